@@ -0,0 +1,375 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/go-gost/gosocks5"
+	"github.com/go-log/log"
+)
+
+// Middleware wraps a Handler to add the functionality such as the traffic accounting.
+type Middleware func(Handler) Handler
+
+// ErrQuotaExceeded is returned if the traffic quota of the user is used up.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// accountingFlushSize is the size of the traffic recorded to the store at once,
+// the rest is recorded when the connection is closed.
+const accountingFlushSize = 64 * 1024
+
+// accountingMaxHeaderSize is the max size of the HTTP request header read for the user,
+// the larger requests are rejected with 431 (Request Header Fields Too Large).
+const accountingMaxHeaderSize = 64 * 1024
+
+// AccountingStore stores the traffic and the quota of the users.
+//
+// The store is shared by all the connections, so the implementations must be safe for concurrent use.
+// A database backend can implement Record by accumulating the counters of the user, e.g. 'UPDATE ... SET
+// bytes_in = bytes_in + ?', and CheckQuota by subtracting the recorded traffic from the quota of the user.
+type AccountingStore interface {
+	// Record adds the traffic of the user, bytesIn is the data received from the client,
+	// bytesOut is the data sent to the client.
+	Record(user string, bytesIn, bytesOut int64)
+	// CheckQuota returns the remaining traffic of the user, the new connections of the user
+	// are rejected if the remaining is not positive or the error is not nil.
+	CheckQuota(user string) (remaining int64, err error)
+}
+
+// AccountingMiddleware creates a Middleware which records the traffic of the authenticated users to the store,
+// the connections are rejected with 429 (Too Many Requests) for HTTP or the authentication failure for SOCKS5
+// if the quota of the user is used up.
+//
+// The user is the username of the HTTP Proxy-Authorization (Basic) header or the SOCKS5 username/password
+// authentication, which is accounted only if it is accepted by the wrapped handler.
+// The anonymous connections and the other protocols are passed to the wrapped handler without accounting.
+// The HTTP requests are rejected with 431 (Request Header Fields Too Large) if the header exceeds 64KB,
+// as the user of them can not be known.
+// For the TLS methods of the SOCKS5 extension, the authentication is encrypted,
+// so the user is reported by the SOCKS5 handler after it is accepted.
+func AccountingMiddleware(store AccountingStore) Middleware {
+	return func(h Handler) Handler {
+		return &accountingHandler{handler: h, store: store}
+	}
+}
+
+type accountingHandler struct {
+	handler Handler
+	store   AccountingStore
+}
+
+func (h *accountingHandler) Init(options ...HandlerOption) {
+	h.handler.Init(options...)
+}
+
+func (h *accountingHandler) Handle(conn net.Conn) {
+	br := bufio.NewReaderSize(conn, accountingMaxHeaderSize)
+	b, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	cc := &accountingConn{
+		Conn:    &bufferdConn{Conn: conn, br: br},
+		store:   h.store,
+		socks5:  b[0] == gosocks5.Ver5,
+		method:  -1,
+		checker: h.checkQuota,
+	}
+	if !cc.socks5 {
+		user, err := httpProxyUser(br)
+		if err != nil {
+			// the user can not be known, the request is not passed to the handler unaccounted.
+			log.Logf("[accounting] %s - %s : %v", conn.RemoteAddr(), conn.LocalAddr(), err)
+			writeAccountingResponse(conn, http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		if user != "" && !h.checkQuota(conn, user) {
+			writeAccountingResponse(conn, http.StatusTooManyRequests)
+			return
+		}
+		cc.user = user
+	}
+	h.handler.Handle(cc)
+}
+
+// checkQuota reports whether the user is allowed to make a new connection.
+func (h *accountingHandler) checkQuota(conn net.Conn, user string) bool {
+	remaining, err := h.store.CheckQuota(user)
+	if err != nil {
+		log.Logf("[accounting] %s - %s : %s: %v", conn.RemoteAddr(), conn.LocalAddr(), user, err)
+		return false
+	}
+	if remaining <= 0 {
+		log.Logf("[accounting] %s - %s : %s: %v", conn.RemoteAddr(), conn.LocalAddr(), user, ErrQuotaExceeded)
+		return false
+	}
+	return true
+}
+
+// writeAccountingResponse writes the HTTP response of the status code and closes the connection.
+func writeAccountingResponse(conn net.Conn, code int) {
+	resp := &http.Response{
+		StatusCode: code,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+	}
+	resp.Header.Set("Connection", "close")
+	resp.Write(conn)
+	conn.Close()
+}
+
+// errHeaderTooLarge is returned if the HTTP request header exceeds accountingMaxHeaderSize.
+var errHeaderTooLarge = errors.New("accounting: request header too large")
+
+// httpMethods are the prefixes of the HTTP request lines.
+var httpMethods = []string{"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "CONNECT ", "OPTIONS ", "TRACE ", "PATCH "}
+
+// httpProxyUser returns the user of the Proxy-Authorization header of the buffered HTTP request,
+// the user is empty for the anonymous requests and the other protocols.
+// errHeaderTooLarge is returned if the header of the HTTP request exceeds the buffer size.
+func httpProxyUser(br *bufio.Reader) (string, error) {
+	for n := 1; ; n++ {
+		b, err := br.Peek(n)
+		if err == bufio.ErrBufferFull && isHTTPRequest(b) {
+			return "", errHeaderTooLarge
+		}
+		if err != nil {
+			return "", nil
+		}
+		if !bytes.HasSuffix(b, []byte("\r\n\r\n")) {
+			continue
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			return "", nil
+		}
+		user, _, _ := basicProxyAuth(req.Header.Get("Proxy-Authorization"))
+		return user, nil
+	}
+}
+
+// isHTTPRequest reports whether the data starts with the request line of an HTTP request.
+func isHTTPRequest(b []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountingConn counts the traffic of the connection,
+// the user is recognized from the SOCKS5 authentication if it is not known yet.
+type accountingConn struct {
+	net.Conn
+	store   AccountingStore
+	checker func(conn net.Conn, user string) bool
+	socks5  bool
+
+	mux      sync.Mutex
+	user     string
+	accepted bool // the user is accepted by the handler
+	rejected bool
+	method   int // the method selected by the SOCKS5 server, -1 if it is unknown yet
+	in, out  int64
+	request  []byte // the data received for the SOCKS5 authentication
+	response []byte // the data sent after the user is recognized
+}
+
+func (c *accountingConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.in += int64(n)
+	if c.socks5 && c.user == "" && !c.rejected {
+		if c.method == int(MethodTLS) || c.method == int(MethodTLSAuth) {
+			// the authentication is encrypted, the user is reported by the handler.
+			c.socks5, c.request = false, nil
+			return
+		}
+		c.request = append(c.request, b[:n]...)
+		if user, done := parseSOCKS5User(c.request); done {
+			c.request = nil
+			if user == "" {
+				// no username/password authentication.
+				c.socks5 = false
+				return
+			}
+			c.user = user
+			if !c.checker(c.Conn, user) {
+				c.rejected = true
+				c.Conn.Write([]byte{gosocks5.UserPassVer, gosocks5.Failure})
+				return 0, ErrQuotaExceeded
+			}
+		}
+	}
+	c.flush(false)
+	return
+}
+
+func (c *accountingConn) Write(b []byte) (n int, err error) {
+	c.mux.Lock()
+	if c.rejected {
+		c.mux.Unlock()
+		return 0, ErrQuotaExceeded
+	}
+	c.mux.Unlock()
+
+	n, err = c.Conn.Write(b)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.out += int64(n)
+	if c.socks5 && c.user == "" && c.method < 0 {
+		// the method selection response.
+		c.response = append(c.response, b[:n]...)
+		if len(c.response) >= 2 {
+			c.method = int(c.response[1])
+			c.response = nil
+		}
+	}
+	if c.user != "" && !c.accepted {
+		c.response = append(c.response, b[:n]...)
+		c.checkAccepted()
+	}
+	c.flush(false)
+	return
+}
+
+// acceptUser accounts the connection for the user accepted by the handler,
+// it reports false if the quota of the user is used up.
+func (c *accountingConn) acceptUser(user string) bool {
+	if !c.checker(c.Conn, user) {
+		return false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.user, c.accepted = user, true
+	c.flush(false)
+	return true
+}
+
+// checkAccepted checks the authentication response of the handler.
+func (c *accountingConn) checkAccepted() {
+	if c.socks5 {
+		// the username/password response.
+		if len(c.response) >= 2 {
+			if c.response[0] == gosocks5.UserPassVer && c.response[1] == gosocks5.Succeeded {
+				c.accepted = true
+			} else {
+				c.user = ""
+			}
+			c.response = nil
+		}
+		return
+	}
+	// the status line of the HTTP response, 'HTTP/1.1 407 ...'.
+	if len(c.response) >= 12 {
+		if string(c.response[9:12]) != "407" {
+			c.accepted = true
+		} else {
+			c.user = ""
+		}
+		c.response = nil
+	}
+}
+
+func (c *accountingConn) flush(force bool) {
+	if !c.accepted || c.user == "" {
+		if force {
+			c.in, c.out = 0, 0
+		}
+		return
+	}
+	if force && (c.in > 0 || c.out > 0) || c.in+c.out >= accountingFlushSize {
+		c.store.Record(c.user, c.in, c.out)
+		c.in, c.out = 0, 0
+	}
+}
+
+func (c *accountingConn) Close() error {
+	c.mux.Lock()
+	c.flush(true)
+	c.mux.Unlock()
+	return c.Conn.Close()
+}
+
+// parseSOCKS5User parses the username of the SOCKS5 username/password authentication (RFC 1929)
+// following the method selection request, it reports false if the data is incomplete.
+// The username is empty if the client does not use the username/password authentication.
+func parseSOCKS5User(b []byte) (user string, done bool) {
+	if len(b) < 2 {
+		return "", false
+	}
+	n := 2 + int(b[1]) // the method selection request
+	if len(b) < n+2 {
+		return "", false
+	}
+	if b[n] != gosocks5.UserPassVer {
+		return "", true
+	}
+	ulen := int(b[n+1])
+	if len(b) < n+2+ulen {
+		return "", false
+	}
+	return string(b[n+2 : n+2+ulen]), true
+}
+
+// MemoryAccountingStore is an in-memory AccountingStore, the users without quota are unlimited.
+type MemoryAccountingStore struct {
+	mux    sync.Mutex
+	quotas map[string]int64
+	in     map[string]int64
+	out    map[string]int64
+}
+
+// NewMemoryAccountingStore creates a MemoryAccountingStore.
+func NewMemoryAccountingStore() *MemoryAccountingStore {
+	return &MemoryAccountingStore{
+		quotas: make(map[string]int64),
+		in:     make(map[string]int64),
+		out:    make(map[string]int64),
+	}
+}
+
+// SetQuota sets the quota (the sum of the received and sent bytes) of the user.
+func (s *MemoryAccountingStore) SetQuota(user string, quota int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.quotas[user] = quota
+}
+
+// Usage returns the recorded traffic of the user.
+func (s *MemoryAccountingStore) Usage(user string) (bytesIn, bytesOut int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.in[user], s.out[user]
+}
+
+// Record implements AccountingStore.
+func (s *MemoryAccountingStore) Record(user string, bytesIn, bytesOut int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.in[user] += bytesIn
+	s.out[user] += bytesOut
+}
+
+// CheckQuota implements AccountingStore.
+func (s *MemoryAccountingStore) CheckQuota(user string) (int64, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	quota, ok := s.quotas[user]
+	if !ok {
+		return math.MaxInt64, nil
+	}
+	return quota - s.in[user] - s.out[user], nil
+}
@@ -0,0 +1,127 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/rand"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func accountingRoundtrip(targetURL string, store AccountingStore, connector Connector, handler Handler) error {
+	ln, err := TCPListener("")
+	if err != nil {
+		return err
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  AccountingMiddleware(store)(handler),
+	}
+	go server.Run()
+	defer server.Close()
+
+	data := make([]byte, 1024)
+	rand.Read(data)
+	return proxyRoundtrip(&Client{Connector: connector, Transporter: TCPTransporter()}, server, targetURL, data)
+}
+
+// waitUsage waits for the traffic of the user recorded when the server side connection is closed.
+func waitUsage(store *MemoryAccountingStore, user string) (in, out int64) {
+	for i := 0; i < 100; i++ {
+		if in, out = store.Usage(user); in > 0 || out > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return
+}
+
+func TestAccountingMiddleware(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	users := []*url.Userinfo{url.UserPassword("alice", "123456"), url.UserPassword("bob", "654321")}
+	tests := []struct {
+		name      string
+		connector func(user *url.Userinfo) Connector
+		handler   func() Handler
+	}{
+		{"http", HTTPConnector, func() Handler { return HTTPHandler(UsersHandlerOption(users...)) }},
+		{"socks5", SOCKS5Connector, func() Handler { return SOCKS5Handler(UsersHandlerOption(users...)) }},
+	}
+
+	for _, tc := range tests {
+		store := NewMemoryAccountingStore()
+		store.SetQuota("alice", 1<<20)
+
+		if err := accountingRoundtrip(httpSrv.URL, store, tc.connector(users[0]), tc.handler()); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		in, out := waitUsage(store, "alice")
+		if in < 1024 || out < 1024 {
+			t.Errorf("%s: got usage in %d out %d, want >= 1024", tc.name, in, out)
+		}
+
+		// the user without quota is unlimited.
+		if err := accountingRoundtrip(httpSrv.URL, store, tc.connector(users[1]), tc.handler()); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+
+		// the traffic of the rejected authentication is not accounted.
+		if err := accountingRoundtrip(httpSrv.URL, store, tc.connector(url.UserPassword("alice", "wrong")), tc.handler()); err == nil {
+			t.Errorf("%s: authentication with wrong password should fail", tc.name)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if in2, out2 := store.Usage("alice"); in2 != in || out2 != out {
+			t.Errorf("%s: rejected authentication is accounted", tc.name)
+		}
+
+		store.SetQuota("alice", in+out)
+		if err := accountingRoundtrip(httpSrv.URL, store, tc.connector(users[0]), tc.handler()); err == nil {
+			t.Errorf("%s: got nil error, want quota exceeded", tc.name)
+		}
+	}
+}
+
+func TestParseSOCKS5User(t *testing.T) {
+	tests := []struct {
+		data []byte
+		user string
+		done bool
+	}{
+		{[]byte{5}, "", false},
+		{[]byte{5, 1, 2}, "", false},
+		{[]byte{5, 1, 0, 5}, "", false},
+		{[]byte{5, 1, 0, 5, 1, 0}, "", true},
+		{[]byte{5, 1, 2, 1, 5, 'a', 'l'}, "", false},
+		{[]byte{5, 1, 2, 1, 5, 'a', 'l', 'i', 'c', 'e'}, "alice", true},
+	}
+	for i, tc := range tests {
+		user, done := parseSOCKS5User(tc.data)
+		if user != tc.user || done != tc.done {
+			t.Errorf("#%d: got %q %v, want %q %v", i, user, done, tc.user, tc.done)
+		}
+	}
+}
+
+func TestHTTPProxyUser(t *testing.T) {
+	auth := "Proxy-Authorization: Basic YWxpY2U6MTIzNDU2\r\n" // alice:123456
+	tests := []struct {
+		data string
+		user string
+		err  error
+	}{
+		{"CONNECT example.com:443 HTTP/1.1\r\n" + auth + "\r\n", "alice", nil},
+		{"CONNECT example.com:443 HTTP/1.1\r\n\r\n", "", nil},
+		{"CONNECT example.com:443 HTTP/1.1\r\nX-Padding: " + strings.Repeat("a", 8192) + "\r\n" + auth + "\r\n", "", errHeaderTooLarge},
+		{strings.Repeat("\x00", 8192), "", nil},
+	}
+	for i, tc := range tests {
+		user, err := httpProxyUser(bufio.NewReaderSize(strings.NewReader(tc.data), 4096))
+		if user != tc.user || err != tc.err {
+			t.Errorf("#%d: got %q %v, want %q %v", i, user, err, tc.user, tc.err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gost
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-log/log"
+)
+
+// GFWDetector detects whether the failures of a transporter are caused by the blocking of the firewall.
+type GFWDetector interface {
+	// IsBlocked reports whether the transporter is blocked by the error err of the dialing or handshaking,
+	// attempt is the number of the consecutive failures of the transporter, starting from 1.
+	IsBlocked(err error, attempt int) bool
+}
+
+type resetGFWDetector struct {
+	attempts int
+}
+
+// ResetGFWDetector creates a GFWDetector that treats the connection reset, the unexpected EOF and the timeout
+// as the blocking patterns of the active probing, the transporter is blocked after attempts consecutive failures.
+// The connection refused is not a blocking pattern, as it is usually that the server is down.
+func ResetGFWDetector(attempts int) GFWDetector {
+	if attempts <= 0 {
+		attempts = 1
+	}
+	return &resetGFWDetector{attempts: attempts}
+}
+
+func (d *resetGFWDetector) IsBlocked(err error, attempt int) bool {
+	if attempt < d.attempts || err == nil {
+		return false
+	}
+	var nerr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return false
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &nerr) && nerr.Timeout():
+		return true
+	}
+	// the errors of the TLS and SSH libraries are not wrapped.
+	s := err.Error()
+	return strings.Contains(s, "connection reset") || strings.Contains(s, "EOF")
+}
+
+// WithAdaptiveStateFile specifies the file used by AdaptiveTransporter to persist the index of the selected
+// transporter, so that the blocked transporters are not tried again after restart.
+func WithAdaptiveStateFile(path string) TransporterOption {
+	return func(opts *TransporterOptions) {
+		opts.adaptiveStateFile = path
+	}
+}
+
+type adaptiveTransporter struct {
+	transporters []Transporter
+	detector     GFWDetector
+	stateFile    string
+	mux          sync.Mutex
+	index        int // the selected transporter
+	failures     int // the consecutive failures of the selected transporter
+	saved        int // the index persisted to the state file
+}
+
+// AdaptiveTransporter creates a Transporter that uses the transporters in turn. It starts from the first one,
+// or the one persisted by WithAdaptiveStateFile, and cycles to the next one when the detector reports that
+// the current one is blocked, e.g. the plain TLS is reset by the firewall and the obfuscated ones are tried next.
+// The selection is persisted to the state file when the transporter succeeds.
+//
+// The connection is handshaked by the transporter that dials it.
+func AdaptiveTransporter(transporters []Transporter, detector GFWDetector, opts ...TransporterOption) Transporter {
+	options := &TransporterOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if detector == nil {
+		detector = ResetGFWDetector(1)
+	}
+	tr := &adaptiveTransporter{
+		transporters: transporters,
+		detector:     detector,
+		stateFile:    options.adaptiveStateFile,
+	}
+	if tr.stateFile != "" {
+		if b, err := os.ReadFile(tr.stateFile); err == nil {
+			if n, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && n >= 0 && n < len(transporters) {
+				tr.index = n
+			}
+		}
+	}
+	tr.saved = tr.index
+	return tr
+}
+
+type adaptiveConn struct {
+	net.Conn
+	index int
+}
+
+func (tr *adaptiveTransporter) current() (int, Transporter) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+	return tr.index, tr.transporters[tr.index]
+}
+
+// report records the result of the transporter of index.
+func (tr *adaptiveTransporter) report(index int, err error) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	// the result of a transporter that is no longer selected.
+	if index != tr.index {
+		return
+	}
+	if err == nil {
+		tr.failures = 0
+		if tr.stateFile != "" && tr.saved != tr.index {
+			if err := os.WriteFile(tr.stateFile, []byte(strconv.Itoa(tr.index)), 0644); err != nil {
+				log.Logf("[adaptive] %s", err)
+			} else {
+				tr.saved = tr.index
+			}
+		}
+		return
+	}
+
+	tr.failures++
+	if len(tr.transporters) > 1 && tr.detector.IsBlocked(err, tr.failures) {
+		tr.index = (tr.index + 1) % len(tr.transporters)
+		tr.failures = 0
+		log.Logf("[adaptive] transporter #%d is blocked (%s), switch to #%d", index, err, tr.index)
+	}
+}
+
+func (tr *adaptiveTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	index, t := tr.current()
+	conn, err := t.Dial(addr, options...)
+	if err != nil {
+		tr.report(index, err)
+		return nil, err
+	}
+	return &adaptiveConn{Conn: conn, index: index}, nil
+}
+
+func (tr *adaptiveTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	index, t := tr.current()
+	if c, ok := conn.(*adaptiveConn); ok {
+		index, t = c.index, tr.transporters[c.index]
+		conn = c.Conn
+	}
+	cc, err := t.Handshake(conn, options...)
+	tr.report(index, err)
+	return cc, err
+}
+
+func (tr *adaptiveTransporter) Multiplex() bool {
+	_, t := tr.current()
+	return t.Multiplex()
+}
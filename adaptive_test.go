@@ -0,0 +1,92 @@
+package gost
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// blockedTransporter is the transporter reset by the firewall in the handshake.
+type blockedTransporter struct {
+	tcpTransporter
+	handshakes int
+}
+
+func (tr *blockedTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	tr.handshakes++
+	return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+}
+
+func TestAdaptiveTransporter(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: HTTPHandler()}
+	go server.Run()
+	defer server.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "adaptive")
+	blocked := &blockedTransporter{}
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: AdaptiveTransporter([]Transporter{blocked, TCPTransporter()}, ResetGFWDetector(2), WithAdaptiveStateFile(stateFile)),
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := proxyRoundtrip(client, server, httpSrv.URL, []byte("hello")); err == nil {
+			t.Fatalf("#%d should failed", i)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := proxyRoundtrip(client, server, httpSrv.URL, []byte("hello")); err != nil {
+			t.Fatalf("#%d got error %v", i, err)
+		}
+	}
+	if blocked.handshakes != 2 {
+		t.Errorf("got %d handshakes of the blocked transporter, want 2", blocked.handshakes)
+	}
+	if b, _ := os.ReadFile(stateFile); string(b) != "1" {
+		t.Errorf("got state %q, want 1", b)
+	}
+
+	// the blocked transporter is not tried after restart.
+	client.Transporter = AdaptiveTransporter([]Transporter{blocked, TCPTransporter()}, nil, WithAdaptiveStateFile(stateFile))
+	if err := proxyRoundtrip(client, server, httpSrv.URL, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if blocked.handshakes != 2 {
+		t.Errorf("got %d handshakes of the blocked transporter, want 2", blocked.handshakes)
+	}
+}
+
+func TestResetGFWDetector(t *testing.T) {
+	tests := []struct {
+		err     error
+		attempt int
+		blocked bool
+	}{
+		{syscall.ECONNRESET, 1, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, 1, true},
+		{io.ErrUnexpectedEOF, 1, true},
+		{errors.New("tls: first record does not look like a TLS handshake, EOF"), 1, true},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, 1, false},
+		{errors.New("407 Proxy Authentication Required"), 1, false},
+		{nil, 1, false},
+		{syscall.ECONNRESET, 0, false},
+	}
+	d := ResetGFWDetector(1)
+	for i, tc := range tests {
+		if blocked := d.IsBlocked(tc.err, tc.attempt); blocked != tc.blocked {
+			t.Errorf("#%d %v: got %v, want %v", i, tc.err, blocked, tc.blocked)
+		}
+	}
+}
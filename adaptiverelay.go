@@ -0,0 +1,132 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+var (
+	// AdaptiveRelayMinBufferSize is the initial buffer size of AdaptiveRelay.
+	AdaptiveRelayMinBufferSize = 4 * 1024
+	// AdaptiveRelayMaxBufferSize is the maximum buffer size of AdaptiveRelay.
+	AdaptiveRelayMaxBufferSize = 256 * 1024
+)
+
+// adaptiveShrinkReads is the number of the consecutive small reads after which the buffer shrinks.
+const adaptiveShrinkReads = 8
+
+var adaptiveRelayPeak int64
+
+// AdaptiveRelayPeakBufferSize returns the peak buffer size used by AdaptiveRelay, for tuning AdaptiveRelayMaxBufferSize.
+func AdaptiveRelayPeakBufferSize() int {
+	return int(atomic.LoadInt64(&adaptiveRelayPeak))
+}
+
+// AdaptiveRelay relays the data between src and dst in both directions, with the buffers sized by the throughput.
+// Each direction starts with a buffer of AdaptiveRelayMinBufferSize, which doubles every time it is filled by a read,
+// up to AdaptiveRelayMaxBufferSize, and shrinks back to the minimum after several consecutive reads smaller than
+// half of it. So the short-lived connections use little memory, and the bulk transfers use the large buffers.
+//
+// It returns the number of bytes copied from src to dst and from dst to src. Both connections are closed
+// when either direction ends, the error is that of the direction ending first, io.EOF is not an error.
+func AdaptiveRelay(dst, src net.Conn) (int64, int64, error) {
+	type result struct {
+		n   int64
+		err error
+	}
+	up, down := make(chan result, 1), make(chan result, 1)
+	go func() {
+		n, err := adaptiveCopy(dst, src)
+		up <- result{n, err}
+	}()
+	go func() {
+		n, err := adaptiveCopy(src, dst)
+		down <- result{n, err}
+	}()
+
+	var first, r1, r2 result
+	select {
+	case r1 = <-up:
+		first = r1
+		dst.Close()
+		src.Close()
+		r2 = <-down
+	case r2 = <-down:
+		first = r2
+		dst.Close()
+		src.Close()
+		r1 = <-up
+	}
+	return r1.n, r2.n, first.err
+}
+
+// adaptiveBuffer is the buffer resized by the sizes of the reads.
+type adaptiveBuffer struct {
+	buf   []byte
+	small int // the number of the consecutive small reads
+}
+
+func newAdaptiveBuffer() *adaptiveBuffer {
+	b := &adaptiveBuffer{}
+	b.resize(AdaptiveRelayMinBufferSize)
+	return b
+}
+
+func (b *adaptiveBuffer) resize(size int) {
+	b.buf = make([]byte, size)
+	b.small = 0
+	for {
+		peak := atomic.LoadInt64(&adaptiveRelayPeak)
+		if int64(size) <= peak || atomic.CompareAndSwapInt64(&adaptiveRelayPeak, peak, int64(size)) {
+			return
+		}
+	}
+}
+
+// adjust resizes the buffer after a read of n bytes.
+func (b *adaptiveBuffer) adjust(n int) {
+	size := len(b.buf)
+	switch {
+	case n == size:
+		if size < AdaptiveRelayMaxBufferSize {
+			size *= 2
+			if size > AdaptiveRelayMaxBufferSize {
+				size = AdaptiveRelayMaxBufferSize
+			}
+			b.resize(size)
+		}
+		b.small = 0
+	case n < size/2:
+		b.small++
+		if b.small >= adaptiveShrinkReads && size > AdaptiveRelayMinBufferSize {
+			b.resize(AdaptiveRelayMinBufferSize)
+		}
+	default:
+		b.small = 0
+	}
+}
+
+func adaptiveCopy(dst io.Writer, src io.Reader) (written int64, err error) {
+	b := newAdaptiveBuffer()
+	for {
+		nr, er := src.Read(b.buf)
+		if nr > 0 {
+			nw, ew := dst.Write(b.buf[:nr])
+			written += int64(nw)
+			if ew != nil {
+				return written, ew
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+			b.adjust(nr)
+		}
+		if er != nil {
+			if er == io.EOF {
+				er = nil
+			}
+			return written, er
+		}
+	}
+}
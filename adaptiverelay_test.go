@@ -0,0 +1,89 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestAdaptiveBuffer(t *testing.T) {
+	b := newAdaptiveBuffer()
+	if len(b.buf) != AdaptiveRelayMinBufferSize {
+		t.Fatalf("initial size %d", len(b.buf))
+	}
+
+	for i := 0; i < 10; i++ {
+		b.adjust(len(b.buf))
+	}
+	if len(b.buf) != AdaptiveRelayMaxBufferSize {
+		t.Errorf("size %d after the full reads, want %d", len(b.buf), AdaptiveRelayMaxBufferSize)
+	}
+	if peak := AdaptiveRelayPeakBufferSize(); peak != AdaptiveRelayMaxBufferSize {
+		t.Errorf("peak %d, want %d", peak, AdaptiveRelayMaxBufferSize)
+	}
+
+	// a large read resets the small reads.
+	for i := 0; i < adaptiveShrinkReads-1; i++ {
+		b.adjust(1)
+	}
+	b.adjust(len(b.buf) * 3 / 4)
+	b.adjust(1)
+	if len(b.buf) != AdaptiveRelayMaxBufferSize {
+		t.Errorf("size %d, want %d", len(b.buf), AdaptiveRelayMaxBufferSize)
+	}
+
+	for i := 0; i < adaptiveShrinkReads; i++ {
+		b.adjust(100)
+	}
+	if len(b.buf) != AdaptiveRelayMinBufferSize {
+		t.Errorf("size %d after the small reads, want %d", len(b.buf), AdaptiveRelayMinBufferSize)
+	}
+}
+
+func TestAdaptiveRelay(t *testing.T) {
+	client, c1 := net.Pipe()
+	c2, server := net.Pipe()
+
+	type result struct {
+		up, down int64
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		up, down, err := AdaptiveRelay(c2, c1)
+		done <- result{up, down, err}
+	}()
+
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	go server.Write([]byte("pong"))
+	go func() {
+		client.Write(data)
+		io.ReadFull(client, make([]byte, 4))
+		client.Close()
+	}()
+
+	b, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("got %d bytes, want %d", len(b), len(data))
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Error(r.err)
+	}
+	if r.up != int64(len(data)) {
+		t.Errorf("up %d, want %d", r.up, len(data))
+	}
+	if r.down != 4 {
+		t.Errorf("down %d", r.down)
+	}
+	if peak := AdaptiveRelayPeakBufferSize(); peak != AdaptiveRelayMaxBufferSize {
+		t.Errorf("peak %d, want %d", peak, AdaptiveRelayMaxBufferSize)
+	}
+}
@@ -0,0 +1,122 @@
+package gost
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/go-log/log"
+)
+
+// ALPNMux dispatches the connections of a TLS listener to the handlers by the protocol negotiated by ALPN,
+// so multiple protocols (e.g. HTTP/1.1, HTTP/2 and the proxy protocols) can share a single port.
+// The TLS config of the listener must include the protocols in NextProtos.
+type ALPNMux struct {
+	ln       Listener
+	mux      sync.RWMutex
+	handlers map[string]Handler
+	def      Handler
+}
+
+// ALPNMuxListener creates an ALPNMux with the TLS listener, e.g. TLSListener.
+func ALPNMuxListener(ln Listener) *ALPNMux {
+	return &ALPNMux{
+		ln:       ln,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler for the ALPN protocol.
+func (l *ALPNMux) Handle(alpn string, handler Handler) error {
+	if alpn == "" || handler == nil {
+		return errors.New("invalid ALPN handler")
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if _, ok := l.handlers[alpn]; ok {
+		return fmt.Errorf("ALPN %s is already handled", alpn)
+	}
+	l.handlers[alpn] = handler
+	return nil
+}
+
+// HandleDefault registers the handler for the connections without ALPN or with an unknown protocol,
+// these connections are closed if the default handler is not set.
+func (l *ALPNMux) HandleDefault(handler Handler) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.def = handler
+}
+
+// Serve accepts the connections and dispatches them to the handlers, each connection is handled in a goroutine.
+func (l *ALPNMux) Serve() error {
+	s := &Server{Listener: l.ln}
+	return s.Serve(&alpnMuxHandler{l: l})
+}
+
+// Addr returns the address of the listener.
+func (l *ALPNMux) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Close closes the listener.
+func (l *ALPNMux) Close() error {
+	return l.ln.Close()
+}
+
+func (l *ALPNMux) handler(alpn string) Handler {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	if h, ok := l.handlers[alpn]; ok {
+		return h
+	}
+	return l.def
+}
+
+// tlsStateConn is the connection of the TLS listeners.
+type tlsStateConn interface {
+	net.Conn
+	HandshakeContext(ctx context.Context) error
+	ConnectionState() tls.ConnectionState
+}
+
+type alpnMuxHandler struct {
+	l *ALPNMux
+}
+
+func (h *alpnMuxHandler) Init(options ...HandlerOption) {
+}
+
+func (h *alpnMuxHandler) Handle(conn net.Conn) {
+	tc, ok := conn.(tlsStateConn)
+	if !ok {
+		log.Logf("[alpn] %s - %s : not a TLS connection", conn.RemoteAddr(), conn.LocalAddr())
+		conn.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	err := tc.HandshakeContext(ctx)
+	cancel()
+	if err != nil {
+		log.Logf("[alpn] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		conn.Close()
+		return
+	}
+
+	alpn := tc.ConnectionState().NegotiatedProtocol
+	handler := h.l.handler(alpn)
+	if handler == nil {
+		log.Logf("[alpn] %s - %s : no handler for protocol %q", conn.RemoteAddr(), conn.LocalAddr(), alpn)
+		conn.Close()
+		return
+	}
+	if Debug {
+		log.Logf("[alpn] %s - %s : protocol %q", conn.RemoteAddr(), conn.LocalAddr(), alpn)
+	}
+	handler.Handle(conn)
+}
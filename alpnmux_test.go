@@ -0,0 +1,65 @@
+package gost
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+)
+
+// alpnTestHandler writes its name to the connection.
+type alpnTestHandler string
+
+func (h alpnTestHandler) Init(options ...HandlerOption) {}
+
+func (h alpnTestHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+	conn.Write([]byte(h))
+}
+
+func TestALPNMuxListener(t *testing.T) {
+	config := DefaultTLSConfig.Clone()
+	config.NextProtos = []string{"h2", "http/1.1", "gost"}
+	ln, err := TLSListener("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := ALPNMuxListener(ln)
+	defer mux.Close()
+
+	if err := mux.Handle("http/1.1", alpnTestHandler("http")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Handle("gost", alpnTestHandler("gost")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mux.Handle("gost", alpnTestHandler("gost")); err == nil {
+		t.Error("the duplicate protocol should be rejected")
+	}
+	mux.HandleDefault(alpnTestHandler("default"))
+	go mux.Serve()
+
+	tests := []struct {
+		protos []string
+		want   string
+	}{
+		{[]string{"gost"}, "gost"},
+		{[]string{"http/1.1"}, "http"},
+		{[]string{"h2"}, "default"},
+		{nil, "default"},
+	}
+	for _, tc := range tests {
+		conn, err := tls.Dial("tcp", mux.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: tc.protos})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.protos, b, tc.want)
+		}
+	}
+}
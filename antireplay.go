@@ -0,0 +1,197 @@
+package gost
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/go-log/log"
+)
+
+// ErrReplayed is returned by the connection of AntiReplayConn if a replayed chunk is received.
+var ErrReplayed = errors.New("replayed chunk")
+
+const (
+	// defaultReplayWindowSize is the window size of AntiReplayConn if it is not positive.
+	defaultReplayWindowSize = 1024
+	antiReplayNonceSize     = 8
+	antiReplayMaxChunk      = 0xffff
+)
+
+// AntiReplayConn wraps the connection to reject the replayed data. Each chunk written to the connection is prepended
+// with an 8-byte nonce, the nonces of a connection start from a random value and increase by one for each chunk.
+// The receiver tracks the last windowSize nonces, and rejects the chunks whose nonce is already seen in the window
+// or falls before the window.
+//
+// A stream connection returns ErrReplayed on a replayed chunk, a packet connection (e.g. UDP) drops the replayed datagrams.
+// It should wrap the encrypted connection, so the nonces are protected by the encryption.
+func AntiReplayConn(conn net.Conn, windowSize int) net.Conn {
+	if windowSize <= 0 {
+		windowSize = defaultReplayWindowSize
+	}
+	var b [antiReplayNonceSize]byte
+	rand.Read(b[:])
+	_, packet := conn.(net.PacketConn)
+	return &antiReplayConn{
+		Conn:   conn,
+		packet: packet,
+		nonce:  binary.BigEndian.Uint64(b[:]),
+		window: newReplayWindow(windowSize),
+	}
+}
+
+type antiReplayConn struct {
+	net.Conn
+	packet bool
+	window *replayWindow
+
+	wmux  sync.Mutex
+	nonce uint64 // the nonce of the next chunk
+
+	rmux sync.Mutex
+	rbuf []byte // the data of the chunk not read yet
+}
+
+func (c *antiReplayConn) Write(b []byte) (n int, err error) {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	if c.packet {
+		buf := make([]byte, antiReplayNonceSize+len(b))
+		binary.BigEndian.PutUint64(buf, c.nonce)
+		copy(buf[antiReplayNonceSize:], b)
+		c.nonce++
+		if _, err = c.Conn.Write(buf); err != nil {
+			return
+		}
+		return len(b), nil
+	}
+
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > antiReplayMaxChunk {
+			chunk = chunk[:antiReplayMaxChunk]
+		}
+		buf := make([]byte, antiReplayNonceSize+2+len(chunk))
+		binary.BigEndian.PutUint64(buf, c.nonce)
+		binary.BigEndian.PutUint16(buf[antiReplayNonceSize:], uint16(len(chunk)))
+		copy(buf[antiReplayNonceSize+2:], chunk)
+		c.nonce++
+		if _, err = c.Conn.Write(buf); err != nil {
+			return
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return
+}
+
+func (c *antiReplayConn) Read(b []byte) (n int, err error) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	if c.packet {
+		return c.readPacket(b)
+	}
+
+	if len(c.rbuf) == 0 {
+		var header [antiReplayNonceSize + 2]byte
+		if _, err = io.ReadFull(c.Conn, header[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint16(header[antiReplayNonceSize:]))
+		if _, err = io.ReadFull(c.Conn, data); err != nil {
+			return
+		}
+		if !c.window.check(binary.BigEndian.Uint64(header[:])) {
+			return 0, ErrReplayed
+		}
+		c.rbuf = data
+	}
+	n = copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return
+}
+
+func (c *antiReplayConn) readPacket(b []byte) (n int, err error) {
+	buf := make([]byte, antiReplayNonceSize+len(b))
+	for {
+		n, err = c.Conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if n < antiReplayNonceSize {
+			continue
+		}
+		if !c.window.check(binary.BigEndian.Uint64(buf)) {
+			if Debug {
+				log.Logf("[antireplay] %s - %s : %s", c.RemoteAddr(), c.LocalAddr(), ErrReplayed)
+			}
+			continue
+		}
+		return copy(b, buf[antiReplayNonceSize:n]), nil
+	}
+}
+
+// replayWindow tracks the nonces in a sliding window, it is a circular buffer indexed by the nonce.
+type replayWindow struct {
+	mux     sync.RWMutex
+	size    uint64
+	nonces  []uint64
+	seen    []bool
+	max     uint64 // the max nonce received
+	started bool
+}
+
+func newReplayWindow(size int) *replayWindow {
+	return &replayWindow{
+		size:   uint64(size),
+		nonces: make([]uint64, size),
+		seen:   make([]bool, size),
+	}
+}
+
+// check reports whether the nonce is accepted, and records it.
+func (w *replayWindow) check(nonce uint64) bool {
+	w.mux.RLock()
+	ok := w.accept(nonce)
+	w.mux.RUnlock()
+	if !ok {
+		return false
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	// check it again, as the nonce may be recorded by another reader.
+	if !w.accept(nonce) {
+		return false
+	}
+	// the nonces wrap around, the difference is compared as signed.
+	if !w.started || int64(nonce-w.max) > 0 {
+		w.max = nonce
+		w.started = true
+	}
+	i := nonce % w.size
+	w.nonces[i], w.seen[i] = nonce, true
+	return true
+}
+
+func (w *replayWindow) accept(nonce uint64) bool {
+	if !w.started {
+		return true
+	}
+	d := w.max - nonce
+	if int64(d) < 0 {
+		// a newer nonce.
+		return true
+	}
+	if d >= w.size {
+		// before the window.
+		return false
+	}
+	i := nonce % w.size
+	return !(w.seen[i] && w.nonces[i] == nonce)
+}
@@ -0,0 +1,121 @@
+package gost
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// recordConn records the data of the last write.
+type recordConn struct {
+	*net.UDPConn
+	last []byte
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.last = append([]byte(nil), b...)
+	return c.UDPConn.Write(b)
+}
+
+func TestAntiReplayConnStream(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// the chunk written by the client.
+	var chunk bytes.Buffer
+	go func() {
+		c := AntiReplayConn(&writeRecorder{Conn: client, w: &chunk}, 16)
+		c.Write([]byte("hello"))
+	}()
+
+	sc := AntiReplayConn(server, 16)
+	b := make([]byte, 16)
+	n, err := sc.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "hello" {
+		t.Fatalf("got %q, want hello", b[:n])
+	}
+
+	go client.Write(chunk.Bytes())
+	if _, err := sc.Read(b); !errors.Is(err, ErrReplayed) {
+		t.Errorf("got %v, want %v", err, ErrReplayed)
+	}
+}
+
+// writeRecorder copies the written data to w.
+type writeRecorder struct {
+	net.Conn
+	w *bytes.Buffer
+}
+
+func (c *writeRecorder) Write(b []byte) (int, error) {
+	c.w.Write(b)
+	return c.Conn.Write(b)
+}
+
+func TestAntiReplayConnPacket(t *testing.T) {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	raw, err := net.DialUDP("udp", nil, pc.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	rc := &recordConn{UDPConn: raw}
+	client := AntiReplayConn(rc, 16)
+	server := AntiReplayConn(pc, 16)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := client.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	// the same packet is sent twice.
+	raw.Write(rc.last)
+	if _, err := client.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 16)
+	for _, want := range []string{"first", "second"} {
+		n, err := server.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b[:n]) != want {
+			t.Errorf("got %q, want %q", b[:n], want)
+		}
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	w := newReplayWindow(4)
+	start := ^uint64(0) - 2 // the nonces wrap around.
+	for _, tc := range []struct {
+		nonce uint64
+		ok    bool
+	}{
+		{start, true},
+		{start, false},
+		{start + 2, true},
+		{start + 1, true}, // out of order in the window
+		{start + 1, false},
+		{start + 5, true},
+		{start + 1, false}, // before the window
+		{start + 3, true},
+		{start + 4, true},
+		{start + 4, false},
+	} {
+		if ok := w.check(tc.nonce); ok != tc.ok {
+			t.Errorf("nonce %d: got %v, want %v", tc.nonce, ok, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,821 @@
+package gost
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/gosocks5"
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("anytls", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			scheme, err := anytlsPaddingScheme(node)
+			if err != nil {
+				return nil, err
+			}
+			return AnyTLSTransporter(opts.TLSConfig, scheme), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			scheme, err := anytlsPaddingScheme(node)
+			if err != nil {
+				return nil, err
+			}
+			var users []*url.Userinfo
+			if node.User != nil {
+				users = append(users, node.User)
+			}
+			return AnyTLSListener(node.Addr, opts.TLSConfig, scheme, users...)
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterProtocol("anytls", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return AnyTLSConnector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return AnyTLSHandler(), nil
+		},
+	})
+}
+
+// anytlsPaddingScheme returns the padding scheme of the file of the node parameter padding-scheme,
+// or the default padding scheme.
+func anytlsPaddingScheme(node Node) (PaddingScheme, error) {
+	file := node.Get("padding-scheme")
+	if file == "" {
+		return DefaultPaddingScheme, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return PaddingScheme{}, err
+	}
+	return ParsePaddingScheme(string(data))
+}
+
+const (
+	anytlsCmdWaste               = 0
+	anytlsCmdSYN                 = 1
+	anytlsCmdPSH                 = 2
+	anytlsCmdFIN                 = 3
+	anytlsCmdSettings            = 4
+	anytlsCmdAlert               = 5
+	anytlsCmdUpdatePaddingScheme = 6
+	anytlsCmdSYNACK              = 7
+	anytlsCmdHeartRequest        = 8
+	anytlsCmdHeartResponse       = 9
+	anytlsCmdServerSettings      = 10
+
+	// anytlsHeaderSize is the size of the frame header [command][stream ID (4 bytes)][length (2 bytes)].
+	anytlsHeaderSize = 7
+	anytlsMaxPayload = 65535
+	// anytlsCheckMark is the check mark "c" of the padding scheme, the rest sizes are skipped if there is no more data.
+	anytlsCheckMark = -1
+)
+
+// DefaultPaddingScheme is the initial padding scheme of the AnyTLS specification.
+// The first packet pads the authentication with 30 null bytes, and the packets up to 8 are split and padded.
+var DefaultPaddingScheme = mustParsePaddingScheme(`stop=8
+0=30-30
+1=100-400
+2=400-500,c,500-1000,c,500-1000,c,500-1000,c,500-1000
+3=9-9,500-1000
+4=500-1000
+5=500-1000
+6=500-1000
+7=500-1000`)
+
+// PaddingScheme is the AnyTLS padding scheme, it controls the record sizes of the first packets of a session.
+// The scheme is the lines of stop=N, the number of the padded packets, and the packet index with the comma separated
+// size ranges min-max, or c for the check mark. The zero value sends no padding.
+type PaddingScheme struct {
+	raw   string
+	stop  int
+	sizes map[int][][2]int
+}
+
+// ParsePaddingScheme parses the text of the padding scheme.
+func ParsePaddingScheme(s string) (PaddingScheme, error) {
+	scheme := PaddingScheme{raw: s, sizes: make(map[int][][2]int)}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return PaddingScheme{}, fmt.Errorf("anytls: invalid padding scheme line %q", line)
+		}
+		n, err := strconv.Atoi(k)
+		if k == "stop" {
+			scheme.stop, err = strconv.Atoi(v)
+		}
+		if err != nil {
+			return PaddingScheme{}, fmt.Errorf("anytls: invalid padding scheme line %q", line)
+		}
+		if k == "stop" {
+			continue
+		}
+		for _, r := range strings.Split(v, ",") {
+			if r == "c" {
+				scheme.sizes[n] = append(scheme.sizes[n], [2]int{anytlsCheckMark, anytlsCheckMark})
+				continue
+			}
+			smin, smax, _ := strings.Cut(r, "-")
+			min, err1 := strconv.Atoi(smin)
+			max, err2 := strconv.Atoi(smax)
+			if err1 != nil || err2 != nil || min < 0 || min > max || max > anytlsMaxPayload {
+				return PaddingScheme{}, fmt.Errorf("anytls: invalid padding size %q", r)
+			}
+			scheme.sizes[n] = append(scheme.sizes[n], [2]int{min, max})
+		}
+	}
+	return scheme, nil
+}
+
+func mustParsePaddingScheme(s string) PaddingScheme {
+	scheme, err := ParsePaddingScheme(s)
+	if err != nil {
+		panic(err)
+	}
+	return scheme
+}
+
+func (p PaddingScheme) String() string {
+	return p.raw
+}
+
+// md5 returns the hex MD5 of the scheme, which is sent by the client to check the scheme of the server.
+func (p PaddingScheme) md5() string {
+	sum := md5.Sum([]byte(p.raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// recordSizes returns the random record sizes of the packet n.
+func (p PaddingScheme) recordSizes(n int) (sizes []int) {
+	for _, r := range p.sizes[n] {
+		size := r[0]
+		if r[1] > r[0] {
+			v, _ := rand.Int(rand.Reader, big.NewInt(int64(r[1]-r[0]+1)))
+			size += int(v.Int64())
+		}
+		sizes = append(sizes, size)
+	}
+	return
+}
+
+// anytlsPassword returns the password of the user, the username is used if the password is not set.
+func anytlsPassword(user *url.Userinfo) string {
+	if user == nil {
+		return ""
+	}
+	if pass, ok := user.Password(); ok {
+		return pass
+	}
+	return user.Username()
+}
+
+func anytlsFrame(cmd byte, sid uint32, data []byte) []byte {
+	b := make([]byte, anytlsHeaderSize, anytlsHeaderSize+len(data))
+	b[0] = cmd
+	binary.BigEndian.PutUint32(b[1:], sid)
+	binary.BigEndian.PutUint16(b[5:], uint16(len(data)))
+	return append(b, data...)
+}
+
+type anytlsSession struct {
+	conn      net.Conn
+	client    bool
+	scheme    PaddingScheme
+	pkt       int
+	padding   bool
+	wmux      sync.Mutex
+	streams   map[uint32]*anytlsStream
+	nextID    uint32
+	mux       sync.Mutex
+	onStream  func(*anytlsStream)        // server
+	onScheme  func(scheme PaddingScheme) // client
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newAnyTLSSession(conn net.Conn, client bool, scheme PaddingScheme) *anytlsSession {
+	return &anytlsSession{
+		conn:    conn,
+		client:  client,
+		scheme:  scheme,
+		padding: client && scheme.stop > 0,
+		streams: make(map[uint32]*anytlsStream),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (s *anytlsSession) writeFrame(cmd byte, sid uint32, data []byte) error {
+	s.wmux.Lock()
+	defer s.wmux.Unlock()
+	return s.writeConn(anytlsFrame(cmd, sid, data))
+}
+
+// writeConn writes the packet, the first packets of the client are split and padded by the padding scheme.
+func (s *anytlsSession) writeConn(b []byte) error {
+	if !s.padding {
+		_, err := s.conn.Write(b)
+		return err
+	}
+	s.pkt++
+	if s.pkt >= s.scheme.stop {
+		s.padding = false
+		_, err := s.conn.Write(b)
+		return err
+	}
+
+	for _, size := range s.scheme.recordSizes(s.pkt) {
+		switch {
+		case size == anytlsCheckMark:
+			if len(b) == 0 {
+				return nil
+			}
+			continue
+		case len(b) > size:
+			if _, err := s.conn.Write(b[:size]); err != nil {
+				return err
+			}
+			b = b[size:]
+			continue
+		case len(b) > 0:
+			if pad := size - len(b) - anytlsHeaderSize; pad > 0 {
+				b = append(b, anytlsFrame(anytlsCmdWaste, 0, make([]byte, pad))...)
+			}
+		default:
+			if size <= anytlsHeaderSize {
+				continue
+			}
+			b = anytlsFrame(anytlsCmdWaste, 0, make([]byte, size-anytlsHeaderSize))
+		}
+		if _, err := s.conn.Write(b); err != nil {
+			return err
+		}
+		b = nil
+	}
+	if len(b) > 0 {
+		_, err := s.conn.Write(b)
+		return err
+	}
+	return nil
+}
+
+func (s *anytlsSession) readLoop() {
+	defer s.Close()
+
+	var header [anytlsHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+			return
+		}
+		cmd := header[0]
+		sid := binary.BigEndian.Uint32(header[1:])
+		data := make([]byte, binary.BigEndian.Uint16(header[5:]))
+		if _, err := io.ReadFull(s.conn, data); err != nil {
+			return
+		}
+
+		switch cmd {
+		case anytlsCmdPSH:
+			if st := s.stream(sid); st != nil {
+				st.pw.Write(data)
+			}
+		case anytlsCmdSYN:
+			if s.client || s.onStream == nil {
+				continue
+			}
+			st := s.newStream(sid)
+			go s.onStream(st)
+		case anytlsCmdSYNACK:
+			if st := s.stream(sid); st != nil && len(data) > 0 {
+				st.pw.CloseWithError(fmt.Errorf("anytls: %s", data))
+			}
+		case anytlsCmdFIN:
+			if st := s.stream(sid); st != nil {
+				st.pw.Close()
+			}
+		case anytlsCmdSettings:
+			if s.client {
+				continue
+			}
+			settings := anytlsParseSettings(data)
+			if s.scheme.raw != "" && settings["padding-md5"] != s.scheme.md5() {
+				s.writeFrame(anytlsCmdUpdatePaddingScheme, 0, []byte(s.scheme.raw))
+			}
+			if v, _ := strconv.Atoi(settings["v"]); v >= 2 {
+				s.writeFrame(anytlsCmdServerSettings, 0, []byte("v=2"))
+			}
+		case anytlsCmdUpdatePaddingScheme:
+			if !s.client || s.onScheme == nil {
+				continue
+			}
+			if scheme, err := ParsePaddingScheme(string(data)); err == nil {
+				s.onScheme(scheme)
+			}
+		case anytlsCmdAlert:
+			log.Logf("[anytls] %s - %s : alert %s", s.conn.LocalAddr(), s.conn.RemoteAddr(), data)
+			return
+		case anytlsCmdHeartRequest:
+			s.writeFrame(anytlsCmdHeartResponse, sid, nil)
+		}
+	}
+}
+
+func anytlsParseSettings(b []byte) map[string]string {
+	settings := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			settings[k] = v
+		}
+	}
+	return settings
+}
+
+func (s *anytlsSession) stream(sid uint32) *anytlsStream {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.streams[sid]
+}
+
+func (s *anytlsSession) newStream(sid uint32) *anytlsStream {
+	pr, pw := io.Pipe()
+	st := &anytlsStream{session: s, id: sid, pr: pr, pw: pw}
+	s.mux.Lock()
+	s.streams[sid] = st
+	s.mux.Unlock()
+	return st
+}
+
+// openStream opens a stream to the address.
+func (s *anytlsSession) openStream(address string) (*anytlsStream, error) {
+	addr, err := gosocks5.NewAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 1+1+255+2)
+	n, err := addr.Encode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	s.nextID++
+	sid := s.nextID
+	s.mux.Unlock()
+
+	st := s.newStream(sid)
+	if err := s.writeFrame(anytlsCmdSYN, sid, nil); err != nil {
+		st.Close()
+		return nil, err
+	}
+	if err := s.writeFrame(anytlsCmdPSH, sid, b[:n]); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *anytlsSession) IsClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *anytlsSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		for id, st := range s.streams {
+			st.pw.Close()
+			delete(s.streams, id)
+		}
+	})
+	return err
+}
+
+// anytlsStream is a stream of the AnyTLS session.
+type anytlsStream struct {
+	session *anytlsSession
+	id      uint32
+	pr      *io.PipeReader
+	pw      *io.PipeWriter
+	once    sync.Once
+}
+
+func (c *anytlsStream) Read(b []byte) (int, error) {
+	return c.pr.Read(b)
+}
+
+func (c *anytlsStream) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		p := b[n:]
+		if len(p) > anytlsMaxPayload {
+			p = p[:anytlsMaxPayload]
+		}
+		if err = c.session.writeFrame(anytlsCmdPSH, c.id, p); err != nil {
+			return
+		}
+		n += len(p)
+	}
+	return
+}
+
+// synack reports the result of the stream to the client.
+func (c *anytlsStream) synack(err error) error {
+	var msg []byte
+	if err != nil {
+		msg = []byte(err.Error())
+	}
+	return c.session.writeFrame(anytlsCmdSYNACK, c.id, msg)
+}
+
+func (c *anytlsStream) Close() error {
+	c.once.Do(func() {
+		c.pr.Close()
+		c.session.mux.Lock()
+		delete(c.session.streams, c.id)
+		c.session.mux.Unlock()
+		if !c.session.IsClosed() {
+			c.session.writeFrame(anytlsCmdFIN, c.id, nil)
+		}
+	})
+	return nil
+}
+
+func (c *anytlsStream) LocalAddr() net.Addr {
+	return c.session.conn.LocalAddr()
+}
+
+func (c *anytlsStream) RemoteAddr() net.Addr {
+	return c.session.conn.RemoteAddr()
+}
+
+func (c *anytlsStream) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *anytlsStream) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *anytlsStream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type anytlsTransporter struct {
+	tlsConfig    *tls.Config
+	scheme       PaddingScheme
+	sessions     map[string]*anytlsSession
+	sessionCache tls.ClientSessionCache
+	mux          sync.Mutex
+}
+
+// AnyTLSTransporter creates a Transporter of the AnyTLS server, which multiplexes the streams in a TLS connection
+// and pads the first packets of the session by the paddingScheme, so the TLS handshakes of the proxied
+// connections are not seen as TLS in TLS. The password is the user of UserHandshakeOption,
+// and the padding scheme is updated by the server. Use it with AnyTLSConnector.
+//
+// The certificate of the server is not verified if tlsConfig is nil.
+func AnyTLSTransporter(tlsConfig *tls.Config, paddingScheme PaddingScheme) Transporter {
+	return &anytlsTransporter{
+		tlsConfig:    tlsConfig,
+		scheme:       paddingScheme,
+		sessions:     make(map[string]*anytlsSession),
+		sessionCache: tls.NewLRUClientSessionCache(0),
+	}
+}
+
+func (tr *anytlsTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	session := tr.sessions[addr]
+	if session != nil && session.IsClosed() {
+		delete(tr.sessions, addr)
+		session = nil
+	}
+	if session != nil {
+		return &anytlsClientConn{session: session}, nil
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	if opts.Chain == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+	return opts.Chain.Dial(addr)
+}
+
+func (tr *anytlsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	if _, ok := conn.(*anytlsClientConn); ok {
+		return conn, nil
+	}
+
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if session := tr.sessions[opts.Addr]; session != nil && !session.IsClosed() {
+		// the session is made by another connection.
+		conn.Close()
+		return &anytlsClientConn{session: session}, nil
+	}
+
+	tlsConfig := tr.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConn, err := wrapTLSClient(conn, withSessionCache(tlsConfig, tr.sessionCache), timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	session := newAnyTLSSession(tlsConn, true, tr.scheme)
+	session.onScheme = func(scheme PaddingScheme) {
+		tr.mux.Lock()
+		defer tr.mux.Unlock()
+		tr.scheme = scheme
+	}
+	if err := tr.authenticate(session, anytlsPassword(opts.User), timeout); err != nil {
+		session.Close()
+		return nil, err
+	}
+	go session.readLoop()
+
+	tr.sessions[opts.Addr] = session
+	return &anytlsClientConn{session: session}, nil
+}
+
+// authenticate sends the SHA256 of the password with the padding, and the settings of the client.
+func (tr *anytlsTransporter) authenticate(session *anytlsSession, password string, timeout time.Duration) error {
+	session.conn.SetWriteDeadline(time.Now().Add(timeout))
+	defer session.conn.SetWriteDeadline(time.Time{})
+
+	sum := sha256.Sum256([]byte(password))
+	var padding int
+	if sizes := session.scheme.recordSizes(0); len(sizes) > 0 && sizes[0] > 0 {
+		padding = sizes[0]
+	}
+	b := append(sum[:], 0, 0)
+	binary.BigEndian.PutUint16(b[32:], uint16(padding))
+	b = append(b, make([]byte, padding)...)
+	if _, err := session.conn.Write(b); err != nil {
+		return err
+	}
+
+	settings := "v=2\nclient=gost\npadding-md5=" + session.scheme.md5()
+	return session.writeFrame(anytlsCmdSettings, 0, []byte(settings))
+}
+
+func (tr *anytlsTransporter) Multiplex() bool {
+	return true
+}
+
+// a dummy AnyTLS client conn used by AnyTLS connector
+type anytlsClientConn struct {
+	nopConn
+	session *anytlsSession
+}
+
+type anytlsConnector struct{}
+
+// AnyTLSConnector creates a Connector for AnyTLS client, it opens a stream to the address
+// by the session of AnyTLSTransporter.
+func AnyTLSConnector() Connector {
+	return &anytlsConnector{}
+}
+
+func (c *anytlsConnector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *anytlsConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%s unsupported", network)
+	}
+
+	cc, ok := conn.(*anytlsClientConn)
+	if !ok {
+		return nil, errors.New("wrong connection type")
+	}
+	return cc.session.openStream(address)
+}
+
+type anytlsHandler struct {
+	options *HandlerOptions
+}
+
+// AnyTLSHandler creates a server Handler for the streams of AnyTLSListener.
+func AnyTLSHandler(opts ...HandlerOption) Handler {
+	h := &anytlsHandler{}
+	h.Init(opts...)
+	return h
+}
+
+func (h *anytlsHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *anytlsHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	addr, err := readSocksAddr(conn)
+	if err != nil {
+		log.Logf("[anytls] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	host := addr.String()
+	synack := func(err error) {
+		if st, ok := conn.(*anytlsStream); ok {
+			st.synack(err)
+		}
+	}
+
+	log.Logf("[anytls] %s -> %s", conn.RemoteAddr(), host)
+
+	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) {
+		log.Logf("[anytls] %s - %s : Unauthorized to tcp connect to %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		synack(errors.New("unauthorized"))
+		return
+	}
+	if h.options.Bypass.Contains(host) {
+		log.Logf("[anytls] %s - %s : Bypass %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		synack(errors.New("bypass"))
+		return
+	}
+
+	cc, err := h.options.Chain.DialContext(context.Background(),
+		"tcp", host,
+		RetryChainOption(h.options.Retries),
+		TimeoutChainOption(h.options.Timeout),
+		HostsChainOption(h.options.Hosts),
+		ResolverChainOption(h.options.Resolver),
+	)
+	if err != nil {
+		log.Logf("[anytls] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		synack(err)
+		return
+	}
+	defer cc.Close()
+	synack(nil)
+
+	log.Logf("[anytls] %s <-> %s", conn.RemoteAddr(), host)
+	transport(conn, cc)
+	log.Logf("[anytls] %s >-< %s", conn.RemoteAddr(), host)
+}
+
+type anytlsListener struct {
+	net.Listener
+	tlsConfig *tls.Config
+	scheme    PaddingScheme
+	passwords [][sha256.Size]byte
+	connChan  chan net.Conn
+	errChan   chan error
+}
+
+// AnyTLSListener creates a Listener for AnyTLS server, the sessions are authenticated by the passwords of the users,
+// and the streams are accepted as the connections of AnyTLSHandler.
+// The paddingScheme is sent to the clients which have the different scheme.
+func AnyTLSListener(addr string, tlsConfig *tls.Config, paddingScheme PaddingScheme, users ...*url.Userinfo) (Listener, error) {
+	if tlsConfig == nil {
+		tlsConfig = DefaultTLSConfig
+	}
+	l := &anytlsListener{
+		tlsConfig: tlsConfig,
+		scheme:    paddingScheme,
+		connChan:  make(chan net.Conn, 1024),
+		errChan:   make(chan error, 1),
+	}
+	for _, user := range users {
+		l.passwords = append(l.passwords, sha256.Sum256([]byte(anytlsPassword(user))))
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.Listener = tcpKeepAliveListener{ln.(*net.TCPListener)}
+	go l.listenLoop()
+
+	return l, nil
+}
+
+func (l *anytlsListener) listenLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			log.Log("[anytls] accept:", err)
+			l.errChan <- err
+			close(l.errChan)
+			return
+		}
+		go l.handleConn(conn)
+	}
+}
+
+func (l *anytlsListener) handleConn(conn net.Conn) {
+	conn = tls.Server(conn, l.tlsConfig)
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	if err := l.authenticate(conn); err != nil {
+		log.Logf("[anytls] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	session := newAnyTLSSession(conn, false, l.scheme)
+	session.onStream = func(st *anytlsStream) {
+		select {
+		case l.connChan <- st:
+		default:
+			st.Close()
+			log.Logf("[anytls] %s - %s: connection queue is full", conn.RemoteAddr(), conn.LocalAddr())
+		}
+	}
+
+	log.Logf("[anytls] %s <-> %s", conn.RemoteAddr(), conn.LocalAddr())
+	session.readLoop()
+	log.Logf("[anytls] %s >-< %s", conn.RemoteAddr(), conn.LocalAddr())
+}
+
+func (l *anytlsListener) authenticate(conn net.Conn) error {
+	var b [sha256.Size + 2]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		return err
+	}
+	ok := len(l.passwords) == 0
+	for _, password := range l.passwords {
+		if subtle.ConstantTimeCompare(password[:], b[:sha256.Size]) == 1 {
+			ok = true
+		}
+	}
+	if !ok {
+		return errors.New("anytls: authentication failed")
+	}
+	_, err := io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint16(b[sha256.Size:])))
+	return err
+}
+
+func (l *anytlsListener) Accept() (conn net.Conn, err error) {
+	var ok bool
+	select {
+	case conn = <-l.connChan:
+	case err, ok = <-l.errChan:
+		if !ok {
+			err = errors.New("accpet on closed listener")
+		}
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package gost
+
+import (
+	"crypto/rand"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParsePaddingScheme(t *testing.T) {
+	if DefaultPaddingScheme.stop != 8 {
+		t.Errorf("got stop %d, want 8", DefaultPaddingScheme.stop)
+	}
+	if sizes := DefaultPaddingScheme.recordSizes(0); len(sizes) != 1 || sizes[0] != 30 {
+		t.Errorf("got sizes %v of the packet 0, want [30]", sizes)
+	}
+	sizes := DefaultPaddingScheme.recordSizes(2)
+	if len(sizes) != 9 || sizes[1] != anytlsCheckMark || sizes[0] < 400 || sizes[0] > 500 {
+		t.Errorf("unexpected sizes %v of the packet 2", sizes)
+	}
+	if sizes := DefaultPaddingScheme.recordSizes(8); sizes != nil {
+		t.Errorf("got sizes %v of the packet 8, want none", sizes)
+	}
+
+	for _, s := range []string{"stop", "stop=x", "1=100", "1=200-100", "x=1-2"} {
+		if _, err := ParsePaddingScheme(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func anytlsRoundtrip(t *testing.T, targetURL string, data []byte, password string) error {
+	ln, err := AnyTLSListener("127.0.0.1:0", nil, DefaultPaddingScheme, url.User("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  AnyTLSHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	// the client starts without padding, and the scheme is updated by the server.
+	tr := AnyTLSTransporter(nil, PaddingScheme{})
+	client := &Client{
+		Connector:   AnyTLSConnector(),
+		Transporter: tr,
+	}
+	conn, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	conn, err = client.Handshake(conn, AddrHandshakeOption(ln.Addr().String()), UserHandshakeOption(url.User(password)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cc, err := client.Connect(conn, httptest.NewRequest("GET", targetURL, nil).Host)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	if err := httpRoundtrip(cc, targetURL, data); err != nil {
+		return err
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	anytr := tr.(*anytlsTransporter)
+	anytr.mux.Lock()
+	defer anytr.mux.Unlock()
+	if anytr.scheme.String() != DefaultPaddingScheme.String() {
+		t.Error("the padding scheme is not updated")
+	}
+	return nil
+}
+
+func TestAnyTLS(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	if err := anytlsRoundtrip(t, httpSrv.URL, sendData, "password"); err != nil {
+		t.Error(err)
+	}
+	if err := anytlsRoundtrip(t, httpSrv.URL, sendData, "wrong"); err == nil {
+		t.Error("the wrong password should not be authenticated")
+	}
+}
+
+func TestAnyTLSPadding(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	ln, err := AnyTLSListener("127.0.0.1:0", nil, DefaultPaddingScheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: AnyTLSHandler()}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   AnyTLSConnector(),
+		Transporter: AnyTLSTransporter(nil, DefaultPaddingScheme),
+	}
+	// the streams of the padded packets and the following packets.
+	for i := 1; i <= 10; i++ {
+		sendData := make([]byte, 100*i)
+		rand.Read(sendData)
+		if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+}
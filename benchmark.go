@@ -0,0 +1,188 @@
+package gost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BenchmarkOptions are the options of BenchmarkTransport.
+type BenchmarkOptions struct {
+	// Concurrency is the number of the connections sending the messages concurrently, the default is 1.
+	Concurrency int
+	// MessageSize is the size of each message, the default is 1024.
+	MessageSize int
+	// Messages is the number of the messages sent by each connection, the default is 100.
+	Messages int
+	// HandshakeOptions are the options of the handshake with the listener, e.g. the TLS config.
+	HandshakeOptions []HandshakeOption
+}
+
+// BenchmarkResult is the result of BenchmarkTransport.
+type BenchmarkResult struct {
+	Connections int
+	Messages    int
+	Bytes       int64
+	Errors      int
+	Duration    time.Duration
+	// Throughput is the echoed data in MB/s.
+	Throughput float64
+	// LatencyP50, LatencyP95 and LatencyP99 are the percentiles of the round-trip time of the messages.
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	LatencyP99 time.Duration
+	// SetupAvg and SetupMax are the time of dialing and handshaking of the connections.
+	SetupAvg time.Duration
+	SetupMax time.Duration
+}
+
+func (r *BenchmarkResult) String() string {
+	return fmt.Sprintf("conns=%d msgs=%d errors=%d duration=%v throughput=%.2fMB/s latency p50/p95/p99=%v/%v/%v setup avg/max=%v/%v",
+		r.Connections, r.Messages, r.Errors, r.Duration, r.Throughput,
+		r.LatencyP50, r.LatencyP95, r.LatencyP99, r.SetupAvg, r.SetupMax)
+}
+
+// BenchmarkTransport runs an echo server on the listener, and sends the messages to it through the transporter
+// from the concurrent connections, each message is sent after the previous one is echoed.
+// The listener is closed when the benchmark is finished or the context is done.
+//
+// The error is returned if none of the connections is established.
+func BenchmarkTransport(ctx context.Context, transporter Transporter, listener Listener, opts BenchmarkOptions) (*BenchmarkResult, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MessageSize <= 0 {
+		opts.MessageSize = 1024
+	}
+	if opts.Messages <= 0 {
+		opts.Messages = 100
+	}
+
+	go benchmarkEcho(listener)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	addr := listener.Addr().String()
+	hopts := append([]HandshakeOption{AddrHandshakeOption(addr)}, opts.HandshakeOptions...)
+
+	type connStats struct {
+		setup     time.Duration
+		latencies []time.Duration
+		err       error
+	}
+	stats := make([]connStats, opts.Concurrency)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range stats {
+		wg.Add(1)
+		go func(st *connStats) {
+			defer wg.Done()
+
+			t := time.Now()
+			conn, err := transporter.Dial(addr)
+			if err != nil {
+				st.err = err
+				return
+			}
+			cc, err := transporter.Handshake(conn, hopts...)
+			if err != nil {
+				conn.Close()
+				st.err = err
+				return
+			}
+			defer cc.Close()
+			st.setup = time.Since(t)
+
+			msg := make([]byte, opts.MessageSize)
+			buf := make([]byte, opts.MessageSize)
+			for n := 0; n < opts.Messages && ctx.Err() == nil; n++ {
+				t := time.Now()
+				if _, err := cc.Write(msg); err != nil {
+					st.err = err
+					return
+				}
+				if _, err := io.ReadFull(cc, buf); err != nil {
+					st.err = err
+					return
+				}
+				st.latencies = append(st.latencies, time.Since(t))
+			}
+		}(&stats[i])
+	}
+	wg.Wait()
+
+	result := &BenchmarkResult{Duration: time.Since(start)}
+	var latencies []time.Duration
+	var setup time.Duration
+	var err error
+	for _, st := range stats {
+		if st.err != nil {
+			result.Errors++
+			err = st.err
+		}
+		if st.setup == 0 {
+			continue
+		}
+		result.Connections++
+		setup += st.setup
+		if st.setup > result.SetupMax {
+			result.SetupMax = st.setup
+		}
+		latencies = append(latencies, st.latencies...)
+	}
+	if result.Connections == 0 {
+		if err == nil {
+			err = errors.New("benchmark: no connection")
+		}
+		return nil, err
+	}
+
+	result.SetupAvg = setup / time.Duration(result.Connections)
+	result.Messages = len(latencies)
+	result.Bytes = int64(result.Messages) * int64(opts.MessageSize)
+	if secs := result.Duration.Seconds(); secs > 0 {
+		result.Throughput = float64(result.Bytes) / 1e6 / secs
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.LatencyP50 = percentile(latencies, 50)
+	result.LatencyP95 = percentile(latencies, 95)
+	result.LatencyP99 = percentile(latencies, 99)
+	return result, nil
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func benchmarkEcho(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+	}
+}
@@ -0,0 +1,55 @@
+package gost
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+)
+
+func TestBenchmarkTransport(t *testing.T) {
+	clientTLS := &tls.Config{InsecureSkipVerify: true}
+	tests := []struct {
+		name        string
+		listener    func() (Listener, error)
+		transporter Transporter
+	}{
+		{"tcp", func() (Listener, error) { return TCPListener("127.0.0.1:0") }, TCPTransporter()},
+		{"tls", func() (Listener, error) { return TLSListener("127.0.0.1:0", DefaultTLSConfig) }, TLSTransporter()},
+		{"ws", func() (Listener, error) { return WSListener("127.0.0.1:0", nil) }, WSTransporter(nil)},
+		{"kcp", func() (Listener, error) { return KCPListener("127.0.0.1:0", nil) }, KCPTransporter(nil)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := tc.listener()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := BenchmarkTransport(context.Background(), tc.transporter, ln, BenchmarkOptions{
+				Concurrency:      4,
+				MessageSize:      512,
+				Messages:         20,
+				HandshakeOptions: []HandshakeOption{TLSConfigHandshakeOption(clientTLS)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Connections != 4 || r.Messages != 80 || r.Errors != 0 || r.Bytes != 80*512 {
+				t.Errorf("result %v", r)
+			}
+			if r.Throughput <= 0 || r.LatencyP50 <= 0 || r.LatencyP50 > r.LatencyP99 || r.SetupAvg <= 0 {
+				t.Errorf("result %v", r)
+			}
+		})
+	}
+}
+
+func TestBenchmarkTransportError(t *testing.T) {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the TLS handshake with the TCP listener fails.
+	if _, err := BenchmarkTransport(context.Background(), TLSTransporter(), ln, BenchmarkOptions{}); err == nil {
+		t.Error("should fail")
+	}
+}
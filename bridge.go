@@ -0,0 +1,167 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/go-gost/gosocks5"
+)
+
+// SOCKS5ToHTTPBridge runs a SOCKS5 server on socks5Addr, which forwards the CONNECT requests
+// as the HTTP CONNECT requests to the HTTP proxy httpProxyAddr.
+//
+// The credentials are set in the addresses as 'user:pass@host:port', the users of socks5Addr are
+// authenticated by the SOCKS5 server, and the user of httpProxyAddr is sent to the HTTP proxy.
+// If neither address has a user, the SOCKS5 username/password of the clients are passed to the HTTP proxy
+// as the Proxy-Authorization (Basic) header if they support the username/password authentication.
+func SOCKS5ToHTTPBridge(socks5Addr, httpProxyAddr string) error {
+	server, err := newBridgeServer(socks5Addr, httpProxyAddr, "http", SOCKS5Handler, HTTPConnector)
+	if err != nil {
+		return err
+	}
+	return server.Run()
+}
+
+// HTTPToSOCKS5Bridge runs a HTTP proxy server on httpAddr, which forwards the requests
+// through the SOCKS5 proxy socks5ProxyAddr.
+//
+// The credentials are the same as SOCKS5ToHTTPBridge, the Proxy-Authorization (Basic) credentials
+// of the clients are passed to the SOCKS5 proxy as the username/password if neither address has a user.
+func HTTPToSOCKS5Bridge(httpAddr, socks5ProxyAddr string) error {
+	server, err := newBridgeServer(httpAddr, socks5ProxyAddr, "socks5", HTTPHandler, SOCKS5Connector)
+	if err != nil {
+		return err
+	}
+	return server.Run()
+}
+
+func newBridgeServer(addr, proxyAddr, protocol string,
+	newHandler func(opts ...HandlerOption) Handler, newConnector func(user *url.Userinfo) Connector) (*Server, error) {
+	laddr, user, err := parseBridgeAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	raddr, proxyUser, err := parseBridgeAddr(proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := TCPListener(laddr)
+	if err != nil {
+		return nil, err
+	}
+	h := &bridgeHandler{
+		newHandler:   newHandler,
+		newConnector: newConnector,
+		protocol:     protocol,
+		proxyAddr:    raddr,
+		proxyUser:    proxyUser,
+	}
+	if user != nil {
+		h.users = []*url.Userinfo{user}
+	}
+	return &Server{Listener: ln, Handler: h}, nil
+}
+
+// parseBridgeAddr parses the address in the form of [user:pass@]host:port.
+func parseBridgeAddr(addr string) (string, *url.Userinfo, error) {
+	u, err := url.Parse("//" + addr)
+	if err != nil {
+		return "", nil, err
+	}
+	return u.Host, u.User, nil
+}
+
+// bridgeHandler creates the handler for each connection,
+// so the credentials of the client can be passed to the proxy.
+type bridgeHandler struct {
+	newHandler   func(opts ...HandlerOption) Handler
+	newConnector func(user *url.Userinfo) Connector
+	protocol     string
+	proxyAddr    string
+	proxyUser    *url.Userinfo
+	users        []*url.Userinfo
+	options      []HandlerOption
+}
+
+func (h *bridgeHandler) Init(options ...HandlerOption) {
+	h.options = append(h.options, options...)
+}
+
+func (h *bridgeHandler) Handle(conn net.Conn) {
+	connector := &bridgeConnector{newConnector: h.newConnector, user: h.proxyUser}
+
+	opts := append([]HandlerOption{}, h.options...)
+	if len(h.users) > 0 {
+		opts = append(opts, UsersHandlerOption(h.users...))
+	} else if h.proxyUser == nil {
+		br := bufio.NewReader(conn)
+		conn = &bufferdConn{Conn: conn, br: br}
+		// the proxy authenticates the credentials of the client. As the authentication is mandatory
+		// for the SOCKS5 server with an Authenticator, it is only used if the client supports it.
+		if h.protocol != "http" || hasSOCKS5Method(br, gosocks5.MethodUserPass) {
+			opts = append(opts, AuthenticatorHandlerOption(connector))
+		}
+	}
+	node := Node{
+		Addr:      h.proxyAddr,
+		Protocol:  h.protocol,
+		Transport: "tcp",
+		Client: &Client{
+			Connector:   connector,
+			Transporter: TCPTransporter(),
+		},
+	}
+	opts = append(opts, ChainHandlerOption(NewChain(node)))
+
+	h.newHandler(opts...).Handle(conn)
+}
+
+// hasSOCKS5Method reports whether the buffered SOCKS5 method selection request contains the method.
+func hasSOCKS5Method(br *bufio.Reader, method uint8) bool {
+	b, err := br.Peek(2)
+	if err != nil {
+		return false
+	}
+	methods, err := br.Peek(2 + int(b[1]))
+	if err != nil {
+		return false
+	}
+	return bytes.IndexByte(methods[2:], method) >= 0
+}
+
+// bridgeConnector connects to the proxy with the user, which is the configured user of the proxy,
+// or the credentials of the client recorded by Authenticate.
+type bridgeConnector struct {
+	newConnector func(user *url.Userinfo) Connector
+	mux          sync.Mutex
+	user         *url.Userinfo
+}
+
+// Authenticate records the credentials of the client, which are authenticated by the proxy.
+func (c *bridgeConnector) Authenticate(user, password string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if user != "" || password != "" {
+		c.user = url.UserPassword(user, password)
+	}
+	return true
+}
+
+func (c *bridgeConnector) connector() Connector {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.newConnector(c.user)
+}
+
+func (c *bridgeConnector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *bridgeConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.connector().ConnectContext(ctx, conn, network, address, options...)
+}
@@ -0,0 +1,65 @@
+package gost
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyBridge(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	upstreamUser := url.UserPassword("admin", "123456")
+	tests := []struct {
+		name         string
+		protocol     string
+		newHandler   func(opts ...HandlerOption) Handler
+		newConnector func(user *url.Userinfo) Connector
+		// the upstream proxy and the client of the bridge.
+		upstreamHandler  func(opts ...HandlerOption) Handler
+		clientConnector  func(user *url.Userinfo) Connector
+		bridgeAddr       string
+		upstreamUserinfo string
+		clientUser       *url.Userinfo
+		ok               bool
+	}{
+		{"socks5-http", "http", SOCKS5Handler, HTTPConnector, HTTPHandler, SOCKS5Connector, "u:p@127.0.0.1:0", "admin:123456@", url.UserPassword("u", "p"), true},
+		{"socks5-http", "http", SOCKS5Handler, HTTPConnector, HTTPHandler, SOCKS5Connector, "u:p@127.0.0.1:0", "admin:123456@", url.UserPassword("admin", "123456"), false},
+		{"socks5-http", "http", SOCKS5Handler, HTTPConnector, HTTPHandler, SOCKS5Connector, "127.0.0.1:0", "", url.UserPassword("admin", "123456"), true},
+		{"socks5-http", "http", SOCKS5Handler, HTTPConnector, HTTPHandler, SOCKS5Connector, "127.0.0.1:0", "", url.UserPassword("admin", "wrong"), false},
+		{"socks5-http", "http", SOCKS5Handler, HTTPConnector, HTTPHandler, SOCKS5Connector, "127.0.0.1:0", "", nil, false},
+		{"http-socks5", "socks5", HTTPHandler, SOCKS5Connector, SOCKS5Handler, HTTPConnector, "u:p@127.0.0.1:0", "admin:123456@", url.UserPassword("u", "p"), true},
+		{"http-socks5", "socks5", HTTPHandler, SOCKS5Connector, SOCKS5Handler, HTTPConnector, "u:p@127.0.0.1:0", "admin:123456@", nil, false},
+		{"http-socks5", "socks5", HTTPHandler, SOCKS5Connector, SOCKS5Handler, HTTPConnector, "127.0.0.1:0", "", url.UserPassword("admin", "123456"), true},
+		{"http-socks5", "socks5", HTTPHandler, SOCKS5Connector, SOCKS5Handler, HTTPConnector, "127.0.0.1:0", "", url.UserPassword("admin", "wrong"), false},
+	}
+
+	for i, tc := range tests {
+		ln, err := TCPListener("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		upstream := &Server{Listener: ln, Handler: tc.upstreamHandler(UsersHandlerOption(upstreamUser))}
+		go upstream.Run()
+
+		bridge, err := newBridgeServer(tc.bridgeAddr, tc.upstreamUserinfo+ln.Addr().String(),
+			tc.protocol, tc.newHandler, tc.newConnector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go bridge.Run()
+
+		client := &Client{Connector: tc.clientConnector(tc.clientUser), Transporter: TCPTransporter()}
+		err = proxyRoundtrip(client, bridge, httpSrv.URL, []byte("hello"))
+		if tc.ok && err != nil {
+			t.Errorf("#%d %s: %v", i, tc.name, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("#%d %s: should fail", i, tc.name)
+		}
+
+		bridge.Close()
+		upstream.Close()
+	}
+}
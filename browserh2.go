@@ -0,0 +1,723 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2BrowserProfile is the HTTP/2 fingerprint of a browser, which is the SETTINGS frame, the WINDOW_UPDATE increment
+// of the connection, the priority of the HEADERS frames and the order of the pseudo headers.
+type h2BrowserProfile struct {
+	settings     []http2.Setting
+	windowUpdate uint32
+	priority     http2.PriorityParam
+	pseudoOrder  []string
+}
+
+var h2BrowserProfiles = map[string]*h2BrowserProfile{
+	"chrome": {
+		settings: []http2.Setting{
+			{ID: http2.SettingHeaderTableSize, Val: 65536},
+			{ID: http2.SettingEnablePush, Val: 0},
+			{ID: http2.SettingInitialWindowSize, Val: 6291456},
+			{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+		},
+		windowUpdate: 15663105,
+		priority:     http2.PriorityParam{Exclusive: true, Weight: 255},
+		pseudoOrder:  []string{":method", ":authority", ":scheme", ":path"},
+	},
+	"firefox": {
+		settings: []http2.Setting{
+			{ID: http2.SettingHeaderTableSize, Val: 65536},
+			{ID: http2.SettingEnablePush, Val: 0},
+			{ID: http2.SettingInitialWindowSize, Val: 131072},
+			{ID: http2.SettingMaxFrameSize, Val: 16384},
+		},
+		windowUpdate: 12517377,
+		priority:     http2.PriorityParam{Weight: 41},
+		pseudoOrder:  []string{":method", ":path", ":authority", ":scheme"},
+	},
+	"safari": {
+		settings: []http2.Setting{
+			{ID: http2.SettingEnablePush, Val: 0},
+			{ID: http2.SettingMaxConcurrentStreams, Val: 100},
+			{ID: http2.SettingInitialWindowSize, Val: 2097152},
+			{ID: 0x9, Val: 1}, // SETTINGS_NO_RFC7540_PRIORITIES
+		},
+		windowUpdate: 10420225,
+		priority:     http2.PriorityParam{Weight: 254},
+		pseudoOrder:  []string{":method", ":scheme", ":authority", ":path"},
+	},
+}
+
+// setting returns the value of the setting of the profile, or the default value of RFC 7540.
+func (p *h2BrowserProfile) setting(id http2.SettingID, defaultValue uint32) uint32 {
+	for _, s := range p.settings {
+		if s.ID == id {
+			return s.Val
+		}
+	}
+	return defaultValue
+}
+
+type browserH2Transporter struct {
+	profile     *h2BrowserProfile
+	tlsConfig   *tls.Config
+	clients     map[string]*http.Client
+	clientMutex sync.Mutex
+}
+
+// BrowserH2Transporter creates a Transporter of the HTTP2 proxy server like HTTP2Transporter,
+// but the HTTP/2 connection has the fingerprint of the browser, which is chrome, firefox or safari.
+// The SETTINGS frame, the connection WINDOW_UPDATE, the priority of the HEADERS frames and the order of
+// the pseudo headers are the same as the browser, so the connection is not distinguished from the browser
+// by the HTTP/2 (Akamai) fingerprint. The TLS fingerprint is still the one of crypto/tls.
+func BrowserH2Transporter(browser string, tlsConfig *tls.Config) Transporter {
+	profile := h2BrowserProfiles[strings.ToLower(browser)]
+	if profile == nil {
+		log.Logf("[h2] unknown browser %s, chrome is used", browser)
+		profile = h2BrowserProfiles["chrome"]
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	return &browserH2Transporter{
+		profile:   profile,
+		tlsConfig: tlsConfig,
+		clients:   make(map[string]*http.Client),
+	}
+}
+
+func (tr *browserH2Transporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	tr.clientMutex.Lock()
+	defer tr.clientMutex.Unlock()
+
+	client, ok := tr.clients[addr]
+	if !ok {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = DialTimeout
+		}
+		chain := opts.Chain
+		client = &http.Client{
+			Transport: &browserH2RoundTripper{
+				profile: tr.profile,
+				dial: func() (net.Conn, error) {
+					conn, err := chain.Dial(addr)
+					if err != nil {
+						return nil, err
+					}
+					return wrapTLSClient(conn, tr.tlsConfig, timeout)
+				},
+			},
+		}
+		tr.clients[addr] = client
+	}
+
+	return &http2ClientConn{
+		addr:   addr,
+		client: client,
+		onClose: func() {
+			tr.clientMutex.Lock()
+			defer tr.clientMutex.Unlock()
+			delete(tr.clients, addr)
+		},
+	}, nil
+}
+
+func (tr *browserH2Transporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *browserH2Transporter) Multiplex() bool {
+	return true
+}
+
+// browserH2RoundTripper sends the requests by a HTTP/2 connection with the browser profile.
+type browserH2RoundTripper struct {
+	profile *h2BrowserProfile
+	dial    func() (net.Conn, error)
+	conn    *browserH2Conn
+	mux     sync.Mutex
+}
+
+func (rt *browserH2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mux.Lock()
+	if rt.conn == nil || !rt.conn.available() {
+		conn, err := rt.dial()
+		if err != nil {
+			rt.mux.Unlock()
+			return nil, err
+		}
+		if proto := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; proto != "h2" {
+			conn.Close()
+			rt.mux.Unlock()
+			return nil, fmt.Errorf("h2: unexpected ALPN protocol %q", proto)
+		}
+		cc, err := newBrowserH2Conn(conn, rt.profile)
+		if err != nil {
+			conn.Close()
+			rt.mux.Unlock()
+			return nil, err
+		}
+		rt.conn = cc
+	}
+	cc := rt.conn
+	rt.mux.Unlock()
+
+	return cc.roundTrip(req)
+}
+
+// browserH2Conn is a minimal HTTP/2 client connection, which writes the frames of the browser profile.
+type browserH2Conn struct {
+	conn    net.Conn
+	profile *h2BrowserProfile
+	bw      *bufio.Writer
+	fr      *http2.Framer
+	henc    *hpack.Encoder
+	hbuf    bytes.Buffer
+	wmux    sync.Mutex
+
+	mux               sync.Mutex
+	cond              *sync.Cond
+	streams           map[uint32]*browserH2Stream
+	nextID            uint32
+	sendWindow        int32
+	peerInitialWindow int32
+	peerMaxFrameSize  uint32
+	recvWindow        int32 // the initial window of the streams advertised to the peer
+	unacked           int32 // the bytes of the connection consumed but not acknowledged by WINDOW_UPDATE
+	goAway            bool
+	err               error
+}
+
+func newBrowserH2Conn(conn net.Conn, profile *h2BrowserProfile) (*browserH2Conn, error) {
+	cc := &browserH2Conn{
+		conn:              conn,
+		profile:           profile,
+		bw:                bufio.NewWriter(conn),
+		streams:           make(map[uint32]*browserH2Stream),
+		nextID:            1,
+		sendWindow:        65535,
+		peerInitialWindow: 65535,
+		peerMaxFrameSize:  16384,
+		recvWindow:        int32(profile.setting(http2.SettingInitialWindowSize, 65535)),
+	}
+	cc.cond = sync.NewCond(&cc.mux)
+	cc.fr = http2.NewFramer(cc.bw, conn)
+	cc.fr.ReadMetaHeaders = hpack.NewDecoder(profile.setting(http2.SettingHeaderTableSize, 4096), nil)
+	cc.fr.SetMaxReadFrameSize(profile.setting(http2.SettingMaxFrameSize, 16384))
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+
+	// the connection preface, the settings and the window update are sent together as the browsers.
+	if _, err := cc.bw.WriteString(http2.ClientPreface); err != nil {
+		return nil, err
+	}
+	if err := cc.fr.WriteSettings(profile.settings...); err != nil {
+		return nil, err
+	}
+	if profile.windowUpdate > 0 {
+		if err := cc.fr.WriteWindowUpdate(0, profile.windowUpdate); err != nil {
+			return nil, err
+		}
+	}
+	if err := cc.bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	go cc.readLoop()
+	return cc, nil
+}
+
+func (cc *browserH2Conn) available() bool {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	return cc.err == nil && !cc.goAway && cc.nextID < 1<<31
+}
+
+// writeFrames writes the frames by f and flushes them.
+func (cc *browserH2Conn) writeFrames(f func() error) error {
+	cc.wmux.Lock()
+	defer cc.wmux.Unlock()
+	if err := f(); err != nil {
+		return err
+	}
+	return cc.bw.Flush()
+}
+
+func (cc *browserH2Conn) roundTrip(req *http.Request) (*http.Response, error) {
+	st := &browserH2Stream{
+		conn:  cc,
+		respc: make(chan *http.Response, 1),
+		errc:  make(chan error, 1),
+	}
+	st.body.cond = sync.NewCond(&st.body.mux)
+
+	cc.mux.Lock()
+	if cc.err != nil {
+		cc.mux.Unlock()
+		return nil, cc.err
+	}
+	st.id = cc.nextID
+	cc.nextID += 2
+	st.sendWindow = cc.peerInitialWindow
+	cc.streams[st.id] = st
+	cc.mux.Unlock()
+
+	endStream := req.Body == nil || req.Body == http.NoBody
+	err := cc.writeFrames(func() error {
+		cc.hbuf.Reset()
+		cc.encodeHeaders(req)
+		return cc.fr.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      st.id,
+			BlockFragment: cc.hbuf.Bytes(),
+			EndStream:     endStream,
+			EndHeaders:    true,
+			Priority:      cc.profile.priority,
+		})
+	})
+	if err != nil {
+		cc.close(err)
+		return nil, err
+	}
+	if !endStream {
+		go st.writeBody(req.Body)
+	}
+
+	ctx := req.Context()
+	select {
+	case resp := <-st.respc:
+		resp.Request = req
+		return resp, nil
+	case err := <-st.errc:
+		return nil, err
+	case <-ctx.Done():
+		st.reset(http2.ErrCodeCancel)
+		return nil, ctx.Err()
+	}
+}
+
+// encodeHeaders encodes the pseudo headers in the order of the profile and the lowercase headers.
+func (cc *browserH2Conn) encodeHeaders(req *http.Request) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	pseudo := map[string]string{
+		":method":    req.Method,
+		":authority": host,
+	}
+	// the CONNECT requests have no scheme and path.
+	if req.Method != http.MethodConnect {
+		pseudo[":scheme"] = req.URL.Scheme
+		pseudo[":path"] = req.URL.RequestURI()
+	}
+	for _, k := range cc.profile.pseudoOrder {
+		if v, ok := pseudo[k]; ok {
+			cc.henc.WriteField(hpack.HeaderField{Name: k, Value: v})
+		}
+	}
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch lk := strings.ToLower(k); lk {
+		case "connection", "proxy-connection", "keep-alive", "transfer-encoding", "upgrade", "host":
+		default:
+			for _, v := range req.Header[k] {
+				cc.henc.WriteField(hpack.HeaderField{Name: lk, Value: v})
+			}
+		}
+	}
+}
+
+func (cc *browserH2Conn) readLoop() {
+	err := cc.serve()
+	cc.close(err)
+}
+
+func (cc *browserH2Conn) serve() error {
+	for {
+		f, err := cc.fr.ReadFrame()
+		if err != nil {
+			return err
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			f.ForeachSetting(func(s http2.Setting) error {
+				cc.mux.Lock()
+				defer cc.mux.Unlock()
+				switch s.ID {
+				case http2.SettingInitialWindowSize:
+					delta := int32(s.Val) - cc.peerInitialWindow
+					cc.peerInitialWindow = int32(s.Val)
+					for _, st := range cc.streams {
+						st.sendWindow += delta
+					}
+					cc.cond.Broadcast()
+				case http2.SettingMaxFrameSize:
+					cc.peerMaxFrameSize = s.Val
+				}
+				return nil
+			})
+			if err := cc.writeFrames(cc.fr.WriteSettingsAck); err != nil {
+				return err
+			}
+		case *http2.PingFrame:
+			if f.IsAck() {
+				continue
+			}
+			if err := cc.writeFrames(func() error { return cc.fr.WritePing(true, f.Data) }); err != nil {
+				return err
+			}
+		case *http2.WindowUpdateFrame:
+			cc.mux.Lock()
+			if f.StreamID == 0 {
+				cc.sendWindow += int32(f.Increment)
+			} else if st := cc.streams[f.StreamID]; st != nil {
+				st.sendWindow += int32(f.Increment)
+			}
+			cc.cond.Broadcast()
+			cc.mux.Unlock()
+		case *http2.MetaHeadersFrame:
+			st := cc.stream(f.StreamID)
+			if st == nil {
+				continue
+			}
+			st.handleResponse(f)
+		case *http2.DataFrame:
+			// the flow control of the data of the unknown streams is acknowledged immediately.
+			if st := cc.stream(f.StreamID); st != nil && len(f.Data()) > 0 {
+				st.body.write(f.Data())
+			} else if f.Length > 0 {
+				cc.consumed(nil, int32(f.Length))
+			}
+			if f.StreamEnded() {
+				if st := cc.stream(f.StreamID); st != nil {
+					st.body.closeWithError(io.EOF)
+					st.remoteClosed()
+				}
+			}
+		case *http2.RSTStreamFrame:
+			if st := cc.stream(f.StreamID); st != nil {
+				err := http2.StreamError{StreamID: f.StreamID, Code: f.ErrCode}
+				st.fail(err)
+				cc.removeStream(st.id)
+			}
+		case *http2.GoAwayFrame:
+			cc.mux.Lock()
+			cc.goAway = true
+			var streams []*browserH2Stream
+			for id, st := range cc.streams {
+				if id > f.LastStreamID {
+					streams = append(streams, st)
+				}
+			}
+			cc.mux.Unlock()
+			for _, st := range streams {
+				st.fail(fmt.Errorf("h2: GOAWAY %s", f.ErrCode))
+				cc.removeStream(st.id)
+			}
+		}
+	}
+}
+
+func (cc *browserH2Conn) stream(id uint32) *browserH2Stream {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	return cc.streams[id]
+}
+
+func (cc *browserH2Conn) removeStream(id uint32) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	delete(cc.streams, id)
+	cc.cond.Broadcast()
+}
+
+// consumed acknowledges the data read from the stream, the WINDOW_UPDATE frames are sent
+// when half of the windows are consumed as the browsers.
+func (cc *browserH2Conn) consumed(st *browserH2Stream, n int32) {
+	cc.mux.Lock()
+	connWindow := int32(65535 + cc.profile.windowUpdate)
+	cc.unacked += n
+	var connIncr, streamIncr int32
+	if cc.unacked >= connWindow/2 {
+		connIncr, cc.unacked = cc.unacked, 0
+	}
+	if st != nil {
+		st.unacked += n
+		if st.unacked >= cc.recvWindow/2 {
+			streamIncr, st.unacked = st.unacked, 0
+		}
+	}
+	cc.mux.Unlock()
+
+	if connIncr == 0 && streamIncr == 0 {
+		return
+	}
+	cc.writeFrames(func() error {
+		if connIncr > 0 {
+			if err := cc.fr.WriteWindowUpdate(0, uint32(connIncr)); err != nil {
+				return err
+			}
+		}
+		if streamIncr > 0 {
+			return cc.fr.WriteWindowUpdate(st.id, uint32(streamIncr))
+		}
+		return nil
+	})
+}
+
+func (cc *browserH2Conn) close(err error) {
+	if err == nil {
+		err = errors.New("h2: connection closed")
+	}
+	cc.mux.Lock()
+	if cc.err == nil {
+		cc.err = err
+	}
+	streams := cc.streams
+	cc.streams = make(map[uint32]*browserH2Stream)
+	cc.cond.Broadcast()
+	cc.mux.Unlock()
+
+	cc.conn.Close()
+	for _, st := range streams {
+		st.fail(err)
+	}
+}
+
+type browserH2Stream struct {
+	conn       *browserH2Conn
+	id         uint32
+	sendWindow int32
+	unacked    int32
+	respc      chan *http.Response
+	errc       chan error
+	gotResp    bool
+	body       browserH2Body
+	closeOnce  sync.Once
+	mux        sync.Mutex
+	localEnd   bool
+	remoteEnd  bool
+}
+
+func (st *browserH2Stream) handleResponse(f *http2.MetaHeadersFrame) {
+	st.mux.Lock()
+	if st.gotResp {
+		// the trailers
+		st.mux.Unlock()
+		if f.StreamEnded() {
+			st.body.closeWithError(io.EOF)
+			st.remoteClosed()
+		}
+		return
+	}
+	st.gotResp = true
+	st.mux.Unlock()
+
+	status, err := strconv.Atoi(f.PseudoValue("status"))
+	if err != nil {
+		st.fail(errors.New("h2: malformed response status"))
+		st.reset(http2.ErrCodeProtocol)
+		return
+	}
+	resp := &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        make(http.Header),
+		ContentLength: -1,
+		Body:          &browserH2BodyReader{st},
+	}
+	for _, hf := range f.RegularFields() {
+		resp.Header.Add(http.CanonicalHeaderKey(hf.Name), hf.Value)
+	}
+	if cl := resp.Header.Get("Content-Length"); cl != "" {
+		resp.ContentLength, _ = strconv.ParseInt(cl, 10, 64)
+	}
+	if f.StreamEnded() {
+		st.body.closeWithError(io.EOF)
+		st.remoteClosed()
+	}
+	st.respc <- resp
+}
+
+// writeBody writes the request body by the DATA frames within the flow control windows.
+func (st *browserH2Stream) writeBody(body io.ReadCloser) {
+	defer body.Close()
+
+	cc := st.conn
+	buf := make([]byte, 16384)
+	for {
+		n, err := body.Read(buf)
+		for b := buf[:n]; len(b) > 0; {
+			cc.mux.Lock()
+			for cc.err == nil && cc.streams[st.id] == st && (cc.sendWindow <= 0 || st.sendWindow <= 0) {
+				cc.cond.Wait()
+			}
+			if cc.err != nil || cc.streams[st.id] != st {
+				cc.mux.Unlock()
+				return
+			}
+			size := min(int32(len(b)), cc.sendWindow, st.sendWindow, int32(cc.peerMaxFrameSize))
+			cc.sendWindow -= size
+			st.sendWindow -= size
+			cc.mux.Unlock()
+
+			p := b[:size]
+			if err := cc.writeFrames(func() error { return cc.fr.WriteData(st.id, false, p) }); err != nil {
+				cc.close(err)
+				return
+			}
+			b = b[size:]
+		}
+		if err != nil {
+			if err == io.EOF && cc.stream(st.id) == st {
+				cc.writeFrames(func() error { return cc.fr.WriteData(st.id, true, nil) })
+				st.mux.Lock()
+				st.localEnd = true
+				done := st.remoteEnd
+				st.mux.Unlock()
+				if done {
+					cc.removeStream(st.id)
+				}
+			} else if err != io.EOF {
+				st.reset(http2.ErrCodeCancel)
+			}
+			return
+		}
+	}
+}
+
+func (st *browserH2Stream) remoteClosed() {
+	st.mux.Lock()
+	st.remoteEnd = true
+	done := st.localEnd
+	st.mux.Unlock()
+	if done {
+		st.conn.removeStream(st.id)
+	}
+}
+
+// fail reports the error to the request and the response body.
+func (st *browserH2Stream) fail(err error) {
+	select {
+	case st.errc <- err:
+	default:
+	}
+	st.body.closeWithError(err)
+}
+
+// reset sends RST_STREAM if the stream is not closed.
+func (st *browserH2Stream) reset(code http2.ErrCode) {
+	cc := st.conn
+	cc.mux.Lock()
+	_, ok := cc.streams[st.id]
+	cc.mux.Unlock()
+	if !ok {
+		return
+	}
+	cc.removeStream(st.id)
+	// the buffered data is acknowledged for the connection window.
+	st.body.closeWithError(errors.New("h2: stream reset"))
+	st.body.mux.Lock()
+	n := st.body.buf.Len()
+	st.body.buf.Reset()
+	st.body.mux.Unlock()
+	if n > 0 {
+		cc.consumed(nil, int32(n))
+	}
+	cc.writeFrames(func() error { return cc.fr.WriteRSTStream(st.id, code) })
+}
+
+// browserH2Body buffers the data of the stream, it is bounded by the flow control window.
+type browserH2Body struct {
+	buf  bytes.Buffer
+	err  error
+	mux  sync.Mutex
+	cond *sync.Cond
+}
+
+func (b *browserH2Body) write(p []byte) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.err == nil {
+		b.buf.Write(p)
+		b.cond.Broadcast()
+	}
+}
+
+func (b *browserH2Body) closeWithError(err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.err == nil {
+		b.err = err
+		b.cond.Broadcast()
+	}
+}
+
+type browserH2BodyReader struct {
+	st *browserH2Stream
+}
+
+func (r *browserH2BodyReader) Read(p []byte) (n int, err error) {
+	b := &r.st.body
+	b.mux.Lock()
+	for b.buf.Len() == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.buf.Len() > 0 {
+		n, _ = b.buf.Read(p)
+	} else {
+		err = b.err
+	}
+	b.mux.Unlock()
+
+	if n > 0 {
+		r.st.conn.consumed(r.st, int32(n))
+	}
+	return
+}
+
+func (r *browserH2BodyReader) Close() error {
+	r.st.closeOnce.Do(func() {
+		r.st.mux.Lock()
+		done := r.st.remoteEnd && r.st.localEnd
+		r.st.mux.Unlock()
+		if !done {
+			r.st.reset(http2.ErrCodeCancel)
+		}
+	})
+	return nil
+}
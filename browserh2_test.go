@@ -0,0 +1,119 @@
+package gost
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestBrowserH2(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	for browser := range h2BrowserProfiles {
+		t.Run(browser, func(t *testing.T) {
+			ln, err := HTTP2Listener("127.0.0.1:0", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &Server{
+				Listener: ln,
+				Handler:  HTTP2Handler(),
+			}
+			go server.Run()
+			defer server.Close()
+
+			client := &Client{
+				Connector:   HTTP2Connector(nil),
+				Transporter: BrowserH2Transporter(browser, nil),
+			}
+			// the data is larger than the initial windows.
+			for _, size := range []int{128, 1 << 20} {
+				sendData := make([]byte, size)
+				rand.Read(sendData)
+				if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+					t.Fatal(size, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBrowserH2Fingerprint(t *testing.T) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: DefaultTLSConfig.Certificates,
+		NextProtos:   []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type fingerprint struct {
+		settings     []http2.Setting
+		windowUpdate uint32
+		priority     http2.PriorityParam
+	}
+	fpc := make(chan fingerprint, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var fp fingerprint
+		defer func() { fpc <- fp }()
+		if _, err := io.ReadFull(conn, make([]byte, len(http2.ClientPreface))); err != nil {
+			return
+		}
+		fr := http2.NewFramer(conn, conn)
+		fr.ReadMetaHeaders = nil
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := f.(type) {
+			case *http2.SettingsFrame:
+				f.ForeachSetting(func(s http2.Setting) error {
+					fp.settings = append(fp.settings, s)
+					return nil
+				})
+				fr.WriteSettings()
+			case *http2.WindowUpdateFrame:
+				fp.windowUpdate = f.Increment
+			case *http2.HeadersFrame:
+				fp.priority = f.Priority
+				return
+			}
+		}
+	}()
+
+	client := &Client{
+		Connector:   HTTP2Connector(nil),
+		Transporter: BrowserH2Transporter("firefox", nil),
+	}
+	conn, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go client.Connect(conn, "example.com:443")
+
+	fp := <-fpc
+	profile := h2BrowserProfiles["firefox"]
+	if !reflect.DeepEqual(fp.settings, profile.settings) {
+		t.Errorf("got settings %v, want %v", fp.settings, profile.settings)
+	}
+	if fp.windowUpdate != profile.windowUpdate {
+		t.Errorf("got window update %d, want %d", fp.windowUpdate, profile.windowUpdate)
+	}
+	if fp.priority != profile.priority {
+		t.Errorf("got priority %v, want %v", fp.priority, profile.priority)
+	}
+}
@@ -0,0 +1,714 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// BuildChainNodes creates the chain nodes of the node parsed by ParseNode, the client of the nodes is created by
+// the transport and the protocol of DefaultRegistry with the options of the node parameters.
+// A node is created for each address of the parameter ip, or the node itself if it is not set.
+func BuildChainNodes(node Node) (nodes []Node, err error) {
+	if err := nodeAuthUser(&node); err != nil {
+		return nil, err
+	}
+	if err := checkNodeFlow(node); err != nil {
+		return nil, err
+	}
+	if node.User == nil {
+		users, err := parseUsers(node.Get("secrets"))
+		if err != nil {
+			return nil, err
+		}
+		if len(users) > 0 {
+			node.User = users[0]
+		}
+	}
+
+	serverName, sport, _ := net.SplitHostPort(node.Addr)
+	if s := node.Get("serverName"); s != "" {
+		serverName = s
+	}
+	if serverName == "" {
+		serverName = "localhost" // default server name
+	}
+
+	rootCAs, err := loadCA(node.Get("ca"))
+	if err != nil {
+		return
+	}
+	tlsCfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: !node.GetBool("secure"),
+		RootCAs:            rootCAs,
+	}
+
+	// If the argument `ca` is given, but not open `secure`, we verify the
+	// certificate manually.
+	if rootCAs != nil && !node.GetBool("secure") {
+		tlsCfg.VerifyConnection = func(state tls.ConnectionState) error {
+			opts := x509.VerifyOptions{
+				Roots:         rootCAs,
+				CurrentTime:   time.Now(),
+				DNSName:       "",
+				Intermediates: x509.NewCertPool(),
+			}
+
+			certs := state.PeerCertificates
+			for i, cert := range certs {
+				if i == 0 {
+					continue
+				}
+				opts.Intermediates.AddCert(cert)
+			}
+
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+
+	if cert, err := tls.LoadX509KeyPair(node.Get("cert"), node.Get("key")); err == nil {
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	wsOpts := nodeWSOptions(node)
+	wsOpts.UserAgent = node.Get("agent")
+
+	timeout := node.GetDuration("timeout")
+
+	opts := &NodeOptions{
+		TLSConfig: tlsCfg,
+		WSOptions: wsOpts,
+	}
+	tr := TCPTransporter()
+	if _, t, _ := DefaultRegistry.LookupTransport(node.Transport); t.NewTransporter != nil {
+		if tr, err = t.NewTransporter(node, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	connector := AutoConnector(node.User)
+	if _, p, _ := DefaultRegistry.LookupProtocol(node.Protocol); p.NewConnector != nil {
+		connector = p.NewConnector(node, opts)
+	}
+
+	host := node.Get("host")
+	if host == "" {
+		host = node.Host
+	}
+
+	// source-ip, fwmark and ifaces are only supported by the raw TCP transporter.
+	if (node.Get("source-ip") != "" || node.GetInt("fwmark") != 0 || node.Get("ifaces") != "") && node.Transport != "tcp" {
+		return nil, fmt.Errorf("%s: source-ip, fwmark and ifaces are not supported by transport %s", node.String(), node.Transport)
+	}
+
+	node.DialOptions = append(node.DialOptions,
+		TimeoutDialOption(timeout),
+		HostDialOption(host),
+		WithDialSourceIP(net.ParseIP(node.Get("source-ip"))),
+		WithFWMark(uint32(node.GetInt("fwmark"))),
+	)
+	if ifaces := node.Get("ifaces"); ifaces != "" {
+		interfaces := strings.Split(ifaces, ",")
+		var metric InterfaceMetric
+		switch node.Get("ifmetric") {
+		case "throughput":
+			metric = NewThroughputMetric(interfaces...)
+		case "", "latency":
+			metric = NewLatencyMetric(interfaces...)
+		default:
+			return nil, fmt.Errorf("%s: unknown ifmetric %s", node.String(), node.Get("ifmetric"))
+		}
+		node.DialOptions = append(node.DialOptions, InterfaceSelector(interfaces, metric))
+	}
+
+	node.ConnectOptions = []ConnectOption{
+		UserAgentConnectOption(node.Get("agent")),
+		NoTLSConnectOption(node.GetBool("notls")),
+		NoDelayConnectOption(node.GetBool("nodelay")),
+	}
+
+	sshConfig := &SSHConfig{}
+	if s := node.Get("ssh_key"); s != "" {
+		key, err := ParseSSHKeyFile(s)
+		if err != nil {
+			return nil, err
+		}
+		sshConfig.Key = key
+	}
+	handshakeOptions := []HandshakeOption{
+		AddrHandshakeOption(node.Addr),
+		HostHandshakeOption(host),
+		UserHandshakeOption(node.User),
+		TLSConfigHandshakeOption(tlsCfg),
+		IntervalHandshakeOption(node.GetDuration("ping")),
+		TimeoutHandshakeOption(timeout),
+		RetryHandshakeOption(node.GetInt("retry")),
+		SSHConfigHandshakeOption(sshConfig),
+		WithXTLSFlow(node.Get("flow")),
+		WSOptionsHandshakeOption(wsOpts),
+	}
+	if attempts := node.GetInt("dial_attempts"); attempts > 1 {
+		var backoff RetryBackoff
+		if d := node.GetDuration("dial_backoff"); d > 0 {
+			backoff = ExponentialBackoff(d, node.GetDuration("dial_backoff_max"), 2)
+		}
+		handshakeOptions = append(handshakeOptions, WithRetry(attempts, backoff))
+	}
+
+	// keep the transport connections dialed in advance, e.g. socks5+tls://:1080?pool=2
+	if n := node.GetInt("pool"); n > 0 && !tr.Multiplex() {
+		tr = PooledTransporter(tr, n, node.GetInt("pool.max"), node.GetDuration("pool.idle"))
+	}
+
+	node.Client = &Client{
+		Connector:   connector,
+		Transporter: tr,
+	}
+
+	node.Bypass = ParseBypass(node.Get("bypass"))
+
+	ips := parseIP(node.Get("ip"), sport)
+	for _, ip := range ips {
+		nd := node.Clone()
+		nd.Addr = ip
+		// override the default node address
+		nd.HandshakeOptions = append(handshakeOptions, AddrHandshakeOption(ip))
+		// One node per IP
+		nodes = append(nodes, nd)
+	}
+	if len(ips) == 0 {
+		node.HandshakeOptions = handshakeOptions
+		nodes = []Node{node}
+	}
+
+	if node.Transport == "obfs4" {
+		for i := range nodes {
+			if err := Obfs4Init(nodes[i], false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return
+}
+
+// BuildServer creates the server of the serve node parsed by ParseNode, the listener and the handler are created by
+// the transport and the protocol of DefaultRegistry with the options of the node parameters.
+// The server is listening, and it is not started.
+func BuildServer(node Node, chain *Chain) (*Server, error) {
+	node, opts, err := serveNodeOptions(node, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var ln Listener
+	if _, t, _ := DefaultRegistry.LookupTransport(node.Transport); t.NewListener != nil {
+		ln, err = t.NewListener(node, opts)
+	} else {
+		ln, err = TCPListener(node.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if path := node.Get("pcap"); path != "" {
+		pln, err := PCAPListener(ln, path)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = pln
+	}
+	if feeds := node.Get("threat-feeds"); feeds != "" {
+		ln = FilteredListener(ln, ThreatIntelFilter(strings.Split(feeds, ","), node.GetDuration("threat-refresh")))
+	}
+	if path := node.Get("threat-feed"); path != "" {
+		ln = FilteredListener(ln, LocalThreatFeed(path))
+	}
+
+	handler, err := serveNodeHandler(node, opts, ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	if service := node.Get("mdns"); service != "" {
+		advertiser, err := MDNSAdvertise(service, ln.Addr().String())
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = &mdnsListener{Listener: ln, advertiser: advertiser}
+	}
+	return &Server{Listener: ln, Handler: handler}, nil
+}
+
+// serveNodeOptions resolves the user of the serve node, and prepares the options shared by the listener and the handler.
+func serveNodeOptions(node Node, chain *Chain) (Node, *NodeOptions, error) {
+	if err := nodeAuthUser(&node); err != nil {
+		return node, nil, err
+	}
+	if err := checkNodeFlow(node); err != nil {
+		return node, nil, err
+	}
+	authenticator, err := parseAuthenticator(node.Get("secrets"))
+	if err != nil {
+		return node, nil, err
+	}
+	if authenticator == nil && node.User != nil {
+		kvs := make(map[string]string)
+		kvs[node.User.Username()], _ = node.User.Password()
+		authenticator = NewLocalAuthenticator(kvs)
+	}
+	if node.User == nil {
+		if users, _ := parseUsers(node.Get("secrets")); len(users) > 0 {
+			node.User = users[0]
+		}
+	}
+	tlsCfg, err := serverTLSConfig(node)
+	if err != nil {
+		return node, nil, err
+	}
+	tlsOpts, err := ParseTLSListenerOptions(node.Get("tls-min-version"), node.Get("tls-cipher-suites"))
+	if err != nil {
+		return node, nil, err
+	}
+
+	tunRoutes := parseIPRoutes(node.Get("route"))
+	gw := net.ParseIP(node.Get("gw")) // default gateway
+	for i := range tunRoutes {
+		if tunRoutes[i].Gateway == nil {
+			tunRoutes[i].Gateway = gw
+		}
+	}
+
+	return node, &NodeOptions{
+		TLSConfig:          tlsCfg,
+		TLSListenerOptions: tlsOpts,
+		WSOptions:          nodeWSOptions(node),
+		Chain:              chain,
+		Authenticator:      authenticator,
+		IPRoutes:           tunRoutes,
+	}, nil
+}
+
+// serveNodeHandler creates the handler of the serve node, addr is the address of the listener.
+func serveNodeHandler(node Node, opts *NodeOptions, addr string) (Handler, error) {
+	var handler Handler
+	if _, p, _ := DefaultRegistry.LookupProtocol(node.Protocol); p.NewHandler != nil {
+		var err error
+		if handler, err = p.NewHandler(node, opts); err != nil {
+			return nil, err
+		}
+	} else if node.Remote != "" {
+		// start from 2.5, if remote is not empty, then we assume that it is a forward tunnel.
+		handler = TCPDirectForwardHandler(node.Remote)
+	} else {
+		handler = AutoHandler()
+	}
+
+	var whitelist, blacklist *Permissions
+	var err error
+	if node.Values.Get("whitelist") != "" {
+		if whitelist, err = ParsePermissions(node.Get("whitelist")); err != nil {
+			return nil, err
+		}
+	}
+	if node.Values.Get("blacklist") != "" {
+		if blacklist, err = ParsePermissions(node.Get("blacklist")); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := node.GetDuration("ttl")
+	timeout := node.GetDuration("timeout")
+
+	node.Bypass = ParseBypass(node.Get("bypass"))
+	hosts := parseHosts(node.Get("hosts"))
+	ips := parseIP(node.Get("ip"), "")
+
+	resolver := parseResolver(node.Get("dns"))
+	if resolver != nil {
+		resolver.Init(
+			ChainResolverOption(opts.Chain),
+			TimeoutResolverOption(timeout),
+			TTLResolverOption(ttl),
+			PreferResolverOption(node.Get("prefer")),
+			SrcIPResolverOption(net.ParseIP(node.Get("ip"))),
+		)
+	}
+
+	handler.Init(
+		AddrHandlerOption(addr),
+		ChainHandlerOption(opts.Chain),
+		UsersHandlerOption(node.User),
+		AuthenticatorHandlerOption(opts.Authenticator),
+		TLSConfigHandlerOption(opts.TLSConfig),
+		WhitelistHandlerOption(whitelist),
+		BlacklistHandlerOption(blacklist),
+		StrategyHandlerOption(NewStrategy(node.Get("strategy"))),
+		MaxFailsHandlerOption(node.GetInt("max_fails")),
+		FailTimeoutHandlerOption(node.GetDuration("fail_timeout")),
+		BypassHandlerOption(node.Bypass),
+		ResolverHandlerOption(resolver),
+		HostsHandlerOption(hosts),
+		RetryHandlerOption(node.GetInt("retry")), // override the global retry option.
+		TimeoutHandlerOption(timeout),
+		ProbeResistHandlerOption(node.Get("probe_resist")),
+		KnockingHandlerOption(node.Get("knock")),
+		NodeHandlerOption(node),
+		IPsHandlerOption(ips),
+		TCPModeHandlerOption(node.GetBool("tcp")),
+		IPRoutesHandlerOption(opts.IPRoutes...),
+		ProxyAgentHandlerOption(node.Get("proxyAgent")),
+		HTTPTunnelHandlerOption(node.GetBool("httpTunnel")),
+		WithHealthCheck(node.Get("healthcheck")),
+		WithHealthCheckUpstream(node.GetBool("healthcheck_upstream")),
+		WithStickyCookie(node.Get("sticky_cookie")),
+	)
+	return handler, nil
+}
+
+// nodeAuthUser sets the user of the node by the base64 encoded user:pass of the parameter auth.
+func nodeAuthUser(node *Node) error {
+	auth := node.Get("auth")
+	if auth == "" || node.User != nil {
+		return nil
+	}
+	c, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return err
+	}
+	cs := string(c)
+	s := strings.IndexByte(cs, ':')
+	if s < 0 {
+		node.User = url.User(cs)
+	} else {
+		node.User = url.UserPassword(cs[:s], cs[s+1:])
+	}
+	return nil
+}
+
+func nodeWSOptions(node Node) *WSOptions {
+	return &WSOptions{
+		EnableCompression: node.GetBool("compression"),
+		ReadBufferSize:    node.GetInt("rbuf"),
+		WriteBufferSize:   node.GetInt("wbuf"),
+		Path:              node.Get("path"),
+	}
+}
+
+// isTLSTransport reports whether the transport of DefaultRegistry is over TLS.
+func isTLSTransport(transport string) bool {
+	_, t, _ := DefaultRegistry.LookupTransport(transport)
+	return t.TLS
+}
+
+// serverTLSConfig loads the certificate of the cert and key parameters of the serve node, the client certificates
+// are verified by the CA of the ca parameter. It is nil if DefaultTLSConfig is used.
+func serverTLSConfig(node Node) (*tls.Config, error) {
+	certFile, keyFile := node.Get("cert"), node.Get("key")
+	if certFile == "" && keyFile == "" {
+		if DefaultTLSConfig == nil {
+			if isTLSTransport(node.Transport) {
+				return nil, fmt.Errorf("transport %s requires a TLS certificate, set the cert and key options", node.Transport)
+			}
+			return nil, nil
+		}
+		if node.Get("ca") == "" {
+			return nil, nil
+		}
+		// the client certificates of the default certificate.
+		pool, err := loadCA(node.Get("ca"))
+		if err != nil {
+			return nil, err
+		}
+		cfg := DefaultTLSConfig.Clone()
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		return cfg, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both the cert and key options are required for the TLS certificate")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load the TLS certificate (cert %s, key %s): %w", certFile, keyFile, err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	pool, err := loadCA(node.Get("ca"))
+	if err != nil {
+		return nil, err
+	}
+	if pool != nil {
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func loadCA(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("load the CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("load the CA certificate %s: no PEM certificate found", caFile)
+	}
+	return pool, nil
+}
+
+func parseUsers(authFile string) (users []*url.Userinfo, err error) {
+	if authFile == "" {
+		return
+	}
+
+	file, err := os.Open(authFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		s := strings.SplitN(line, " ", 2)
+		if len(s) == 1 {
+			users = append(users, url.User(strings.TrimSpace(s[0])))
+		} else if len(s) == 2 {
+			users = append(users, url.UserPassword(strings.TrimSpace(s[0]), strings.TrimSpace(s[1])))
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
+
+func parseAuthenticator(s string) (Authenticator, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, err := os.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	au := NewLocalAuthenticator(nil)
+	au.Reload(f)
+
+	go PeriodReload(au, s)
+
+	return au, nil
+}
+
+func parseIP(s string, port string) (ips []string) {
+	if s == "" {
+		return
+	}
+	if port == "" {
+		port = "8080" // default port
+	}
+
+	addrFn := func(s, port string) string {
+		c := strings.Count(s, ":")
+		if c == 0 || //ipv4 or domain
+			s[len(s)-1] == ']' { //[ipv6]
+			return s + ":" + port
+		}
+		if c > 1 && s[0] != '[' { // ipv6
+			return "[" + s + "]:" + port
+		}
+		return s //ipv4:port or [ipv6]:port
+	}
+
+	file, err := os.Open(s)
+	if err != nil {
+		ss := strings.Split(s, ",")
+		for _, s := range ss {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				ips = append(ips, addrFn(s, port))
+			}
+
+		}
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ips = append(ips, addrFn(line, port))
+	}
+	return
+}
+
+// ParseBypass creates the Bypass of the comma separated patterns, or of the file that is reloaded periodically.
+// The bypass is reversed if s has the prefix ~.
+func ParseBypass(s string) *Bypass {
+	if s == "" {
+		return nil
+	}
+	var matchers []Matcher
+	var reversed bool
+	if strings.HasPrefix(s, "~") {
+		reversed = true
+		s = strings.TrimLeft(s, "~")
+	}
+
+	f, err := os.Open(s)
+	if err != nil {
+		for _, s := range strings.Split(s, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			matchers = append(matchers, NewMatcher(s))
+		}
+		return NewBypass(reversed, matchers...)
+	}
+	defer f.Close()
+
+	bp := NewBypass(reversed)
+	bp.Reload(f)
+	go PeriodReload(bp, s)
+
+	return bp
+}
+
+func parseResolver(cfg string) Resolver {
+	if cfg == "" {
+		return nil
+	}
+	var nss []NameServer
+
+	f, err := os.Open(cfg)
+	if err != nil {
+		for _, s := range strings.Split(cfg, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if strings.HasPrefix(s, "https") {
+				p := "https"
+				u, _ := url.Parse(s)
+				if u == nil || u.Scheme == "" {
+					continue
+				}
+				if u.Scheme == "https-chain" {
+					p = u.Scheme
+				}
+				ns := NameServer{
+					Addr:     s,
+					Protocol: p,
+				}
+				nss = append(nss, ns)
+				continue
+			}
+
+			ss := strings.Split(s, "/")
+			if len(ss) == 1 {
+				ns := NameServer{
+					Addr: ss[0],
+				}
+				nss = append(nss, ns)
+			}
+			if len(ss) == 2 {
+				ns := NameServer{
+					Addr:     ss[0],
+					Protocol: ss[1],
+				}
+				nss = append(nss, ns)
+			}
+		}
+		return NewResolver(0, nss...)
+	}
+	defer f.Close()
+
+	resolver := NewResolver(0)
+	resolver.Reload(f)
+
+	go PeriodReload(resolver, cfg)
+
+	return resolver
+}
+
+func parseHosts(s string) *Hosts {
+	f, err := os.Open(s)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	hosts := NewHosts()
+	hosts.Reload(f)
+
+	go PeriodReload(hosts, s)
+
+	return hosts
+}
+
+func parseIPRoutes(s string) (routes []IPRoute) {
+	if s == "" {
+		return
+	}
+
+	file, err := os.Open(s)
+	if err != nil {
+		ss := strings.Split(s, ",")
+		for _, s := range ss {
+			if _, inet, _ := net.ParseCIDR(strings.TrimSpace(s)); inet != nil {
+				routes = append(routes, IPRoute{Dest: inet})
+			}
+		}
+		return
+	}
+
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Replace(scanner.Text(), "\t", " ", -1)
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var route IPRoute
+		var ss []string
+		for _, s := range strings.Split(line, " ") {
+			if s = strings.TrimSpace(s); s != "" {
+				ss = append(ss, s)
+			}
+		}
+		if len(ss) > 0 && ss[0] != "" {
+			_, route.Dest, _ = net.ParseCIDR(strings.TrimSpace(ss[0]))
+			if route.Dest == nil {
+				continue
+			}
+		}
+		if len(ss) > 1 && ss[1] != "" {
+			route.Gateway = net.ParseIP(ss[1])
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
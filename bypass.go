@@ -23,6 +23,7 @@ type Matcher interface {
 
 // NewMatcher creates a Matcher for the given pattern.
 // The acutal Matcher depends on the pattern:
+// Keyword Matcher if pattern is a keyword such as '<local>' or '<private>'.
 // IP Matcher if pattern is a valid IP address.
 // CIDR Matcher if pattern is a valid CIDR address.
 // Domain Matcher if both of the above are not.
@@ -30,6 +31,9 @@ func NewMatcher(pattern string) Matcher {
 	if pattern == "" {
 		return nil
 	}
+	if m := KeywordMatcher(pattern); m != nil {
+		return m
+	}
 	if ip := net.ParseIP(pattern); ip != nil {
 		return IPMatcher(ip)
 	}
@@ -118,6 +122,49 @@ func (m *domainMatcher) String() string {
 	return "domain " + m.pattern
 }
 
+var bypassKeywords = map[string][]string{
+	// loopback addresses
+	"<local>": {"localhost", "127.0.0.0/8", "::1/128"},
+	// RFC 1918 private addresses and RFC 4193 unique local addresses
+	"<private>": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+}
+
+type keywordMatcher struct {
+	keyword  string
+	matchers []Matcher
+}
+
+// KeywordMatcher creates a Matcher for a shortcut keyword,
+// '<local>' matches the loopback addresses and '<private>' matches the private network addresses.
+// It returns nil if the keyword is unknown.
+func KeywordMatcher(keyword string) Matcher {
+	patterns, ok := bypassKeywords[keyword]
+	if !ok {
+		return nil
+	}
+	m := &keywordMatcher{keyword: keyword}
+	for _, pattern := range patterns {
+		m.matchers = append(m.matchers, NewMatcher(pattern))
+	}
+	return m
+}
+
+func (m *keywordMatcher) Match(v string) bool {
+	if m == nil {
+		return false
+	}
+	for _, matcher := range m.matchers {
+		if matcher.Match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *keywordMatcher) String() string {
+	return "keyword " + m.keyword
+}
+
 // Bypass is a filter for address (IP or domain).
 // It contains a list of matchers.
 type Bypass struct {
@@ -186,6 +233,12 @@ func (bp *Bypass) Contains(addr string) bool {
 		bp.reversed && !matched
 }
 
+// ShouldBypass reports whether the connection to host should bypass the proxy chain,
+// host can be an IP address or domain name with an optional port.
+func (bp *Bypass) ShouldBypass(host string) bool {
+	return bp.Contains(host)
+}
+
 // AddMatchers appends matchers to the bypass matcher list.
 func (bp *Bypass) AddMatchers(matchers ...Matcher) {
 	bp.mux.Lock()
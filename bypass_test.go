@@ -155,6 +155,27 @@ var bypassContainTests = []struct {
 	{[]string{".example.com:*"}, false, "example.com:80", false},
 	{[]string{".example.com:*"}, false, "www.example.com:8080", false},
 	{[]string{".example.com:*"}, false, "http://www.example.com:80", true},
+
+	// keywords
+	{[]string{"<local>"}, false, "localhost", true},
+	{[]string{"<local>"}, false, "localhost:8080", true},
+	{[]string{"<local>"}, false, "127.0.0.1", true},
+	{[]string{"<local>"}, false, "127.1.2.3:80", true},
+	{[]string{"<local>"}, false, "::1", true},
+	{[]string{"<local>"}, false, "[::1]:80", true},
+	{[]string{"<local>"}, false, "192.168.1.1", false},
+	{[]string{"<local>"}, true, "127.0.0.1", false},
+	{[]string{"<private>"}, false, "10.1.2.3", true},
+	{[]string{"<private>"}, false, "172.16.0.1", true},
+	{[]string{"<private>"}, false, "172.31.255.255:443", true},
+	{[]string{"<private>"}, false, "172.32.0.1", false},
+	{[]string{"<private>"}, false, "192.168.1.1", true},
+	{[]string{"<private>"}, false, "fd00::1", true},
+	{[]string{"<private>"}, false, "8.8.8.8", false},
+	{[]string{"<private>"}, false, "localhost", false},
+	{[]string{"<private>"}, true, "8.8.8.8", true},
+	{[]string{"<local>", "<private>", "*.local"}, false, "printer.local", true},
+	{[]string{"<local>", "<private>", "*.local"}, false, "example.com", false},
 }
 
 func TestBypassContains(t *testing.T) {
@@ -301,3 +322,30 @@ func TestByapssReload(t *testing.T) {
 		}
 	}
 }
+
+func TestChainBypass(t *testing.T) {
+	chain := NewChain(Node{
+		Addr:   "127.0.0.1:1080",
+		Client: &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()},
+	})
+	chain.Bypass = NewBypassPatterns(false, "<local>", "<private>")
+
+	for _, tc := range []struct {
+		addr   string
+		direct bool
+	}{
+		{"127.0.0.1:80", true},
+		{"localhost:80", true},
+		{"192.168.1.1:80", true},
+		{"example.com:80", false},
+		{"8.8.8.8:53", false},
+	} {
+		route, err := chain.selectRouteFor(tc.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if route.IsEmpty() != tc.direct {
+			t.Errorf("%s: direct %v, want %v", tc.addr, route.IsEmpty(), tc.direct)
+		}
+	}
+}
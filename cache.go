@@ -0,0 +1,468 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// maxCacheEntrySize is the max size of a cached response, the response is buffered in memory.
+const maxCacheEntrySize = 32 << 20
+
+type cachingHandler struct {
+	upstream Handler
+	cache    *httpCache
+}
+
+// CachingHandler creates a Handler which caches the responses of the plain HTTP proxy requests
+// handled by the upstream (HTTP) handler, the other requests (e.g. CONNECT) are passed to the upstream handler.
+//
+// The GET responses with 'Cache-Control: max-age' (or 's-maxage') or 'Expires' headers are stored in the cacheDir,
+// named by the SHA-256 of the request. The fresh responses are served without hitting the upstream,
+// the stale responses are validated by the conditional requests with 'If-None-Match' and 'If-Modified-Since'.
+// The least recently used responses are evicted if the total size exceeds maxSizeBytes.
+//
+// The Proxy-Authorization header is a part of the cache key, so the cached responses are not served
+// to the clients which are not authenticated by the upstream handler with the same credentials.
+func CachingHandler(upstream Handler, cacheDir string, maxSizeBytes int64) Handler {
+	cache, err := newHTTPCache(cacheDir, maxSizeBytes)
+	if err != nil {
+		log.Logf("[cache] %s: %v, caching is disabled", cacheDir, err)
+	}
+	return &cachingHandler{
+		upstream: upstream,
+		cache:    cache,
+	}
+}
+
+func (h *cachingHandler) Init(options ...HandlerOption) {
+	h.upstream.Init(options...)
+}
+
+func (h *cachingHandler) Handle(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	for {
+		if _, err := br.Peek(1); err != nil {
+			conn.Close()
+			return
+		}
+		if h.cache == nil || !isCacheableRequestLine(br) {
+			h.upstream.Handle(&bufferdConn{Conn: conn, br: br})
+			return
+		}
+
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			log.Logf("[cache] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+			conn.Close()
+			return
+		}
+		if err := h.serve(conn, req); err != nil {
+			log.Logf("[cache] %s - %s : %s", conn.RemoteAddr(), req.URL, err)
+			conn.Close()
+			return
+		}
+		if req.Close {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// isCacheableRequestLine reports whether the request is a GET request with the absolute HTTP URI.
+func isCacheableRequestLine(br *bufio.Reader) bool {
+	const prefix = "GET http://"
+	b, _ := br.Peek(len(prefix))
+	return string(b) == prefix
+}
+
+func (h *cachingHandler) serve(conn net.Conn, req *http.Request) error {
+	if !isCacheableRequest(req) {
+		resp, err := h.roundTrip(conn, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return resp.Write(conn)
+	}
+
+	key := httpCacheKey(req)
+	// the cache is validated with our own conditional request.
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+
+	entry, err := h.cache.load(key, req)
+	if err != nil && !os.IsNotExist(err) {
+		log.Logf("[cache] %s - %s : %s", conn.RemoteAddr(), req.URL, err)
+	}
+	if entry != nil {
+		if entry.fresh() && !isNoCacheRequest(req) {
+			if Debug {
+				log.Logf("[cache] %s - %s : HIT", conn.RemoteAddr(), req.URL)
+			}
+			return entry.write(conn)
+		}
+		if etag := entry.resp.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.resp.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := h.roundTrip(conn, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		if Debug {
+			log.Logf("[cache] %s - %s : REVALIDATED", conn.RemoteAddr(), req.URL)
+		}
+		for _, k := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if v, ok := resp.Header[k]; ok {
+				entry.resp.Header[k] = v
+			}
+		}
+		entry.stored = time.Now()
+		if err := h.cache.store(key, entry.resp, entry.body); err != nil {
+			log.Logf("[cache] %s - %s : %s", conn.RemoteAddr(), req.URL, err)
+		}
+		return entry.write(conn)
+	}
+
+	if Debug {
+		log.Logf("[cache] %s - %s : MISS", conn.RemoteAddr(), req.URL)
+	}
+	if !isCacheableResponse(resp) {
+		return resp.Write(conn)
+	}
+
+	limit := h.cache.maxSize
+	if limit > maxCacheEntrySize {
+		limit = maxCacheEntrySize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		resp.Body = &inspectedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), body: resp.Body}
+		return resp.Write(conn)
+	}
+
+	if err := h.cache.store(key, resp, body); err != nil {
+		log.Logf("[cache] %s - %s : %s", conn.RemoteAddr(), req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	return resp.Write(conn)
+}
+
+// roundTrip sends the request to the upstream handler through a pipe and reads the response.
+func (h *cachingHandler) roundTrip(conn net.Conn, req *http.Request) (*http.Response, error) {
+	c1, c2 := net.Pipe()
+	go h.upstream.Handle(&cachePipeConn{Conn: c2, localAddr: conn.LocalAddr(), remoteAddr: conn.RemoteAddr()})
+
+	if err := req.WriteProxy(c1); err != nil {
+		c1.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(c1), req)
+	if err != nil {
+		c1.Close()
+		return nil, err
+	}
+	resp.Body = &inspectedBody{Reader: resp.Body, body: c1}
+	return resp, nil
+}
+
+// cachePipeConn is the server side of the pipe to the upstream handler,
+// it has the addresses of the client connection for the upstream handler.
+type cachePipeConn struct {
+	net.Conn
+	localAddr  net.Addr
+	remoteAddr net.Addr
+}
+
+func (c *cachePipeConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *cachePipeConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func httpCacheKey(req *http.Request) string {
+	key := req.URL.String() + "\n" +
+		req.Header.Get("Accept-Encoding") + "\n" +
+		req.Header.Get("Proxy-Authorization")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" || req.Header.Get("Range") != "" {
+		return false
+	}
+	_, noStore := parseCacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+func isNoCacheRequest(req *http.Request) bool {
+	_, noCache := parseCacheControl(req.Header)["no-cache"]
+	return noCache || req.Header.Get("Pragma") == "no-cache"
+}
+
+func isCacheableResponse(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, v := range resp.Header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if !strings.EqualFold(strings.TrimSpace(field), "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	lifetime, ok := cacheLifetime(resp.Header)
+	return ok && (lifetime > 0 || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "")
+}
+
+// cacheLifetime returns the freshness lifetime of the response,
+// it reports false if the response can not be cached.
+func cacheLifetime(header http.Header) (time.Duration, bool) {
+	cc := parseCacheControl(header)
+	if _, ok := cc["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := cc["private"]; ok {
+		return 0, false
+	}
+
+	var lifetime time.Duration
+	var ok bool
+	if v, found := cc["s-maxage"]; found {
+		lifetime, ok = parseCacheSeconds(v)
+	}
+	if v, found := cc["max-age"]; found && !ok {
+		lifetime, ok = parseCacheSeconds(v)
+	}
+	if !ok {
+		expires, err := http.ParseTime(header.Get("Expires"))
+		if err != nil {
+			// an invalid Expires (e.g. 0) means already expired.
+			if header.Get("Expires") == "" {
+				return 0, false
+			}
+			expires = time.Time{}
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		lifetime, ok = expires.Sub(date), true
+	}
+	if _, noCache := cc["no-cache"]; noCache || lifetime < 0 {
+		lifetime = 0
+	}
+	return lifetime, ok
+}
+
+func parseCacheSeconds(v string) (time.Duration, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+	}
+	return cc
+}
+
+type httpCacheEntry struct {
+	resp   *http.Response
+	body   []byte
+	stored time.Time
+}
+
+func (e *httpCacheEntry) fresh() bool {
+	lifetime, _ := cacheLifetime(e.resp.Header)
+	return time.Since(e.stored) < lifetime
+}
+
+func (e *httpCacheEntry) write(w io.Writer) error {
+	resp := *e.resp
+	resp.Header = e.resp.Header.Clone()
+	resp.Header.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	resp.Body = io.NopCloser(bytes.NewReader(e.body))
+	resp.ContentLength = int64(len(e.body))
+	resp.TransferEncoding = nil
+	return resp.Write(w)
+}
+
+type httpCacheFile struct {
+	size   int64
+	access time.Time
+}
+
+// httpCache is the on-disk store of the HTTP responses,
+// the file modification time is the time the response is stored (or validated).
+type httpCache struct {
+	dir     string
+	maxSize int64
+	mux     sync.Mutex
+	files   map[string]*httpCacheFile
+	size    int64
+}
+
+func newHTTPCache(dir string, maxSize int64) (*httpCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &httpCache{
+		dir:     dir,
+		maxSize: maxSize,
+		files:   make(map[string]*httpCacheFile),
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		if _, err := hex.DecodeString(entry.Name()); err != nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		c.files[entry.Name()] = &httpCacheFile{size: info.Size(), access: info.ModTime()}
+		c.size += info.Size()
+	}
+	c.mux.Lock()
+	c.evict("")
+	c.mux.Unlock()
+	return c, nil
+}
+
+func (c *httpCache) load(key string, req *http.Request) (*httpCacheEntry, error) {
+	c.mux.Lock()
+	if f := c.files[key]; f != nil {
+		f.access = time.Now()
+	}
+	c.mux.Unlock()
+
+	file, err := os.Open(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(file), req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &httpCacheEntry{resp: resp, body: body, stored: info.ModTime()}, nil
+}
+
+func (c *httpCache) store(key string, resp *http.Response, body []byte) error {
+	stored := *resp
+	stored.Body = io.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	stored.Close = false
+
+	buf := &bytes.Buffer{}
+	if err := stored.Write(buf); err != nil {
+		return err
+	}
+	size := int64(buf.Len())
+	if size > c.maxSize {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if f := c.files[key]; f != nil {
+		c.size -= f.size
+	}
+	c.files[key] = &httpCacheFile{size: size, access: time.Now()}
+	c.size += size
+	c.evict(key)
+	return nil
+}
+
+// evict removes the least recently used files until the total size does not exceed the max size,
+// the file of the key is kept. The caller must hold the lock.
+func (c *httpCache) evict(keep string) {
+	for c.size > c.maxSize {
+		var oldest string
+		for k, f := range c.files {
+			if k != keep && (oldest == "" || f.access.Before(c.files[oldest].access)) {
+				oldest = k
+			}
+		}
+		if oldest == "" {
+			return
+		}
+		os.Remove(filepath.Join(c.dir, oldest))
+		c.size -= c.files[oldest].size
+		delete(c.files, oldest)
+	}
+}
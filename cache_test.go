@@ -0,0 +1,141 @@
+package gost
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func cachingProxyServer(t *testing.T, dir string, maxSize int64) (*http.Client, func()) {
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  CachingHandler(HTTPHandler(), dir, maxSize),
+	}
+	go server.Run()
+
+	proxyURL, _ := url.Parse("http://" + ln.Addr().String())
+	tr := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	return &http.Client{Transport: tr}, func() {
+		tr.CloseIdleConnections()
+		server.Close()
+	}
+}
+
+func TestCachingHandler(t *testing.T) {
+	var hits, validations int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/expires":
+			w.Header().Set("Expires", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		case "/etag":
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&validations, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	client, closeProxy := cachingProxyServer(t, t.TempDir(), 1<<20)
+	defer closeProxy()
+
+	tests := []struct {
+		path        string
+		hits        int32
+		validations int32
+	}{
+		{"/fresh", 1, 0},
+		{"/expires", 1, 0},
+		{"/etag", 2, 1},
+		{"/nostore", 2, 0},
+	}
+	for _, tc := range tests {
+		atomic.StoreInt32(&hits, 0)
+		atomic.StoreInt32(&validations, 0)
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(origin.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(body) != tc.path {
+				t.Errorf("%s #%d: got %d %q", tc.path, i, resp.StatusCode, body)
+			}
+		}
+		if n := atomic.LoadInt32(&hits); n != tc.hits {
+			t.Errorf("%s: got %d upstream requests, want %d", tc.path, n, tc.hits)
+		}
+		if n := atomic.LoadInt32(&validations); n != tc.validations {
+			t.Errorf("%s: got %d validations, want %d", tc.path, n, tc.validations)
+		}
+	}
+}
+
+func TestCachingHandlerPersistent(t *testing.T) {
+	var hits int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		client, closeProxy := cachingProxyServer(t, dir, 1<<20)
+		resp, err := client.Get(origin.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		closeProxy()
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("got %d upstream requests, want 1", n)
+	}
+}
+
+func TestHTTPCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newHTTPCache(dir, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := make([]byte, 100)
+	resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{}}
+	for _, key := range []string{"aa", "bb", "cc"} {
+		if err := c.store(key, resp, body); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.size > 300 {
+		t.Errorf("got cache size %d, want <= 300", c.size)
+	}
+	if _, err := os.Stat(dir + "/aa"); !os.IsNotExist(err) {
+		t.Error("the least recently used entry is not evicted")
+	}
+	if _, err := os.Stat(dir + "/cc"); err != nil {
+		t.Error(err)
+	}
+}
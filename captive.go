@@ -0,0 +1,105 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterProtocol("captive", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return RedirectHandler(node.Get("url"), node.GetInt("code")), nil
+		},
+	})
+}
+
+// redirectMaxLineSize is the max size of the request line read by RedirectHandler.
+const redirectMaxLineSize = 4096
+
+// httpRequestLine matches the request line of HTTP/1.x, e.g. 'GET / HTTP/1.1'.
+var httpRequestLine = regexp.MustCompile(`^[A-Z]+ \S+ HTTP/1\.[01]\r?\n$`)
+
+type redirectHandler struct {
+	targetURL string
+	code      int
+}
+
+// RedirectHandler creates a server Handler that responds to any HTTP request with a redirect to the targetURL,
+// e.g. for simulating the captive portals. The code is one of 301, 302 and 307, defaults to 302.
+// The first line of the connection is read, the connection is closed if it is not a HTTP request line
+// (e.g. SOCKS5 or the other protocols).
+func RedirectHandler(targetURL string, code int) Handler {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect:
+	default:
+		code = http.StatusFound
+	}
+	return &redirectHandler{
+		targetURL: targetURL,
+		code:      code,
+	}
+}
+
+func (h *redirectHandler) Init(options ...HandlerOption) {
+}
+
+func (h *redirectHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+	br := bufio.NewReaderSize(conn, redirectMaxLineSize)
+	if !httpRequestLine.Match(peekLine(br)) {
+		log.Logf("[redirect] %s - %s : not a HTTP request", conn.RemoteAddr(), conn.LocalAddr())
+		return
+	}
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		log.Logf("[redirect] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if Debug {
+		log.Logf("[redirect] %s - %s : %s %s -> %d %s", conn.RemoteAddr(), conn.LocalAddr(), req.Method, req.RequestURI, h.code, h.targetURL)
+	}
+
+	body := fmt.Sprintf("<a href=\"%s\">%s</a>.\n", html.EscapeString(h.targetURL), http.StatusText(h.code))
+	resp := &http.Response{
+		StatusCode:    h.code,
+		Request:       req,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+	}
+	resp.Header.Set("Location", h.targetURL)
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Connection", "close")
+	resp.Write(conn)
+}
+
+// peekLine returns the buffered first line, it is nil if the line is not found within the buffer size,
+// or the line does not start with a HTTP method.
+func peekLine(br *bufio.Reader) []byte {
+	for n := 1; n <= br.Size(); n++ {
+		b, err := br.Peek(n)
+		if err != nil || b[0] < 'A' || b[0] > 'Z' {
+			return nil
+		}
+		if b[n-1] == '\n' {
+			return b
+		}
+	}
+	return nil
+}
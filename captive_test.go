@@ -0,0 +1,81 @@
+package gost
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func redirectTestServer(t *testing.T, code int) *Server {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  RedirectHandler("http://portal.example.com/login", code),
+	}
+	go server.Run()
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestRedirectHandler(t *testing.T) {
+	for _, tc := range []struct {
+		code, want int
+	}{
+		{http.StatusMovedPermanently, http.StatusMovedPermanently},
+		{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect},
+		{0, http.StatusFound},
+	} {
+		server := redirectTestServer(t, tc.code)
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			// the requests of the HTTP proxy clients are redirected too.
+			proxyURL, _ := url.Parse("http://" + server.Addr().String())
+			client := &http.Client{
+				Transport:     &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+				CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+			}
+			req, _ := http.NewRequest(method, "http://www.example.com/", nil)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.want {
+				t.Errorf("%s: got status %d, want %d", method, resp.StatusCode, tc.want)
+			}
+			if loc := resp.Header.Get("Location"); loc != "http://portal.example.com/login" {
+				t.Errorf("%s: got location %q", method, loc)
+			}
+		}
+	}
+}
+
+func TestRedirectHandlerNonHTTP(t *testing.T) {
+	server := redirectTestServer(t, http.StatusFound)
+
+	for _, data := range [][]byte{
+		{5, 1, 0}, // SOCKS5
+		[]byte("HELLO WORLD\r\n"),
+	} {
+		conn, err := net.Dial("tcp", server.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second))
+		conn.Write(data)
+		b, err := io.ReadAll(bufio.NewReader(conn))
+		conn.Close()
+		if err != nil {
+			t.Errorf("%q: %v", data, err)
+		}
+		if len(b) > 0 {
+			t.Errorf("%q: unexpected response %q", data, b)
+		}
+	}
+}
@@ -18,12 +18,17 @@ var (
 
 // Chain is a proxy chain that holds a list of proxy node groups.
 type Chain struct {
-	isRoute    bool
-	Retries    int
-	Mark       int
-	Interface  string
-	nodeGroups []*NodeGroup
-	route      []Node // nodes in the selected route
+	isRoute   bool
+	Retries   int
+	Mark      int
+	Interface string
+	Bypass    *Bypass // the addresses that connect directly, without the chain
+	// SplitTunnel are the destination ranges that connect through the chain if it is not empty,
+	// the others connect directly. The domain names are checked by the resolver and the hosts of the dial,
+	// and connect through the chain if they can not be resolved by them.
+	SplitTunnel []*net.IPNet
+	nodeGroups  []*NodeGroup
+	route       []Node // nodes in the selected route
 }
 
 // NewChain creates a proxy chain with a list of proxy nodes.
@@ -150,10 +155,17 @@ func (c *Chain) dialWithOptions(ctx context.Context, network, address string, op
 	if err != nil {
 		return nil, err
 	}
+	if len(c.SplitTunnel) > 0 && !route.IsEmpty() && !splitTunnelProxied(c.SplitTunnel, address, options.Resolver, options.Hosts) {
+		route = c.newRoute()
+	}
 
 	ipAddr := address
 	if address != "" {
+		start := time.Now()
 		ipAddr = c.resolve(address, options.Resolver, options.Hosts)
+		if t := options.trace; t != nil && (options.Resolver != nil || options.Hosts != nil) {
+			t.DNS = time.Since(start)
+		}
 		if ipAddr == "" {
 			return nil, fmt.Errorf("resolver: domain %s does not exists", address)
 		}
@@ -280,46 +292,117 @@ func (c *Chain) getConn(ctx context.Context) (conn net.Conn, err error) {
 		err = ErrEmptyChain
 		return
 	}
-	nodes := c.Nodes()
-	node := nodes[0]
-
-	cc, err := node.Client.Dial(node.Addr, node.DialOptions...)
-	if err != nil {
-		node.MarkDead()
-		return
-	}
+	return c.connectNodes(ctx, c.Nodes())
+}
 
-	cn, err := node.Client.Handshake(cc, node.HandshakeOptions...)
+// connectNodes obtains a connection to the last node of the nodes.
+func (c *Chain) connectNodes(ctx context.Context, nodes []Node) (net.Conn, error) {
+	node := nodes[0]
+	cn, err := c.dialNode(ctx, node)
 	if err != nil {
-		cc.Close()
 		node.MarkDead()
-		return
+		return nil, err
 	}
 	node.ResetDead()
 
-	preNode := node
-	for _, node := range nodes[1:] {
-		var cc net.Conn
-		cc, err = preNode.Client.ConnectContext(ctx, cn, "tcp", node.Addr, preNode.ConnectOptions...)
+	for i, node := range nodes[1:] {
+		cn, err = c.connectNode(ctx, cn, nodes[:i+1], node)
 		if err != nil {
-			cn.Close()
 			node.MarkDead()
+			return nil, err
+		}
+		node.ResetDead()
+	}
+	return cn, nil
+}
+
+// dialNode dials and handshakes with the node,
+// it retries according to the retry options of the node.
+func (c *Chain) dialNode(ctx context.Context, node Node) (conn net.Conn, err error) {
+	attempts, backoff := nodeRetry(node)
+	for i := 1; i <= attempts; i++ {
+		if i > 1 {
+			if err = waitRetry(ctx, node, i, attempts, backoff, err); err != nil {
+				return
+			}
+		}
+
+		var cc net.Conn
+		cc, err = node.Client.Dial(node.Addr, node.DialOptions...)
+		if err == nil {
+			conn, err = node.Client.Handshake(cc, node.HandshakeOptions...)
+			if err == nil {
+				return
+			}
+			cc.Close()
+		}
+		if ctx.Err() != nil || isPermanentError(err) {
 			return
 		}
-		cc, err = node.Client.Handshake(cc, node.HandshakeOptions...)
-		if err != nil {
-			cn.Close()
-			node.MarkDead()
+	}
+	return
+}
+
+// connectNode connects to the node by the connection cn of the previous nodes prev and handshakes with it,
+// it retries according to the retry options of the node. As cn is consumed by the failed attempt,
+// the connection of the previous nodes is obtained again for each retry.
+func (c *Chain) connectNode(ctx context.Context, cn net.Conn, prev []Node, node Node) (conn net.Conn, err error) {
+	preNode := prev[len(prev)-1]
+	attempts, backoff := nodeRetry(node)
+	for i := 1; i <= attempts; i++ {
+		if i > 1 {
+			if err = waitRetry(ctx, node, i, attempts, backoff, err); err != nil {
+				return
+			}
+			if cn, err = c.connectNodes(ctx, prev); err != nil {
+				return
+			}
+		}
+
+		var cc net.Conn
+		cc, err = preNode.Client.ConnectContext(ctx, cn, "tcp", node.Addr, preNode.ConnectOptions...)
+		if err == nil {
+			conn, err = node.Client.Handshake(cc, node.HandshakeOptions...)
+			if err == nil {
+				return
+			}
+		}
+		cn.Close()
+		if ctx.Err() != nil || isPermanentError(err) {
 			return
 		}
-		node.ResetDead()
+	}
+	return
+}
 
-		cn = cc
-		preNode = node
+// nodeRetry returns the max attempts and the backoff of the node, see WithRetry.
+func nodeRetry(node Node) (int, RetryBackoff) {
+	hopts := &HandshakeOptions{}
+	for _, opt := range node.HandshakeOptions {
+		opt(hopts)
 	}
+	attempts := hopts.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	return attempts, newBackoff(hopts.Backoff)
+}
 
-	conn = cn
-	return
+// waitRetry waits for the backoff before the attempt i of the node, err is the error of the last attempt.
+func waitRetry(ctx context.Context, node Node, i, attempts int, backoff RetryBackoff, err error) error {
+	var d time.Duration
+	if backoff != nil {
+		d = backoff.Next()
+	}
+	if Debug {
+		log.Logf("[chain] %s: attempt %d/%d in %v: %v", node.String(), i, attempts, d, err)
+	}
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *Chain) selectRoute() (route *Chain, err error) {
@@ -334,6 +417,9 @@ func (c *Chain) selectRouteFor(addr string) (route *Chain, err error) {
 	if c.isRoute {
 		return c, nil
 	}
+	if c.Bypass.ShouldBypass(addr) {
+		return c.newRoute(), nil
+	}
 
 	route = c.newRoute()
 	var nl []Node
@@ -372,6 +458,8 @@ type ChainOptions struct {
 	Hosts    *Hosts
 	Resolver Resolver
 	Mark     int
+
+	trace *dialTrace
 }
 
 // ChainOption allows a common way to set chain options.
@@ -404,3 +492,10 @@ func ResolverChainOption(resolver Resolver) ChainOption {
 		opts.Resolver = resolver
 	}
 }
+
+// dialTraceChainOption records the time of the resolving to the trace.
+func dialTraceChainOption(trace *dialTrace) ChainOption {
+	return func(opts *ChainOptions) {
+		opts.trace = trace
+	}
+}
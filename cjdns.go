@@ -0,0 +1,87 @@
+package gost
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("cjdns", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			tun := node.Get("tun")
+			if tun == "" {
+				tun = "tun0"
+			}
+			return CJDNSTransporter(tun), nil
+		},
+	})
+}
+
+// cjdnsNet is the address range of the CJDNS network.
+var cjdnsNet = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(8, 128)}
+
+// IsCJDNSAddress reports whether the ip is a CJDNS address (fc00::/8).
+// It can be used as a routing predicate to send only the CJDNS traffic through the CJDNSTransporter.
+func IsCJDNSAddress(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil && cjdnsNet.Contains(ip)
+}
+
+type cjdnsTransporter struct {
+	tcpTransporter
+	tunDevice string
+}
+
+// CJDNSTransporter creates a Transporter that connects to the CJDNS addresses (fc00::/8)
+// by the TUN device tunDevice of the CJDNS daemon, e.g. tun0.
+// The CJDNS connections are plain IPv6 TCP, the socket is only bound to the TUN device (SO_BINDTODEVICE),
+// so it takes effect on Linux only.
+func CJDNSTransporter(tunDevice string) Transporter {
+	return &cjdnsTransporter{tunDevice: tunDevice}
+}
+
+func (tr *cjdnsTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if !IsCJDNSAddress(net.ParseIP(host)) {
+		return nil, fmt.Errorf("cjdns: %s is not a CJDNS address", host)
+	}
+
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.Chain != nil || tr.tunDevice == "" {
+		return tr.tcpTransporter.Dial(addr, options...)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	d := &net.Dialer{
+		Timeout: timeout,
+		Control: bindToCJDNSDevice(tr.tunDevice),
+	}
+	return d.Dial("tcp6", addr)
+}
+
+// bindToCJDNSDevice returns the net.Dialer control function binding the socket to the CJDNS TUN device.
+func bindToCJDNSDevice(tunDevice string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var serr error
+		if err := c.Control(func(fd uintptr) {
+			if serr = setSocketInterface(int(fd), tunDevice); serr != nil {
+				log.Logf("[cjdns] bind interface %s: %s", tunDevice, serr)
+			}
+		}); err != nil {
+			return err
+		}
+		// fail the dial, otherwise the traffic leaks out of the CJDNS network silently.
+		return serr
+	}
+}
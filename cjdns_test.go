@@ -0,0 +1,37 @@
+package gost
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsCJDNSAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"fc00::1", true},
+		{"fcab:1234:5678::1", true},
+		{"fd00::1", false},
+		{"200::1", false},
+		{"::ffff:252.0.0.1", false},
+		{"127.0.0.1", false},
+	}
+	for _, tc := range tests {
+		if got := IsCJDNSAddress(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("IsCJDNSAddress(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+	if IsCJDNSAddress(nil) {
+		t.Error("nil should not be a CJDNS address")
+	}
+}
+
+func TestCJDNSTransporter(t *testing.T) {
+	tr := CJDNSTransporter("tun0")
+	for _, addr := range []string{"127.0.0.1:8080", "[fd00::1]:8080", "example.com:8080", "[200::1]:8080", "fc00::1"} {
+		if _, err := tr.Dial(addr); err == nil {
+			t.Errorf("%s should not be dialed", addr)
+		}
+	}
+}
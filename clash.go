@@ -0,0 +1,221 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-log/log"
+	"gopkg.in/yaml.v3"
+)
+
+// clashProxy is an entry of the proxies of the Clash config, only the fields used by gost are decoded.
+type clashProxy struct {
+	Name           string            `yaml:"name"`
+	Type           string            `yaml:"type"`
+	Server         string            `yaml:"server"`
+	Port           int               `yaml:"port"`
+	Username       string            `yaml:"username"`
+	Password       string            `yaml:"password"`
+	Cipher         string            `yaml:"cipher"`
+	UUID           string            `yaml:"uuid"`
+	AlterID        int               `yaml:"alterId"`
+	TLS            bool              `yaml:"tls"`
+	SNI            string            `yaml:"sni"`
+	ServerName     string            `yaml:"servername"`
+	SkipCertVerify bool              `yaml:"skip-cert-verify"`
+	Network        string            `yaml:"network"`
+	Plugin         string            `yaml:"plugin"`
+	PluginOpts     map[string]string `yaml:"plugin-opts"`
+	WSOpts         struct {
+		Path    string            `yaml:"path"`
+		Headers map[string]string `yaml:"headers"`
+	} `yaml:"ws-opts"`
+	GRPCOpts struct {
+		ServiceName string `yaml:"grpc-service-name"`
+	} `yaml:"grpc-opts"`
+	Up           string `yaml:"up"`
+	Down         string `yaml:"down"`
+	Obfs         string `yaml:"obfs"`
+	ObfsPassword string `yaml:"obfs-password"`
+}
+
+// ImportClashConfig reads the proxies of the Clash YAML config file and converts them to the nodes.
+// The ss, http, socks5, trojan, vmess and hysteria2 proxies are supported, the others are skipped with a warning.
+// The name of the proxy is set to the Values as name.
+//
+// The ss, http, socks5 and hysteria2 nodes are ready for use. The trojan and vmess nodes keep
+// the parameters of the proxies in the Values, they are usable only by a Connector of the protocol.
+func ImportClashConfig(path string) ([]*Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Proxies []clashProxy `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("clash %s: %w", path, err)
+	}
+
+	var nodes []*Node
+	for i := range cfg.Proxies {
+		p := &cfg.Proxies[i]
+		node, err := p.node()
+		if err != nil {
+			log.Logf("[clash] proxy %q: %s, skipped", p.Name, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (p *clashProxy) node() (*Node, error) {
+	if p.Server == "" || p.Port <= 0 || p.Port > 65535 {
+		return nil, errors.New("invalid server or port")
+	}
+
+	var node *Node
+	switch p.Type {
+	case "ss":
+		if p.Cipher == "" || p.Password == "" {
+			return nil, errors.New("missing cipher or password")
+		}
+		node = importNode("ss", "tcp", p.Server, p.Port, url.UserPassword(p.Cipher, p.Password))
+		if p.Plugin != "" {
+			node.Values.Set("plugin", clashPluginString(p.Plugin, p.PluginOpts))
+		}
+	case "http", "socks5":
+		transport := "tcp"
+		if p.TLS {
+			transport = "tls"
+		}
+		var user *url.Userinfo
+		if p.Username != "" || p.Password != "" {
+			user = url.UserPassword(p.Username, p.Password)
+		}
+		node = importNode(p.Type, transport, p.Server, p.Port, user)
+	case "trojan":
+		if p.Password == "" {
+			return nil, errors.New("missing password")
+		}
+		transport := "tls"
+		if p.Network == "ws" {
+			transport = "wss"
+		}
+		node = importNode("trojan", transport, p.Server, p.Port, url.User(p.Password))
+	case "vmess":
+		if p.UUID == "" {
+			return nil, errors.New("missing uuid")
+		}
+		transport := p.Network
+		switch transport {
+		case "", "tcp":
+			transport = "tcp"
+			if p.TLS {
+				transport = "tls"
+			}
+		case "ws":
+			if p.TLS {
+				transport = "wss"
+			}
+		case "h2":
+			transport = "http2"
+		case "grpc":
+		default:
+			return nil, fmt.Errorf("unsupported network %s", p.Network)
+		}
+		node = importNode("vmess", transport, p.Server, p.Port, url.User(p.UUID))
+		if transport == "grpc" && p.TLS {
+			node.Values.Set("tls", "true")
+		}
+		node.Values.Set("alterId", strconv.Itoa(p.AlterID))
+		if p.Cipher != "" {
+			node.Values.Set("cipher", p.Cipher)
+		}
+	case "hysteria2":
+		if p.Password == "" {
+			return nil, errors.New("missing password")
+		}
+		node = importNode("hysteria2", "hysteria2", p.Server, p.Port, url.User(p.Password))
+		for k, v := range map[string]string{"up": p.Up, "down": p.Down, "obfs": p.Obfs, "obfs-password": p.ObfsPassword} {
+			if v != "" {
+				node.Values.Set(k, v)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", p.Type)
+	}
+
+	if p.Name != "" {
+		node.Values.Set("name", p.Name)
+	}
+	sni := p.SNI
+	if sni == "" {
+		sni = p.ServerName
+	}
+	if sni != "" {
+		node.Values.Set("serverName", sni)
+	}
+	tls := p.TLS || isTLSTransport(node.Transport)
+	if tls && !p.SkipCertVerify {
+		node.Values.Set("secure", "true")
+	}
+	if p.WSOpts.Path != "" {
+		node.Values.Set("path", p.WSOpts.Path)
+	}
+	if host := p.WSOpts.Headers["Host"]; host != "" {
+		node.Values.Set("host", host)
+	}
+	if p.GRPCOpts.ServiceName != "" {
+		node.Values.Set("serviceName", p.GRPCOpts.ServiceName)
+	}
+	return node, nil
+}
+
+// clashPluginString converts the plugin and plugin-opts of Clash to the plugin of SIP002,
+// e.g. obfs with mode http is obfs-local;obfs=http.
+func clashPluginString(plugin string, opts map[string]string) string {
+	var ss []string
+	switch plugin {
+	case "obfs":
+		ss = append(ss, "obfs-local")
+		if mode := opts["mode"]; mode != "" {
+			ss = append(ss, "obfs="+mode)
+		}
+		if host := opts["host"]; host != "" {
+			ss = append(ss, "obfs-host="+host)
+		}
+	default:
+		ss = append(ss, plugin)
+		var keys []string
+		for k := range opts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ss = append(ss, k+"="+opts[k])
+		}
+	}
+	return strings.Join(ss, ";")
+}
+
+// importNode creates the node of the imported proxy, the protocol is kept as is.
+func importNode(protocol, transport, host string, port int, user *url.Userinfo) *Node {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return &Node{
+		Addr:      addr,
+		Host:      addr,
+		Protocol:  protocol,
+		Transport: transport,
+		User:      user,
+		Values:    url.Values{},
+		marker:    &failMarker{},
+	}
+}
@@ -0,0 +1,123 @@
+package gost
+
+import (
+	"testing"
+)
+
+const clashTestConfig = `
+port: 7890
+mode: rule
+proxies:
+  - name: ss1
+    type: ss
+    server: 192.0.2.1
+    port: 8388
+    cipher: aes-256-gcm
+    password: secret
+    plugin: obfs
+    plugin-opts:
+      mode: http
+      host: bing.com
+  - name: http1
+    type: http
+    server: proxy.example.com
+    port: 443
+    username: user
+    password: pass
+    tls: true
+    skip-cert-verify: true
+  - name: socks1
+    type: socks5
+    server: 2001:db8::1
+    port: 1080
+  - name: trojan1
+    type: trojan
+    server: trojan.example.com
+    port: 443
+    password: secret
+    sni: example.com
+    servername: other.example.com
+    network: ws
+    ws-opts:
+      path: /ws
+      headers:
+        Host: cdn.example.com
+  - name: vmess1
+    type: vmess
+    server: vmess.example.com
+    port: 443
+    uuid: b831381d-6324-4d53-ad4f-8cda48b30811
+    alterId: 0
+    cipher: auto
+    tls: true
+    servername: vmess.example.org
+    network: grpc
+    grpc-opts:
+      grpc-service-name: example
+  - name: hy2
+    type: hysteria2
+    server: hy2.example.com
+    port: 8443
+    password: secret
+    up: 30 Mbps
+    down: 200 Mbps
+  - name: ssr1
+    type: ssr
+    server: 192.0.2.2
+    port: 8388
+  - name: bad
+    type: ss
+    server: 192.0.2.3
+    port: 0
+    cipher: aes-256-gcm
+    password: secret
+`
+
+func TestImportClashConfig(t *testing.T) {
+	nodes, err := ImportClashConfig(writeConfigFile(t, "clash.yaml", clashTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, protocol, transport, addr, user string
+		values                                map[string]string
+	}{
+		{"ss1", "ss", "tcp", "192.0.2.1:8388", "aes-256-gcm:secret",
+			map[string]string{"plugin": "obfs-local;obfs=http;obfs-host=bing.com"}},
+		{"http1", "http", "tls", "proxy.example.com:443", "user:pass",
+			map[string]string{"secure": ""}},
+		{"socks1", "socks5", "tcp", "[2001:db8::1]:1080", "", nil},
+		{"trojan1", "trojan", "wss", "trojan.example.com:443", "secret",
+			map[string]string{"serverName": "example.com", "path": "/ws", "host": "cdn.example.com", "secure": "true"}},
+		{"vmess1", "vmess", "grpc", "vmess.example.com:443", "b831381d-6324-4d53-ad4f-8cda48b30811",
+			map[string]string{"alterId": "0", "cipher": "auto", "tls": "true", "serverName": "vmess.example.org", "serviceName": "example", "secure": "true"}},
+		{"hy2", "hysteria2", "hysteria2", "hy2.example.com:8443", "secret",
+			map[string]string{"up": "30 Mbps", "down": "200 Mbps"}},
+	}
+	if len(nodes) != len(tests) {
+		t.Fatalf("got %d nodes, want %d", len(nodes), len(tests))
+	}
+	for i, tc := range tests {
+		node := nodes[i]
+		var user string
+		if node.User != nil {
+			user = node.User.String()
+		}
+		if node.Values.Get("name") != tc.name || node.Protocol != tc.protocol || node.Transport != tc.transport ||
+			node.Addr != tc.addr || user != tc.user {
+			t.Errorf("#%d got %s %s+%s://%s@%s", i, node.Values.Get("name"), node.Protocol, node.Transport, user, node.Addr)
+		}
+		for k, v := range tc.values {
+			if got := node.Values.Get(k); got != v {
+				t.Errorf("#%d %s got %q, want %q", i, k, got, v)
+			}
+		}
+	}
+}
+
+func TestImportClashConfigError(t *testing.T) {
+	if _, err := ImportClashConfig(writeConfigFile(t, "bad.yaml", "proxies: [")); err == nil {
+		t.Error("should failed")
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/go-gost/gosocks5"
+	"tailscale.com/types/key"
 )
 
 // Client is a proxy client.
@@ -79,11 +81,26 @@ type Transporter interface {
 	Multiplex() bool
 }
 
+// TransporterOptions describes the options for creating a Transporter.
+type TransporterOptions struct {
+	proxyAuth    httpProxyAuth
+	turnTCP      bool
+	sessionCache tls.ClientSessionCache
+
+	adaptiveStateFile string
+}
+
+// TransporterOption allows a common way to set TransporterOptions.
+type TransporterOption func(opts *TransporterOptions)
+
 // DialOptions describes the options for Transporter.Dial.
 type DialOptions struct {
-	Timeout time.Duration
-	Chain   *Chain
-	Host    string
+	Timeout   time.Duration
+	Chain     *Chain
+	Host      string
+	SourceIP  net.IP
+	FWMark    uint32
+	Interface string
 }
 
 // DialOption allows a common way to set DialOptions.
@@ -110,19 +127,68 @@ func HostDialOption(host string) DialOption {
 	}
 }
 
+// WithDialSourceIP specifies the local source IP used by Transporter.Dial,
+// it is useful for multi-homed hosts. The OS default is used if ip is nil.
+// It is only honoured by TCPTransporter, the other transporters ignore it.
+func WithDialSourceIP(ip net.IP) DialOption {
+	return func(opts *DialOptions) {
+		opts.SourceIP = ip
+	}
+}
+
+// WithFWMark specifies the firewall mark (SO_MARK) set on the socket used by Transporter.Dial.
+// It only takes effect on Linux, and requires CAP_NET_ADMIN, the dial fails if the mark can not be set.
+// It is only honoured by TCPTransporter, the other transporters ignore it.
+//
+// The mark can be used for policy-based routing, e.g. to route the marked traffic
+// through a dedicated routing table 100:
+//
+//	ip rule add fwmark 1 table 100
+//	ip route add default via 192.168.1.1 dev eth1 table 100
+func WithFWMark(mark uint32) DialOption {
+	return func(opts *DialOptions) {
+		opts.FWMark = mark
+	}
+}
+
+// WithDialInterface specifies the network interface (SO_BINDTODEVICE) the socket used by Transporter.Dial is bound to.
+// It only takes effect on Linux, and it is only honoured by TCPTransporter.
+func WithDialInterface(ifName string) DialOption {
+	return func(opts *DialOptions) {
+		opts.Interface = ifName
+	}
+}
+
 // HandshakeOptions describes the options for handshake.
 type HandshakeOptions struct {
-	Addr       string
-	Host       string
-	User       *url.Userinfo
-	Timeout    time.Duration
-	Interval   time.Duration
-	Retry      int
-	TLSConfig  *tls.Config
-	WSOptions  *WSOptions
-	KCPConfig  *KCPConfig
-	QUICConfig *QUICConfig
-	SSHConfig  *SSHConfig
+	Addr        string
+	Host        string
+	User        *url.Userinfo
+	Timeout     time.Duration
+	Interval    time.Duration
+	Retry       int // the retries of the SSH ping
+	TLSConfig   *tls.Config
+	WSOptions   *WSOptions
+	KCPConfig   *KCPConfig
+	QUICConfig  *QUICConfig
+	SSHConfig   *SSHConfig
+	MaxAttempts int // the max attempts of dialing the node, see WithRetry
+	Backoff     RetryBackoff
+
+	// ConnectHeader is the extra header of the HTTP CONNECT request sent by HTTPProxyTransporter.
+	ConnectHeader http.Header
+
+	// ECHConfigList is the ECH config list used by TLSTransporter, see WithECH.
+	ECHConfigList []byte
+
+	// EarlyData is the data sent in the handshake, see WithTLS0RTT.
+	EarlyData []byte
+
+	// DERPPeer is the public key of the peer of the connection of DERPTransporter, see WithDERPPeer.
+	DERPPeer *key.NodePublic
+
+	// XTLSFlow is the XTLS flow of TLSTransporter, see WithXTLSFlow.
+	XTLSFlow string
 }
 
 // HandshakeOption allows a common way to set HandshakeOptions.
@@ -163,7 +229,8 @@ func IntervalHandshakeOption(interval time.Duration) HandshakeOption {
 	}
 }
 
-// RetryHandshakeOption specifies the times of retry used by Transporter.Handshake
+// RetryHandshakeOption specifies the times of retry used by Transporter.Handshake,
+// it is the retries of the SSH ping, see WithRetry for retrying the dial of a node.
 func RetryHandshakeOption(retry int) HandshakeOption {
 	return func(opts *HandshakeOptions) {
 		opts.Retry = retry
@@ -0,0 +1,87 @@
+// Command bench compares the performance of the transports on the local machine.
+//
+//	bench -transport tcp,tls,ws,kcp,quic -c 8 -n 1000 -size 4096
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ginuerzh/gost"
+)
+
+func main() {
+	var (
+		transports string
+		opts       gost.BenchmarkOptions
+	)
+	flag.StringVar(&transports, "transport", "tcp,tls,ws,wss,kcp,quic", "comma-separated list of the transports")
+	flag.IntVar(&opts.Concurrency, "c", 8, "number of the concurrent connections")
+	flag.IntVar(&opts.Messages, "n", 1000, "number of the messages of each connection")
+	flag.IntVar(&opts.MessageSize, "size", 4096, "size of the messages")
+	flag.Parse()
+
+	cert, err := gost.GenCertificate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{cert}}
+	opts.HandshakeOptions = []gost.HandshakeOption{
+		gost.TLSConfigHandshakeOption(&tls.Config{InsecureSkipVerify: true}),
+	}
+
+	failed := false
+	for _, name := range strings.Split(transports, ",") {
+		ln, tr, err := transport(strings.TrimSpace(name), serverTLS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		r, err := gost.BenchmarkTransport(context.Background(), tr, ln, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%-5s %v\n", name, r)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func transport(name string, tlsConfig *tls.Config) (gost.Listener, gost.Transporter, error) {
+	const addr = "127.0.0.1:0"
+	var ln gost.Listener
+	var err error
+	var tr gost.Transporter
+	switch name {
+	case "tcp":
+		ln, err = gost.TCPListener(addr)
+		tr = gost.TCPTransporter()
+	case "tls":
+		ln, err = gost.TLSListener(addr, tlsConfig)
+		tr = gost.TLSTransporter()
+	case "ws":
+		ln, err = gost.WSListener(addr, nil)
+		tr = gost.WSTransporter(nil)
+	case "wss":
+		ln, err = gost.WSSListener(addr, tlsConfig, nil)
+		tr = gost.WSSTransporter(nil)
+	case "kcp":
+		ln, err = gost.KCPListener(addr, nil)
+		tr = gost.KCPTransporter(nil)
+	case "quic":
+		ln, err = gost.QUICListener(addr, &gost.QUICConfig{TLSConfig: tlsConfig})
+		tr = gost.QUICTransporter(nil)
+	default:
+		return nil, nil, fmt.Errorf("unknown transport")
+	}
+	return ln, tr, err
+}
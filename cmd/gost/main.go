@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	_ "net/http/pprof"
 
@@ -17,11 +18,20 @@ import (
 
 var (
 	configureFile string
+	logFile       string
 	baseCfg       = &baseConfig{}
+	flagCfg       *baseConfig      // the config of the flags, the config file is parsed over it
+	server        = &gost.Server{} // the servers of the routes, see gost.Server.Reload
 	pprofAddr     string
 	pprofEnabled  = os.Getenv("PROFILING") != ""
+	pingTarget    string
+	pingCount     int
+	traceChain    bool
 )
 
+// shutdownTimeout is the max time waiting for the connections to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
 func init() {
 	gost.SetLogger(&gost.LogLogger{})
 
@@ -33,9 +43,13 @@ func init() {
 	flag.Var(&baseCfg.route.ServeNodes, "L", "listen address, can listen on multiple ports (required)")
 	flag.IntVar(&baseCfg.route.Mark, "M", 0, "Specify out connection mark")
 	flag.StringVar(&configureFile, "C", "", "configure file")
+	flag.StringVar(&logFile, "O", "", "log file, reopened on SIGUSR1 (also the SNMP log signal of kcp)")
 	flag.StringVar(&baseCfg.route.Interface, "I", "", "Interface to bind")
 	flag.BoolVar(&baseCfg.Debug, "D", false, "enable debug log")
 	flag.BoolVar(&printVersion, "V", false, "print version")
+	flag.StringVar(&pingTarget, "ping", "", "ping the HTTP server through the forward chain and exit")
+	flag.IntVar(&pingCount, "ping-count", 4, "number of the pings")
+	flag.BoolVar(&traceChain, "trace", false, "trace the hops of the forward chain and exit")
 	if pprofEnabled {
 		flag.StringVar(&pprofAddr, "P", ":6060", "profiling HTTP server address")
 	}
@@ -47,12 +61,14 @@ func init() {
 		os.Exit(0)
 	}
 
+	flagCfg = baseCfg.clone()
 	if configureFile != "" {
-		_, err := parseBaseConfig(configureFile)
+		cfg, err := parseBaseConfig(configureFile, flagCfg)
 		if err != nil {
 			log.Log(err)
 			os.Exit(1)
 		}
+		baseCfg = cfg
 	}
 	if flag.NFlag() == 0 {
 		flag.PrintDefaults()
@@ -61,6 +77,13 @@ func init() {
 }
 
 func main() {
+	if logFile != "" {
+		if err := gost.SetLogFile(logFile); err != nil {
+			log.Log(err)
+			os.Exit(1)
+		}
+	}
+
 	if pprofEnabled {
 		go func() {
 			log.Log("profiling server on", pprofAddr)
@@ -69,55 +92,118 @@ func main() {
 	}
 
 	// NOTE: as of 2.6, you can use custom cert/key files to initialize the default certificate.
-	tlsConfig, err := tlsConfig(defaultCertFile, defaultKeyFile, "")
+	cert, err := tls.LoadX509KeyPair(defaultCertFile, defaultKeyFile)
 	if err != nil {
 		// generate random self-signed certificate.
-		cert, err := gost.GenCertificate()
+		cert, err = gost.GenCertificate()
 		if err != nil {
 			log.Log(err)
 			os.Exit(1)
 		}
-		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
 	} else {
 		log.Log("load TLS certificate files OK")
 	}
 
-	gost.DefaultTLSConfig = tlsConfig
+	gost.DefaultTLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if pingTarget != "" {
+		os.Exit(ping())
+	}
+	if traceChain {
+		os.Exit(trace())
+	}
 
 	if err := start(); err != nil {
 		log.Log(err)
 		os.Exit(1)
 	}
 
+	signals, actions := gost.DefaultSignalActions(reload, shutdown)
+	if _, err := gost.SignalHandler(signals, actions); err != nil {
+		log.Log(err)
+	}
+
 	select {}
 }
 
-func start() error {
-	gost.Debug = baseCfg.Debug
-
-	var routers []router
-	rts, err := baseCfg.route.GenRouters()
+// ping pings the target through the chain of the -F nodes, and returns the exit code.
+func ping() int {
+	chain, err := baseCfg.route.parseChain()
 	if err != nil {
-		return err
+		log.Log(err)
+		return 1
 	}
-	routers = append(routers, rts...)
+	r, err := gost.PingChain(context.Background(), *chain, pingTarget, gost.PingCountOption(pingCount))
+	if err != nil {
+		log.Log(err)
+		return 1
+	}
+	fmt.Fprintf(os.Stdout, "PING %s: %v\n", pingTarget, r)
+	if !r.Connected {
+		return 1
+	}
+	return 0
+}
 
-	for _, route := range baseCfg.Routes {
-		rts, err := route.GenRouters()
-		if err != nil {
-			return err
+// trace traces the hops of the chain of the -F nodes, and returns the exit code.
+func trace() int {
+	chain, err := baseCfg.route.parseChain()
+	if err != nil {
+		log.Log(err)
+		return 1
+	}
+	hops, err := gost.TraceChain(context.Background(), *chain)
+	if err != nil {
+		log.Log(err)
+		return 1
+	}
+	gost.PrintHops(os.Stdout, hops)
+	for _, hop := range hops {
+		if hop.Error != nil {
+			return 1
 		}
-		routers = append(routers, rts...)
 	}
+	return 0
+}
 
-	if len(routers) == 0 {
-		return errors.New("invalid config")
+// reload applies the config file to the running servers, the connections are not dropped.
+func reload() error {
+	if configureFile == "" {
+		return nil
+	}
+	// the config is replaced only if the servers are reloaded.
+	newCfg, err := parseBaseConfig(configureFile, flagCfg)
+	if err != nil {
+		return err
 	}
-	for i := range routers {
-		go routers[i].Serve()
+	cfg, err := newCfg.config()
+	if err != nil {
+		return err
 	}
+	if err := server.Reload(cfg); err != nil {
+		return err
+	}
+	baseCfg = newCfg
+	gost.Debug = cfg.Debug
+	return nil
+}
 
+// shutdown waits for the connections to finish and exits.
+func shutdown() error {
+	if err := gost.GracefulShutdown(shutdownTimeout, server); err != nil {
+		log.Log("shutdown:", err)
+	}
+	os.Exit(0)
 	return nil
 }
+
+func start() error {
+	cfg, err := baseCfg.config()
+	if err != nil {
+		return err
+	}
+	gost.Debug = cfg.Debug
+	return server.Reload(cfg)
+}
@@ -0,0 +1,683 @@
+package gost
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the servers, each serve node runs a server,
+// and the chain nodes are the proxy chain of all the servers.
+type Config struct {
+	ServeNodes []NodeConfig `json:"serveNodes"`
+	ChainNodes []NodeConfig `json:"chainNodes,omitempty"`
+	Retries    int          `json:"retries,omitempty"`   // the retries of the chain
+	Mark       int          `json:"mark,omitempty"`      // the fwmark of the outgoing connections
+	Interface  string       `json:"interface,omitempty"` // the interface of the outgoing connections
+	Bypass     string       `json:"bypass,omitempty"`    // the bypass of the chain, see ParseBypass
+	// Routes are the other groups of the serve nodes with their own chains,
+	// the Debug and Routes of them are ignored.
+	Routes []Config `json:"routes,omitempty"`
+	Debug  bool     `json:"debug,omitempty"`
+}
+
+// NodeConfig is the configuration of a node, the options are the same as the query parameters of the node URL.
+type NodeConfig struct {
+	Protocol  string            `json:"protocol,omitempty"`
+	Transport string            `json:"transport,omitempty"`
+	Addr      string            `json:"addr"`
+	Remote    string            `json:"remote,omitempty"` // the target address of the forward and relay servers
+	Username  string            `json:"username,omitempty"`
+	Password  string            `json:"password,omitempty"`
+	Options   map[string]string `json:"options,omitempty"`
+}
+
+// ConfigSchema is the JSON Schema of the configuration file, the file is validated against it by LoadConfig.
+// The protocol and the transport of the nodes are also validated against the schemes of DefaultRegistry.
+const ConfigSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["serveNodes"],
+	"additionalProperties": false,
+	"properties": {
+		"serveNodes": {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/serveNode"}},
+		"chainNodes": {"type": "array", "items": {"$ref": "#/definitions/chainNode"}},
+		"retries": {"type": "integer"},
+		"mark": {"type": "integer"},
+		"interface": {"type": "string"},
+		"bypass": {"type": "string"},
+		"routes": {"type": "array", "items": {"$ref": "#/definitions/route"}},
+		"debug": {"type": "boolean"}
+	},
+	"definitions": {
+		"route": {
+			"type": "object",
+			"required": ["serveNodes"],
+			"additionalProperties": false,
+			"properties": {
+				"serveNodes": {"type": "array", "minItems": 1, "items": {"$ref": "#/definitions/serveNode"}},
+				"chainNodes": {"type": "array", "items": {"$ref": "#/definitions/chainNode"}},
+				"retries": {"type": "integer"},
+				"mark": {"type": "integer"},
+				"interface": {"type": "string"},
+				"bypass": {"type": "string"}
+			}
+		},
+		"serveNode": {
+			"type": "object",
+			"required": ["addr"],
+			"additionalProperties": false,
+			"properties": {
+				"protocol": {"type": "string"},
+				"transport": {"type": "string"},
+				"addr": {"type": "string"},
+				"remote": {"type": "string"},
+				"username": {"type": "string"},
+				"password": {"type": "string"},
+				"options": {"type": "object", "additionalProperties": {"type": ["string", "number", "boolean"]}}
+			}
+		},
+		"chainNode": {
+			"type": "object",
+			"required": ["addr"],
+			"additionalProperties": false,
+			"properties": {
+				"protocol": {"type": "string"},
+				"transport": {"type": "string"},
+				"addr": {"type": "string"},
+				"username": {"type": "string"},
+				"password": {"type": "string"},
+				"options": {"type": "object", "additionalProperties": {"type": ["string", "number", "boolean"]}}
+			}
+		}
+	}
+}`
+
+// LoadConfig loads the configuration from the YAML (.yaml, .yml) or JSON file,
+// the file is validated against ConfigSchema.
+//
+// The ${ENV_VAR} and ${ENV_VAR:-default} patterns in the string values are replaced with the
+// environment variables before the validation, the default is used if the variable is unset or empty.
+// The patterns can be nested, e.g. ${USER_${ENV}} or ${PASSWORD:-${DEFAULT_PASSWORD}}.
+// A ConfigError is returned if any variable without default is unset.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ConfigError is the error of the unresolved environment variables in the configuration.
+type ConfigError struct {
+	Unresolved []string
+}
+
+func (e *ConfigError) Error() string {
+	return "unresolved environment variables: " + strings.Join(e.Unresolved, ", ")
+}
+
+// interpolateEnv replaces the environment variables in the string values of v,
+// the names of the unset variables without default are appended to unresolved.
+func interpolateEnv(v interface{}, unresolved *[]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expandEnv(v, unresolved)
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = interpolateEnv(v[k], unresolved)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = interpolateEnv(v[i], unresolved)
+		}
+	}
+	return v
+}
+
+func expandEnv(s string, unresolved *[]string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+
+		// find the matching brace and the default separator at the same level.
+		depth, end, sep := 0, -1, -1
+		for j := i + 2; j < len(s) && end < 0; j++ {
+			switch {
+			case strings.HasPrefix(s[j:], "${"):
+				depth++
+				j++
+			case s[j] == '}':
+				if depth == 0 {
+					end = j
+				}
+				depth--
+			case depth == 0 && sep < 0 && strings.HasPrefix(s[j:], ":-"):
+				sep = j
+			}
+		}
+		if end < 0 {
+			// no matching brace, it is not a variable.
+			b.WriteString(s[i:])
+			return b.String()
+		}
+
+		name := s[i+2 : end]
+		if sep >= 0 {
+			name = s[i+2 : sep]
+		}
+		name = expandEnv(name, unresolved)
+		if value, ok := os.LookupEnv(name); ok && (value != "" || sep < 0) {
+			b.WriteString(value)
+		} else if sep >= 0 {
+			b.WriteString(expandEnv(s[sep+2:end], unresolved))
+		} else if !containsString(*unresolved, name) {
+			*unresolved = append(*unresolved, name)
+		}
+		s = s[end+1:]
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func parseConfig(data []byte, ext string) (*Config, error) {
+	var doc interface{}
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var unresolved []string
+	doc = interpolateEnv(doc, &unresolved)
+	if len(unresolved) > 0 {
+		return nil, &ConfigError{Unresolved: unresolved}
+	}
+
+	if err := validateConfigDoc(doc); err != nil {
+		return nil, err
+	}
+
+	// the options are strings, as the query parameters of the node URL.
+	routes := []interface{}{doc}
+	if rs, ok := doc.(map[string]interface{})["routes"].([]interface{}); ok {
+		routes = append(routes, rs...)
+	}
+	for _, route := range routes {
+		for _, key := range []string{"serveNodes", "chainNodes"} {
+			nodes, _ := route.(map[string]interface{})[key].([]interface{})
+			for _, node := range nodes {
+				opts, _ := node.(map[string]interface{})["options"].(map[string]interface{})
+				for k, v := range opts {
+					opts[k] = fmt.Sprint(v)
+				}
+			}
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func validateConfigDoc(doc interface{}) error {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(ConfigSchema), &schema); err != nil {
+		return err
+	}
+	// the schemes are registered by the transports and the protocols.
+	protocols := schemaEnum(append([]string{"", "auto"}, DefaultRegistry.Protocols()...))
+	transports := schemaEnum(append([]string{""}, DefaultRegistry.Transports()...))
+	defs, _ := schema["definitions"].(map[string]interface{})
+	for _, def := range []string{"serveNode", "chainNode"} {
+		props, _ := defs[def].(map[string]interface{})["properties"].(map[string]interface{})
+		props["protocol"] = map[string]interface{}{"enum": protocols}
+		props["transport"] = map[string]interface{}{"enum": transports}
+	}
+	return validateSchema(schema, schema, doc, "")
+}
+
+func schemaEnum(values []string) []interface{} {
+	enum := make([]interface{}, len(values))
+	for i, v := range values {
+		enum[i] = v
+	}
+	return enum
+}
+
+// ParseFlags generates the configuration from the command-line arguments (without the program name),
+// e.g. '-L socks5://:1080 -F http://proxy.example.com:8080'. The -L (listen) flags are the serve nodes,
+// and the -F (forward) flags are the chain nodes in order, both are in the node URL format of ParseNode.
+// The -D flag enables the debug log. The nodes are validated as the configuration file, so every scheme
+// of ParseNode is accepted.
+func ParseFlags(args []string) (*Config, error) {
+	var serveNodes, chainNodes []string
+	fs := flag.NewFlagSet("gost", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Func("L", "listen address, can be repeated", func(s string) error {
+		serveNodes = append(serveNodes, s)
+		return nil
+	})
+	fs.Func("F", "forward address, can be repeated to make a forward chain", func(s string) error {
+		chainNodes = append(chainNodes, s)
+		return nil
+	})
+	debug := fs.Bool("D", false, "enable debug log")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if len(serveNodes) == 0 {
+		return nil, errors.New("no listen address, the -L flag is required")
+	}
+
+	cfg := &Config{Debug: *debug}
+	for _, s := range serveNodes {
+		nc, err := ParseNodeConfig(s)
+		if err != nil {
+			return nil, fmt.Errorf("-L %s: %w", s, err)
+		}
+		cfg.ServeNodes = append(cfg.ServeNodes, nc)
+	}
+	for _, s := range chainNodes {
+		nc, err := ParseNodeConfig(s)
+		if err != nil {
+			return nil, fmt.Errorf("-F %s: %w", s, err)
+		}
+		cfg.ChainNodes = append(cfg.ChainNodes, nc)
+	}
+
+	// the same validation as the configuration file.
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if err := validateConfigDoc(doc); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ParseNodeConfig parses the node URL of ParseNode to the NodeConfig.
+func ParseNodeConfig(s string) (NodeConfig, error) {
+	node, err := ParseNode(s)
+	if err != nil {
+		return NodeConfig{}, err
+	}
+	nc := NodeConfig{
+		Protocol:  node.Protocol,
+		Transport: node.Transport,
+		Addr:      node.Addr,
+		Remote:    node.Remote,
+	}
+	if node.User != nil {
+		nc.Username = node.User.Username()
+		nc.Password, _ = node.User.Password()
+	}
+	for k := range node.Values {
+		if nc.Options == nil {
+			nc.Options = make(map[string]string)
+		}
+		nc.Options[k] = node.Values.Get(k)
+	}
+	return nc, nil
+}
+
+// validateSchema validates the value v against the schema, only the keywords used by ConfigSchema are supported.
+// The root is the schema containing the definitions, path is the location of v in the document.
+func validateSchema(root, schema map[string]interface{}, v interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		defs, _ := root["definitions"].(map[string]interface{})
+		def, ok := defs[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("schema: invalid reference %s", ref)
+		}
+		schema = def
+	}
+	name := path
+	if name == "" {
+		name = "config"
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			if e == v {
+				return nil
+			}
+		}
+		var values []string
+		for _, e := range enum {
+			if s := fmt.Sprint(e); s != "" {
+				values = append(values, s)
+			}
+		}
+		return fmt.Errorf("%s: unknown value %v, expected one of %s", name, v, strings.Join(values, ", "))
+	}
+
+	if t, ok := schema["type"]; ok && !matchSchemaType(t, v) {
+		return fmt.Errorf("%s: expected %v, got %s", name, t, jsonTypeOf(v))
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, key := range schemaStrings(schema["required"]) {
+			if _, ok := v[key]; !ok {
+				return fmt.Errorf("%s: missing required field %q", name, key)
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			p := key
+			if path != "" {
+				p = path + "." + key
+			}
+			if prop, ok := props[key].(map[string]interface{}); ok {
+				if err := validateSchema(root, prop, v[key], p); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s: unknown field %q", name, key)
+				}
+			case map[string]interface{}:
+				if err := validateSchema(root, additional, v[key], p); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if n, ok := schema["minItems"].(float64); ok && len(v) < int(n) {
+			return fmt.Errorf("%s: at least %d item(s) required", name, int(n))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i := range v {
+				if err := validateSchema(root, items, v[i], name+"["+strconv.Itoa(i)+"]"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchSchemaType(t interface{}, v interface{}) bool {
+	for _, s := range schemaStrings(t) {
+		if s == jsonTypeOf(v) || s == "number" && jsonTypeOf(v) == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case int, int64, uint64:
+		return "integer"
+	case float32:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func schemaStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ss []string
+		for _, s := range v {
+			ss = append(ss, fmt.Sprint(s))
+		}
+		return ss
+	}
+	return nil
+}
+
+// Build creates the servers of the serve nodes of the config and the routes, the servers are not started.
+func (c *Config) Build() ([]*Server, error) {
+	var servers []*Server
+	for _, r := range c.routes() {
+		chain, err := r.BuildChain()
+		if err != nil {
+			closeServers(servers)
+			return nil, err
+		}
+		for i := range r.ServeNodes {
+			server, err := r.ServeNodes[i].server(chain)
+			if err != nil {
+				closeServers(servers)
+				return nil, fmt.Errorf("serveNodes[%d]: %w", i, err)
+			}
+			servers = append(servers, server)
+		}
+	}
+	return servers, nil
+}
+
+// routes returns the config itself and the routes.
+func (c *Config) routes() []*Config {
+	routes := []*Config{c}
+	for i := range c.Routes {
+		routes = append(routes, &c.Routes[i])
+	}
+	return routes
+}
+
+func closeServers(servers []*Server) {
+	for _, s := range servers {
+		s.Close()
+	}
+}
+
+// BuildChain creates the chain of the chain nodes, each chain node is a node group of the nodes of BuildChainNodes.
+// The nodes of the group are selected by the strategy, max_fails, fail_timeout and fastest_count options of the node,
+// the backup nodes are discovered by the mdns option, or loaded from the file of the peer option.
+func (c *Config) BuildChain() (*Chain, error) {
+	chain := NewChain()
+	chain.Retries = c.Retries
+	chain.Mark = c.Mark
+	chain.Interface = c.Interface
+	chain.Bypass = ParseBypass(c.Bypass)
+
+	for i := range c.ChainNodes {
+		nodes, err := c.ChainNodes[i].chainNodes()
+		if err != nil {
+			return nil, fmt.Errorf("chainNodes[%d]: %w", i, err)
+		}
+		group, err := chainNodeGroup(nodes)
+		if err != nil {
+			return nil, fmt.Errorf("chainNodes[%d]: %w", i, err)
+		}
+		group.ID = i + 1
+
+		if v := nodes[0].Get("split-tunnel"); v != "" {
+			cidrs, err := ParseCIDRs(v)
+			if err != nil {
+				return nil, fmt.Errorf("chainNodes[%d]: %w", i, err)
+			}
+			chain.SplitTunnel = append(chain.SplitTunnel, cidrs...)
+		}
+		chain.AddNodeGroup(group)
+	}
+	return chain, nil
+}
+
+func chainNodeGroup(nodes []Node) (*NodeGroup, error) {
+	for i := range nodes {
+		nodes[i].ID = i + 1
+	}
+	group := NewNodeGroup(nodes...)
+
+	strategy := NewStrategy(nodes[0].Get("strategy"))
+	mdns := nodes[0].Get("mdns")
+	if mdns != "" {
+		if nodes[0].Get("peer") != "" {
+			return nil, errors.New("mdns and peer can not be used together")
+		}
+		// the discovered nodes are the backups, they are only used when the base nodes fail.
+		strategy = &FIFOStrategy{}
+	}
+	group.SetSelector(nil,
+		WithFilter(
+			&FailFilter{
+				MaxFails:    nodes[0].GetInt("max_fails"),
+				FailTimeout: nodes[0].GetDuration("fail_timeout"),
+			},
+			&InvalidFilter{},
+			NewFastestFilter(0, nodes[0].GetInt("fastest_count")),
+		),
+		WithStrategy(strategy),
+	)
+
+	if mdns != "" {
+		go newMDNSDiscoverer(group, nodes).Run()
+	}
+
+	if cfg := nodes[0].Get("peer"); cfg != "" {
+		f, err := os.Open(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		peerCfg := newPeerConfig()
+		peerCfg.group = group
+		peerCfg.baseNodes = nodes
+		peerCfg.Reload(f)
+		f.Close()
+
+		go PeriodReload(peerCfg, cfg)
+	}
+	return group, nil
+}
+
+func (nc *NodeConfig) node() Node {
+	node := Node{
+		Addr:      nc.Addr,
+		Host:      nc.Addr,
+		Protocol:  nc.Protocol,
+		Transport: nc.Transport,
+		Remote:    nc.Remote,
+		Values:    url.Values{},
+		marker:    &failMarker{},
+	}
+	if node.Protocol == "" {
+		node.Protocol = "auto"
+	}
+	if node.Transport == "" {
+		node.Transport = "tcp"
+	}
+	if nc.Username != "" || nc.Password != "" {
+		node.User = url.UserPassword(nc.Username, nc.Password)
+	}
+	for k, v := range nc.Options {
+		node.Values.Set(k, v)
+	}
+	return node
+}
+
+// serveNode returns the node of the serve node config, the node is built by BuildServer.
+func (nc *NodeConfig) serveNode() (Node, error) {
+	node := nc.node()
+	if node.Addr == "" {
+		return Node{}, errors.New("addr is empty")
+	}
+	if node.Protocol == "tcp" && node.Remote == "" {
+		return Node{}, errors.New("protocol tcp requires the remote address")
+	}
+	return node, nil
+}
+
+func (nc *NodeConfig) server(chain *Chain) (*Server, error) {
+	node, err := nc.serveNode()
+	if err != nil {
+		return nil, err
+	}
+	return BuildServer(node, chain)
+}
+
+// handler creates the handler of the serve node, addr is the address of the listener.
+func (nc *NodeConfig) handler(addr string, chain *Chain) (Handler, error) {
+	node, err := nc.serveNode()
+	if err != nil {
+		return nil, err
+	}
+	node, opts, err := serveNodeOptions(node, chain)
+	if err != nil {
+		return nil, err
+	}
+	return serveNodeHandler(node, opts, addr)
+}
+
+func (nc *NodeConfig) chainNodes() ([]Node, error) {
+	node := nc.node()
+	if node.Addr == "" {
+		return nil, errors.New("addr is empty")
+	}
+	return BuildChainNodes(node)
+}
@@ -0,0 +1,299 @@
+package gost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/go-log/log"
+)
+
+// configServer is a server of the serve node of the config run by Server.Reload.
+type configServer struct {
+	server  *Server
+	handler *swapHandler
+	config  NodeConfig
+	chain   Config // the chain config of the route of the node
+}
+
+// RunConfig starts the servers of the config, the servers are run by the returned Server, see Server.Reload.
+func RunConfig(cfg *Config) (*Server, error) {
+	s := &Server{}
+	if err := s.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Servers returns the running servers of the config.
+func (s *Server) Servers() []*Server {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var servers []*Server
+	for _, cs := range s.servers {
+		servers = append(servers, cs.server)
+	}
+	return servers
+}
+
+// Reload applies the new config to the servers of the config run by the server,
+// the serve nodes are matched by the transport and address:
+//
+// The servers of the removed nodes stop listening, and their connections are drained.
+// The servers of the added nodes are started.
+// The handlers of the changed nodes (or all the nodes of the route if the chain is changed) are replaced,
+// the connections being handled continue to use the old handlers until they close.
+// The servers are restarted if the options of the node other than the handler options (e.g. the certificate
+// or pcap) are changed, or the chain is changed for the listeners using it (e.g. rtcp).
+//
+// The running servers are not changed if the new config is invalid or the new servers can not be started.
+// The servers are closed by Close and Shutdown of the server.
+func (s *Server) Reload(newCfg *Config) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.servers == nil {
+		s.servers = make(map[string]*configServer)
+	}
+
+	type update struct {
+		handler Handler
+		config  NodeConfig
+		chain   Config
+	}
+	type replacement struct {
+		key    string
+		config NodeConfig
+		chain  Config
+		c      *Chain
+	}
+
+	routes := newCfg.routes()
+	chains := make([]*Chain, len(routes))
+	keys := make(map[string]bool)
+	updates := make(map[string]update)      // the new handlers of the running servers
+	added := make(map[string]*configServer) // the new servers
+	var replaced []replacement              // the servers restarted with the new listeners
+	defer func() {
+		// close the new servers if it is failed.
+		for _, cs := range added {
+			cs.server.Close()
+		}
+	}()
+
+	for ri, r := range routes {
+		prefix := ""
+		if ri > 0 {
+			prefix = fmt.Sprintf("routes[%d].", ri-1)
+		}
+		chainCfg := r.chainConfig()
+
+		for i := range r.ServeNodes {
+			nc := r.ServeNodes[i]
+			key := nc.listenerKey()
+			if keys[key] {
+				return fmt.Errorf("%sserveNodes[%d]: duplicate listener %s", prefix, i, key)
+			}
+			keys[key] = true
+
+			old := s.servers[key]
+			if old != nil && reflect.DeepEqual(old.config, nc) && reflect.DeepEqual(old.chain, chainCfg) {
+				continue
+			}
+			if chains[ri] == nil {
+				chain, err := r.BuildChain()
+				if err != nil {
+					return fmt.Errorf("%s%w", prefix, err)
+				}
+				chains[ri] = chain
+			}
+
+			switch {
+			case old != nil && nc.listenerEqual(&old.config) &&
+				(!nc.listenerChain() || reflect.DeepEqual(old.chain, chainCfg)):
+				h, err := nc.handler(old.server.Addr().String(), chains[ri])
+				if err != nil {
+					return fmt.Errorf("%sserveNodes[%d]: %w", prefix, i, err)
+				}
+				updates[key] = update{handler: h, config: nc, chain: chainCfg}
+			case old != nil:
+				// the address is in use by the old server, the node is validated now, and listened after it is closed.
+				if _, err := serverTLSConfig(nc.node()); err != nil {
+					return fmt.Errorf("%sserveNodes[%d]: %w", prefix, i, err)
+				}
+				replaced = append(replaced, replacement{key: key, config: nc, chain: chainCfg, c: chains[ri]})
+			default:
+				cs, err := nc.configServer(chains[ri], chainCfg)
+				if err != nil {
+					return fmt.Errorf("%sserveNodes[%d]: %w", prefix, i, err)
+				}
+				added[key] = cs
+			}
+		}
+	}
+
+	for key, u := range updates {
+		cs := s.servers[key]
+		cs.handler.set(u.handler)
+		cs.config, cs.chain = u.config, u.chain
+		log.Logf("[reload] %s: handler updated", key)
+	}
+	for key, cs := range s.servers {
+		if !keys[key] {
+			drainServer(key, cs)
+			delete(s.servers, key)
+		}
+	}
+
+	var errs []error
+	for _, r := range replaced {
+		old := s.servers[r.key]
+		// the address is released before the new listener is created.
+		old.server.Close()
+		cs, err := r.config.configServer(r.c, r.chain)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.key, err))
+			// the old node is listened again with the old handler, the connections of the old server are kept.
+			if cs, err = old.relisten(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", r.key, err))
+				drainServer(r.key, old)
+				delete(s.servers, r.key)
+				continue
+			}
+		}
+		drainServer(r.key, old)
+		delete(s.servers, r.key)
+		added[r.key] = cs
+	}
+	for key, cs := range added {
+		s.servers[key] = cs
+		go cs.server.Run()
+		log.Logf("[reload] %s: started on %s", key, cs.server.Addr())
+	}
+	added = nil
+
+	return errors.Join(errs...)
+}
+
+// drainServer stops the server listening, and waits for its connections to finish in background.
+func drainServer(key string, cs *configServer) {
+	log.Logf("[reload] %s: stopped", key)
+	go func() {
+		cs.server.Shutdown(context.Background())
+		if Debug {
+			log.Logf("[reload] %s: drained", key)
+		}
+	}()
+}
+
+// resetServers removes all the servers of the config and returns them.
+func (s *Server) resetServers() []*Server {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var servers []*Server
+	for _, cs := range s.servers {
+		servers = append(servers, cs.server)
+	}
+	s.servers = nil
+	return servers
+}
+
+// chainConfig returns the config of the chain of the route.
+func (c *Config) chainConfig() Config {
+	return Config{
+		ChainNodes: c.ChainNodes,
+		Retries:    c.Retries,
+		Mark:       c.Mark,
+		Interface:  c.Interface,
+		Bypass:     c.Bypass,
+	}
+}
+
+func (nc *NodeConfig) configServer(chain *Chain, chainCfg Config) (*configServer, error) {
+	s, err := nc.server(chain)
+	if err != nil {
+		return nil, err
+	}
+	h := &swapHandler{}
+	h.set(s.Handler)
+	s.Handler = h
+	return &configServer{server: s, handler: h, config: *nc, chain: chainCfg}, nil
+}
+
+// relisten creates a new server of the node with the handler of the server.
+func (cs *configServer) relisten() (*configServer, error) {
+	s, err := cs.config.server(nil)
+	if err != nil {
+		return nil, err
+	}
+	s.Handler = cs.handler
+	return &configServer{server: s, handler: cs.handler, config: cs.config, chain: cs.chain}, nil
+}
+
+// listenerKey identifies the listener of the serve node.
+func (nc *NodeConfig) listenerKey() string {
+	node := nc.node()
+	return node.Transport + "://" + node.Addr
+}
+
+// handlerOptions are the options only used by the handlers,
+// the other options may be used by the listeners (e.g. c of kcp) or their wrappers (e.g. pcap).
+var handlerOptions = map[string]bool{
+	"whitelist": true, "blacklist": true, "bypass": true, "hosts": true, "ip": true, "prefer": true,
+	"strategy": true, "max_fails": true, "fail_timeout": true, "retry": true,
+	"probe_resist": true, "knock": true, "proxyAgent": true, "httpTunnel": true,
+	"healthcheck": true, "healthcheck_upstream": true, "sticky_cookie": true,
+}
+
+// listenerEqual reports whether the listeners of the nodes are the same,
+// the nodes differ only in the handler options and the remote address.
+// The users are compared as they are also used by the listeners, e.g. ssh.
+func (nc *NodeConfig) listenerEqual(other *NodeConfig) bool {
+	if nc.listenerKey() != other.listenerKey() ||
+		nc.Username != other.Username || nc.Password != other.Password {
+		return false
+	}
+	for k, v := range nc.Options {
+		if !handlerOptions[k] && other.Options[k] != v {
+			return false
+		}
+	}
+	for k, v := range other.Options {
+		if !handlerOptions[k] && nc.Options[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// listenerChain reports whether the listener of the node uses the chain.
+func (nc *NodeConfig) listenerChain() bool {
+	_, t, _ := DefaultRegistry.LookupTransport(nc.node().Transport)
+	return t.Chain
+}
+
+// swapHandler passes the connections to the current handler. The handler is replaced as a whole (copy-on-write),
+// so a connection sees the same handler during its lifetime.
+type swapHandler struct {
+	v atomic.Value // swapHandlerValue
+}
+
+type swapHandlerValue struct {
+	Handler
+}
+
+func (h *swapHandler) set(handler Handler) {
+	h.v.Store(swapHandlerValue{handler})
+}
+
+// Init does nothing, the handlers are initialized when they are created.
+func (h *swapHandler) Init(options ...HandlerOption) {
+}
+
+func (h *swapHandler) Handle(conn net.Conn) {
+	h.v.Load().(swapHandlerValue).Handle(conn)
+}
@@ -0,0 +1,196 @@
+package gost
+
+import (
+	"crypto/rand"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func configServerOf(s *Server, key string) *configServer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.servers[key]
+}
+
+func TestServerReload(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	cfg := &Config{
+		ServeNodes: []NodeConfig{
+			{Protocol: "http", Addr: "127.0.0.1:0"},
+			{Protocol: "socks5", Addr: "127.0.0.2:0"},
+		},
+	}
+	srv, err := RunConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	httpServer := configServerOf(srv, "tcp://127.0.0.1:0")
+	socksServer := configServerOf(srv, "tcp://127.0.0.2:0")
+	if httpServer == nil || socksServer == nil {
+		t.Fatal("servers are not started")
+	}
+	oldHandler := httpServer.handler.v.Load()
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: TCPTransporter(),
+	}
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	// the connection through the removed server, it is kept after reload.
+	conn, err := proxyConn(&Client{Connector: SOCKS5Connector(nil), Transporter: TCPTransporter()}, socksServer.server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	u, _ := url.Parse(httpSrv.URL)
+	conn, err = SOCKS5Connector(nil).Connect(conn, u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCfg := &Config{
+		ServeNodes: []NodeConfig{
+			{Protocol: "http", Addr: "127.0.0.1:0", Options: map[string]string{"proxyAgent": "gost-test"}},
+		},
+		Routes: []Config{
+			{ServeNodes: []NodeConfig{{Protocol: "socks5", Addr: "127.0.0.3:0"}}},
+		},
+	}
+
+	const total = 1000
+	var done, failed int64
+	var wg sync.WaitGroup
+	reloaded := make(chan error, 1)
+	var reloadOnce sync.Once
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.AddInt64(&done, 1) <= total {
+				if err := proxyRoundtrip(client, httpServer.server, httpSrv.URL, sendData); err != nil {
+					t.Log(err)
+					atomic.AddInt64(&failed, 1)
+				}
+				if atomic.LoadInt64(&done) >= total/2 {
+					reloadOnce.Do(func() { reloaded <- srv.Reload(newCfg) })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not reloaded")
+	}
+	if failed > 0 {
+		t.Errorf("%d of %d connections failed", failed, total)
+	}
+
+	if s := configServerOf(srv, "tcp://127.0.0.1:0"); s != httpServer {
+		t.Error("the listener of the changed node should be kept")
+	}
+	if httpServer.handler.v.Load() == oldHandler {
+		t.Error("the handler of the changed node is not updated")
+	}
+	if s := configServerOf(srv, "tcp://127.0.0.2:0"); s != nil {
+		t.Error("the removed server is running")
+	}
+	if _, err := net.DialTimeout("tcp", socksServer.server.Addr().String(), time.Second); err == nil {
+		t.Error("the removed server is listening")
+	}
+	added := configServerOf(srv, "tcp://127.0.0.3:0")
+	if added == nil {
+		t.Fatal("the added server is not running")
+	}
+	if err := proxyRoundtrip(&Client{Connector: SOCKS5Connector(nil), Transporter: TCPTransporter()},
+		added.server, httpSrv.URL, sendData); err != nil {
+		t.Error(err)
+	}
+
+	// the connection of the removed server is drained.
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if err := httpRoundtrip(conn, httpSrv.URL, sendData); err != nil {
+		t.Errorf("the connection of the removed server: %v", err)
+	}
+}
+
+func TestServerReloadError(t *testing.T) {
+	cfg := &Config{
+		ServeNodes: []NodeConfig{{Protocol: "http", Addr: "127.0.0.1:0"}},
+	}
+	srv, err := RunConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the address of the added node is in use.
+	err = srv.Reload(&Config{
+		ServeNodes: []NodeConfig{
+			{Protocol: "socks5", Addr: "127.0.0.1:0"},
+			{Protocol: "http", Addr: ln.Addr().String()},
+		},
+	})
+	if err == nil {
+		t.Fatal("should fail with the address in use")
+	}
+	s := configServerOf(srv, "tcp://127.0.0.1:0")
+	if s == nil || s.config.Protocol != "http" {
+		t.Errorf("the running servers should not be changed: %+v", s)
+	}
+
+	err = srv.Reload(&Config{
+		ServeNodes: []NodeConfig{
+			{Protocol: "http", Addr: "127.0.0.1:0"},
+			{Protocol: "socks5", Addr: "127.0.0.1:0"},
+		},
+	})
+	if err == nil {
+		t.Error("should fail with the duplicate listener")
+	}
+}
+
+func TestNodeConfigListenerEqual(t *testing.T) {
+	base := NodeConfig{Protocol: "http", Addr: ":8080", Options: map[string]string{"whitelist": "a", "pcap": "a.pcap"}}
+	tests := []struct {
+		nc    NodeConfig
+		equal bool
+	}{
+		{NodeConfig{Protocol: "socks5", Addr: ":8080", Remote: "b", Options: map[string]string{"pcap": "a.pcap", "bypass": "b"}}, true},
+		{NodeConfig{Protocol: "http", Addr: ":8080", Options: map[string]string{"whitelist": "a"}}, false},
+		{NodeConfig{Protocol: "http", Addr: ":8080", Options: map[string]string{"whitelist": "a", "pcap": "b.pcap"}}, false},
+		{NodeConfig{Protocol: "http", Addr: ":8080", Options: map[string]string{"pcap": "a.pcap", "c": "kcp.json"}}, false},
+		{NodeConfig{Protocol: "http", Addr: ":8080", Username: "alice", Options: map[string]string{"pcap": "a.pcap"}}, false},
+		{NodeConfig{Protocol: "http", Transport: "tls", Addr: ":8080", Options: map[string]string{"pcap": "a.pcap"}}, false},
+	}
+	for i, tc := range tests {
+		if equal := tc.nc.listenerEqual(&base); equal != tc.equal {
+			t.Errorf("#%d: got %v, want %v", i, equal, tc.equal)
+		}
+		if equal := base.listenerEqual(&tc.nc); equal != tc.equal {
+			t.Errorf("#%d: got %v, want %v (reversed)", i, equal, tc.equal)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulOptions are the options of ConsulRegistrar.
+type ConsulOptions struct {
+	// CheckInterval is the interval of the TCP health check, the default is 10s.
+	CheckInterval time.Duration
+	// CheckTimeout is the timeout of the TCP health check, the default is 5s.
+	CheckTimeout time.Duration
+	// DeregisterAfter deregisters the service if the check is critical for the duration, it is disabled if zero.
+	DeregisterAfter time.Duration
+}
+
+// ConsulOption allows a common way to set the options of ConsulRegistrar.
+type ConsulOption func(opts *ConsulOptions)
+
+// CheckIntervalConsulOption sets the interval of the health check.
+func CheckIntervalConsulOption(interval time.Duration) ConsulOption {
+	return func(opts *ConsulOptions) {
+		opts.CheckInterval = interval
+	}
+}
+
+// CheckTimeoutConsulOption sets the timeout of the health check.
+func CheckTimeoutConsulOption(timeout time.Duration) ConsulOption {
+	return func(opts *ConsulOptions) {
+		opts.CheckTimeout = timeout
+	}
+}
+
+// DeregisterAfterConsulOption sets the duration after which the critical service is deregistered by Consul.
+func DeregisterAfterConsulOption(d time.Duration) ConsulOption {
+	return func(opts *ConsulOptions) {
+		opts.DeregisterAfter = d
+	}
+}
+
+type consulRegistrar struct {
+	agent     *api.Agent
+	serviceID string
+	closeOnce sync.Once
+}
+
+// ConsulRegistrar registers the service of serviceAddr:port to the Consul agent addr, with a TCP health check
+// of the address. The service is deregistered by Close.
+func ConsulRegistrar(addr, serviceID, serviceAddr string, port int, tags []string, opts ...ConsulOption) (io.Closer, error) {
+	options := &ConsulOptions{
+		CheckInterval: 10 * time.Second,
+		CheckTimeout:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	config := api.DefaultConfig()
+	config.Address = addr
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &api.AgentServiceCheck{
+		CheckID:  serviceID + ":tcp",
+		TCP:      net.JoinHostPort(serviceAddr, strconv.Itoa(port)),
+		Interval: options.CheckInterval.String(),
+		Timeout:  options.CheckTimeout.String(),
+	}
+	if options.DeregisterAfter > 0 {
+		check.DeregisterCriticalServiceAfter = options.DeregisterAfter.String()
+	}
+	reg := &api.AgentServiceRegistration{
+		ID:      serviceID,
+		Name:    "gost",
+		Tags:    tags,
+		Address: serviceAddr,
+		Port:    port,
+		Check:   check,
+	}
+	agent := client.Agent()
+	if err := agent.ServiceRegister(reg); err != nil {
+		return nil, err
+	}
+	log.Logf("[consul] %s: service %s registered on %s:%d", addr, serviceID, serviceAddr, port)
+
+	return &consulRegistrar{
+		agent:     agent,
+		serviceID: serviceID,
+	}, nil
+}
+
+func (r *consulRegistrar) Close() (err error) {
+	r.closeOnce.Do(func() {
+		err = r.agent.ServiceDeregister(r.serviceID)
+		if err != nil {
+			log.Logf("[consul] service %s: deregister: %v", r.serviceID, err)
+			return
+		}
+		log.Logf("[consul] service %s deregistered", r.serviceID)
+	})
+	return
+}
@@ -0,0 +1,58 @@
+package gost
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestConsulRegistrar(t *testing.T) {
+	var reg api.AgentServiceRegistration
+	deregistered := ""
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/agent/service/register":
+			if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			deregistered = strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer agent.Close()
+
+	addr := strings.TrimPrefix(agent.URL, "http://")
+	closer, err := ConsulRegistrar(addr, "gost-1", "10.0.0.1", 1080, []string{"socks5"},
+		CheckIntervalConsulOption(3*time.Second),
+		DeregisterAfterConsulOption(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.ID != "gost-1" || reg.Address != "10.0.0.1" || reg.Port != 1080 || len(reg.Tags) != 1 || reg.Tags[0] != "socks5" {
+		t.Errorf("registration %+v", reg)
+	}
+	if reg.Check == nil || reg.Check.TCP != "10.0.0.1:1080" || reg.Check.Interval != "3s" ||
+		reg.Check.Timeout != "5s" || reg.Check.DeregisterCriticalServiceAfter != "1m0s" {
+		t.Errorf("check %+v", reg.Check)
+	}
+
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if deregistered != "gost-1" {
+		t.Errorf("deregistered %q", deregistered)
+	}
+
+	agent.Close()
+	if _, err := ConsulRegistrar(addr, "gost-2", "10.0.0.1", 1080, nil); err == nil {
+		t.Error("should fail with the agent unavailable")
+	}
+}
@@ -0,0 +1,117 @@
+package gost
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// ddosLogInterval is the min interval of the warnings of the rejected connections.
+const ddosLogInterval = 10 * time.Second
+
+// DDoSMitigationListener wraps the listener to shed the load of a connection flood early.
+// A connection is pending from it is accepted until the first data is read from it
+// (for the TLS based listeners, the handshake is completed in the first read) or it is closed.
+// The new connections are closed immediately if there are maxPendingHandshakes pending connections,
+// or maxPerIP pending connections from the same IP. A limit is disabled if it is not positive.
+func DDoSMitigationListener(ln Listener, maxPendingHandshakes int, maxPerIP int) Listener {
+	return &ddosListener{
+		Listener:   ln,
+		maxPending: int64(maxPendingHandshakes),
+		maxPerIP:   int64(maxPerIP),
+	}
+}
+
+type ddosListener struct {
+	Listener
+	maxPending int64
+	maxPerIP   int64
+	pending    int64    // the number of the pending connections
+	perIP      sync.Map // the IP string -> *int64, the number of its pending connections
+	rejected   int64    // the number of the connections rejected since the last warning
+	lastLog    int64    // the unix nano time of the last warning
+}
+
+func (l *ddosListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if counter := l.acquire(ip); counter != nil {
+			return &ddosConn{Conn: conn, l: l, ip: ip, counter: counter}, nil
+		}
+		conn.Close()
+		l.warn()
+	}
+}
+
+// acquire adds a pending connection of the IP, it returns nil if the limits are exceeded.
+func (l *ddosListener) acquire(ip string) *int64 {
+	if n := atomic.AddInt64(&l.pending, 1); l.maxPending > 0 && n > l.maxPending {
+		atomic.AddInt64(&l.pending, -1)
+		return nil
+	}
+	v, _ := l.perIP.LoadOrStore(ip, new(int64))
+	counter := v.(*int64)
+	if n := atomic.AddInt64(counter, 1); l.maxPerIP > 0 && n > l.maxPerIP {
+		l.release(ip, counter)
+		return nil
+	}
+	return counter
+}
+
+func (l *ddosListener) release(ip string, counter *int64) {
+	if atomic.AddInt64(counter, -1) == 0 {
+		// a counter removed while it is acquired by another connection only loosens the limit of the IP.
+		l.perIP.CompareAndDelete(ip, counter)
+	}
+	atomic.AddInt64(&l.pending, -1)
+}
+
+// warn logs the number of the rejected connections at most once in ddosLogInterval.
+func (l *ddosListener) warn() {
+	n := atomic.AddInt64(&l.rejected, 1)
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&l.lastLog)
+	if now-last < int64(ddosLogInterval) || !atomic.CompareAndSwapInt64(&l.lastLog, last, now) {
+		return
+	}
+	atomic.AddInt64(&l.rejected, -n)
+	log.Logf("[ddos] %s: %d connections rejected, too many pending connections", l.Addr(), n)
+}
+
+type ddosConn struct {
+	net.Conn
+	l       *ddosListener
+	ip      string
+	counter *int64
+	once    sync.Once
+}
+
+func (c *ddosConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.done()
+	}
+	return
+}
+
+func (c *ddosConn) Close() error {
+	c.done()
+	return c.Conn.Close()
+}
+
+func (c *ddosConn) done() {
+	c.once.Do(func() {
+		c.l.release(c.ip, c.counter)
+	})
+}
@@ -0,0 +1,140 @@
+package gost
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ddosEchoServer runs an echo server with the DDoS mitigation TLS listener.
+func ddosEchoServer(t *testing.T, maxPending, maxPerIP int) Listener {
+	ln, err := TLSListener("127.0.0.1:0", DefaultTLSConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = DDoSMitigationListener(ln, maxPending, maxPerIP)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+// ddosEcho connects to the server from the local IP, and checks the echo.
+func ddosEcho(addr, localIP string) error {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)},
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		return err
+	}
+	b := make([]byte, 4)
+	_, err = io.ReadFull(conn, b)
+	return err
+}
+
+func TestDDoSMitigationListenerLimit(t *testing.T) {
+	ln := ddosEchoServer(t, 4, 2)
+	addr := ln.Addr().String()
+
+	var conns []net.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	// the idle connections are pending, 2 of 127.0.0.1 and 2 of 127.0.0.2.
+	for _, ip := range []string{"127.0.0.1", "127.0.0.1", "127.0.0.2", "127.0.0.2"} {
+		conn, err := (&net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}).Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := ddosEcho(addr, "127.0.0.3"); err == nil {
+		t.Error("the connection should be rejected by the global limit")
+	}
+	conns[2].Close()
+	time.Sleep(100 * time.Millisecond)
+	if err := ddosEcho(addr, "127.0.0.1"); err == nil {
+		t.Error("the connection should be rejected by the per-IP limit")
+	}
+	if err := ddosEcho(addr, "127.0.0.3"); err != nil {
+		t.Error(err)
+	}
+	// the handshaked connections are not pending.
+	for i := 0; i < 10; i++ {
+		if err := ddosEcho(addr, "127.0.0.3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDDoSMitigationListenerFlood(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the flood test in short mode")
+	}
+	ln := ddosEchoServer(t, 100, 10)
+	addr := ln.Addr().String()
+
+	const flood = 10000
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < flood; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			<-done
+		}()
+	}
+
+	// the flood of 127.0.0.1 can only take the per-IP limit of the pending connections.
+	// The echo still waits for the flood in the accept queue, without the limits it would time out.
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		if err := ddosEcho(addr, "127.0.0.2"); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d > 3*time.Second {
+			t.Errorf("the server is slow under the flood: %v", d)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// the pending connections are released when they are closed.
+	for i := 0; i < 50 && atomic.LoadInt64(&ln.(*ddosListener).pending) > 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&ln.(*ddosListener).pending); n != 0 {
+		t.Errorf("%d pending connections, want 0", n)
+	}
+}
@@ -0,0 +1,92 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+var errDeadConn = errors.New("dead connection: no data received")
+
+// DeadConnDetector wraps the connection to detect the silent half-open connection, whose peer is gone
+// without closing it. When no data has been received for probeInterval, the read deadline is set to
+// probeTimeout, the connection is considered dead and closed if no data arrives before the deadline.
+// The detector is reset by every successful read.
+//
+// Unlike the TCP keepalive, no data is sent to the peer, so the peer must send some data within
+// probeInterval+probeTimeout, e.g. the heartbeats of the protocol or KeepaliveConn.
+// The read deadlines set by the caller are still respected.
+func DeadConnDetector(conn net.Conn, probeInterval, probeTimeout time.Duration) net.Conn {
+	return &deadConnDetector{
+		Conn:     conn,
+		interval: probeInterval,
+		timeout:  probeTimeout,
+		lastRecv: time.Now(),
+	}
+}
+
+type deadConnDetector struct {
+	net.Conn
+	interval time.Duration
+	timeout  time.Duration
+	mux      sync.Mutex
+	lastRecv time.Time
+	rdl      time.Time // the read deadline set by the caller
+}
+
+func (c *deadConnDetector) Read(b []byte) (n int, err error) {
+	probe := c.lastRecvTime().Add(c.interval)
+	if now := time.Now(); probe.Before(now) {
+		probe = now
+	}
+	probe = probe.Add(c.timeout)
+
+	rdl := c.readDeadline()
+	deadline := probe
+	if !rdl.IsZero() && rdl.Before(probe) {
+		deadline = rdl
+	}
+	c.Conn.SetReadDeadline(deadline)
+
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.mux.Lock()
+		c.lastRecv = time.Now()
+		c.mux.Unlock()
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() && deadline.Equal(probe) && !probe.Equal(rdl) {
+		log.Logf("[deadconn] %s - %s : no data in %v, closed", c.LocalAddr(), c.RemoteAddr(), c.interval+c.timeout)
+		c.Conn.Close()
+		return n, errDeadConn
+	}
+	return
+}
+
+func (c *deadConnDetector) lastRecvTime() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.lastRecv
+}
+
+func (c *deadConnDetector) readDeadline() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.rdl
+}
+
+func (c *deadConnDetector) SetDeadline(t time.Time) error {
+	c.mux.Lock()
+	c.rdl = t
+	c.mux.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *deadConnDetector) SetReadDeadline(t time.Time) error {
+	c.mux.Lock()
+	c.rdl = t
+	c.mux.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
@@ -0,0 +1,63 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDeadConnDetector(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	conn := DeadConnDetector(c1, 50*time.Millisecond, 50*time.Millisecond)
+	defer conn.Close()
+
+	// the data received within the interval keeps the connection alive.
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(30 * time.Millisecond)
+			c2.Write([]byte("x"))
+		}
+	}()
+	b := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		if _, err := conn.Read(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the silent peer.
+	start := time.Now()
+	if _, err := conn.Read(b); err != errDeadConn {
+		t.Fatalf("got %v, want %v", err, errDeadConn)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("the connection is closed in %v", d)
+	}
+	if _, err := c2.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("the dead connection is not closed: %v", err)
+	}
+}
+
+func TestDeadConnDetectorDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	conn := DeadConnDetector(c1, time.Second, time.Second)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("got %v, want timeout", err)
+	}
+
+	// the connection is still alive after the deadline of the caller.
+	conn.SetReadDeadline(time.Time{})
+	go c2.Write([]byte("x"))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,401 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"go4.org/mem"
+	"tailscale.com/derp"
+	"tailscale.com/types/key"
+)
+
+func init() {
+	// the DERP server of the node address, e.g. socks5+derp://derp1.tailscale.com:443?peer-key=<hex>
+	DefaultRegistry.RegisterTransport("derp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			var privateKey *key.MachinePrivate
+			if s := node.Get("key"); s != "" {
+				k := new(key.MachinePrivate)
+				if err := k.UnmarshalText([]byte(s)); err != nil {
+					return nil, fmt.Errorf("derp: invalid key: %v", err)
+				}
+				privateKey = k
+			}
+			tr := DERPTransporter("https://"+node.Addr+node.Get("path"), privateKey).(*derpTransporter)
+			if s := node.Get("peer-key"); s != "" {
+				peer, err := key.ParseNodePublicUntyped(mem.S(s))
+				if err != nil {
+					return nil, fmt.Errorf("derp: invalid peer-key: %v", err)
+				}
+				tr.peer = &peer
+			}
+			return tr, nil
+		},
+	})
+}
+
+// DERPMaxPacketSize is the max size of the packets relayed by the DERP servers.
+const DERPMaxPacketSize = derp.MaxPacketSize
+
+var (
+	errDERPNoPeer = errors.New("derp: no peer to send")
+)
+
+// derpNodeKey returns the key the node of the machine key is registered with on the DERP server.
+func derpNodeKey(privateKey key.MachinePrivate) key.NodePrivate {
+	return key.NodePrivateFromRaw32(mem.B(privateKey.UntypedBytes()))
+}
+
+// DERPPublicKey returns the public key of the node of privateKey on the DERP server,
+// the packets are sent to the node by the DERPAddr of it.
+func DERPPublicKey(privateKey key.MachinePrivate) key.NodePublic {
+	return derpNodeKey(privateKey).Public()
+}
+
+// DERPAddr is the address of a node on the DERP server, it is the public key of the node.
+type DERPAddr key.NodePublic
+
+// Network returns "derp".
+func (a DERPAddr) Network() string {
+	return "derp"
+}
+
+func (a DERPAddr) String() string {
+	return key.NodePublic(a).UntypedHexString()
+}
+
+// WithDERPPeer specifies the public key of the peer that the packets are sent to by the connection of DERPTransporter.
+func WithDERPPeer(publicKey key.NodePublic) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		opts.DERPPeer = &publicKey
+	}
+}
+
+type derpTransporter struct {
+	tcpTransporter
+	url        *url.URL
+	privateKey key.NodePrivate
+	peer       *key.NodePublic // the default peer of the connections
+}
+
+// DERPTransporter creates a Transporter that connects to the DERP (Designated Encrypted Relay for Packets) server
+// of Tailscale at derpURL, such as https://derp1.tailscale.com/derp, by the client of tailscale.com/derp, and
+// registers the node of privateKey, a random key is generated if it is nil. The handshaked connection is
+// a net.PacketConn relaying the packets by the DERP server: ReadFrom returns the packets forwarded to the node
+// with the DERPAddr of the sender, and WriteTo sends a packet to the node of the DERPAddr. Read and Write relay
+// the packets with the peer of WithDERPPeer, or the last sender if not specified.
+//
+// The addr of Dial is ignored, the connection is made to the host of derpURL.
+func DERPTransporter(derpURL string, privateKey *key.MachinePrivate) Transporter {
+	u, err := url.Parse(derpURL)
+	if err != nil {
+		log.Logf("[derp] %s: %s", derpURL, err)
+		u = &url.URL{}
+	}
+	if u.Path == "" {
+		u.Path = "/derp"
+	}
+	if privateKey == nil {
+		k := key.NewMachine()
+		privateKey = &k
+	}
+	return &derpTransporter{
+		url:        u,
+		privateKey: derpNodeKey(*privateKey),
+	}
+}
+
+func (tr *derpTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	host := tr.url.Host
+	if tr.url.Port() == "" {
+		if tr.url.Scheme == "http" {
+			host = net.JoinHostPort(tr.url.Hostname(), "80")
+		} else {
+			host = net.JoinHostPort(tr.url.Hostname(), "443")
+		}
+	}
+	return tr.tcpTransporter.Dial(host, options...)
+}
+
+func (tr *derpTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if tr.url.Scheme != "http" {
+		cfg := opts.TLSConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: tr.url.Hostname()}
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: tr.url.Path},
+		Host:       tr.url.Host,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	req.Header.Set("Upgrade", "DERP")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("User-Agent", DefaultUserAgent)
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("derp: %s", resp.Status)
+	}
+
+	// the client receives the key of the server, and registers the public key of the node.
+	client, err := derp.NewClient(tr.privateKey, conn, bufio.NewReadWriter(br, bufio.NewWriter(conn)), derpLogf)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &derpConn{
+		Conn:      conn,
+		client:    client,
+		publicKey: tr.privateKey.Public(),
+		packets:   make(chan derpPacket, 64),
+		closed:    make(chan struct{}),
+	}
+	peer := opts.DERPPeer
+	if peer == nil {
+		peer = tr.peer
+	}
+	if peer != nil {
+		c.peer = *peer
+		c.hasPeer = true
+	}
+	go c.recvLoop()
+	return c, nil
+}
+
+func (tr *derpTransporter) Multiplex() bool {
+	return false
+}
+
+func derpLogf(format string, args ...interface{}) {
+	if Debug {
+		log.Logf("[derp] "+format, args...)
+	}
+}
+
+type derpPacket struct {
+	src  key.NodePublic
+	data []byte
+}
+
+// derpConn is the connection of the node on the DERP server. The messages of the server are received
+// by the recvLoop, as the client of tailscale.com/derp fails forever on the deadline of Recv.
+type derpConn struct {
+	net.Conn
+	client    *derp.Client
+	publicKey key.NodePublic
+	packets   chan derpPacket
+	closed    chan struct{}
+	once      sync.Once
+	err       error
+
+	pmux    sync.Mutex
+	peer    key.NodePublic
+	hasPeer bool
+
+	rmux sync.Mutex
+	rbuf []byte // the rest of the last packet for Read
+
+	dmux         sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *derpConn) recvLoop() {
+	for {
+		m, err := c.client.Recv()
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		switch m := m.(type) {
+		case derp.ReceivedPacket:
+			// the data is owned by the client until the next Recv.
+			p := derpPacket{src: m.Source, data: append([]byte(nil), m.Data...)}
+			select {
+			case c.packets <- p:
+			case <-c.closed:
+				return
+			}
+		case derp.PingMessage:
+			if err := c.client.SendPong(m); err != nil {
+				c.shutdown(err)
+				return
+			}
+		case derp.PeerGoneMessage:
+			if Debug {
+				log.Logf("[derp] peer %s gone", DERPAddr(m.Peer))
+			}
+		}
+	}
+}
+
+func (c *derpConn) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.closed)
+	})
+}
+
+// ReadFrom reads a packet forwarded by the DERP server.
+func (c *derpConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	c.dmux.Lock()
+	deadline := c.readDeadline
+	c.dmux.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p := <-c.packets:
+		return copy(b, p.data), DERPAddr(p.src), nil
+	case <-c.closed:
+		return 0, nil, c.err
+	case <-timeout:
+		return 0, nil, &net.OpError{Op: "read", Net: "derp", Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// WriteTo sends the packet to the node of the DERPAddr by the DERP server.
+func (c *derpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	var dst DERPAddr
+	switch a := addr.(type) {
+	case DERPAddr:
+		dst = a
+	case *DERPAddr:
+		dst = *a
+	default:
+		return 0, fmt.Errorf("derp: invalid address %v", addr)
+	}
+	if err := c.client.Send(key.NodePublic(dst), b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read reads the packets of the peer, the packets of the other nodes are dropped if the peer is specified,
+// otherwise the sender becomes the peer.
+func (c *derpConn) Read(b []byte) (n int, err error) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	if len(c.rbuf) > 0 {
+		n = copy(b, c.rbuf)
+		c.rbuf = c.rbuf[n:]
+		return
+	}
+
+	buf := make([]byte, DERPMaxPacketSize)
+	for {
+		nn, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		src := key.NodePublic(addr.(DERPAddr))
+		c.pmux.Lock()
+		if c.hasPeer && c.peer != src {
+			c.pmux.Unlock()
+			continue
+		}
+		c.peer, c.hasPeer = src, true
+		c.pmux.Unlock()
+
+		n = copy(b, buf[:nn])
+		c.rbuf = buf[n:nn]
+		return n, nil
+	}
+}
+
+// Write sends the data to the peer, it is split to the packets of DERPMaxPacketSize.
+func (c *derpConn) Write(b []byte) (n int, err error) {
+	c.pmux.Lock()
+	peer, ok := c.peer, c.hasPeer
+	c.pmux.Unlock()
+	if !ok {
+		return 0, errDERPNoPeer
+	}
+
+	for n < len(b) {
+		p := b[n:]
+		if len(p) > DERPMaxPacketSize {
+			p = p[:DERPMaxPacketSize]
+		}
+		if _, err = c.WriteTo(p, DERPAddr(peer)); err != nil {
+			return
+		}
+		n += len(p)
+	}
+	return
+}
+
+func (c *derpConn) Close() error {
+	c.shutdown(net.ErrClosed)
+	return c.Conn.Close()
+}
+
+// LocalAddr returns the DERPAddr of the node.
+func (c *derpConn) LocalAddr() net.Addr {
+	return DERPAddr(c.publicKey)
+}
+
+// RemoteAddr returns the DERPAddr of the peer, or the address of the DERP server if the peer is unknown.
+func (c *derpConn) RemoteAddr() net.Addr {
+	c.pmux.Lock()
+	defer c.pmux.Unlock()
+	if c.hasPeer {
+		return DERPAddr(c.peer)
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// SetDeadline sets the read deadline of the packets, and the write deadline of the connection to the server.
+func (c *derpConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of reading the packets, the connection to the server is not affected.
+func (c *derpConn) SetReadDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline = t
+	return nil
+}
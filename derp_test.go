@@ -0,0 +1,97 @@
+package gost
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tailscale.com/derp"
+	"tailscale.com/derp/derphttp"
+	"tailscale.com/types/key"
+)
+
+// derpTestServer is the DERP server of tailscale.com/derp forwarding the packets between the clients.
+func derpTestServer(t *testing.T) *httptest.Server {
+	s := derp.NewServer(key.NewNode(), t.Logf)
+	srv := httptest.NewServer(derphttp.Handler(s))
+	t.Cleanup(func() {
+		srv.Close()
+		s.Close()
+	})
+	return srv
+}
+
+func derpTestConn(t *testing.T, srv *httptest.Server, key *key.MachinePrivate, options ...HandshakeOption) net.Conn {
+	tr := DERPTransporter(srv.URL+"/derp", key)
+	conn, err := tr.Dial("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = tr.Handshake(conn, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDERPTransporter(t *testing.T) {
+	srv := derpTestServer(t)
+
+	privA, privB := key.NewMachine(), key.NewMachine()
+	pubA, pubB := DERPPublicKey(privA), DERPPublicKey(privB)
+
+	a := derpTestConn(t, srv, &privA, WithDERPPeer(pubB))
+	b := derpTestConn(t, srv, &privB)
+	if a.LocalAddr().String() != DERPAddr(pubA).String() {
+		t.Errorf("unexpected local address %s", a.LocalAddr())
+	}
+	if _, err := b.Write([]byte("hello")); err != errDERPNoPeer {
+		t.Errorf("got error %v, want %v", err, errDERPNoPeer)
+	}
+
+	// the connection of B may not be registered yet.
+	buf := make([]byte, 16)
+	var n int
+	var err error
+	for i := 0; i < 50; i++ {
+		if _, err = a.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if n, err = b.Read(buf); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("got %q, want hello", buf[:n])
+	}
+	if b.RemoteAddr().String() != DERPAddr(pubA).String() {
+		t.Errorf("unexpected remote address %s", b.RemoteAddr())
+	}
+
+	// the read deadline exceeded does not break the connection.
+	b.SetReadDeadline(time.Time{})
+	if _, err := b.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if n, err = a.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Errorf("got %q, want world", buf[:n])
+	}
+
+	pc := a.(net.PacketConn)
+	if _, err := pc.WriteTo([]byte("to"), DERPAddr(pubB)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pc.WriteTo([]byte("to"), &net.TCPAddr{}); err == nil {
+		t.Error("write to a non-DERP address should failed")
+	}
+}
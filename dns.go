@@ -17,6 +17,24 @@ import (
 	"github.com/miekg/dns"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("dns", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return DNSListener(node.Addr, &DNSOptions{
+				Mode:      node.Get("mode"),
+				TLSConfig: opts.TLSConfig,
+			})
+		},
+	})
+	DefaultRegistry.RegisterProtocol("dns", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return DNSHandler(node.Remote), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("dot", Protocol{})
+	DefaultRegistry.RegisterProtocol("doh", Protocol{})
+}
+
 var (
 	defaultResolver Resolver
 )
@@ -0,0 +1,57 @@
+package gost
+
+import (
+	"net"
+)
+
+// WithTLS0RTT sends the data as the TLS 1.3 early data (0-RTT) in the handshake, so the server receives
+// the first request of the connection without waiting for the handshake to complete.
+//
+// The early data is only sent by QUICTransporter, for the resumed sessions of the servers which accept
+// 0-RTT (see WithAccept0RTT), it is sent after the handshake otherwise. As crypto/tls does not support
+// the early data, TLSTransporter always sends the data right after the handshake.
+//
+// WARNING: the early data is not protected against the replay attacks, an attacker can resend it to the server,
+// so it must be idempotent, e.g. a HTTP GET request.
+func WithTLS0RTT(data []byte) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		opts.EarlyData = data
+	}
+}
+
+// TLSListenerOptions are the options of the TLS based listeners.
+type TLSListenerOptions struct {
+	Accept0RTT bool
+	// MinVersion is the minimum TLS version accepted by the listener, it overrides the version of the TLS config if it is higher.
+	MinVersion uint16
+	// CipherSuites are the TLS 1.0-1.2 cipher suites of the listener if they are not nil.
+	CipherSuites []uint16
+	// XTLSFlow is the XTLS flow of TLSListener, see WithXTLSServerFlow.
+	XTLSFlow string
+}
+
+// TLSListenerOption allows a common way to set TLSListenerOptions.
+type TLSListenerOption func(opts *TLSListenerOptions)
+
+// WithAccept0RTT enables or disables accepting the early data (0-RTT) of the resumed TLS 1.3 sessions,
+// it is disabled by default. It is only supported by QUICListener, the TLS listener always rejects the early data.
+//
+// WARNING: the early data can be replayed, the server should only accept it if the first requests
+// of the clients are idempotent.
+func WithAccept0RTT(accept bool) TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		opts.Accept0RTT = accept
+	}
+}
+
+// writeEarlyData writes the early data to the connection, the connection is closed if it fails.
+func writeEarlyData(conn net.Conn, data []byte) (net.Conn, error) {
+	if len(data) == 0 {
+		return conn, nil
+	}
+	if _, err := conn.Write(data); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,153 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// delayPacketConn delays the packets sent in order, which simulates the network latency.
+type delayPacketConn struct {
+	net.PacketConn
+	delay   time.Duration
+	packets chan delayPacket
+}
+
+type delayPacket struct {
+	data   []byte
+	addr   net.Addr
+	sendAt time.Time
+}
+
+func newDelayPacketConn(pc net.PacketConn, delay time.Duration) *delayPacketConn {
+	c := &delayPacketConn{PacketConn: pc, delay: delay, packets: make(chan delayPacket, 1024)}
+	go func() {
+		for p := range c.packets {
+			time.Sleep(time.Until(p.sendAt))
+			c.PacketConn.WriteTo(p.data, p.addr)
+		}
+	}()
+	return c
+}
+
+func (c *delayPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.packets <- delayPacket{data: append([]byte(nil), b...), addr: addr, sendAt: time.Now().Add(c.delay)}
+	return len(b), nil
+}
+
+func TestQUIC0RTT(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ln, err := quicListenOn(newDelayPacketConn(pc, 50*time.Millisecond),
+		&QUICConfig{TLSConfig: DefaultTLSConfig}, WithAccept0RTT(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(conn, conn, 100)
+			}()
+		}
+	}()
+
+	addr := pc.LocalAddr().String()
+	tr := QUICTransporter(&QUICConfig{TLSConfig: &tls.Config{InsecureSkipVerify: true}}).(*quicTransporter)
+	request := bytes.Repeat([]byte("a"), 100)
+	roundtrip := func() (time.Duration, bool) {
+		start := time.Now()
+		conn, err := tr.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cc, err := tr.Handshake(conn, WithTLS0RTT(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cc.Close()
+		response := make([]byte, len(request))
+		if _, err := io.ReadFull(cc, response); err != nil {
+			t.Fatal(err)
+		}
+		rtt := time.Since(start)
+		if !bytes.Equal(request, response) {
+			t.Error("response mismatch")
+		}
+
+		// the next roundtrip uses a new session.
+		tr.sessionMutex.Lock()
+		defer tr.sessionMutex.Unlock()
+		session := tr.sessions[addr]
+		<-session.session.HandshakeComplete()
+		used0RTT := session.session.ConnectionState().Used0RTT
+		session.Close()
+		delete(tr.sessions, addr)
+		return rtt, used0RTT
+	}
+
+	rtt1, used := roundtrip()
+	if used {
+		t.Error("the first session should not use 0-RTT")
+	}
+	// wait for the session ticket.
+	time.Sleep(200 * time.Millisecond)
+	rtt0, used := roundtrip()
+	if !used {
+		t.Error("the resumed session should use 0-RTT")
+	}
+	t.Logf("1-RTT: %v, 0-RTT: %v", rtt1, rtt0)
+	if rtt0 >= rtt1 {
+		t.Errorf("0-RTT (%v) should be faster than 1-RTT (%v)", rtt0, rtt1)
+	}
+}
+
+func TestQUIC0RTTRejected(t *testing.T) {
+	ln, err := QUICListener("127.0.0.1:0", &QUICConfig{TLSConfig: DefaultTLSConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.CopyN(conn, conn, 5)
+			}()
+		}
+	}()
+
+	// the early data is sent after the handshake if the server does not accept 0-RTT.
+	tr := QUICTransporter(&QUICConfig{TLSConfig: &tls.Config{InsecureSkipVerify: true}})
+	for i := 0; i < 2; i++ {
+		conn, err := tr.Dial(ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cc, err := tr.Handshake(conn, WithTLS0RTT([]byte("hello")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 5)
+		if _, err := io.ReadFull(cc, b); err != nil || string(b) != "hello" {
+			t.Errorf("#%d: response %q: %v", i, b, err)
+		}
+		cc.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,208 @@
+package gost
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/miekg/dns"
+)
+
+var (
+	// ErrECHUnsupported is returned if ECH is not supported by the Go version (requires Go 1.23+).
+	ErrECHUnsupported = errors.New("ech: unsupported, requires go1.23")
+	// ErrNoECHConfig is returned by FetchECHConfig if the domain does not publish the ECH config.
+	ErrNoECHConfig = errors.New("ech: no ech config found")
+)
+
+// ECHResolver is the resolver used by FetchECHConfig,
+// the name servers in /etc/resolv.conf are used if it is nil.
+var ECHResolver Resolver
+
+// WithECH enables the ECH (Encrypted Client Hello) for TLSTransporter with the ECH config list,
+// which hides the real server name in the encrypted inner ClientHello.
+//
+// If the server does not accept ECH, the connection dialed by TLSTransporter is dialed again and the handshake
+// is retried with the retry configs provided by the server, or the plain SNI if there are none.
+// The rejection is remembered for echRejectionTTL, so the later handshakes with the server use the retry configs directly.
+func WithECH(echConfigList []byte) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		opts.ECHConfigList = echConfigList
+	}
+}
+
+// echRejectionTTL is how long the rejection of the ECH config list is remembered,
+// the original config list is tried again after it, as the server may support it again.
+const echRejectionTTL = 10 * time.Minute
+
+type echRejection struct {
+	retryConfigList []byte // may be empty
+	expires         time.Time
+}
+
+// echRejectionCache records the servers which have rejected the ECH config list.
+type echRejectionCache struct {
+	mux sync.Mutex
+	m   map[string]echRejection
+}
+
+func (c *echRejectionCache) load(key string) ([]byte, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	r, ok := c.m[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(r.expires) {
+		delete(c.m, key)
+		return nil, false
+	}
+	return r.retryConfigList, true
+}
+
+func (c *echRejectionCache) store(key string, retryConfigList []byte) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := time.Now()
+	if c.m == nil {
+		c.m = make(map[string]echRejection)
+	}
+	for k, r := range c.m {
+		if now.After(r.expires) {
+			delete(c.m, k)
+		}
+	}
+	c.m[key] = echRejection{retryConfigList: retryConfigList, expires: now.Add(echRejectionTTL)}
+}
+
+var echRejections = &echRejectionCache{}
+
+func echRejectionKey(echConfigList []byte, serverName, addr string) string {
+	return string(echConfigList) + "|" + serverName + "|" + addr
+}
+
+// echRedialConn is the connection dialed by TLSTransporter, which can be dialed again
+// to retry the handshake if ECH is rejected.
+type echRedialConn struct {
+	net.Conn
+	redial func() (net.Conn, error)
+}
+
+// echHandshake performs the TLS handshake with the ECH config list. If ECH is rejected by the server
+// and redial is not nil, the handshake is retried once on the new connection returned by redial.
+func echHandshake(conn net.Conn, config *tls.Config, echConfigList []byte, addr string, timeout time.Duration,
+	redial func() (net.Conn, error)) (net.Conn, error) {
+	key := echRejectionKey(echConfigList, config.ServerName, addr)
+	if v, ok := echRejections.load(key); ok {
+		echConfigList = v
+	}
+
+	cc, err := echClient(conn, config, echConfigList, addr, timeout)
+	if err == nil {
+		return cc, nil
+	}
+	retryConfigList, ok := echRetryConfigList(err)
+	if !ok {
+		return nil, err
+	}
+	echRejections.store(key, retryConfigList)
+	if Debug {
+		log.Logf("[tls] %s: ECH rejected by server, %d bytes retry configs", addr, len(retryConfigList))
+	}
+	if redial == nil {
+		return nil, err
+	}
+
+	conn.Close()
+	if conn, err = redial(); err != nil {
+		return nil, err
+	}
+	if cc, err = echClient(conn, config, retryConfigList, addr, timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cc, nil
+}
+
+// echClient performs the TLS handshake with the ECH config list, or the plain SNI if the list is empty.
+func echClient(conn net.Conn, config *tls.Config, echConfigList []byte, addr string, timeout time.Duration) (net.Conn, error) {
+	if len(echConfigList) == 0 {
+		if Debug {
+			log.Logf("[tls] %s: ECH rejected, fall back to plain SNI %s", addr, config.ServerName)
+		}
+		return wrapTLSClient(conn, config, timeout)
+	}
+
+	config, err := echTLSConfig(config, echConfigList)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := wrapTLSClient(conn, config, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if Debug && echAccepted(cc) {
+		log.Logf("[tls] %s: ECH accepted", addr)
+	}
+	return cc, nil
+}
+
+// FetchECHConfig retrieves the ECH config list from the HTTPS record (RFC 9460) of the domain.
+func FetchECHConfig(domain string) ([]byte, error) {
+	mq := &dns.Msg{}
+	mq.SetQuestion(dns.Fqdn(domain), dns.TypeHTTPS)
+	mq.RecursionDesired = true
+	query, err := mq.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := echExchange(query)
+	if err != nil {
+		return nil, err
+	}
+	mr := &dns.Msg{}
+	if err := mr.Unpack(reply); err != nil {
+		return nil, err
+	}
+
+	for _, rr := range mr.Answer {
+		https, ok := rr.(*dns.HTTPS)
+		if !ok {
+			continue
+		}
+		for _, kv := range https.Value {
+			if ech, ok := kv.(*dns.SVCBECHConfig); ok && len(ech.ECH) > 0 {
+				return ech.ECH, nil
+			}
+		}
+	}
+	return nil, ErrNoECHConfig
+}
+
+func echExchange(query []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultResolverTimeout)
+	defer cancel()
+
+	if ECHResolver != nil {
+		return ECHResolver.Exchange(ctx, query)
+	}
+
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+	err = errors.New("ech: no name server")
+	for _, server := range config.Servers {
+		ex := NewDNSExchanger(net.JoinHostPort(server, config.Port), TimeoutExchangerOption(DefaultResolverTimeout))
+		var reply []byte
+		if reply, err = ex.Exchange(ctx, query); err == nil {
+			return reply, nil
+		}
+	}
+	return nil, err
+}
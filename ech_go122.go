@@ -0,0 +1,21 @@
+//go:build !go1.23
+// +build !go1.23
+
+package gost
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+func echTLSConfig(config *tls.Config, echConfigList []byte) (*tls.Config, error) {
+	return nil, ErrECHUnsupported
+}
+
+func echRetryConfigList(err error) ([]byte, bool) {
+	return nil, false
+}
+
+func echAccepted(conn net.Conn) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+//go:build go1.23
+// +build go1.23
+
+package gost
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+func echTLSConfig(config *tls.Config, echConfigList []byte) (*tls.Config, error) {
+	config = config.Clone()
+	config.EncryptedClientHelloConfigList = echConfigList
+	if config.MinVersion != 0 && config.MinVersion < tls.VersionTLS13 {
+		config.MinVersion = tls.VersionTLS13
+	}
+	// the certificate for the public name is verified if ECH is rejected,
+	// which is skipped as well as the verification of the server name.
+	if config.InsecureSkipVerify && config.EncryptedClientHelloRejectionVerify == nil {
+		config.EncryptedClientHelloRejectionVerify = func(tls.ConnectionState) error { return nil }
+	}
+	return config, nil
+}
+
+// echRetryConfigList returns the retry config list if the error is caused by the ECH rejection.
+func echRetryConfigList(err error) ([]byte, bool) {
+	var e *tls.ECHRejectionError
+	if errors.As(err, &e) {
+		return e.RetryConfigList, true
+	}
+	return nil, false
+}
+
+func echAccepted(conn net.Conn) bool {
+	tc, ok := conn.(*tls.Conn)
+	return ok && tc.ConnectionState().ECHAccepted
+}
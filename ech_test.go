@@ -0,0 +1,263 @@
+//go:build go1.24
+// +build go1.24
+
+package gost
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newECHKey generates an ECH config (DHKEM(X25519), HKDF-SHA256, AES-128-GCM) and the key for the server.
+func newECHKey(t *testing.T, id uint8, publicName string) ([]byte, tls.EncryptedClientHelloKey) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.PublicKey().Bytes()
+
+	var b []byte
+	b = append(b, id)
+	b = binary.BigEndian.AppendUint16(b, 0x0020) // kem_id
+	b = binary.BigEndian.AppendUint16(b, uint16(len(pub)))
+	b = append(b, pub...)
+	b = binary.BigEndian.AppendUint16(b, 4)
+	b = binary.BigEndian.AppendUint16(b, 0x0001) // kdf_id
+	b = binary.BigEndian.AppendUint16(b, 0x0001) // aead_id
+	b = append(b, 0, byte(len(publicName)))      // maximum_name_length
+	b = append(b, publicName...)
+	b = binary.BigEndian.AppendUint16(b, 0) // extensions
+
+	config := binary.BigEndian.AppendUint16(nil, 0xfe0d)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(b)))
+	config = append(config, b...)
+
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	list = append(list, config...)
+	return list, tls.EncryptedClientHelloKey{Config: config, PrivateKey: key.Bytes(), SendAsRetry: true}
+}
+
+// echTestServer serves the TLS handshakes, the server name of the (inner) ClientHello is sent to names.
+func echTestServer(t *testing.T, keys []tls.EncryptedClientHelloKey, names chan<- string) net.Listener {
+	config := DefaultTLSConfig.Clone()
+	config.EncryptedClientHelloKeys = keys
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		names <- hello.ServerName
+		return nil, nil
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte{1})
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func echTestHandshake(addr string, echConfigList []byte) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := TLSTransporter().Handshake(conn,
+		TLSConfigHandshakeOption(&tls.Config{ServerName: "secret.example.com", InsecureSkipVerify: true}),
+		WithECH(echConfigList),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cc, nil
+}
+
+func TestTLSTransporterECH(t *testing.T) {
+	list, key := newECHKey(t, 1, "public.example.com")
+	names := make(chan string, 4)
+	ln := echTestServer(t, []tls.EncryptedClientHelloKey{key}, names)
+	defer ln.Close()
+
+	conn, err := echTestHandshake(ln.Addr().String(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !echAccepted(conn) {
+		t.Error("ECH is not accepted")
+	}
+	if name := <-names; name != "secret.example.com" {
+		t.Errorf("got server name %s, want secret.example.com", name)
+	}
+}
+
+func TestTLSTransporterECHFallback(t *testing.T) {
+	list, _ := newECHKey(t, 1, "public.example.com")
+
+	// the server does not support ECH, the later handshake falls back to the plain SNI.
+	names := make(chan string, 4)
+	ln := echTestServer(t, nil, names)
+	defer ln.Close()
+
+	if conn, err := echTestHandshake(ln.Addr().String(), list); err == nil {
+		conn.Close()
+		t.Fatal("ECH is accepted by the server without ECH support")
+	}
+	if name := <-names; name != "public.example.com" {
+		t.Errorf("got outer server name %s, want public.example.com", name)
+	}
+
+	conn, err := echTestHandshake(ln.Addr().String(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if echAccepted(conn) {
+		t.Error("ECH is accepted by the server without ECH support")
+	}
+	if name := <-names; name != "secret.example.com" {
+		t.Errorf("got server name %s, want secret.example.com", name)
+	}
+}
+
+func TestTLSTransporterECHRetry(t *testing.T) {
+	staleList, _ := newECHKey(t, 1, "public.example.com")
+	_, key := newECHKey(t, 2, "public.example.com")
+
+	// the server rotates the key, the later handshake uses the retry config.
+	names := make(chan string, 4)
+	ln := echTestServer(t, []tls.EncryptedClientHelloKey{key}, names)
+	defer ln.Close()
+
+	if conn, err := echTestHandshake(ln.Addr().String(), staleList); err == nil {
+		conn.Close()
+		t.Fatal("ECH is accepted with the stale config")
+	}
+	<-names
+
+	conn, err := echTestHandshake(ln.Addr().String(), staleList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !echAccepted(conn) {
+		t.Error("ECH is not accepted with the retry config")
+	}
+}
+
+func TestTLSTransporterECHRedial(t *testing.T) {
+	staleList, _ := newECHKey(t, 3, "public.example.com")
+	_, key := newECHKey(t, 4, "public.example.com")
+	names := make(chan string, 4)
+	ln := echTestServer(t, []tls.EncryptedClientHelloKey{key}, names)
+	defer ln.Close()
+
+	// the connection dialed by the transporter is dialed again with the retry config.
+	tr := TLSTransporter()
+	conn, err := tr.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := tr.Handshake(conn,
+		TLSConfigHandshakeOption(&tls.Config{ServerName: "secret.example.com", InsecureSkipVerify: true}),
+		WithECH(staleList),
+	)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	if !echAccepted(cc) {
+		t.Error("ECH is not accepted with the retry config")
+	}
+	if name := <-names; name != "public.example.com" {
+		t.Errorf("got outer server name %s, want public.example.com", name)
+	}
+	if name := <-names; name != "secret.example.com" {
+		t.Errorf("got server name %s, want secret.example.com", name)
+	}
+}
+
+func TestECHRejectionCacheTTL(t *testing.T) {
+	c := &echRejectionCache{}
+	c.store("a", []byte{1})
+	if v, ok := c.load("a"); !ok || len(v) != 1 {
+		t.Fatalf("got %v %v, want the retry config", v, ok)
+	}
+
+	c.m["a"] = echRejection{retryConfigList: []byte{1}, expires: time.Now().Add(-time.Second)}
+	if _, ok := c.load("a"); ok {
+		t.Error("the expired rejection should be ignored")
+	}
+	c.m["b"] = echRejection{expires: time.Now().Add(-time.Second)}
+	c.store("c", nil)
+	if _, ok := c.m["b"]; ok {
+		t.Error("the expired rejection should be removed")
+	}
+}
+
+func TestFetchECHConfig(t *testing.T) {
+	list, _ := newECHKey(t, 1, "public.example.com")
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := &dns.Msg{}
+			m.SetReply(r)
+			if q := r.Question[0]; q.Name == "example.com." && q.Qtype == dns.TypeHTTPS {
+				m.Answer = append(m.Answer, &dns.HTTPS{SVCB: dns.SVCB{
+					Hdr:      dns.RR_Header{Name: q.Name, Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 60},
+					Priority: 1,
+					Target:   ".",
+					Value: []dns.SVCBKeyValue{
+						&dns.SVCBAlpn{Alpn: []string{"h2"}},
+						&dns.SVCBECHConfig{ECH: list},
+					},
+				}})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go srv.ActivateAndServe()
+	defer srv.Shutdown()
+
+	r := NewResolver(0, NameServer{Addr: pc.LocalAddr().String()})
+	if err := r.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ECHResolver = r
+	defer func() { ECHResolver = nil }()
+
+	b, err := FetchECHConfig("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(list) {
+		t.Errorf("got ech config %x, want %x", b, list)
+	}
+
+	if _, err := FetchECHConfig("example.org"); err != ErrNoECHConfig {
+		t.Errorf("got error %v, want %v", err, ErrNoECHConfig)
+	}
+}
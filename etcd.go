@@ -0,0 +1,210 @@
+package gost
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-log/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ConfigUpdateType is the type of the node changes of a ConfigUpdate.
+type ConfigUpdateType int
+
+// The node changes.
+const (
+	ConfigNodeAdded ConfigUpdateType = iota
+	ConfigNodeModified
+	ConfigNodeDeleted
+)
+
+func (t ConfigUpdateType) String() string {
+	switch t {
+	case ConfigNodeAdded:
+		return "added"
+	case ConfigNodeModified:
+		return "modified"
+	case ConfigNodeDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// ConfigUpdate is a change of the nodes from a ConfigSource, Config is the whole config after the change.
+type ConfigUpdate struct {
+	Type   ConfigUpdateType
+	Key    string
+	Config *Config
+}
+
+// ConfigSource is the source of the dynamic config.
+type ConfigSource interface {
+	// Watch pushes the updates to ch until ctx is done, the first update is the current config.
+	Watch(ctx context.Context, ch chan<- ConfigUpdate) error
+}
+
+// WatchConfig reloads the servers of the config by the updates of the source until ctx is done, see Reload.
+func (s *Server) WatchConfig(ctx context.Context, src ConfigSource) error {
+	ch := make(chan ConfigUpdate)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- src.Watch(ctx, ch)
+	}()
+	for {
+		select {
+		case u := <-ch:
+			log.Logf("[config] %s %s", u.Key, u.Type)
+			if err := s.Reload(u.Config); err != nil {
+				log.Logf("[config] reload: %v", err)
+			}
+		case err := <-errc:
+			return err
+		}
+	}
+}
+
+type etcdConfigSource struct {
+	endpoints []string
+	prefix    string
+}
+
+// EtcdConfigSource creates a ConfigSource of the nodes stored in etcd. The values of the keys under
+// 'prefix/serve/' and 'prefix/chain/' are the JSON (NodeConfig) of the serve nodes and the chain nodes,
+// the chain nodes are in order of the keys.
+func EtcdConfigSource(endpoints []string, prefix string) ConfigSource {
+	return &etcdConfigSource{
+		endpoints: endpoints,
+		prefix:    strings.TrimSuffix(prefix, "/") + "/",
+	}
+}
+
+func (s *etcdConfigSource) Watch(ctx context.Context, ch chan<- ConfigUpdate) error {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   s.endpoints,
+		DialTimeout: 5 * time.Second,
+		Context:     ctx,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	resp, err := client.Get(ctx, s.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	nodes := newConfigNodes(s.prefix)
+	for _, kv := range resp.Kvs {
+		nodes.put(string(kv.Key), kv.Value)
+	}
+	select {
+	case ch <- ConfigUpdate{Type: ConfigNodeAdded, Key: s.prefix, Config: nodes.config()}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	wch := client.Watch(ctx, s.prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wresp.Events {
+			key := string(ev.Kv.Key)
+			var t ConfigUpdateType
+			var ok bool
+			if ev.Type == clientv3.EventTypeDelete {
+				t, ok = ConfigNodeDeleted, nodes.delete(key)
+			} else {
+				t, ok = nodes.put(key, ev.Kv.Value)
+			}
+			if !ok {
+				continue
+			}
+			select {
+			case ch <- ConfigUpdate{Type: t, Key: key, Config: nodes.config()}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// configNodes is the nodes of the keys under the prefix.
+type configNodes struct {
+	prefix string
+	serve  map[string]NodeConfig
+	chain  map[string]NodeConfig
+}
+
+func newConfigNodes(prefix string) *configNodes {
+	return &configNodes{
+		prefix: prefix,
+		serve:  make(map[string]NodeConfig),
+		chain:  make(map[string]NodeConfig),
+	}
+}
+
+// nodes returns the nodes of the key, and the name of the node.
+func (c *configNodes) nodes(key string) (map[string]NodeConfig, string) {
+	name := strings.TrimPrefix(key, c.prefix)
+	switch {
+	case strings.HasPrefix(name, "serve/"):
+		return c.serve, strings.TrimPrefix(name, "serve/")
+	case strings.HasPrefix(name, "chain/"):
+		return c.chain, strings.TrimPrefix(name, "chain/")
+	}
+	return nil, ""
+}
+
+// put adds or modifies the node of the key, it reports false if the key is not a node, or the value is invalid.
+func (c *configNodes) put(key string, value []byte) (ConfigUpdateType, bool) {
+	nodes, name := c.nodes(key)
+	if nodes == nil || name == "" {
+		return 0, false
+	}
+	var nc NodeConfig
+	if err := json.Unmarshal(value, &nc); err != nil {
+		log.Logf("[config] %s: %v", key, err)
+		return 0, false
+	}
+	t := ConfigNodeAdded
+	if _, ok := nodes[name]; ok {
+		t = ConfigNodeModified
+	}
+	nodes[name] = nc
+	return t, true
+}
+
+func (c *configNodes) delete(key string) bool {
+	nodes, name := c.nodes(key)
+	if _, ok := nodes[name]; !ok {
+		return false
+	}
+	delete(nodes, name)
+	return true
+}
+
+// config returns the config of the nodes, the nodes are in order of the names.
+func (c *configNodes) config() *Config {
+	cfg := &Config{}
+	for _, name := range sortedKeys(c.serve) {
+		cfg.ServeNodes = append(cfg.ServeNodes, c.serve[name])
+	}
+	for _, name := range sortedKeys(c.chain) {
+		cfg.ChainNodes = append(cfg.ChainNodes, c.chain[name])
+	}
+	return cfg
+}
+
+func sortedKeys(m map[string]NodeConfig) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
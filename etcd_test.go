@@ -0,0 +1,104 @@
+package gost
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfigNodes(t *testing.T) {
+	nodes := newConfigNodes("/gost/")
+
+	if typ, ok := nodes.put("/gost/serve/b", []byte(`{"protocol": "socks5", "addr": ":1080"}`)); !ok || typ != ConfigNodeAdded {
+		t.Errorf("put: %s, %v", typ, ok)
+	}
+	nodes.put("/gost/serve/a", []byte(`{"protocol": "http", "addr": ":8080"}`))
+	nodes.put("/gost/chain/2", []byte(`{"protocol": "socks5", "addr": "2.2.2.2:1080"}`))
+	nodes.put("/gost/chain/1", []byte(`{"protocol": "http", "addr": "1.1.1.1:8080"}`))
+	if typ, ok := nodes.put("/gost/serve/b", []byte(`{"protocol": "socks5", "addr": ":1081"}`)); !ok || typ != ConfigNodeModified {
+		t.Errorf("put: %s, %v", typ, ok)
+	}
+	if _, ok := nodes.put("/gost/serve/c", []byte(`invalid`)); ok {
+		t.Error("the invalid node should be ignored")
+	}
+	if _, ok := nodes.put("/gost/other", []byte(`{}`)); ok {
+		t.Error("the other keys should be ignored")
+	}
+
+	cfg := nodes.config()
+	if len(cfg.ServeNodes) != 2 || cfg.ServeNodes[0].Addr != ":8080" || cfg.ServeNodes[1].Addr != ":1081" {
+		t.Errorf("serve nodes %+v", cfg.ServeNodes)
+	}
+	if len(cfg.ChainNodes) != 2 || cfg.ChainNodes[0].Addr != "1.1.1.1:8080" || cfg.ChainNodes[1].Addr != "2.2.2.2:1080" {
+		t.Errorf("chain nodes %+v", cfg.ChainNodes)
+	}
+
+	if !nodes.delete("/gost/serve/a") || nodes.delete("/gost/serve/a") {
+		t.Error("delete")
+	}
+	if cfg := nodes.config(); len(cfg.ServeNodes) != 1 {
+		t.Errorf("serve nodes %+v", cfg.ServeNodes)
+	}
+}
+
+type testConfigSource struct {
+	updates []ConfigUpdate
+}
+
+func (s *testConfigSource) Watch(ctx context.Context, ch chan<- ConfigUpdate) error {
+	for _, u := range s.updates {
+		select {
+		case ch <- u:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestServerWatchConfig(t *testing.T) {
+	srv, err := RunConfig(&Config{
+		ServeNodes: []NodeConfig{{Protocol: "http", Addr: "127.0.0.1:0"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	src := &testConfigSource{
+		updates: []ConfigUpdate{
+			{Type: ConfigNodeAdded, Key: "/gost/serve/socks5", Config: &Config{
+				ServeNodes: []NodeConfig{
+					{Protocol: "http", Addr: "127.0.0.1:0"},
+					{Protocol: "socks5", Addr: "127.0.0.2:0"},
+				},
+			}},
+			{Type: ConfigNodeDeleted, Key: "/gost/serve/http", Config: &Config{
+				ServeNodes: []NodeConfig{
+					{Protocol: "socks5", Addr: "127.0.0.2:0"},
+				},
+			}},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- srv.WatchConfig(ctx, src) }()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if configServerOf(srv, "tcp://127.0.0.1:0") == nil && configServerOf(srv, "tcp://127.0.0.2:0") != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if configServerOf(srv, "tcp://127.0.0.1:0") != nil || configServerOf(srv, "tcp://127.0.0.2:0") == nil {
+		t.Error("the updates are not applied")
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("WatchConfig: %v", err)
+	}
+}
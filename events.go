@@ -0,0 +1,346 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-gost/gosocks5"
+)
+
+// EventType is the type of the connection events.
+type EventType string
+
+// The connection events.
+const (
+	// EventConnOpen is sent when the target of the connection is recognized,
+	// or when the connection is closed if it is not.
+	EventConnOpen EventType = "connection.open"
+	// EventConnClose is sent when the connection is closed.
+	EventConnClose EventType = "connection.close"
+	// EventConnError is sent when the handler rejects the request, e.g. a HTTP response status of 4xx/5xx
+	// or a SOCKS5 reply of failure.
+	EventConnError EventType = "connection.error"
+)
+
+// ConnEvent is a connection event.
+type ConnEvent struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Event      EventType `json:"event"`
+	SrcAddr    string    `json:"src_addr"`
+	DstAddr    string    `json:"dst_addr"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// eventSniffSize is the max size of the data sniffed for the target and the response of the handler.
+const eventSniffSize = 4096
+
+// eventMiddleware creates a Middleware which calls emit for the events of the connections.
+// The target is recognized from the HTTP request or the SOCKS5 request, it is empty for the other protocols.
+func eventMiddleware(events []EventType, emit func(ConnEvent)) Middleware {
+	types := make(map[EventType]bool)
+	for _, e := range events {
+		types[e] = true
+	}
+	return func(h Handler) Handler {
+		return &eventHandler{handler: h, events: types, emit: emit}
+	}
+}
+
+type eventHandler struct {
+	handler Handler
+	events  map[EventType]bool
+	emit    func(ConnEvent)
+}
+
+func (h *eventHandler) Init(options ...HandlerOption) {
+	h.handler.Init(options...)
+}
+
+func (h *eventHandler) Handle(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	b, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	cc := &eventConn{
+		Conn:   &bufferdConn{Conn: conn, br: br},
+		h:      h,
+		start:  time.Now(),
+		socks5: b[0] == gosocks5.Ver5,
+		method: -1,
+	}
+	if !cc.socks5 {
+		cc.parseHTTPTarget(br)
+	}
+	defer cc.finish()
+
+	h.handler.Handle(cc)
+}
+
+func (h *eventHandler) send(e EventType, c *eventConn, errMsg string) {
+	if !h.events[e] {
+		return
+	}
+	h.emit(ConnEvent{
+		Timestamp:  time.Now(),
+		Event:      e,
+		SrcAddr:    c.RemoteAddr().String(),
+		DstAddr:    c.dst,
+		BytesIn:    c.in,
+		BytesOut:   c.out,
+		DurationMs: time.Since(c.start).Milliseconds(),
+		Error:      errMsg,
+	})
+}
+
+// eventConn counts the traffic of the connection, and sniffs the target and the response of the handler.
+type eventConn struct {
+	net.Conn
+	h      *eventHandler
+	start  time.Time
+	socks5 bool
+
+	mux     sync.Mutex
+	dst     string
+	opened  bool
+	checked bool // the response of the request is checked
+	closed  bool
+	in, out int64
+	method  int    // the method selected by the SOCKS5 server, -1 if it is unknown yet
+	tls     bool   // the SOCKS5 negotiation is encrypted by the TLS methods, see observeTLS
+	request []byte // the data received before the target is recognized
+	sent    []byte // the data sent before the response of the request is checked
+}
+
+func (c *eventConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.in += int64(n)
+	if c.socks5 && !c.opened && !c.tls && len(c.request) < eventSniffSize {
+		c.request = append(c.request, b[:n]...)
+		c.parseSOCKS5Target()
+	}
+	return
+}
+
+func (c *eventConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.out += int64(n)
+	if !c.checked && !c.tls {
+		c.sent = append(c.sent, b[:n]...)
+		c.checkResponse()
+	}
+	return
+}
+
+// observeTLS returns the connection which sniffs the SOCKS5 negotiation decrypted by the TLS method,
+// conn is the TLS connection over c. The negotiation is sniffed as the equivalent plain method.
+func (c *eventConn) observeTLS(conn net.Conn, method uint8) net.Conn {
+	plain := gosocks5.MethodNoAuth
+	if method == MethodTLSAuth {
+		plain = gosocks5.MethodUserPass
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.method = int(plain)
+	c.request = []byte{gosocks5.Ver5, 1, plain}
+	c.sent = []byte{gosocks5.Ver5, plain}
+	return &eventTLSConn{Conn: conn, c: c}
+}
+
+// eventTLSConn sniffs the decrypted SOCKS5 negotiation for eventConn.
+type eventTLSConn struct {
+	net.Conn
+	c *eventConn
+}
+
+func (tc *eventTLSConn) Read(b []byte) (n int, err error) {
+	n, err = tc.Conn.Read(b)
+
+	c := tc.c
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.opened && len(c.request) < eventSniffSize {
+		c.request = append(c.request, b[:n]...)
+		c.parseSOCKS5Target()
+	}
+	return
+}
+
+func (tc *eventTLSConn) Write(b []byte) (n int, err error) {
+	n, err = tc.Conn.Write(b)
+
+	c := tc.c
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.checked {
+		c.sent = append(c.sent, b[:n]...)
+		c.checkResponse()
+	}
+	return
+}
+
+func (c *eventConn) Close() error {
+	c.finish()
+	return c.Conn.Close()
+}
+
+func (c *eventConn) finish() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.open()
+	c.h.send(EventConnClose, c, "")
+}
+
+func (c *eventConn) open() {
+	if c.opened {
+		return
+	}
+	c.opened = true
+	c.request = nil
+	c.h.send(EventConnOpen, c, "")
+}
+
+// parseHTTPTarget parses the target of the buffered HTTP request.
+func (c *eventConn) parseHTTPTarget(br *bufio.Reader) {
+	defer c.open()
+	for n := 1; n <= eventSniffSize; n++ {
+		b, err := br.Peek(n)
+		if err != nil {
+			return
+		}
+		if !bytes.HasSuffix(b, []byte("\r\n\r\n")) {
+			continue
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			return
+		}
+		c.dst = req.Host
+		if _, port, _ := net.SplitHostPort(c.dst); port == "" {
+			c.dst = net.JoinHostPort(c.dst, "80")
+		}
+		return
+	}
+}
+
+// parseSOCKS5Target parses the target of the SOCKS5 request following the method selection
+// and the username/password authentication.
+func (c *eventConn) parseSOCKS5Target() {
+	b := c.request
+	if len(b) < 2 || c.method < 0 {
+		return
+	}
+	n := 2 + int(b[1])
+	switch c.method {
+	case int(gosocks5.MethodNoAuth):
+	case int(gosocks5.MethodUserPass):
+		if len(b) < n+2 {
+			return
+		}
+		ulen := int(b[n+1])
+		if len(b) < n+3+ulen {
+			return
+		}
+		n += 3 + ulen + int(b[n+2+ulen])
+	default:
+		// the request is encrypted or rejected.
+		c.open()
+		return
+	}
+	if len(b) < n {
+		return
+	}
+	req, err := gosocks5.ReadRequest(bytes.NewReader(b[n:]))
+	if err != nil {
+		if len(b) >= eventSniffSize {
+			c.open()
+		}
+		return
+	}
+	c.dst = req.Addr.String()
+	c.open()
+}
+
+// checkResponse checks the response of the request sent by the handler,
+// the error event is sent if the request is rejected.
+func (c *eventConn) checkResponse() {
+	b := c.sent
+	errMsg := ""
+	if !c.socks5 {
+		// the status line, 'HTTP/1.1 200 ...'.
+		if len(b) < 12 {
+			return
+		}
+		if code, _ := strconv.Atoi(string(b[9:12])); code >= http.StatusBadRequest {
+			errMsg = "HTTP " + string(b[9:12])
+		}
+	} else {
+		if len(b) < 2 {
+			return
+		}
+		if c.method < 0 {
+			c.method = int(b[1])
+			if c.method == int(MethodTLS) || c.method == int(MethodTLSAuth) {
+				// the negotiation is sniffed by observeTLS.
+				c.tls, c.request, c.sent = true, nil, nil
+				return
+			}
+			if !c.opened {
+				c.parseSOCKS5Target()
+			}
+		}
+		n := 2
+		switch c.method {
+		case int(gosocks5.MethodNoAuth):
+		case int(gosocks5.MethodUserPass):
+			if len(b) < 4 {
+				return
+			}
+			if b[3] != gosocks5.Succeeded {
+				errMsg = "SOCKS5 authentication failure"
+			}
+			n = 4
+		case int(gosocks5.MethodNoAcceptable):
+			errMsg = "SOCKS5 no acceptable methods"
+		default:
+			// the response is encrypted.
+			c.checked, c.sent = true, nil
+			return
+		}
+		if errMsg == "" {
+			if len(b) < n+2 {
+				return
+			}
+			if rep := b[n+1]; rep != gosocks5.Succeeded {
+				errMsg = "SOCKS5 reply " + strconv.Itoa(int(rep))
+			}
+		}
+	}
+
+	c.checked, c.sent = true, nil
+	if errMsg != "" {
+		c.open()
+		c.h.send(EventConnError, c, errMsg)
+	}
+}
@@ -15,6 +15,66 @@ import (
 	smux "github.com/xtaci/smux"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("rtcp", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			// Directly use SSH port forwarding if the last chain node is forward+ssh
+			sshForwardChain(opts.Chain, SSHRemoteForwardConnector())
+			return TCPRemoteForwardListener(node.Addr, opts.Chain)
+		},
+		Chain: true,
+	})
+	DefaultRegistry.RegisterTransport("rudp", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return UDPRemoteForwardListener(node.Addr, opts.Chain, udpListenConfig(node))
+		},
+		Chain: true,
+	})
+	DefaultRegistry.RegisterProtocol("tcp", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TCPDirectForwardHandler(node.Remote), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("udp", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return UDPDirectForwardHandler(node.Remote), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("rtcp", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TCPRemoteForwardHandler(node.Remote), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("rudp", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return UDPRemoteForwardHandler(node.Remote), nil
+		},
+	})
+
+	// the TCP and UDP transparent proxy of redirect.go.
+	redu := Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return UDPRedirectListener(node.Addr, udpListenConfig(node))
+		},
+	}
+	DefaultRegistry.RegisterTransport("redu", redu)
+	DefaultRegistry.RegisterTransport("redirectu", redu)
+	redirect := Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TCPRedirectHandler(), nil
+		},
+	}
+	DefaultRegistry.RegisterProtocol("red", redirect)
+	DefaultRegistry.RegisterProtocol("redirect", redirect)
+	redirectu := Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return UDPRedirectHandler(), nil
+		},
+	}
+	DefaultRegistry.RegisterProtocol("redu", redirectu)
+	DefaultRegistry.RegisterProtocol("redirectu", redirectu)
+}
+
 type forwardConnector struct {
 }
 
@@ -0,0 +1,205 @@
+package gost
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// ErrFreenetStream is returned by FreenetTransporter as the streams over Freenet are not supported yet.
+var ErrFreenetStream = errors.New("freenet: streams over the darknet paths are not supported yet")
+
+// fcpMessage is the message of FCP (Freenet Client Protocol) v2:
+//
+//	ClientHello
+//	Name=gost
+//	ExpectedVersion=2.0
+//	EndMessage
+//
+// The fields are followed by the payload of DataLength bytes if the message ends with Data instead of EndMessage.
+type fcpMessage struct {
+	Name   string
+	Fields map[string]string
+	Data   []byte
+}
+
+func writeFCPMessage(w io.Writer, m *fcpMessage) error {
+	var b strings.Builder
+	b.WriteString(m.Name + "\n")
+	for k, v := range m.Fields {
+		if k == "DataLength" {
+			continue
+		}
+		b.WriteString(k + "=" + v + "\n")
+	}
+	if m.Data != nil {
+		b.WriteString("DataLength=" + strconv.Itoa(len(m.Data)) + "\nData\n")
+	} else {
+		b.WriteString("EndMessage\n")
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if m.Data != nil {
+		_, err := w.Write(m.Data)
+		return err
+	}
+	return nil
+}
+
+func readFCPMessage(br *bufio.Reader) (*fcpMessage, error) {
+	m := &fcpMessage{Fields: make(map[string]string)}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if m.Name == "" {
+			m.Name = line
+			continue
+		}
+		switch line {
+		case "EndMessage":
+			return m, nil
+		case "Data":
+			n, err := strconv.Atoi(m.Fields["DataLength"])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("freenet: %s: invalid DataLength %q", m.Name, m.Fields["DataLength"])
+			}
+			m.Data = make([]byte, n)
+			if _, err := io.ReadFull(br, m.Data); err != nil {
+				return nil, err
+			}
+			return m, nil
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("freenet: %s: invalid field %q", m.Name, line)
+		}
+		m.Fields[k] = v
+	}
+}
+
+// fcpConn is the FCP connection to the Freenet node.
+type fcpConn struct {
+	net.Conn
+	br *bufio.Reader
+	// the fields of NodeHello, such as Version, Node and ConnectionIdentifier.
+	hello map[string]string
+}
+
+// dialFCP connects to the FCP interface of the Freenet node and does the ClientHello handshake.
+func dialFCP(fcpAddr, name string) (*fcpConn, error) {
+	conn, err := net.DialTimeout("tcp", fcpAddr, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &fcpConn{Conn: conn, br: bufio.NewReader(conn)}
+
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := &fcpMessage{
+		Name: "ClientHello",
+		Fields: map[string]string{
+			"Name":            name,
+			"ExpectedVersion": "2.0",
+		},
+	}
+	if err := writeFCPMessage(conn, hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	m, err := readFCPMessage(c.br)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	switch m.Name {
+	case "NodeHello":
+	case "ProtocolError", "CloseConnectionDuplicateClientName":
+		conn.Close()
+		return nil, fmt.Errorf("freenet: %s: %s", m.Name, m.Fields["CodeDescription"])
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("freenet: unexpected message %s", m.Name)
+	}
+	c.hello = m.Fields
+	return c, nil
+}
+
+type freenetTransporter struct {
+	fcpAddr string
+	conn    *fcpConn
+	mux     sync.Mutex
+}
+
+// FreenetTransporter creates a Transporter of the Freenet node by the FCP interface at fcpAddr,
+// such as 127.0.0.1:9481.
+//
+// It is EXPERIMENTAL and a stub: the persistent FCP connection is set up with the ClientHello handshake,
+// but Freenet is a content store rather than a stream network, so Dial returns ErrFreenetStream
+// until the streams over the darknet paths are implemented. So it is not available as the freenet:// node
+// of the command line and the config, it can only be used by the API.
+func FreenetTransporter(fcpAddr string) Transporter {
+	return &freenetTransporter{fcpAddr: fcpAddr}
+}
+
+// fcp returns the persistent FCP connection, it reconnects if the connection is not set up.
+func (tr *freenetTransporter) fcp() (*fcpConn, error) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.conn != nil {
+		return tr.conn, nil
+	}
+	conn, err := dialFCP(tr.fcpAddr, fmt.Sprintf("gost-%d", time.Now().UnixNano()))
+	if err != nil {
+		return nil, err
+	}
+	log.Logf("[freenet] %s: connected to %s %s", tr.fcpAddr, conn.hello["Node"], conn.hello["Version"])
+	tr.conn = conn
+
+	go func() {
+		// the node messages are not used, the connection is set up again when it is closed.
+		for {
+			if _, err := readFCPMessage(conn.br); err != nil {
+				break
+			}
+		}
+		conn.Close()
+		tr.mux.Lock()
+		if tr.conn == conn {
+			tr.conn = nil
+		}
+		tr.mux.Unlock()
+	}()
+	return conn, nil
+}
+
+func (tr *freenetTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	if _, err := tr.fcp(); err != nil {
+		return nil, err
+	}
+	return nil, ErrFreenetStream
+}
+
+func (tr *freenetTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *freenetTransporter) Multiplex() bool {
+	return false
+}
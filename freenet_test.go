@@ -0,0 +1,109 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFCPMessage(t *testing.T) {
+	var buf bytes.Buffer
+	m := &fcpMessage{
+		Name:   "ClientPut",
+		Fields: map[string]string{"URI": "CHK@", "Identifier": "a"},
+		Data:   []byte("EndMessage\nData\n"),
+	}
+	if err := writeFCPMessage(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFCPMessage(&buf, &fcpMessage{Name: "Disconnect"}); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(&buf)
+	m2, err := readFCPMessage(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Name != m.Name || m2.Fields["URI"] != "CHK@" || m2.Fields["Identifier"] != "a" || !bytes.Equal(m2.Data, m.Data) {
+		t.Errorf("got %+v, want %+v", m2, m)
+	}
+	m2, err = readFCPMessage(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.Name != "Disconnect" || m2.Data != nil {
+		t.Errorf("unexpected message %+v", m2)
+	}
+}
+
+// fcpTestNode replies the ClientHello with the reply message.
+func fcpTestNode(t *testing.T, reply *fcpMessage) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				m, err := readFCPMessage(br)
+				if err != nil || m.Name != "ClientHello" || m.Fields["ExpectedVersion"] != "2.0" {
+					return
+				}
+				writeFCPMessage(conn, reply)
+				readFCPMessage(br)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestFreenetTransporter(t *testing.T) {
+	ln := fcpTestNode(t, &fcpMessage{
+		Name: "NodeHello",
+		Fields: map[string]string{
+			"FCPVersion": "2.0",
+			"Node":       "Fred",
+			"Version":    "Fred,0.7,1.0,1497",
+		},
+	})
+	defer ln.Close()
+
+	tr := FreenetTransporter(ln.Addr().String())
+	if _, err := tr.Dial("example"); !errors.Is(err, ErrFreenetStream) {
+		t.Errorf("got error %v, want %v", err, ErrFreenetStream)
+	}
+	conn, err := tr.(*freenetTransporter).fcp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.hello["Node"] != "Fred" {
+		t.Errorf("unexpected NodeHello %v", conn.hello)
+	}
+	conn.Close()
+}
+
+func TestFreenetTransporterProtocolError(t *testing.T) {
+	ln := fcpTestNode(t, &fcpMessage{
+		Name: "ProtocolError",
+		Fields: map[string]string{
+			"Code":            "1",
+			"CodeDescription": "ClientHello must be first message",
+		},
+	})
+	defer ln.Close()
+
+	_, err := FreenetTransporter(ln.Addr().String()).Dial("example")
+	if err == nil || !strings.Contains(err.Error(), "ClientHello must be first message") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
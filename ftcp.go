@@ -9,6 +9,22 @@ import (
 	"github.com/xtaci/tcpraw"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("ftcp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return FakeTCPTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return FakeTCPListener(node.Addr, &FakeTCPListenConfig{
+				TTL:       node.GetDuration("ttl"),
+				Backlog:   node.GetInt("backlog"),
+				QueueSize: node.GetInt("queue"),
+			})
+		},
+	})
+	DefaultRegistry.RegisterProtocol("ftcp", Protocol{})
+}
+
 type fakeTCPTransporter struct{}
 
 // FakeTCPTransporter creates a Transporter that is used by fake tcp client.
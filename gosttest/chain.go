@@ -0,0 +1,111 @@
+// Package gosttest provides utilities for testing the gost transports in process.
+package gosttest
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ginuerzh/gost"
+)
+
+// acceptTimeout is the max time waiting for the connection to the target.
+const acceptTimeout = 5 * time.Second
+
+type chainLayer struct {
+	transporter gost.Transporter
+	listener    gost.Listener
+}
+
+// TestChainBuilder builds a proxy chain in process, each layer is a hop of the chain served by a HTTP proxy
+// on its listener, and the client connects to the next hop through the transporter of the layer.
+// The connections of the chain are on the loopback interface.
+type TestChainBuilder struct {
+	layers []chainLayer
+}
+
+// NewTestChainBuilder creates an empty TestChainBuilder, the connections of an empty chain are direct.
+func NewTestChainBuilder() *TestChainBuilder {
+	return &TestChainBuilder{}
+}
+
+// AddLayer appends a hop with the client transporter and the server listener, e.g. gost.TLSTransporter()
+// and gost.TLSListener("127.0.0.1:0", nil). The listener is closed by the cleanup of Build.
+func (b *TestChainBuilder) AddLayer(transporter gost.Transporter, listener gost.Listener) *TestChainBuilder {
+	b.layers = append(b.layers, chainLayer{transporter: transporter, listener: listener})
+	return b
+}
+
+// Build serves the layers, and connects through all of them to a target listener.
+// The clientConn is the connection of the client through the chain, the serverConn is the connection accepted by the target.
+// The cleanup closes the connections and the listeners, it is also called when the test ends.
+func (b *TestChainBuilder) Build(t *testing.T) (clientConn net.Conn, serverConn net.Conn, cleanup func()) {
+	t.Helper()
+
+	var closers []func() error
+	var once sync.Once
+	cleanup = func() {
+		once.Do(func() {
+			for i := len(closers) - 1; i >= 0; i-- {
+				closers[i]()
+			}
+		})
+	}
+	t.Cleanup(cleanup)
+
+	var nodes []gost.Node
+	for _, layer := range b.layers {
+		server := &gost.Server{Listener: layer.listener}
+		go server.Serve(gost.HTTPHandler())
+		closers = append(closers, server.Close)
+
+		addr := layer.listener.Addr().String()
+		nodes = append(nodes, gost.Node{
+			Addr:     addr,
+			Protocol: "http",
+			Client: &gost.Client{
+				Connector:   gost.HTTPConnector(nil),
+				Transporter: layer.transporter,
+			},
+			HandshakeOptions: []gost.HandshakeOption{
+				gost.AddrHandshakeOption(addr),
+				gost.HostHandshakeOption(addr),
+			},
+		})
+	}
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	closers = append(closers, target.Close)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	clientConn, err = gost.NewChain(nodes...).Dial(target.Addr().String())
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	closers = append(closers, clientConn.Close)
+
+	select {
+	case serverConn = <-accepted:
+	case <-time.After(acceptTimeout):
+	}
+	if serverConn == nil {
+		cleanup()
+		t.Fatal("the connection to the target is not accepted")
+	}
+	closers = append(closers, serverConn.Close)
+	return
+}
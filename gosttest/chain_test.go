@@ -0,0 +1,92 @@
+package gosttest
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/ginuerzh/gost"
+)
+
+func tlsConfig(t *testing.T) *tls.Config {
+	cert, err := gost.GenCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
+// roundtrip writes the data on one side of the connections and reads it from the other side.
+func roundtrip(t *testing.T, clientConn, serverConn net.Conn) {
+	for _, c := range [][2]net.Conn{{clientConn, serverConn}, {serverConn, clientConn}} {
+		data := []byte("hello gost")
+		go c[0].Write(data)
+		b := make([]byte, len(data))
+		if _, err := io.ReadFull(c[1], b); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != string(data) {
+			t.Errorf("got %q, want %q", b, data)
+		}
+	}
+}
+
+func TestChainBuilderTLS(t *testing.T) {
+	ln, err := gost.TLSListener("127.0.0.1:0", tlsConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn, cleanup := NewTestChainBuilder().
+		AddLayer(gost.TLSTransporter(), ln).
+		Build(t)
+	defer cleanup()
+	roundtrip(t, clientConn, serverConn)
+}
+
+func TestChainBuilderObfsHTTP(t *testing.T) {
+	ln, err := gost.ObfsHTTPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn, cleanup := NewTestChainBuilder().
+		AddLayer(gost.ObfsHTTPTransporter(), ln).
+		Build(t)
+	defer cleanup()
+	roundtrip(t, clientConn, serverConn)
+}
+
+// the smux layer is the multiplexed TLS (mtls).
+func TestChainBuilderSmux(t *testing.T) {
+	ln, err := gost.MTLSListener("127.0.0.1:0", tlsConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn, cleanup := NewTestChainBuilder().
+		AddLayer(gost.MTLSTransporter(), ln).
+		Build(t)
+	defer cleanup()
+	roundtrip(t, clientConn, serverConn)
+}
+
+func TestChainBuilderLayers(t *testing.T) {
+	tlsLn, err := gost.TLSListener("127.0.0.1:0", tlsConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obfsLn, err := gost.ObfsHTTPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	muxLn, err := gost.MTLSListener("127.0.0.1:0", tlsConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, serverConn, cleanup := NewTestChainBuilder().
+		AddLayer(gost.TLSTransporter(), tlsLn).
+		AddLayer(gost.ObfsHTTPTransporter(), obfsLn).
+		AddLayer(gost.MTLSTransporter(), muxLn).
+		Build(t)
+	defer cleanup()
+	roundtrip(t, clientConn, serverConn)
+}
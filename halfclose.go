@@ -0,0 +1,67 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// HalfCloseRelay relays the data between a and b in both directions, keeping the TCP half-close.
+// When the Read of a returns io.EOF, the write side of b is closed by CloseWrite to signal the end of the data
+// from a to b, while the data from b to a is still relayed, and vice versa. Both connections are closed when
+// both directions are half-closed, or either direction fails. It is required by the protocols which finish sending
+// before receiving the response, e.g. the FTP passive mode or the HTTP request ended by the half-close.
+//
+// The connections must implement CloseWrite() error, such as *net.TCPConn, *net.UnixConn and *tls.Conn,
+// otherwise both connections are closed when either direction ends, as the other relays do.
+//
+// It returns the number of bytes copied from a to b and from b to a, the error is that of the failing direction.
+func HalfCloseRelay(a, b net.Conn) (int64, int64, error) {
+	type result struct {
+		n   int64
+		err error
+	}
+	var closed int32
+	// closeBoth closes the connections, it returns false if they have been closed by the other direction.
+	closeBoth := func() bool {
+		if !atomic.CompareAndSwapInt32(&closed, 0, 1) {
+			return false
+		}
+		a.Close()
+		b.Close()
+		return true
+	}
+	relay := func(dst, src net.Conn, ch chan<- result) {
+		n, err := io.Copy(dst, src)
+		if err == nil {
+			if cw, ok := dst.(closeWriter); ok {
+				err = cw.CloseWrite()
+			} else {
+				// no half-close, end both directions.
+				closeBoth()
+			}
+		}
+		if err != nil && !closeBoth() {
+			// the error is caused by the other direction closing the connections.
+			err = nil
+		}
+		ch <- result{n, err}
+	}
+
+	ab, ba := make(chan result, 1), make(chan result, 1)
+	go relay(b, a, ab)
+	go relay(a, b, ba)
+
+	r1, r2 := <-ab, <-ba
+	closeBoth()
+
+	err := r1.err
+	if err == nil {
+		err = r2.err
+	}
+	return r1.n, r2.n, err
+}
@@ -0,0 +1,88 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// tcpConnPair returns both ends of a TCP connection.
+func tcpConnPair(t *testing.T, ln net.Listener) (net.Conn, net.Conn) {
+	c1, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c1, c2
+}
+
+func TestHalfCloseRelay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, a := tcpConnPair(t, ln)
+	b, server := tcpConnPair(t, ln)
+	defer client.Close()
+	defer server.Close()
+
+	type result struct {
+		ab, ba int64
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ab, ba, err := HalfCloseRelay(a, b)
+		done <- result{ab, ba, err}
+	}()
+
+	// the server responds after the end of the request, which is signaled by the half-close.
+	go func() {
+		req, _ := io.ReadAll(server)
+		server.Write(append([]byte("response to "), req...))
+		server.(*net.TCPConn).CloseWrite()
+	}()
+
+	client.Write([]byte("request"))
+	client.(*net.TCPConn).CloseWrite()
+	resp, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "response to request" {
+		t.Errorf("got %q", resp)
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Error(r.err)
+	}
+	if r.ab != 7 || r.ba != 19 {
+		t.Errorf("relayed %d and %d bytes, want 7 and 19", r.ab, r.ba)
+	}
+}
+
+func TestHalfCloseRelayNoHalfClose(t *testing.T) {
+	client, a := net.Pipe()
+	b, server := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := HalfCloseRelay(a, b)
+		done <- err
+	}()
+
+	// net.Pipe does not support the half-close, both directions end with either.
+	client.Close()
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v, want %v", err, io.EOF)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
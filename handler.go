@@ -10,6 +10,7 @@ import (
 	"github.com/go-gost/gosocks4"
 	"github.com/go-gost/gosocks5"
 	"github.com/go-log/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Handler is a proxy server handler
@@ -44,6 +45,20 @@ type HandlerOptions struct {
 	IPRoutes      []IPRoute
 	ProxyAgent    string
 	HTTPTunnel    bool
+
+	// TimeACL is the time-based access control of the users, see TimeACLHandlerOption.
+	TimeACL *TimeACL
+
+	// TracerProvider creates the spans of the proxy connections, see WithOpenTelemetryTracer.
+	TracerProvider trace.TracerProvider
+
+	// HealthCheck is the path of the health check endpoint of HTTP handler, see WithHealthCheck.
+	HealthCheck string
+	// HealthCheckUpstream checks the first hop of the chain for the health check, see WithHealthCheckUpstream.
+	HealthCheckUpstream bool
+
+	// StickyCookie is the cookie name of the sticky sessions of the reverse proxy, see WithStickyCookie.
+	StickyCookie string
 }
 
 // HandlerOption allows a common way to set handler options.
@@ -227,6 +242,46 @@ func HTTPTunnelHandlerOption(tunnelMode bool) HandlerOption {
 	}
 }
 
+// TimeACLHandlerOption sets the time-based access control for HTTP and SOCKS5 handler,
+// the users are rejected outside the allowed time after the authentication.
+func TimeACLHandlerOption(acl *TimeACL) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.TimeACL = acl
+	}
+}
+
+// WithOpenTelemetryTracer sets the OpenTelemetry tracer provider for HTTP and SOCKS5 handler,
+// a span is created for each proxy connection.
+func WithOpenTelemetryTracer(tp trace.TracerProvider) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.TracerProvider = tp
+	}
+}
+
+// WithHealthCheck sets the path of the health check endpoint for HTTP handler.
+// The GET requests to the path are responded with 200 and '{"status":"ok","version":"..."}' before the authentication.
+func WithHealthCheck(path string) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.HealthCheck = path
+	}
+}
+
+// WithHealthCheckUpstream enables checking the upstream for the health check endpoint,
+// it is responded with 503 if none of the nodes of the first hop of the chain can be connected by its transport.
+func WithHealthCheckUpstream(check bool) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.HealthCheckUpstream = check
+	}
+}
+
+// WithStickyCookie sets the cookie name of the sticky sessions for ReverseLoadBalancerHandler.
+// The client is sent to the backend of the cookie as long as it is up, the cookie is set by the first response.
+func WithStickyCookie(name string) HandlerOption {
+	return func(opts *HandlerOptions) {
+		opts.StickyCookie = name
+	}
+}
+
 type autoHandler struct {
 	options *HandlerOptions
 }
@@ -0,0 +1,307 @@
+package gost
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-log/log"
+)
+
+// harDefaultMaxBodySize is the default max size of the bodies captured by HARExporter.
+const harDefaultMaxBodySize = 64 * 1024
+
+// HARMiddleware captures the HTTP traffic of the wrapped handlers to a HAR file.
+type HARMiddleware interface {
+	// Handler wraps the handler, e.g. the HTTP handler, to capture its HTTP requests.
+	Handler(h Handler) Handler
+	// Close completes the HAR file, the requests are not captured after it is closed.
+	Close() error
+}
+
+// HAROptions describes the options for HARExporter.
+type HAROptions struct {
+	MaxBodySize int64
+}
+
+// HAROption allows a common way to set HAR options.
+type HAROption func(opts *HAROptions)
+
+// HARMaxBodySizeOption sets the max size of the request and response bodies saved in the HAR file,
+// the bodies are truncated to the size, 0 disables the bodies, defaults to 64KB.
+func HARMaxBodySizeOption(n int64) HAROption {
+	return func(opts *HAROptions) {
+		opts.MaxBodySize = n
+	}
+}
+
+// HARExporter creates a HARMiddleware which writes the HTTP requests proxied by the wrapped handlers
+// to the HAR 1.2 file at outputPath. The requests are parsed from the traffic as HTTPLogMiddleware does,
+// the entries are written to the file when their responses complete, so a long running capture does not
+// keep them in memory, and the file is a valid HAR after Close.
+// The dns and connect timings are recorded by the handlers which dial the targets (e.g. the HTTP handler),
+// they are -1 if the upstream connection is reused.
+func HARExporter(outputPath string, opts ...HAROption) HARMiddleware {
+	options := HAROptions{MaxBodySize: harDefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	e := &harExporter{options: options}
+	e.f, e.err = os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if e.err != nil {
+		log.Logf("[har] %s", e.err)
+		return e
+	}
+	e.w = bufio.NewWriter(e.f)
+	header, _ := json.Marshal(harCreator{Name: "gost", Version: Version})
+	e.write([]byte(`{"log":{"version":"1.2","creator":`))
+	e.write(header)
+	e.write([]byte(`,"entries":[`))
+	e.flush()
+	return e
+}
+
+type harExporter struct {
+	mux     sync.Mutex
+	options HAROptions
+	f       *os.File
+	w       *bufio.Writer
+	entries int
+	closed  bool
+	err     error
+}
+
+func (e *harExporter) Handler(h Handler) Handler {
+	return &httpLogHandler{handler: h, emit: e.export, maxBody: e.options.MaxBodySize}
+}
+
+func (e *harExporter) Close() error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	if e.f == nil {
+		return e.err
+	}
+	e.write([]byte("]}}\n"))
+	e.flush()
+	if err := e.f.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+func (e *harExporter) export(x *httpExchange) {
+	b, err := json.Marshal(newHAREntry(x))
+	if err != nil {
+		return
+	}
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.closed || e.f == nil {
+		return
+	}
+	if e.entries > 0 {
+		e.write([]byte{','})
+	}
+	e.write(b)
+	e.flush()
+	e.entries++
+}
+
+// write writes to the buffer of the file, the first error is kept and returned by Close.
+func (e *harExporter) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(b)
+}
+
+func (e *harExporter) flush() {
+	if e.err != nil {
+		return
+	}
+	if e.err = e.w.Flush(); e.err != nil {
+		log.Logf("[har] %s", e.err)
+	}
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// harTimings are in milliseconds, -1 if the timing does not apply.
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func harMillis(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for k, vs := range h {
+		for _, v := range vs {
+			headers = append(headers, harNameValue{Name: k, Value: v})
+		}
+	}
+	return headers
+}
+
+func newHAREntry(x *httpExchange) *harEntry {
+	// the request is read when the header is parsed, then the target is dialed before the body is forwarded.
+	t := harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	send := x.sent.Sub(x.Timestamp)
+	if d := x.dial; d != nil {
+		if d.DNS >= 0 {
+			t.DNS = harMillis(d.DNS)
+			send -= d.DNS
+		}
+		t.Connect = harMillis(d.Connect)
+		send -= d.Connect
+	}
+	t.Send = harMillis(send)
+	t.Wait = harMillis(x.firstByte.Sub(x.sent))
+	t.Receive = harMillis(x.done.Sub(x.firstByte))
+
+	entry := &harEntry{
+		StartedDateTime: x.Timestamp.Format(time.RFC3339Nano),
+		Time:            harMillis(x.done.Sub(x.Timestamp)),
+		Timings:         t,
+		Request: harRequest{
+			Method:      x.Method,
+			URL:         harURL(x),
+			HTTPVersion: x.proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(x.RequestHeaders),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Status:      x.Status,
+			StatusText:  x.statusText,
+			HTTPVersion: x.respProto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(x.ResponseHeaders),
+			RedirectURL: x.ResponseHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    -1,
+			Content: harContent{
+				MimeType: x.ResponseHeaders.Get("Content-Type"),
+			},
+		},
+	}
+	if u, err := url.ParseRequestURI(x.URL); err == nil {
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: k, Value: v})
+			}
+		}
+	}
+	if !x.tunnel {
+		entry.Request.BodySize = x.reqBodySize
+		entry.Response.BodySize = x.respBodySize
+		entry.Response.Content.Size = x.respBodySize
+	}
+	if len(x.reqBody) > 0 {
+		entry.Request.PostData = &harPostData{
+			MimeType: x.RequestHeaders.Get("Content-Type"),
+			Text:     string(x.reqBody),
+		}
+	}
+	if len(x.respBody) > 0 {
+		if utf8.Valid(x.respBody) {
+			entry.Response.Content.Text = string(x.respBody)
+		} else {
+			entry.Response.Content.Text = base64.StdEncoding.EncodeToString(x.respBody)
+			entry.Response.Content.Encoding = "base64"
+		}
+	}
+	return entry
+}
+
+// harURL returns the absolute URL of the request, the URL of a proxy request is absolute,
+// the others are relative to the Host header.
+func harURL(x *httpExchange) string {
+	u, err := url.Parse(x.URL)
+	if err != nil || u.IsAbs() || x.tunnel {
+		return x.URL
+	}
+	if x.host == "" {
+		return x.URL
+	}
+	u.Scheme, u.Host = "http", x.host
+	return u.String()
+}
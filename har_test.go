@@ -0,0 +1,120 @@
+package gost
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type harTestFile struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+// waitHAREntries waits for the n entries written to the HAR file.
+func waitHAREntries(path string, n int) {
+	for i := 0; i < 100; i++ {
+		if b, _ := os.ReadFile(path); strings.Count(string(b), `"startedDateTime"`) >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHARExporter(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	path := filepath.Join(t.TempDir(), "test.har")
+	har := HARExporter(path, HARMaxBodySizeOption(4))
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: har.Handler(HTTPHandler())}
+	go server.Run()
+	defer server.Close()
+
+	proxyURL, _ := url.Parse("http://" + server.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	for _, body := range []string{"hello", "world"} {
+		resp, err := client.Post(httpSrv.URL+"/post?a=1", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	client.CloseIdleConnections()
+
+	waitHAREntries(path, 2)
+	if err := har.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f harTestFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatalf("invalid HAR file: %v\n%s", err, b)
+	}
+	if f.Log.Version != "1.2" || f.Log.Creator.Name != "gost" {
+		t.Errorf("unexpected log %+v", f.Log)
+	}
+	if len(f.Log.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(f.Log.Entries))
+	}
+
+	e := f.Log.Entries[0]
+	if e.Request.Method != http.MethodPost || e.Request.URL != httpSrv.URL+"/post?a=1" || e.Request.HTTPVersion != "HTTP/1.1" {
+		t.Errorf("unexpected request %+v", e.Request)
+	}
+	if len(e.Request.QueryString) != 1 || e.Request.QueryString[0] != (harNameValue{Name: "a", Value: "1"}) {
+		t.Errorf("unexpected query string %+v", e.Request.QueryString)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "hell" || e.Request.BodySize != 5 {
+		t.Errorf("unexpected request body %+v, size %d", e.Request.PostData, e.Request.BodySize)
+	}
+	if e.Response.Status != http.StatusOK || e.Response.StatusText != "OK" ||
+		e.Response.Content.Text != "hell" || e.Response.Content.Size != 5 {
+		t.Errorf("unexpected response %+v", e.Response)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, e.StartedDateTime); err != nil {
+		t.Error(err)
+	}
+	if e.Timings.Connect < 0 || e.Timings.Send < 0 || e.Timings.Wait < 0 || e.Timings.Receive < 0 {
+		t.Errorf("unexpected timings %+v", e.Timings)
+	}
+	// the connection to the target is reused by the second request.
+	if tm := f.Log.Entries[1].Timings; tm.Connect != -1 || tm.DNS != -1 {
+		t.Errorf("unexpected timings of the reused connection %+v", tm)
+	}
+}
+
+func TestHARExporterEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.har")
+	if err := HARExporter(path).Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	var f harTestFile
+	if err := json.Unmarshal(b, &f); err != nil || f.Log.Entries == nil || len(f.Log.Entries) != 0 {
+		t.Errorf("invalid HAR file %s: %v", b, err)
+	}
+
+	if err := HARExporter(filepath.Join(path, "invalid")).Close(); err == nil {
+		t.Error("the error of the file should be returned")
+	}
+}
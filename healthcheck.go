@@ -0,0 +1,94 @@
+package gost
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// healthCheckTimeout is the timeout of connecting to the upstream nodes for the health check.
+const healthCheckTimeout = 3 * time.Second
+
+type healthStatus struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+}
+
+// healthCheck responds to the request if it is a health check request, and reports whether it is.
+func (h *httpHandler) healthCheck(conn net.Conn, req *http.Request) bool {
+	path := h.options.HealthCheck
+	if path == "" || req.Method != http.MethodGet || req.URL.IsAbs() || req.URL.Path != path {
+		return false
+	}
+
+	status, code := healthStatus{Status: "ok", Version: Version}, http.StatusOK
+	if h.options.HealthCheckUpstream && !upstreamReachable(h.options.Chain) {
+		status.Status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	if Debug {
+		log.Logf("[http] %s - %s : health check %d", conn.RemoteAddr(), conn.LocalAddr(), code)
+	}
+
+	body, _ := json.Marshal(status)
+	resp := &http.Response{
+		StatusCode:    code,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Connection", "close")
+	resp.Write(conn)
+	return true
+}
+
+// upstreamReachable reports whether any node of the first hop of the chain can be connected
+// by the transport of the node, it is always true if the chain is empty.
+func upstreamReachable(chain *Chain) bool {
+	if chain.IsEmpty() {
+		return true
+	}
+	nodes := chain.NodeGroups()[0].Nodes()
+	if len(nodes) == 0 {
+		return true
+	}
+
+	ok := make(chan bool, len(nodes))
+	for _, node := range nodes {
+		go func(node Node) {
+			ok <- dialNode(node) == nil
+		}(node)
+	}
+	for range nodes {
+		if <-ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dialNode connects to the node and performs the handshake of the transport, the connection is closed.
+func dialNode(node Node) error {
+	dialOpts := append([]DialOption{TimeoutDialOption(healthCheckTimeout)}, node.DialOptions...)
+	conn, err := node.Client.Dial(node.Addr, dialOpts...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	handshakeOpts := append([]HandshakeOption{TimeoutHandshakeOption(healthCheckTimeout)}, node.HandshakeOptions...)
+	cc, err := node.Client.Handshake(conn, handshakeOpts...)
+	if err != nil {
+		return err
+	}
+	return cc.Close()
+}
@@ -0,0 +1,82 @@
+package gost
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func healthCheckRoundtrip(t *testing.T, opts ...HandlerOption) (int, healthStatus) {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = append(opts, UsersHandlerOption(url.UserPassword("admin", "123456")), WithHealthCheck("/healthz"))
+	server := &Server{Listener: ln, Handler: HTTPHandler(opts...)}
+	go server.Run()
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var status healthStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatalf("%s: %v", body, err)
+	}
+	return resp.StatusCode, status
+}
+
+func TestHTTPHealthCheck(t *testing.T) {
+	code, status := healthCheckRoundtrip(t)
+	if code != http.StatusOK || status.Status != "ok" || status.Version != Version {
+		t.Errorf("got %d %+v", code, status)
+	}
+
+	// the upstream is reachable.
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	chain := NewChain(Node{Addr: up.Addr().String(), Client: &Client{Transporter: TCPTransporter()}})
+	if code, _ := healthCheckRoundtrip(t, ChainHandlerOption(chain), WithHealthCheckUpstream(true)); code != http.StatusOK {
+		t.Errorf("got %d, want %d", code, http.StatusOK)
+	}
+
+	// the upstream is down.
+	addr := up.Addr().String()
+	up.Close()
+	chain = NewChain(Node{Addr: addr, Client: &Client{Transporter: TCPTransporter()}})
+	code, status = healthCheckRoundtrip(t, ChainHandlerOption(chain), WithHealthCheckUpstream(true))
+	if code != http.StatusServiceUnavailable || status.Status != "unavailable" {
+		t.Errorf("got %d %+v", code, status)
+	}
+}
+
+func TestHTTPHealthCheckProxy(t *testing.T) {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: HTTPHandler(UsersHandlerOption(url.UserPassword("admin", "123456")), WithHealthCheck("/healthz"))}
+	go server.Run()
+	defer server.Close()
+
+	// the proxy requests to the path are not intercepted.
+	proxyURL, _ := url.Parse("http://" + server.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get("http://www.example.com/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("got %d, want %d", resp.StatusCode, http.StatusProxyAuthRequired)
+	}
+}
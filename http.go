@@ -19,6 +19,17 @@ import (
 	"github.com/go-log/log"
 )
 
+func init() {
+	DefaultRegistry.RegisterProtocol("http", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return HTTPConnector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return HTTPHandler(), nil
+		},
+	}, "https")
+}
+
 type httpConnector struct {
 	User *url.Userinfo
 }
@@ -99,7 +110,7 @@ func (c *httpConnector) ConnectContext(ctx context.Context, conn net.Conn, netwo
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s", resp.Status)
+		return nil, proxyStatusError(resp)
 	}
 
 	return conn, nil
@@ -142,6 +153,9 @@ func (h *httpHandler) handleRequest(conn net.Conn, req *http.Request) {
 	if req == nil {
 		return
 	}
+	if h.healthCheck(conn, req) {
+		return
+	}
 
 	// try to get the actual host.
 	if v := req.Header.Get("Gost-Target"); v != "" {
@@ -169,6 +183,9 @@ func (h *httpHandler) handleRequest(conn net.Conn, req *http.Request) {
 
 	req.Header.Del("Gost-Target")
 
+	ctx, span := startProxySpan(h.options.TracerProvider, "http", conn, host, req.Header)
+	defer span.End()
+
 	resp := &http.Response{
 		ProtoMajor: 1,
 		ProtoMinor: 1,
@@ -227,6 +244,9 @@ func (h *httpHandler) handleRequest(conn net.Conn, req *http.Request) {
 	}
 
 	req.Header.Del("Proxy-Authorization")
+	if req.Method != http.MethodConnect {
+		injectTraceContext(ctx, req.Header)
+	}
 
 	retries := 1
 	if h.options.Chain != nil && h.options.Chain.Retries > 0 {
@@ -255,6 +275,7 @@ func (h *httpHandler) handleRequest(conn net.Conn, req *http.Request) {
 		}
 		fmt.Fprintf(&buf, "%s", host)
 		log.Log("[route]", buf.String())
+		setSpanRoute(span, route)
 
 		// forward http request
 		lastNode := route.LastNode()
@@ -269,18 +290,27 @@ func (h *httpHandler) handleRequest(conn net.Conn, req *http.Request) {
 			continue
 		}
 
+		dt := dialTrace{DNS: -1}
+		start := time.Now()
 		cc, err = route.Dial(host,
 			TimeoutChainOption(h.options.Timeout),
 			HostsChainOption(h.options.Hosts),
 			ResolverChainOption(h.options.Resolver),
+			dialTraceChainOption(&dt),
 		)
 		if err == nil {
+			dt.Connect = time.Since(start)
+			if dt.DNS > 0 {
+				dt.Connect -= dt.DNS
+			}
+			recordDialTrace(conn, &dt)
 			break
 		}
 		log.Logf("[http] %s -> %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
 	}
 
 	if err != nil {
+		setSpanError(span, err)
 		resp.StatusCode = http.StatusServiceUnavailable
 
 		if Debug {
@@ -359,6 +389,13 @@ func (h *httpHandler) authenticate(conn net.Conn, req *http.Request, resp *http.
 			conn.RemoteAddr(), conn.LocalAddr(), u, p)
 	}
 	if h.options.Authenticator == nil || h.options.Authenticator.Authenticate(u, p) {
+		if !h.options.TimeACL.Allow(u, time.Now()) {
+			log.Logf("[http] %s <- %s : user '%s' is not allowed at this time",
+				conn.RemoteAddr(), conn.LocalAddr(), u)
+			resp.StatusCode = http.StatusForbidden
+			resp.Write(conn)
+			return false
+		}
 		return true
 	}
 
@@ -23,6 +23,46 @@ import (
 	"golang.org/x/net/http2"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("http2", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			if browser := node.Get("browser"); browser != "" {
+				return BrowserH2Transporter(browser, opts.TLSConfig), nil
+			}
+			return HTTP2Transporter(opts.TLSConfig), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return HTTP2Listener(node.Addr, opts.TLSConfig)
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterTransport("h2", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return H2Transporter(opts.TLSConfig, node.Get("path")), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return H2Listener(node.Addr, opts.TLSConfig, node.Get("path"))
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterTransport("h2c", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return H2CTransporter(node.Get("path")), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return H2CListener(node.Addr, node.Get("path"))
+		},
+	})
+	DefaultRegistry.RegisterProtocol("http2", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return HTTP2Connector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return HTTP2Handler(), nil
+		},
+	})
+}
+
 type http2Connector struct {
 	User *url.Userinfo
 }
@@ -98,7 +138,7 @@ func (c *http2Connector) ConnectContext(ctx context.Context, conn net.Conn, netw
 
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, errors.New(resp.Status)
+		return nil, proxyStatusError(resp)
 	}
 	hc := &http2Conn{
 		r:      resp.Body,
@@ -284,7 +324,7 @@ func (tr *h2Transporter) Dial(addr string, options ...DialOption) (net.Conn, err
 
 	if resp.StatusCode != http.StatusOK {
 		resp.Body.Close()
-		return nil, errors.New(resp.Status)
+		return nil, proxyStatusError(resp)
 	}
 	conn := &http2Conn{
 		r:      resp.Body,
@@ -0,0 +1,419 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPLogFormat is the format of the HTTP logs.
+type HTTPLogFormat int
+
+const (
+	// HTTPLogJSON logs each request as a JSON object in a line.
+	HTTPLogJSON HTTPLogFormat = iota
+	// HTTPLogCombined logs each request in the Apache combined log format.
+	HTTPLogCombined
+)
+
+// HTTPLogOptions describes the options for HTTPLogMiddleware.
+type HTTPLogOptions struct {
+	Format HTTPLogFormat
+	// Headers includes the headers of the requests and the responses in the JSON logs,
+	// the combined format only includes the Referer and User-Agent headers.
+	Headers bool
+	// RedactAuthorization replaces the values of the Authorization and Proxy-Authorization headers in the logs.
+	RedactAuthorization bool
+}
+
+// HTTPLogEntry is the log of a HTTP request.
+type HTTPLogEntry struct {
+	Timestamp       time.Time   `json:"timestamp"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Status          int         `json:"status"`
+	RequestSize     int64       `json:"request_size"`
+	ResponseSize    int64       `json:"response_size"`
+	Duration        int64       `json:"duration"` // in milliseconds
+	ClientIP        string      `json:"client_ip"`
+	RequestHeaders  http.Header `json:"request_headers,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+}
+
+// httpExchange is a request and its response parsed by httpLogConn.
+type httpExchange struct {
+	HTTPLogEntry
+	user       string
+	tunnel     bool          // a CONNECT request
+	body       chan struct{} // closed when the request body is read
+	host       string
+	proto      string
+	respProto  string
+	statusText string
+	// the bodies are captured up to the max body size of the connection.
+	reqBody, respBody         []byte
+	reqBodySize, respBodySize int64
+	// the time when the request body is read, the response header is written, and the response is written.
+	sent, firstByte, done time.Time
+	// dial is the dialing to the target for the request, it is nil if the upstream connection is reused.
+	dial *dialTrace
+}
+
+// httpLogRedacted replaces the values of the authorization headers.
+const httpLogRedacted = "[REDACTED]"
+
+// httpLogQueueSize is the max number of the requests waiting for their responses on a connection.
+const httpLogQueueSize = 64
+
+// HTTPLogMiddleware creates a Middleware which logs the HTTP requests proxied by the wrapped handler to the logger.
+// The requests and the responses are parsed from the traffic of the connections, a request of the HTTP CONNECT method
+// is logged when the tunnel is closed, the sizes and the duration are of the whole connection.
+// The other protocols are passed to the wrapped handler without logging.
+func HTTPLogMiddleware(logger io.Writer, opts HTTPLogOptions) Middleware {
+	l := &httpLogger{w: logger, options: opts}
+	return func(h Handler) Handler {
+		return &httpLogHandler{handler: h, emit: l.log}
+	}
+}
+
+type httpLogger struct {
+	mux     sync.Mutex
+	w       io.Writer
+	options HTTPLogOptions
+}
+
+func (l *httpLogger) log(e *httpExchange) {
+	var line []byte
+	switch l.options.Format {
+	case HTTPLogCombined:
+		line = []byte(e.combined())
+	default:
+		if !l.options.Headers {
+			e.RequestHeaders, e.ResponseHeaders = nil, nil
+		} else if l.options.RedactAuthorization {
+			redactHeaders(e.RequestHeaders)
+			redactHeaders(e.ResponseHeaders)
+		}
+		line, _ = json.Marshal(&e.HTTPLogEntry)
+		line = append(line, '\n')
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.w.Write(line)
+}
+
+func redactHeaders(h http.Header) {
+	for _, k := range []string{"Authorization", "Proxy-Authorization"} {
+		if _, ok := h[k]; ok {
+			h.Set(k, httpLogRedacted)
+		}
+	}
+}
+
+// combined formats the entry in the Apache combined log format:
+// '%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"'.
+func (e *httpExchange) combined() string {
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	size := "-"
+	if e.ResponseSize > 0 {
+		size = strconv.FormatInt(e.ResponseSize, 10)
+	}
+	var referer, ua string
+	if e.RequestHeaders != nil {
+		referer, ua = e.RequestHeaders.Get("Referer"), e.RequestHeaders.Get("User-Agent")
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s HTTP/1.1\" %d %s %q %q\n",
+		dash(e.ClientIP), dash(e.user), e.Timestamp.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.URL, e.Status, size, dash(referer), dash(ua))
+}
+
+type httpLogHandler struct {
+	handler Handler
+	emit    func(e *httpExchange)
+	maxBody int64
+}
+
+func (h *httpLogHandler) Init(options ...HandlerOption) {
+	h.handler.Init(options...)
+}
+
+func (h *httpLogHandler) Handle(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	b, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	cc := &bufferdConn{Conn: conn, br: br}
+	if b[0] < 'A' || b[0] > 'Z' {
+		// not a HTTP request.
+		h.handler.Handle(cc)
+		return
+	}
+
+	lc := newHTTPLogConn(cc, h.emit, h.maxBody)
+	defer lc.finish()
+	h.handler.Handle(lc)
+}
+
+// httpLogConn parses the HTTP requests read from the connection and the responses written to it.
+// The data is passed to the parsers through the pipes, which are closed when the parsers stop
+// (e.g. the data is not HTTP or the tunnel is established).
+type httpLogConn struct {
+	net.Conn
+	emit     func(e *httpExchange)
+	maxBody  int64
+	clientIP string
+	reqW     *io.PipeWriter
+	respW    *io.PipeWriter
+	reqDone  int32
+	respDone int32
+	queue    chan *httpExchange
+	parsers  sync.WaitGroup
+	tunnel   *httpExchange // set by the response parser
+	in, out  int64
+	once     sync.Once
+	dialMux  sync.Mutex
+	dial     *dialTrace // the last dialing, taken by the next response
+}
+
+func newHTTPLogConn(conn net.Conn, emit func(e *httpExchange), maxBody int64) *httpLogConn {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	c := &httpLogConn{
+		Conn:    conn,
+		emit:    emit,
+		maxBody: maxBody,
+		reqW:    reqW,
+		respW:   respW,
+		queue:   make(chan *httpExchange, httpLogQueueSize),
+	}
+	c.clientIP = conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(c.clientIP); err == nil {
+		c.clientIP = host
+	}
+	c.parsers.Add(2)
+	go c.parseRequests(reqR)
+	go c.parseResponses(respR)
+	return c
+}
+
+func (c *httpLogConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddInt64(&c.in, int64(n))
+		if atomic.LoadInt32(&c.reqDone) == 0 {
+			c.reqW.Write(b[:n])
+		}
+	}
+	return
+}
+
+func (c *httpLogConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddInt64(&c.out, int64(n))
+		if atomic.LoadInt32(&c.respDone) == 0 {
+			c.respW.Write(b[:n])
+		}
+	}
+	return
+}
+
+func (c *httpLogConn) Close() error {
+	c.finish()
+	return c.Conn.Close()
+}
+
+// finish stops the parsers, and logs the tunnel if it is established.
+func (c *httpLogConn) finish() {
+	c.once.Do(func() {
+		c.reqW.Close()
+		c.respW.Close()
+		c.parsers.Wait()
+
+		if e := c.tunnel; e != nil {
+			e.RequestSize = atomic.LoadInt64(&c.in)
+			e.ResponseSize = atomic.LoadInt64(&c.out)
+			e.done = time.Now()
+			e.Duration = e.done.Sub(e.Timestamp).Milliseconds()
+			c.emit(e)
+		}
+	})
+}
+
+func (c *httpLogConn) recordDial(t *dialTrace) {
+	c.dialMux.Lock()
+	defer c.dialMux.Unlock()
+	c.dial = t
+}
+
+func (c *httpLogConn) takeDial() *dialTrace {
+	c.dialMux.Lock()
+	defer c.dialMux.Unlock()
+	t := c.dial
+	c.dial = nil
+	return t
+}
+
+func (c *httpLogConn) parseRequests(r *io.PipeReader) {
+	defer func() {
+		atomic.StoreInt32(&c.reqDone, 1)
+		r.Close()
+		close(c.queue)
+		c.parsers.Done()
+	}()
+
+	cr := &countReader{r: r}
+	br := bufio.NewReader(cr)
+	for {
+		start := cr.n - int64(br.Buffered())
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		e := &httpExchange{
+			HTTPLogEntry: HTTPLogEntry{
+				Timestamp:      time.Now(),
+				Method:         req.Method,
+				URL:            req.RequestURI,
+				ClientIP:       c.clientIP,
+				RequestHeaders: req.Header.Clone(),
+			},
+			tunnel: req.Method == http.MethodConnect,
+			body:   make(chan struct{}),
+			host:   req.Host,
+			proto:  req.Proto,
+		}
+		e.user, _, _ = basicProxyAuth(req.Header.Get("Proxy-Authorization"))
+		if e.user == "" {
+			e.user, _, _ = req.BasicAuth()
+		}
+		// the request is queued before the body is read, as the response may be sent before the body is received.
+		select {
+		case c.queue <- e:
+		default:
+			// too many requests are waiting for the responses, stop logging.
+			return
+		}
+		if e.tunnel {
+			e.RequestSize = cr.n - int64(br.Buffered()) - start
+			e.sent = time.Now()
+			close(e.body)
+			return
+		}
+
+		e.reqBody, e.reqBodySize, err = captureBody(req.Body, c.maxBody)
+		e.RequestSize = cr.n - int64(br.Buffered()) - start
+		e.sent = time.Now()
+		close(e.body)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *httpLogConn) parseResponses(r *io.PipeReader) {
+	defer func() {
+		atomic.StoreInt32(&c.respDone, 1)
+		r.Close()
+		for range c.queue {
+		}
+		c.parsers.Done()
+	}()
+
+	cr := &countReader{r: r}
+	br := bufio.NewReader(cr)
+	for e := range c.queue {
+		start := cr.n - int64(br.Buffered())
+		resp, err := http.ReadResponse(br, &http.Request{Method: e.Method})
+		if err != nil {
+			return
+		}
+		e.firstByte = time.Now()
+		e.Status = resp.StatusCode
+		e.ResponseHeaders = resp.Header.Clone()
+		e.respProto = resp.Proto
+		e.statusText = http.StatusText(resp.StatusCode)
+		if _, text, ok := strings.Cut(resp.Status, " "); ok {
+			e.statusText = text
+		}
+		e.dial = c.takeDial()
+
+		if e.tunnel && resp.StatusCode/100 == 2 {
+			c.tunnel = e
+			return
+		}
+
+		if e.respBody, e.respBodySize, err = captureBody(resp.Body, c.maxBody); err != nil {
+			return
+		}
+		e.ResponseSize = cr.n - int64(br.Buffered()) - start
+		e.done = time.Now()
+		e.Duration = e.done.Sub(e.Timestamp).Milliseconds()
+		<-e.body
+		c.emit(e)
+		if e.tunnel {
+			// the CONNECT request is rejected.
+			return
+		}
+	}
+}
+
+// captureBody reads the body, and returns the first max bytes of it and the size of it.
+func captureBody(r io.Reader, max int64) ([]byte, int64, error) {
+	var b bytes.Buffer
+	if max > 0 {
+		if n, err := io.CopyN(&b, r, max); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return b.Bytes(), n, err
+		}
+	}
+	n, err := io.Copy(io.Discard, r)
+	return b.Bytes(), int64(b.Len()) + n, err
+}
+
+// dialTrace is the timing of the dialing to the target of a request, DNS is -1 if the address is not resolved by gost.
+type dialTrace struct {
+	DNS     time.Duration
+	Connect time.Duration
+}
+
+// dialTraceRecorder is implemented by the connections which record the dialing of the handlers, e.g. httpLogConn.
+type dialTraceRecorder interface {
+	recordDial(t *dialTrace)
+}
+
+func recordDialTrace(conn net.Conn, t *dialTrace) {
+	if r, ok := conn.(dialTraceRecorder); ok {
+		r.recordDial(t)
+	}
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(b []byte) (n int, err error) {
+	n, err = r.r.Read(b)
+	r.n += int64(n)
+	return
+}
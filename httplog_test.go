@@ -0,0 +1,188 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+// waitLines waits for the n lines of the logs.
+func (b *syncBuffer) waitLines(n int) []string {
+	for i := 0; i < 100; i++ {
+		if s := b.String(); strings.Count(s, "\n") >= n {
+			return strings.Split(strings.TrimRight(s, "\n"), "\n")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+}
+
+func httpLogServer(t *testing.T, w io.Writer, opts HTTPLogOptions) *Server {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPLogMiddleware(w, opts)(HTTPHandler(UsersHandlerOption(url.UserPassword("alice", "123456")))),
+	}
+	go server.Run()
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestHTTPLogMiddleware(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	logs := &syncBuffer{}
+	server := httpLogServer(t, logs, HTTPLogOptions{Headers: true, RedactAuthorization: true})
+
+	proxyURL, _ := url.Parse("http://alice:123456@" + server.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Post(httpSrv.URL+"/post", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	client.CloseIdleConnections()
+
+	connector := HTTPConnector(url.UserPassword("alice", "123456"))
+	if err := proxyRoundtrip(&Client{Connector: connector, Transporter: TCPTransporter()}, server, httpSrv.URL, []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := logs.waitLines(2)
+	if len(lines) != 2 {
+		t.Fatalf("got %d logs, want 2: %q", len(lines), lines)
+	}
+	entries := make(map[string]HTTPLogEntry)
+	for _, line := range lines {
+		var e HTTPLogEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries[e.Method] = e
+	}
+
+	post := entries[http.MethodPost]
+	if post.URL != httpSrv.URL+"/post" || post.Status != http.StatusOK || post.ClientIP != "127.0.0.1" {
+		t.Errorf("unexpected log %+v", post)
+	}
+	if post.RequestSize <= int64(len("hello")) || post.ResponseSize <= int64(len("hello")) {
+		t.Errorf("unexpected sizes %d %d", post.RequestSize, post.ResponseSize)
+	}
+	if v := post.RequestHeaders.Get("Proxy-Authorization"); v != httpLogRedacted {
+		t.Errorf("Proxy-Authorization %q, want redacted", v)
+	}
+
+	connect := entries[http.MethodConnect]
+	if connect.Status != http.StatusOK || connect.URL != strings.TrimPrefix(httpSrv.URL, "http://") {
+		t.Errorf("unexpected log %+v", connect)
+	}
+	// the tunnel includes the HTTP request and response.
+	if connect.RequestSize <= int64(len("world")) || connect.ResponseSize <= int64(len("world")) {
+		t.Errorf("unexpected sizes %d %d", connect.RequestSize, connect.ResponseSize)
+	}
+}
+
+func TestHTTPLogMiddlewareCombined(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	logs := &syncBuffer{}
+	server := httpLogServer(t, logs, HTTPLogOptions{Format: HTTPLogCombined})
+
+	// the request is rejected without the credentials.
+	proxyURL, _ := url.Parse("http://" + server.Addr().String())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	req, _ := http.NewRequest(http.MethodGet, httpSrv.URL+"/get", nil)
+	req.Header.Set("User-Agent", "gost-test")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	lines := logs.waitLines(1)
+	want := `127.0.0.1 - - [`
+	if !strings.HasPrefix(lines[0], want) ||
+		!strings.Contains(lines[0], `"GET `+httpSrv.URL+`/get HTTP/1.1" 407 `) ||
+		!strings.HasSuffix(lines[0], `"-" "gost-test"`) {
+		t.Errorf("unexpected log %q", lines[0])
+	}
+}
+
+func TestGzipLogRotator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := GzipLogRotator(path, 1)
+
+	line := bytes.Repeat([]byte("x"), 1023)
+	line = append(line, '\n')
+	for i := 0; i < 1500; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 476*1024 {
+		t.Errorf("the size of the current file is %d, want %d", fi.Size(), 476*1024)
+	}
+	files, _ := filepath.Glob(path + ".*")
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".gz") {
+		t.Fatalf("unexpected rotated files %v", files)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for s := bufio.NewScanner(zr); s.Scan(); n++ {
+	}
+	if n != 1024 {
+		t.Errorf("%d lines rotated, want 1024", n)
+	}
+}
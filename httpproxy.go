@@ -0,0 +1,354 @@
+package gost
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	ntlmssp "github.com/Azure/go-ntlmssp"
+	"github.com/go-log/log"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// maxProxyAuthRounds is the max rounds of the connection-oriented proxy authentication.
+const maxProxyAuthRounds = 3
+
+// httpProxyAuth is a connection-oriented authentication scheme for HTTP proxy, such as NTLM.
+type httpProxyAuth interface {
+	// Scheme returns the scheme name used in the Proxy-Authorization and Proxy-Authenticate headers.
+	Scheme() string
+	// Token returns the token in response to the challenge from the proxy,
+	// the challenge is nil for the initial request.
+	Token(challenge []byte) ([]byte, error)
+}
+
+type ntlmAuth struct {
+	domain   string
+	user     string
+	password string
+}
+
+func (a *ntlmAuth) Scheme() string {
+	return "NTLM"
+}
+
+func (a *ntlmAuth) Token(challenge []byte) ([]byte, error) {
+	// the same as ntlmssp.Negotiator, the domain of the proxy is used unless the user is in UPN format.
+	user, domain, domainNeeded := ntlmssp.GetDomain(a.user)
+	if a.domain != "" {
+		domain = a.domain
+	}
+	if challenge == nil {
+		workstation, _ := os.Hostname()
+		return ntlmssp.NewNegotiateMessage(domain, workstation)
+	}
+	return ntlmssp.ProcessChallenge(challenge, user, a.password, domainNeeded)
+}
+
+// WithNTLMAuth specifies the NTLM credentials used by HTTPProxyTransporter.
+// The user can also be in the format of 'DOMAIN\user' or 'user@domain' (UPN).
+// The NTLM handshake is performed on the same connection before the tunnel is established.
+func WithNTLMAuth(domain, user, password string) TransporterOption {
+	return func(opts *TransporterOptions) {
+		opts.proxyAuth = &ntlmAuth{
+			domain:   domain,
+			user:     user,
+			password: password,
+		}
+	}
+}
+
+type kerberosAuth struct {
+	spn     string
+	tickets kerberosTicketSource
+}
+
+func (a *kerberosAuth) Scheme() string {
+	return "Negotiate"
+}
+
+// Token returns a fresh SPNEGO token for both the initial request and the re-challenge,
+// the challenge from the proxy is ignored.
+func (a *kerberosAuth) Token(challenge []byte) ([]byte, error) {
+	cl, tkt, key, err := a.tickets.ServiceTicket(a.spn)
+	if err != nil {
+		return nil, err
+	}
+	token, err := spnego.NewNegTokenInitKRB5(cl, tkt, key)
+	if err != nil {
+		return nil, err
+	}
+	ct := &spnego.SPNEGOToken{
+		Init:         true,
+		NegTokenInit: token,
+	}
+	return ct.Marshal()
+}
+
+// kerberosTicketSource provides the service ticket and the session key of the spn,
+// the credentials of the returned client are used to build the authenticator.
+type kerberosTicketSource interface {
+	ServiceTicket(spn string) (*client.Client, messages.Ticket, types.EncryptionKey, error)
+}
+
+// keytabTicketSource gets the service ticket from the KDC with the principal of the first keytab entry.
+type keytabTicketSource struct {
+	krb5Conf   string
+	keytabPath string
+	client     *client.Client
+	mux        sync.Mutex
+}
+
+func (s *keytabTicketSource) ServiceTicket(spn string) (*client.Client, messages.Ticket, types.EncryptionKey, error) {
+	cl, err := s.getClient()
+	if err != nil {
+		return nil, messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		return nil, messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return cl, tkt, key, nil
+}
+
+// getClient logins to the KDC with the principal of the first keytab entry.
+func (s *keytabTicketSource) getClient() (*client.Client, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	cfg, err := config.Load(s.krb5Conf)
+	if err != nil {
+		return nil, err
+	}
+	kt, err := keytab.Load(s.keytabPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(kt.Entries) == 0 {
+		return nil, fmt.Errorf("keytab %s: no entry", s.keytabPath)
+	}
+
+	p := kt.Entries[0].Principal
+	cl := client.NewWithKeytab(strings.Join(p.Components, "/"), p.Realm, kt, cfg,
+		client.DisablePAFXFAST(true))
+	if err := cl.Login(); err != nil {
+		return nil, err
+	}
+	s.client = cl
+	return cl, nil
+}
+
+// WithKerberosAuth specifies the Kerberos (SPNEGO) authentication used by HTTPProxyTransporter.
+// krb5Conf is the path of krb5.conf, keytabPath is the path of the keytab file,
+// the principal of the first entry in the keytab is used as the client.
+// spn is the service principal name of the HTTP proxy, such as 'HTTP/proxy.example.com'.
+func WithKerberosAuth(krb5Conf, keytabPath, spn string) TransporterOption {
+	return func(opts *TransporterOptions) {
+		opts.proxyAuth = &kerberosAuth{
+			spn: spn,
+			tickets: &keytabTicketSource{
+				krb5Conf:   krb5Conf,
+				keytabPath: keytabPath,
+			},
+		}
+	}
+}
+
+// WithHTTPConnectHeaders adds the headers to the CONNECT request sent by HTTPProxyTransporter,
+// such as X-Forwarded-For or the token required by the proxy.
+// The headers of multiple WithHTTPConnectHeaders options are accumulated.
+func WithHTTPConnectHeaders(headers http.Header) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		if opts.ConnectHeader == nil {
+			opts.ConnectHeader = make(http.Header)
+		}
+		for k, vs := range headers {
+			for _, v := range vs {
+				opts.ConnectHeader.Add(k, v)
+			}
+		}
+	}
+}
+
+type httpProxyTransporter struct {
+	proxyAddr string
+	user      *url.Userinfo
+	options   *TransporterOptions
+}
+
+// HTTPProxyTransporter creates a Transporter that reaches the proxy server through an existing HTTP proxy
+// (e.g. the corporate proxy) at proxyAddr by using the HTTP CONNECT method.
+// The proxyUser and proxyPass are used for HTTP Basic Authentication if proxyUser is not empty.
+func HTTPProxyTransporter(proxyAddr, proxyUser, proxyPass string, opts ...TransporterOption) Transporter {
+	tr := &httpProxyTransporter{
+		proxyAddr: proxyAddr,
+		options:   &TransporterOptions{},
+	}
+	if proxyUser != "" {
+		tr.user = url.UserPassword(proxyUser, proxyPass)
+	}
+	for _, opt := range opts {
+		opt(tr.options)
+	}
+	return tr
+}
+
+// Dial connects to the HTTP proxy, the addr is ignored.
+func (tr *httpProxyTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	if opts.Chain == nil {
+		return net.DialTimeout("tcp", tr.proxyAddr, timeout)
+	}
+	return opts.Chain.Dial(tr.proxyAddr)
+}
+
+// Handshake establishes a tunnel to the proxy server specified by the AddrHandshakeOption via the HTTP proxy.
+func (tr *httpProxyTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	auth := tr.options.proxyAuth
+
+	var token []byte
+	if auth != nil {
+		var err error
+		if token, err = auth.Token(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	br := bufio.NewReader(conn)
+	for i := 0; i < maxProxyAuthRounds; i++ {
+		req := &http.Request{
+			Method:     http.MethodConnect,
+			URL:        &url.URL{Host: opts.Addr},
+			Host:       opts.Addr,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+		}
+		req.Header.Set("User-Agent", DefaultUserAgent)
+		// the custom headers override the default User-Agent, but not the headers required by the tunnel.
+		for k, v := range opts.ConnectHeader {
+			req.Header[k] = v
+		}
+		req.Header.Set("Proxy-Connection", "keep-alive")
+
+		if auth != nil {
+			req.Header.Set("Proxy-Authorization",
+				auth.Scheme()+" "+base64.StdEncoding.EncodeToString(token))
+		} else if tr.user != nil {
+			u := tr.user.Username()
+			p, _ := tr.user.Password()
+			req.Header.Set("Proxy-Authorization",
+				"Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+p)))
+		}
+
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+
+		if Debug {
+			dump, _ := httputil.DumpRequest(req, false)
+			log.Logf("[httpproxy] %s -> %s\n%s", conn.LocalAddr(), tr.proxyAddr, string(dump))
+		}
+
+		// the response can be HTTP/1.0 or HTTP/1.1.
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			// drain the body to keep the connection for the next round.
+			io.Copy(io.Discard, resp.Body)
+		}
+		resp.Body.Close()
+
+		if Debug {
+			dump, _ := httputil.DumpResponse(resp, false)
+			log.Logf("[httpproxy] %s <- %s\n%s", conn.LocalAddr(), tr.proxyAddr, string(dump))
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			if br.Buffered() > 0 {
+				return &bufferdConn{Conn: conn, br: br}, nil
+			}
+			return conn, nil
+		}
+
+		if resp.StatusCode != http.StatusProxyAuthRequired || auth == nil || resp.Close {
+			return nil, proxyStatusError(resp)
+		}
+
+		challenge, ok := proxyAuthChallenge(resp.Header, auth.Scheme())
+		if !ok {
+			return nil, proxyStatusError(resp)
+		}
+		if token, err = auth.Token(challenge); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("httpproxy: too many authentication rounds")
+}
+
+func (tr *httpProxyTransporter) Multiplex() bool {
+	return false
+}
+
+// proxyAuthChallenge finds the challenge data of the scheme in the Proxy-Authenticate headers.
+// ok is false if the proxy does not supports the scheme.
+func proxyAuthChallenge(header http.Header, scheme string) (challenge []byte, ok bool) {
+	for _, v := range header.Values("Proxy-Authenticate") {
+		ss := strings.SplitN(strings.TrimSpace(v), " ", 2)
+		if !strings.EqualFold(ss[0], scheme) {
+			continue
+		}
+		if len(ss) == 1 {
+			return []byte{}, true
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ss[1]))
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	}
+	return nil, false
+}
@@ -0,0 +1,528 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"golang.org/x/crypto/md4"
+)
+
+// connectProxyServer is a minimal HTTP proxy that only supports the CONNECT method.
+func connectProxyServer(t *testing.T, proto string, user, pass string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				if u, p, _ := basicProxyAuth(req.Header.Get("Proxy-Authorization")); u != user || p != pass {
+					fmt.Fprintf(conn, "%s 407 Proxy Authentication Required\r\n\r\n", proto)
+					return
+				}
+				cc, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					fmt.Fprintf(conn, "%s 502 Bad Gateway\r\n\r\n", proto)
+					return
+				}
+				defer cc.Close()
+
+				fmt.Fprintf(conn, "%s 200 Connection established\r\n\r\n", proto)
+				transport(conn, cc)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestHTTPProxyTransporter(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	tests := []struct {
+		proto              string
+		srvUser, srvPass   string
+		proxyUser, proxyPw string
+		ok                 bool
+	}{
+		{"HTTP/1.1", "", "", "", "", true},
+		{"HTTP/1.0", "", "", "", "", true},
+		{"HTTP/1.1", "admin", "123456", "admin", "123456", true},
+		{"HTTP/1.0", "admin", "123456", "admin", "123456", true},
+		{"HTTP/1.1", "admin", "123456", "admin", "654321", false},
+		{"HTTP/1.1", "admin", "123456", "", "", false},
+	}
+
+	for i, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("#%d", i), func(t *testing.T) {
+			proxy := connectProxyServer(t, tc.proto, tc.srvUser, tc.srvPass)
+			defer proxy.Close()
+
+			ln, err := TCPListener("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &Server{
+				Listener: ln,
+				Handler:  HTTPHandler(),
+			}
+			go server.Run()
+			defer server.Close()
+
+			client := &Client{
+				Connector:   HTTPConnector(nil),
+				Transporter: HTTPProxyTransporter(proxy.Addr().String(), tc.proxyUser, tc.proxyPw),
+			}
+			err = proxyRoundtrip(client, server, httpSrv.URL, sendData)
+			if tc.ok && err != nil {
+				t.Error(err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("should failed")
+			}
+		})
+	}
+
+}
+
+// ntlmProxyServer is a mock HTTP proxy that simulates the NTLM handshake,
+// it verifies the NTLMv2 response of the AUTHENTICATE message with the password.
+func ntlmProxyServer(t *testing.T, password string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const domain = "CORP"
+	serverChallenge := []byte("12345678")
+
+	// the CHALLENGE message with NTLMSSP_NEGOTIATE_UNICODE, NTLMSSP_REQUEST_TARGET and NTLMSSP_NEGOTIATE_NTLM flags.
+	target := ntlmUnicode(domain)
+	challenge := make([]byte, 48, 48+len(target))
+	copy(challenge, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint16(challenge[12:], uint16(len(target)))
+	binary.LittleEndian.PutUint16(challenge[14:], uint16(len(target)))
+	binary.LittleEndian.PutUint32(challenge[16:], 48)
+	binary.LittleEndian.PutUint32(challenge[20:], 0x00000205)
+	copy(challenge[24:], serverChallenge)
+	challenge = append(challenge, target...)
+
+	ntlmMessage := func(req *http.Request) (int, []byte) {
+		s := strings.TrimPrefix(req.Header.Get("Proxy-Authorization"), "NTLM ")
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil || len(b) < 12 || string(b[:8]) != "NTLMSSP\x00" {
+			return 0, nil
+		}
+		return int(binary.LittleEndian.Uint32(b[8:])), b
+	}
+
+	verify := func(msg []byte) bool {
+		field := func(off int) []byte {
+			if len(msg) < off+8 {
+				return nil
+			}
+			n := int(binary.LittleEndian.Uint16(msg[off:]))
+			p := int(binary.LittleEndian.Uint32(msg[off+4:]))
+			if p+n > len(msg) {
+				return nil
+			}
+			return msg[p : p+n]
+		}
+		ntResponse, targetName, userName := field(20), field(28), field(36)
+		if len(ntResponse) <= 16 || len(userName) == 0 {
+			return false
+		}
+		// the domain of the proxy is used unless the user is in UPN format.
+		user := ntlmString(userName)
+		if strings.Contains(user, "@") != (len(targetName) == 0) ||
+			len(targetName) > 0 && ntlmString(targetName) != domain {
+			return false
+		}
+
+		h := md4.New()
+		h.Write(ntlmUnicode(password))
+		mac := hmac.New(md5.New, h.Sum(nil))
+		mac.Write(ntlmUnicode(strings.ToUpper(user) + ntlmString(targetName)))
+		mac = hmac.New(md5.New, mac.Sum(nil))
+		mac.Write(serverChallenge)
+		mac.Write(ntResponse[16:])
+		return hmac.Equal(mac.Sum(nil), ntResponse[:16])
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				br := bufio.NewReader(conn)
+				for step := 1; ; step++ {
+					req, err := http.ReadRequest(br)
+					if err != nil || req.Method != http.MethodConnect {
+						return
+					}
+					switch typ, msg := ntlmMessage(req); {
+					case step == 1 && typ == 1:
+						fmt.Fprintf(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+							"Proxy-Authenticate: NTLM %s\r\nContent-Length: 0\r\n\r\n",
+							base64.StdEncoding.EncodeToString(challenge))
+					case step == 2 && typ == 3 && verify(msg):
+						cc, err := net.Dial("tcp", req.Host)
+						if err != nil {
+							return
+						}
+						defer cc.Close()
+						fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+						transport(&bufferdConn{Conn: conn, br: br}, cc)
+						return
+					default:
+						fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+							"Proxy-Authenticate: NTLM\r\nContent-Length: 0\r\n\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func ntlmUnicode(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, r := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], r)
+	}
+	return b
+}
+
+func ntlmString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+func TestHTTPProxyTransporterNTLM(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	proxy := ntlmProxyServer(t, "123456")
+	defer proxy.Close()
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	var tests = []struct {
+		domain, user, password string
+		pass                   bool
+	}{
+		{"CORP", "admin", "123456", true},
+		{"", "admin", "123456", true},
+		{"", `CORP\admin`, "123456", true},
+		{"", "admin@corp.local", "123456", true},
+		{"CORP", "admin", "654321", false},
+		{"", "admin@corp.local", "654321", false},
+	}
+	for i, tc := range tests {
+		client := &Client{
+			Connector: HTTPConnector(nil),
+			Transporter: HTTPProxyTransporter(proxy.Addr().String(), "", "",
+				WithNTLMAuth(tc.domain, tc.user, tc.password)),
+		}
+		err := proxyRoundtrip(client, server, httpSrv.URL, sendData)
+		if tc.pass && err != nil {
+			t.Errorf("#%d %s: %v", i, tc.user, err)
+		}
+		if !tc.pass && err == nil {
+			t.Errorf("#%d %s: should failed", i, tc.user)
+		}
+	}
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: HTTPProxyTransporter(proxy.Addr().String(), "admin", "123456"),
+	}
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err == nil {
+		t.Error("should failed without NTLM")
+	}
+}
+
+// negotiateProxyServer is a mock HTTP proxy that simulates the SPNEGO exchange,
+// it re-challenges the first Negotiate token on each connection, and accepts the second one
+// if its AP-REQ authenticator can be decrypted with the session key and the client is cname.
+func negotiateProxyServer(t *testing.T, sessionKey types.EncryptionKey, cname string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(req *http.Request) bool {
+		s := strings.TrimPrefix(req.Header.Get("Proxy-Authorization"), "Negotiate ")
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return false
+		}
+		var token spnego.SPNEGOToken
+		if err := token.Unmarshal(b); err != nil || !token.Init {
+			return false
+		}
+		if len(token.NegTokenInit.MechTypes) == 0 ||
+			!token.NegTokenInit.MechTypes[0].Equal(gssapi.OIDKRB5.OID()) {
+			return false
+		}
+		var mt spnego.KRB5Token
+		if err := mt.Unmarshal(token.NegTokenInit.MechTokenBytes); err != nil || !mt.IsAPReq() {
+			return false
+		}
+		if err := mt.APReq.DecryptAuthenticator(sessionKey); err != nil {
+			return false
+		}
+		return mt.APReq.Authenticator.CName.PrincipalNameString() == cname
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				br := bufio.NewReader(conn)
+				for step := 1; ; step++ {
+					req, err := http.ReadRequest(br)
+					if err != nil || req.Method != http.MethodConnect {
+						return
+					}
+					if step == 1 || !verify(req) {
+						fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+							"Proxy-Authenticate: Negotiate\r\nContent-Length: 0\r\n\r\n")
+						continue
+					}
+
+					cc, err := net.Dial("tcp", req.Host)
+					if err != nil {
+						return
+					}
+					defer cc.Close()
+					fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+					transport(&bufferdConn{Conn: conn, br: br}, cc)
+					return
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// staticTicketSource issues a fake service ticket with the session key without the KDC.
+type staticTicketSource struct {
+	client *krbclient.Client
+	key    types.EncryptionKey
+	n      int
+}
+
+func (s *staticTicketSource) ServiceTicket(spn string) (*krbclient.Client, messages.Ticket, types.EncryptionKey, error) {
+	s.n++
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+	tkt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  s.client.Credentials.Realm(),
+		SName:  sname,
+		EncPart: types.EncryptedData{
+			EType:  s.key.KeyType,
+			Cipher: []byte("ticket"),
+		},
+	}
+	return s.client, tkt, s.key, nil
+}
+
+func TestHTTPProxyTransporterKerberos(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	key := types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: make([]byte, 32),
+	}
+	rand.Read(key.KeyValue)
+
+	proxy := negotiateProxyServer(t, key, "admin")
+	defer proxy.Close()
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	tickets := &staticTicketSource{
+		client: krbclient.NewWithPassword("admin", "EXAMPLE.COM", "123456", config.New()),
+		key:    key,
+	}
+	fakeAuth := func(opts *TransporterOptions) {
+		opts.proxyAuth = &kerberosAuth{
+			spn:     "HTTP/proxy.example.com",
+			tickets: tickets,
+		}
+	}
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: HTTPProxyTransporter(proxy.Addr().String(), "", "", fakeAuth),
+	}
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+		t.Error(err)
+	}
+	if tickets.n != 2 {
+		t.Errorf("got %d tokens, want 2", tickets.n)
+	}
+
+	// the token is not accepted with another session key.
+	tickets.key.KeyValue = make([]byte, 32)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err == nil {
+		t.Error("should failed with invalid session key")
+	}
+
+	client.Transporter = HTTPProxyTransporter(proxy.Addr().String(), "", "",
+		WithKerberosAuth("testdata/nonexistent/krb5.conf", "testdata/nonexistent/krb5.keytab", "HTTP/proxy.example.com"))
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err == nil {
+		t.Error("should failed with invalid kerberos config")
+	}
+}
+
+func TestHTTPProxyTransporterConnectHeaders(t *testing.T) {
+	echo := echoTestServer(t)
+	defer echo.Close()
+
+	headers := make(chan http.Header, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		headers <- r.Header
+
+		cc, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer cc.Close()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		transport(conn, cc)
+	}))
+	defer proxy.Close()
+
+	tr := HTTPProxyTransporter(proxy.Listener.Addr().String(), "admin", "123456")
+	conn, err := tr.Dial("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn, err = tr.Handshake(conn,
+		AddrHandshakeOption(echo.Addr().String()),
+		WithHTTPConnectHeaders(http.Header{
+			"X-Forwarded-For": {"192.0.2.1"},
+			"user-agent":      {"custom"},
+		}),
+		WithHTTPConnectHeaders(http.Header{
+			"X-Forwarded-For":     {"192.0.2.2"},
+			"X-Token":             {"secret"},
+			"Proxy-Authorization": {"Basic invalid"},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := <-headers
+	if v := h.Values("X-Forwarded-For"); len(v) != 2 || v[0] != "192.0.2.1" || v[1] != "192.0.2.2" {
+		t.Errorf("X-Forwarded-For: got %v", v)
+	}
+	if v := h.Get("X-Token"); v != "secret" {
+		t.Errorf("X-Token: got %s", v)
+	}
+	if v := h.Get("User-Agent"); v != "custom" {
+		t.Errorf("User-Agent: got %s", v)
+	}
+	// the required headers are not overridden.
+	if v := h.Get("Proxy-Authorization"); v != "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:123456")) {
+		t.Errorf("Proxy-Authorization: got %s", v)
+	}
+
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hello" {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
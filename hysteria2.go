@@ -0,0 +1,956 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	quic "github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"golang.org/x/net/http2/hpack"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("hysteria2", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return Hysteria2Transporter(node.Addr, hysteria2Password(node.User), opts.TLSConfig, hysteria2Bandwidth(node)), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return Hysteria2Listener(node.Addr, hysteria2Password(node.User), opts.TLSConfig, hysteria2Bandwidth(node))
+		},
+		TLS: true,
+	}, "hy2")
+	DefaultRegistry.RegisterProtocol("hysteria2", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return Hysteria2Connector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return Hysteria2Handler(), nil
+		},
+	}, "hy2")
+}
+
+// hysteria2Password returns the password of the hysteria2 node, the user:pass form is used
+// for the userpass authentication, and the password only form is used otherwise.
+func hysteria2Password(user *url.Userinfo) string {
+	if user == nil {
+		return ""
+	}
+	if pass, ok := user.Password(); ok {
+		return user.Username() + ":" + pass
+	}
+	return user.Username()
+}
+
+// hysteria2Bandwidth returns the bandwidth of the node parameters up and down in Mbps.
+func hysteria2Bandwidth(node Node) Hysteria2Option {
+	const mbps = 1000 * 1000 / 8
+	return WithHysteria2Bandwidth(uint64(node.GetInt("up"))*mbps, uint64(node.GetInt("down"))*mbps)
+}
+
+const (
+	hysteria2TCPRequest   = 0x401
+	hysteria2StatusAuthOK = 233
+	hysteria2StatusOK     = 0x00
+	hysteria2StatusError  = 0x01
+
+	// hysteria2MaxAddrLen and hysteria2MaxMsgLen limit the variable length fields of the TCP request and response.
+	hysteria2MaxAddrLen    = 2048
+	hysteria2MaxMsgLen     = 2048
+	hysteria2MaxPaddingLen = 4096
+
+	h3FrameHeaders  = 0x01
+	h3FrameSettings = 0x04
+	h3StreamControl = 0x00
+	h3MaxFrameSize  = 64 * 1024
+)
+
+var (
+	errHysteria2Auth = errors.New("hysteria2: authentication failed")
+)
+
+// Hysteria2Option allows a common way to set the options of Hysteria2Transporter and Hysteria2Listener.
+type Hysteria2Option func(opts *hysteria2Options)
+
+type hysteria2Options struct {
+	up   uint64 // bytes per second
+	down uint64
+}
+
+// WithHysteria2Bandwidth specifies the max sending (up) and receiving (down) rates in bytes per second, 0 is unlimited.
+// The receiving rate is sent to the peer in the handshake, and the sending rate is limited to the
+// min of up and the receiving rate of the peer.
+func WithHysteria2Bandwidth(up, down uint64) Hysteria2Option {
+	return func(opts *hysteria2Options) {
+		opts.up = up
+		opts.down = down
+	}
+}
+
+// bandwidthLimiter paces the writes to the rate in bytes per second.
+type bandwidthLimiter struct {
+	rate uint64
+	next time.Time
+	mux  sync.Mutex
+}
+
+func newBandwidthLimiter(up, peerRx uint64) *bandwidthLimiter {
+	rate := up
+	if rate == 0 || (peerRx > 0 && peerRx < rate) {
+		rate = peerRx
+	}
+	if rate == 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: rate}
+}
+
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(uint64(n) * uint64(time.Second) / l.rate))
+	l.mux.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+type hysteria2Conn struct {
+	quic.Stream
+	laddr   net.Addr
+	raddr   net.Addr
+	limiter *bandwidthLimiter
+}
+
+func (c *hysteria2Conn) Write(b []byte) (n int, err error) {
+	if c.limiter == nil {
+		return c.Stream.Write(b)
+	}
+	// the data is paced in small chunks to keep the rate smooth.
+	for n < len(b) {
+		p := b[n:]
+		if len(p) > 16*1024 {
+			p = p[:16*1024]
+		}
+		c.limiter.wait(len(p))
+		nn, err := c.Stream.Write(p)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return
+}
+
+func (c *hysteria2Conn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *hysteria2Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+type hysteria2Session struct {
+	conn    quic.Connection
+	pc      net.PacketConn
+	limiter *bandwidthLimiter
+}
+
+func (s *hysteria2Session) GetConn() (net.Conn, error) {
+	stream, err := s.conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &hysteria2Conn{
+		Stream:  stream,
+		laddr:   s.conn.LocalAddr(),
+		raddr:   s.conn.RemoteAddr(),
+		limiter: s.limiter,
+	}, nil
+}
+
+func (s *hysteria2Session) Close() error {
+	s.conn.CloseWithError(0, "")
+	return s.pc.Close()
+}
+
+type hysteria2Transporter struct {
+	addr      string
+	password  string
+	tlsConfig *tls.Config
+	options   hysteria2Options
+
+	session *hysteria2Session
+	mux     sync.Mutex
+}
+
+// Hysteria2Transporter creates a Transporter of the Hysteria2 server at addr, which is a QUIC proxy protocol
+// optimized for the unstable networks. The QUIC connection is authenticated by the password in the HTTP/3
+// request of the first stream, then each connection is a stream of the QUIC connection,
+// use it with Hysteria2Connector to request the TCP relay.
+//
+// The certificate of the server is not verified if tlsConfig is nil.
+func Hysteria2Transporter(addr, password string, tlsConfig *tls.Config, opts ...Hysteria2Option) Transporter {
+	tr := &hysteria2Transporter{
+		addr:      addr,
+		password:  password,
+		tlsConfig: tlsConfig,
+	}
+	for _, opt := range opts {
+		opt(&tr.options)
+	}
+	return tr
+}
+
+func (tr *hysteria2Transporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	if tr.addr != "" {
+		addr = tr.addr
+	}
+
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.session != nil && tr.session.conn.Context().Err() != nil {
+		tr.session.Close()
+		tr.session = nil
+	}
+	if tr.session == nil {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = DialTimeout
+		}
+		session, err := tr.initSession(addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		tr.session = session
+	}
+
+	conn, err := tr.session.GetConn()
+	if err != nil {
+		tr.session.Close()
+		tr.session = nil
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (tr *hysteria2Transporter) initSession(addr string, timeout time.Duration) (*hysteria2Session, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := tr.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := quic.Dial(ctx, pc, udpAddr, tlsConfig, &quic.Config{
+		HandshakeIdleTimeout: timeout,
+		KeepAlivePeriod:      10 * time.Second,
+	})
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	peerRx, err := tr.auth(ctx, conn)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		pc.Close()
+		return nil, err
+	}
+	if Debug {
+		log.Logf("[hysteria2] %s -> %s : authenticated, rx %d", conn.LocalAddr(), addr, peerRx)
+	}
+	return &hysteria2Session{
+		conn:    conn,
+		pc:      pc,
+		limiter: newBandwidthLimiter(tr.options.up, peerRx),
+	}, nil
+}
+
+// auth sends the HTTP/3 authentication request, and returns the receiving rate of the server.
+func (tr *hysteria2Transporter) auth(ctx context.Context, conn quic.Connection) (uint64, error) {
+	if err := h3OpenControlStream(conn); err != nil {
+		return 0, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.CancelRead(0)
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	headers := [][2]string{
+		{":method", "POST"},
+		{":scheme", "https"},
+		{":authority", "hysteria"},
+		{":path", "/auth"},
+		{"hysteria-auth", tr.password},
+		{"hysteria-cc-rx", strconv.FormatUint(tr.options.down, 10)},
+		{"hysteria-padding", hysteria2Padding()},
+	}
+	if err := writeH3Frame(stream, h3FrameHeaders, qpackEncode(headers)); err != nil {
+		return 0, err
+	}
+	stream.Close()
+
+	resp, err := readH3Headers(bufio.NewReader(stream))
+	if err != nil {
+		return 0, err
+	}
+	if status := resp[":status"]; status != strconv.Itoa(hysteria2StatusAuthOK) {
+		return 0, fmt.Errorf("%w: status %s", errHysteria2Auth, status)
+	}
+	rx, _ := strconv.ParseUint(resp["hysteria-cc-rx"], 10, 64) // "auto" is unlimited
+	return rx, nil
+}
+
+func (tr *hysteria2Transporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *hysteria2Transporter) Multiplex() bool {
+	return true
+}
+
+type hysteria2Connector struct{}
+
+// Hysteria2Connector creates a Connector that requests the TCP relay to the address by the stream of Hysteria2Transporter.
+func Hysteria2Connector() Connector {
+	return &hysteria2Connector{}
+}
+
+func (c *hysteria2Connector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *hysteria2Connector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%s unsupported", network)
+	}
+
+	opts := &ConnectOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = ConnectTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	padding := hysteria2Padding()
+	b := quicvarint.Append(nil, hysteria2TCPRequest)
+	b = quicvarint.Append(b, uint64(len(address)))
+	b = append(b, address...)
+	b = quicvarint.Append(b, uint64(len(padding)))
+	b = append(b, padding...)
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	status, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := readHysteria2Field(br, hysteria2MaxMsgLen)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readHysteria2Field(br, hysteria2MaxPaddingLen); err != nil {
+		return nil, err
+	}
+	if status != hysteria2StatusOK {
+		return nil, fmt.Errorf("hysteria2: %s", msg)
+	}
+	if br.Buffered() > 0 {
+		return &bufferdConn{Conn: conn, br: br}, nil
+	}
+	return conn, nil
+}
+
+type hysteria2Handler struct {
+	options *HandlerOptions
+}
+
+// Hysteria2Handler creates a server Handler for the TCP relay requests of the connections of Hysteria2Listener.
+func Hysteria2Handler(opts ...HandlerOption) Handler {
+	h := &hysteria2Handler{}
+	h.Init(opts...)
+	return h
+}
+
+func (h *hysteria2Handler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *hysteria2Handler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+	br := bufio.NewReader(conn)
+	typ, err := quicvarint.Read(br)
+	if err != nil {
+		log.Logf("[hysteria2] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	if typ != hysteria2TCPRequest {
+		log.Logf("[hysteria2] %s - %s : unknown request %#x", conn.RemoteAddr(), conn.LocalAddr(), typ)
+		return
+	}
+	addr, err := readHysteria2Field(br, hysteria2MaxAddrLen)
+	if err == nil {
+		_, err = readHysteria2Field(br, hysteria2MaxPaddingLen)
+	}
+	if err != nil {
+		log.Logf("[hysteria2] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	host := string(addr)
+	log.Logf("[hysteria2] %s -> %s", conn.RemoteAddr(), host)
+
+	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) {
+		log.Logf("[hysteria2] %s - %s : Unauthorized to tcp connect to %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		writeHysteria2Response(conn, hysteria2StatusError, "unauthorized")
+		return
+	}
+	if h.options.Bypass.Contains(host) {
+		log.Logf("[hysteria2] %s - %s : Bypass %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		writeHysteria2Response(conn, hysteria2StatusError, "bypass")
+		return
+	}
+
+	cc, err := h.options.Chain.DialContext(context.Background(),
+		"tcp", host,
+		RetryChainOption(h.options.Retries),
+		TimeoutChainOption(h.options.Timeout),
+		HostsChainOption(h.options.Hosts),
+		ResolverChainOption(h.options.Resolver),
+	)
+	if err != nil {
+		log.Logf("[hysteria2] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		writeHysteria2Response(conn, hysteria2StatusError, err.Error())
+		return
+	}
+	defer cc.Close()
+
+	if err := writeHysteria2Response(conn, hysteria2StatusOK, ""); err != nil {
+		log.Logf("[hysteria2] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		return
+	}
+	if br.Buffered() > 0 {
+		conn = &bufferdConn{Conn: conn, br: br}
+	}
+
+	log.Logf("[hysteria2] %s <-> %s", conn.RemoteAddr(), host)
+	transport(conn, cc)
+	log.Logf("[hysteria2] %s >-< %s", conn.RemoteAddr(), host)
+}
+
+func writeHysteria2Response(w io.Writer, status byte, msg string) error {
+	padding := hysteria2Padding()
+	b := []byte{status}
+	b = quicvarint.Append(b, uint64(len(msg)))
+	b = append(b, msg...)
+	b = quicvarint.Append(b, uint64(len(padding)))
+	b = append(b, padding...)
+	_, err := w.Write(b)
+	return err
+}
+
+// readHysteria2Field reads a varint length-prefixed field.
+func readHysteria2Field(br *bufio.Reader, max int) ([]byte, error) {
+	n, err := quicvarint.Read(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(max) {
+		return nil, fmt.Errorf("hysteria2: field too long (%d)", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(br, b)
+	return b, err
+}
+
+// hysteria2Padding returns the random padding of 64-511 bytes.
+func hysteria2Padding() string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	n, _ := rand.Int(rand.Reader, big.NewInt(448))
+	b := make([]byte, 64+n.Int64())
+	rand.Read(b)
+	for i := range b {
+		b[i] = letters[int(b[i])%len(letters)]
+	}
+	return string(b)
+}
+
+type hysteria2Listener struct {
+	ln       *quic.Listener
+	password string
+	options  hysteria2Options
+	connChan chan net.Conn
+	errChan  chan error
+}
+
+// Hysteria2Listener creates a Listener for Hysteria2 proxy server, the QUIC connections are authenticated by
+// the password, then each stream of the connections is accepted, use it with Hysteria2Handler.
+// The failed authentication is replied with 404 as a HTTP/3 server.
+func Hysteria2Listener(addr, password string, tlsConfig *tls.Config, opts ...Hysteria2Option) (Listener, error) {
+	if tlsConfig == nil {
+		tlsConfig = DefaultTLSConfig
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+
+	ln, err := quic.ListenAddr(addr, tlsConfig, &quic.Config{
+		KeepAlivePeriod: 10 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	l := &hysteria2Listener{
+		ln:       ln,
+		password: password,
+		connChan: make(chan net.Conn, 1024),
+		errChan:  make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(&l.options)
+	}
+	go l.listenLoop()
+	return l, nil
+}
+
+func (l *hysteria2Listener) listenLoop() {
+	for {
+		session, err := l.ln.Accept(context.Background())
+		if err != nil {
+			log.Log("[hysteria2] accept:", err)
+			l.errChan <- err
+			close(l.errChan)
+			return
+		}
+		go l.sessionLoop(session)
+	}
+}
+
+func (l *hysteria2Listener) sessionLoop(session quic.Connection) {
+	defer session.CloseWithError(0, "")
+
+	// the control and QPACK streams of the peer are not used.
+	go func() {
+		for {
+			stream, err := session.AcceptUniStream(context.Background())
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, stream)
+		}
+	}()
+	if err := h3OpenControlStream(session); err != nil {
+		return
+	}
+
+	limiter, err := l.auth(session)
+	if err != nil {
+		log.Logf("[hysteria2] %s - %s : %s", session.RemoteAddr(), session.LocalAddr(), err)
+		// wait for the client to close the connection after the response.
+		select {
+		case <-session.Context().Done():
+		case <-time.After(HandshakeTimeout):
+		}
+		return
+	}
+	log.Logf("[hysteria2] %s <-> %s", session.RemoteAddr(), session.LocalAddr())
+	defer log.Logf("[hysteria2] %s >-< %s", session.RemoteAddr(), session.LocalAddr())
+
+	for {
+		stream, err := session.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		cc := &hysteria2Conn{
+			Stream:  stream,
+			laddr:   session.LocalAddr(),
+			raddr:   session.RemoteAddr(),
+			limiter: limiter,
+		}
+		select {
+		case l.connChan <- cc:
+		default:
+			cc.Close()
+			log.Logf("[hysteria2] %s - %s: connection queue is full", session.RemoteAddr(), session.LocalAddr())
+		}
+	}
+}
+
+// auth verifies the HTTP/3 authentication request of the first stream, and returns the limiter of the session.
+func (l *hysteria2Listener) auth(session quic.Connection) (*bandwidthLimiter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	stream, err := session.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(HandshakeTimeout))
+
+	req, err := readH3Headers(bufio.NewReader(stream))
+	if err != nil {
+		return nil, err
+	}
+	if req[":method"] != "POST" || req[":path"] != "/auth" ||
+		subtle.ConstantTimeCompare([]byte(req["hysteria-auth"]), []byte(l.password)) != 1 {
+		writeH3Frame(stream, h3FrameHeaders, qpackEncode([][2]string{{":status", "404"}}))
+		return nil, errHysteria2Auth
+	}
+
+	rx := "auto"
+	if l.options.down > 0 {
+		rx = strconv.FormatUint(l.options.down, 10)
+	}
+	resp := [][2]string{
+		{":status", strconv.Itoa(hysteria2StatusAuthOK)},
+		{"hysteria-udp", "false"},
+		{"hysteria-cc-rx", rx},
+		{"hysteria-padding", hysteria2Padding()},
+	}
+	if err := writeH3Frame(stream, h3FrameHeaders, qpackEncode(resp)); err != nil {
+		return nil, err
+	}
+	peerRx, _ := strconv.ParseUint(req["hysteria-cc-rx"], 10, 64)
+	return newBandwidthLimiter(l.options.up, peerRx), nil
+}
+
+func (l *hysteria2Listener) Accept() (conn net.Conn, err error) {
+	var ok bool
+	select {
+	case conn = <-l.connChan:
+	case err, ok = <-l.errChan:
+		if !ok {
+			err = errors.New("accpet on closed listener")
+		}
+	}
+	return
+}
+
+func (l *hysteria2Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+func (l *hysteria2Listener) Close() error {
+	return l.ln.Close()
+}
+
+// h3OpenControlStream opens the HTTP/3 control stream with the empty SETTINGS frame.
+// The stream must be kept open during the connection.
+func h3OpenControlStream(conn quic.Connection) error {
+	stream, err := conn.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	_, err = stream.Write([]byte{h3StreamControl, h3FrameSettings, 0x00})
+	return err
+}
+
+func writeH3Frame(w io.Writer, typ uint64, payload []byte) error {
+	b := quicvarint.Append(nil, typ)
+	b = quicvarint.Append(b, uint64(len(payload)))
+	_, err := w.Write(append(b, payload...))
+	return err
+}
+
+// readH3Headers reads the frames until the HEADERS frame, and decodes the header fields.
+func readH3Headers(br *bufio.Reader) (map[string]string, error) {
+	for {
+		typ, err := quicvarint.Read(br)
+		if err != nil {
+			return nil, err
+		}
+		n, err := quicvarint.Read(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > h3MaxFrameSize {
+			return nil, fmt.Errorf("http3: frame too large (%d)", n)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, err
+		}
+		if typ == h3FrameHeaders {
+			return qpackDecode(b)
+		}
+		// the unknown and reserved frames are ignored.
+	}
+}
+
+// qpackEncode encodes the header fields by the literal field lines with the literal names,
+// the dynamic table and the Huffman encoding are not used.
+func qpackEncode(fields [][2]string) []byte {
+	b := []byte{0x00, 0x00} // required insert count and base
+	for _, f := range fields {
+		b = appendQPACKInt(b, 0x20, 3, uint64(len(f[0])))
+		b = append(b, f[0]...)
+		b = appendQPACKInt(b, 0x00, 7, uint64(len(f[1])))
+		b = append(b, f[1]...)
+	}
+	return b
+}
+
+// qpackDecode decodes the field section encoded with the static table only.
+func qpackDecode(b []byte) (map[string]string, error) {
+	errInvalid := errors.New("qpack: invalid field section")
+
+	// the required insert count must be 0 without the dynamic table.
+	ric, b, ok := readQPACKInt(b, 8)
+	if !ok || ric != 0 {
+		return nil, errInvalid
+	}
+	if _, b, ok = readQPACKInt(b, 7); !ok {
+		return nil, errInvalid
+	}
+
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		var name, value string
+		var idx uint64
+		switch c := b[0]; {
+		case c&0x80 != 0: // indexed field line
+			if c&0x40 == 0 {
+				return nil, errInvalid
+			}
+			if idx, b, ok = readQPACKInt(b, 6); !ok || idx >= uint64(len(qpackStaticTable)) {
+				return nil, errInvalid
+			}
+			name, value = qpackStaticTable[idx][0], qpackStaticTable[idx][1]
+		case c&0x40 != 0: // literal field line with name reference
+			if c&0x10 == 0 {
+				return nil, errInvalid
+			}
+			if idx, b, ok = readQPACKInt(b, 4); !ok || idx >= uint64(len(qpackStaticTable)) {
+				return nil, errInvalid
+			}
+			name = qpackStaticTable[idx][0]
+			if value, b, ok = readQPACKString(b, 7); !ok {
+				return nil, errInvalid
+			}
+		case c&0x20 != 0: // literal field line with literal name
+			if name, b, ok = readQPACKString(b, 3); !ok {
+				return nil, errInvalid
+			}
+			if value, b, ok = readQPACKString(b, 7); !ok {
+				return nil, errInvalid
+			}
+		default: // post-base references of the dynamic table
+			return nil, errInvalid
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+// appendQPACKInt appends the integer with the N-bit prefix, the high bits of the first byte are flags.
+func appendQPACKInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+func readQPACKInt(b []byte, n uint) (uint64, []byte, bool) {
+	if len(b) == 0 {
+		return 0, nil, false
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, true
+	}
+	for shift := uint(0); len(b) > 0 && shift < 63; shift += 7 {
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, true
+		}
+	}
+	return 0, nil, false
+}
+
+// readQPACKString reads the string literal with the N-bit length prefix, the Huffman flag is the bit before the prefix.
+func readQPACKString(b []byte, n uint) (string, []byte, bool) {
+	if len(b) == 0 {
+		return "", nil, false
+	}
+	huffman := b[0]&(1<<n) != 0
+	l, b, ok := readQPACKInt(b, n)
+	if !ok || l > uint64(len(b)) {
+		return "", nil, false
+	}
+	s := b[:l]
+	if !huffman {
+		return string(s), b[l:], true
+	}
+	v, err := hpack.HuffmanDecodeToString(s)
+	if err != nil {
+		return "", nil, false
+	}
+	return v, b[l:], true
+}
+
+// qpackStaticTable is the static table of QPACK, RFC 9204 Appendix A.
+var qpackStaticTable = [...][2]string{
+	{":authority", ""},
+	{":path", "/"},
+	{"age", "0"},
+	{"content-disposition", ""},
+	{"content-length", "0"},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"referer", ""},
+	{"set-cookie", ""},
+	{":method", "CONNECT"},
+	{":method", "DELETE"},
+	{":method", "GET"},
+	{":method", "HEAD"},
+	{":method", "OPTIONS"},
+	{":method", "POST"},
+	{":method", "PUT"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "103"},
+	{":status", "200"},
+	{":status", "304"},
+	{":status", "404"},
+	{":status", "503"},
+	{"accept", "*/*"},
+	{"accept", "application/dns-message"},
+	{"accept-encoding", "gzip, deflate, br"},
+	{"accept-ranges", "bytes"},
+	{"access-control-allow-headers", "cache-control"},
+	{"access-control-allow-headers", "content-type"},
+	{"access-control-allow-origin", "*"},
+	{"cache-control", "max-age=0"},
+	{"cache-control", "max-age=2592000"},
+	{"cache-control", "max-age=604800"},
+	{"cache-control", "no-cache"},
+	{"cache-control", "no-store"},
+	{"cache-control", "public, max-age=31536000"},
+	{"content-encoding", "br"},
+	{"content-encoding", "gzip"},
+	{"content-type", "application/dns-message"},
+	{"content-type", "application/javascript"},
+	{"content-type", "application/json"},
+	{"content-type", "application/x-www-form-urlencoded"},
+	{"content-type", "image/gif"},
+	{"content-type", "image/jpeg"},
+	{"content-type", "image/png"},
+	{"content-type", "text/css"},
+	{"content-type", "text/html; charset=utf-8"},
+	{"content-type", "text/plain"},
+	{"content-type", "text/plain;charset=utf-8"},
+	{"range", "bytes=0-"},
+	{"strict-transport-security", "max-age=31536000"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains; preload"},
+	{"vary", "accept-encoding"},
+	{"vary", "origin"},
+	{"x-content-type-options", "nosniff"},
+	{"x-xss-protection", "1; mode=block"},
+	{":status", "100"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "302"},
+	{":status", "400"},
+	{":status", "403"},
+	{":status", "421"},
+	{":status", "425"},
+	{":status", "500"},
+	{"accept-language", ""},
+	{"access-control-allow-credentials", "FALSE"},
+	{"access-control-allow-credentials", "TRUE"},
+	{"access-control-allow-headers", "*"},
+	{"access-control-allow-methods", "get"},
+	{"access-control-allow-methods", "get, post, options"},
+	{"access-control-allow-methods", "options"},
+	{"access-control-expose-headers", "content-length"},
+	{"access-control-request-headers", "content-type"},
+	{"access-control-request-method", "get"},
+	{"access-control-request-method", "post"},
+	{"alt-svc", "clear"},
+	{"authorization", ""},
+	{"content-security-policy", "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{"early-data", "1"},
+	{"expect-ct", ""},
+	{"forwarded", ""},
+	{"if-range", ""},
+	{"origin", ""},
+	{"purpose", "prefetch"},
+	{"server", ""},
+	{"timing-allow-origin", "*"},
+	{"upgrade-insecure-requests", "1"},
+	{"user-agent", ""},
+	{"x-forwarded-for", ""},
+	{"x-frame-options", "deny"},
+	{"x-frame-options", "sameorigin"},
+}
@@ -0,0 +1,105 @@
+package gost
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestQPACKDecode(t *testing.T) {
+	fields := [][2]string{
+		{":status", "233"},
+		{"hysteria-cc-rx", "auto"},
+		{"x-long-header-name", string(make([]byte, 300))},
+	}
+	got, err := qpackDecode(qpackEncode(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fields {
+		if got[f[0]] != f[1] {
+			t.Errorf("%s: got %q, want %q", f[0], got[f[0]], f[1])
+		}
+	}
+
+	// :method POST of the static table, :path with the static name and the Huffman value,
+	// and the literal name with the Huffman value.
+	b := []byte{0x00, 0x00, 0xc0 | 20}
+	path := hpack.AppendHuffmanString(nil, "/auth")
+	b = append(b, 0x50|1, 0x80|byte(len(path)))
+	b = append(b, path...)
+	value := hpack.AppendHuffmanString(nil, "password")
+	b = appendQPACKInt(b, 0x20, 3, 13)
+	b = append(b, "hysteria-auth"...)
+	b = append(b, 0x80|byte(len(value)))
+	b = append(b, value...)
+	got, err = qpackDecode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[":method"] != "POST" || got[":path"] != "/auth" || got["hysteria-auth"] != "password" {
+		t.Errorf("unexpected fields %v", got)
+	}
+
+	// the dynamic table is not supported.
+	if _, err := qpackDecode([]byte{0x01, 0x00, 0x80}); err == nil {
+		t.Error("the dynamic table should not be supported")
+	}
+}
+
+func hysteria2Roundtrip(t *testing.T, targetURL string, data []byte, clientPassword string) error {
+	ln, err := Hysteria2Listener("127.0.0.1:0", "password", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  Hysteria2Handler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   Hysteria2Connector(),
+		Transporter: Hysteria2Transporter(ln.Addr().String(), clientPassword, nil, WithHysteria2Bandwidth(0, 1<<20)),
+	}
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestHysteria2(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	if err := hysteria2Roundtrip(t, httpSrv.URL, sendData, "password"); err != nil {
+		t.Error(err)
+	}
+	if err := hysteria2Roundtrip(t, httpSrv.URL, sendData, "wrong"); !errors.Is(err, errHysteria2Auth) {
+		t.Errorf("got error %v, want %v", err, errHysteria2Auth)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	if newBandwidthLimiter(0, 0) != nil {
+		t.Error("the limiter should be nil without the rates")
+	}
+	l := newBandwidthLimiter(1<<20, 100*1024)
+	if l.rate != 100*1024 {
+		t.Fatalf("got rate %d, want %d", l.rate, 100*1024)
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		l.wait(10 * 1024)
+	}
+	// the first write is not delayed, the others are paced by 100ms.
+	if d := time.Since(start); d < 250*time.Millisecond || d > 2*time.Second {
+		t.Errorf("4 writes of 10KB at 100KB/s took %v", d)
+	}
+}
@@ -0,0 +1,289 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-i2p/i2pkeys"
+	"github.com/go-i2p/sam3"
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("i2p", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return I2PTransporter(i2pSAMAddr(node)), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return I2PListener(i2pSAMAddr(node), node.Get("key"))
+		},
+	})
+}
+
+// i2pSAMAddr returns the address of the SAM bridge of the node parameter sam, the default is the SAM bridge
+// of the local I2P router.
+func i2pSAMAddr(node Node) string {
+	if sam := node.Get("sam"); sam != "" {
+		return sam
+	}
+	return "127.0.0.1:7656"
+}
+
+// newI2PSession creates the streaming session of the keys by the SAM bridge at samAddr,
+// the session lives as long as the control connection of the SAM bridge.
+func newI2PSession(samAddr string, keys i2pkeys.I2PKeys) (*sam3.StreamSession, error) {
+	sam, err := sam3.NewSAM(samAddr)
+	if err != nil {
+		return nil, err
+	}
+	// the session dials the SAM bridge for the streams by the address in the config,
+	// which is always set to 127.0.0.1:7656 by NewSAM.
+	if host, port, err := net.SplitHostPort(samAddr); err == nil {
+		sam.Config.I2PConfig.SamHost, sam.Config.I2PConfig.SamPort = host, port
+	}
+	session, err := sam.NewStreamSession("gost-"+sam3.RandString(), keys, nil)
+	if err != nil {
+		sam.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// newI2PKeys generates the keys of a new destination, the signature type is Ed25519.
+func newI2PKeys(samAddr string) (i2pkeys.I2PKeys, error) {
+	sam, err := sam3.NewSAM(samAddr)
+	if err != nil {
+		return i2pkeys.I2PKeys{}, err
+	}
+	defer sam.Close()
+	return sam.NewKeys(sam3.Sig_EdDSA_SHA512_Ed25519)
+}
+
+// loadI2PKeys loads the keys from keyFile, the keys of a new destination are generated and saved to keyFile
+// if it does not exist. The keys are not saved if keyFile is empty.
+func loadI2PKeys(samAddr, keyFile string) (i2pkeys.I2PKeys, error) {
+	if keyFile != "" {
+		f, err := os.Open(keyFile)
+		if err == nil {
+			defer f.Close()
+			return i2pkeys.LoadKeysIncompat(f)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return i2pkeys.I2PKeys{}, err
+		}
+	}
+
+	keys, err := newI2PKeys(samAddr)
+	if err != nil || keyFile == "" {
+		return keys, err
+	}
+	f, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return i2pkeys.I2PKeys{}, err
+	}
+	defer f.Close()
+	return keys, i2pkeys.StoreKeysIncompat(keys, f)
+}
+
+// i2pAddr is the b32 address of the I2P destination.
+type i2pAddr string
+
+func (a i2pAddr) Network() string {
+	return "i2p"
+}
+
+func (a i2pAddr) String() string {
+	return string(a)
+}
+
+// i2pConn reports the b32 addresses of the destinations, instead of the I2PAddr of sam3.
+type i2pConn struct {
+	*sam3.SAMConn
+}
+
+func (c *i2pConn) LocalAddr() net.Addr {
+	return i2pAddr(c.SAMConn.LocalAddr().(i2pkeys.I2PAddr).Base32())
+}
+
+func (c *i2pConn) RemoteAddr() net.Addr {
+	return i2pAddr(c.SAMConn.RemoteAddr().(i2pkeys.I2PAddr).Base32())
+}
+
+type i2pTransporter struct {
+	samAddr string
+	session *sam3.StreamSession
+	mux     sync.Mutex
+}
+
+// I2PTransporter creates a Transporter that connects to the I2P destinations by the SAM v3 bridge at samAddr,
+// such as 127.0.0.1:7656 of the I2P router, with the client of github.com/go-i2p/sam3. The address of the node
+// is the b32 address, the name or the base64 destination, and the port is ignored. A streaming session of
+// a transient destination is created for the transporter, and re-created if it is closed by the bridge.
+func I2PTransporter(samAddr string) Transporter {
+	return &i2pTransporter{samAddr: samAddr}
+}
+
+func (tr *i2pTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+
+	session, err := tr.getSession()
+	if err != nil {
+		return nil, err
+	}
+
+	dest := i2pkeys.I2PAddr(host)
+	if strings.HasSuffix(host, ".i2p") {
+		if dest, err = session.Lookup(host); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := session.DialI2P(dest)
+	if err != nil {
+		if err.Error() == "Invalid tunnel ID" {
+			// the session is closed by the bridge.
+			tr.mux.Lock()
+			if tr.session == session {
+				tr.session = nil
+			}
+			tr.mux.Unlock()
+			session.Close()
+		}
+		return nil, fmt.Errorf("i2p: %s: %v", host, err)
+	}
+	return &i2pConn{SAMConn: conn}, nil
+}
+
+func (tr *i2pTransporter) getSession() (*sam3.StreamSession, error) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.session != nil {
+		return tr.session, nil
+	}
+	keys, err := newI2PKeys(tr.samAddr)
+	if err != nil {
+		return nil, err
+	}
+	session, err := newI2PSession(tr.samAddr, keys)
+	if err != nil {
+		return nil, err
+	}
+	tr.session = session
+	return session, nil
+}
+
+func (tr *i2pTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *i2pTransporter) Multiplex() bool {
+	return false
+}
+
+type i2pListener struct {
+	session  *sam3.StreamSession
+	ln       *sam3.StreamListener
+	connChan chan net.Conn
+	errChan  chan error
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// I2PListener creates a Listener for the I2P destination of the keys in keyFile by the SAM v3 bridge
+// at samAddr. The keys of a new destination are saved to keyFile if it does not exist, so the b32 address
+// of the server is kept; a transient destination is used if keyFile is empty. The b32 address is logged
+// and returned by Addr.
+func I2PListener(samAddr, keyFile string) (Listener, error) {
+	keys, err := loadI2PKeys(samAddr, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	session, err := newI2PSession(samAddr, keys)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := session.Listen()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	log.Logf("[i2p] %s: listening on %s", samAddr, keys.Addr().Base32())
+
+	l := &i2pListener{
+		session:  session,
+		ln:       ln,
+		connChan: make(chan net.Conn, 1024),
+		errChan:  make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+	go l.listenLoop()
+	return l, nil
+}
+
+func (l *i2pListener) listenLoop() {
+	for {
+		conn, err := l.accept()
+		if err != nil {
+			select {
+			case <-l.closed:
+				err = errors.New("accpet on closed listener")
+			default:
+			}
+			log.Log("[i2p] accept:", err)
+			l.errChan <- err
+			close(l.errChan)
+			return
+		}
+		select {
+		case l.connChan <- conn:
+		default:
+			conn.Close()
+			log.Logf("[i2p] %s - %s: connection queue is full", conn.RemoteAddr(), conn.LocalAddr())
+		}
+	}
+}
+
+// accept waits for a connection of the session by a new connection to the SAM bridge.
+func (l *i2pListener) accept() (conn net.Conn, err error) {
+	defer func() {
+		// AcceptI2P of sam3 panics if the SAM bridge is unreachable.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("i2p: %v", r)
+		}
+	}()
+	c, err := l.ln.AcceptI2P()
+	if err != nil {
+		return nil, err
+	}
+	return &i2pConn{SAMConn: c}, nil
+}
+
+func (l *i2pListener) Accept() (conn net.Conn, err error) {
+	var ok bool
+	select {
+	case conn = <-l.connChan:
+	case err, ok = <-l.errChan:
+		if !ok {
+			err = errors.New("accpet on closed listener")
+		}
+	}
+	return
+}
+
+func (l *i2pListener) Addr() net.Addr {
+	return i2pAddr(l.session.Addr().Base32())
+}
+
+func (l *i2pListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return l.session.Close()
+}
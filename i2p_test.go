@@ -0,0 +1,215 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-i2p/i2pkeys"
+)
+
+// i2pTestEncoding is the base64 encoding of I2P, which uses - and ~ instead of + and /.
+var i2pTestEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-~")
+
+// samTestArgs parses the arguments of the SAM command, such as SESSION CREATE ID=... DESTINATION=...
+func samTestArgs(line string) map[string]string {
+	args := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			args[k] = v
+		}
+	}
+	return args
+}
+
+// samTestBridge is a SAM bridge which connects the streams of the sessions locally.
+type samTestBridge struct {
+	ln       net.Listener
+	mux      sync.Mutex
+	sessions map[string]string // ID -> destination
+	accepts  map[string]chan net.Conn
+}
+
+func newSAMTestBridge(t *testing.T) *samTestBridge {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &samTestBridge{
+		ln:       ln,
+		sessions: make(map[string]string),
+		accepts:  make(map[string]chan net.Conn),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *samTestBridge) serve(conn net.Conn) {
+	var session string
+	defer func() {
+		if session == "" {
+			return
+		}
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		delete(b.sessions, session)
+		close(b.accepts[session])
+		for c := range b.accepts[session] {
+			c.Close()
+		}
+		delete(b.accepts, session)
+	}()
+
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return
+		}
+		fields := strings.Fields(line)
+		args := samTestArgs(line)
+		switch fields[0] + " " + fields[1] {
+		case "HELLO VERSION":
+			fmt.Fprintf(conn, "HELLO REPLY RESULT=OK VERSION=3.1\n")
+		case "DEST GENERATE":
+			// the private keys are appended to the destination.
+			pub, priv := make([]byte, 390), make([]byte, 63)
+			rand.Read(pub)
+			rand.Read(priv)
+			dest := i2pTestEncoding.EncodeToString(pub)
+			fmt.Fprintf(conn, "DEST REPLY PUB=%s PRIV=%s\n", dest, dest+i2pTestEncoding.EncodeToString(priv))
+		case "SESSION CREATE":
+			keys := args["DESTINATION"]
+			session = args["ID"]
+			b.mux.Lock()
+			b.sessions[session] = keys[:520]
+			b.accepts[session] = make(chan net.Conn, 16)
+			b.mux.Unlock()
+			fmt.Fprintf(conn, "SESSION STATUS RESULT=OK DESTINATION=%s\n", keys)
+		case "NAMING LOOKUP":
+			value := ""
+			b.mux.Lock()
+			for _, dest := range b.sessions {
+				if args["NAME"] == i2pkeys.I2PAddr(dest).Base32() {
+					value = dest
+				}
+			}
+			b.mux.Unlock()
+			if value == "" {
+				fmt.Fprintf(conn, "NAMING REPLY RESULT=KEY_NOT_FOUND NAME=%s\n", args["NAME"])
+				continue
+			}
+			fmt.Fprintf(conn, "NAMING REPLY RESULT=OK NAME=%s VALUE=%s\n", args["NAME"], value)
+		case "STREAM ACCEPT":
+			b.mux.Lock()
+			defer b.mux.Unlock()
+			accepts, ok := b.accepts[args["ID"]]
+			if !ok {
+				fmt.Fprintf(conn, "STREAM STATUS RESULT=INVALID_ID\n")
+				conn.Close()
+				return
+			}
+			fmt.Fprintf(conn, "STREAM STATUS RESULT=OK\n")
+			accepts <- conn
+			return
+		case "STREAM CONNECT":
+			var accepts chan net.Conn
+			b.mux.Lock()
+			src := b.sessions[args["ID"]]
+			for id, dest := range b.sessions {
+				if dest == args["DESTINATION"] {
+					accepts = b.accepts[id]
+				}
+			}
+			b.mux.Unlock()
+			var peer net.Conn
+			select {
+			case peer = <-accepts:
+			case <-time.After(time.Second):
+			}
+			if peer == nil {
+				fmt.Fprintf(conn, "STREAM STATUS RESULT=CANT_REACH_PEER\n")
+				conn.Close()
+				return
+			}
+			fmt.Fprintf(peer, "%s FROM_PORT=0 TO_PORT=0\n", src)
+			// AcceptI2P of sam3 drops the data read with the destination line,
+			// so the data of the stream does not arrive together with it.
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(conn, "STREAM STATUS RESULT=OK\n")
+			go func() {
+				io.Copy(peer, br)
+				peer.Close()
+			}()
+			io.Copy(conn, peer)
+			conn.Close()
+			return
+		}
+	}
+}
+
+func TestI2P(t *testing.T) {
+	bridge := newSAMTestBridge(t)
+	defer bridge.ln.Close()
+
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "i2p.key")
+	ln, err := I2PListener(bridge.ln.Addr().String(), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if !strings.HasSuffix(addr, ".b32.i2p") || len(addr) != 52+len(".b32.i2p") {
+		t.Errorf("invalid b32 address %s", addr)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: I2PTransporter(bridge.ln.Addr().String()),
+	}
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+		t.Error(err)
+	}
+	server.Close()
+
+	// the destination of the key file is reused.
+	if b, err := os.ReadFile(keyFile); err != nil || len(b) == 0 {
+		t.Fatal("the keys are not saved", err)
+	}
+	ln, err = I2PListener(bridge.ln.Addr().String(), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != addr {
+		t.Errorf("got address %s, want %s", ln.Addr(), addr)
+	}
+}
@@ -0,0 +1,151 @@
+package gost
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-log/log"
+)
+
+// DefaultInspectorMaxBodySize is the default max size of the request body buffered for inspection.
+const DefaultInspectorMaxBodySize = 1 << 20
+
+// BodyInspector inspects the body of the HTTP requests.
+type BodyInspector interface {
+	// Inspect reports whether the request is allowed,
+	// the body is replaced by modified if it is not nil.
+	Inspect(req *http.Request, body []byte) (allow bool, modified []byte)
+}
+
+// OversizePolicy is the policy for the request body exceeding the size limit of the inspection.
+type OversizePolicy int
+
+const (
+	// OversizeBypass passes the oversized request to the handler without inspection.
+	OversizeBypass OversizePolicy = iota
+	// OversizeReject rejects the oversized request with 413 (Request Entity Too Large).
+	OversizeReject
+)
+
+type inspectorOptions struct {
+	maxBodySize int64
+	oversize    OversizePolicy
+}
+
+// InspectorOption allows a common way to set the inspector middleware options.
+type InspectorOption func(opts *inspectorOptions)
+
+// MaxBodySizeInspectorOption sets the max size of the request body buffered for inspection,
+// defaults to DefaultInspectorMaxBodySize.
+func MaxBodySizeInspectorOption(n int64) InspectorOption {
+	return func(opts *inspectorOptions) {
+		opts.maxBodySize = n
+	}
+}
+
+// OversizeInspectorOption sets the policy for the request body exceeding the max size, defaults to OversizeBypass.
+func OversizeInspectorOption(policy OversizePolicy) InspectorOption {
+	return func(opts *inspectorOptions) {
+		opts.oversize = policy
+	}
+}
+
+type inspectorMiddleware struct {
+	handler   http.Handler
+	inspector BodyInspector
+	options   inspectorOptions
+}
+
+// InspectorMiddleware creates a http.Handler that buffers the request body and passes it to the inspector
+// before the request is served by the handler. The request is served with the modified body if the inspector modifies it,
+// the connection is closed without response if the inspector denies the request.
+func InspectorMiddleware(handler http.Handler, inspector BodyInspector, opts ...InspectorOption) http.Handler {
+	m := &inspectorMiddleware{
+		handler:   handler,
+		inspector: inspector,
+	}
+	for _, opt := range opts {
+		opt(&m.options)
+	}
+	if m.options.maxBodySize <= 0 {
+		m.options.maxBodySize = DefaultInspectorMaxBodySize
+	}
+	return m
+}
+
+func (m *inspectorMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		b, err := io.ReadAll(io.LimitReader(r.Body, m.options.maxBodySize+1))
+		if err != nil {
+			log.Logf("[inspector] %s - %s: %v", r.RemoteAddr, r.Host, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = b
+	}
+
+	if int64(len(body)) > m.options.maxBodySize {
+		if m.options.oversize == OversizeReject {
+			if Debug {
+				log.Logf("[inspector] %s - %s: body exceeds %d bytes, rejected", r.RemoteAddr, r.Host, m.options.maxBodySize)
+			}
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if Debug {
+			log.Logf("[inspector] %s - %s: body exceeds %d bytes, bypassed", r.RemoteAddr, r.Host, m.options.maxBodySize)
+		}
+		r.Body = &inspectedBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), body: r.Body}
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	allow, modified := m.inspector.Inspect(r, body)
+	if !allow {
+		if Debug {
+			log.Logf("[inspector] %s - %s: %s %s denied", r.RemoteAddr, r.Host, r.Method, r.URL)
+		}
+		m.closeConn(w)
+		return
+	}
+
+	if modified != nil {
+		body = modified
+		r.ContentLength = int64(len(body))
+		r.TransferEncoding = nil
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &inspectedBody{Reader: bytes.NewReader(body), body: r.Body}
+	} else if len(body) > 0 {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	m.handler.ServeHTTP(w, r)
+}
+
+// closeConn closes the client connection without response,
+// falls back to 403 (Forbidden) if the connection can not be hijacked (e.g. HTTP/2).
+func (m *inspectorMiddleware) closeConn(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// inspectedBody is the request body read from the buffer, the original body is closed along with it.
+type inspectedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *inspectedBody) Close() error {
+	return b.body.Close()
+}
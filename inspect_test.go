@@ -0,0 +1,82 @@
+package gost
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type inspectorFunc func(req *http.Request, body []byte) (bool, []byte)
+
+func (f inspectorFunc) Inspect(req *http.Request, body []byte) (bool, []byte) {
+	return f(req, body)
+}
+
+func TestInspectorMiddleware(t *testing.T) {
+	// the echo handler replies the request body.
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	})
+
+	var calls int32
+	inspector := inspectorFunc(func(req *http.Request, body []byte) (bool, []byte) {
+		atomic.AddInt32(&calls, 1)
+		switch {
+		case bytes.Contains(body, []byte("attack")):
+			return false, nil
+		case bytes.Contains(body, []byte("secret")):
+			return true, bytes.ReplaceAll(body, []byte("secret"), []byte("******"))
+		default:
+			return true, nil
+		}
+	})
+
+	tests := []struct {
+		policy    OversizePolicy
+		body      string
+		status    int
+		reply     string
+		inspected bool
+	}{
+		{OversizeBypass, "hello", http.StatusOK, "hello", true},
+		{OversizeBypass, "", http.StatusOK, "", true},
+		{OversizeBypass, "my secret", http.StatusOK, "my ******", true},
+		{OversizeBypass, "attack", 0, "", true},
+		{OversizeBypass, strings.Repeat("attack", 4), http.StatusOK, strings.Repeat("attack", 4), false},
+		{OversizeReject, strings.Repeat("attack", 4), http.StatusRequestEntityTooLarge, "", false},
+	}
+
+	for i, tc := range tests {
+		srv := httptest.NewServer(InspectorMiddleware(echo, inspector,
+			MaxBodySizeInspectorOption(16), OversizeInspectorOption(tc.policy)))
+
+		atomic.StoreInt32(&calls, 0)
+		resp, err := http.Post(srv.URL, "text/plain", strings.NewReader(tc.body))
+		if tc.status == 0 {
+			// the connection is closed by the denied request.
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("#%d: got status %d, want connection closed", i, resp.StatusCode)
+			}
+		} else if err != nil {
+			t.Errorf("#%d: %v", i, err)
+		} else {
+			reply, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("#%d: got status %d, want %d", i, resp.StatusCode, tc.status)
+			}
+			if tc.status == http.StatusOK && string(reply) != tc.reply {
+				t.Errorf("#%d: got reply %q, want %q", i, reply, tc.reply)
+			}
+		}
+		srv.Close()
+		if n := atomic.LoadInt32(&calls); (n > 0) != tc.inspected {
+			t.Errorf("#%d: inspected %v, want %v", i, n > 0, tc.inspected)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+//go:build integration
+
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// compose runs the docker compose command of the integration chain in testdata/docker-compose.yml.
+func compose(t *testing.T, wwwDir string, args ...string) error {
+	args = append([]string{"compose", "-f", filepath.Join("testdata", "docker-compose.yml"), "-p", "gost-integration"}, args...)
+	cmd := exec.Command("docker", args...)
+	cmd.Env = append(os.Environ(), "GOST_WWW_DIR="+wwwDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Logf("docker %v: %s", args, out)
+	}
+	return err
+}
+
+func TestIntegrationChain(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available")
+	}
+
+	www := t.TempDir()
+	os.Chmod(www, 0755)
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(www, "file"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+
+	if err := compose(t, www, "up", "-d", "--build"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if t.Failed() {
+			compose(t, www, "logs")
+		}
+		compose(t, www, "down", "-v")
+	}()
+
+	proxyURL, _ := url.Parse("http://127.0.0.1:18080")
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)},
+		Timeout:   30 * time.Second,
+	}
+	// the services may not be ready after they are started.
+	var b []byte
+	var err error
+	for i := 0; i < 30; i++ {
+		if b, err = integrationGet(client, "http://upstream/file"); err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sha256.Sum256(b); !bytes.Equal(got[:], want[:]) {
+		t.Errorf("sha256 %x, want %x, got %d bytes", got, want, len(b))
+	}
+}
+
+func integrationGet(client *http.Client, target string) ([]byte, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", target, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
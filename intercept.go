@@ -0,0 +1,220 @@
+package gost
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// InterceptCertTTL is the time the generated leaf certificates are cached.
+var InterceptCertTTL = 24 * time.Hour
+
+type interceptCert struct {
+	cert    *tls.Certificate
+	expires time.Time
+}
+
+type tlsInterceptHandler struct {
+	caKey   *rsa.PrivateKey
+	caCert  *x509.Certificate
+	options *HandlerOptions
+	certs   map[string]*interceptCert
+	mux     sync.Mutex
+}
+
+// TLSInterceptHandler creates a HTTP proxy handler which intercepts (SSL bump) the CONNECT tunnels.
+// For each CONNECT request, the client TLS session is terminated with a leaf certificate of the target
+// hostname (the SNI, or the CONNECT host if absent) signed by the CA, and the decrypted data is relayed to
+// a separate TLS session with the target. The other requests are handled as the HTTP handler.
+//
+// The certificate of the target is verified with the RootCAs of the TLSConfigHandlerOption if it is set,
+// or the system roots otherwise. The leaf certificates are cached by the hostname for InterceptCertTTL.
+// The clients must trust the CA certificate.
+func TLSInterceptHandler(caKey *rsa.PrivateKey, caCert *x509.Certificate, opts ...HandlerOption) Handler {
+	h := &tlsInterceptHandler{
+		caKey:  caKey,
+		caCert: caCert,
+		certs:  make(map[string]*interceptCert),
+	}
+	h.Init(opts...)
+	return h
+}
+
+func (h *tlsInterceptHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *tlsInterceptHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		log.Logf("[intercept] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	defer req.Body.Close()
+
+	hh := &httpHandler{options: h.options}
+	if req.Method != http.MethodConnect {
+		hh.handleRequest(conn, req)
+		return
+	}
+
+	host := req.Host
+	if _, port, _ := net.SplitHostPort(host); port == "" {
+		host = net.JoinHostPort(host, "443")
+	}
+	log.Logf("[intercept] %s -> %s", conn.RemoteAddr(), host)
+
+	resp := &http.Response{
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+	}
+	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) || h.options.Bypass.Contains(host) {
+		log.Logf("[intercept] %s - %s : Unauthorized to tcp connect to %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		resp.StatusCode = http.StatusForbidden
+		resp.Write(conn)
+		return
+	}
+	if !hh.authenticate(conn, req, resp) {
+		return
+	}
+
+	cc, err := h.options.Chain.Dial(host,
+		TimeoutChainOption(h.options.Timeout),
+		HostsChainOption(h.options.Hosts),
+		ResolverChainOption(h.options.Resolver),
+	)
+	if err != nil {
+		log.Logf("[intercept] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		resp.StatusCode = http.StatusServiceUnavailable
+		resp.Write(conn)
+		return
+	}
+	defer cc.Close()
+
+	proxyAgent := DefaultProxyAgent
+	if h.options.ProxyAgent != "" {
+		proxyAgent = h.options.ProxyAgent
+	}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n" +
+		"Proxy-Agent: " + proxyAgent + "\r\n\r\n")); err != nil {
+		return
+	}
+
+	serverName, _, _ := net.SplitHostPort(host)
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				serverName = hello.ServerName
+			}
+			return h.getCert(serverName)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		log.Logf("[intercept] %s - %s : %s", conn.RemoteAddr(), host, err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	upstreamConfig := &tls.Config{
+		ServerName: serverName,
+		NextProtos: []string{"http/1.1"},
+	}
+	if h.options.TLSConfig != nil {
+		upstreamConfig.RootCAs = h.options.TLSConfig.RootCAs
+	}
+	upstream, err := wrapTLSClient(cc, upstreamConfig, h.options.Timeout)
+	if err != nil {
+		log.Logf("[intercept] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		return
+	}
+	defer upstream.Close()
+
+	log.Logf("[intercept] %s <-> %s (%s)", conn.RemoteAddr(), host, serverName)
+	transport(tlsConn, upstream)
+	log.Logf("[intercept] %s >-< %s (%s)", conn.RemoteAddr(), host, serverName)
+}
+
+// getCert returns the leaf certificate of the host, the certificate is generated if it is not cached.
+func (h *tlsInterceptHandler) getCert(host string) (*tls.Certificate, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	now := time.Now()
+	if c := h.certs[host]; c != nil && now.Before(c.expires) {
+		return c.cert, nil
+	}
+	for k, c := range h.certs {
+		if !now.Before(c.expires) {
+			delete(h.certs, k)
+		}
+	}
+
+	cert, err := h.genCert(host)
+	if err != nil {
+		return nil, err
+	}
+	if Debug {
+		log.Logf("[intercept] generate certificate for %s", host)
+	}
+	h.certs[host] = &interceptCert{cert: cert, expires: now.Add(InterceptCertTTL)}
+	return cert, nil
+}
+
+func (h *tlsInterceptHandler) genCert(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		// valid a bit longer than it is cached.
+		NotAfter:    now.Add(InterceptCertTTL + 24*time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, h.caCert, &key.PublicKey, h.caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, h.caCert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package gost
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func interceptTestCA(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gost test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestTLSInterceptHandler(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer origin.Close()
+	originRoots := x509.NewCertPool()
+	originRoots.AddCert(origin.Certificate())
+
+	caKey, caCert := interceptTestCA(t)
+	handler := TLSInterceptHandler(caKey, caCert, TLSConfigHandlerOption(&tls.Config{RootCAs: originRoots}))
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: handler}
+	go server.Run()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	proxyURL, _ := url.Parse("http://" + ln.Addr().String())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+
+	var leaf []byte
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(origin.URL + "/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello /test" {
+			t.Errorf("got body %q", body)
+		}
+
+		cert := resp.TLS.PeerCertificates[0]
+		if cert.Issuer.CommonName != caCert.Subject.CommonName {
+			t.Errorf("got issuer %s, want %s", cert.Issuer.CommonName, caCert.Subject.CommonName)
+		}
+		if leaf != nil && string(leaf) != string(cert.Raw) {
+			t.Error("leaf certificate is not cached")
+		}
+		leaf = cert.Raw
+		client.Transport.(*http.Transport).CloseIdleConnections()
+	}
+}
+
+func TestTLSInterceptHandlerUntrustedUpstream(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+
+	caKey, caCert := interceptTestCA(t)
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: TLSInterceptHandler(caKey, caCert)}
+	go server.Run()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	proxyURL, _ := url.Parse("http://" + ln.Addr().String())
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+	if resp, err := client.Get(origin.URL); err == nil {
+		resp.Body.Close()
+		t.Error("untrusted upstream certificate is accepted")
+	}
+}
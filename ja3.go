@@ -0,0 +1,268 @@
+package gost
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxClientHelloSize is the max size of the recorded ClientHello.
+const maxClientHelloSize = 64 * 1024
+
+// JA3Fingerprint returns the JA3 fingerprint (the MD5 hash of the JA3 string) of the ClientHello.
+//
+// The JA3 string is 'SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats',
+// each field is a '-' separated list of the decimal values, the GREASE values are ignored.
+// The extensions are not exposed by tls.ClientHelloInfo, they are available only if the connection
+// is accepted by TLSListener in debug mode, which records the raw ClientHello. Otherwise the extensions field is empty
+// and the SSLVersion is derived from the supported versions.
+func JA3Fingerprint(hello *tls.ClientHelloInfo) string {
+	return ja3Hash(ja3String(hello))
+}
+
+// JA3SFingerprint returns the JA3S fingerprint of the server side handshake.
+//
+// The JA3S string is 'SSLVersion,Cipher,Extensions'. As the extensions of the ServerHello are not
+// exposed by tls.ConnectionState, the extensions field is always empty,
+// so the fingerprint only distinguishes the negotiated version and cipher suite.
+func JA3SFingerprint(state tls.ConnectionState) string {
+	return ja3Hash(ja3sString(state))
+}
+
+func ja3Hash(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func ja3String(hello *tls.ClientHelloInfo) string {
+	if c, ok := hello.Conn.(*clientHelloConn); ok {
+		if h := c.clientHello(); h != nil {
+			return h.ja3()
+		}
+	}
+
+	h := &clientHello{
+		ciphers: hello.CipherSuites,
+		curves:  make([]uint16, 0, len(hello.SupportedCurves)),
+		points:  hello.SupportedPoints,
+	}
+	// TLS 1.3 clients send TLS 1.2 as the legacy version.
+	for _, v := range hello.SupportedVersions {
+		if v > h.version && v <= tls.VersionTLS12 {
+			h.version = v
+		}
+	}
+	for _, c := range hello.SupportedCurves {
+		h.curves = append(h.curves, uint16(c))
+	}
+	return h.ja3()
+}
+
+func ja3sString(state tls.ConnectionState) string {
+	version := state.Version
+	// TLS 1.3 servers send TLS 1.2 as the legacy version.
+	if version > tls.VersionTLS12 {
+		version = tls.VersionTLS12
+	}
+	return strconv.Itoa(int(version)) + "," + strconv.Itoa(int(state.CipherSuite)) + ","
+}
+
+// clientHello is the fields of the ClientHello used by JA3.
+type clientHello struct {
+	version    uint16
+	ciphers    []uint16
+	extensions []uint16
+	curves     []uint16
+	points     []uint8
+}
+
+func (h *clientHello) ja3() string {
+	points := make([]uint16, len(h.points))
+	for i, p := range h.points {
+		points[i] = uint16(p)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(h.version)),
+		ja3List(h.ciphers),
+		ja3List(h.extensions),
+		ja3List(h.curves),
+		ja3List(points),
+	}, ",")
+}
+
+func ja3List(values []uint16) string {
+	ss := make([]string, 0, len(values))
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		ss = append(ss, strconv.Itoa(int(v)))
+	}
+	return strings.Join(ss, "-")
+}
+
+// isGREASE reports whether the value is one of the GREASE values (RFC 8701), such as 0x0a0a.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// parseClientHello parses the ClientHello from the TLS records,
+// it returns nil and false if the data is incomplete, or nil and true if the data is not a valid ClientHello.
+func parseClientHello(data []byte) (h *clientHello, done bool) {
+	// reassemble the handshake message from the records.
+	var msg []byte
+	for {
+		if len(data) < 5 {
+			return nil, false
+		}
+		if data[0] != 22 { // handshake
+			return nil, true
+		}
+		n := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+n {
+			return nil, false
+		}
+		msg = append(msg, data[5:5+n]...)
+		data = data[5+n:]
+
+		if len(msg) >= 4 {
+			if msg[0] != 1 { // client_hello
+				return nil, true
+			}
+			if size := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3]); len(msg) >= 4+size {
+				msg = msg[4 : 4+size]
+				break
+			}
+		}
+	}
+
+	r := &helloReader{b: msg}
+	h = &clientHello{}
+	h.version = r.uint16()
+	r.skip(32) // random
+	r.skip(int(r.uint8()))
+	for i, n := 0, int(r.uint16())/2; i < n; i++ {
+		h.ciphers = append(h.ciphers, r.uint16())
+	}
+	r.skip(int(r.uint8())) // compression methods
+
+	exts := &helloReader{b: r.bytes(int(r.uint16()))}
+	for !exts.err && len(exts.b) > 0 {
+		typ := exts.uint16()
+		ext := &helloReader{b: exts.bytes(int(exts.uint16()))}
+		h.extensions = append(h.extensions, typ)
+		switch typ {
+		case 10: // supported_groups
+			for i, n := 0, int(ext.uint16())/2; i < n; i++ {
+				h.curves = append(h.curves, ext.uint16())
+			}
+		case 11: // ec_point_formats
+			h.points = append(h.points, ext.bytes(int(ext.uint8()))...)
+		}
+	}
+	if r.err || exts.err {
+		return nil, true
+	}
+	return h, true
+}
+
+type helloReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *helloReader) bytes(n int) []byte {
+	if r.err || len(r.b) < n {
+		r.err = true
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *helloReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *helloReader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *helloReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// clientHelloConn records the data read from the connection until the ClientHello is parsed.
+// Once the ClientHello is parsed, the reads go to the underlying connection directly.
+type clientHelloConn struct {
+	net.Conn
+	mu    sync.Mutex
+	buf   []byte
+	hello *clientHello
+	done  atomic.Bool
+}
+
+func (c *clientHelloConn) Read(b []byte) (n int, err error) {
+	if c.done.Load() {
+		return c.Conn.Read(b)
+	}
+
+	n, err = c.Conn.Read(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > 0 {
+		var done bool
+		c.buf = append(c.buf, b[:n]...)
+		c.hello, done = parseClientHello(c.buf)
+		if done || len(c.buf) > maxClientHelloSize {
+			c.buf = nil
+			c.done.Store(true)
+		}
+	}
+	return
+}
+
+func (c *clientHelloConn) clientHello() *clientHello {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hello
+}
+
+// release drops the recorded ClientHello when the handshake does not need it anymore.
+func (c *clientHelloConn) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf, c.hello = nil, nil
+	c.done.Store(true)
+}
+
+// clientHelloListener wraps the accepted connections to record the ClientHello in debug mode,
+// the connections are not wrapped otherwise.
+type clientHelloListener struct {
+	net.Listener
+}
+
+func (l *clientHelloListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !Debug {
+		return conn, nil
+	}
+	return &clientHelloConn{Conn: conn}, nil
+}
@@ -0,0 +1,179 @@
+package gost
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// buildClientHello builds the TLS records of a ClientHello, the handshake message is split into two records.
+func buildClientHello() []byte {
+	u16 := func(b []byte, v ...uint16) []byte {
+		for _, n := range v {
+			b = binary.BigEndian.AppendUint16(b, n)
+		}
+		return b
+	}
+
+	var exts []byte
+	exts = u16(exts, 0x0a0a, 0) // GREASE
+	exts = u16(exts, 0, 7, 5)   // server_name
+	exts = append(exts, 0, 0, 2, 'a', 'b')
+	exts = u16(exts, 10, 8, 6, 0x1a1a) // supported_groups
+	exts = u16(exts, 29, 23)
+	exts = u16(exts, 11, 2)
+	exts = append(exts, 1, 0) // ec_point_formats
+
+	var body []byte
+	body = u16(body, tls.VersionTLS12)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session id
+	body = u16(body, 6, 0x2a2a, tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384)
+	body = append(body, 1, 0) // compression methods
+	body = u16(body, uint16(len(exts)))
+	body = append(body, exts...)
+
+	msg := append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+
+	var records []byte
+	for _, frag := range [][]byte{msg[:10], msg[10:]} {
+		records = append(records, 22, 3, 1)
+		records = u16(records, uint16(len(frag)))
+		records = append(records, frag...)
+	}
+	return records
+}
+
+func TestParseClientHello(t *testing.T) {
+	data := buildClientHello()
+
+	for i := 0; i < len(data); i++ {
+		if h, done := parseClientHello(data[:i]); h != nil || done {
+			t.Fatalf("parse %d of %d bytes: got done", i, len(data))
+		}
+	}
+
+	h, done := parseClientHello(data)
+	if h == nil || !done {
+		t.Fatal("parse failed")
+	}
+	if s, want := h.ja3(), "771,4865-4866,0-10-11,29-23,0"; s != want {
+		t.Errorf("got JA3 string %q, want %q", s, want)
+	}
+	if got, want := JA3Fingerprint(&tls.ClientHelloInfo{Conn: &clientHelloConn{hello: h}}), ja3Hash("771,4865-4866,0-10-11,29-23,0"); got != want {
+		t.Errorf("got JA3 %s, want %s", got, want)
+	}
+
+	if h, done := parseClientHello([]byte{23, 3, 3, 0, 0}); h != nil || !done {
+		t.Error("non-handshake record should be rejected")
+	}
+}
+
+func TestJA3FingerprintTLSListener(t *testing.T) {
+	hellos := make(chan string, 2)
+	config := DefaultTLSConfig.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		hellos <- ja3String(hello)
+		// the fallback string without the raw ClientHello.
+		hellos <- ja3String(&tls.ClientHelloInfo{
+			CipherSuites:      hello.CipherSuites,
+			SupportedCurves:   hello.SupportedCurves,
+			SupportedPoints:   hello.SupportedPoints,
+			SupportedVersions: hello.SupportedVersions,
+		})
+		return nil, nil
+	}
+
+	ln, err := TLSListener("localhost:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	states := make(chan tls.ConnectionState, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tc := conn.(*tls.Conn)
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		states <- tc.ConnectionState()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, fallback := <-hellos, <-hellos
+	// the raw string has the extensions.
+	if len(raw) <= len(fallback) || raw[:4] != "771," {
+		t.Errorf("got JA3 string %q, fallback %q", raw, fallback)
+	}
+	// the fields other than the extensions are identical.
+	rawFields, fallbackFields := strings.Split(raw, ","), strings.Split(fallback, ",")
+	for _, i := range []int{0, 1, 3, 4} {
+		if rawFields[i] != fallbackFields[i] {
+			t.Errorf("field #%d: got %q, fallback %q", i, rawFields[i], fallbackFields[i])
+		}
+	}
+
+	state := <-states
+	if s, want := ja3sString(state), "771,"; s[:4] != want || len(s) <= len(want) {
+		t.Errorf("got JA3S string %q", s)
+	}
+	if JA3SFingerprint(state) != JA3SFingerprint(conn.ConnectionState()) {
+		t.Error("JA3S mismatch between the server and client")
+	}
+}
+
+func TestRandomizedTLSConfig(t *testing.T) {
+	fingerprints := make(chan string, 1)
+	config := DefaultTLSConfig.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		fingerprints <- JA3Fingerprint(hello)
+		return nil, nil
+	}
+
+	ln, err := TLSListener("localhost:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+
+	base := &tls.Config{InsecureSkipVerify: true}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), RandomizedTLSConfig(base))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		seen[<-fingerprints] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("got %d distinct JA3 fingerprints in 100 handshakes", len(seen))
+	}
+	if base.CipherSuites != nil || base.CurvePreferences != nil || base.SessionTicketsDisabled {
+		t.Error("base config is modified")
+	}
+}
@@ -0,0 +1,129 @@
+package gost
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaQueueSize is the max number of the events waiting to be written to Kafka.
+const kafkaQueueSize = 4096
+
+// KafkaEventNotifier publishes the connection events to Kafka, see KafkaNotifier.
+type KafkaEventNotifier struct {
+	writer  *kafka.Writer
+	ch      chan kafka.Message
+	done    chan struct{}
+	mux     sync.RWMutex
+	closed  bool
+	dropped int64
+}
+
+// KafkaNotifier creates a KafkaEventNotifier which publishes the JSON encoded events (ConnEvent) to the topic.
+// The messages are keyed by the client IP of the connection, so the events of a client are in the same partition in order.
+//
+// The events are written in background, they are dropped and counted by Dropped if Kafka is unavailable
+// or the queue is full. The Middleware of the notifier wraps the handlers, and Close flushes the pending events.
+func KafkaNotifier(brokers []string, topic string) *KafkaEventNotifier {
+	n := &KafkaEventNotifier{
+		ch:   make(chan kafka.Message, kafkaQueueSize),
+		done: make(chan struct{}),
+	}
+	n.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 100 * time.Millisecond,
+		MaxAttempts:  3,
+		WriteTimeout: 10 * time.Second,
+		Async:        true,
+		Completion: func(messages []kafka.Message, err error) {
+			if err != nil {
+				atomic.AddInt64(&n.dropped, int64(len(messages)))
+				if Debug {
+					log.Logf("[kafka] %s: %d events dropped: %v", topic, len(messages), err)
+				}
+			}
+		},
+	}
+	go n.run()
+	return n
+}
+
+// Middleware returns the Middleware which sends the events of the connections.
+func (n *KafkaEventNotifier) Middleware(events []EventType) Middleware {
+	return eventMiddleware(events, n.notify)
+}
+
+// Dropped returns the number of the dropped events.
+func (n *KafkaEventNotifier) Dropped() int64 {
+	return atomic.LoadInt64(&n.dropped)
+}
+
+// Close flushes the pending events and closes the Kafka writer.
+func (n *KafkaEventNotifier) Close() error {
+	n.mux.Lock()
+	if n.closed {
+		n.mux.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.ch)
+	n.mux.Unlock()
+
+	<-n.done
+	return n.writer.Close()
+}
+
+func (n *KafkaEventNotifier) notify(e ConnEvent) {
+	msg, err := kafkaEventMessage(e)
+	if err != nil {
+		atomic.AddInt64(&n.dropped, 1)
+		return
+	}
+
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	if n.closed {
+		atomic.AddInt64(&n.dropped, 1)
+		return
+	}
+	select {
+	case n.ch <- msg:
+	default:
+		atomic.AddInt64(&n.dropped, 1)
+	}
+}
+
+func (n *KafkaEventNotifier) run() {
+	defer close(n.done)
+	for msg := range n.ch {
+		// the messages are buffered by the async writer, the errors are reported to Completion.
+		if err := n.writer.WriteMessages(context.Background(), msg); err != nil {
+			atomic.AddInt64(&n.dropped, 1)
+		}
+	}
+}
+
+// kafkaEventMessage encodes the event as a Kafka message keyed by the client IP.
+func kafkaEventMessage(e ConnEvent) (kafka.Message, error) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	key := e.SrcAddr
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	return kafka.Message{
+		Key:   []byte(key),
+		Value: value,
+		Time:  e.Timestamp,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package gost
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKafkaEventMessage(t *testing.T) {
+	e := ConnEvent{
+		Timestamp: time.Unix(1700000000, 0),
+		Event:     EventConnOpen,
+		SrcAddr:   "192.168.1.10:54321",
+		DstAddr:   "example.com:443",
+	}
+	msg, err := kafkaEventMessage(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Key) != "192.168.1.10" {
+		t.Errorf("key %s", msg.Key)
+	}
+	var v ConnEvent
+	if err := json.Unmarshal(msg.Value, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Event != e.Event || v.SrcAddr != e.SrcAddr || v.DstAddr != e.DstAddr || !v.Timestamp.Equal(e.Timestamp) {
+		t.Errorf("event %+v, want %+v", v, e)
+	}
+}
+
+func TestKafkaNotifierUnavailable(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	// no broker is listening on the address.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := ln.Addr().String()
+	ln.Close()
+
+	n := KafkaNotifier([]string{broker}, "gost-events")
+	mw := n.Middleware([]EventType{EventConnOpen, EventConnClose})
+	client := &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()}
+	if err := middlewareRoundtrip(t, mw, HTTPHandler(), client, httpSrv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- n.Close() }()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("close timeout")
+	}
+	if d := n.Dropped(); d != 2 {
+		t.Errorf("%d events dropped, want 2", d)
+	}
+
+	// the events after close are dropped.
+	n.notify(ConnEvent{Event: EventConnOpen})
+	if d := n.Dropped(); d != 3 {
+		t.Errorf("%d events dropped, want 3", d)
+	}
+	if err := n.Close(); err != nil {
+		t.Error(err)
+	}
+}
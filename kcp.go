@@ -3,6 +3,7 @@ package gost
 import (
 	"crypto/sha1"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -20,6 +21,52 @@ import (
 	"github.com/xtaci/tcpraw"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("kcp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			config, err := parseKCPConfig(node)
+			if err != nil {
+				return nil, err
+			}
+			if node.GetBool("mtudiscovery") {
+				config.MTUDiscovery = true
+			}
+			return KCPTransporter(config), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			config, err := parseKCPConfig(node)
+			if err != nil {
+				return nil, err
+			}
+			return KCPListener(node.Addr, config)
+		},
+	})
+}
+
+// parseKCPConfig returns the KCPConfig of the JSON file of the node parameter c,
+// or DefaultKCPConfig over TCP if the parameter tcp is true.
+func parseKCPConfig(node Node) (*KCPConfig, error) {
+	configFile := node.Get("c")
+	if configFile == "" {
+		config := DefaultKCPConfig
+		if node.GetBool("tcp") {
+			config.TCP = true
+		}
+		return &config, nil
+	}
+	file, err := os.Open(configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &KCPConfig{}
+	if err = json.NewDecoder(file).Decode(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 var (
 	// KCPSalt is the default salt for KCP cipher.
 	KCPSalt = "kcp-go"
@@ -49,8 +96,11 @@ type KCPConfig struct {
 	KeepAlive    int    `json:"keepalive"`
 	SnmpLog      string `json:"snmplog"`
 	SnmpPeriod   int    `json:"snmpperiod"`
-	Signal       bool   `json:"signal"` // Signal enables the signal SIGUSR1 feature.
+	Signal       bool   `json:"signal"` // Signal enables the signal SIGUSR1 feature, the SNMP log. The log file is also reopened on it.
 	TCP          bool   `json:"tcp"`
+	// MTUDiscovery discovers the path MTU to the server, and reduces the MTU if it is lower,
+	// e.g. when a packet is rejected with EMSGSIZE.
+	MTUDiscovery bool `json:"mtudiscovery"`
 }
 
 // Init initializes the KCP config.
@@ -219,6 +269,18 @@ func (tr *kcpTransporter) initSession(addr string, conn net.Conn, config *KCPCon
 		return nil, errors.New("kcp: wrong connection type")
 	}
 
+	mtu := config.MTU
+	mtuSetter := &kcpMTUSetter{}
+	if config.MTUDiscovery && !config.TCP {
+		mtu = kcpPathMTU(addr, mtu)
+		mpc, err := newMTUPacketConn(pc, mtuSetter.set)
+		if err != nil {
+			log.Log("[kcp]", err)
+		} else {
+			pc = mpc
+		}
+	}
+
 	kcpconn, err := kcp.NewConn(addr,
 		blockCrypt(config.Key, config.Crypt, KCPSalt),
 		config.DataShard, config.ParityShard, pc)
@@ -230,8 +292,9 @@ func (tr *kcpTransporter) initSession(addr string, conn net.Conn, config *KCPCon
 	kcpconn.SetWriteDelay(false)
 	kcpconn.SetNoDelay(config.NoDelay, config.Interval, config.Resend, config.NoCongestion)
 	kcpconn.SetWindowSize(config.SndWnd, config.RcvWnd)
-	kcpconn.SetMtu(config.MTU)
+	kcpconn.SetMtu(mtu)
 	kcpconn.SetACKNoDelay(config.AckNodelay)
+	mtuSetter.attach(kcpconn)
 
 	if config.DSCP > 0 {
 		if err := kcpconn.SetDSCP(config.DSCP); err != nil {
@@ -266,6 +329,50 @@ func (tr *kcpTransporter) initSession(addr string, conn net.Conn, config *KCPCon
 	return &muxSession{conn: conn, session: session}, nil
 }
 
+// kcpMTUSetter sets the path MTU found by the packet connection to the session,
+// the MTU found before the session is configured is set when it is attached.
+type kcpMTUSetter struct {
+	mux     sync.Mutex
+	session *kcp.UDPSession
+	pmtu    int
+}
+
+func (s *kcpMTUSetter) set(pmtu int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.pmtu = pmtu
+	if s.session != nil {
+		s.session.SetMtu(pmtu - udpOverhead(s.session.RemoteAddr()))
+	}
+}
+
+func (s *kcpMTUSetter) attach(session *kcp.UDPSession) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.session = session
+	if s.pmtu > 0 {
+		session.SetMtu(s.pmtu - udpOverhead(session.RemoteAddr()))
+	}
+}
+
+// kcpPathMTU returns the MTU of the KCP packets to the server, which is lower than the path MTU.
+func kcpPathMTU(addr string, mtu int) int {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return mtu
+	}
+	overhead := udpOverhead(raddr)
+	pmtu, err := discoverPathMTU(addr, 576, mtu+overhead)
+	if err != nil {
+		log.Log("[kcp] mtu:", err)
+		return mtu
+	}
+	if pmtu-overhead < mtu {
+		mtu = pmtu - overhead
+	}
+	return mtu
+}
+
 func (tr *kcpTransporter) Multiplex() bool {
 	return true
 }
@@ -0,0 +1,215 @@
+package gost
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// the frame types of KeepaliveConn.
+const (
+	keepaliveFrameData = 0x00
+	keepaliveFramePing = 0x01
+	keepaliveFramePong = 0x02
+)
+
+const keepaliveMaxPayload = 0xffff
+
+var errKeepaliveTimeout = errors.New("keepalive: ping timeout")
+
+// KeepaliveConn wraps the connection to keep it alive through the NAT devices and detect the dead peer.
+// A ping is sent every interval if no data has been written, the connection is closed if nothing is received
+// within pingTimeout after the ping, the peer answers a ping with a pong.
+//
+// Both sides of the connection must be wrapped, as the data is framed:
+//
+//	data: [0x00][2-byte length][payload]
+//	ping: [0x01][4-byte ID]
+//	pong: [0x02][4-byte ID, the same as the ping]
+func KeepaliveConn(conn net.Conn, interval time.Duration, pingTimeout time.Duration) net.Conn {
+	pr, pw := io.Pipe()
+	c := &keepaliveConn{
+		Conn:     conn,
+		interval: interval,
+		timeout:  pingTimeout,
+		pr:       pr,
+		pw:       pw,
+		pongs:    make(chan uint32, 16),
+		done:     make(chan struct{}),
+	}
+	now := time.Now().UnixNano()
+	c.lastWrite, c.lastRecv = now, now
+	go c.readLoop()
+	go c.controlLoop()
+	return c
+}
+
+type keepaliveConn struct {
+	net.Conn
+	interval time.Duration
+	timeout  time.Duration
+	wmux     sync.Mutex
+	pr       *io.PipeReader
+	pw       *io.PipeWriter
+	pingID   uint32
+	pongs    chan uint32 // the IDs of the pings to answer
+	done     chan struct{}
+	once     sync.Once
+
+	lastWrite  int64 // the time of the last write in unix nanoseconds
+	lastRecv   int64 // the time when the last frame is received
+	delivering int32 // the received data is waiting to be read by the caller
+}
+
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	return c.pr.Read(b)
+}
+
+func (c *keepaliveConn) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		p := b[n:]
+		if len(p) > keepaliveMaxPayload {
+			p = p[:keepaliveMaxPayload]
+		}
+		buf := make([]byte, 3+len(p))
+		buf[0] = keepaliveFrameData
+		binary.BigEndian.PutUint16(buf[1:], uint16(len(p)))
+		copy(buf[3:], p)
+		if err = c.writeFrame(buf); err != nil {
+			return
+		}
+		n += len(p)
+	}
+	return
+}
+
+func (c *keepaliveConn) writeFrame(b []byte) error {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	_, err := c.Conn.Write(b)
+	if err == nil && b[0] == keepaliveFrameData {
+		atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	}
+	return err
+}
+
+func (c *keepaliveConn) writeControl(typ byte, id uint32) error {
+	b := make([]byte, 5)
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:], id)
+	return c.writeFrame(b)
+}
+
+func (c *keepaliveConn) Close() error {
+	c.closeWithError(io.ErrClosedPipe)
+	return c.Conn.Close()
+}
+
+func (c *keepaliveConn) closeWithError(err error) {
+	c.once.Do(func() {
+		close(c.done)
+		// the pending and the later reads return err.
+		c.pw.CloseWithError(err)
+	})
+}
+
+func (c *keepaliveConn) readLoop() {
+	br := bufio.NewReader(c.Conn)
+	header := make([]byte, 5)
+	for {
+		err := func() error {
+			if _, err := io.ReadFull(br, header[:1]); err != nil {
+				return err
+			}
+			atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+
+			switch header[0] {
+			case keepaliveFrameData:
+				if _, err := io.ReadFull(br, header[1:3]); err != nil {
+					return err
+				}
+				atomic.StoreInt32(&c.delivering, 1)
+				defer atomic.StoreInt32(&c.delivering, 0)
+				_, err := io.CopyN(c.pw, br, int64(binary.BigEndian.Uint16(header[1:3])))
+				return err
+			case keepaliveFramePing, keepaliveFramePong:
+				if _, err := io.ReadFull(br, header[1:5]); err != nil {
+					return err
+				}
+				if header[0] == keepaliveFramePing {
+					// the pong is sent by the control loop, the reading is not blocked by the writing.
+					select {
+					case c.pongs <- binary.BigEndian.Uint32(header[1:5]):
+					default:
+					}
+				}
+				return nil
+			default:
+				return errors.New("keepalive: invalid frame")
+			}
+		}()
+		if err != nil {
+			c.closeWithError(err)
+			c.Conn.Close()
+			return
+		}
+	}
+}
+
+// controlLoop sends the pongs, and the pings if the connection is idle.
+func (c *keepaliveConn) controlLoop() {
+	var tick <-chan time.Time
+	if c.interval > 0 && c.timeout > 0 {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case id := <-c.pongs:
+			if err := c.writeControl(keepaliveFramePong, id); err != nil {
+				c.closeWithError(err)
+				c.Conn.Close()
+				return
+			}
+			continue
+		case <-tick:
+		case <-c.done:
+			return
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastWrite))) < c.interval {
+			continue
+		}
+
+		id := atomic.AddUint32(&c.pingID, 1)
+		sent := time.Now().UnixNano()
+		if err := c.writeControl(keepaliveFramePing, id); err != nil {
+			c.closeWithError(err)
+			c.Conn.Close()
+			return
+		}
+
+		time.AfterFunc(c.timeout, func() {
+			// any frame received after the ping is the proof of the peer, the data waiting for the caller too.
+			if atomic.LoadInt64(&c.lastRecv) >= sent || atomic.LoadInt32(&c.delivering) == 1 {
+				return
+			}
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			log.Logf("[keepalive] %s - %s : no pong of ping %d in %v", c.LocalAddr(), c.RemoteAddr(), id, c.timeout)
+			c.closeWithError(errKeepaliveTimeout)
+			c.Conn.Close()
+		})
+	}
+}
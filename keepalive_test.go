@@ -0,0 +1,75 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syncWriteRecorder copies the written data to w, which is read concurrently.
+type syncWriteRecorder struct {
+	net.Conn
+	w *syncBuffer
+}
+
+func (c *syncWriteRecorder) Write(b []byte) (int, error) {
+	c.w.Write(b)
+	return c.Conn.Write(b)
+}
+
+func TestKeepaliveConn(t *testing.T) {
+	c1, c2 := net.Pipe()
+	frames := &syncBuffer{}
+	client := KeepaliveConn(&syncWriteRecorder{Conn: c1, w: frames}, 20*time.Millisecond, 100*time.Millisecond)
+	server := KeepaliveConn(c2, 20*time.Millisecond, 100*time.Millisecond)
+	defer client.Close()
+	defer server.Close()
+
+	go server.Write([]byte("hello"))
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(client, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("got %q, want hello", b)
+	}
+
+	// the idle connection is kept alive by the pings.
+	time.Sleep(200 * time.Millisecond)
+	go client.Write([]byte("world"))
+	if _, err := io.ReadFull(server, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "world" {
+		t.Errorf("got %q, want world", b)
+	}
+	if !strings.Contains(frames.String(), string([]byte{keepaliveFramePing, 0, 0, 0, 1})) {
+		t.Errorf("no ping is sent: %x", frames.String())
+	}
+}
+
+func TestKeepaliveConnTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	// the peer reads the pings but never answers.
+	go io.Copy(io.Discard, c2)
+
+	client := KeepaliveConn(c1, 10*time.Millisecond, 30*time.Millisecond)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != errKeepaliveTimeout {
+			t.Errorf("got %v, want %v", err, errKeepaliveTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the dead connection is not closed")
+	}
+}
@@ -3,12 +3,50 @@ package gost
 import (
 	"fmt"
 	"log"
+	"os"
+	"sync"
 )
 
+var logFile struct {
+	mux  sync.Mutex
+	path string
+	file *os.File
+}
+
 func init() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 }
 
+// SetLogFile sets the output of the standard log package to the file, the logs are appended to it.
+func SetLogFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	logFile.mux.Lock()
+	defer logFile.mux.Unlock()
+	log.SetOutput(f)
+	if logFile.file != nil {
+		logFile.file.Close()
+	}
+	logFile.path, logFile.file = path, f
+	return nil
+}
+
+// ReopenLogFile reopens the log file set by SetLogFile, e.g. after it is rotated.
+// It does nothing if the log file is not set.
+func ReopenLogFile() error {
+	logFile.mux.Lock()
+	path := logFile.path
+	logFile.mux.Unlock()
+
+	if path == "" {
+		return nil
+	}
+	return SetLogFile(path)
+}
+
 // LogLogger uses the standard log package as the logger
 type LogLogger struct {
 }
@@ -0,0 +1,124 @@
+package gost
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// GzipLogRotator creates a io.Writer which appends the data to the file at path. If the size of the file exceeds
+// maxSizeMB megabytes, it is renamed with the suffix of the rotation time, e.g. access.log.20060102-150405.000,
+// and compressed to a gzip file in background. The file is not rotated if maxSizeMB is not positive.
+// The writer is also a io.Closer, Close closes the file and waits for the compression to finish.
+func GzipLogRotator(path string, maxSizeMB int) io.Writer {
+	return &gzipLogRotator{
+		path:    path,
+		maxSize: int64(maxSizeMB) << 20,
+	}
+}
+
+type gzipLogRotator struct {
+	path    string
+	maxSize int64
+
+	mux  sync.Mutex
+	file *os.File
+	size int64
+	wg   sync.WaitGroup // the compressions
+}
+
+func (r *gzipLogRotator) Write(b []byte) (n int, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.file == nil {
+		if err = r.open(); err != nil {
+			return
+		}
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(b)) > r.maxSize {
+		if err = r.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = r.file.Write(b)
+	r.size += int64(n)
+	return
+}
+
+func (r *gzipLogRotator) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.wg.Wait()
+	return err
+}
+
+func (r *gzipLogRotator) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, fi.Size()
+	return nil
+}
+
+func (r *gzipLogRotator) rotate() error {
+	r.file.Close()
+	r.file = nil
+
+	name := r.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(r.path, name); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := gzipFile(name); err != nil {
+			log.Logf("[log] compress %s: %v", name, err)
+		}
+	}()
+	return r.open()
+}
+
+// gzipFile compresses the file to name.gz, and removes it.
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
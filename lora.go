@@ -0,0 +1,416 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("lora", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			sf := node.GetInt("sf")
+			if sf == 0 {
+				sf = 7
+			}
+			bw, _ := strconv.ParseFloat(node.Get("bw"), 64)
+			if bw == 0 {
+				bw = 125
+			}
+			return LoRaTransporter(node.Get("port"), sf, bw), nil
+		},
+	})
+}
+
+const (
+	// loraMaxPacket is the max size of the LoRa packet, it is limited by the FIFO of the SX127x radios.
+	loraMaxPacket = 255
+	// loraHeaderLen is the size of the packet header: the type and the sequence number.
+	loraHeaderLen = 2
+	// loraMaxPayload is the max size of the payload carried by a data packet.
+	loraMaxPayload = loraMaxPacket - loraHeaderLen
+	// loraRetries is the max retransmissions of a data packet before the write fails.
+	loraRetries = 8
+)
+
+const (
+	loraData byte = iota
+	loraAck
+	loraFin
+)
+
+// ErrLoRaTimeout is returned by the write of the LoRa connection when a packet is not acknowledged
+// after the retransmissions.
+var ErrLoRaTimeout = errors.New("lora: packet is not acknowledged")
+
+// loraBitrate returns the raw bit rate of the LoRa modulation in bps for the spreading factor sf (7-12)
+// and the bandwidth bw in kHz, with the coding rate 4/5.
+func loraBitrate(sf int, bw float64) float64 {
+	return float64(sf) * bw * 1000 / math.Pow(2, float64(sf)) * 4 / 5
+}
+
+// loraAirtime returns the approximate time on air of the packet of n bytes.
+func loraAirtime(n int, sf int, bw float64) time.Duration {
+	bps := loraBitrate(sf, bw)
+	if bps <= 0 {
+		return 0
+	}
+	// the preamble and the PHY header take about 20 symbols.
+	symbol := math.Pow(2, float64(sf)) / (bw * 1000)
+	return time.Duration((float64(n*8)/bps + 20*symbol) * float64(time.Second))
+}
+
+// loraAddr is the address of the LoRa connection, it is the serial port of the LoRa module.
+type loraAddr string
+
+func (addr loraAddr) Network() string { return "lora" }
+func (addr loraAddr) String() string  { return string(addr) }
+
+// loraConn is a reliable stream over the LoRa packets.
+// The packets are framed on the serial link of the module by the length byte:
+//
+//	+-----+------+-----+---------+
+//	| LEN | TYPE | SEQ | PAYLOAD |
+//	+-----+------+-----+---------+
+//	   1     1      1    0 - 253
+//
+// The data packets are sent one at a time (stop-and-wait), each one is retransmitted
+// until the ACK of the same SEQ is received.
+type loraConn struct {
+	rw      io.ReadWriteCloser
+	addr    loraAddr
+	rto     time.Duration
+	sendSeq byte
+	recvSeq byte
+	wmux    sync.Mutex // serializes the writes of the data packets
+	fmux    sync.Mutex // serializes the writes of the frames to rw
+	acks    chan byte
+	rbuf    chan []byte
+	pending []byte
+	closed  chan struct{}
+	once    sync.Once
+	err     error
+
+	dmux          sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newLoRaConn(rw io.ReadWriteCloser, addr string, sf int, bw float64) *loraConn {
+	c := &loraConn{
+		rw:   rw,
+		addr: loraAddr(addr),
+		// the data packet of the max size and the ACK, with the time to process them by the modules.
+		rto:    2*(loraAirtime(loraMaxPacket+1, sf, bw)+loraAirtime(loraHeaderLen+1, sf, bw)) + 100*time.Millisecond,
+		acks:   make(chan byte, 16),
+		rbuf:   make(chan []byte, 64),
+		closed: make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *loraConn) writeFrame(typ, seq byte, payload []byte) error {
+	b := make([]byte, 1+loraHeaderLen+len(payload))
+	b[0] = byte(loraHeaderLen + len(payload))
+	b[1] = typ
+	b[2] = seq
+	copy(b[3:], payload)
+
+	c.fmux.Lock()
+	defer c.fmux.Unlock()
+	_, err := c.rw.Write(b)
+	return err
+}
+
+func (c *loraConn) readLoop() {
+	defer c.shutdown(io.EOF)
+
+	var hdr [1]byte
+	for {
+		if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+			return
+		}
+		n := int(hdr[0])
+		if n < loraHeaderLen {
+			continue
+		}
+		p := make([]byte, n)
+		if _, err := io.ReadFull(c.rw, p); err != nil {
+			return
+		}
+
+		switch typ, seq := p[0], p[1]; typ {
+		case loraData:
+			if seq == c.recvSeq {
+				select {
+				case c.rbuf <- p[loraHeaderLen:]:
+				case <-c.closed:
+					return
+				}
+				c.recvSeq++
+			}
+			// the duplicated packet is ACKed again as the previous ACK may be lost.
+			if err := c.writeFrame(loraAck, seq, nil); err != nil {
+				return
+			}
+		case loraAck:
+			select {
+			case c.acks <- seq:
+			default:
+			}
+		case loraFin:
+			return
+		}
+	}
+}
+
+func (c *loraConn) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.closed)
+		c.rw.Close()
+	})
+}
+
+func (c *loraConn) Read(b []byte) (n int, err error) {
+	if len(c.pending) == 0 {
+		c.dmux.Lock()
+		deadline := c.readDeadline
+		c.dmux.Unlock()
+
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case c.pending = <-c.rbuf:
+		case <-c.closed:
+			// drain the received data before EOF.
+			select {
+			case c.pending = <-c.rbuf:
+			default:
+				return 0, c.err
+			}
+		case <-timeout:
+			return 0, &net.OpError{Op: "read", Net: "lora", Err: os.ErrDeadlineExceeded}
+		}
+	}
+	n = copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return
+}
+
+func (c *loraConn) Write(b []byte) (n int, err error) {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	for len(b) > 0 {
+		m := len(b)
+		if m > loraMaxPayload {
+			m = loraMaxPayload
+		}
+		if err = c.send(b[:m]); err != nil {
+			return
+		}
+		n += m
+		b = b[m:]
+	}
+	return
+}
+
+// send sends the data packet and waits for the ACK, the packet is retransmitted on the RTO.
+func (c *loraConn) send(payload []byte) error {
+	c.dmux.Lock()
+	deadline := c.writeDeadline
+	c.dmux.Unlock()
+
+	seq := c.sendSeq
+	for i := 0; i <= loraRetries; i++ {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return &net.OpError{Op: "write", Net: "lora", Err: os.ErrDeadlineExceeded}
+		}
+		if err := c.writeFrame(loraData, seq, payload); err != nil {
+			return err
+		}
+
+		timer := time.NewTimer(c.rto)
+	wait:
+		for {
+			select {
+			case ack := <-c.acks:
+				if ack != seq {
+					// the late ACK of the previous packet.
+					continue
+				}
+				timer.Stop()
+				c.sendSeq++
+				return nil
+			case <-timer.C:
+				break wait
+			case <-c.closed:
+				timer.Stop()
+				return c.err
+			}
+		}
+	}
+	return ErrLoRaTimeout
+}
+
+func (c *loraConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		c.writeFrame(loraFin, 0, nil)
+	}
+	c.shutdown(errors.New("lora: use of closed connection"))
+	return nil
+}
+
+func (c *loraConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// RemoteAddr returns the serial port as well, the peer is any module on the same channel.
+func (c *loraConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *loraConn) SetDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+
+func (c *loraConn) SetReadDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *loraConn) SetWriteDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+type loraTransporter struct {
+	port string
+	sf   int
+	bw   float64
+}
+
+// LoRaTransporter creates a Transporter over the LoRa module (such as SX1278) attached to the serial port,
+// e.g. /dev/ttyUSB0 or COM3. The module must be in the transparent mode, and the spreading factor sf (7-12)
+// and the bandwidth bw in kHz (e.g. 125) must match the module settings, they are used for the retransmission timeout.
+// The Dial address is ignored, the connection goes to the module on the same channel. The chain is not used.
+//
+// The bandwidth of LoRa is about 250 bps - 50 kbps, it is only suitable for the control plane traffic.
+func LoRaTransporter(port string, sf int, bw float64) Transporter {
+	return &loraTransporter{
+		port: port,
+		sf:   sf,
+		bw:   bw,
+	}
+}
+
+func (tr *loraTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	if tr.sf < 6 || tr.sf > 12 || tr.bw <= 0 {
+		return nil, fmt.Errorf("lora: invalid spreading factor %d or bandwidth %gkHz", tr.sf, tr.bw)
+	}
+	rw, err := openLoRaSerial(tr.port)
+	if err != nil {
+		return nil, err
+	}
+	return newLoRaConn(rw, tr.port, tr.sf, tr.bw), nil
+}
+
+// openLoRaSerial opens the serial port of the LoRa module in 9600 8N1,
+// which is the default UART setting of the SX127x modules.
+func openLoRaSerial(port string) (io.ReadWriteCloser, error) {
+	return serial.Open(port, &serial.Mode{
+		BaudRate: 9600,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	})
+}
+
+func (tr *loraTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *loraTransporter) Multiplex() bool {
+	return false
+}
+
+// LoRaSimulator creates a pair of connected LoRa connections without hardware.
+// The radio link is simulated with the time on air of the spreading factor sf and the bandwidth bw in kHz,
+// and each packet is lost with the probability loss (0-1).
+func LoRaSimulator(sf int, bw float64, loss float64) (net.Conn, net.Conn) {
+	ab := make(chan []byte, 64)
+	ba := make(chan []byte, 64)
+	a := &loraSimRadio{in: ba, out: ab, sf: sf, bw: bw, loss: loss, closed: make(chan struct{})}
+	b := &loraSimRadio{in: ab, out: ba, sf: sf, bw: bw, loss: loss, closed: make(chan struct{})}
+	return newLoRaConn(a, "sim-a", sf, bw), newLoRaConn(b, "sim-b", sf, bw)
+}
+
+// loraSimRadio is the simulated serial link of the LoRa module, each Write is a packet on air.
+type loraSimRadio struct {
+	in      <-chan []byte
+	out     chan<- []byte
+	sf      int
+	bw      float64
+	loss    float64
+	pending []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (r *loraSimRadio) Read(b []byte) (int, error) {
+	for len(r.pending) == 0 {
+		select {
+		case r.pending = <-r.in:
+		case <-r.closed:
+			return 0, io.EOF
+		}
+	}
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *loraSimRadio) Write(b []byte) (int, error) {
+	select {
+	case <-r.closed:
+		return 0, io.ErrClosedPipe
+	case <-time.After(loraAirtime(len(b), r.sf, r.bw)):
+	}
+	if rand.Float64() < r.loss {
+		return len(b), nil
+	}
+	select {
+	case r.out <- append([]byte(nil), b...):
+	default: // the receiver is overrun, the packet is lost.
+	}
+	return len(b), nil
+}
+
+func (r *loraSimRadio) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,83 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLoRaAirtime(t *testing.T) {
+	// SF7/125kHz is about 5.5 kbps, SF12/125kHz is about 290 bps.
+	if bps := loraBitrate(7, 125); bps < 5400 || bps > 5500 {
+		t.Errorf("SF7/125kHz: got %.0f bps", bps)
+	}
+	if bps := loraBitrate(12, 125); bps < 280 || bps > 300 {
+		t.Errorf("SF12/125kHz: got %.0f bps", bps)
+	}
+	if loraAirtime(255, 12, 125) <= loraAirtime(255, 7, 125) {
+		t.Error("the airtime of SF12 should be longer than SF7")
+	}
+}
+
+func loraRoundtrip(t *testing.T, a, b io.ReadWriteCloser, size int) {
+	data := make([]byte, size)
+	rand.Read(data)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := a.Write(data)
+		errc <- err
+	}()
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(b, buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf) {
+		t.Error("data mismatch")
+	}
+}
+
+func TestLoRaSimulator(t *testing.T) {
+	a, b := LoRaSimulator(7, 500, 0)
+	defer a.Close()
+	defer b.Close()
+
+	loraRoundtrip(t, a, b, 600)
+	loraRoundtrip(t, b, a, 100)
+}
+
+func TestLoRaSimulatorLoss(t *testing.T) {
+	a, b := LoRaSimulator(7, 500, 0.2)
+	defer a.Close()
+	defer b.Close()
+
+	loraRoundtrip(t, a, b, 1000)
+}
+
+func TestLoRaClose(t *testing.T) {
+	a, b := LoRaSimulator(7, 500, 0)
+	a.Close()
+
+	b.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := b.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+	if _, err := a.Write([]byte("hello")); err == nil {
+		t.Error("should not write to the closed connection")
+	}
+}
+
+func TestLoRaTransporter(t *testing.T) {
+	if _, err := LoRaTransporter("/dev/null", 13, 125).Dial(""); err == nil {
+		t.Error("should not dial with the invalid spreading factor")
+	}
+	if _, err := LoRaTransporter("/nonexistent/ttyUSB0", 7, 125).Dial(""); err == nil {
+		t.Error("should not dial with the nonexistent port")
+	}
+}
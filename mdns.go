@@ -0,0 +1,205 @@
+package gost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/grandcat/zeroconf"
+)
+
+const mdnsDomain = "local."
+
+// MDNSAdvertise announces the gost node listening on addr as an instance of the service serviceName
+// (e.g. '_gost._tcp') via mDNS. If the host of addr is empty or unspecified,
+// all the addresses of the host are announced.
+// The announcement is stopped when the returned Closer is closed.
+func MDNSAdvertise(serviceName, addr string) (io.Closer, error) {
+	host, sport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(sport)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "gost"
+	}
+	instance := fmt.Sprintf("%s-%d", hostname, port)
+
+	var server *zeroconf.Server
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		server, err = zeroconf.Register(instance, serviceName, mdnsDomain, port, nil, nil)
+	} else {
+		server, err = zeroconf.RegisterProxy(instance, serviceName, mdnsDomain, port,
+			hostname, []string{ip.String()}, nil, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if Debug {
+		log.Logf("[mdns] advertise %s.%s%s on port %d", instance, serviceName, mdnsDomain, port)
+	}
+	return &mdnsCloser{server: server}, nil
+}
+
+type mdnsCloser struct {
+	server *zeroconf.Server
+}
+
+func (c *mdnsCloser) Close() error {
+	c.server.Shutdown()
+	return nil
+}
+
+// MDNSDiscover browses the instances of the service serviceName via mDNS for the timeout,
+// and returns the addresses (host:port) of the nodes discovered.
+func MDNSDiscover(serviceName string, timeout time.Duration) ([]string, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, serviceName, mdnsDomain, entries); err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	found := make(map[string]bool)
+	for entry := range entries {
+		ips := append(entry.AddrIPv4, entry.AddrIPv6...)
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip.String(), strconv.Itoa(entry.Port))
+			if found[addr] {
+				continue
+			}
+			found[addr] = true
+			addrs = append(addrs, addr)
+			if Debug {
+				log.Logf("[mdns] discover %s: %s", entry.Instance, addr)
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// mdnsListener stops the mDNS announcement when the listener is closed.
+type mdnsListener struct {
+	Listener
+	advertiser io.Closer
+}
+
+func (l *mdnsListener) Close() error {
+	l.advertiser.Close()
+	return l.Listener.Close()
+}
+
+const (
+	defaultMDNSTimeout = time.Second
+	defaultMDNSPeriod  = time.Minute
+)
+
+// mdnsDiscoverer discovers the nodes of the service via mDNS periodically,
+// the discovered nodes are put after the base nodes of the group as the backups.
+type mdnsDiscoverer struct {
+	service   string
+	timeout   time.Duration
+	period    time.Duration
+	group     *NodeGroup
+	baseNodes []Node
+}
+
+func newMDNSDiscoverer(group *NodeGroup, baseNodes []Node) *mdnsDiscoverer {
+	node := baseNodes[0]
+	d := &mdnsDiscoverer{
+		service:   node.Get("mdns"),
+		timeout:   node.GetDuration("mdns_timeout"),
+		period:    node.GetDuration("mdns_period"),
+		group:     group,
+		baseNodes: baseNodes,
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultMDNSTimeout
+	}
+	if d.period <= 0 {
+		d.period = defaultMDNSPeriod
+	}
+	return d
+}
+
+// Run discovers the nodes until the process exits.
+func (d *mdnsDiscoverer) Run() {
+	for {
+		if err := d.discover(); err != nil {
+			log.Logf("[mdns] discover %s: %v", d.service, err)
+		}
+		time.Sleep(d.period)
+	}
+}
+
+func (d *mdnsDiscoverer) discover() error {
+	addrs, err := MDNSDiscover(d.service, d.timeout)
+	if err != nil {
+		return err
+	}
+
+	known := resolveNodeAddrs(d.baseNodes)
+	nodes := append([]Node{}, d.baseNodes...)
+	nid := len(d.baseNodes) + 1
+	for _, addr := range addrs {
+		if known[addr] {
+			continue
+		}
+		known[addr] = true
+
+		base := d.baseNodes[0]
+		nd := base.Clone()
+		nd.ID = nid
+		nid++
+		nd.Addr = addr
+		nd.HandshakeOptions = append(append([]HandshakeOption{}, base.HandshakeOptions...),
+			AddrHandshakeOption(addr))
+		if nd.Transport == "obfs4" {
+			if err := Obfs4Init(nd, false); err != nil {
+				return err
+			}
+		}
+		nodes = append(nodes, nd)
+	}
+	d.group.SetNodes(nodes...)
+	return nil
+}
+
+// resolveNodeAddrs returns the addresses (ip:port) of the nodes,
+// the hostnames are resolved so the base nodes are not discovered again.
+func resolveNodeAddrs(nodes []Node) map[string]bool {
+	addrs := make(map[string]bool)
+	for _, node := range nodes {
+		addrs[node.Addr] = true
+
+		host, port, err := net.SplitHostPort(node.Addr)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			addrs[net.JoinHostPort(ip.String(), port)] = true
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,33 @@
+package gost
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMDNSDiscover(t *testing.T) {
+	service := "_gost-test._tcp"
+	closer, err := MDNSAdvertise(service, "127.0.0.1:18080")
+	if err != nil {
+		t.Skip("mdns:", err)
+	}
+	defer closer.Close()
+
+	addrs, err := MDNSDiscover(service, 2*time.Second)
+	if err != nil {
+		t.Skip("mdns:", err)
+	}
+	if len(addrs) == 0 {
+		t.Skip("mdns: no multicast route")
+	}
+
+	var found bool
+	for _, addr := range addrs {
+		if addr == "127.0.0.1:18080" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("127.0.0.1:18080 not found in %v", addrs)
+	}
+}
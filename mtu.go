@@ -0,0 +1,215 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+var (
+	// mtuCacheTTL is the lifetime of the discovered path MTU of the destinations.
+	mtuCacheTTL = 10 * time.Minute
+	// mtuProbeWait is the time waiting for the ICMP feedback of each probe.
+	mtuProbeWait = 20 * time.Millisecond
+)
+
+var pathMTUCache = &mtuCache{m: make(map[string]mtuCacheEntry)}
+
+type mtuCacheEntry struct {
+	mtu     int
+	expires time.Time
+}
+
+// mtuCache caches the path MTU of the destination hosts.
+type mtuCache struct {
+	mux sync.Mutex
+	m   map[string]mtuCacheEntry
+}
+
+func (c *mtuCache) get(host string) (int, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, ok := c.m[host]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.m, host)
+		return 0, false
+	}
+	return e.mtu, true
+}
+
+func (c *mtuCache) set(host string, mtu int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.m[host] = mtuCacheEntry{mtu: mtu, expires: time.Now().Add(mtuCacheTTL)}
+}
+
+// udpOverhead returns the size of the IP and UDP headers of the address.
+func udpOverhead(addr net.Addr) int {
+	if ua, ok := addr.(*net.UDPAddr); ok && ua.IP.To4() == nil {
+		return 48
+	}
+	return 28
+}
+
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// MTUDiscovery finds the path MTU (including the IP and UDP headers) to the peer of the connected UDP connection
+// in the range [minMTU, maxMTU] by binary search. The probes are sent with the Don't Fragment flag,
+// a probe is too big if it is rejected with EMSGSIZE, or the ICMP feedback (the Fragmentation Needed or
+// Packet Too Big message) reduces the path MTU known by the kernel below it.
+//
+// The result is cached for the peer host for 10 minutes. It is only supported on Linux.
+func MTUDiscovery(conn net.Conn, minMTU, maxMTU int) (int, error) {
+	if minMTU <= 0 || maxMTU < minMTU {
+		return 0, errors.New("mtu: invalid range")
+	}
+	host := addrHost(conn.RemoteAddr())
+	if mtu, ok := pathMTUCache.get(host); ok {
+		return mtu, nil
+	}
+
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("mtu: not a UDP connection")
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	if err := setDontFragment(rc, true); err != nil {
+		return 0, err
+	}
+
+	overhead := udpOverhead(conn.RemoteAddr())
+	lo, hi := minMTU, maxMTU
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if probeMTU(conn, rc, mid, overhead) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	pathMTUCache.set(host, lo)
+	if Debug {
+		log.Logf("[mtu] %s: path MTU %d", host, lo)
+	}
+	return lo, nil
+}
+
+func probeMTU(conn net.Conn, rc syscall.RawConn, mtu, overhead int) bool {
+	size := mtu - overhead
+	if size <= 0 {
+		return true
+	}
+	if _, err := conn.Write(make([]byte, size)); err != nil && isEMSGSIZE(err) {
+		return false
+	}
+	time.Sleep(mtuProbeWait)
+	if pmtu, err := pathMTU(rc); err == nil && pmtu < mtu {
+		return false
+	}
+	return true
+}
+
+func isEMSGSIZE(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+// discoverPathMTU discovers the path MTU to the host of addr. The probes are sent to the discard port of the host,
+// so they are not received by the server.
+func discoverPathMTU(addr string, minMTU, maxMTU int) (int, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	if mtu, ok := pathMTUCache.get(host); ok {
+		return mtu, nil
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(9)))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return MTUDiscovery(conn, minMTU, maxMTU)
+}
+
+// mtuPacketConn sends the packets with the Don't Fragment flag. If a packet is rejected with EMSGSIZE,
+// it reduces the path MTU of the destination and calls onMTU with it, so the frame size can be reduced,
+// and then the packet is sent again with the fragmentation allowed.
+type mtuPacketConn struct {
+	net.PacketConn
+	rc    syscall.RawConn
+	mux   sync.RWMutex
+	onMTU func(mtu int)
+}
+
+func newMTUPacketConn(pc net.PacketConn, onMTU func(mtu int)) (net.PacketConn, error) {
+	sc, ok := pc.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("mtu: not a UDP connection")
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	if err := setDontFragment(rc, true); err != nil {
+		return nil, err
+	}
+	return &mtuPacketConn{PacketConn: pc, rc: rc, onMTU: onMTU}, nil
+}
+
+func (c *mtuPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mux.RLock()
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.mux.RUnlock()
+	if err == nil || !isEMSGSIZE(err) {
+		return n, err
+	}
+
+	mtu := len(b) + udpOverhead(addr)
+	if pmtu, er := queryPathMTU(addr); er == nil && pmtu < mtu {
+		mtu = pmtu
+	} else {
+		mtu -= mtu / 10
+	}
+	pathMTUCache.set(addrHost(addr), mtu)
+	log.Logf("[mtu] %s: path MTU is reduced to %d", addr, mtu)
+	if c.onMTU != nil {
+		c.onMTU(mtu)
+	}
+
+	// the fragment is requeued, allowing the fragmentation.
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err := setDontFragment(c.rc, false); err != nil {
+		return 0, err
+	}
+	defer setDontFragment(c.rc, true)
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// queryPathMTU returns the path MTU to the addr known by the kernel.
+func queryPathMTU(addr net.Addr) (int, error) {
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	rc, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	return pathMTU(rc)
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the Don't Fragment flag of the packets (IP_PMTUDISC_DO),
+// or allows the fragmentation (IP_PMTUDISC_WANT). Both the IPv4 and IPv6 options are set for the dual-stack socket.
+func setDontFragment(rc syscall.RawConn, on bool) error {
+	v4, v6 := unix.IP_PMTUDISC_WANT, unix.IPV6_PMTUDISC_WANT
+	if on {
+		v4, v6 = unix.IP_PMTUDISC_DO, unix.IPV6_PMTUDISC_DO
+	}
+	var err4, err6 error
+	err := rc.Control(func(fd uintptr) {
+		err4 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, v4)
+		err6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, v6)
+	})
+	if err != nil {
+		return err
+	}
+	if err4 != nil && err6 != nil {
+		return err4
+	}
+	return nil
+}
+
+// pathMTU returns the path MTU of the connected socket.
+func pathMTU(rc syscall.RawConn) (mtu int, err error) {
+	e := rc.Control(func(fd uintptr) {
+		mtu, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU)
+		if err != nil {
+			mtu, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU)
+		}
+	})
+	if e != nil {
+		return 0, e
+	}
+	return
+}
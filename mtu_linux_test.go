@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMTUDiscovery(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	defer func(d time.Duration) { mtuProbeWait = d }(mtuProbeWait)
+	mtuProbeWait = 0
+	pathMTUCache.mux.Lock()
+	delete(pathMTUCache.m, "127.0.0.1")
+	pathMTUCache.mux.Unlock()
+
+	mtu, err := MTUDiscovery(conn, 576, 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu != 1500 {
+		t.Errorf("mtu %d, want 1500", mtu)
+	}
+	// the cached result.
+	if mtu, err := MTUDiscovery(conn, 576, 9000); err != nil || mtu != 1500 {
+		t.Errorf("cached mtu %d: %v", mtu, err)
+	}
+
+	// the max UDP payload over IPv4 is 65507.
+	pathMTUCache.mux.Lock()
+	delete(pathMTUCache.m, "127.0.0.1")
+	pathMTUCache.mux.Unlock()
+	if mtu, err := MTUDiscovery(conn, 576, 70000); err != nil || mtu != 65507+28 {
+		t.Errorf("mtu %d: %v", mtu, err)
+	}
+
+	if _, err := MTUDiscovery(conn, 1500, 576); err == nil {
+		t.Error("should fail with the invalid range")
+	}
+}
+
+func TestMTUPacketConn(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reduced int
+	mpc, err := newMTUPacketConn(pc, func(mtu int) { reduced = mtu })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpc.Close()
+
+	if _, err := mpc.WriteTo(make([]byte, 1000), server.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if reduced != 0 {
+		t.Errorf("mtu should not be reduced, got %d", reduced)
+	}
+
+	// the packet is too big for UDP, it can not be sent even if fragmented.
+	if _, err := mpc.WriteTo(make([]byte, 70000), server.LocalAddr()); err == nil {
+		t.Error("should fail with the oversize packet")
+	}
+	if reduced <= 0 || reduced >= 70000+28 {
+		t.Errorf("reduced mtu %d", reduced)
+	}
+}
+
+func TestKCPMTUDiscovery(t *testing.T) {
+	ln, err := KCPListener("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultKCPConfig
+	config.MTUDiscovery = true
+	r, err := BenchmarkTransport(context.Background(), KCPTransporter(&config), ln, BenchmarkOptions{
+		MessageSize: 4096,
+		Messages:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Messages != 10 || r.Errors != 0 {
+		t.Errorf("result %v", r)
+	}
+}
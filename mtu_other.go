@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package gost
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setDontFragment(rc syscall.RawConn, on bool) error {
+	return errors.New("mtu: path MTU discovery is not available on this platform")
+}
+
+func pathMTU(rc syscall.RawConn) (int, error) {
+	return 0, errors.New("mtu: path MTU discovery is not available on this platform")
+}
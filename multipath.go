@@ -0,0 +1,359 @@
+package gost
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	multiPathData = 0
+	multiPathPing = 1
+	multiPathPong = 2
+
+	// multiPathHeaderSize is the header of the frames: [type][sequence (4 bytes)][length (2 bytes)].
+	multiPathHeaderSize = 7
+	multiPathMaxData    = 16 * 1024
+)
+
+// MultiPathPingInterval is the interval of the pings of the paths of MultiPathConn to measure the RTT.
+var MultiPathPingInterval = time.Second
+
+var errMultiPathClosed = errors.New("multipath: connection closed")
+
+// PathStats is the stats of a path of MultiPathConn for the Scheduler.
+type PathStats struct {
+	// RTT is the smoothed RTT of the path, it is zero before the first pong.
+	RTT time.Duration
+	// Sent is the bytes of the data sent by the path.
+	Sent int64
+	// Alive is false if the path is broken.
+	Alive bool
+}
+
+// Scheduler selects the path of MultiPathConn to send the data.
+type Scheduler interface {
+	// Schedule returns the index of the path in paths, at least one of them is alive.
+	Schedule(paths []PathStats) int
+}
+
+// RoundRobinScheduler is a Scheduler that sends the data by the alive paths in turn.
+type RoundRobinScheduler struct {
+	counter uint64
+}
+
+// Schedule selects the next alive path.
+func (s *RoundRobinScheduler) Schedule(paths []PathStats) int {
+	n := atomic.AddUint64(&s.counter, 1) - 1
+	for i := range paths {
+		if j := int((n + uint64(i)) % uint64(len(paths))); paths[j].Alive {
+			return j
+		}
+	}
+	return 0
+}
+
+// MinRTTScheduler is a Scheduler that sends the data by the alive path with the min RTT.
+// The paths without RTT are used in turn until they are measured.
+type MinRTTScheduler struct {
+	rr RoundRobinScheduler
+}
+
+// Schedule selects the alive path with the min RTT.
+func (s *MinRTTScheduler) Schedule(paths []PathStats) int {
+	best := -1
+	for i, p := range paths {
+		if !p.Alive {
+			continue
+		}
+		if p.RTT == 0 {
+			return s.rr.Schedule(paths)
+		}
+		if best < 0 || p.RTT < paths[best].RTT {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0
+	}
+	return best
+}
+
+type multiPath struct {
+	conn  net.Conn
+	wmux  sync.Mutex
+	rtt   int64 // the smoothed RTT in nanoseconds
+	sent  int64
+	alive int32
+}
+
+func (p *multiPath) writeFrame(typ byte, seq uint32, data []byte) error {
+	b := make([]byte, multiPathHeaderSize+len(data))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:], seq)
+	binary.BigEndian.PutUint16(b[5:], uint16(len(data)))
+	copy(b[multiPathHeaderSize:], data)
+
+	p.wmux.Lock()
+	defer p.wmux.Unlock()
+	_, err := p.conn.Write(b)
+	return err
+}
+
+type multiPathConn struct {
+	paths     []*multiPath
+	scheduler Scheduler
+
+	wmux    sync.Mutex
+	sendSeq uint32
+
+	rmux     sync.Mutex
+	recvSeq  uint32
+	pending  map[uint32][]byte // the frames received out of order
+	rbuf     []byte
+	dead     int // the number of the broken paths
+	err      error
+	notify   chan struct{}
+	deadline atomic.Value // time.Time, the read deadline
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// MultiPathConn creates a connection that aggregates the connections to the same peer as the paths, such as the
+// connections by the different network interfaces. The peer wraps its connections by MultiPathConn in the same order.
+// The data is split to the frames with the sequence numbers, each frame is sent by a path selected by the scheduler
+// (RoundRobinScheduler if nil), and the frames are reassembled in order by the peer. The RTT of the paths
+// is measured by the pings every MultiPathPingInterval.
+//
+// A broken path is not selected any more, but the frames sent by it are lost, the other paths can not
+// retransmit them, so the reading stalls until the deadline. Close closes all the connections.
+func MultiPathConn(conns []net.Conn, scheduler Scheduler) net.Conn {
+	if scheduler == nil {
+		scheduler = &RoundRobinScheduler{}
+	}
+	c := &multiPathConn{
+		scheduler: scheduler,
+		pending:   make(map[uint32][]byte),
+		notify:    make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+	c.deadline.Store(time.Time{})
+	for _, conn := range conns {
+		p := &multiPath{conn: conn, alive: 1}
+		c.paths = append(c.paths, p)
+	}
+	for _, p := range c.paths {
+		go c.readLoop(p)
+		go c.pingLoop(p)
+	}
+	return c
+}
+
+func (c *multiPathConn) readLoop(p *multiPath) {
+	header := make([]byte, multiPathHeaderSize)
+	for {
+		if _, err := io.ReadFull(p.conn, header); err != nil {
+			c.pathDown(p, err)
+			return
+		}
+		seq := binary.BigEndian.Uint32(header[1:])
+		data := make([]byte, binary.BigEndian.Uint16(header[5:]))
+		if _, err := io.ReadFull(p.conn, data); err != nil {
+			c.pathDown(p, err)
+			return
+		}
+
+		switch header[0] {
+		case multiPathData:
+			c.deliver(seq, data)
+		case multiPathPing:
+			go p.writeFrame(multiPathPong, seq, data)
+		case multiPathPong:
+			if len(data) == 8 {
+				sample := time.Now().UnixNano() - int64(binary.BigEndian.Uint64(data))
+				if rtt := atomic.LoadInt64(&p.rtt); rtt > 0 {
+					sample = (rtt*7 + sample) / 8
+				}
+				atomic.StoreInt64(&p.rtt, sample)
+			}
+		}
+	}
+}
+
+func (c *multiPathConn) pingLoop(p *multiPath) {
+	ticker := time.NewTicker(MultiPathPingInterval)
+	defer ticker.Stop()
+	for {
+		ts := make([]byte, 8)
+		binary.BigEndian.PutUint64(ts, uint64(time.Now().UnixNano()))
+		if err := p.writeFrame(multiPathPing, 0, ts); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *multiPathConn) pathDown(p *multiPath, err error) {
+	if !atomic.CompareAndSwapInt32(&p.alive, 1, 0) {
+		return
+	}
+	c.rmux.Lock()
+	c.dead++
+	if c.dead == len(c.paths) && c.err == nil {
+		c.err = err
+	}
+	c.rmux.Unlock()
+	c.wakeup()
+}
+
+func (c *multiPathConn) deliver(seq uint32, data []byte) {
+	c.rmux.Lock()
+	if seq == c.recvSeq {
+		c.rbuf = append(c.rbuf, data...)
+		c.recvSeq++
+		for {
+			b, ok := c.pending[c.recvSeq]
+			if !ok {
+				break
+			}
+			delete(c.pending, c.recvSeq)
+			c.rbuf = append(c.rbuf, b...)
+			c.recvSeq++
+		}
+	} else {
+		c.pending[seq] = data
+	}
+	c.rmux.Unlock()
+	c.wakeup()
+}
+
+func (c *multiPathConn) wakeup() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (c *multiPathConn) Read(b []byte) (n int, err error) {
+	for {
+		c.rmux.Lock()
+		if len(c.rbuf) > 0 {
+			n = copy(b, c.rbuf)
+			c.rbuf = c.rbuf[n:]
+			c.rmux.Unlock()
+			return
+		}
+		err = c.err
+		c.rmux.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if d := c.deadline.Load().(time.Time); !d.IsZero() {
+			if time.Until(d) <= 0 {
+				return 0, &net.OpError{Op: "read", Net: "multipath", Err: os.ErrDeadlineExceeded}
+			}
+			timer = time.NewTimer(time.Until(d))
+			timeout = timer.C
+		}
+		select {
+		case <-c.notify:
+		case <-timeout:
+		case <-c.closed:
+			err = errMultiPathClosed
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *multiPathConn) Write(b []byte) (n int, err error) {
+	for n < len(b) {
+		data := b[n:]
+		if len(data) > multiPathMaxData {
+			data = data[:multiPathMaxData]
+		}
+
+		c.wmux.Lock()
+		stats := make([]PathStats, len(c.paths))
+		var alive bool
+		for i, p := range c.paths {
+			stats[i] = PathStats{
+				RTT:   time.Duration(atomic.LoadInt64(&p.rtt)),
+				Sent:  atomic.LoadInt64(&p.sent),
+				Alive: atomic.LoadInt32(&p.alive) == 1,
+			}
+			alive = alive || stats[i].Alive
+		}
+		if !alive {
+			c.wmux.Unlock()
+			return n, errMultiPathClosed
+		}
+		p := c.paths[c.scheduler.Schedule(stats)]
+		seq := c.sendSeq
+		c.sendSeq++
+		c.wmux.Unlock()
+
+		if err = p.writeFrame(multiPathData, seq, data); err != nil {
+			return
+		}
+		atomic.AddInt64(&p.sent, int64(len(data)))
+		n += len(data)
+	}
+	return
+}
+
+func (c *multiPathConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		for _, p := range c.paths {
+			if e := p.conn.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+func (c *multiPathConn) LocalAddr() net.Addr {
+	return c.paths[0].conn.LocalAddr()
+}
+
+func (c *multiPathConn) RemoteAddr() net.Addr {
+	return c.paths[0].conn.RemoteAddr()
+}
+
+func (c *multiPathConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *multiPathConn) SetReadDeadline(t time.Time) error {
+	c.deadline.Store(t)
+	c.wakeup()
+	return nil
+}
+
+func (c *multiPathConn) SetWriteDeadline(t time.Time) error {
+	for _, p := range c.paths {
+		p.conn.SetWriteDeadline(t)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delayConn delays the writes to simulate a path of the high latency.
+type delayConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *delayConn) Write(b []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Write(b)
+}
+
+// multiPathTestPair creates the multipath connections of two loopback paths,
+// the second path is delayed by delay.
+func multiPathTestPair(t *testing.T, scheduler func() Scheduler, delay time.Duration) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	a1, b1 := tcpConnPair(t, ln)
+	a2, b2 := tcpConnPair(t, ln)
+	a := MultiPathConn([]net.Conn{a1, &delayConn{Conn: a2, delay: delay}}, scheduler())
+	b := MultiPathConn([]net.Conn{b1, &delayConn{Conn: b2, delay: delay}}, scheduler())
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func multiPathEcho(t *testing.T, a, b net.Conn, data []byte) {
+	go io.Copy(b, b)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := a.Write(data)
+		errc <- err
+	}()
+	a.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(a, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the data is not reassembled in order")
+	}
+}
+
+func TestMultiPathConnRoundRobin(t *testing.T) {
+	a, b := multiPathTestPair(t, func() Scheduler { return &RoundRobinScheduler{} }, 5*time.Millisecond)
+
+	data := make([]byte, 256*1024)
+	rand.Read(data)
+	multiPathEcho(t, a, b, data)
+
+	for i, p := range a.(*multiPathConn).paths {
+		if n := atomic.LoadInt64(&p.sent); n != int64(len(data)/2) {
+			t.Errorf("path #%d sent %d bytes, want %d", i, n, len(data)/2)
+		}
+	}
+}
+
+func TestMultiPathConnMinRTT(t *testing.T) {
+	a, b := multiPathTestPair(t, func() Scheduler { return &MinRTTScheduler{} }, 50*time.Millisecond)
+
+	// wait for the RTT of the paths.
+	paths := a.(*multiPathConn).paths
+	for i := 0; i < 100 && (atomic.LoadInt64(&paths[0].rtt) == 0 || atomic.LoadInt64(&paths[1].rtt) == 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rtt0, rtt1 := atomic.LoadInt64(&paths[0].rtt), atomic.LoadInt64(&paths[1].rtt); rtt0 == 0 || rtt0 >= rtt1 {
+		t.Fatalf("unexpected RTT %v, %v", time.Duration(rtt0), time.Duration(rtt1))
+	}
+
+	data := make([]byte, 256*1024)
+	rand.Read(data)
+	multiPathEcho(t, a, b, data)
+
+	if fast, slow := atomic.LoadInt64(&paths[0].sent), atomic.LoadInt64(&paths[1].sent); fast != int64(len(data)) || slow != 0 {
+		t.Errorf("the fast path sent %d bytes, the slow path sent %d bytes", fast, slow)
+	}
+}
+
+func TestMultiPathConnClose(t *testing.T) {
+	a, b := multiPathTestPair(t, func() Scheduler { return nil }, 0)
+
+	if _, err := a.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+
+	b.SetReadDeadline(time.Now().Add(3 * time.Second))
+	got, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("got %q, want hello", got)
+	}
+	if _, err := a.Write([]byte("hello")); err == nil {
+		t.Error("write after close should failed")
+	}
+}
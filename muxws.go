@@ -0,0 +1,323 @@
+package gost
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/yamux"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("muxws", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return MuxWSTransporter(nil), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return MuxWSListener(node.Addr, nil, opts.WSOptions)
+		},
+	})
+	DefaultRegistry.RegisterTransport("muxwss", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			tlsConfig := opts.TLSConfig
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{InsecureSkipVerify: true}
+			}
+			return MuxWSTransporter(tlsConfig), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			tlsConfig := opts.TLSConfig
+			if tlsConfig == nil {
+				tlsConfig = DefaultTLSConfig
+			}
+			return MuxWSListener(node.Addr, tlsConfig, opts.WSOptions)
+		},
+		TLS: true,
+	})
+}
+
+func muxWSConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = io.Discard
+	return config
+}
+
+type muxWSTransporter struct {
+	tlsConfig    *tls.Config
+	sessions     map[string]*muxWSSession
+	sessionMutex sync.Mutex
+}
+
+// MuxWSTransporter creates a Transporter that multiplexes the proxy streams over one websocket connection
+// per server by yamux. The websocket is established over TLS if tlsCfg is not nil.
+// The connection is established on the first use, and re-established with the exponential backoff within
+// the dial timeout if it drops. The server is MuxWSListener.
+func MuxWSTransporter(tlsCfg *tls.Config) Transporter {
+	return &muxWSTransporter{
+		tlsConfig: tlsCfg,
+		sessions:  make(map[string]*muxWSSession),
+	}
+}
+
+func (tr *muxWSTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	tr.sessionMutex.Lock()
+	session, ok := tr.sessions[addr]
+	reconnect := false
+	if ok && session.session.IsClosed() {
+		delete(tr.sessions, addr)
+		ok = false
+		reconnect = true
+	}
+	tr.sessionMutex.Unlock()
+	if ok {
+		return &muxWSSessionConn{Conn: session.conn, session: session.session}, nil
+	}
+	// the websocket is established by Handshake.
+	return dialMWS(addr, opts, reconnect)
+}
+
+func (tr *muxWSTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	if sc, ok := conn.(*muxWSSessionConn); ok {
+		stream, err := sc.session.OpenStream()
+		if err != nil {
+			sc.session.Close()
+			return nil, err
+		}
+		return stream, nil
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	session, err := tr.initSession(conn, opts)
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tr.sessionMutex.Lock()
+	if s, ok := tr.sessions[opts.Addr]; ok && !s.session.IsClosed() {
+		// the session was established by another stream meanwhile.
+		session.session.Close()
+		session = s
+	} else {
+		tr.sessions[opts.Addr] = session
+	}
+	tr.sessionMutex.Unlock()
+
+	stream, err := session.session.OpenStream()
+	if err != nil {
+		session.session.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (tr *muxWSTransporter) initSession(conn net.Conn, opts *HandshakeOptions) (*muxWSSession, error) {
+	wsOptions := opts.WSOptions
+	if wsOptions == nil {
+		wsOptions = &WSOptions{}
+	}
+	path := wsOptions.Path
+	if path == "" {
+		path = defaultWSPath
+	}
+
+	scheme := "ws"
+	tlsConfig := tr.tlsConfig
+	if tlsConfig != nil {
+		scheme = "wss"
+		if opts.TLSConfig != nil {
+			tlsConfig = opts.TLSConfig
+		}
+	}
+	url := url.URL{Scheme: scheme, Host: opts.Host, Path: path}
+	conn, err := websocketClientConn(url.String(), conn, tlsConfig, wsOptions)
+	if err != nil {
+		return nil, err
+	}
+	session, err := yamux.Client(conn, muxWSConfig())
+	if err != nil {
+		return nil, err
+	}
+	return &muxWSSession{conn: conn, session: session}, nil
+}
+
+func (tr *muxWSTransporter) Multiplex() bool {
+	return true
+}
+
+type muxWSSession struct {
+	conn    net.Conn
+	session *yamux.Session
+}
+
+// muxWSSessionConn is the websocket connection of an established session returned by Dial.
+// Closing it or setting its deadlines does not affect the session shared by the other streams.
+type muxWSSessionConn struct {
+	net.Conn
+	session *yamux.Session
+}
+
+func (c *muxWSSessionConn) Close() error {
+	return nil
+}
+
+func (c *muxWSSessionConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *muxWSSessionConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *muxWSSessionConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type muxWSListener struct {
+	addr     net.Addr
+	upgrader *websocket.Upgrader
+	srv      *http.Server
+	connChan chan net.Conn
+	errChan  chan error
+}
+
+// MuxWSListener creates a Listener for the server of MuxWSTransporter.
+// The websocket is served over TLS by tlsConfig if it is not nil.
+func MuxWSListener(addr string, tlsConfig *tls.Config, options *WSOptions) (Listener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &WSOptions{}
+	}
+	l := &muxWSListener{
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:    options.ReadBufferSize,
+			WriteBufferSize:   options.WriteBufferSize,
+			CheckOrigin:       func(r *http.Request) bool { return true },
+			EnableCompression: options.EnableCompression,
+		},
+		connChan: make(chan net.Conn, 1024),
+		errChan:  make(chan error, 1),
+	}
+
+	path := options.Path
+	if path == "" {
+		path = defaultWSPath
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, http.HandlerFunc(l.upgrade))
+	l.srv = &http.Server{
+		Addr:              addr,
+		TLSConfig:         tlsConfig,
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	ln, err := net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		return nil, err
+	}
+	l.addr = ln.Addr()
+
+	var sl net.Listener = tcpKeepAliveListener{ln}
+	if tlsConfig != nil {
+		sl = tls.NewListener(sl, tlsConfig)
+	}
+	go func() {
+		err := l.srv.Serve(sl)
+		if err != nil {
+			l.errChan <- err
+		}
+		close(l.errChan)
+	}()
+	select {
+	case err := <-l.errChan:
+		return nil, err
+	default:
+	}
+
+	return l, nil
+}
+
+func (l *muxWSListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	log.Logf("[muxws] %s -> %s", r.RemoteAddr, l.addr)
+	if Debug {
+		dump, _ := httputil.DumpRequest(r, false)
+		log.Log(string(dump))
+	}
+	conn, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Logf("[muxws] %s - %s : %s", r.RemoteAddr, l.addr, err)
+		return
+	}
+
+	l.mux(websocketServerConn(conn))
+}
+
+func (l *muxWSListener) mux(conn net.Conn) {
+	session, err := yamux.Server(conn, muxWSConfig())
+	if err != nil {
+		log.Logf("[muxws] %s - %s : %s", conn.RemoteAddr(), l.Addr(), err)
+		return
+	}
+	defer session.Close()
+
+	log.Logf("[muxws] %s <-> %s", conn.RemoteAddr(), l.Addr())
+	defer log.Logf("[muxws] %s >-< %s", conn.RemoteAddr(), l.Addr())
+
+	for {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			log.Log("[muxws] accept stream:", err)
+			return
+		}
+
+		select {
+		case l.connChan <- stream:
+		default:
+			stream.Close()
+			log.Logf("[muxws] %s - %s: connection queue is full", conn.RemoteAddr(), conn.LocalAddr())
+		}
+	}
+}
+
+func (l *muxWSListener) Accept() (conn net.Conn, err error) {
+	select {
+	case conn = <-l.connChan:
+	case err = <-l.errChan:
+	}
+	return
+}
+
+func (l *muxWSListener) Close() error {
+	return l.srv.Close()
+}
+
+func (l *muxWSListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,130 @@
+package gost
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func httpOverMuxWSRoundtrip(targetURL string, data []byte, tlsConfig *tls.Config,
+	clientInfo *url.Userinfo, serverInfo []*url.Userinfo) error {
+
+	var serverTLSConfig *tls.Config
+	if tlsConfig != nil {
+		serverTLSConfig = DefaultTLSConfig
+	}
+	ln, err := MuxWSListener("", serverTLSConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		Connector:   HTTPConnector(clientInfo),
+		Transporter: MuxWSTransporter(tlsConfig),
+	}
+
+	server := &Server{
+		Listener: ln,
+		Handler: HTTPHandler(
+			UsersHandlerOption(serverInfo...),
+		),
+	}
+
+	go server.Run()
+	defer server.Close()
+
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestHTTPOverMuxWS(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	for _, tlsConfig := range []*tls.Config{nil, {InsecureSkipVerify: true}} {
+		for i, tc := range httpProxyTests {
+			err := httpOverMuxWSRoundtrip(httpSrv.URL, sendData, tlsConfig, tc.cliUser, tc.srvUsers)
+			if err == nil {
+				if tc.errStr != "" {
+					t.Errorf("#%d should failed with error %s", i, tc.errStr)
+				}
+			} else {
+				if tc.errStr == "" {
+					t.Errorf("#%d got error %v", i, err)
+				}
+				if err.Error() != tc.errStr {
+					t.Errorf("#%d got error %v, want %v", i, err, tc.errStr)
+				}
+			}
+		}
+	}
+}
+
+func TestMuxWSSession(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	ln, err := MuxWSListener("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	server := &Server{Listener: ln, Handler: HTTPHandler()}
+	go server.Run()
+
+	tr := MuxWSTransporter(nil).(*muxWSTransporter)
+	client := &Client{Connector: HTTPConnector(nil), Transporter: tr}
+	roundtrip := func() error {
+		return proxyRoundtrip(client, server, httpSrv.URL, sendData)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := roundtrip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session := tr.sessions[addr]
+	if session == nil {
+		t.Fatal("the session is not cached")
+	}
+	if err := roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.sessions[addr] != session {
+		t.Error("the session is not reused")
+	}
+
+	// the server restarts, and the connection drops.
+	server.Close()
+	session.session.Close()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ln, err := MuxWSListener(addr, nil, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server := &Server{Listener: ln, Handler: HTTPHandler()}
+		t.Cleanup(func() { server.Close() })
+		server.Run()
+	}()
+
+	start := time.Now()
+	if err := roundtrip(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("reconnected in %v before the server restarts", d)
+	}
+	if tr.sessions[addr] == session {
+		t.Error("the dropped session is reused")
+	}
+}
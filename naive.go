@@ -0,0 +1,349 @@
+package gost
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/http2"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("naive", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return NaiveProxyTransporter("https://"+node.Addr, naiveCredentials(node.User), opts.TLSConfig), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return NaiveProxyListener(node.Addr, naiveCredentials(node.User), opts.TLSConfig)
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterProtocol("naive", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return NaiveProxyConnector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return HTTP2Handler(), nil
+		},
+	})
+}
+
+// naiveCredentials returns the user:pass of the naive node.
+func naiveCredentials(user *url.Userinfo) string {
+	if user == nil {
+		return ""
+	}
+	pass, _ := user.Password()
+	return user.Username() + ":" + pass
+}
+
+const (
+	// naiveFirstPaddings is the number of the padded frames at the beginning of each direction.
+	naiveFirstPaddings  = 8
+	naiveMaxPaddingSize = 255
+	naiveMaxPayloadSize = 65535
+)
+
+// naivePaddingHeader returns the random value of the padding header of 16-32 bytes.
+// The characters are not compressed by the Huffman encoding of HPACK, so the length is kept on the wire.
+func naivePaddingHeader() string {
+	const chars = "!#$()+<>?@[]^`{}"
+	n, _ := rand.Int(rand.Reader, big.NewInt(17))
+	b := make([]byte, 16+n.Int64())
+	rand.Read(b)
+	for i := range b {
+		b[i] = chars[int(b[i])%len(chars)]
+	}
+	return string(b)
+}
+
+// naivePaddingReader removes the padding of the first frames:
+// [payload size (2 bytes)][padding size (1 byte)][payload][padding].
+type naivePaddingReader struct {
+	r       io.Reader
+	frames  int
+	payload int // the rest payload of the current frame
+	padding int // the padding of the current frame
+}
+
+func (r *naivePaddingReader) Read(b []byte) (n int, err error) {
+	for r.payload == 0 {
+		if r.padding > 0 {
+			if _, err = io.CopyN(io.Discard, r.r, int64(r.padding)); err != nil {
+				return
+			}
+			r.padding = 0
+		}
+		if r.frames >= naiveFirstPaddings {
+			return r.r.Read(b)
+		}
+		var header [3]byte
+		if _, err = io.ReadFull(r.r, header[:]); err != nil {
+			return
+		}
+		r.frames++
+		r.payload = int(binary.BigEndian.Uint16(header[:]))
+		r.padding = int(header[2])
+	}
+
+	if len(b) > r.payload {
+		b = b[:r.payload]
+	}
+	n, err = r.r.Read(b)
+	r.payload -= n
+	if err == io.EOF && r.payload > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// naivePaddingWriter pads the first frames written by Write.
+type naivePaddingWriter struct {
+	w      io.Writer
+	frames int
+}
+
+func (w *naivePaddingWriter) Write(b []byte) (n int, err error) {
+	for w.frames < naiveFirstPaddings && n < len(b) {
+		p := b[n:]
+		if len(p) > naiveMaxPayloadSize {
+			p = p[:naiveMaxPayloadSize]
+		}
+		padding, _ := rand.Int(rand.Reader, big.NewInt(naiveMaxPaddingSize+1))
+		frame := make([]byte, 3+len(p)+int(padding.Int64()))
+		binary.BigEndian.PutUint16(frame, uint16(len(p)))
+		frame[2] = byte(padding.Int64())
+		copy(frame[3:], p)
+		if _, err = w.w.Write(frame); err != nil {
+			return
+		}
+		w.frames++
+		n += len(p)
+	}
+	if n < len(b) {
+		var nn int
+		nn, err = w.w.Write(b[n:])
+		n += nn
+	}
+	return
+}
+
+type naiveTransporter struct {
+	*http2Transporter
+	addr        string
+	credentials string
+}
+
+// NaiveProxyTransporter creates a Transporter of the NaiveProxy server at serverURL, such as https://example.com,
+// which tunnels the connections by the HTTP/2 CONNECT requests, the server is usually fronted by a CDN.
+// The credentials is user:pass for the Basic proxy authorization, use it with NaiveProxyConnector.
+//
+// The certificate of the server is not verified if tlsConfig is nil.
+func NaiveProxyTransporter(serverURL string, credentials string, tlsConfig *tls.Config) Transporter {
+	addr := serverURL
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		addr = u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+	return &naiveTransporter{
+		http2Transporter: HTTP2Transporter(tlsConfig).(*http2Transporter),
+		addr:             addr,
+		credentials:      credentials,
+	}
+}
+
+func (tr *naiveTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	conn, err := tr.http2Transporter.Dial(tr.addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &naiveClientConn{
+		http2ClientConn: conn.(*http2ClientConn),
+		credentials:     tr.credentials,
+	}, nil
+}
+
+// a dummy NaiveProxy client conn used by NaiveProxy connector
+type naiveClientConn struct {
+	*http2ClientConn
+	credentials string
+}
+
+type naiveConnector struct{}
+
+// NaiveProxyConnector creates a Connector for NaiveProxy client, it sends the CONNECT request with the padding
+// header by the connection of NaiveProxyTransporter, and the first frames of the tunnel are padded
+// if the server supports the padding.
+func NaiveProxyConnector() Connector {
+	return &naiveConnector{}
+}
+
+func (c *naiveConnector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *naiveConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%s unsupported", network)
+	}
+
+	cc, ok := conn.(*naiveClientConn)
+	if !ok {
+		return nil, errors.New("wrong connection type")
+	}
+
+	pr, pw := io.Pipe()
+	req := &http.Request{
+		Method:        http.MethodConnect,
+		URL:           &url.URL{Scheme: "https", Host: cc.addr},
+		Header:        make(http.Header),
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		ProtoMinor:    0,
+		Body:          pr,
+		Host:          address,
+		ContentLength: -1,
+	}
+	req.Header.Set("Padding", naivePaddingHeader())
+	if cc.credentials != "" {
+		req.Header.Set("Proxy-Authorization",
+			"Basic "+base64.StdEncoding.EncodeToString([]byte(cc.credentials)))
+	}
+	if Debug {
+		dump, _ := httputil.DumpRequest(req, false)
+		log.Log("[naive]", string(dump))
+	}
+	resp, err := cc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	if Debug {
+		dump, _ := httputil.DumpResponse(resp, false)
+		log.Log("[naive]", string(dump))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, proxyStatusError(resp)
+	}
+
+	hc := &http2Conn{
+		r:      resp.Body,
+		w:      pw,
+		closed: make(chan struct{}),
+	}
+	if resp.Header.Get("Padding") != "" {
+		hc.r = &naivePaddingReader{r: resp.Body}
+		hc.w = &naivePaddingWriter{w: pw}
+	}
+	hc.remoteAddr, _ = net.ResolveTCPAddr("tcp", address)
+	hc.localAddr, _ = net.ResolveTCPAddr("tcp", cc.addr)
+	return &naiveConn{http2Conn: hc, body: resp.Body, pw: pw}, nil
+}
+
+// naiveConn closes the underlying body and pipe of the padded http2Conn.
+type naiveConn struct {
+	*http2Conn
+	body io.Closer
+	pw   io.Closer
+}
+
+func (c *naiveConn) Close() error {
+	c.http2Conn.Close()
+	c.body.Close()
+	return c.pw.Close()
+}
+
+// naiveResponseWriter pads the first frames of the response body.
+type naiveResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *naiveResponseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *naiveResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// NaiveProxyListener creates a Listener for NaiveProxy server, the CONNECT requests are authorized by the
+// credentials user:pass, and the tunnels are padded if the clients send the padding header,
+// then the requests are accepted as the connections of HTTP2Handler.
+// The other requests are replied with 404 as a web server to resist the probes.
+func NaiveProxyListener(addr string, credentials string, tlsConfig *tls.Config) (Listener, error) {
+	l := &http2Listener{
+		connChan: make(chan *http2ServerConn, 1024),
+		errChan:  make(chan error, 1),
+	}
+	if tlsConfig == nil {
+		tlsConfig = DefaultTLSConfig
+	}
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   naiveHandler(l, credentials),
+		TLSConfig: tlsConfig,
+	}
+	if err := http2.ConfigureServer(server, nil); err != nil {
+		return nil, err
+	}
+	l.server = server
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.addr = ln.Addr()
+
+	ln = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, server.TLSConfig)
+	go func() {
+		err := server.Serve(ln)
+		if err != nil {
+			log.Log("[naive]", err)
+		}
+	}()
+
+	return l, nil
+}
+
+func naiveHandler(l *http2Listener, credentials string) http.Handler {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.ProtoMajor != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		if credentials != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get("Proxy-Authorization")), []byte(auth)) != 1 {
+			log.Logf("[naive] %s - %s : proxy authentication required", r.RemoteAddr, l.addr)
+			w.Header().Set("Proxy-Authenticate", "Basic realm=\"naive\"")
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Header.Get("Padding") != "" {
+			w.Header().Set("Padding", naivePaddingHeader())
+			r.Body = io.NopCloser(&naivePaddingReader{r: r.Body})
+			w = &naiveResponseWriter{ResponseWriter: w, w: &naivePaddingWriter{w: w}}
+		}
+		l.handleFunc(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNaivePadding(t *testing.T) {
+	var buf bytes.Buffer
+	w := &naivePaddingWriter{w: &buf}
+
+	var data []byte
+	for i := 0; i < naiveFirstPaddings+2; i++ {
+		b := make([]byte, 100+i)
+		rand.Read(b)
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, b...)
+	}
+	// the padded frames have the headers of 3 bytes.
+	if buf.Len() < len(data)+3*naiveFirstPaddings {
+		t.Errorf("got %d bytes on the wire, want at least %d", buf.Len(), len(data)+3*naiveFirstPaddings)
+	}
+
+	got, err := io.ReadAll(&naivePaddingReader{r: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("the data is not unpadded")
+	}
+}
+
+func naiveRoundtrip(t *testing.T, targetURL string, data []byte, credentials string) error {
+	ln, err := NaiveProxyListener("127.0.0.1:0", "user:pass", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTP2Handler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   NaiveProxyConnector(),
+		Transporter: NaiveProxyTransporter("https://"+ln.Addr().String(), credentials, nil),
+	}
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestNaiveProxy(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	if err := naiveRoundtrip(t, httpSrv.URL, sendData, "user:pass"); err != nil {
+		t.Error(err)
+	}
+	if err := naiveRoundtrip(t, httpSrv.URL, sendData, "user:wrong"); err == nil || err.Error() != "407 Proxy Authentication Required" {
+		t.Errorf("got error %v, want 407 Proxy Authentication Required", err)
+	}
+}
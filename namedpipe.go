@@ -0,0 +1,57 @@
+package gost
+
+import (
+	"errors"
+	"strings"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("pipe", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return NamedPipeTransporter(node.Addr), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return NamedPipeListener(node.Addr, SecurityDescriptorListenOption(node.Get("sddl")))
+		},
+	})
+}
+
+const namedPipePrefix = `\\.\pipe\`
+
+// ErrNamedPipeUnsupported is returned when the named pipe is used on the platform other than Windows.
+var ErrNamedPipeUnsupported = errors.New("named pipe is only supported on Windows")
+
+type namedPipeListenOptions struct {
+	securityDescriptor string
+}
+
+// NamedPipeListenOption allows a common way to set the named pipe listener options.
+type NamedPipeListenOption func(opts *namedPipeListenOptions)
+
+// SecurityDescriptorListenOption specifies the access control of the named pipe
+// by a security descriptor in SDDL format, e.g. 'D:P(A;;GA;;;BA)(A;;GA;;;SY)' allows
+// only the administrators and the local system. The default security descriptor is used if not specified.
+func SecurityDescriptorListenOption(sddl string) NamedPipeListenOption {
+	return func(opts *namedPipeListenOptions) {
+		opts.securityDescriptor = sddl
+	}
+}
+
+// namedPipePath returns the full path of the named pipe,
+// the name is converted to '\\.\pipe\gost-<name>' unless it is a full path already.
+func namedPipePath(name string) string {
+	if strings.HasPrefix(name, namedPipePrefix) {
+		return name
+	}
+	return namedPipePrefix + "gost-" + name
+}
+
+type namedPipeAddr string
+
+func (a namedPipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a namedPipeAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package gost
+
+import "net"
+
+// NamedPipeTransporter is only supported on Windows,
+// the returned Transporter always fails with ErrNamedPipeUnsupported.
+func NamedPipeTransporter(pipeName string) Transporter {
+	return &namedPipeTransporter{}
+}
+
+// NamedPipeListener is only supported on Windows, it always returns ErrNamedPipeUnsupported.
+func NamedPipeListener(pipeName string, opts ...NamedPipeListenOption) (Listener, error) {
+	return nil, ErrNamedPipeUnsupported
+}
+
+type namedPipeTransporter struct{}
+
+func (tr *namedPipeTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	return nil, ErrNamedPipeUnsupported
+}
+
+func (tr *namedPipeTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return nil, ErrNamedPipeUnsupported
+}
+
+func (tr *namedPipeTransporter) Multiplex() bool {
+	return false
+}
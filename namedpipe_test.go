@@ -0,0 +1,19 @@
+package gost
+
+import "testing"
+
+func TestNamedPipePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"proxy", `\\.\pipe\gost-proxy`},
+		{`\\.\pipe\proxy`, `\\.\pipe\proxy`},
+		{"", `\\.\pipe\gost-`},
+	}
+	for _, tc := range tests {
+		if path := namedPipePath(tc.name); path != tc.path {
+			t.Errorf("namedPipePath(%q) = %s, want %s", tc.name, path, tc.path)
+		}
+	}
+}
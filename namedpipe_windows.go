@@ -0,0 +1,82 @@
+//go:build windows
+// +build windows
+
+package gost
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+const namedPipeBufferSize = 64 * 1024
+
+// namedPipeTransporter is a Windows named pipe transporter.
+type namedPipeTransporter struct {
+	path string
+}
+
+// NamedPipeTransporter creates a Transporter for Windows named pipe client.
+// The pipe name follows the '\\.\pipe\gost-<name>' convention, the Dial address is used if pipeName is empty.
+//
+// The pipe is opened in overlapped mode, so the connection supports deadlines
+// and a pending Read is unblocked by Close.
+func NamedPipeTransporter(pipeName string) Transporter {
+	tr := &namedPipeTransporter{}
+	if pipeName != "" {
+		tr.path = namedPipePath(pipeName)
+	}
+	return tr
+}
+
+func (tr *namedPipeTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+
+	path := tr.path
+	if path == "" {
+		path = namedPipePath(addr)
+	}
+	// waits for a free pipe instance until timeout if all the instances are busy.
+	conn, err := winio.DialPipe(path, &timeout)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: namedPipeAddr(path), Err: err}
+	}
+	return conn, nil
+}
+
+func (tr *namedPipeTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *namedPipeTransporter) Multiplex() bool {
+	return false
+}
+
+// NamedPipeListener creates a Listener for Windows named pipe server.
+// The pipe name follows the '\\.\pipe\gost-<name>' convention,
+// it fails if the pipe is created by another process already. The remote clients are rejected.
+func NamedPipeListener(pipeName string, opts ...NamedPipeListenOption) (Listener, error) {
+	options := &namedPipeListenOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	path := namedPipePath(pipeName)
+	ln, err := winio.ListenPipe(path, &winio.PipeConfig{
+		SecurityDescriptor: options.securityDescriptor,
+		InputBufferSize:    namedPipeBufferSize,
+		OutputBufferSize:   namedPipeBufferSize,
+	})
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: namedPipeAddr(path), Err: err}
+	}
+	return ln, nil
+}
@@ -0,0 +1,106 @@
+package gost
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func namedPipeProxyRoundtrip(pipeName string, opts ...NamedPipeListenOption) error {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	ln, err := NamedPipeListener(pipeName, opts...)
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: NamedPipeTransporter(pipeName),
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	return proxyRoundtrip(client, server, httpSrv.URL, sendData)
+}
+
+func TestNamedPipeTransporter(t *testing.T) {
+	pipeName := fmt.Sprintf("test-%d", os.Getpid())
+	if err := namedPipeProxyRoundtrip(pipeName); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNamedPipeSecurityDescriptor(t *testing.T) {
+	pipeName := fmt.Sprintf("test-sd-%d", os.Getpid())
+	// allow everyone
+	if err := namedPipeProxyRoundtrip(pipeName, SecurityDescriptorListenOption("D:P(A;;GA;;;WD)")); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NamedPipeListener(pipeName+"-invalid", SecurityDescriptorListenOption("invalid")); err == nil {
+		t.Error("should failed with invalid security descriptor")
+	}
+}
+
+func TestNamedPipeConnDeadline(t *testing.T) {
+	pipeName := fmt.Sprintf("test-deadline-%d", os.Getpid())
+	ln, err := NamedPipeListener(pipeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := NamedPipeTransporter(pipeName).Dial("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read should time out")
+	} else if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("got %v, want timeout error", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// the pending read is unblocked by Close.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("pending read should fail")
+		}
+	case <-time.After(time.Second):
+		t.Error("pending read is not unblocked by Close")
+	}
+}
@@ -0,0 +1,566 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	// experimental, client only
+	DefaultRegistry.RegisterTransport("ndn", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			face := node.Get("face")
+			if face == "" {
+				face = "unix:///run/nfd/nfd.sock"
+			}
+			prefix := node.Get("prefix")
+			if prefix == "" {
+				prefix = "/gost"
+			}
+			return NDNTransporter(face, prefix), nil
+		},
+	})
+}
+
+// The TLV types of the NDN packet format v0.3 and the NDNLPv2 link protocol.
+const (
+	ndnTypeInterest              = 0x05
+	ndnTypeData                  = 0x06
+	ndnTypeName                  = 0x07
+	ndnTypeGenericComponent      = 0x08
+	ndnTypeParamsDigestComponent = 0x02
+	ndnTypeSequenceNumComponent  = 0x3a
+	ndnTypeNonce                 = 0x0a
+	ndnTypeInterestLifetime      = 0x0c
+	ndnTypeAppParameters         = 0x24
+	ndnTypeMetaInfo              = 0x14
+	ndnTypeContent               = 0x15
+	ndnTypeContentType           = 0x18
+	ndnTypeLpPacket              = 0x64
+	ndnTypeLpFragment            = 0x50
+	ndnTypeLpNack                = 0x0320
+
+	// ndnContentTypeNack is the application-level NACK, it is used by the producer to refuse or close the session.
+	ndnContentTypeNack = 3
+)
+
+const (
+	// ndnMaxChunk is the max size of the data carried by an Interest, the max NDN packet size is 8800 bytes.
+	ndnMaxChunk        = 8000
+	ndnLifetime        = 4 * time.Second
+	ndnRetries         = 3
+	ndnMinPollInterval = 50 * time.Millisecond
+	ndnMaxPollInterval = 2 * time.Second
+)
+
+var errNDNNack = errors.New("ndn: interest is nacked by the forwarder")
+
+func ndnAppendVarNum(b []byte, v uint64) []byte {
+	switch {
+	case v < 253:
+		return append(b, byte(v))
+	case v <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, 253), uint16(v))
+	case v <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, 254), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 255), v)
+	}
+}
+
+func ndnAppendTLV(b []byte, typ uint64, value []byte) []byte {
+	b = ndnAppendVarNum(b, typ)
+	b = ndnAppendVarNum(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// ndnNonNegInt encodes the nonNegativeInteger in the shortest form of 1, 2, 4 or 8 bytes.
+func ndnNonNegInt(v uint64) []byte {
+	switch {
+	case v <= 0xff:
+		return []byte{byte(v)}
+	case v <= 0xffff:
+		return binary.BigEndian.AppendUint16(nil, uint16(v))
+	case v <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(nil, uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(nil, v)
+	}
+}
+
+func ndnParseNonNegInt(b []byte) (uint64, error) {
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case 8:
+		return binary.BigEndian.Uint64(b), nil
+	}
+	return 0, fmt.Errorf("ndn: invalid nonNegativeInteger of %d bytes", len(b))
+}
+
+func ndnParseVarNum(b []byte) (v uint64, n int, err error) {
+	if len(b) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	switch b[0] {
+	case 253:
+		n = 3
+	case 254:
+		n = 5
+	case 255:
+		n = 9
+	default:
+		return uint64(b[0]), 1, nil
+	}
+	if len(b) < n {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	v, err = ndnParseNonNegInt(b[1:n])
+	return
+}
+
+// ndnParseTLV parses the first TLV element of b.
+func ndnParseTLV(b []byte) (typ uint64, value, rest []byte, err error) {
+	typ, n, err := ndnParseVarNum(b)
+	if err != nil {
+		return
+	}
+	b = b[n:]
+	length, n, err := ndnParseVarNum(b)
+	if err != nil {
+		return
+	}
+	b = b[n:]
+	if uint64(len(b)) < length {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	return typ, b[:length], b[length:], nil
+}
+
+func ndnReadVarNum(br *bufio.Reader) (uint64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	switch c {
+	case 253:
+		n = 2
+	case 254:
+		n = 4
+	case 255:
+		n = 8
+	default:
+		return uint64(c), nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return 0, err
+	}
+	return ndnParseNonNegInt(b)
+}
+
+// ndnReadPacket reads a TLV element from the face.
+func ndnReadPacket(br *bufio.Reader) (typ uint64, value []byte, err error) {
+	if typ, err = ndnReadVarNum(br); err != nil {
+		return
+	}
+	length, err := ndnReadVarNum(br)
+	if err != nil {
+		return
+	}
+	if length > 0xffff {
+		return 0, nil, fmt.Errorf("ndn: packet of %d bytes is too large", length)
+	}
+	value = make([]byte, length)
+	_, err = io.ReadFull(br, value)
+	return
+}
+
+// ndnPrefix encodes the name URI such as /example/gost to the name components.
+func ndnPrefix(uri string) ([]byte, error) {
+	var b []byte
+	for _, s := range strings.Split(strings.Trim(uri, "/"), "/") {
+		if s == "" {
+			continue
+		}
+		c, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, fmt.Errorf("ndn: invalid name %s: %v", uri, err)
+		}
+		b = ndnAppendTLV(b, ndnTypeGenericComponent, []byte(c))
+	}
+	if b == nil {
+		return nil, fmt.Errorf("ndn: empty name prefix")
+	}
+	return b, nil
+}
+
+// ndnInterest encodes the Interest of the name components with the application parameters,
+// the ParametersSha256DigestComponent is appended to the name. It returns the packet and the value of its Name.
+func ndnInterest(components []byte, params []byte, lifetime time.Duration) (packet, name []byte) {
+	ap := ndnAppendTLV(nil, ndnTypeAppParameters, params)
+	digest := sha256.Sum256(ap)
+	components = ndnAppendTLV(append([]byte(nil), components...), ndnTypeParamsDigestComponent, digest[:])
+
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+
+	v := ndnAppendTLV(nil, ndnTypeName, components)
+	v = ndnAppendTLV(v, ndnTypeNonce, nonce)
+	v = ndnAppendTLV(v, ndnTypeInterestLifetime, ndnNonNegInt(uint64(lifetime/time.Millisecond)))
+	v = append(v, ap...)
+	return ndnAppendTLV(nil, ndnTypeInterest, v), components
+}
+
+// ndnData is the decoded Data packet, the signature is not verified.
+type ndnData struct {
+	Name        []byte // the value of the Name element
+	ContentType uint64
+	Content     []byte
+}
+
+func ndnParseData(b []byte) (*ndnData, error) {
+	d := &ndnData{}
+	for len(b) > 0 {
+		typ, v, rest, err := ndnParseTLV(b)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ndnTypeName:
+			d.Name = v
+		case ndnTypeMetaInfo:
+			for len(v) > 0 {
+				t, mv, mrest, err := ndnParseTLV(v)
+				if err != nil {
+					return nil, err
+				}
+				if t == ndnTypeContentType {
+					if d.ContentType, err = ndnParseNonNegInt(mv); err != nil {
+						return nil, err
+					}
+				}
+				v = mrest
+			}
+		case ndnTypeContent:
+			d.Content = v
+		}
+		b = rest
+	}
+	return d, nil
+}
+
+// ndnInterestName returns the value of the Name element of the Interest.
+func ndnInterestName(b []byte) []byte {
+	for len(b) > 0 {
+		typ, v, rest, err := ndnParseTLV(b)
+		if err != nil {
+			return nil
+		}
+		if typ == ndnTypeName {
+			return v
+		}
+		b = rest
+	}
+	return nil
+}
+
+// ndnConn is a stream over the Interest/Data exchanges of the session /<prefix>/<session>/<seq>.
+// The Interests are sent one at a time, the upstream data is carried by the ApplicationParameters
+// and the downstream data is returned in the Content of the Data.
+// The Interests with the empty parameters are sent to poll the downstream data when there is nothing to write.
+type ndnConn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	session  []byte // the name components of /<prefix>/<session>
+	seq      uint64
+	mux      sync.Mutex // one outstanding Interest at a time
+	rmux     sync.Mutex
+	rbuf     bytes.Buffer
+	eof      bool
+	interval time.Duration
+
+	dmux          sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// exchange sends the Interest of the next sequence number with the params, and returns the Content of the Data.
+// The Interest is retransmitted with a new Nonce if no Data is received in the lifetime,
+// so the producer must handle the duplicated sequence numbers.
+func (c *ndnConn) exchange(params []byte) (*ndnData, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	components := ndnAppendTLV(append([]byte(nil), c.session...), ndnTypeSequenceNumComponent, ndnNonNegInt(c.seq))
+	var err error
+	for i := 0; i < ndnRetries; i++ {
+		var d *ndnData
+		if d, err = c.roundtrip(components, params); err == nil {
+			c.seq++
+			return d, nil
+		}
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *ndnConn) roundtrip(components, params []byte) (*ndnData, error) {
+	interest, name := ndnInterest(components, params, ndnLifetime)
+
+	c.conn.SetDeadline(time.Now().Add(ndnLifetime))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write(interest); err != nil {
+		return nil, err
+	}
+	for {
+		typ, v, err := ndnReadPacket(c.br)
+		if err != nil {
+			return nil, err
+		}
+		nack := false
+		if typ == ndnTypeLpPacket {
+			var fragment []byte
+			for len(v) > 0 {
+				t, fv, rest, err := ndnParseTLV(v)
+				if err != nil {
+					return nil, err
+				}
+				switch t {
+				case ndnTypeLpNack:
+					nack = true
+				case ndnTypeLpFragment:
+					fragment = fv
+				}
+				v = rest
+			}
+			if typ, v, _, err = ndnParseTLV(fragment); err != nil {
+				// the idle packet without fragment.
+				continue
+			}
+		}
+
+		switch typ {
+		case ndnTypeInterest:
+			if nack && bytes.Equal(ndnInterestName(v), name) {
+				return nil, errNDNNack
+			}
+		case ndnTypeData:
+			d, err := ndnParseData(v)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(d.Name, name) {
+				return d, nil
+			}
+		}
+	}
+}
+
+// deliver buffers the downstream data of the Data, the NACK content type means the session is closed.
+func (c *ndnConn) deliver(d *ndnData) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	if d.ContentType == ndnContentTypeNack {
+		c.eof = true
+		return
+	}
+	c.rbuf.Write(d.Content)
+}
+
+func (c *ndnConn) Read(b []byte) (n int, err error) {
+	for {
+		c.rmux.Lock()
+		if c.rbuf.Len() > 0 {
+			n, err = c.rbuf.Read(b)
+			c.rmux.Unlock()
+			return
+		}
+		eof := c.eof
+		c.rmux.Unlock()
+		if eof {
+			return 0, io.EOF
+		}
+
+		c.dmux.Lock()
+		deadline := c.readDeadline
+		c.dmux.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, &net.OpError{Op: "read", Net: "ndn", Err: os.ErrDeadlineExceeded}
+		}
+
+		d, err := c.exchange(nil)
+		if err != nil {
+			return 0, err
+		}
+		c.deliver(d)
+		if len(d.Content) > 0 {
+			c.interval = ndnMinPollInterval
+			continue
+		}
+		// back off the polling when the session is idle.
+		time.Sleep(c.interval)
+		if c.interval *= 2; c.interval > ndnMaxPollInterval {
+			c.interval = ndnMaxPollInterval
+		}
+	}
+}
+
+func (c *ndnConn) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		c.dmux.Lock()
+		deadline := c.writeDeadline
+		c.dmux.Unlock()
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return n, &net.OpError{Op: "write", Net: "ndn", Err: os.ErrDeadlineExceeded}
+		}
+
+		m := len(b)
+		if m > ndnMaxChunk {
+			m = ndnMaxChunk
+		}
+		d, err := c.exchange(b[:m])
+		if err != nil {
+			return n, err
+		}
+		c.deliver(d)
+		if d.ContentType == ndnContentTypeNack {
+			return n, io.ErrClosedPipe
+		}
+		n += m
+		b = b[m:]
+	}
+	return
+}
+
+func (c *ndnConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ndnConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *ndnConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *ndnConn) SetDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+
+func (c *ndnConn) SetReadDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *ndnConn) SetWriteDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+type ndnTransporter struct {
+	faceMgmtURL string
+	prefix      string
+}
+
+// NDNTransporter creates a Transporter over the Named Data Networking forwarder (NFD) at faceMgmtURL,
+// such as tcp://127.0.0.1:6363 or unix:///run/nfd/nfd.sock. The streams are carried by the Interests
+// of the name /<prefix>/<session>/<seq>, and the producer serving the prefix is the proxy server.
+//
+// It is EXPERIMENTAL. The first Interest of the session carries the Dial address,
+// the producer replies the Data with the empty content on success, or the NACK content type on failure.
+func NDNTransporter(faceMgmtURL string, prefix string) Transporter {
+	return &ndnTransporter{
+		faceMgmtURL: faceMgmtURL,
+		prefix:      prefix,
+	}
+}
+
+func (tr *ndnTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+
+	prefix, err := ndnPrefix(tr.prefix)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(tr.faceMgmtURL)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		conn, err = net.DialTimeout(u.Scheme, u.Host, timeout)
+	case "unix":
+		conn, err = net.DialTimeout("unix", u.Path, timeout)
+	default:
+		return nil, fmt.Errorf("ndn: unsupported face %s", tr.faceMgmtURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := make([]byte, 8)
+	rand.Read(session)
+	c := &ndnConn{
+		conn:     conn,
+		br:       bufio.NewReader(conn),
+		session:  ndnAppendTLV(prefix, ndnTypeGenericComponent, []byte(hex.EncodeToString(session))),
+		interval: ndnMinPollInterval,
+	}
+	d, err := c.exchange([]byte(addr))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if d.ContentType == ndnContentTypeNack {
+		conn.Close()
+		return nil, fmt.Errorf("ndn: %s: connect %s: %s", tr.prefix, addr, d.Content)
+	}
+	return c, nil
+}
+
+func (tr *ndnTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *ndnTransporter) Multiplex() bool {
+	return false
+}
@@ -0,0 +1,156 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ndnTestForwarder is an NFD face with the echo producer of the prefix /gost,
+// the Interests of the other prefixes are nacked.
+type ndnTestForwarder struct {
+	ln net.Listener
+	t  *testing.T
+}
+
+func newNDNTestForwarder(t *testing.T) *ndnTestForwarder {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &ndnTestForwarder{ln: ln, t: t}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *ndnTestForwarder) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	var echo []byte
+	replies := make(map[uint64][]byte)
+	for {
+		typ, v, err := ndnReadPacket(br)
+		if err != nil {
+			return
+		}
+		if typ != ndnTypeInterest {
+			continue
+		}
+		name := ndnInterestName(v)
+		var params []byte
+		for b := v; len(b) > 0; {
+			t, pv, rest, _ := ndnParseTLV(b)
+			if t == ndnTypeAppParameters {
+				digest := sha256.Sum256(b[:len(b)-len(rest)])
+				if !bytes.HasSuffix(name, digest[:]) {
+					f.t.Error("invalid ParametersSha256DigestComponent")
+				}
+				params = pv
+			}
+			b = rest
+		}
+
+		var comps [][]byte
+		var seq uint64
+		for b := name; len(b) > 0; {
+			t, cv, rest, _ := ndnParseTLV(b)
+			switch t {
+			case ndnTypeGenericComponent:
+				comps = append(comps, cv)
+			case ndnTypeSequenceNumComponent:
+				seq, _ = ndnParseNonNegInt(cv)
+			}
+			b = rest
+		}
+		if len(comps) == 0 || string(comps[0]) != "gost" {
+			lp := ndnAppendTLV(nil, ndnTypeLpNack, nil)
+			lp = ndnAppendTLV(lp, ndnTypeLpFragment, ndnAppendTLV(nil, ndnTypeInterest, v))
+			conn.Write(ndnAppendTLV(nil, ndnTypeLpPacket, lp))
+			continue
+		}
+
+		content, ok := replies[seq]
+		contentType := uint64(0)
+		if !ok {
+			switch {
+			case seq == 0 && strings.HasPrefix(string(params), "refused"):
+				contentType, content = ndnContentTypeNack, []byte("connection refused")
+			case seq == 0:
+			default:
+				content, echo = echo, params
+			}
+			replies[seq] = content
+		}
+
+		d := ndnAppendTLV(nil, ndnTypeName, name)
+		d = ndnAppendTLV(d, ndnTypeMetaInfo, ndnAppendTLV(nil, ndnTypeContentType, ndnNonNegInt(contentType)))
+		d = ndnAppendTLV(d, ndnTypeContent, content)
+		conn.Write(ndnAppendTLV(nil, ndnTypeData, d))
+	}
+}
+
+func TestNDNTLV(t *testing.T) {
+	for _, n := range []int{0, 252, 253, 0xffff, 0x10000} {
+		b := ndnAppendTLV(nil, ndnTypeContent, make([]byte, n))
+		typ, v, rest, err := ndnParseTLV(b)
+		if err != nil || typ != ndnTypeContent || len(v) != n || len(rest) != 0 {
+			t.Errorf("%d: got %d %d %d %v", n, typ, len(v), len(rest), err)
+		}
+	}
+	if _, _, _, err := ndnParseTLV([]byte{ndnTypeContent, 10, 1}); err == nil {
+		t.Error("should not parse the truncated TLV")
+	}
+	if _, err := ndnPrefix("/"); err == nil {
+		t.Error("should not accept the empty prefix")
+	}
+}
+
+func TestNDNTransporter(t *testing.T) {
+	f := newNDNTestForwarder(t)
+	defer f.ln.Close()
+
+	tr := NDNTransporter("tcp://"+f.ln.Addr().String(), "/gost")
+	conn, err := tr.Dial("example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the echo producer returns the data of the previous Interest.
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, buf) {
+		t.Error("data mismatch")
+	}
+
+	if _, err := tr.Dial("refused:80"); err == nil {
+		t.Error("should not connect to the refused address")
+	}
+	if _, err := NDNTransporter("tcp://"+f.ln.Addr().String(), "/other").Dial("example.com:80"); err != errNDNNack {
+		t.Errorf("got %v, want %v", err, errNDNNack)
+	}
+	if _, err := NDNTransporter("udp://"+f.ln.Addr().String(), "/gost").Dial("example.com:80"); err == nil {
+		t.Error("should not dial the unsupported face")
+	}
+}
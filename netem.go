@@ -0,0 +1,102 @@
+package gost
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// NetEmConfig is the network conditions emulated by NetEmConn, the percentages are in the range [0, 100].
+type NetEmConfig struct {
+	// LatencyMean is the delay added to each write.
+	LatencyMean time.Duration
+	// LatencyJitter is the max random variation of the delay, the delay is uniformly distributed in
+	// [LatencyMean-LatencyJitter, LatencyMean+LatencyJitter].
+	LatencyJitter time.Duration
+	// PacketLossPct is the percentage of the writes dropped.
+	PacketLossPct float64
+	// CorruptPct is the percentage of the writes with a random bit flipped.
+	CorruptPct float64
+	// ReorderPct is the percentage of the writes delayed after the next write.
+	ReorderPct float64
+	// DuplicatePct is the percentage of the writes sent twice.
+	DuplicatePct float64
+}
+
+// NetEmConn wraps the connection to emulate the network conditions on its writes, like the Linux netem qdisc.
+// Each write is treated as a packet, a dropped write reports success without sending the data.
+//
+// It is a testing and simulation tool: it breaks the reliability of the stream connections (e.g. TCP),
+// so the protocols running over them are expected to fail. It must not be used on the production connections.
+func NetEmConn(conn net.Conn, cfg NetEmConfig) net.Conn {
+	return &netEmConn{
+		Conn: conn,
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+type netEmConn struct {
+	net.Conn
+	cfg  NetEmConfig
+	mux  sync.Mutex
+	rand *rand.Rand
+	held []byte // the reordered write, sent after the next write
+}
+
+func (c *netEmConn) Write(b []byte) (n int, err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if d := c.delay(); d > 0 {
+		time.Sleep(d)
+	}
+	if c.hit(c.cfg.PacketLossPct) {
+		return len(b), nil
+	}
+
+	p := b
+	if c.hit(c.cfg.CorruptPct) && len(b) > 0 {
+		p = append([]byte(nil), b...)
+		p[c.rand.Intn(len(p))] ^= 1 << uint(c.rand.Intn(8))
+	}
+	if c.held == nil && c.hit(c.cfg.ReorderPct) {
+		c.held = append([]byte(nil), p...)
+		return len(b), nil
+	}
+
+	if _, err = c.Conn.Write(p); err != nil {
+		return 0, err
+	}
+	if c.hit(c.cfg.DuplicatePct) {
+		c.Conn.Write(p)
+	}
+	if held := c.held; held != nil {
+		c.held = nil
+		c.Conn.Write(held)
+	}
+	return len(b), nil
+}
+
+func (c *netEmConn) Close() error {
+	c.mux.Lock()
+	if held := c.held; held != nil {
+		c.held = nil
+		c.Conn.Write(held)
+	}
+	c.mux.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *netEmConn) delay() time.Duration {
+	d := c.cfg.LatencyMean
+	if j := c.cfg.LatencyJitter; j > 0 {
+		d += time.Duration(c.rand.Int63n(int64(2*j)+1)) - j
+	}
+	return d
+}
+
+func (c *netEmConn) hit(pct float64) bool {
+	return pct > 0 && c.rand.Float64()*100 < pct
+}
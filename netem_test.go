@@ -0,0 +1,78 @@
+package gost
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// packetRecorder records the writes as the packets.
+type packetRecorder struct {
+	net.Conn
+	mux     sync.Mutex
+	packets [][]byte
+}
+
+func (c *packetRecorder) Write(b []byte) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.packets = append(c.packets, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (c *packetRecorder) Close() error {
+	return nil
+}
+
+func TestNetEmConnPacketLoss(t *testing.T) {
+	rec := &packetRecorder{}
+	conn := NetEmConn(rec, NetEmConfig{PacketLossPct: 10})
+
+	const n = 10000
+	for i := 0; i < n; i++ {
+		if _, err := conn.Write([]byte{1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dropped := n - len(rec.packets)
+	// the expected deviation is about 30 writes.
+	if dropped < 850 || dropped > 1150 {
+		t.Errorf("dropped %d of %d writes, want about 10%%", dropped, n)
+	}
+}
+
+func TestNetEmConnEffects(t *testing.T) {
+	rec := &packetRecorder{}
+	conn := NetEmConn(rec, NetEmConfig{CorruptPct: 100})
+	conn.Write([]byte("hello"))
+	if len(rec.packets) != 1 || bytes.Equal(rec.packets[0], []byte("hello")) || len(rec.packets[0]) != 5 {
+		t.Errorf("the write should be corrupted: %q", rec.packets)
+	}
+
+	rec = &packetRecorder{}
+	conn = NetEmConn(rec, NetEmConfig{DuplicatePct: 100})
+	conn.Write([]byte("a"))
+	if len(rec.packets) != 2 {
+		t.Errorf("the write should be duplicated: %q", rec.packets)
+	}
+
+	rec = &packetRecorder{}
+	conn = NetEmConn(rec, NetEmConfig{ReorderPct: 100})
+	conn.Write([]byte("a"))
+	conn.Write([]byte("b"))
+	conn.Write([]byte("c"))
+	conn.Close()
+	if got := bytes.Join(rec.packets, nil); string(got) != "bac" {
+		t.Errorf("got %q, want %q", got, "bac")
+	}
+
+	rec = &packetRecorder{}
+	conn = NetEmConn(rec, NetEmConfig{LatencyMean: 20 * time.Millisecond, LatencyJitter: 10 * time.Millisecond})
+	start := time.Now()
+	conn.Write([]byte("a"))
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("the write is delayed %v, want at least 10ms", d)
+	}
+}
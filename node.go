@@ -74,46 +74,26 @@ func ParseNode(s string) (node Node, err error) {
 		node.Transport = schemes[1]
 	}
 
-	switch node.Transport {
-	case "https":
-		node.Transport = "tls"
-	case "tls", "mtls":
-	case "http2", "h2", "h2c":
-	case "ws", "mws", "wss", "mwss":
-	case "kcp", "ssh", "quic":
-	case "ssu":
-		node.Transport = "udp"
-	case "ohttp", "otls", "obfs4": // obfs
-	case "tcp", "udp":
-	case "rtcp", "rudp": // rtcp and rudp are for remote port forwarding
-	case "tun", "tap": // tun/tap device
-	case "ftcp": // fake TCP
-	case "dns":
-	case "redu", "redirectu": // UDP tproxy
-	case "vsock":
-	default:
+	// the transports and the protocols are registered to DefaultRegistry,
+	// the aliases are replaced by the registered names, e.g. https+https is http+tls.
+	if name, t, ok := DefaultRegistry.LookupTransport(node.Transport); ok {
+		node.Transport = name
+		if t.PathAddr {
+			// the address is specified by the URL path, e.g. unix:///var/run/gost.sock,
+			// or unix:///@gost for the abstract socket.
+			node.Addr = u.Path
+			if strings.HasPrefix(node.Addr, "/@") {
+				node.Addr = node.Addr[1:]
+			}
+			node.Remote = ""
+		}
+	} else {
 		node.Transport = "tcp"
 	}
 
-	switch node.Protocol {
-	case "http", "http2":
-	case "https":
-		node.Protocol = "http"
-	case "socks4", "socks4a":
-	case "socks", "socks5":
-		node.Protocol = "socks5"
-	case "ss", "ssu":
-	case "ss2": // as of 2.10.1, ss2 is same as ss
-		node.Protocol = "ss"
-	case "sni":
-	case "tcp", "udp", "rtcp", "rudp": // port forwarding
-	case "direct", "remote", "forward": // forwarding
-	case "red", "redirect", "redu", "redirectu": // TCP,UDP transparent proxy
-	case "tun", "tap": // tun/tap device
-	case "ftcp": // fake TCP
-	case "dns", "dot", "doh":
-	case "relay":
-	default:
+	if name, _, ok := DefaultRegistry.LookupProtocol(node.Protocol); ok {
+		node.Protocol = name
+	} else {
 		node.Protocol = ""
 	}
 
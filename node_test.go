@@ -28,6 +28,20 @@ var nodeTests = []struct {
 	{"rtcp://:8080/:8081", Node{Addr: ":8080", Remote: ":8081", Protocol: "rtcp", Transport: "rtcp"}, false},
 	{"rudp://:8080/:8081", Node{Addr: ":8080", Remote: ":8081", Protocol: "rudp", Transport: "rudp"}, false},
 	{"redirect://:8080", Node{Addr: ":8080", Protocol: "redirect", Transport: "tcp"}, false},
+	{"http+unix:///var/run/gost.sock", Node{Addr: "/var/run/gost.sock", Protocol: "http", Transport: "unix"}, false},
+	{"socks5+unix:///@gost", Node{Addr: "@gost", Protocol: "socks5", Transport: "unix"}, false},
+	{"unixgram:///tmp/gost.sock", Node{Addr: "/tmp/gost.sock", Transport: "unixgram"}, false},
+	{"http+pipe://proxy", Node{Addr: "proxy", Protocol: "http", Transport: "pipe"}, false},
+	{"hy2://password@:8443", Node{Addr: ":8443", Protocol: "hysteria2", Transport: "hysteria2", User: url.User("password")}, false},
+	{"naive://user:pass@:443", Node{Addr: ":443", Protocol: "naive", Transport: "naive", User: url.UserPassword("user", "pass")}, false},
+	{"anytls://password@:443", Node{Addr: ":443", Protocol: "anytls", Transport: "anytls", User: url.User("password")}, false},
+	{"http+i2p://example.b32.i2p:80", Node{Addr: "example.b32.i2p:80", Protocol: "http", Transport: "i2p"}, false},
+	{"socks5+ygg://[200:1234::1]:1080", Node{Addr: "[200:1234::1]:1080", Protocol: "socks5", Transport: "yggdrasil"}, false},
+	{"socks5+cjdns://[fc00::1]:1080", Node{Addr: "[fc00::1]:1080", Protocol: "socks5", Transport: "cjdns"}, false},
+	{"socks5+lora://:0", Node{Addr: ":0", Protocol: "socks5", Transport: "lora"}, false},
+	{"socks5+rfcomm://:3", Node{Addr: ":3", Protocol: "socks5", Transport: "rfcomm"}, false},
+	{"socks5+ndn://:1080", Node{Addr: ":1080", Protocol: "socks5", Transport: "ndn"}, false},
+	{"tuic://6f5d3c7a-2b1e-4d4f-9a8b-0c1d2e3f4a5b:pass@:443", Node{Addr: ":443", Protocol: "tuic", Transport: "tuic", User: url.UserPassword("6f5d3c7a-2b1e-4d4f-9a8b-0c1d2e3f4a5b", "pass")}, false},
 }
 
 func TestParseNode(t *testing.T) {
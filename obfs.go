@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +16,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,10 +29,35 @@ import (
 	"gitlab.com/yawning/obfs4.git/transports/obfs4"
 )
 
+func init() {
+	DefaultRegistry.Register("ohttp", ObfsHTTPTransporter, ObfsHTTPListener)
+	DefaultRegistry.Register("otls", ObfsTLSTransporter, ObfsTLSListener)
+	DefaultRegistry.RegisterTransport("obfs4", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return Obfs4Transporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			if err := Obfs4Init(node, true); err != nil {
+				return nil, err
+			}
+			return Obfs4Listener(node.Addr)
+		},
+	})
+}
+
 const (
 	maxTLSDataLen = 16384
 )
 
+// ObfsConn is the connection of the HTTP obfuscating tunnels, such as ObfsHTTPTransporter and ObfsHTTP2Transporter.
+// The handshake is done by the first Read or Write, or by Handshake explicitly.
+type ObfsConn interface {
+	net.Conn
+	Handshake() error
+}
+
+var _ ObfsConn = (*obfsHTTPConn)(nil)
+
 type obfsHTTPTransporter struct {
 	tcpTransporter
 }
@@ -727,7 +756,7 @@ func obfs4GetContext(addr string) (obfs4Context, error) {
 
 func obfs4ServerURL(node Node) string {
 	ctx, err := obfs4GetContext(node.Addr)
-	if err != nil {
+	if err != nil || ctx.sargs == nil {
 		return ""
 	}
 
@@ -742,6 +771,72 @@ func obfs4ServerURL(node Node) string {
 	)
 }
 
+const (
+	// obfs4CertSize is the size of the decoded cert of the bridge, the node ID and the public key.
+	obfs4CertSize = 20 + 32
+	// obfs4MaxIATMode is the max iat-mode, 0 (disabled), 1 (enabled) or 2 (paranoid).
+	obfs4MaxIATMode = 2
+)
+
+// ParseBridgeLine parses the obfs4 bridge line of Tor, such as
+//
+//	obfs4 192.0.2.1:443 8F4D84D1B3EB59E6D1B8D6B16F3263E1D1C0A7E1 cert=cb0U...hWA iat-mode=0
+//
+// the Bridge prefix of the torrc is allowed, the fingerprint is optional. The node is ready for Obfs4Init,
+// the cert and iat-mode are set to the Values, as well as the fingerprint if present.
+func ParseBridgeLine(line string) (Node, error) {
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.EqualFold(fields[0], "Bridge") {
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return Node{}, errors.New("bridge: missing transport or address")
+	}
+	if fields[0] != "obfs4" {
+		return Node{}, fmt.Errorf("bridge: unsupported transport %s", fields[0])
+	}
+	addr := fields[1]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return Node{}, fmt.Errorf("bridge: %v", err)
+	}
+	fields = fields[2:]
+
+	values := url.Values{}
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		fp := fields[0]
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != 20 {
+			return Node{}, fmt.Errorf("bridge: invalid fingerprint %s", fp)
+		}
+		values.Set("fingerprint", fp)
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return Node{}, fmt.Errorf("bridge: invalid argument %s", field)
+		}
+		values.Set(k, v)
+	}
+
+	cert := values.Get("cert")
+	if cert == "" {
+		return Node{}, errors.New("bridge: missing cert")
+	}
+	if b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(cert, "=")); err != nil || len(b) != obfs4CertSize {
+		return Node{}, fmt.Errorf("bridge: invalid cert %s", cert)
+	}
+	if s := values.Get("iat-mode"); s != "" {
+		mode, err := strconv.Atoi(s)
+		if err != nil || mode < 0 || mode > obfs4MaxIATMode {
+			return Node{}, fmt.Errorf("bridge: invalid iat-mode %s", s)
+		}
+	} else {
+		values.Set("iat-mode", "0")
+	}
+
+	return ParseNode("obfs4://" + addr + "?" + values.Encode())
+}
+
 func obfs4ClientConn(addr string, conn net.Conn) (net.Conn, error) {
 	ctx, err := obfs4GetContext(addr)
 	if err != nil {
@@ -0,0 +1,89 @@
+package gost
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzConn is a connection reading the fuzz input, the written data is discarded.
+type fuzzConn struct {
+	r *bytes.Reader
+}
+
+func newFuzzConn(data []byte) *fuzzConn {
+	return &fuzzConn{r: bytes.NewReader(data)}
+}
+
+func (c *fuzzConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *fuzzConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *fuzzConn) Close() error                       { return nil }
+func (c *fuzzConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080} }
+func (c *fuzzConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1080} }
+func (c *fuzzConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fuzzConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fuzzConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func FuzzObfsHTTPHandshake(f *testing.F) {
+	// the requests read by the server.
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\nhello"))
+	f.Add([]byte("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"))
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: exa"))
+	f.Add([]byte("GET / HTTP/1.1\r\nX-Large: " + strings.Repeat("a", 8*1024) + "\r\n\r\n"))
+	// the responses read by the client.
+	f.Add([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\nhello"))
+	f.Add([]byte("HTTP/1.1 999999 Invalid\r\n\r\n"))
+	f.Add([]byte("HTTP/1.1 101 Switch"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b := make([]byte, 1024)
+
+		server := &obfsHTTPConn{Conn: newFuzzConn(data), isServer: true}
+		for {
+			if _, err := server.Read(b); err != nil {
+				break
+			}
+		}
+		server.Write([]byte("hello"))
+
+		client := &obfsHTTPConn{Conn: newFuzzConn(data), host: "example.com"}
+		if _, err := client.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		for {
+			if _, err := client.Read(b); err != nil {
+				break
+			}
+		}
+	})
+}
+
+func FuzzObfs4Params(f *testing.F) {
+	f.Add("cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA&iat-mode=0", false)
+	f.Add("cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA&iat-mode=2", false)
+	f.Add("node-id=bf1ed5ca5b2f7e4e2c3d799ff9244d9bf1930c4e&public-key=f1fd0e2b0d7a4b57f5f8e3b743e8c1e49c3bdfc1c1ac70a865f1b4ee03b8c67b&iat-mode=1", false)
+	f.Add("iat-mode=1", true)
+	f.Add("cert=&iat-mode=-1", false)
+	f.Add("iat-mode=%zz", true)
+
+	f.Fuzz(func(t *testing.T, query string, isServeNode bool) {
+		values, _ := url.ParseQuery(query)
+		// the state of the server is written to the state directory.
+		values.Set("state-dir", t.TempDir())
+		node := Node{
+			Addr:      "127.0.0.1:8443",
+			Protocol:  "obfs4",
+			Transport: "obfs4",
+			Values:    values,
+		}
+		if err := Obfs4Init(node, isServeNode); err == nil {
+			obfs4ServerURL(node)
+		}
+		delete(obfs4Map, node.Addr)
+	})
+}
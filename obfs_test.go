@@ -422,3 +422,50 @@ func _TestHTTPOverObfs4(t *testing.T) {
 		})
 	}
 }
+
+var bridgeLineTests = []struct {
+	line     string
+	addr     string
+	fp       string
+	iatMode  string
+	hasError bool
+}{
+	{"obfs4 192.0.2.1:443 8F4D84D1B3EB59E6D1B8D6B16F3263E1D1C0A7E1 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA iat-mode=0",
+		"192.0.2.1:443", "8F4D84D1B3EB59E6D1B8D6B16F3263E1D1C0A7E1", "0", false},
+	{"Bridge obfs4 [2001:db8::1]:8443 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA iat-mode=2",
+		"[2001:db8::1]:8443", "", "2", false},
+	{"  bridge obfs4 192.0.2.1:443 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA",
+		"192.0.2.1:443", "", "0", false},
+	{"obfs4 192.0.2.1:443 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA iat-mode=3", "", "", "", true},
+	{"obfs4 192.0.2.1:443 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1X iat-mode=0", "", "", "", true},
+	{"obfs4 192.0.2.1:443 iat-mode=0", "", "", "", true},
+	{"obfs4 192.0.2.1:443 8F4D cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA", "", "", "", true},
+	{"obfs4 192.0.2.1 cert=cb0UkgNYIV2Qtpk1BS8knv3SW1XftT6NGgDra/Qklw68vDRwJprtu8/6MCnrhC0lYwAhWA", "", "", "", true},
+	{"meek 192.0.2.1:443 url=https://example.com/", "", "", "", true},
+	{"Bridge", "", "", "", true},
+}
+
+func TestParseBridgeLine(t *testing.T) {
+	for i, tc := range bridgeLineTests {
+		node, err := ParseBridgeLine(tc.line)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("#%d should failed", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d got error %v", i, err)
+			continue
+		}
+		if node.Addr != tc.addr || node.Transport != "obfs4" ||
+			node.Values.Get("fingerprint") != tc.fp || node.Values.Get("iat-mode") != tc.iatMode {
+			t.Errorf("#%d got %s %s %v", i, node.Addr, node.Transport, node.Values)
+		}
+
+		if err := Obfs4Init(node, false); err != nil {
+			t.Errorf("#%d Obfs4Init: %v", i, err)
+		}
+		delete(obfs4Map, node.Addr)
+	}
+}
@@ -0,0 +1,321 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func init() {
+	DefaultRegistry.Register("oh2", ObfsHTTP2Transporter, ObfsHTTP2Listener)
+}
+
+const (
+	// obfsHTTP2StreamID is the stream of the obfuscated data.
+	obfsHTTP2StreamID = 1
+	// obfsHTTP2MaxPadding is the max length of the random padding of the DATA frames.
+	obfsHTTP2MaxPadding = 255
+	// obfsHTTP2MaxData is the max data of a DATA frame, which keeps the frame within the default max frame size.
+	obfsHTTP2MaxData = 16384 - 1 - obfsHTTP2MaxPadding
+	obfsHTTP2Path    = "/upload"
+)
+
+type obfsHTTP2Transporter struct {
+	tcpTransporter
+}
+
+// ObfsHTTP2Transporter creates a Transporter that is used by HTTP/2 obfuscating tunnel client.
+// The data is sent as the DATA frames of a HTTP/2 POST request to /upload, which is answered with 200,
+// the DATA frames carry the random padding to vary their sizes. It is not a real HTTP/2 connection,
+// there is only one stream and no flow control.
+func ObfsHTTP2Transporter() Transporter {
+	return &obfsHTTP2Transporter{}
+}
+
+func (tr *obfsHTTP2Transporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return newObfsHTTP2Conn(conn, opts.Host, false), nil
+}
+
+type obfsHTTP2Listener struct {
+	net.Listener
+}
+
+// ObfsHTTP2Listener creates a Listener for HTTP/2 obfuscating tunnel server.
+func ObfsHTTP2Listener(addr string) (Listener, error) {
+	laddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &obfsHTTP2Listener{Listener: tcpKeepAliveListener{ln}}, nil
+}
+
+func (l *obfsHTTP2Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newObfsHTTP2Conn(conn, "", true), nil
+}
+
+type obfsHTTP2Conn struct {
+	net.Conn
+	host     string
+	isServer bool
+	framer   *http2.Framer
+	wbuf     bytes.Buffer // the frames written by the framer
+	rbuf     []byte       // the data of the DATA frame left by the last read
+
+	handshaked     bool
+	handshakeErr   error
+	handshakeMutex sync.Mutex
+	rmux           sync.Mutex
+	wmux           sync.Mutex
+}
+
+var _ ObfsConn = (*obfsHTTP2Conn)(nil)
+
+func newObfsHTTP2Conn(conn net.Conn, host string, isServer bool) *obfsHTTP2Conn {
+	c := &obfsHTTP2Conn{
+		Conn:     conn,
+		host:     host,
+		isServer: isServer,
+	}
+	c.framer = http2.NewFramer(&c.wbuf, conn)
+	c.framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	// the padding is random instead of zero.
+	c.framer.AllowIllegalWrites = true
+	return c
+}
+
+func (c *obfsHTTP2Conn) Handshake() error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+
+	if c.handshaked {
+		return c.handshakeErr
+	}
+	c.handshaked = true
+	if c.isServer {
+		c.handshakeErr = c.serverHandshake()
+	} else {
+		c.handshakeErr = c.clientHandshake()
+	}
+	return c.handshakeErr
+}
+
+func (c *obfsHTTP2Conn) clientHandshake() error {
+	host := c.host
+	if host == "" {
+		host = c.RemoteAddr().String()
+	}
+
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	c.wbuf.WriteString(http2.ClientPreface)
+	c.framer.WriteSettings(
+		http2.Setting{ID: http2.SettingEnablePush, Val: 0},
+		http2.Setting{ID: http2.SettingInitialWindowSize, Val: 6291456},
+		http2.Setting{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+	)
+	c.framer.WriteWindowUpdate(0, 15663105)
+	c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID: obfsHTTP2StreamID,
+		BlockFragment: obfsHTTP2Headers(
+			hpack.HeaderField{Name: ":method", Value: "POST"},
+			hpack.HeaderField{Name: ":authority", Value: host},
+			hpack.HeaderField{Name: ":scheme", Value: "https"},
+			hpack.HeaderField{Name: ":path", Value: obfsHTTP2Path},
+			hpack.HeaderField{Name: "content-type", Value: "application/octet-stream"},
+			hpack.HeaderField{Name: "user-agent", Value: DefaultUserAgent},
+		),
+		EndHeaders: true,
+	})
+	if Debug {
+		log.Logf("[oh2] %s -> %s : POST %s%s", c.LocalAddr(), c.RemoteAddr(), host, obfsHTTP2Path)
+	}
+	// the request is sent with the first data.
+	return nil
+}
+
+func (c *obfsHTTP2Conn) serverHandshake() error {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(c.Conn, preface); err != nil {
+		return err
+	}
+	if string(preface) != http2.ClientPreface {
+		return errors.New("oh2: bad preface")
+	}
+
+	for {
+		f, err := c.framer.ReadFrame()
+		if err != nil {
+			return err
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if err := c.ackSettings(f); err != nil {
+				return err
+			}
+		case *http2.MetaHeadersFrame:
+			if Debug {
+				log.Logf("[oh2] %s -> %s : %s %s%s", c.RemoteAddr(), c.LocalAddr(),
+					f.PseudoValue("method"), f.PseudoValue("authority"), f.PseudoValue("path"))
+			}
+			if f.PseudoValue("method") != "POST" || f.StreamID != obfsHTTP2StreamID {
+				c.writeResponse(404, true)
+				return errors.New("oh2: bad request")
+			}
+			return c.writeResponse(200, false)
+		case *http2.WindowUpdateFrame, *http2.PingFrame, *http2.PriorityFrame:
+		default:
+			return fmt.Errorf("oh2: unexpected frame %v", f.Header())
+		}
+	}
+}
+
+func (c *obfsHTTP2Conn) writeResponse(status int, endStream bool) error {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	c.framer.WriteSettings(
+		http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 128},
+		http2.Setting{ID: http2.SettingInitialWindowSize, Val: 65536},
+		http2.Setting{ID: http2.SettingMaxFrameSize, Val: 16777215},
+	)
+	c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID: obfsHTTP2StreamID,
+		BlockFragment: obfsHTTP2Headers(
+			hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)},
+			hpack.HeaderField{Name: "server", Value: "nginx"},
+			hpack.HeaderField{Name: "content-type", Value: "application/octet-stream"},
+		),
+		EndHeaders: true,
+		EndStream:  endStream,
+	})
+	_, err := c.wbuf.WriteTo(c.Conn)
+	return err
+}
+
+func (c *obfsHTTP2Conn) ackSettings(f *http2.SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	c.framer.WriteSettingsAck()
+	_, err := c.wbuf.WriteTo(c.Conn)
+	return err
+}
+
+func obfsHTTP2Headers(fields ...hpack.HeaderField) []byte {
+	var buf bytes.Buffer
+	enc := hpack.NewEncoder(&buf)
+	for _, f := range fields {
+		enc.WriteField(f)
+	}
+	return buf.Bytes()
+}
+
+func (c *obfsHTTP2Conn) Read(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if !c.isServer {
+		// the request is sent before waiting for the response.
+		if err = c.flush(); err != nil {
+			return
+		}
+	}
+
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	for len(c.rbuf) == 0 {
+		f, err := c.framer.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch f := f.(type) {
+		case *http2.DataFrame:
+			if f.StreamEnded() && len(f.Data()) == 0 {
+				return 0, io.EOF
+			}
+			// the data is valid until the next frame is read.
+			c.rbuf = append(c.rbuf[:0], f.Data()...)
+		case *http2.SettingsFrame:
+			if err := c.ackSettings(f); err != nil {
+				return 0, err
+			}
+		case *http2.MetaHeadersFrame:
+			if status := f.PseudoValue("status"); status != "" && status != "200" {
+				return 0, fmt.Errorf("oh2: bad response %s", status)
+			}
+		case *http2.RSTStreamFrame, *http2.GoAwayFrame:
+			return 0, io.EOF
+		}
+	}
+	n = copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return
+}
+
+func (c *obfsHTTP2Conn) flush() error {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	if c.wbuf.Len() == 0 {
+		return nil
+	}
+	_, err := c.wbuf.WriteTo(c.Conn)
+	return err
+}
+
+func (c *obfsHTTP2Conn) Write(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	for n < len(b) {
+		p := b[n:]
+		if len(p) > obfsHTTP2MaxData {
+			p = p[:obfsHTTP2MaxData]
+		}
+		if err = c.framer.WriteDataPadded(obfsHTTP2StreamID, false, p, obfsHTTP2Padding()); err != nil {
+			return
+		}
+		if _, err = c.wbuf.WriteTo(c.Conn); err != nil {
+			return
+		}
+		n += len(p)
+	}
+	return
+}
+
+// obfsHTTP2Padding returns the random padding of a DATA frame.
+func obfsHTTP2Padding() []byte {
+	size, _ := rand.Int(rand.Reader, big.NewInt(obfsHTTP2MaxPadding+1))
+	pad := make([]byte, size.Int64())
+	rand.Read(pad)
+	return pad
+}
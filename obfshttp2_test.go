@@ -0,0 +1,116 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func httpOverObfsHTTP2Roundtrip(targetURL string, data []byte,
+	clientInfo *url.Userinfo, serverInfo []*url.Userinfo) error {
+
+	ln, err := ObfsHTTP2Listener("")
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		Connector:   HTTPConnector(clientInfo),
+		Transporter: ObfsHTTP2Transporter(),
+	}
+
+	server := &Server{
+		Listener: ln,
+		Handler: HTTPHandler(
+			UsersHandlerOption(serverInfo...),
+		),
+	}
+
+	go server.Run()
+	defer server.Close()
+
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestHTTPOverObfsHTTP2(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	for i, tc := range httpProxyTests {
+		tc := tc
+		t.Run(fmt.Sprintf("#%d", i), func(t *testing.T) {
+			err := httpOverObfsHTTP2Roundtrip(httpSrv.URL, sendData, tc.cliUser, tc.srvUsers)
+			if err == nil {
+				if tc.errStr != "" {
+					t.Errorf("#%d should failed with error %s", i, tc.errStr)
+				}
+			} else {
+				if tc.errStr == "" {
+					t.Errorf("#%d got error %v", i, err)
+				}
+				if err.Error() != tc.errStr {
+					t.Errorf("#%d got error %v, want %v", i, err, tc.errStr)
+				}
+			}
+		})
+	}
+}
+
+func TestObfsHTTP2Frames(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	client, err := ObfsHTTP2Transporter().Handshake(c1, HostHandshakeOption("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("gost"), 10000)
+	go client.Write(data)
+
+	// the client is seen as a HTTP/2 POST request.
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(c2, preface); err != nil {
+		t.Fatal(err)
+	}
+	if string(preface) != http2.ClientPreface {
+		t.Fatalf("bad preface %q", preface)
+	}
+	fr := http2.NewFramer(nil, c2)
+	var got []byte
+	sizes := make(map[uint32]bool)
+	for len(got) < len(data) {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			if f.StreamID != obfsHTTP2StreamID || len(got) > 0 {
+				t.Errorf("unexpected headers %v", f)
+			}
+		case *http2.DataFrame:
+			if !f.Flags.Has(http2.FlagDataPadded) {
+				t.Error("the data frame is not padded")
+			}
+			got = append(got, f.Data()...)
+			sizes[f.Length-uint32(len(f.Data()))] = true
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want %d", len(got), len(data))
+	}
+	if len(sizes) < 2 {
+		t.Errorf("the padding is not random: %v", sizes)
+	}
+}
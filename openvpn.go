@@ -0,0 +1,334 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// the opcodes of the OpenVPN packets.
+const (
+	openVPNControlV1         = 4
+	openVPNAckV1             = 5
+	openVPNHardResetClientV2 = 7
+	openVPNHardResetServerV2 = 8
+	openVPNHMACSize          = sha1.Size
+	openVPNMaxControlPayload = 1250
+	openVPNSessionIDSize     = 8
+)
+
+var errOpenVPNBadHMAC = errors.New("openvpn: packet HMAC verification failed")
+
+// openVPNPacket is the packet of the OpenVPN control channel with the tls-auth HMAC:
+//
+//	[opcode|key ID][session ID][HMAC][packet ID][net time][ack count][acks][remote session ID][message packet ID][payload]
+//
+// the remote session ID is present if there are acks, the message packet ID is absent in P_ACK_V1.
+type openVPNPacket struct {
+	opcode          byte
+	keyID           byte
+	sessionID       [openVPNSessionIDSize]byte
+	packetID        uint32
+	netTime         uint32
+	acks            []uint32
+	remoteSessionID [openVPNSessionIDSize]byte
+	msgPacketID     uint32
+	payload         []byte
+}
+
+// marshal encodes the packet, the HMAC-SHA1 is computed by the key over
+// [packet ID][net time][opcode|key ID][session ID][ack count]...[payload].
+func (p *openVPNPacket) marshal(key []byte) []byte {
+	var rest bytes.Buffer
+	rest.WriteByte(byte(len(p.acks)))
+	for _, id := range p.acks {
+		binary.Write(&rest, binary.BigEndian, id)
+	}
+	if len(p.acks) > 0 {
+		rest.Write(p.remoteSessionID[:])
+	}
+	if p.opcode != openVPNAckV1 {
+		binary.Write(&rest, binary.BigEndian, p.msgPacketID)
+	}
+	rest.Write(p.payload)
+
+	replay := make([]byte, 8)
+	binary.BigEndian.PutUint32(replay, p.packetID)
+	binary.BigEndian.PutUint32(replay[4:], p.netTime)
+	op := p.opcode<<3 | p.keyID&0x07
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(replay)
+	mac.Write([]byte{op})
+	mac.Write(p.sessionID[:])
+	mac.Write(rest.Bytes())
+
+	b := make([]byte, 0, 1+openVPNSessionIDSize+openVPNHMACSize+len(replay)+rest.Len())
+	b = append(b, op)
+	b = append(b, p.sessionID[:]...)
+	b = mac.Sum(b)
+	b = append(b, replay...)
+	return append(b, rest.Bytes()...)
+}
+
+func (p *openVPNPacket) unmarshal(b []byte, key []byte) error {
+	const header = 1 + openVPNSessionIDSize + openVPNHMACSize + 8
+	if len(b) < header+1 {
+		return errors.New("openvpn: short packet")
+	}
+	p.opcode, p.keyID = b[0]>>3, b[0]&0x07
+	copy(p.sessionID[:], b[1:])
+	sum := b[1+openVPNSessionIDSize : 1+openVPNSessionIDSize+openVPNHMACSize]
+	replay := b[header-8 : header]
+	rest := b[header:]
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(replay)
+	mac.Write(b[:1+openVPNSessionIDSize])
+	mac.Write(rest)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return errOpenVPNBadHMAC
+	}
+	p.packetID = binary.BigEndian.Uint32(replay)
+	p.netTime = binary.BigEndian.Uint32(replay[4:])
+
+	n := int(rest[0])
+	rest = rest[1:]
+	if len(rest) < n*4 {
+		return errors.New("openvpn: short ack array")
+	}
+	p.acks = nil
+	for i := 0; i < n; i++ {
+		p.acks = append(p.acks, binary.BigEndian.Uint32(rest[i*4:]))
+	}
+	rest = rest[n*4:]
+	if n > 0 {
+		if len(rest) < openVPNSessionIDSize {
+			return errors.New("openvpn: short remote session ID")
+		}
+		copy(p.remoteSessionID[:], rest)
+		rest = rest[openVPNSessionIDSize:]
+	}
+	if p.opcode != openVPNAckV1 {
+		if len(rest) < 4 {
+			return errors.New("openvpn: short message packet ID")
+		}
+		p.msgPacketID = binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+	}
+	p.payload = rest
+	return nil
+}
+
+// openVPNControlConn is the reliable stream of the P_CONTROL_V1 packets of an OpenVPN session, over TCP.
+type openVPNControlConn struct {
+	net.Conn
+	key       []byte
+	localSID  [openVPNSessionIDSize]byte
+	remoteSID [openVPNSessionIDSize]byte
+
+	wmux     sync.Mutex
+	packetID uint32 // the last packet ID of the replay protection
+	msgID    uint32 // the next message packet ID to send
+
+	rmux   sync.Mutex
+	recvID uint32 // the next message packet ID to receive
+	rbuf   []byte
+}
+
+func (c *openVPNControlConn) writePacket(p *openVPNPacket) error {
+	c.packetID++
+	p.packetID = c.packetID
+	p.netTime = uint32(time.Now().Unix())
+	p.sessionID = c.localSID
+	b := p.marshal(c.key)
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+func (c *openVPNControlConn) readPacket() (*openVPNPacket, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.Conn, size[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(c.Conn, b); err != nil {
+		return nil, err
+	}
+	p := &openVPNPacket{}
+	if err := p.unmarshal(b, c.key); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (c *openVPNControlConn) ack(id uint32) error {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	return c.writePacket(&openVPNPacket{
+		opcode:          openVPNAckV1,
+		acks:            []uint32{id},
+		remoteSessionID: c.remoteSID,
+	})
+}
+
+func (c *openVPNControlConn) Read(b []byte) (n int, err error) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	for len(c.rbuf) == 0 {
+		p, err := c.readPacket()
+		if err != nil {
+			return 0, err
+		}
+		if p.sessionID != c.remoteSID {
+			return 0, errors.New("openvpn: unknown session")
+		}
+		switch p.opcode {
+		case openVPNControlV1, openVPNHardResetServerV2, openVPNHardResetClientV2:
+			if err := c.ack(p.msgPacketID); err != nil {
+				return 0, err
+			}
+			// the retransmission of the received packet.
+			if p.msgPacketID < c.recvID {
+				continue
+			}
+			if p.msgPacketID != c.recvID {
+				return 0, fmt.Errorf("openvpn: message packet %d, want %d", p.msgPacketID, c.recvID)
+			}
+			c.recvID++
+			if p.opcode == openVPNControlV1 {
+				c.rbuf = p.payload
+			}
+		case openVPNAckV1:
+		default:
+			if Debug {
+				log.Logf("[openvpn] %s - %s : ignore packet of opcode %d", c.LocalAddr(), c.RemoteAddr(), p.opcode)
+			}
+		}
+	}
+	n = copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return
+}
+
+func (c *openVPNControlConn) Write(b []byte) (n int, err error) {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	for n < len(b) {
+		payload := b[n:]
+		if len(payload) > openVPNMaxControlPayload {
+			payload = payload[:openVPNMaxControlPayload]
+		}
+		err = c.writePacket(&openVPNPacket{
+			opcode:      openVPNControlV1,
+			msgPacketID: c.msgID,
+			payload:     payload,
+		})
+		if err != nil {
+			return
+		}
+		c.msgID++
+		n += len(payload)
+	}
+	return
+}
+
+// openVPNClientReset sends P_CONTROL_HARD_RESET_CLIENT_V2 and processes P_CONTROL_HARD_RESET_SERVER_V2,
+// then the control channel is ready for the TLS handshake.
+func openVPNClientReset(conn net.Conn, key []byte) (*openVPNControlConn, error) {
+	c := &openVPNControlConn{Conn: conn, key: key}
+	rand.Read(c.localSID[:])
+
+	if err := c.writePacket(&openVPNPacket{opcode: openVPNHardResetClientV2}); err != nil {
+		return nil, err
+	}
+	c.msgID = 1
+
+	for {
+		p, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		if len(p.acks) > 0 && p.remoteSessionID != c.localSID {
+			return nil, errors.New("openvpn: the reset is acknowledged with a wrong session ID")
+		}
+		switch p.opcode {
+		case openVPNHardResetServerV2:
+			c.remoteSID = p.sessionID
+			c.recvID = p.msgPacketID + 1
+			if err := c.ack(p.msgPacketID); err != nil {
+				return nil, err
+			}
+			return c, nil
+		case openVPNAckV1:
+		default:
+			return nil, fmt.Errorf("openvpn: unexpected opcode %d for the reset", p.opcode)
+		}
+	}
+}
+
+type openVPNTransporter struct {
+	tcpTransporter
+	key []byte
+}
+
+// OpenVPNTransporter creates a Transporter that connects to the TLS control channel of an OpenVPN 2.x server in TCP mode.
+// It sends P_CONTROL_HARD_RESET_CLIENT_V2, processes the P_CONTROL_HARD_RESET_SERVER_V2 reply, then runs the TLS
+// handshake over the P_CONTROL_V1 packets, and returns the TLS connection. All packets are authenticated by HMAC-SHA1
+// of the tls-auth, with the first 20 bytes of psk as the key for both directions (no key-direction), which is the
+// HMAC key of the static key file. The packets failing the HMAC verification are rejected.
+//
+// It is not a full OpenVPN client, the key method exchange and the data channel are not implemented,
+// the stream over the TLS is left to the caller. The TLS config is by TLSConfigHandshakeOption, the certificate
+// of the server is not verified if no TLS config is given.
+func OpenVPNTransporter(psk [64]byte) Transporter {
+	return &openVPNTransporter{key: append([]byte(nil), psk[:openVPNHMACSize]...)}
+}
+
+func (tr *openVPNTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = HandshakeTimeout
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	cc, err := openVPNClientReset(conn, tr.key)
+	if err != nil {
+		return nil, err
+	}
+	if Debug {
+		log.Logf("[openvpn] %s - %s : session %x reset", conn.LocalAddr(), conn.RemoteAddr(), cc.localSID)
+	}
+
+	tlsConfig := opts.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tc := tls.Client(cc, tlsConfig)
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
@@ -0,0 +1,130 @@
+package gost
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+)
+
+// openVPNTestServer replies the reset of the client and serves the TLS echo over the control channel.
+func openVPNTestServer(t *testing.T, conn net.Conn, key []byte) {
+	defer conn.Close()
+
+	c := &openVPNControlConn{Conn: conn, key: key}
+	p, err := c.readPacket()
+	if err != nil {
+		return
+	}
+	if p.opcode != openVPNHardResetClientV2 {
+		t.Errorf("got opcode %d, want %d", p.opcode, openVPNHardResetClientV2)
+		return
+	}
+	rand.Read(c.localSID[:])
+	c.remoteSID = p.sessionID
+	c.recvID = p.msgPacketID + 1
+	err = c.writePacket(&openVPNPacket{
+		opcode:          openVPNHardResetServerV2,
+		acks:            []uint32{p.msgPacketID},
+		remoteSessionID: p.sessionID,
+	})
+	if err != nil {
+		return
+	}
+	c.msgID = 1
+
+	tc := tls.Server(c, DefaultTLSConfig)
+	io.Copy(tc, tc)
+}
+
+// openVPNTestConn connects to an OpenVPN test server with the key.
+func openVPNTestConn(t *testing.T, key []byte) net.Conn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		openVPNTestServer(t, conn, key)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestOpenVPNTransporter(t *testing.T) {
+	var psk [64]byte
+	rand.Read(psk[:])
+
+	c1 := openVPNTestConn(t, psk[:openVPNHMACSize])
+
+	conn, err := OpenVPNTransporter(psk).Handshake(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the data is split into the control packets.
+	data := make([]byte, 10000)
+	rand.Read(data)
+	go conn.Write(data)
+	b := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(data) {
+		t.Error("the data does not match")
+	}
+}
+
+func TestOpenVPNTransporterBadKey(t *testing.T) {
+	var psk, other [64]byte
+	rand.Read(psk[:])
+	rand.Read(other[:])
+
+	c1 := openVPNTestConn(t, other[:openVPNHMACSize])
+	defer c1.Close()
+
+	if _, err := OpenVPNTransporter(psk).Handshake(c1); err == nil {
+		t.Error("the handshake with the wrong key should fail")
+	}
+}
+
+func TestOpenVPNPacket(t *testing.T) {
+	key := []byte("0123456789abcdefghij")
+	p := &openVPNPacket{
+		opcode:          openVPNControlV1,
+		keyID:           1,
+		sessionID:       [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		packetID:        3,
+		netTime:         1700000000,
+		acks:            []uint32{1, 2},
+		remoteSessionID: [8]byte{8, 7, 6, 5, 4, 3, 2, 1},
+		msgPacketID:     5,
+		payload:         []byte("hello"),
+	}
+	b := p.marshal(key)
+
+	var q openVPNPacket
+	if err := q.unmarshal(b, key); err != nil {
+		t.Fatal(err)
+	}
+	if q.opcode != p.opcode || q.keyID != p.keyID || q.sessionID != p.sessionID || q.packetID != p.packetID ||
+		q.netTime != p.netTime || len(q.acks) != 2 || q.acks[1] != 2 || q.remoteSessionID != p.remoteSessionID ||
+		q.msgPacketID != p.msgPacketID || string(q.payload) != "hello" {
+		t.Errorf("got %+v, want %+v", q, p)
+	}
+
+	b[len(b)-1] ^= 1
+	if err := q.unmarshal(b, key); err != errOpenVPNBadHMAC {
+		t.Errorf("got %v, want %v", err, errOpenVPNBadHMAC)
+	}
+}
@@ -0,0 +1,77 @@
+package gost
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation name of the tracer.
+const tracerName = "github.com/ginuerzh/gost"
+
+// tracePropagator propagates the W3C trace context (Traceparent) and baggage of the HTTP requests.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// startProxySpan starts the span of the proxy connection from the client conn to the target dst.
+// The span is a child of the trace context of the HTTP request header if it is not nil, or a new root.
+// A noop span is returned if the tracer provider is not set.
+//
+// The spans are exported by the exporter of the tracer provider, e.g. the OTLP exporter
+// (go.opentelemetry.io/otel/exporters/otlp/otlptrace) of the SDK tracer provider.
+func startProxySpan(tp trace.TracerProvider, protocol string, conn net.Conn, dst string, header http.Header) (context.Context, trace.Span) {
+	ctx := context.Background()
+	if tp == nil {
+		return ctx, noop.Span{}
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("proxy.src", conn.RemoteAddr().String()),
+			attribute.String("proxy.dst", dst),
+			attribute.String("proxy.protocol", protocol),
+		),
+	}
+	if header != nil {
+		ctx = tracePropagator.Extract(ctx, propagation.HeaderCarrier(header))
+	} else {
+		opts = append(opts, trace.WithNewRoot())
+	}
+	return tp.Tracer(tracerName).Start(ctx, protocol+" "+dst, opts...)
+}
+
+// setSpanRoute sets the route of the chain to the span.
+func setSpanRoute(span trace.Span, route *Chain) {
+	if route == nil || !span.IsRecording() {
+		return
+	}
+	var nodes []string
+	for _, node := range route.route {
+		nodes = append(nodes, node.String())
+	}
+	span.SetAttributes(attribute.String("proxy.chain", strings.Join(nodes, ",")))
+}
+
+// setSpanError records the error to the span.
+func setSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// injectTraceContext replaces the trace context of the forwarded HTTP request with the span of the context.
+func injectTraceContext(ctx context.Context, header http.Header) {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	tracePropagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
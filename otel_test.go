@@ -0,0 +1,144 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == attribute.Key(key) {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestHTTPHandlerTracing(t *testing.T) {
+	traceparents := make(chan string, 1)
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("Traceparent")
+	}))
+	defer httpSrv.Close()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(WithOpenTelemetryTracer(tp)),
+	}
+	go server.Run()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, httpSrv.URL, nil)
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	req.Header.Set("Baggage", "tenant=gost")
+	if err := req.WriteProxy(conn); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	conn.Close()
+
+	upstream := <-traceparents
+	server.Close()
+	server.Shutdown(context.Background())
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans", len(spans))
+	}
+	span := spans[0]
+	if span.SpanContext().TraceID().String() != traceID {
+		t.Errorf("trace ID %s, want %s", span.SpanContext().TraceID(), traceID)
+	}
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("parent %s", span.Parent().SpanID())
+	}
+	if want := "00-" + traceID + "-" + span.SpanContext().SpanID().String() + "-01"; upstream != want {
+		t.Errorf("the forwarded traceparent %s, want %s", upstream, want)
+	}
+	if v := spanAttr(span, "proxy.protocol"); v != "http" {
+		t.Errorf("proxy.protocol %s", v)
+	}
+	if v := spanAttr(span, "proxy.dst"); v != httpSrv.Listener.Addr().String() {
+		t.Errorf("proxy.dst %s", v)
+	}
+	if v := spanAttr(span, "proxy.src"); v == "" {
+		t.Error("proxy.src is empty")
+	}
+}
+
+func TestSOCKS5HandlerTracing(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  SOCKS5Handler(WithOpenTelemetryTracer(tp)),
+	}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   SOCKS5Connector(nil),
+		Transporter: TCPTransporter(),
+	}
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	server.Shutdown(context.Background())
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans", len(spans))
+	}
+	span := spans[0]
+	if span.Parent().IsValid() {
+		t.Error("the span should be a root")
+	}
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span kind %s", span.SpanKind())
+	}
+	if v := spanAttr(span, "proxy.protocol"); v != "socks5" {
+		t.Errorf("proxy.protocol %s", v)
+	}
+	if v := spanAttr(span, "proxy.dst"); v != httpSrv.Listener.Addr().String() {
+		t.Errorf("proxy.dst %s", v)
+	}
+}
@@ -0,0 +1,278 @@
+package gost
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	pcapMagic   = 0xa1b2c3d4
+	pcapSnapLen = 65535
+	// pcapLinkTypeRaw is LINKTYPE_RAW, the link type of DLT_RAW in the pcap files.
+	pcapLinkTypeRaw = 101
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagPSH = 0x08
+	tcpFlagACK = 0x10
+)
+
+// PCAPListener wraps the listener to capture the data of the accepted connections to a pcap file (libpcap format, DLT_RAW).
+// The data of the connections is written as the TCP segments in the IP packets between their addresses,
+// with a TCP handshake when a connection is accepted and a FIN when it is closed, so they can be analyzed by Wireshark.
+// As the data is captured after the transport of the listener (e.g. TLS) is decoded, it shows the inner protocol.
+// The file is closed when the listener is closed.
+func PCAPListener(ln Listener, outputPath string) (Listener, error) {
+	f, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &pcapWriter{f: f}
+	if err := w.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &pcapListener{Listener: ln, w: w}, nil
+}
+
+type pcapListener struct {
+	Listener
+	w *pcapWriter
+}
+
+func (l *pcapListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newPCAPConn(conn, l.w), nil
+}
+
+func (l *pcapListener) Close() error {
+	err := l.Listener.Close()
+	l.w.close()
+	return err
+}
+
+type pcapWriter struct {
+	mux    sync.Mutex
+	f      *os.File
+	closed bool
+}
+
+func (w *pcapWriter) writeHeader() error {
+	b := make([]byte, 24)
+	binary.LittleEndian.PutUint32(b[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(b[4:], 2) // version 2.4
+	binary.LittleEndian.PutUint16(b[6:], 4)
+	// thiszone and sigfigs are 0.
+	binary.LittleEndian.PutUint32(b[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(b[20:], pcapLinkTypeRaw)
+	_, err := w.f.Write(b)
+	return err
+}
+
+// writeRecord writes the packet captured at t, the packet is truncated to the snaplen.
+func (w *pcapWriter) writeRecord(t time.Time, packet []byte) error {
+	orig := len(packet)
+	if len(packet) > pcapSnapLen {
+		packet = packet[:pcapSnapLen]
+	}
+	b := make([]byte, 16+len(packet))
+	binary.LittleEndian.PutUint32(b[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(b[12:], uint32(orig))
+	copy(b[16:], packet)
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	_, err := w.f.Write(b)
+	return err
+}
+
+func (w *pcapWriter) close() {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if !w.closed {
+		w.closed = true
+		w.f.Close()
+	}
+}
+
+// pcapEndpoint is an endpoint of the captured TCP connection.
+type pcapEndpoint struct {
+	ip   net.IP
+	port uint16
+	seq  uint32 // the next sequence number sent by the endpoint
+}
+
+func newPCAPEndpoint(addr net.Addr) *pcapEndpoint {
+	ep := &pcapEndpoint{ip: net.IPv4zero}
+	if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			ep.ip = ip
+		}
+		if n, err := net.LookupPort("tcp", port); err == nil {
+			ep.port = uint16(n)
+		}
+	}
+	return ep
+}
+
+type pcapConn struct {
+	net.Conn
+	w              *pcapWriter
+	mux            sync.Mutex
+	client, server *pcapEndpoint
+	once           sync.Once
+}
+
+func newPCAPConn(conn net.Conn, w *pcapWriter) *pcapConn {
+	c := &pcapConn{
+		Conn:   conn,
+		w:      w,
+		client: newPCAPEndpoint(conn.RemoteAddr()),
+		server: newPCAPEndpoint(conn.LocalAddr()),
+	}
+	// the IP versions of the packets must be the same.
+	if (c.client.ip.To4() == nil) != (c.server.ip.To4() == nil) {
+		c.client.ip, c.server.ip = c.client.ip.To16(), c.server.ip.To16()
+	}
+
+	c.capture(c.client, c.server, tcpFlagSYN, nil)
+	c.capture(c.server, c.client, tcpFlagSYN|tcpFlagACK, nil)
+	c.capture(c.client, c.server, tcpFlagACK, nil)
+	return c
+}
+
+func (c *pcapConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.capture(c.client, c.server, tcpFlagPSH|tcpFlagACK, b[:n])
+	}
+	return
+}
+
+func (c *pcapConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		c.capture(c.server, c.client, tcpFlagPSH|tcpFlagACK, b[:n])
+	}
+	return
+}
+
+func (c *pcapConn) Close() error {
+	c.once.Do(func() {
+		c.capture(c.server, c.client, tcpFlagFIN|tcpFlagACK, nil)
+	})
+	return c.Conn.Close()
+}
+
+// capture writes the data sent from src to dst as the TCP segments.
+func (c *pcapConn) capture(src, dst *pcapEndpoint, flags byte, data []byte) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := time.Now()
+	hlen := 20 + 20
+	if src.ip.To4() == nil {
+		hlen = 40 + 20
+	}
+	for {
+		payload := data
+		if max := pcapSnapLen - hlen; len(payload) > max {
+			payload = payload[:max]
+		}
+		if err := c.w.writeRecord(now, tcpPacket(src, dst, flags, payload)); err != nil {
+			return
+		}
+		src.seq += uint32(len(payload))
+		if flags&(tcpFlagSYN|tcpFlagFIN) != 0 {
+			src.seq++
+		}
+		data = data[len(payload):]
+		if len(data) == 0 {
+			return
+		}
+	}
+}
+
+// tcpPacket builds the IP packet of the TCP segment.
+func tcpPacket(src, dst *pcapEndpoint, flags byte, payload []byte) []byte {
+	tcp := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], src.seq)
+	if flags&tcpFlagACK != 0 {
+		binary.BigEndian.PutUint32(tcp[8:], dst.seq)
+	}
+	tcp[12] = 5 << 4 // data offset
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], 0xffff) // window
+	copy(tcp[20:], payload)
+
+	var packet, pseudo []byte
+	if ip4, dst4 := src.ip.To4(), dst.ip.To4(); ip4 != nil && dst4 != nil {
+		packet = make([]byte, 20+len(tcp))
+		packet[0] = 0x45
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+		binary.BigEndian.PutUint16(packet[6:], 0x4000) // don't fragment
+		packet[8] = 64                                 // TTL
+		packet[9] = 6                                  // TCP
+		copy(packet[12:], ip4)
+		copy(packet[16:], dst4)
+		binary.BigEndian.PutUint16(packet[10:], ipChecksum(0, packet[:20]))
+
+		pseudo = make([]byte, 12)
+		copy(pseudo, ip4)
+		copy(pseudo[4:], dst4)
+		pseudo[9] = 6
+		binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+	} else {
+		packet = make([]byte, 40+len(tcp))
+		packet[0] = 0x60
+		binary.BigEndian.PutUint16(packet[4:], uint16(len(tcp)))
+		packet[6] = 6  // TCP
+		packet[7] = 64 // hop limit
+		copy(packet[8:], src.ip.To16())
+		copy(packet[24:], dst.ip.To16())
+
+		pseudo = make([]byte, 40)
+		copy(pseudo, src.ip.To16())
+		copy(pseudo[16:], dst.ip.To16())
+		binary.BigEndian.PutUint32(pseudo[32:], uint32(len(tcp)))
+		pseudo[39] = 6
+	}
+	binary.BigEndian.PutUint16(tcp[16:], ipChecksum(ipChecksumSum(0, pseudo), tcp))
+	copy(packet[len(packet)-len(tcp):], tcp)
+	return packet
+}
+
+// ipChecksum returns the internet checksum of the data, sum is the partial sum of the preceding data.
+func ipChecksum(sum uint32, b []byte) uint16 {
+	sum = ipChecksumSum(sum, b)
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+func ipChecksumSum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return sum
+}
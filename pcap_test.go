@@ -0,0 +1,131 @@
+package gost
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type pcapRecord struct {
+	inclLen, origLen int
+	packet           []byte
+}
+
+func readPCAP(t *testing.T, path string) []pcapRecord {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) < 24 || binary.LittleEndian.Uint32(b) != pcapMagic ||
+		binary.LittleEndian.Uint32(b[16:]) != pcapSnapLen || binary.LittleEndian.Uint32(b[20:]) != pcapLinkTypeRaw {
+		t.Fatalf("invalid pcap header %x", b[:24])
+	}
+	var records []pcapRecord
+	for b = b[24:]; len(b) >= 16; {
+		r := pcapRecord{
+			inclLen: int(binary.LittleEndian.Uint32(b[8:])),
+			origLen: int(binary.LittleEndian.Uint32(b[12:])),
+		}
+		r.packet, b = b[16:16+r.inclLen], b[16+r.inclLen:]
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestPCAPListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pcap")
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err = PCAPListener(ln, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 5)
+		io.ReadFull(conn, b)
+		conn.Write(bytes.ToUpper(b))
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	io.ReadAll(conn)
+	conn.Close()
+	ln.Close()
+
+	records := readPCAP(t, path)
+	// SYN, SYN-ACK, ACK, the request, the response and FIN.
+	if len(records) != 6 {
+		t.Fatalf("got %d records, want 6", len(records))
+	}
+	sport := uint16(conn.LocalAddr().(*net.TCPAddr).Port)
+	for i, want := range []struct {
+		flags   byte
+		toSrv   bool
+		payload string
+	}{
+		{tcpFlagSYN, true, ""},
+		{tcpFlagSYN | tcpFlagACK, false, ""},
+		{tcpFlagACK, true, ""},
+		{tcpFlagPSH | tcpFlagACK, true, "hello"},
+		{tcpFlagPSH | tcpFlagACK, false, "HELLO"},
+		{tcpFlagFIN | tcpFlagACK, false, ""},
+	} {
+		p := records[i].packet
+		if p[0] != 0x45 || int(binary.BigEndian.Uint16(p[2:])) != len(p) || ipChecksum(0, p[:20]) != 0 {
+			t.Errorf("record %d: invalid IP header %x", i, p[:20])
+		}
+		tcp := p[20:]
+		if tcp[13] != want.flags {
+			t.Errorf("record %d: flags %x, want %x", i, tcp[13], want.flags)
+		}
+		port := binary.BigEndian.Uint16(tcp[0:])
+		if want.toSrv != (port == sport) {
+			t.Errorf("record %d: unexpected direction, source port %d", i, port)
+		}
+		pseudo := append(append([]byte{}, p[12:20]...), 0, 6, byte(len(tcp)>>8), byte(len(tcp)))
+		if ipChecksum(ipChecksumSum(0, pseudo), tcp) != 0 {
+			t.Errorf("record %d: invalid TCP checksum", i)
+		}
+		if string(tcp[20:]) != want.payload {
+			t.Errorf("record %d: payload %q, want %q", i, tcp[20:], want.payload)
+		}
+	}
+	// the sequence number of the response follows the SYN-ACK.
+	synAck := binary.BigEndian.Uint32(records[1].packet[24:])
+	if seq := binary.BigEndian.Uint32(records[4].packet[24:]); seq != synAck+1 {
+		t.Errorf("seq %d, want %d", seq, synAck+1)
+	}
+}
+
+func TestPCAPTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pcap")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &pcapWriter{f: f}
+	w.writeHeader()
+	w.writeRecord(time.Now(), make([]byte, pcapSnapLen+100))
+	w.close()
+
+	records := readPCAP(t, path)
+	if len(records) != 1 || records[0].inclLen != pcapSnapLen || records[0].origLen != pcapSnapLen+100 {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
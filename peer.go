@@ -1,4 +1,4 @@
-package main
+package gost
 
 import (
 	"bufio"
@@ -8,10 +8,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/ginuerzh/gost"
 )
 
+// peerConfig is the file of the peer option of the chain node, the nodes of the file are put after the base nodes
+// of the node group, and the file is reloaded periodically.
 type peerConfig struct {
 	Strategy     string `json:"strategy"`
 	MaxFails     int    `json:"max_fails"`
@@ -20,8 +20,8 @@ type peerConfig struct {
 	period       time.Duration // the period for live reloading
 
 	Nodes     []string `json:"nodes"`
-	group     *gost.NodeGroup
-	baseNodes []gost.Node
+	group     *NodeGroup
+	baseNodes []Node
 	stopped   chan struct{}
 }
 
@@ -47,21 +47,25 @@ func (cfg *peerConfig) Reload(r io.Reader) error {
 	group := cfg.group
 	group.SetSelector(
 		nil,
-		gost.WithFilter(
-			&gost.FailFilter{
+		WithFilter(
+			&FailFilter{
 				MaxFails:    cfg.MaxFails,
 				FailTimeout: cfg.FailTimeout,
 			},
-			&gost.InvalidFilter{},
-			gost.NewFastestFilter(0, cfg.FastestCount),
+			&InvalidFilter{},
+			NewFastestFilter(0, cfg.FastestCount),
 		),
-		gost.WithStrategy(gost.NewStrategy(cfg.Strategy)),
+		WithStrategy(NewStrategy(cfg.Strategy)),
 	)
 
 	gNodes := cfg.baseNodes
 	nid := len(gNodes) + 1
 	for _, s := range cfg.Nodes {
-		nodes, err := parseChainNode(s)
+		node, err := ParseNode(s)
+		if err != nil {
+			return err
+		}
+		nodes, err := BuildChainNodes(node)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,188 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PingResult is the result of PingChain.
+type PingResult struct {
+	// RTT is the average round-trip time of the successful pings.
+	RTT time.Duration
+	// Connected reports whether any ping is successful.
+	Connected bool
+	// Error is the error of the last failed ping.
+	Error error
+
+	Sent     int
+	Received int
+	MinRTT   time.Duration
+	MaxRTT   time.Duration
+}
+
+func (r *PingResult) String() string {
+	loss := 0
+	if r.Sent > 0 {
+		loss = (r.Sent - r.Received) * 100 / r.Sent
+	}
+	s := fmt.Sprintf("%d pings sent, %d received, %d%% loss", r.Sent, r.Received, loss)
+	if r.Connected {
+		s += fmt.Sprintf(", rtt min/avg/max = %v/%v/%v", r.MinRTT, r.RTT, r.MaxRTT)
+	}
+	if r.Error != nil {
+		s += fmt.Sprintf(", error: %v", r.Error)
+	}
+	return s
+}
+
+// PingOptions are the options of PingChain.
+type PingOptions struct {
+	Count    int
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// PingOption allows a common way to set the options of PingChain.
+type PingOption func(opts *PingOptions)
+
+// PingCountOption sets the number of the pings, the default is 1.
+func PingCountOption(n int) PingOption {
+	return func(opts *PingOptions) {
+		opts.Count = n
+	}
+}
+
+// PingIntervalOption sets the interval between the pings, the default is 1s.
+func PingIntervalOption(interval time.Duration) PingOption {
+	return func(opts *PingOptions) {
+		opts.Interval = interval
+	}
+}
+
+// PingTimeoutOption sets the timeout of each ping, the default is DialTimeout.
+func PingTimeoutOption(timeout time.Duration) PingOption {
+	return func(opts *PingOptions) {
+		opts.Timeout = timeout
+	}
+}
+
+// PingChain connects to the HTTP server target (e.g. 'http://example.com' or 'example.com:80') through the chain
+// and sends a HEAD request, the round-trip time is the time from connecting to receiving the response.
+// The error is returned if the target is invalid, the failures of the pings are reported in the result.
+func PingChain(ctx context.Context, chain Chain, target string, opts ...PingOption) (*PingResult, error) {
+	options := &PingOptions{
+		Count:    1,
+		Interval: time.Second,
+		Timeout:  DialTimeout,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Count <= 0 {
+		options.Count = 1
+	}
+
+	u, err := parsePingTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PingResult{}
+	var total time.Duration
+	for i := 0; i < options.Count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return result, nil
+			case <-time.After(options.Interval):
+			}
+		}
+
+		result.Sent++
+		rtt, err := pingOnce(ctx, &chain, u, options.Timeout)
+		if err != nil {
+			result.Error = err
+			continue
+		}
+		result.Received++
+		result.Connected = true
+		total += rtt
+		if result.MinRTT == 0 || rtt < result.MinRTT {
+			result.MinRTT = rtt
+		}
+		if rtt > result.MaxRTT {
+			result.MaxRTT = rtt
+		}
+		result.RTT = total / time.Duration(result.Received)
+	}
+	return result, nil
+}
+
+func parsePingTarget(target string) (*url.URL, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("ping: unsupported scheme %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("ping: invalid target %s", target)
+	}
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+func pingOnce(ctx context.Context, chain *Chain, u *url.URL, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := chain.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return 0, err
+		}
+		conn = tlsConn
+	}
+
+	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+	if err := req.Write(conn); err != nil {
+		return 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return time.Since(start), nil
+}
@@ -0,0 +1,55 @@
+package gost
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPingChain(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: SOCKS5Handler()}
+	go server.Run()
+	defer server.Close()
+
+	chain := NewChain(Node{
+		Addr:      ln.Addr().String(),
+		Protocol:  "socks5",
+		Transport: "tcp",
+		Client:    &Client{Connector: SOCKS5Connector(nil), Transporter: TCPTransporter()},
+	})
+
+	r, err := PingChain(context.Background(), *chain, httpSrv.URL,
+		PingCountOption(3), PingIntervalOption(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Connected || r.Sent != 3 || r.Received != 3 || r.Error != nil {
+		t.Errorf("result %v", r)
+	}
+	if r.MinRTT <= 0 || r.MinRTT > r.RTT || r.RTT > r.MaxRTT {
+		t.Errorf("rtt min/avg/max %v/%v/%v", r.MinRTT, r.RTT, r.MaxRTT)
+	}
+
+	// the target is not available.
+	addr := httpSrv.Listener.Addr().String()
+	httpSrv.Close()
+	r, err = PingChain(context.Background(), *chain, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Connected || r.Sent != 1 || r.Received != 0 || r.Error == nil {
+		t.Errorf("result %v", r)
+	}
+
+	if _, err := PingChain(context.Background(), *chain, "ftp://example.com"); err == nil {
+		t.Error("should fail with the unsupported scheme")
+	}
+}
@@ -0,0 +1,292 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+var (
+	// ErrPoolExhausted is an error that implies the connection pool reaches the max total connections.
+	ErrPoolExhausted = errors.New("pool: too many connections")
+)
+
+// poolHealthCheckTimeout is the read deadline used by the health check of the idle connection.
+var poolHealthCheckTimeout = 5 * time.Millisecond
+
+type idleConn struct {
+	conn net.Conn
+	t    time.Time
+}
+
+// poolDialOptions are the options of the last handshaked connection to the address,
+// which are used to dial the idle connections in advance.
+type poolDialOptions struct {
+	dial      []DialOption
+	handshake []HandshakeOption
+}
+
+type pooledTransporter struct {
+	base        Transporter
+	maxIdle     int
+	maxTotal    int
+	idleTimeout time.Duration
+	idle        map[string][]idleConn
+	total       map[string]int
+	options     map[string]poolDialOptions
+	filling     map[string]bool
+	mux         sync.Mutex
+}
+
+// PooledTransporter creates a Transporter that keeps the idle connections dialed and handshaked
+// by the base Transporter in advance, up to maxIdle per target address, so a new relay does not wait for them.
+//
+// Only the connections at the transport level are pooled: once the connection is read or written
+// (e.g. by the Connect of the chain), it is bound to the destination of the proxy request, so it is not reusable
+// and is closed by Close. The connection that is closed without being used, e.g. the dial of the chain is aborted,
+// is returned to the pool. Unlike returning every closed connection, this keeps the proxy protocols correct,
+// and the pool saves the dial and the handshake of the new connections instead.
+// The idle connections are health checked when they are checked out, and those older than idleTimeout are discarded.
+// maxTotal is the max connections (idle and in use) per address, zero or negative value means unlimited.
+func PooledTransporter(base Transporter, maxIdle, maxTotal int, idleTimeout time.Duration) Transporter {
+	if base == nil {
+		base = TCPTransporter()
+	}
+	return &pooledTransporter{
+		base:        base,
+		maxIdle:     maxIdle,
+		maxTotal:    maxTotal,
+		idleTimeout: idleTimeout,
+		idle:        make(map[string][]idleConn),
+		total:       make(map[string]int),
+		options:     make(map[string]poolDialOptions),
+		filling:     make(map[string]bool),
+	}
+}
+
+func (tr *pooledTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	if conn := tr.get(addr); conn != nil {
+		return newPooledConn(conn, tr, addr, false), nil
+	}
+	if !tr.acquire(addr) {
+		return nil, ErrPoolExhausted
+	}
+
+	conn, err := tr.base.Dial(addr, options...)
+	if err != nil {
+		tr.release(addr)
+		return nil, err
+	}
+	pc := newPooledConn(conn, tr, addr, true)
+	pc.dialOptions = options
+	return pc, nil
+}
+
+func (tr *pooledTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	pc, ok := conn.(*pooledConn)
+	if !ok {
+		return tr.base.Handshake(conn, options...)
+	}
+	// the connection from the pool has been handshaked.
+	if !pc.fresh {
+		tr.fill(pc.addr)
+		return pc, nil
+	}
+
+	cc, err := tr.base.Handshake(pc.Conn, options...)
+	if err != nil {
+		pc.broken.Store(true)
+		pc.Close()
+		return nil, err
+	}
+	pc.Conn = cc
+	pc.fresh = false
+
+	tr.mux.Lock()
+	tr.options[pc.addr] = poolDialOptions{dial: pc.dialOptions, handshake: options}
+	tr.mux.Unlock()
+	tr.fill(pc.addr)
+
+	return pc, nil
+}
+
+func (tr *pooledTransporter) Multiplex() bool {
+	return tr.base.Multiplex()
+}
+
+// get checks out an idle connection for addr from the pool,
+// the connection that fails the health check is discarded.
+func (tr *pooledTransporter) get(addr string) net.Conn {
+	for {
+		tr.mux.Lock()
+		conns := tr.idle[addr]
+		if len(conns) == 0 {
+			tr.mux.Unlock()
+			return nil
+		}
+		ic := conns[len(conns)-1]
+		tr.idle[addr] = conns[:len(conns)-1]
+		tr.mux.Unlock()
+
+		if (tr.idleTimeout > 0 && time.Since(ic.t) > tr.idleTimeout) || !healthCheck(ic.conn) {
+			ic.conn.Close()
+			tr.release(addr)
+			continue
+		}
+		return ic.conn
+	}
+}
+
+// put returns the connection to the pool, or closes it if the pool is full.
+func (tr *pooledTransporter) put(addr string, conn net.Conn) {
+	tr.mux.Lock()
+	if tr.maxIdle <= 0 || len(tr.idle[addr]) >= tr.maxIdle {
+		tr.mux.Unlock()
+		conn.Close()
+		tr.release(addr)
+		return
+	}
+	tr.idle[addr] = append(tr.idle[addr], idleConn{conn: conn, t: time.Now()})
+	tr.mux.Unlock()
+}
+
+// fill dials the idle connections to addr in background until there are maxIdle of them.
+func (tr *pooledTransporter) fill(addr string) {
+	tr.mux.Lock()
+	if tr.filling[addr] || len(tr.idle[addr]) >= tr.maxIdle {
+		tr.mux.Unlock()
+		return
+	}
+	tr.filling[addr] = true
+	opts := tr.options[addr]
+	tr.mux.Unlock()
+
+	go func() {
+		defer func() {
+			tr.mux.Lock()
+			delete(tr.filling, addr)
+			tr.mux.Unlock()
+		}()
+
+		for {
+			tr.mux.Lock()
+			n := len(tr.idle[addr])
+			tr.mux.Unlock()
+			if n >= tr.maxIdle || !tr.acquire(addr) {
+				return
+			}
+
+			conn, err := tr.base.Dial(addr, opts.dial...)
+			if err == nil {
+				var cc net.Conn
+				if cc, err = tr.base.Handshake(conn, opts.handshake...); err != nil {
+					conn.Close()
+				} else {
+					conn = cc
+				}
+			}
+			if err != nil {
+				tr.release(addr)
+				if Debug {
+					log.Logf("[pool] %s: %v", addr, err)
+				}
+				return
+			}
+			tr.put(addr, conn)
+		}
+	}()
+}
+
+// acquire counts a new connection to addr, it reports false if there are maxTotal connections already.
+func (tr *pooledTransporter) acquire(addr string) bool {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.maxTotal > 0 && tr.total[addr] >= tr.maxTotal {
+		return false
+	}
+	tr.total[addr]++
+	return true
+}
+
+func (tr *pooledTransporter) release(addr string) {
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.total[addr]--; tr.total[addr] <= 0 {
+		delete(tr.total, addr)
+	}
+}
+
+// healthCheck checks whether the idle connection is still alive.
+// An alive idle connection should block on reading until the deadline is exceeded.
+func healthCheck(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(poolHealthCheckTimeout)); err != nil {
+		return false
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := conn.Read(b[:])
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	// unexpected data or error
+	return false
+}
+
+// pooledConn is a connection checked out from the pool.
+// It is returned to the pool by Close only if it has not been read or written.
+type pooledConn struct {
+	net.Conn
+	pool        *pooledTransporter
+	addr        string
+	fresh       bool // dialed, but has not been handshaked yet
+	dialOptions []DialOption
+	used        atomic.Bool
+	broken      atomic.Bool
+	closed      atomic.Bool
+}
+
+func newPooledConn(conn net.Conn, pool *pooledTransporter, addr string, fresh bool) *pooledConn {
+	return &pooledConn{
+		Conn:  conn,
+		pool:  pool,
+		addr:  addr,
+		fresh: fresh,
+	}
+}
+
+func (c *pooledConn) Read(b []byte) (n int, err error) {
+	// used is set before closed is checked, so Close does not return the connection being used to the pool.
+	c.used.Store(true)
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *pooledConn) Write(b []byte) (n int, err error) {
+	c.used.Store(true)
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	return c.Conn.Write(b)
+}
+
+// Close returns the unused connection to the pool, or closes it.
+func (c *pooledConn) Close() error {
+	if !c.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	if c.used.Load() || c.broken.Load() || c.fresh {
+		defer c.pool.release(c.addr)
+		return c.Conn.Close()
+	}
+	c.pool.put(c.addr, c.Conn)
+	return nil
+}
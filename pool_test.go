@@ -0,0 +1,211 @@
+package gost
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func echoTestServer(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func poolDial(tr Transporter, addr string) (net.Conn, error) {
+	conn, err := tr.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return tr.Handshake(conn)
+}
+
+func poolRoundtrip(conn net.Conn, data []byte) error {
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+	recv := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		return err
+	}
+	if !bytes.Equal(recv, data) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// waitIdle waits for the pool to dial the idle connections to addr.
+func waitIdle(tr Transporter, addr string, n int) bool {
+	ptr := tr.(*pooledTransporter)
+	for i := 0; i < 100; i++ {
+		ptr.mux.Lock()
+		idle := len(ptr.idle[addr])
+		ptr.mux.Unlock()
+		if idle >= n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestPooledTransporter(t *testing.T) {
+	ln := echoTestServer(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	base := &failTransporter{}
+	tr := PooledTransporter(base, 1, 3, time.Minute)
+
+	c1, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	if err := poolRoundtrip(c1, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// the idle connection is dialed in advance.
+	if !waitIdle(tr, addr, 1) {
+		t.Fatal("the idle connection is not dialed")
+	}
+	if base.dials != 2 {
+		t.Errorf("dialed %d times, want 2", base.dials)
+	}
+
+	c2, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if c2.LocalAddr().String() == c1.LocalAddr().String() {
+		t.Error("the connection in use is checked out")
+	}
+	if err := poolRoundtrip(c2, []byte("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	// c1, c2 and the idle connection.
+	if !waitIdle(tr, addr, 1) {
+		t.Fatal("the idle connection is not dialed")
+	}
+	if _, err := poolDial(tr, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Dial(addr); err != ErrPoolExhausted {
+		t.Errorf("got error %v, want %v", err, ErrPoolExhausted)
+	}
+}
+
+func TestPooledTransporterUsedConn(t *testing.T) {
+	ln := echoTestServer(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	tr := PooledTransporter(TCPTransporter(), 1, 0, time.Minute)
+
+	c1, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitIdle(tr, addr, 1) {
+		t.Fatal("the idle connection is not dialed")
+	}
+	// the unused connection is returned to the pool, which is full.
+	c1.Close()
+
+	c2, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	laddr := c2.LocalAddr().String()
+	// the unused connection is returned to the pool.
+	c2.Close()
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Error("read after close should fail")
+	}
+
+	c3, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3.LocalAddr().String() != laddr {
+		t.Error("the unused connection is not reused")
+	}
+	if err := poolRoundtrip(c3, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	// the used connection is not returned to the pool.
+	c3.Close()
+
+	c4, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c4.Close()
+	if c4.LocalAddr().String() == laddr {
+		t.Error("the used connection is reused")
+	}
+}
+
+func TestPooledTransporterClosedByPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	peers := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			peers <- conn
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	addr := ln.Addr().String()
+	tr := PooledTransporter(TCPTransporter(), 1, 0, time.Minute)
+
+	c1, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	<-peers
+	if !waitIdle(tr, addr, 1) {
+		t.Fatal("the idle connection is not dialed")
+	}
+
+	// the server closes the idle connection.
+	(<-peers).Close()
+	time.Sleep(50 * time.Millisecond)
+
+	c2, err := poolDial(tr, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if err := poolRoundtrip(c2, []byte("world")); err != nil {
+		t.Error("dead connection is reused:", err)
+	}
+}
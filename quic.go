@@ -5,6 +5,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -16,8 +17,46 @@ import (
 	quic "github.com/quic-go/quic-go"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("quic", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			config := quicNodeConfig(node, opts.TLSConfig)
+			config.MTUDiscovery = node.GetBool("mtudiscovery")
+			return QUICTransporter(config, WithQUICConnectionMigration(node.GetBool("migration"))), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			config := quicNodeConfig(node, opts.TLSConfig)
+			config.ConnectionMigration = node.GetBool("migration")
+			return QUICListener(node.Addr, config, opts.TLSListenerOptions...)
+		},
+		TLS: true,
+	})
+}
+
+// quicNodeConfig returns the QUICConfig of the node parameters keepalive, ttl, timeout, idle and cipher.
+func quicNodeConfig(node Node, tlsConfig *tls.Config) *QUICConfig {
+	config := &QUICConfig{
+		TLSConfig:   tlsConfig,
+		KeepAlive:   node.GetBool("keepalive"),
+		Timeout:     node.GetDuration("timeout"),
+		IdleTimeout: node.GetDuration("idle"),
+	}
+	if config.KeepAlive {
+		config.KeepAlivePeriod = node.GetDuration("ttl")
+		if config.KeepAlivePeriod == 0 {
+			config.KeepAlivePeriod = 10 * time.Second
+		}
+	}
+	if cipher := node.Get("cipher"); cipher != "" {
+		sum := sha256.Sum256([]byte(cipher))
+		config.Key = sum[:]
+	}
+	return config
+}
+
 type quicSession struct {
 	session quic.EarlyConnection
+	conn    net.PacketConn
 }
 
 func (session *quicSession) GetConn() (*quicConn, error) {
@@ -40,16 +79,25 @@ type quicTransporter struct {
 	config       *QUICConfig
 	sessionMutex sync.Mutex
 	sessions     map[string]*quicSession
+	sessionCache tls.ClientSessionCache
 }
 
 // QUICTransporter creates a Transporter that is used by QUIC proxy client.
-func QUICTransporter(config *QUICConfig) Transporter {
+func QUICTransporter(config *QUICConfig, opts ...QUICTransporterOption) Transporter {
 	if config == nil {
 		config = &QUICConfig{}
 	}
+	if len(opts) > 0 {
+		c := *config
+		for _, opt := range opts {
+			opt(&c)
+		}
+		config = &c
+	}
 	return &quicTransporter{
-		config:   config,
-		sessions: make(map[string]*quicSession),
+		config:       config,
+		sessions:     make(map[string]*quicSession),
+		sessionCache: tls.NewLRUClientSessionCache(0),
 	}
 }
 
@@ -70,7 +118,11 @@ func (tr *quicTransporter) Dial(addr string, options ...DialOption) (conn net.Co
 	session, ok := tr.sessions[addr]
 	if !ok {
 		var pc net.PacketConn
-		pc, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+		if tr.config != nil && tr.config.ConnectionMigration {
+			pc, err = newQUICMigrationConn()
+		} else {
+			pc, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+		}
 		if err != nil {
 			return
 		}
@@ -97,7 +149,12 @@ func (tr *quicTransporter) Dial(addr string, options ...DialOption) (conn net.Co
 }
 
 func (tr *quicTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
-	return conn, nil
+	opts := &HandshakeOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	// the stream may be opened before the handshake completes, the data is sent in 0-RTT if it is possible.
+	return writeEarlyData(conn, opts.EarlyData)
 }
 
 func (tr *quicTransporter) initSession(addr net.Addr, conn net.PacketConn) (*quicSession, error) {
@@ -108,22 +165,37 @@ func (tr *quicTransporter) initSession(addr net.Addr, conn net.PacketConn) (*qui
 	if config.TLSConfig == nil {
 		config.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	tlsConfig := tlsConfigQUICALPN(config.TLSConfig)
+	if tlsConfig.ClientSessionCache == nil {
+		// the sessions are resumed with the tickets of the previous connections, which enables 0-RTT.
+		tlsConfig.ClientSessionCache = tr.sessionCache
+	}
 
 	quicConfig := &quic.Config{
 		HandshakeIdleTimeout: config.Timeout,
 		MaxIdleTimeout:       config.IdleTimeout,
 		KeepAlivePeriod:      config.KeepAlivePeriod,
+		EnableDatagrams:      config.ConnectionMigration,
 		Versions: []quic.VersionNumber{
 			quic.Version1,
 			quic.Version2,
 		},
 	}
-	session, err := quic.DialEarly(context.Background(), conn, addr, tlsConfigQUICALPN(config.TLSConfig), quicConfig)
+	if config.MTUDiscovery {
+		// the initial packet size is set to the path MTU, it is adjusted by the path MTU discovery of QUIC.
+		pmtu, err := discoverPathMTU(addr.String(), quicMinMTU+udpOverhead(addr), 1500)
+		if err != nil {
+			log.Logf("quic mtu %s: %v", addr, err)
+		} else {
+			quicConfig.InitialPacketSize = uint16(pmtu - udpOverhead(addr))
+		}
+	}
+	session, err := quic.DialEarly(context.Background(), conn, addr, tlsConfig, quicConfig)
 	if err != nil {
 		log.Logf("quic dial %s: %v", addr, err)
 		return nil, err
 	}
-	return &quicSession{session: session}, nil
+	return &quicSession{session: session, conn: conn}, nil
 }
 
 func (tr *quicTransporter) Multiplex() bool {
@@ -138,8 +210,16 @@ type QUICConfig struct {
 	KeepAlivePeriod time.Duration
 	IdleTimeout     time.Duration
 	Key             []byte
+	// MTUDiscovery discovers the path MTU to the server for the initial packet size.
+	MTUDiscovery bool
+	// ConnectionMigration keeps the sessions when the addresses of the clients change,
+	// it must be enabled on both the client and the server, see WithQUICConnectionMigration.
+	ConnectionMigration bool
 }
 
+// quicMinMTU is the minimum size of the QUIC packets.
+const quicMinMTU = 1200
+
 type quicListener struct {
 	ln       quic.EarlyListener
 	connChan chan net.Conn
@@ -147,7 +227,28 @@ type quicListener struct {
 }
 
 // QUICListener creates a Listener for QUIC proxy server.
-func QUICListener(addr string, config *QUICConfig) (Listener, error) {
+func QUICListener(addr string, config *QUICConfig, opts ...TLSListenerOption) (Listener, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := quicListenOn(conn, config, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func quicListenOn(conn net.PacketConn, config *QUICConfig, opts ...TLSListenerOption) (Listener, error) {
+	options := &TLSListenerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
 	if config == nil {
 		config = &QUICConfig{}
 	}
@@ -155,6 +256,8 @@ func QUICListener(addr string, config *QUICConfig) (Listener, error) {
 		HandshakeIdleTimeout: config.Timeout,
 		KeepAlivePeriod:      config.KeepAlivePeriod,
 		MaxIdleTimeout:       config.IdleTimeout,
+		Allow0RTT:            options.Accept0RTT,
+		EnableDatagrams:      config.ConnectionMigration,
 		Versions: []quic.VersionNumber{
 			quic.Version1,
 			quic.Version2,
@@ -165,17 +268,11 @@ func QUICListener(addr string, config *QUICConfig) (Listener, error) {
 	if tlsConfig == nil {
 		tlsConfig = DefaultTLSConfig
 	}
-	var conn net.PacketConn
+	tlsConfig = tlsPolicyConfig(tlsConfig, options)
 
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
-		return nil, err
+	if config.ConnectionMigration {
+		conn = newQUICMigrationListenConn(conn)
 	}
-	conn, err = net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		return nil, err
-	}
-
 	if config.Key != nil {
 		conn = &quicCipherConn{PacketConn: conn, key: config.Key}
 	}
@@ -0,0 +1,228 @@
+package gost
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+const (
+	// quicMigrationIDSize is the size of the client ID prepended to the packets sent to the server.
+	quicMigrationIDSize = 8
+	// quicMigrationPeerTTL is the time after which an idle client is forgotten by the server.
+	quicMigrationPeerTTL = 5 * time.Minute
+)
+
+// QUICTransporterOption allows a common way to set QUIC transporter options.
+type QUICTransporterOption func(config *QUICConfig)
+
+// WithQUICConnectionMigration enables the connection migration of the QUIC client, the server must enable
+// QUICConfig.ConnectionMigration too. The QUIC session is kept when the address of the client changes
+// (e.g. switching from WiFi to LTE, or the NAT rebinding), so the proxy connections are not interrupted.
+//
+// As quic-go does not migrate the connections, the migration is done by gost beneath QUIC: each packet of the
+// client is prefixed with a random client ID, the server tracks the current address of each ID and sends the
+// packets of the session to it. The client rebinds its UDP socket when it fails to send, e.g. the interface is gone.
+// The packets are still authenticated by QUIC, the ID only steers where the server sends the packets to.
+func WithQUICConnectionMigration(enable bool) QUICTransporterOption {
+	return func(config *QUICConfig) {
+		config.ConnectionMigration = enable
+	}
+}
+
+// quicMigrationConn is the UDP socket of the QUIC client, which can be rebound to a new local address.
+type quicMigrationConn struct {
+	id     [quicMigrationIDSize]byte
+	mux    sync.RWMutex
+	conn   net.PacketConn
+	rdl    time.Time // the read deadline applied to the new sockets
+	closed bool
+}
+
+func newQUICMigrationConn() (*quicMigrationConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	c := &quicMigrationConn{conn: conn}
+	rand.Read(c.id[:])
+	return c, nil
+}
+
+func (c *quicMigrationConn) current() net.PacketConn {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.conn
+}
+
+// rebind replaces the socket with a new one, the packets are sent from the new address since then.
+func (c *quicMigrationConn) rebind() error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		conn.Close()
+		return net.ErrClosed
+	}
+	old := c.conn
+	c.conn = conn
+	if !c.rdl.IsZero() {
+		conn.SetReadDeadline(c.rdl)
+	}
+	c.mux.Unlock()
+
+	if Debug {
+		log.Logf("[quic] migrate %s -> %s", old.LocalAddr(), conn.LocalAddr())
+	}
+	// the pending read on the old socket continues on the new one.
+	old.Close()
+	return nil
+}
+
+func (c *quicMigrationConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		conn := c.current()
+		n, addr, err = conn.ReadFrom(b)
+		if err == nil || conn == c.current() {
+			return
+		}
+	}
+}
+
+func (c *quicMigrationConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	buf := make([]byte, quicMigrationIDSize+len(b))
+	copy(buf, c.id[:])
+	copy(buf[quicMigrationIDSize:], b)
+
+	if _, err := c.current().WriteTo(buf, addr); err != nil {
+		if errors.Is(err, net.ErrClosed) || c.rebind() != nil {
+			return 0, err
+		}
+		if _, err := c.current().WriteTo(buf, addr); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *quicMigrationConn) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *quicMigrationConn) LocalAddr() net.Addr {
+	return c.current().LocalAddr()
+}
+
+func (c *quicMigrationConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *quicMigrationConn) SetReadDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.rdl = t
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *quicMigrationConn) SetWriteDeadline(t time.Time) error {
+	return c.current().SetWriteDeadline(t)
+}
+
+type quicMigrationPeer struct {
+	addr    net.Addr // the first address of the client, which is seen by QUIC
+	current net.Addr // the current address of the client
+	seen    time.Time
+}
+
+// quicMigrationListenConn is the UDP socket of the QUIC server, which tracks the addresses of the clients by their IDs.
+// The clients are seen by QUIC at their first addresses, so their sessions survive the address changes.
+type quicMigrationListenConn struct {
+	net.PacketConn
+	mux   sync.RWMutex
+	peers map[uint64]*quicMigrationPeer
+	ids   map[string]uint64 // the client IDs by the first addresses
+	gc    time.Time
+}
+
+func newQUICMigrationListenConn(conn net.PacketConn) *quicMigrationListenConn {
+	return &quicMigrationListenConn{
+		PacketConn: conn,
+		peers:      make(map[uint64]*quicMigrationPeer),
+		ids:        make(map[string]uint64),
+		gc:         time.Now(),
+	}
+}
+
+func (c *quicMigrationListenConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = c.PacketConn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if n < quicMigrationIDSize {
+			continue
+		}
+		id := binary.BigEndian.Uint64(b)
+		n = copy(b, b[quicMigrationIDSize:n])
+		return n, c.peer(id, addr), nil
+	}
+}
+
+// peer updates the current address of the client, and returns its first address.
+func (c *quicMigrationListenConn) peer(id uint64, addr net.Addr) net.Addr {
+	now := time.Now()
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if now.Sub(c.gc) > quicMigrationPeerTTL {
+		c.gc = now
+		for k, p := range c.peers {
+			if now.Sub(p.seen) > quicMigrationPeerTTL {
+				delete(c.peers, k)
+				delete(c.ids, p.addr.String())
+			}
+		}
+	}
+
+	p, ok := c.peers[id]
+	if !ok {
+		if old, ok := c.ids[addr.String()]; ok {
+			// the address is reused by another client.
+			delete(c.peers, old)
+		}
+		p = &quicMigrationPeer{addr: addr, current: addr}
+		c.peers[id] = p
+		c.ids[addr.String()] = id
+	}
+	if p.current.String() != addr.String() {
+		log.Logf("[quic] %s migrated %s -> %s", p.addr, p.current, addr)
+		p.current = addr
+	}
+	p.seen = now
+	return p.addr
+}
+
+func (c *quicMigrationListenConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mux.RLock()
+	if id, ok := c.ids[addr.String()]; ok {
+		addr = c.peers[id].current
+	}
+	c.mux.RUnlock()
+	return c.PacketConn.WriteTo(b, addr)
+}
@@ -0,0 +1,78 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestQUICConnectionMigration(t *testing.T) {
+	ln, err := QUICListener("127.0.0.1:0", &QUICConfig{TLSConfig: DefaultTLSConfig, ConnectionMigration: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	addr := ln.Addr().String()
+	tr := QUICTransporter(&QUICConfig{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+		WithQUICConnectionMigration(true)).(*quicTransporter)
+	conn, err := tr.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tr.sessionMutex.Lock()
+	pc := tr.sessions[addr].conn.(*quicMigrationConn)
+	tr.sessionMutex.Unlock()
+	laddr := pc.LocalAddr().String()
+
+	const chunks = 100
+	chunk := bytes.Repeat([]byte("gost"), 256)
+	go func() {
+		for i := 0; i < chunks; i++ {
+			if i == chunks/2 {
+				// the client changes its address in the middle of the transfer.
+				if err := pc.rebind(); err != nil {
+					t.Error(err)
+				}
+			}
+			if _, err := conn.Write(chunk); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	b := make([]byte, len(chunk))
+	for i := 0; i < chunks; i++ {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			t.Fatalf("chunk %d: %v", i, err)
+		}
+		if !bytes.Equal(b, chunk) {
+			t.Fatalf("chunk %d mismatch", i)
+		}
+	}
+	if pc.LocalAddr().String() == laddr {
+		t.Errorf("the address %s is not changed", laddr)
+	}
+
+	// the new streams of the session use the new address.
+	conn2, err := tr.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn2.Close()
+}
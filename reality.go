@@ -0,0 +1,321 @@
+package gost
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-log/log"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("reality", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return nil, fmt.Errorf("%s: transport reality is only supported by the server", node.String())
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			key, err := base64.RawURLEncoding.DecodeString(node.Get("private-key"))
+			if err != nil {
+				return nil, err
+			}
+			return REALITYListener(node.Addr, node.Get("dest"), key, strings.Split(node.Get("short-ids"), ","))
+		},
+	})
+}
+
+const (
+	tlsRecordHandshake      = 22
+	tlsHandshakeClientHello = 1
+	tlsExtensionKeyShare    = 51
+	tlsGroupX25519          = 0x001d
+)
+
+// realityClientHello is the fields of the ClientHello used by the REALITY authentication.
+type realityClientHello struct {
+	raw       []byte // the handshake message
+	random    []byte
+	sessionID []byte
+	keyShare  []byte // the X25519 key share
+}
+
+// parseRealityClientHello parses the ClientHello of the TLS record.
+func parseRealityClientHello(record []byte) (*realityClientHello, error) {
+	errInvalid := errors.New("reality: invalid ClientHello")
+
+	if len(record) < 5+4 || record[0] != tlsRecordHandshake || record[5] != tlsHandshakeClientHello {
+		return nil, errInvalid
+	}
+	msg := record[5:]
+	n := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+	if len(msg) < 4+n {
+		return nil, errInvalid
+	}
+	hello := &realityClientHello{raw: msg[:4+n]}
+
+	b := msg[4 : 4+n]
+	if len(b) < 2+32+1 {
+		return nil, errInvalid
+	}
+	hello.random = b[2:34]
+	b = b[34:]
+	sidLen := int(b[0])
+	if len(b) < 1+sidLen {
+		return nil, errInvalid
+	}
+	hello.sessionID = b[1 : 1+sidLen]
+	b = b[1+sidLen:]
+
+	// cipher suites and compression methods
+	if len(b) < 2 {
+		return nil, errInvalid
+	}
+	l := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+l+1 {
+		return nil, errInvalid
+	}
+	b = b[2+l:]
+	l = int(b[0])
+	if len(b) < 1+l+2 {
+		return nil, errInvalid
+	}
+	b = b[1+l:]
+
+	l = int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < l {
+		return nil, errInvalid
+	}
+	for exts := b[:l]; len(exts) >= 4; {
+		typ := binary.BigEndian.Uint16(exts)
+		l := int(binary.BigEndian.Uint16(exts[2:]))
+		if len(exts) < 4+l {
+			return nil, errInvalid
+		}
+		data := exts[4 : 4+l]
+		exts = exts[4+l:]
+		if typ != tlsExtensionKeyShare || len(data) < 2 {
+			continue
+		}
+		for shares := data[2:]; len(shares) >= 4; {
+			group := binary.BigEndian.Uint16(shares)
+			l := int(binary.BigEndian.Uint16(shares[2:]))
+			if len(shares) < 4+l {
+				return nil, errInvalid
+			}
+			if group == tlsGroupX25519 && l == 32 {
+				hello.keyShare = shares[4 : 4+l]
+			}
+			shares = shares[4+l:]
+		}
+	}
+	return hello, nil
+}
+
+// realityAuthKey returns the auth key of the client if its session ID is sealed by the key shared with
+// the server and has one of the short IDs, otherwise nil.
+//
+// The session ID is AES-GCM sealed [version (3 bytes)][reserved][unix time (4 bytes)][short ID (8 bytes)],
+// the key is HKDF-SHA256 of the X25519 shared key with the salt random[:20] and the info "REALITY",
+// the nonce is random[20:], and the additional data is the ClientHello with the zero session ID.
+func realityAuthKey(hello *realityClientHello, privateKey []byte, shortIDs [][8]byte) []byte {
+	if len(hello.sessionID) != 32 || hello.keyShare == nil {
+		return nil
+	}
+	shared, err := curve25519.X25519(privateKey, hello.keyShare)
+	if err != nil {
+		return nil
+	}
+	authKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, hello.random[:20], []byte("REALITY")), authKey); err != nil {
+		return nil
+	}
+	block, _ := aes.NewCipher(authKey)
+	aead, _ := cipher.NewGCM(block)
+
+	aad := append([]byte(nil), hello.raw...)
+	copy(aad[4+2+32+1:], make([]byte, 32))
+	plain, err := aead.Open(nil, hello.random[20:], hello.sessionID, aad)
+	if err != nil {
+		return nil
+	}
+	for _, id := range shortIDs {
+		if bytes.Equal(plain[8:16], id[:]) {
+			return authKey
+		}
+	}
+	return nil
+}
+
+type realityListener struct {
+	net.Listener
+	dest       string
+	privateKey []byte
+	shortIDs   [][8]byte
+	certDER    []byte
+	certKey    ed25519.PrivateKey
+	connChan   chan net.Conn
+	errChan    chan error
+}
+
+// REALITYListener creates a Listener for the REALITY server, which is the TLS camouflage of Xray.
+// The client is recognized by the session ID of the ClientHello, sealed by the key shared between the X25519 key share
+// of the client and the privateKey of the server, with one of the shortIDs (the hex strings up to 16 characters).
+// The TLS handshake of the known client is done with a temporary certificate signed by the shared key,
+// and the TLS connection is accepted. The TLS sessions of the unknown clients are forwarded to dest transparently,
+// so the server is seen as dest, such as www.microsoft.com:443.
+func REALITYListener(addr, dest string, privateKey []byte, shortIDs []string) (Listener, error) {
+	if len(privateKey) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("reality: invalid private key length %d", len(privateKey))
+	}
+	l := &realityListener{
+		dest:       dest,
+		privateKey: privateKey,
+		connChan:   make(chan net.Conn, 1024),
+		errChan:    make(chan error, 1),
+	}
+	for _, s := range shortIDs {
+		var id [8]byte
+		if len(s) > 16 {
+			return nil, fmt.Errorf("reality: invalid short ID %s", s)
+		}
+		if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+			return nil, fmt.Errorf("reality: invalid short ID %s: %v", s, err)
+		}
+		l.shortIDs = append(l.shortIDs, id)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+	l.certDER, err = x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		return nil, err
+	}
+	l.certKey = priv
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l.Listener = tcpKeepAliveListener{ln.(*net.TCPListener)}
+	go l.listenLoop()
+
+	return l, nil
+}
+
+func (l *realityListener) listenLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			log.Log("[reality] accept:", err)
+			l.errChan <- err
+			close(l.errChan)
+			return
+		}
+		go l.handleConn(conn)
+	}
+}
+
+func (l *realityListener) handleConn(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	br := bufio.NewReaderSize(conn, 5+16*1024)
+	var authKey []byte
+	if header, err := br.Peek(5); err == nil {
+		record, err := br.Peek(5 + int(binary.BigEndian.Uint16(header[3:])))
+		if err == nil {
+			if hello, err := parseRealityClientHello(record); err == nil {
+				authKey = realityAuthKey(hello, l.privateKey, l.shortIDs)
+			}
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+	bc := &bufferdConn{Conn: conn, br: br}
+
+	if authKey == nil {
+		l.forward(bc)
+		return
+	}
+
+	// the signature of the certificate is replaced by the HMAC of the public key, which is verified by the client.
+	der := append([]byte(nil), l.certDER...)
+	h := hmac.New(sha512.New, authKey)
+	h.Write(l.certKey.Public().(ed25519.PublicKey))
+	copy(der[len(der)-64:], h.Sum(nil))
+
+	tlsConn := tls.Server(bc, &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  l.certKey,
+		}},
+	})
+	tlsConn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		log.Logf("[reality] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		conn.Close()
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	select {
+	case l.connChan <- tlsConn:
+	default:
+		tlsConn.Close()
+		log.Logf("[reality] %s - %s: connection queue is full", conn.RemoteAddr(), conn.LocalAddr())
+	}
+}
+
+// forward relays the connection of the unknown client to dest.
+func (l *realityListener) forward(conn net.Conn) {
+	defer conn.Close()
+
+	cc, err := net.DialTimeout("tcp", l.dest, DialTimeout)
+	if err != nil {
+		log.Logf("[reality] %s -> %s : %s", conn.RemoteAddr(), l.dest, err)
+		return
+	}
+	defer cc.Close()
+
+	if Debug {
+		log.Logf("[reality] %s <-> %s : forwarded", conn.RemoteAddr(), l.dest)
+	}
+	transport(conn, cc)
+}
+
+func (l *realityListener) Accept() (conn net.Conn, err error) {
+	var ok bool
+	select {
+	case conn = <-l.connChan:
+	case err, ok = <-l.errChan:
+		if !ok {
+			err = errors.New("accpet on closed listener")
+		}
+	}
+	return
+}
@@ -0,0 +1,124 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// realityTestClientHello captures the ClientHello record of crypto/tls.
+func realityTestClientHello(t *testing.T) []byte {
+	c, s := net.Pipe()
+	defer s.Close()
+	go func() {
+		tls.Client(c, &tls.Config{ServerName: "www.example.com", InsecureSkipVerify: true}).Handshake()
+		c.Close()
+	}()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(s, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, 5+int(binary.BigEndian.Uint16(header[3:])))
+	copy(record, header)
+	if _, err := io.ReadFull(s, record[5:]); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestREALITYAuthKey(t *testing.T) {
+	serverKey := make([]byte, 32)
+	rand.Read(serverKey)
+	serverPub, _ := curve25519.X25519(serverKey, curve25519.Basepoint)
+
+	hello, err := parseRealityClientHello(realityTestClientHello(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hello.sessionID) != 32 || len(hello.keyShare) != 32 {
+		t.Fatalf("unexpected session ID %x, key share %x", hello.sessionID, hello.keyShare)
+	}
+
+	// the client replaces the key share and seals the session ID as a REALITY client.
+	clientKey := make([]byte, 32)
+	rand.Read(clientKey)
+	clientPub, _ := curve25519.X25519(clientKey, curve25519.Basepoint)
+	copy(hello.keyShare, clientPub)
+	shared, _ := curve25519.X25519(clientKey, serverPub)
+	authKey := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, shared, hello.random[:20], []byte("REALITY")), authKey)
+
+	plain := make([]byte, 16)
+	copy(plain, []byte{1, 8, 1})
+	binary.BigEndian.PutUint32(plain[4:], uint32(time.Now().Unix()))
+	copy(plain[8:], []byte{0xab, 0xcd})
+	copy(hello.sessionID, make([]byte, 32))
+	block, _ := aes.NewCipher(authKey)
+	aead, _ := cipher.NewGCM(block)
+	copy(hello.sessionID, aead.Seal(nil, hello.random[20:], plain, hello.raw))
+
+	if key := realityAuthKey(hello, serverKey, [][8]byte{{0x12}, {0xab, 0xcd}}); !bytes.Equal(key, authKey) {
+		t.Errorf("got auth key %x, want %x", key, authKey)
+	}
+	if key := realityAuthKey(hello, serverKey, [][8]byte{{0x12}}); key != nil {
+		t.Error("the unknown short ID should not be authenticated")
+	}
+	hello.random[0] ^= 1
+	if key := realityAuthKey(hello, serverKey, [][8]byte{{0xab, 0xcd}}); key != nil {
+		t.Error("the modified ClientHello should not be authenticated")
+	}
+}
+
+func TestREALITYListenerForward(t *testing.T) {
+	dest := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("dest"))
+	}))
+	defer dest.Close()
+
+	privateKey := make([]byte, 32)
+	rand.Read(privateKey)
+	ln, err := REALITYListener("127.0.0.1:0", dest.Listener.Addr().String(), privateKey, []string{"abcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "dest" {
+		t.Errorf("got %q, want dest", body)
+	}
+	if cert := resp.TLS.PeerCertificates[0]; !cert.Equal(dest.Certificate()) {
+		t.Error("the certificate of dest is not presented")
+	}
+
+	if _, err := REALITYListener("127.0.0.1:0", "", privateKey[:16], nil); err == nil {
+		t.Error("the short private key should be rejected")
+	}
+	if _, err := REALITYListener("127.0.0.1:0", "", privateKey, []string{"xyz"}); err == nil {
+		t.Error("the invalid short ID should be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+package gost
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/go-redis/redis/v8"
+)
+
+// redisTimeout is the timeout of the Redis commands.
+const redisTimeout = 3 * time.Second
+
+type redisAccountingStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// RedisAccountingStore creates an AccountingStore backed by Redis, so the traffic and the quota of the users
+// are shared by the gost instances of a cluster.
+//
+// The traffic of the user is accumulated in the keys 'keyPrefix:user:bytes_in' and 'keyPrefix:user:bytes_out',
+// which expire ttl after the last record if ttl is positive. The quota of the user (the sum of the bytes)
+// is read from 'keyPrefix:user:quota', the users without quota are unlimited.
+// The commands of a Record or CheckQuota are sent in a pipeline.
+func RedisAccountingStore(client *redis.Client, keyPrefix string, ttl time.Duration) AccountingStore {
+	return &redisAccountingStore{
+		client: client,
+		prefix: keyPrefix,
+		ttl:    ttl,
+	}
+}
+
+func (s *redisAccountingStore) key(user, name string) string {
+	return s.prefix + ":" + user + ":" + name
+}
+
+// Record implements AccountingStore.
+func (s *redisAccountingStore) Record(user string, bytesIn, bytesOut int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	in, out := s.key(user, "bytes_in"), s.key(user, "bytes_out")
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, in, bytesIn)
+		pipe.IncrBy(ctx, out, bytesOut)
+		if s.ttl > 0 {
+			pipe.Expire(ctx, in, s.ttl)
+			pipe.Expire(ctx, out, s.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Logf("[accounting] redis: record %s: %v", user, err)
+	}
+}
+
+// CheckQuota implements AccountingStore.
+func (s *redisAccountingStore) CheckQuota(user string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	var quota, in, out *redis.StringCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		quota = pipe.Get(ctx, s.key(user, "quota"))
+		in = pipe.Get(ctx, s.key(user, "bytes_in"))
+		out = pipe.Get(ctx, s.key(user, "bytes_out"))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	limit, err := quota.Int64()
+	if err == redis.Nil {
+		return math.MaxInt64, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	remaining := limit
+	for _, cmd := range []*redis.StringCmd{in, out} {
+		n, err := cmd.Int64()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		remaining -= n
+	}
+	return remaining, nil
+}
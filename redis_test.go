@@ -0,0 +1,82 @@
+package gost
+
+import (
+	"math"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisAccountingStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	store := RedisAccountingStore(client, "gost", time.Hour)
+	if remaining, err := store.CheckQuota("admin"); err != nil || remaining != math.MaxInt64 {
+		t.Errorf("remaining %d, %v, want unlimited", remaining, err)
+	}
+
+	store.Record("admin", 100, 200)
+	store.Record("admin", 10, 20)
+	if v, _ := mr.Get("gost:admin:bytes_in"); v != "110" {
+		t.Errorf("bytes_in %s", v)
+	}
+	if v, _ := mr.Get("gost:admin:bytes_out"); v != "220" {
+		t.Errorf("bytes_out %s", v)
+	}
+	if ttl := mr.TTL("gost:admin:bytes_in"); ttl != time.Hour {
+		t.Errorf("ttl %s", ttl)
+	}
+
+	mr.Set("gost:admin:quota", "1000")
+	if remaining, err := store.CheckQuota("admin"); err != nil || remaining != 1000-330 {
+		t.Errorf("remaining %d, %v", remaining, err)
+	}
+	// the quota of the user without traffic.
+	mr.Set("gost:guest:quota", "10")
+	if remaining, err := store.CheckQuota("guest"); err != nil || remaining != 10 {
+		t.Errorf("remaining %d, %v", remaining, err)
+	}
+
+	mr.Set("gost:admin:quota", "invalid")
+	if _, err := store.CheckQuota("admin"); err == nil {
+		t.Error("should fail with the invalid quota")
+	}
+
+	mr.Close()
+	if _, err := store.CheckQuota("admin"); err == nil {
+		t.Error("should fail with redis unavailable")
+	}
+}
+
+func TestRedisAccountingStoreQuota(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	mr.Set("gost:admin:quota", "100")
+
+	mw := AccountingMiddleware(RedisAccountingStore(client, "gost", 0))
+	handler := HTTPHandler(UsersHandlerOption(url.UserPassword("admin", "123456")))
+	proxyClient := &Client{
+		Connector:   HTTPConnector(url.UserPassword("admin", "123456")),
+		Transporter: TCPTransporter(),
+	}
+	if err := middlewareRoundtrip(t, mw, handler, proxyClient, httpSrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := mr.Get("gost:admin:bytes_in"); v == "" || v == "0" {
+		t.Errorf("bytes_in %s", v)
+	}
+	// the quota is used up.
+	if err := middlewareRoundtrip(t, mw, handler, proxyClient, httpSrv.URL); err == nil {
+		t.Error("should fail with the quota exceeded")
+	}
+}
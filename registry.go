@@ -0,0 +1,188 @@
+package gost
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TransporterFactory creates the Transporter of a scheme.
+type TransporterFactory func() Transporter
+
+// ListenerFactory creates the Listener of a scheme on the address.
+type ListenerFactory func(addr string) (Listener, error)
+
+// NodeOptions are the options of a node prepared by the builder of the chain and the servers,
+// they are shared by the transport and the protocol of the node.
+type NodeOptions struct {
+	// TLSConfig is the client config of the chain node, or the server config of the serve node.
+	TLSConfig *tls.Config
+	// TLSListenerOptions are the options of the TLS listeners of the serve node.
+	TLSListenerOptions []TLSListenerOption
+	// WSOptions are the websocket options of the node parameters.
+	WSOptions *WSOptions
+	// Chain is the chain of the serve node.
+	Chain *Chain
+	// Authenticator authenticates the users of the serve node.
+	Authenticator Authenticator
+	// IPRoutes are the routes of the tun/tap device of the serve node.
+	IPRoutes []IPRoute
+}
+
+// Transport creates the Transporter and the Listener of a node, e.g. tls of http+tls://:443.
+type Transport struct {
+	// NewTransporter creates the Transporter of the chain node, it is nil if the transport is only for the server.
+	NewTransporter func(node Node, opts *NodeOptions) (Transporter, error)
+	// NewListener creates the Listener of the serve node, it is nil if the transport is only for the client.
+	NewListener func(node Node, opts *NodeOptions) (Listener, error)
+	// PathAddr is true if the address of the node is the path of the URL, e.g. unix:///var/run/gost.sock.
+	PathAddr bool
+	// TLS is true if the listener requires a TLS certificate, the cert and key parameters or DefaultTLSConfig.
+	TLS bool
+	// Chain is true if the listener uses the chain of the serve node, e.g. the remote port forwarding.
+	Chain bool
+}
+
+// Protocol creates the Connector and the Handler of a node, e.g. http of http+tls://:443.
+type Protocol struct {
+	// NewConnector creates the Connector of the chain node, the auto connector is used if it is nil.
+	NewConnector func(node Node, opts *NodeOptions) Connector
+	// NewHandler creates the Handler of the serve node, the auto handler is used if it is nil.
+	NewHandler func(node Node, opts *NodeOptions) (Handler, error)
+}
+
+type registryEntry struct {
+	name      string
+	transport Transport
+}
+
+type protocolEntry struct {
+	name     string
+	protocol Protocol
+}
+
+// Registry is the registry of the transports and the protocols of the node schemes.
+// The schemes registered to DefaultRegistry are recognized by ParseNode,
+// and the transport and the protocol of the nodes are created by the factories.
+type Registry struct {
+	entries   map[string]registryEntry
+	protocols map[string]protocolEntry
+	mux       sync.RWMutex
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		entries:   make(map[string]registryEntry),
+		protocols: make(map[string]protocolEntry),
+	}
+}
+
+// DefaultRegistry is the registry of the built-in transports and protocols, each of them is registered
+// by the init of its own file. The third-party transports can be registered to it in init.
+var DefaultRegistry = NewRegistry()
+
+// RegisterTransport registers the transport of the scheme, the aliases are the other schemes of it,
+// e.g. https for tls. The previous registration is replaced.
+func (r *Registry) RegisterTransport(scheme string, t Transport, aliases ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	scheme = strings.ToLower(scheme)
+	e := registryEntry{name: scheme, transport: t}
+	r.entries[scheme] = e
+	for _, alias := range aliases {
+		r.entries[strings.ToLower(alias)] = e
+	}
+}
+
+// LookupTransport returns the transport of the scheme and the name it is registered with,
+// ok is false if the scheme is not registered.
+func (r *Registry) LookupTransport(scheme string) (name string, t Transport, ok bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	e, ok := r.entries[strings.ToLower(scheme)]
+	return e.name, e.transport, ok
+}
+
+// Transports returns the sorted schemes of the registered transports, including the aliases.
+func (r *Registry) Transports() []string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	schemes := make([]string, 0, len(r.entries))
+	for scheme := range r.entries {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// RegisterProtocol registers the protocol of the scheme, the aliases are the other schemes of it,
+// e.g. socks for socks5. The previous registration is replaced.
+func (r *Registry) RegisterProtocol(scheme string, p Protocol, aliases ...string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	scheme = strings.ToLower(scheme)
+	e := protocolEntry{name: scheme, protocol: p}
+	r.protocols[scheme] = e
+	for _, alias := range aliases {
+		r.protocols[strings.ToLower(alias)] = e
+	}
+}
+
+// LookupProtocol returns the protocol of the scheme and the name it is registered with,
+// ok is false if the scheme is not registered.
+func (r *Registry) LookupProtocol(scheme string) (name string, p Protocol, ok bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	e, ok := r.protocols[strings.ToLower(scheme)]
+	return e.name, e.protocol, ok
+}
+
+// Protocols returns the sorted schemes of the registered protocols, including the aliases.
+func (r *Registry) Protocols() []string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	schemes := make([]string, 0, len(r.protocols))
+	for scheme := range r.protocols {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Register registers the transport of the scheme by the factories of the default options,
+// the previous registration is replaced.
+// Either factory can be nil if the scheme is only for the client or the server.
+func (r *Registry) Register(scheme string, newTransporter func() Transporter, newListener func(addr string) (Listener, error)) {
+	var t Transport
+	if newTransporter != nil {
+		t.NewTransporter = func(node Node, opts *NodeOptions) (Transporter, error) {
+			return newTransporter(), nil
+		}
+	}
+	if newListener != nil {
+		t.NewListener = func(node Node, opts *NodeOptions) (Listener, error) {
+			return newListener(node.Addr)
+		}
+	}
+	r.RegisterTransport(scheme, t)
+}
+
+// Lookup returns the factories of the transport of the scheme with the default options,
+// ok is false if the scheme is not registered.
+func (r *Registry) Lookup(scheme string) (newTransporter TransporterFactory, newListener ListenerFactory, ok bool) {
+	name, t, ok := r.LookupTransport(scheme)
+	if t.NewTransporter != nil {
+		newTransporter = func() Transporter {
+			tr, _ := t.NewTransporter(Node{Transport: name}, &NodeOptions{})
+			return tr
+		}
+	}
+	if t.NewListener != nil {
+		newListener = func(addr string) (Listener, error) {
+			return t.NewListener(Node{Addr: addr, Transport: name}, &NodeOptions{})
+		}
+	}
+	return newTransporter, newListener, ok
+}
@@ -0,0 +1,168 @@
+package gost
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryBuiltin(t *testing.T) {
+	for _, scheme := range []string{"tcp", "tls", "ws", "wss", "kcp", "quic", "h2", "ssh", "ohttp", "obfs4", "unix"} {
+		newTransporter, newListener, ok := DefaultRegistry.Lookup(scheme)
+		if !ok || newTransporter == nil || newListener == nil {
+			t.Errorf("%s is not registered", scheme)
+			continue
+		}
+		if newTransporter() == nil {
+			t.Errorf("%s: nil transporter", scheme)
+		}
+	}
+	if _, _, ok := DefaultRegistry.Lookup("unknown"); ok {
+		t.Error("unknown should not be registered")
+	}
+}
+
+func TestRegistryCustomScheme(t *testing.T) {
+	r := DefaultRegistry
+	r.Register("xtcp", TCPTransporter, TCPListener)
+	defer func() {
+		r.mux.Lock()
+		delete(r.entries, "xtcp")
+		r.mux.Unlock()
+	}()
+
+	node, err := ParseNode("http+xtcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Transport != "xtcp" {
+		t.Fatalf("got transport %s, want xtcp", node.Transport)
+	}
+	newTransporter, newListener, ok := r.Lookup(node.Transport)
+	if !ok {
+		t.Fatal("xtcp is not registered")
+	}
+
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+	ln, err := newListener(node.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{Connector: HTTPConnector(nil), Transporter: newTransporter()}
+	server := &Server{Listener: ln, Handler: HTTPHandler()}
+	go server.Run()
+	defer server.Close()
+
+	data := make([]byte, 128)
+	rand.Read(data)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, data); err != nil {
+		t.Error(err)
+	}
+
+	// the unregistered scheme falls back to tcp.
+	if node, _ := ParseNode("http+ytcp://127.0.0.1:0"); node.Transport != "tcp" {
+		t.Errorf("got transport %s, want tcp", node.Transport)
+	}
+}
+
+func TestRegistryAliases(t *testing.T) {
+	tests := []struct {
+		s         string
+		protocol  string
+		transport string
+		addr      string
+	}{
+		{"https://:443", "http", "tls", ":443"},
+		{"socks+tls://:443", "socks5", "tls", ":443"},
+		{"ss2+ssu://:8338", "ss", "udp", ":8338"},
+		{"hy2://:443", "hysteria2", "hysteria2", ":443"},
+		{"http+ygg://:8080", "http", "yggdrasil", ":8080"},
+		{"socks5+unixgram:///var/run/gost.sock", "socks5", "unixgram", "/var/run/gost.sock"},
+		{"http+derp://derp.example.com:443", "http", "derp", "derp.example.com:443"},
+		{"unknown+unknown://:8080", "", "tcp", ":8080"},
+	}
+	for _, tc := range tests {
+		node, err := ParseNode(tc.s)
+		if err != nil {
+			t.Errorf("%s: %v", tc.s, err)
+			continue
+		}
+		if node.Protocol != tc.protocol || node.Transport != tc.transport || node.Addr != tc.addr {
+			t.Errorf("%s: got %s+%s://%s, want %s+%s://%s", tc.s,
+				node.Protocol, node.Transport, node.Addr, tc.protocol, tc.transport, tc.addr)
+		}
+	}
+}
+
+func TestRegistryNodeFactories(t *testing.T) {
+	r := DefaultRegistry
+	r.RegisterTransport("ztcp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			if node.Get("secret") != "123" {
+				return nil, errors.New("invalid secret")
+			}
+			return TCPTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return TCPListener(node.Addr)
+		},
+	}, "zt")
+	r.RegisterProtocol("zhttp", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return HTTPConnector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return HTTPHandler(), nil
+		},
+	})
+	defer func() {
+		r.mux.Lock()
+		delete(r.entries, "ztcp")
+		delete(r.entries, "zt")
+		delete(r.protocols, "zhttp")
+		r.mux.Unlock()
+	}()
+
+	node, err := ParseNode("zhttp+zt://127.0.0.1:0?secret=123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Protocol != "zhttp" || node.Transport != "ztcp" {
+		t.Fatalf("got %s+%s, want zhttp+ztcp", node.Protocol, node.Transport)
+	}
+	_, tp, _ := r.LookupTransport(node.Transport)
+	_, p, _ := r.LookupProtocol(node.Protocol)
+	opts := &NodeOptions{}
+
+	ln, err := tp.NewListener(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := p.NewHandler(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := tp.NewTransporter(node, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Values.Set("secret", "456")
+	if _, err := tp.NewTransporter(node, opts); err == nil {
+		t.Error("the transporter of the invalid secret should not be created")
+	}
+
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+	client := &Client{Connector: p.NewConnector(node, opts), Transporter: tr}
+	server := &Server{Listener: ln, Handler: handler}
+	go server.Run()
+	defer server.Close()
+
+	data := make([]byte, 128)
+	rand.Read(data)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, data); err != nil {
+		t.Error(err)
+	}
+}
@@ -17,6 +17,17 @@ import (
 	"github.com/go-log/log"
 )
 
+func init() {
+	DefaultRegistry.RegisterProtocol("relay", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return RelayConnector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return RelayHandler(node.Remote), nil
+		},
+	})
+}
+
 type relayConnector struct {
 	user       *url.Userinfo
 	remoteAddr string
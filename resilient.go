@@ -0,0 +1,208 @@
+package gost
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+var (
+	resilientBackoffInitial = 100 * time.Millisecond
+	resilientBackoffMax     = 5 * time.Second
+)
+
+// ResilientConn wraps the connection to re-dial it when it fails, so the caller keeps using the same connection.
+// The dialer must return a ready connection, e.g. Chain.Dial, which re-establishes the transport and the proxy
+// handshakes (including the multiplexed sessions and streams) of the chain. On a Read or Write error except for
+// io.EOF and the timeouts of the deadlines, the connection is re-dialed up to maxRetries times with an exponential
+// backoff, then the unsent data of the failed Write is written to the new connection, and the failed Read is retried.
+// The deadlines are applied to the new connections.
+//
+// The data in flight when the connection fails, which has been written but not received by the peer, is lost.
+// So it fits the protocols which tolerate a reconnection, e.g. the idempotent requests or those resuming by themselves.
+//
+// The returned connection implements ReconnectCount() int, which returns the number of the reconnections.
+func ResilientConn(conn net.Conn, dialer func() (net.Conn, error), maxRetries int) net.Conn {
+	return &resilientConn{
+		conn:       conn,
+		dialer:     dialer,
+		maxRetries: maxRetries,
+		done:       make(chan struct{}),
+	}
+}
+
+type resilientConn struct {
+	mux        sync.Mutex
+	conn       net.Conn
+	gen        int // the generation of conn, increased by each reconnection
+	dialer     func() (net.Conn, error)
+	maxRetries int
+	closed     bool
+	rdl, wdl   time.Time
+	reconnects int
+	done       chan struct{}
+
+	rmux, wmux sync.Mutex
+	dialMux    sync.Mutex
+}
+
+func (c *resilientConn) current() (net.Conn, int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.conn, c.gen
+}
+
+// ReconnectCount returns the number of the reconnections.
+func (c *resilientConn) ReconnectCount() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.reconnects
+}
+
+func (c *resilientConn) Read(b []byte) (n int, err error) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+
+	for {
+		conn, gen := c.current()
+		n, err = conn.Read(b)
+		if n > 0 || !c.retryable(err) {
+			return
+		}
+		if rerr := c.reconnect(gen, err); rerr != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *resilientConn) Write(b []byte) (n int, err error) {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+
+	for {
+		conn, gen := c.current()
+		var nn int
+		nn, err = conn.Write(b[n:])
+		n += nn
+		if err == nil || !c.retryable(err) {
+			return
+		}
+		if rerr := c.reconnect(gen, err); rerr != nil {
+			return
+		}
+	}
+}
+
+func (c *resilientConn) retryable(err error) bool {
+	if err == nil || errors.Is(err, io.EOF) {
+		return false
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return !c.closed
+}
+
+// reconnect re-dials the connection of the generation gen, which fails with the error cause.
+// The connection is re-dialed once if both of Read and Write fail with it.
+func (c *resilientConn) reconnect(gen int, cause error) error {
+	c.dialMux.Lock()
+	defer c.dialMux.Unlock()
+
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return net.ErrClosed
+	}
+	if c.gen != gen {
+		// reconnected by the other direction.
+		c.mux.Unlock()
+		return nil
+	}
+	old := c.conn
+	c.mux.Unlock()
+	old.Close()
+
+	backoff := ExponentialBackoff(resilientBackoffInitial, resilientBackoffMax, 2)
+	err := cause
+	for i := 0; i < c.maxRetries; i++ {
+		log.Logf("[resilient] %s - %s : %v, reconnecting %d/%d", old.LocalAddr(), old.RemoteAddr(), err, i+1, c.maxRetries)
+
+		var conn net.Conn
+		if conn, err = c.dialer(); err == nil {
+			c.mux.Lock()
+			defer c.mux.Unlock()
+			if c.closed {
+				conn.Close()
+				return net.ErrClosed
+			}
+			if !c.rdl.IsZero() {
+				conn.SetReadDeadline(c.rdl)
+			}
+			if !c.wdl.IsZero() {
+				conn.SetWriteDeadline(c.wdl)
+			}
+			c.conn = conn
+			c.gen++
+			c.reconnects++
+			return nil
+		}
+		if isPermanentError(err) {
+			break
+		}
+		select {
+		case <-time.After(backoff.Next()):
+		case <-c.done:
+			return net.ErrClosed
+		}
+	}
+	return err
+}
+
+func (c *resilientConn) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	return c.conn.Close()
+}
+
+func (c *resilientConn) LocalAddr() net.Addr {
+	conn, _ := c.current()
+	return conn.LocalAddr()
+}
+
+func (c *resilientConn) RemoteAddr() net.Addr {
+	conn, _ := c.current()
+	return conn.RemoteAddr()
+}
+
+func (c *resilientConn) SetDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.rdl, c.wdl = t, t
+	return c.conn.SetDeadline(t)
+}
+
+func (c *resilientConn) SetReadDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.rdl = t
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *resilientConn) SetWriteDeadline(t time.Time) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.wdl = t
+	return c.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,106 @@
+package gost
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResilientConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn, first bool) {
+				defer conn.Close()
+				b := make([]byte, 5)
+				for {
+					if _, err := io.ReadFull(conn, b); err != nil {
+						return
+					}
+					conn.Write(b)
+					if first {
+						// the first connection is reset after a roundtrip.
+						conn.(*net.TCPConn).SetLinger(0)
+						return
+					}
+				}
+			}(conn, i == 0)
+		}
+	}()
+
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", ln.Addr().String())
+	}
+	conn, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := ResilientConn(conn, dial, 3)
+	defer rc.Close()
+
+	b := make([]byte, 5)
+	for i, msg := range []string{"hello", "world", "again"} {
+		if i == 1 {
+			// wait for the reset of the first connection.
+			time.Sleep(100 * time.Millisecond)
+		}
+		if _, err := rc.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(rc, b); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != msg {
+			t.Errorf("got %q, want %q", b, msg)
+		}
+	}
+	if n := rc.(interface{ ReconnectCount() int }).ReconnectCount(); n != 1 {
+		t.Errorf("reconnected %d times, want 1", n)
+	}
+}
+
+func TestResilientConnRetries(t *testing.T) {
+	defer func(d time.Duration) { resilientBackoffInitial = d }(resilientBackoffInitial)
+	resilientBackoffInitial = time.Millisecond
+
+	client, server := net.Pipe()
+	server.Close()
+	dials := 0
+	errDial := errors.New("dial failed")
+	rc := ResilientConn(client, func() (net.Conn, error) {
+		dials++
+		return nil, errDial
+	}, 3)
+	defer rc.Close()
+
+	if _, err := rc.Write([]byte("hello")); err == nil {
+		t.Error("the write should fail")
+	}
+	if dials != 3 {
+		t.Errorf("dialed %d times, want 3", dials)
+	}
+	if n := rc.(interface{ ReconnectCount() int }).ReconnectCount(); n != 0 {
+		t.Errorf("reconnected %d times, want 0", n)
+	}
+
+	// the connection is not re-dialed on EOF.
+	client, server = net.Pipe()
+	rc = ResilientConn(client, func() (net.Conn, error) {
+		t.Error("the connection should not be re-dialed")
+		return nil, errDial
+	}, 3)
+	server.Close()
+	if _, err := rc.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
@@ -0,0 +1,128 @@
+package gost
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-gost/gosocks5"
+)
+
+// RetryBackoff is the backoff strategy used between the retries of dialing a node.
+type RetryBackoff interface {
+	// Next returns the duration to wait before the next attempt.
+	Next() time.Duration
+}
+
+type constantBackoff struct {
+	d time.Duration
+}
+
+// ConstantBackoff creates a RetryBackoff that always waits for duration d.
+func ConstantBackoff(d time.Duration) RetryBackoff {
+	return &constantBackoff{d: d}
+}
+
+func (b *constantBackoff) Next() time.Duration {
+	return b.d
+}
+
+type exponentialBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	factor  float64
+	next    time.Duration
+}
+
+// ExponentialBackoff creates a RetryBackoff that starts from the initial duration,
+// and multiplies it by factor for each attempt, up to the max duration.
+func ExponentialBackoff(initial, max time.Duration, factor float64) RetryBackoff {
+	if factor < 1 {
+		factor = 1
+	}
+	return &exponentialBackoff{
+		initial: initial,
+		max:     max,
+		factor:  factor,
+	}
+}
+
+func (b *exponentialBackoff) Next() time.Duration {
+	if b.next <= 0 {
+		b.next = b.initial
+	}
+	d := b.next
+	if b.max > 0 && d > b.max {
+		d = b.max
+	}
+	b.next = time.Duration(float64(d) * b.factor)
+	return d
+}
+
+func (b *exponentialBackoff) clone() RetryBackoff {
+	return &exponentialBackoff{
+		initial: b.initial,
+		max:     b.max,
+		factor:  b.factor,
+	}
+}
+
+// newBackoff returns a fresh state of the backoff b if it is stateful,
+// so that the concurrent dials do not share the same backoff sequence.
+func newBackoff(b RetryBackoff) RetryBackoff {
+	if c, ok := b.(interface{ clone() RetryBackoff }); ok {
+		return c.clone()
+	}
+	return b
+}
+
+// WithRetry specifies the max attempts and the backoff strategy for dialing and handshaking with the node.
+// The backoff can be nil, which means to retry immediately.
+// It is different from RetryHandshakeOption, which is the retries of the SSH ping.
+func WithRetry(maxAttempts int, backoff RetryBackoff) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		opts.MaxAttempts = maxAttempts
+		opts.Backoff = backoff
+	}
+}
+
+// PermanentError is the error of the attempt which should not be retried, such as an authentication failure.
+// The Connectors and Transporters can wrap their errors with it to stop the retries of WithRetry.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// proxyStatusError returns the error of the HTTP proxy response which is not 200 OK,
+// the authentication failure (407) is permanent.
+func proxyStatusError(resp *http.Response) error {
+	err := errors.New(resp.Status)
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
+// isPermanentError reports whether the error err is permanent,
+// which means that the attempt should not be retried, such as an authentication failure.
+func isPermanentError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// NOTE: the context errors are not checked here, as the dial timeout of the net package
+	// is also a context.DeadlineExceeded, the caller should check its own context instead.
+	var perr *PermanentError
+	if errors.As(err, &perr) || errors.Is(err, gosocks5.ErrAuthFailure) {
+		return true
+	}
+	var verr *tls.CertificateVerificationError
+	return errors.As(err, &verr)
+}
@@ -0,0 +1,213 @@
+package gost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-gost/gosocks5"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond, 2)
+	expected := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	}
+	for i, d := range expected {
+		if v := b.Next(); v != d {
+			t.Errorf("#%d: got %v, want %v", i, v, d)
+		}
+	}
+
+	if v := newBackoff(b).Next(); v != 10*time.Millisecond {
+		t.Errorf("new backoff: got %v, want %v", v, 10*time.Millisecond)
+	}
+}
+
+type failTransporter struct {
+	tcpTransporter
+	fails int
+	err   error
+	dials int
+}
+
+func (tr *failTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	tr.dials++
+	if tr.dials <= tr.fails {
+		return nil, tr.err
+	}
+	return tr.tcpTransporter.Dial(addr, options...)
+}
+
+func TestChainDialNodeRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// the dial timeout of the net package is a transient error.
+	_, timeoutErr := (&net.Dialer{Timeout: time.Nanosecond}).Dial("tcp", ln.Addr().String())
+	if timeoutErr == nil {
+		t.Fatal("dial should time out")
+	}
+
+	tests := []struct {
+		fails       int
+		err         error
+		maxAttempts int
+		dials       int
+		ok          bool
+	}{
+		{0, nil, 0, 1, true},
+		{1, errors.New("connection refused"), 0, 1, false},
+		{2, errors.New("connection refused"), 3, 3, true},
+		{3, errors.New("connection refused"), 3, 3, false},
+		{3, gosocks5.ErrAuthFailure, 3, 1, false},
+		{2, timeoutErr, 3, 3, true},
+	}
+
+	for i, tc := range tests {
+		tr := &failTransporter{fails: tc.fails, err: tc.err}
+		node := Node{
+			Addr:   ln.Addr().String(),
+			Client: &Client{Connector: HTTPConnector(nil), Transporter: tr},
+			HandshakeOptions: []HandshakeOption{
+				WithRetry(tc.maxAttempts, ConstantBackoff(time.Millisecond)),
+			},
+		}
+		conn, err := NewChain().dialNode(context.Background(), node)
+		if (err == nil) != tc.ok {
+			t.Errorf("#%d: got error %v", i, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		if tr.dials != tc.dials {
+			t.Errorf("#%d: dialed %d times, want %d", i, tr.dials, tc.dials)
+		}
+	}
+}
+
+type failConnector struct {
+	Connector
+	fails    int
+	err      error
+	connects int
+}
+
+func (c *failConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	c.connects++
+	if c.connects <= c.fails {
+		return nil, c.err
+	}
+	return c.Connector.ConnectContext(ctx, conn, network, address, options...)
+}
+
+func TestChainConnectNodeRetry(t *testing.T) {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := &Server{Listener: ln, Handler: HTTPHandler()}
+	go proxy.Run()
+	defer proxy.Close()
+
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		fails    int
+		err      error
+		connects int
+		dials    int
+		ok       bool
+	}{
+		{0, nil, 1, 1, true},
+		{2, errors.New("connection reset"), 3, 3, true},
+		{3, errors.New("connection reset"), 3, 3, false},
+		{3, &PermanentError{Err: errors.New("407 Proxy Authentication Required")}, 1, 1, false},
+	}
+
+	for i, tc := range tests {
+		tr := &failTransporter{}
+		connector := &failConnector{Connector: HTTPConnector(nil), fails: tc.fails, err: tc.err}
+		first := Node{
+			Addr:   ln.Addr().String(),
+			Client: &Client{Connector: connector, Transporter: tr},
+		}
+		// the retries of the second node connect through the first node again.
+		second := Node{
+			Addr:   target.Addr().String(),
+			Client: &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()},
+			HandshakeOptions: []HandshakeOption{
+				WithRetry(3, ConstantBackoff(time.Millisecond)),
+			},
+		}
+		conn, err := NewChain(first, second).getConn(context.Background())
+		if (err == nil) != tc.ok {
+			t.Errorf("#%d: got error %v", i, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		if connector.connects != tc.connects || tr.dials != tc.dials {
+			t.Errorf("#%d: connected %d times and dialed %d times, want %d and %d",
+				i, connector.connects, tr.dials, tc.connects, tc.dials)
+		}
+	}
+}
+
+func TestIsPermanentError(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), false},
+		{gosocks5.ErrAuthFailure, true},
+		{fmt.Errorf("socks5: %w", gosocks5.ErrAuthFailure), true},
+		{proxyStatusError(&http.Response{StatusCode: http.StatusProxyAuthRequired, Status: "407 Proxy Authentication Required"}), true},
+		{proxyStatusError(&http.Response{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"}), false},
+		// the message is not classified, only the type.
+		{errors.New("407 Proxy Authentication Required"), false},
+		{sshHandshakeError(errors.New("ssh: unable to authenticate"), true), true},
+		{sshHandshakeError(errors.New("ssh: unable to authenticate"), false), false},
+		{sshHandshakeError(io.EOF, true), false},
+	}
+	for i, tc := range tests {
+		if got := isPermanentError(tc.err); got != tc.permanent {
+			t.Errorf("#%d: %v: got %v, want %v", i, tc.err, got, tc.permanent)
+		}
+	}
+}
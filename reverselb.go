@@ -0,0 +1,348 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterProtocol("reverse-lb", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			backends, err := parseBackends(node.Remote)
+			if err != nil {
+				return nil, err
+			}
+			return ReverseLoadBalancerHandler(backends, ParseLoadBalancerStrategy(node.Get("strategy"))), nil
+		},
+	})
+}
+
+// parseBackends parses the comma-separated backends of the reverse proxy, e.g. http://10.0.0.1:80,http://10.0.0.2:80.
+// The backend without the scheme is a TCP address.
+func parseBackends(s string) (backends []*url.URL, err error) {
+	for _, s := range strings.Split(s, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "://") {
+			s = "tcp://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid backend %s", s)
+		}
+		backends = append(backends, u)
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("no backend")
+	}
+	return
+}
+
+// LoadBalancerStrategy is the strategy of ReverseLoadBalancerHandler to select the backend.
+type LoadBalancerStrategy int
+
+const (
+	// RoundRobinLoadBalancer selects the backends in turn.
+	RoundRobinLoadBalancer LoadBalancerStrategy = iota
+	// RandomLoadBalancer selects the backend randomly.
+	RandomLoadBalancer
+	// IPHashLoadBalancer selects the backend by the hash of the client IP, so a client sticks to a backend.
+	IPHashLoadBalancer
+)
+
+// ParseLoadBalancerStrategy parses the strategy: round, random or iphash, defaults to round.
+func ParseLoadBalancerStrategy(s string) LoadBalancerStrategy {
+	switch strings.ToLower(s) {
+	case "random":
+		return RandomLoadBalancer
+	case "iphash", "ip_hash", "ip-hash":
+		return IPHashLoadBalancer
+	default:
+		return RoundRobinLoadBalancer
+	}
+}
+
+func (s LoadBalancerStrategy) String() string {
+	switch s {
+	case RandomLoadBalancer:
+		return "random"
+	case IPHashLoadBalancer:
+		return "iphash"
+	default:
+		return "round"
+	}
+}
+
+type lbBackend struct {
+	url    *url.URL
+	id     string // the value of the sticky cookie
+	marker *failMarker
+}
+
+func (b *lbBackend) addr() string {
+	if b.url.Port() != "" {
+		return b.url.Host
+	}
+	switch b.url.Scheme {
+	case "https":
+		return net.JoinHostPort(b.url.Hostname(), "443")
+	case "http":
+		return net.JoinHostPort(b.url.Hostname(), "80")
+	}
+	return b.url.Host
+}
+
+type reverseLBHandler struct {
+	backends  []*lbBackend
+	strategy  LoadBalancerStrategy
+	http      bool
+	counter   uint64
+	rand      *rand.Rand
+	randMux   sync.Mutex
+	transport *http.Transport
+	options   *HandlerOptions
+}
+
+// ReverseLoadBalancerHandler creates a server Handler of the reverse proxy, which distributes the connections
+// across the backends by the strategy. The backends of the http and https schemes are proxied by the HTTP requests,
+// each request is sent to a backend, and the backend can be sticky by the cookie named by WithStickyCookie.
+// The backends of the other schemes (e.g. tcp://10.0.0.1:22) are relayed by the connections.
+//
+// The backends are checked passively: a backend is down after MaxFailsHandlerOption consecutive errors of
+// connecting or sending the request, then up again after FailTimeoutHandlerOption. The responses of the backends,
+// including 5xx, are not errors. The backends are connected through ChainHandlerOption.
+func ReverseLoadBalancerHandler(backends []*url.URL, strategy LoadBalancerStrategy) Handler {
+	h := &reverseLBHandler{
+		strategy: strategy,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		options:  &HandlerOptions{},
+	}
+	for _, u := range backends {
+		hash := fnv.New32a()
+		hash.Write([]byte(u.String()))
+		h.backends = append(h.backends, &lbBackend{
+			url:    u,
+			id:     fmt.Sprintf("%08x", hash.Sum32()),
+			marker: &failMarker{},
+		})
+	}
+	if len(backends) > 0 {
+		h.http = backends[0].Scheme == "http" || backends[0].Scheme == "https"
+	}
+	h.transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return h.options.Chain.DialContext(ctx, network, addr, TimeoutChainOption(h.options.Timeout))
+		},
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return h
+}
+
+func (h *reverseLBHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+// alive reports whether the backend is up.
+func (h *reverseLBHandler) alive(b *lbBackend) bool {
+	maxFails := h.options.MaxFails
+	if maxFails == 0 {
+		maxFails = DefaultMaxFails
+	}
+	failTimeout := h.options.FailTimeout
+	if failTimeout == 0 {
+		failTimeout = DefaultFailTimeout
+	}
+	if maxFails < 0 {
+		return true
+	}
+	return b.marker.FailCount() < uint32(maxFails) ||
+		time.Since(time.Unix(b.marker.FailTime(), 0)) >= failTimeout
+}
+
+// next selects the backend for the client, the tried backends are skipped.
+func (h *reverseLBHandler) next(client string, tried map[*lbBackend]bool) *lbBackend {
+	n := len(h.backends)
+	var start int
+	switch h.strategy {
+	case RandomLoadBalancer:
+		h.randMux.Lock()
+		start = h.rand.Intn(n)
+		h.randMux.Unlock()
+	case IPHashLoadBalancer:
+		hash := fnv.New32a()
+		hash.Write([]byte(client))
+		start = int(hash.Sum32() % uint32(n))
+	default:
+		start = int((atomic.AddUint64(&h.counter, 1) - 1) % uint64(n))
+	}
+
+	// the next alive backend, or the next one if all are down.
+	var fallback *lbBackend
+	for i := 0; i < n; i++ {
+		b := h.backends[(start+i)%n]
+		if tried[b] {
+			continue
+		}
+		if h.alive(b) {
+			return b
+		}
+		if fallback == nil {
+			fallback = b
+		}
+	}
+	return fallback
+}
+
+func (h *reverseLBHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	if len(h.backends) == 0 {
+		log.Logf("[reverse-lb] %s - %s : no backend", conn.RemoteAddr(), conn.LocalAddr())
+		return
+	}
+	client, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if h.http {
+		h.handleHTTP(conn, client)
+		return
+	}
+
+	tried := make(map[*lbBackend]bool)
+	for b := h.next(client, tried); b != nil; b = h.next(client, tried) {
+		tried[b] = true
+		cc, err := h.options.Chain.Dial(b.addr(), TimeoutChainOption(h.options.Timeout))
+		if err != nil {
+			log.Logf("[reverse-lb] %s -> %s : %s", conn.RemoteAddr(), b.url, err)
+			b.marker.Mark()
+			continue
+		}
+		b.marker.Reset()
+		defer cc.Close()
+
+		log.Logf("[reverse-lb] %s <-> %s", conn.RemoteAddr(), b.url)
+		transport(conn, cc)
+		log.Logf("[reverse-lb] %s >-< %s", conn.RemoteAddr(), b.url)
+		return
+	}
+}
+
+// sticky returns the alive backend of the sticky cookie of the request.
+func (h *reverseLBHandler) sticky(req *http.Request) *lbBackend {
+	if h.options.StickyCookie == "" {
+		return nil
+	}
+	cookie, err := req.Cookie(h.options.StickyCookie)
+	if err != nil {
+		return nil
+	}
+	for _, b := range h.backends {
+		if b.id == cookie.Value && h.alive(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (h *reverseLBHandler) handleHTTP(conn net.Conn, client string) {
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if err != io.EOF {
+				log.Logf("[reverse-lb] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+			}
+			return
+		}
+		resp := h.roundTrip(req, client)
+		if Debug {
+			log.Logf("[reverse-lb] %s : %s %s -> %s", conn.RemoteAddr(), req.Method, req.URL, resp.Status)
+		}
+		err = resp.Write(conn)
+		resp.Body.Close()
+		if err != nil || req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+// roundTrip sends the request to the backends until one responds, the request with the body is sent once.
+func (h *reverseLBHandler) roundTrip(req *http.Request, client string) *http.Response {
+	uri := req.URL
+	if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+		req.Header.Set("X-Forwarded-For", prior+", "+client)
+	} else {
+		req.Header.Set("X-Forwarded-For", client)
+	}
+	req.RequestURI = ""
+	retry := req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+
+	tried := make(map[*lbBackend]bool)
+	b := h.sticky(req)
+	if b == nil {
+		b = h.next(client, tried)
+	}
+	for ; b != nil; b = h.next(client, tried) {
+		tried[b] = true
+
+		u := *uri
+		u.Scheme = b.url.Scheme
+		u.Host = b.url.Host
+		if p := strings.TrimRight(b.url.Path, "/"); p != "" {
+			u.Path = p + uri.Path
+			u.RawPath = ""
+		}
+		req.URL = &u
+
+		resp, err := h.transport.RoundTrip(req)
+		if err != nil {
+			log.Logf("[reverse-lb] %s -> %s : %s", client, b.url, err)
+			b.marker.Mark()
+			if !retry {
+				break
+			}
+			continue
+		}
+		b.marker.Reset()
+
+		if name := h.options.StickyCookie; name != "" {
+			if c, err := req.Cookie(name); err != nil || c.Value != b.id {
+				resp.Header.Add("Set-Cookie", (&http.Cookie{Name: name, Value: b.id, Path: "/", HttpOnly: true}).String())
+			}
+		}
+		return resp
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Status:     "502 Bad Gateway",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Close:      true,
+		Request:    req,
+	}
+}
@@ -0,0 +1,143 @@
+package gost
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func reverseLBServer(t *testing.T, h Handler) string {
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Listener: ln, Handler: h}
+	go s.Run()
+	t.Cleanup(func() { s.Close() })
+	return "http://" + ln.Addr().String()
+}
+
+func reverseLBBackends(t *testing.T, n int) []*url.URL {
+	var backends []*url.URL
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("backend%d", i)
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		t.Cleanup(s.Close)
+		u, _ := url.Parse(s.URL)
+		backends = append(backends, u)
+	}
+	return backends
+}
+
+func reverseLBGet(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	return string(b)
+}
+
+func TestReverseLoadBalancerRoundRobin(t *testing.T) {
+	backends := reverseLBBackends(t, 3)
+	// the closed backend is marked down.
+	down, _ := url.Parse("http://127.0.0.1:1")
+	backends = append(backends, down)
+
+	h := ReverseLoadBalancerHandler(backends, RoundRobinLoadBalancer)
+	h.Init(MaxFailsHandlerOption(1), FailTimeoutHandlerOption(time.Minute))
+	addr := reverseLBServer(t, h)
+
+	counts := make(map[string]int)
+	for i := 0; i < 12; i++ {
+		counts[reverseLBGet(t, http.DefaultClient, addr)]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("unexpected distribution %v", counts)
+	}
+	for name, n := range counts {
+		if n < 3 {
+			t.Errorf("%s got %d requests of 12", name, n)
+		}
+	}
+}
+
+func TestReverseLoadBalancerIPHash(t *testing.T) {
+	h := ReverseLoadBalancerHandler(reverseLBBackends(t, 3), IPHashLoadBalancer)
+	addr := reverseLBServer(t, h)
+
+	first := reverseLBGet(t, http.DefaultClient, addr)
+	for i := 0; i < 5; i++ {
+		if got := reverseLBGet(t, &http.Client{Transport: &http.Transport{}}, addr); got != first {
+			t.Errorf("got %s, want %s", got, first)
+		}
+	}
+}
+
+func TestReverseLoadBalancerSticky(t *testing.T) {
+	h := ReverseLoadBalancerHandler(reverseLBBackends(t, 3), RandomLoadBalancer)
+	h.Init(WithStickyCookie("GOSTLB"))
+	addr := reverseLBServer(t, h)
+
+	resp, err := http.Get(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "GOSTLB" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("no sticky cookie")
+	}
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodGet, addr, nil)
+		req.AddCookie(cookie)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(got) != string(b) {
+			t.Errorf("got %s, want %s", got, b)
+		}
+		if len(resp.Cookies()) > 0 {
+			t.Error("the cookie is set again")
+		}
+	}
+}
+
+func TestReverseLoadBalancerTCP(t *testing.T) {
+	backend := httptest.NewServer(httpTestHandler)
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	h := ReverseLoadBalancerHandler([]*url.URL{{Scheme: "tcp", Host: u.Host}}, RoundRobinLoadBalancer)
+	addr := reverseLBServer(t, h)
+
+	conn, err := net.Dial("tcp", addr[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := httpRoundtrip(conn, backend.URL, []byte("hello")); err != nil {
+		t.Error(err)
+	}
+}
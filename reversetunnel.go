@@ -0,0 +1,325 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	smux "github.com/xtaci/smux"
+)
+
+const reverseTunnelVersion = 1
+
+// the status of the reverse tunnel registration.
+const (
+	reverseTunnelOK         = 0x00
+	reverseTunnelNameTaken  = 0x01
+	reverseTunnelBadRequest = 0x02
+)
+
+var (
+	// ErrReverseTunnelNotFound is returned by ReverseTunnelDial if the name is not registered.
+	ErrReverseTunnelNotFound = errors.New("reverse tunnel: name not registered")
+)
+
+// reverseTunnels are the tunnels of the registered names of ReverseTunnelServer.
+var reverseTunnels = struct {
+	sync.RWMutex
+	m map[string]*reverseTunnel
+}{m: make(map[string]*reverseTunnel)}
+
+// reverseTunnel is the registration of a client, the session is nil until the registration is replied.
+type reverseTunnel struct {
+	mux     sync.Mutex
+	session *smux.Session
+}
+
+func (t *reverseTunnel) setSession(session *smux.Session) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.session = session
+}
+
+func (t *reverseTunnel) getSession() *smux.Session {
+	if t == nil {
+		return nil
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.session
+}
+
+// ReverseTunnelClient exposes the local services behind the NAT through the reverse tunnel server at serverAddr.
+// It connects to the server, registers the names of localServices, which maps the names to the local addresses,
+// then serves the streams opened by the server over the single connection, each stream is relayed to the local
+// service of its name. It blocks until the connection is closed, and returns the error.
+//
+// The protocol is, after the connection:
+//
+//	registration: [version 1][number of names][name length][name]...
+//	reply: [status], 0 is OK, 1 if a name is registered by another client, 2 for the invalid registration
+//
+// then the connection is multiplexed by smux, each stream opened by the server starts with [name length][name].
+func ReverseTunnelClient(serverAddr string, localServices map[string]string) error {
+	if len(localServices) == 0 || len(localServices) > 255 {
+		return fmt.Errorf("reverse tunnel: invalid number of services %d", len(localServices))
+	}
+	b := []byte{reverseTunnelVersion, byte(len(localServices))}
+	for name := range localServices {
+		if len(name) == 0 || len(name) > 255 {
+			return fmt.Errorf("reverse tunnel: invalid name %q", name)
+		}
+		b = append(b, byte(len(name)))
+		b = append(b, name...)
+	}
+
+	conn, err := net.DialTimeout("tcp", serverAddr, DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if _, err := conn.Write(b); err != nil {
+		return err
+	}
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return err
+	}
+	switch status[0] {
+	case reverseTunnelOK:
+	case reverseTunnelNameTaken:
+		return errors.New("reverse tunnel: name is registered by another client")
+	default:
+		return fmt.Errorf("reverse tunnel: registration failed with status %d", status[0])
+	}
+	conn.SetDeadline(time.Time{})
+
+	session, err := smux.Server(conn, smux.DefaultConfig())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	log.Logf("[rtun] %s - %s : %d services registered", conn.LocalAddr(), serverAddr, len(localServices))
+
+	for {
+		stream, err := session.AcceptStream()
+		if err != nil {
+			return err
+		}
+		go reverseTunnelServeStream(stream, localServices)
+	}
+}
+
+func reverseTunnelServeStream(stream *smux.Stream, localServices map[string]string) {
+	defer stream.Close()
+
+	name, err := readReverseTunnelName(stream)
+	if err != nil {
+		log.Logf("[rtun] %s : %s", stream.RemoteAddr(), err)
+		return
+	}
+	addr, ok := localServices[name]
+	if !ok {
+		log.Logf("[rtun] unknown service %s", name)
+		return
+	}
+	cc, err := net.DialTimeout("tcp", addr, DialTimeout)
+	if err != nil {
+		log.Logf("[rtun] %s -> %s : %s", name, addr, err)
+		return
+	}
+	defer cc.Close()
+
+	if Debug {
+		log.Logf("[rtun] %s <-> %s", name, addr)
+	}
+	transport(stream, cc)
+	if Debug {
+		log.Logf("[rtun] %s >-< %s", name, addr)
+	}
+}
+
+func readReverseTunnelName(r io.Reader) (string, error) {
+	b := make([]byte, 256)
+	if _, err := io.ReadFull(r, b[:1]); err != nil {
+		return "", err
+	}
+	n := int(b[0])
+	if n == 0 {
+		return "", errors.New("reverse tunnel: empty name")
+	}
+	if _, err := io.ReadFull(r, b[:n]); err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+// ReverseTunnelServer accepts the registrations of ReverseTunnelClient on addr. The registered names are
+// reached by ReverseTunnelDial, and exposed by the servers with ReverseTunnelHandler, e.g. on a public port.
+// A name is unregistered when the connection of its client is closed. It blocks until the listener fails.
+func ReverseTunnelServer(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return serveReverseTunnel(ln)
+}
+
+func serveReverseTunnel(ln net.Listener) error {
+	defer ln.Close()
+	log.Logf("[rtun] listening on %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go reverseTunnelRegister(conn)
+	}
+}
+
+func reverseTunnelRegister(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	names, err := readReverseTunnelRegistration(conn)
+	if err != nil {
+		log.Logf("[rtun] %s : %s", conn.RemoteAddr(), err)
+		conn.Write([]byte{reverseTunnelBadRequest})
+		return
+	}
+
+	tunnel := &reverseTunnel{}
+	reverseTunnels.Lock()
+	for _, name := range names {
+		if _, ok := reverseTunnels.m[name]; ok {
+			reverseTunnels.Unlock()
+			log.Logf("[rtun] %s : name %s is taken", conn.RemoteAddr(), name)
+			conn.Write([]byte{reverseTunnelNameTaken})
+			return
+		}
+	}
+	for _, name := range names {
+		reverseTunnels.m[name] = tunnel
+	}
+	reverseTunnels.Unlock()
+
+	defer func() {
+		reverseTunnels.Lock()
+		for _, name := range names {
+			if reverseTunnels.m[name] == tunnel {
+				delete(reverseTunnels.m, name)
+			}
+		}
+		reverseTunnels.Unlock()
+		log.Logf("[rtun] %s : %v unregistered", conn.RemoteAddr(), names)
+	}()
+
+	if _, err := conn.Write([]byte{reverseTunnelOK}); err != nil {
+		log.Logf("[rtun] %s : %s", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	session, err := smux.Client(conn, smux.DefaultConfig())
+	if err != nil {
+		log.Logf("[rtun] %s : %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer session.Close()
+	tunnel.setSession(session)
+	log.Logf("[rtun] %s : %v registered", conn.RemoteAddr(), names)
+
+	<-session.CloseChan()
+}
+
+func readReverseTunnelRegistration(r io.Reader) ([]string, error) {
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if b[0] != reverseTunnelVersion {
+		return nil, fmt.Errorf("reverse tunnel: unsupported version %d", b[0])
+	}
+	if b[1] == 0 {
+		return nil, errors.New("reverse tunnel: no names")
+	}
+
+	var names []string
+	for i := 0; i < int(b[1]); i++ {
+		name, err := readReverseTunnelName(r)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// ReverseTunnelDial connects to the local service registered with the name by ReverseTunnelClient.
+func ReverseTunnelDial(name string) (net.Conn, error) {
+	reverseTunnels.RLock()
+	session := reverseTunnels.m[name].getSession()
+	reverseTunnels.RUnlock()
+	if session == nil {
+		return nil, ErrReverseTunnelNotFound
+	}
+
+	stream, err := session.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stream.Write(append([]byte{byte(len(name))}, name...)); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+type reverseTunnelHandler struct {
+	name    string
+	options *HandlerOptions
+}
+
+// ReverseTunnelHandler creates a server Handler which relays the connections to the local service
+// registered with the name by ReverseTunnelClient.
+func ReverseTunnelHandler(name string, opts ...HandlerOption) Handler {
+	h := &reverseTunnelHandler{
+		name:    name,
+		options: &HandlerOptions{},
+	}
+	for _, opt := range opts {
+		opt(h.options)
+	}
+	return h
+}
+
+func (h *reverseTunnelHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *reverseTunnelHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	cc, err := ReverseTunnelDial(h.name)
+	if err != nil {
+		log.Logf("[rtun] %s -> %s : %s", conn.RemoteAddr(), h.name, err)
+		return
+	}
+	defer cc.Close()
+
+	log.Logf("[rtun] %s <-> %s", conn.RemoteAddr(), h.name)
+	transport(conn, cc)
+	log.Logf("[rtun] %s >-< %s", conn.RemoteAddr(), h.name)
+}
@@ -0,0 +1,78 @@
+package gost
+
+import (
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReverseTunnel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go serveReverseTunnel(ln)
+	defer ln.Close()
+
+	backend := httptest.NewServer(httpTestHandler)
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	// the registrations of the package are kept by the previous runs.
+	name := fmt.Sprintf("web-%d", time.Now().UnixNano())
+	services := map[string]string{name: u.Host}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ReverseTunnelClient(addr, services)
+	}()
+
+	// wait for the registration.
+	for i := 0; ; i++ {
+		conn, err := ReverseTunnelDial(name)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-errc:
+			t.Fatal(err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ReverseTunnelClient(addr, services); err == nil {
+		t.Error("the registered name is registered again")
+	}
+	if _, err := ReverseTunnelDial("unknown"); err != ErrReverseTunnelNotFound {
+		t.Errorf("got %v, want %v", err, ErrReverseTunnelNotFound)
+	}
+
+	// the public server exposes the service.
+	pln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: pln, Handler: ReverseTunnelHandler(name)}
+	go server.Run()
+	defer server.Close()
+
+	sendData := make([]byte, 128)
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", pln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = httpRoundtrip(conn, backend.URL, sendData)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
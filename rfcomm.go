@@ -0,0 +1,61 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	// the channel is the port of the node address, e.g. socks5+rfcomm://:3?mac=00:11:22:AA:BB:CC
+	DefaultRegistry.RegisterTransport("rfcomm", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			_, channel, _ := net.SplitHostPort(node.Addr)
+			return RFCOMMTransporter(node.Get("mac"), channel), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			_, channel, err := net.SplitHostPort(node.Addr)
+			if err != nil {
+				return nil, err
+			}
+			return RFCOMMListener(channel)
+		},
+	})
+}
+
+var errRFCOMMNoRemote = errors.New("rfcomm: the MAC address of the remote device is required")
+
+// RFCOMMAddr is the address of the Bluetooth RFCOMM connection.
+type RFCOMMAddr struct {
+	MAC     net.HardwareAddr
+	Channel uint8
+}
+
+// Network returns "rfcomm".
+func (addr *RFCOMMAddr) Network() string {
+	return "rfcomm"
+}
+
+// String returns the Bluetooth MAC address in the upper case, such as 00:11:22:AA:BB:CC.
+func (addr *RFCOMMAddr) String() string {
+	return strings.ToUpper(addr.MAC.String())
+}
+
+// parseRFCOMMAddr parses the Bluetooth MAC address (empty for any local adapter) and the RFCOMM channel (1-30).
+func parseRFCOMMAddr(mac, channel string) (*RFCOMMAddr, error) {
+	ch, err := strconv.ParseUint(channel, 10, 8)
+	if err != nil || ch < 1 || ch > 30 {
+		return nil, fmt.Errorf("rfcomm: invalid channel %q, should be 1-30", channel)
+	}
+	addr := &RFCOMMAddr{MAC: make(net.HardwareAddr, 6), Channel: uint8(ch)}
+	if mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil || len(hw) != 6 {
+			return nil, fmt.Errorf("rfcomm: invalid MAC address %q", mac)
+		}
+		addr.MAC = hw
+	}
+	return addr, nil
+}
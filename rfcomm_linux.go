@@ -0,0 +1,215 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// bdaddr converts the MAC address to the Bluetooth device address, which is in the little-endian byte order.
+func bdaddr(mac net.HardwareAddr) (addr [6]uint8) {
+	for i := range addr {
+		addr[i] = mac[5-i]
+	}
+	return
+}
+
+func bdaddrToMAC(addr [6]uint8) net.HardwareAddr {
+	mac := make(net.HardwareAddr, 6)
+	for i := range mac {
+		mac[i] = addr[5-i]
+	}
+	return mac
+}
+
+func rfcommSocket() (int, *os.File, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.BTPROTO_RFCOMM)
+	if err != nil {
+		return -1, nil, os.NewSyscallError("socket", err)
+	}
+	// the non-blocking file is added to the runtime poller, so the deadlines work.
+	return fd, os.NewFile(uintptr(fd), "rfcomm"), nil
+}
+
+// rfcommConn is the RFCOMM stream socket, net.FileConn does not support the AF_BLUETOOTH sockets.
+type rfcommConn struct {
+	*os.File
+	laddr *RFCOMMAddr
+	raddr *RFCOMMAddr
+}
+
+func (c *rfcommConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+// RemoteAddr returns the *RFCOMMAddr of the peer, its String is the MAC address of the peer device.
+func (c *rfcommConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+type rfcommTransporter struct {
+	remoteMAC string
+	channel   string
+}
+
+// RFCOMMTransporter creates a Transporter that connects to the RFCOMM channel (1-30) of the paired Bluetooth device remoteMAC,
+// such as 00:11:22:AA:BB:CC. The Dial address is ignored and the chain is not used.
+func RFCOMMTransporter(remoteMAC, channel string) Transporter {
+	return &rfcommTransporter{
+		remoteMAC: remoteMAC,
+		channel:   channel,
+	}
+}
+
+func (tr *rfcommTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+
+	if tr.remoteMAC == "" {
+		return nil, errRFCOMMNoRemote
+	}
+	raddr, err := parseRFCOMMAddr(tr.remoteMAC, tr.channel)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, f, err := rfcommSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err := rfcommConnect(fd, f, &unix.SockaddrRFCOMM{Addr: bdaddr(raddr.MAC), Channel: raddr.Channel}, timeout); err != nil {
+		f.Close()
+		return nil, &net.OpError{Op: "dial", Net: "rfcomm", Addr: raddr, Err: err}
+	}
+
+	laddr := &RFCOMMAddr{MAC: make(net.HardwareAddr, 6), Channel: raddr.Channel}
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if sa, ok := sa.(*unix.SockaddrRFCOMM); ok {
+			laddr.MAC = bdaddrToMAC(sa.Addr)
+		}
+	}
+	return &rfcommConn{File: f, laddr: laddr, raddr: raddr}, nil
+}
+
+// rfcommConnect connects the non-blocking socket, it waits for the connection until the timeout.
+func rfcommConnect(fd int, f *os.File, sa unix.Sockaddr, timeout time.Duration) error {
+	err := unix.Connect(fd, sa)
+	if err == nil {
+		return nil
+	}
+	if err != unix.EINPROGRESS {
+		return os.NewSyscallError("connect", err)
+	}
+
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	f.SetWriteDeadline(time.Now().Add(timeout))
+	defer f.SetWriteDeadline(time.Time{})
+
+	var serr error
+	started := false
+	if err := rc.Write(func(fd uintptr) bool {
+		// the socket is writable when the connection is done.
+		if !started {
+			started = true
+			return false
+		}
+		var n int
+		if n, serr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR); serr == nil && n != 0 {
+			serr = os.NewSyscallError("connect", syscall.Errno(n))
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func (tr *rfcommTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *rfcommTransporter) Multiplex() bool {
+	return false
+}
+
+type rfcommListener struct {
+	f    *os.File
+	rc   syscall.RawConn
+	addr *RFCOMMAddr
+}
+
+// RFCOMMListener creates a Listener on the RFCOMM channel (1-30) of the local Bluetooth adapters.
+func RFCOMMListener(channel string) (Listener, error) {
+	laddr, err := parseRFCOMMAddr("", channel)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, f, err := rfcommSocket()
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrRFCOMM{Channel: laddr.Channel}); err != nil {
+		f.Close()
+		return nil, os.NewSyscallError("bind", err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		f.Close()
+		return nil, os.NewSyscallError("listen", err)
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rfcommListener{f: f, rc: rc, addr: laddr}, nil
+}
+
+func (l *rfcommListener) Accept() (net.Conn, error) {
+	var nfd int
+	var sa unix.Sockaddr
+	var aerr error
+	if err := l.rc.Read(func(fd uintptr) bool {
+		nfd, sa, aerr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		return aerr != unix.EAGAIN
+	}); err != nil {
+		return nil, err
+	}
+	if aerr != nil {
+		return nil, os.NewSyscallError("accept", aerr)
+	}
+
+	raddr := &RFCOMMAddr{MAC: make(net.HardwareAddr, 6), Channel: l.addr.Channel}
+	if sa, ok := sa.(*unix.SockaddrRFCOMM); ok {
+		raddr.MAC = bdaddrToMAC(sa.Addr)
+		raddr.Channel = sa.Channel
+	}
+	return &rfcommConn{
+		File:  os.NewFile(uintptr(nfd), "rfcomm"),
+		laddr: l.addr,
+		raddr: raddr,
+	}, nil
+}
+
+func (l *rfcommListener) Close() error {
+	return l.f.Close()
+}
+
+func (l *rfcommListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,33 @@
+package gost
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestBDAddr(t *testing.T) {
+	mac, _ := net.ParseMAC("CC:BB:AA:33:22:11")
+	addr := bdaddr(mac)
+	if addr != [6]uint8{0x11, 0x22, 0x33, 0xaa, 0xbb, 0xcc} {
+		t.Errorf("got %x, want little-endian", addr)
+	}
+	if !bytes.Equal(bdaddrToMAC(addr), mac) {
+		t.Errorf("got %s, want %s", bdaddrToMAC(addr), mac)
+	}
+}
+
+func TestRFCOMMTransporterInvalid(t *testing.T) {
+	for _, tr := range []Transporter{
+		RFCOMMTransporter("", "1"),
+		RFCOMMTransporter("00:11:22:AA:BB:CC", "0"),
+		RFCOMMTransporter("invalid", "1"),
+	} {
+		if _, err := tr.Dial(""); err == nil {
+			t.Error("should not dial with the invalid address")
+		}
+	}
+	if _, err := RFCOMMListener("31"); err == nil {
+		t.Error("should not listen on the invalid channel")
+	}
+}
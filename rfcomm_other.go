@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+package gost
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrRFCOMMUnsupported is returned when RFCOMMTransporter or RFCOMMListener is used on the platform other than Linux.
+var ErrRFCOMMUnsupported = errors.New("rfcomm is only supported on Linux")
+
+// RFCOMMTransporter is only supported on Linux,
+// the returned Transporter always fails with ErrRFCOMMUnsupported.
+func RFCOMMTransporter(remoteMAC, channel string) Transporter {
+	return &rfcommTransporter{}
+}
+
+// RFCOMMListener is only supported on Linux, it always returns ErrRFCOMMUnsupported.
+func RFCOMMListener(channel string) (Listener, error) {
+	return nil, ErrRFCOMMUnsupported
+}
+
+type rfcommTransporter struct{}
+
+func (tr *rfcommTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	return nil, ErrRFCOMMUnsupported
+}
+
+func (tr *rfcommTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return nil, ErrRFCOMMUnsupported
+}
+
+func (tr *rfcommTransporter) Multiplex() bool {
+	return false
+}
@@ -0,0 +1,33 @@
+package gost
+
+import "testing"
+
+func TestParseRFCOMMAddr(t *testing.T) {
+	tests := []struct {
+		mac, channel string
+		want         string
+		ok           bool
+	}{
+		{"00:11:22:aa:bb:cc", "1", "00:11:22:AA:BB:CC", true},
+		{"00-11-22-AA-BB-CC", "30", "00:11:22:AA:BB:CC", true},
+		{"", "3", "00:00:00:00:00:00", true},
+		{"00:11:22:aa:bb:cc", "0", "", false},
+		{"00:11:22:aa:bb:cc", "31", "", false},
+		{"00:11:22:aa:bb:cc", "x", "", false},
+		{"00:11:22:aa:bb", "1", "", false},
+		{"00:00:5e:00:53:00:00:01", "1", "", false},
+	}
+	for _, tc := range tests {
+		addr, err := parseRFCOMMAddr(tc.mac, tc.channel)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s/%s: got error %v", tc.mac, tc.channel, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if addr.String() != tc.want || addr.Network() != "rfcomm" {
+			t.Errorf("%s/%s: got %s %s, want %s", tc.mac, tc.channel, addr.Network(), addr, tc.want)
+		}
+	}
+}
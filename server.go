@@ -1,8 +1,10 @@
 package gost
 
 import (
+	"context"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/go-log/log"
@@ -18,6 +20,12 @@ type Server struct {
 	Listener Listener
 	Handler  Handler
 	options  *ServerOptions
+	conns    sync.WaitGroup // the connections being handled
+	connMux  sync.Mutex
+	closed   bool // no connection is handled after Shutdown
+
+	mux     sync.Mutex
+	servers map[string]*configServer // the servers of the config run by Reload
 }
 
 // Init intializes server with given options.
@@ -30,14 +38,84 @@ func (s *Server) Init(opts ...ServerOption) {
 	}
 }
 
-// Addr returns the address of the server
+// Addr returns the address of the server, it is nil if the server only runs the servers of a config.
 func (s *Server) Addr() net.Addr {
+	if s.Listener == nil {
+		return nil
+	}
 	return s.Listener.Addr()
 }
 
-// Close closes the server
+// Close closes the server, and the servers of the config run by Reload.
 func (s *Server) Close() error {
-	return s.Listener.Close()
+	var err error
+	for _, cs := range s.resetServers() {
+		if e := cs.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if s.Listener != nil {
+		if e := s.Listener.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Shutdown closes the server and waits for the connections being handled to finish,
+// it returns the context error if the context is done before that.
+// The servers of the config run by Reload are shut down in the same way.
+func (s *Server) Shutdown(ctx context.Context) error {
+	errc := make(chan error, 1)
+	servers := s.resetServers()
+	go func() {
+		errc <- shutdownServers(ctx, servers...)
+	}()
+
+	err := s.Close()
+
+	// the connections accepted before the listener is closed are not added after Wait.
+	s.connMux.Lock()
+	s.closed = true
+	s.connMux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if e := <-errc; e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// GracefulShutdown shuts down the servers, and waits for their connections to finish until the timeout.
+func GracefulShutdown(timeout time.Duration, servers ...*Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return shutdownServers(ctx, servers...)
+}
+
+func shutdownServers(ctx context.Context, servers ...*Server) error {
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *Server) {
+			errc <- s.Shutdown(ctx)
+		}(s)
+	}
+	var err error
+	for range servers {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 // Serve serves as a proxy server.
@@ -81,7 +159,18 @@ func (s *Server) Serve(h Handler, opts ...ServerOption) error {
 		}
 		tempDelay = 0
 
-		go h.Handle(conn)
+		s.connMux.Lock()
+		if s.closed {
+			s.connMux.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		s.conns.Add(1)
+		s.connMux.Unlock()
+		go func() {
+			defer s.conns.Done()
+			h.Handle(conn)
+		}()
 	}
 }
 
@@ -119,7 +208,19 @@ func transport(rw1, rw2 io.ReadWriter) error {
 	return nil
 }
 
+// readerFromFirst is implemented by the writers whose io.ReaderFrom must be used
+// even if the source implements io.WriterTo, which io.Copy prefers.
+type readerFromFirst interface {
+	io.ReaderFrom
+	readFromFirst()
+}
+
 func copyBuffer(dst io.Writer, src io.Reader) error {
+	if rf, ok := dst.(readerFromFirst); ok {
+		_, err := rf.ReadFrom(src)
+		return err
+	}
+
 	buf := lPool.Get().([]byte)
 	defer lPool.Put(buf)
 
@@ -0,0 +1,140 @@
+package gost
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// sessionTestServer accepts the TLS connections and sends a byte, so the client receives the session ticket.
+func sessionTestServer(t testing.TB) string {
+	ln, err := TLSListener("127.0.0.1:0", DefaultTLSConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte{1})
+				conn.Read(make([]byte, 1))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// sessionTestHandshake connects to the server with the transporter, and reports whether the session is resumed.
+func sessionTestHandshake(t testing.TB, tr Transporter, addr string) (bool, time.Duration) {
+	conn, err := tr.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	cc, err := tr.Handshake(conn, AddrHandshakeOption(addr), TLSConfigHandshakeOption(&tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "localhost",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := time.Since(start)
+	if _, err := cc.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	return cc.(*tls.Conn).ConnectionState().DidResume, d
+}
+
+func TestTLSSessionCache(t *testing.T) {
+	addr := sessionTestServer(t)
+	tr := TLSTransporter(WithTLSSessionCache(LRUSessionCache(8)))
+
+	if resumed, _ := sessionTestHandshake(t, tr, addr); resumed {
+		t.Error("the first session should not be resumed")
+	}
+	if resumed, _ := sessionTestHandshake(t, tr, addr); !resumed {
+		t.Error("the session should be resumed")
+	}
+
+	if resumed, _ := sessionTestHandshake(t, TLSTransporter(), addr); resumed {
+		t.Error("the session should not be resumed without the cache")
+	}
+}
+
+func TestTLSSessionCacheFile(t *testing.T) {
+	addr := sessionTestServer(t)
+	path := filepath.Join(t.TempDir(), "sessions")
+	key := []byte("secret")
+
+	tr := TLSTransporter(WithTLSSessionCache(LRUSessionCache(8, SessionCacheFileOption(path), SessionCacheKeyOption(key))))
+	sessionTestHandshake(t, tr, addr)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new cache loaded from the file, as the program is restarted.
+	tr = TLSTransporter(WithTLSSessionCache(LRUSessionCache(8, SessionCacheFileOption(path), SessionCacheKeyOption(key))))
+	if resumed, _ := sessionTestHandshake(t, tr, addr); !resumed {
+		t.Error("the session should be resumed from the file")
+	}
+
+	// the file can not be decrypted with another key.
+	tr = TLSTransporter(WithTLSSessionCache(LRUSessionCache(8, SessionCacheFileOption(path), SessionCacheKeyOption([]byte("other")))))
+	if resumed, _ := sessionTestHandshake(t, tr, addr); resumed {
+		t.Error("the session should not be resumed with a wrong key")
+	}
+}
+
+func TestLRUSessionCacheEvict(t *testing.T) {
+	c := LRUSessionCache(2)
+	cs := &tls.ClientSessionState{}
+	c.Put("a", cs)
+	c.Put("b", cs)
+	c.Get("a")
+	c.Put("c", cs)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("the least recently used session should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("session %s not found", key)
+		}
+	}
+	c.Put("a", nil)
+	if _, ok := c.Get("a"); ok {
+		t.Error("the session should be removed")
+	}
+}
+
+func BenchmarkTLSSessionCache(b *testing.B) {
+	for _, bm := range []struct {
+		name  string
+		cache tls.ClientSessionCache
+	}{
+		{"full", nil},
+		{"resumed", LRUSessionCache(8)},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			addr := sessionTestServer(b)
+			tr := TLSTransporter(WithTLSSessionCache(bm.cache))
+			sessionTestHandshake(b, tr, addr)
+
+			var total time.Duration
+			for i := 0; i < b.N; i++ {
+				_, d := sessionTestHandshake(b, tr, addr)
+				total += d
+			}
+			b.ReportMetric(float64(total.Microseconds())/float64(b.N), "us/handshake")
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ssAEADSpec is an AEAD cipher of the Shadowsocks specification (SIP004).
+type ssAEADSpec struct {
+	method  string
+	keySize int
+	new     func(key []byte) (cipher.AEAD, error)
+}
+
+var ssAEADSpecs = []ssAEADSpec{
+	{"aes-128-gcm", 16, newAESGCM},
+	{"aes-256-gcm", 32, newAESGCM},
+	{"chacha20-ietf-poly1305", 32, chacha20poly1305.New},
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// key derives the master key from the password by EVP_BytesToKey with MD5.
+func (s ssAEADSpec) key(password string) []byte {
+	var key, prev []byte
+	for len(key) < s.keySize {
+		h := md5.New()
+		h.Write(prev)
+		h.Write([]byte(password))
+		prev = h.Sum(nil)
+		key = append(key, prev...)
+	}
+	return key[:s.keySize]
+}
+
+// aead creates the AEAD with the session subkey derived by HKDF-SHA1 from the master key and the salt.
+func (s ssAEADSpec) aead(t *testing.T, password string, salt []byte) cipher.AEAD {
+	subkey := make([]byte, s.keySize)
+	if _, err := io.ReadFull(hkdf.New(sha1.New, s.key(password), salt, []byte("ss-subkey")), subkey); err != nil {
+		t.Fatal(err)
+	}
+	aead, err := s.new(subkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+// sealStream encrypts the writes as the TCP stream: the salt, followed by the chunks of
+// [encrypted payload length][length tag][encrypted payload][payload tag], with the little-endian nonce
+// incremented after each encryption. The payload of a chunk is at most 0x3FFF bytes.
+func (s ssAEADSpec) sealStream(t *testing.T, password string, salt []byte, writes ...[]byte) []byte {
+	aead := s.aead(t, password, salt)
+	nonce := make([]byte, aead.NonceSize())
+	increment := func() {
+		for i := range nonce {
+			nonce[i]++
+			if nonce[i] != 0 {
+				return
+			}
+		}
+	}
+
+	out := append([]byte(nil), salt...)
+	for _, b := range writes {
+		for len(b) > 0 {
+			payload := b
+			if len(payload) > 0x3FFF {
+				payload = payload[:0x3FFF]
+			}
+			b = b[len(payload):]
+			out = aead.Seal(out, nonce, []byte{byte(len(payload) >> 8), byte(len(payload))}, nil)
+			increment()
+			out = aead.Seal(out, nonce, payload, nil)
+			increment()
+		}
+	}
+	return out
+}
+
+// sealPacket encrypts the UDP packet: the salt, followed by the encrypted payload with the zero nonce.
+func (s ssAEADSpec) sealPacket(t *testing.T, password string, salt, payload []byte) []byte {
+	aead := s.aead(t, password, salt)
+	return aead.Seal(append([]byte(nil), salt...), make([]byte, aead.NonceSize()), payload, nil)
+}
+
+// packetWriteRecorder records the packets written to the connection.
+type packetWriteRecorder struct {
+	net.PacketConn
+	packets [][]byte
+}
+
+func (c *packetWriteRecorder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.packets = append(c.packets, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// ssConformanceVectors are the ciphertexts of the plaintext "hello, shadowsocks" with the password "gost"
+// and the salt 0x00, 0x01, 0x02..., the stream is [salt][encrypted length][encrypted payload].
+//
+// The vectors are generated by the independent implementation of Xray-core v1.260327.0
+// (github.com/xtls/xray-core/proxy/shadowsocks): the stream is the salt followed by the output of
+// AEADCipher.NewEncryptionWriter with the salt as the IV, the packet is AEADCipher.EncodePacket of the salt
+// and the plaintext, with the key of Account{Password: "gost"}.AsAccount().
+var ssConformanceVectors = map[string]struct {
+	stream, packet string
+}{
+	"aes-128-gcm": {
+		stream: "000102030405060708090a0b0c0d0e0f" +
+			"69bb4eacb7cf3942734c375b346be6d14221" +
+			"fe2c2bca109b37726fd34e81ef23d42b8a3abadaf3f83fa22884595584b15473f7ef",
+		packet: "000102030405060708090a0b0c0d0e0f" +
+			"01cc459b0a7ad973aca360673af7b2c10bfdfce0be8efb1e53340d3d0d3dc07b3192",
+	},
+	"aes-256-gcm": {
+		stream: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+			"f8efc49dbabb45c360aeb192b8e4415bf747" +
+			"3357902879e2dfb07609e7bb792f1a73824d24a848cbdf301c9fa1b27c583957998b",
+		packet: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+			"9098821bf3b172c5aab9d3f49cacb8a5c59e3fcea4c18aa235cbbcf2d80c72425f95",
+	},
+	"chacha20-ietf-poly1305": {
+		stream: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+			"12aca9d95a50bef0dec2918532a5a1e99744" +
+			"1498a3b70905798993ff8fd6ed394e783a33d2e4e41e1a09567edc4fa43d3f7bd1d6",
+		packet: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+			"7adbb4357f93a3064cd5e19fcf0e1ad0de00364455ab9182d9ba21efce8574f428c7",
+	},
+}
+
+func TestShadowsocksAEADConformance(t *testing.T) {
+	const password = "gost"
+	plaintext := []byte("hello, shadowsocks")
+
+	for _, spec := range ssAEADSpecs {
+		t.Run(spec.method, func(t *testing.T) {
+			ciph := initShadowCipher(url.UserPassword(spec.method, password))
+			if ciph == nil {
+				t.Fatal("the cipher is not supported")
+			}
+			salt := make([]byte, spec.keySize)
+			for i := range salt {
+				salt[i] = byte(i)
+			}
+			vector := ssConformanceVectors[spec.method]
+
+			// the specification helpers match the vectors.
+			if got := hex.EncodeToString(spec.sealStream(t, password, salt, plaintext)); got != vector.stream {
+				t.Errorf("stream %s, want %s", got, vector.stream)
+			}
+			if got := hex.EncodeToString(spec.sealPacket(t, password, salt, plaintext)); got != vector.packet {
+				t.Errorf("packet %s, want %s", got, vector.packet)
+			}
+
+			// the stream encrypted by gost, the chunks of the large write test the nonce increment.
+			writes := [][]byte{plaintext, bytes.Repeat([]byte("gost"), 10000), plaintext}
+			var buf bytes.Buffer
+			conn := ciph.StreamConn(&writeRecorder{Conn: newFuzzConn(nil), w: &buf})
+			for _, b := range writes {
+				if _, err := conn.Write(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := buf.Bytes()
+			if len(got) < spec.keySize {
+				t.Fatalf("the stream is too short: %d bytes", len(got))
+			}
+			if want := spec.sealStream(t, password, got[:spec.keySize], writes...); !bytes.Equal(got, want) {
+				t.Errorf("the stream of %d bytes does not match the specification of %d bytes", len(got), len(want))
+			}
+
+			// the packet encrypted by gost.
+			rec := &packetWriteRecorder{}
+			if _, err := ciph.PacketConn(rec).WriteTo(plaintext, &net.UDPAddr{}); err != nil {
+				t.Fatal(err)
+			}
+			if len(rec.packets) != 1 || len(rec.packets[0]) < spec.keySize {
+				t.Fatalf("unexpected packets %x", rec.packets)
+			}
+			if want := spec.sealPacket(t, password, rec.packets[0][:spec.keySize], plaintext); !bytes.Equal(rec.packets[0], want) {
+				t.Errorf("packet %x, want %x", rec.packets[0], want)
+			}
+
+			// the stream of the vector is decrypted by gost.
+			b, _ := hex.DecodeString(vector.stream)
+			data, err := io.ReadAll(ciph.StreamConn(newFuzzConn(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, plaintext) {
+				t.Errorf("got %q, want %q", data, plaintext)
+			}
+			// the tampered stream is rejected.
+			b[len(b)-1] ^= 1
+			if _, err := io.ReadAll(ciph.StreamConn(newFuzzConn(b))); err == nil {
+				t.Error("the tampered stream should be rejected")
+			}
+		})
+	}
+}
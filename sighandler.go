@@ -0,0 +1,77 @@
+package gost
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/go-log/log"
+)
+
+type signalHandler struct {
+	ch        chan os.Signal
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// SignalHandler starts a goroutine listening on the signals, the action of the signal is called
+// when it is received. The returned io.Closer stops the listening.
+func SignalHandler(signals []os.Signal, actions map[os.Signal]func() error) (io.Closer, error) {
+	if len(signals) == 0 {
+		return nil, errors.New("signal: no signals")
+	}
+	for _, sig := range signals {
+		if actions[sig] == nil {
+			return nil, errors.New("signal: no action for " + sig.String())
+		}
+	}
+
+	h := &signalHandler{
+		ch:   make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+	signal.Notify(h.ch, signals...)
+	go func() {
+		for {
+			select {
+			case sig := <-h.ch:
+				log.Logf("[signal] %s received", sig)
+				if err := actions[sig](); err != nil {
+					log.Logf("[signal] %s: %v", sig, err)
+				}
+			case <-h.done:
+				return
+			}
+		}
+	}()
+	return h, nil
+}
+
+func (h *signalHandler) Close() error {
+	h.closeOnce.Do(func() {
+		signal.Stop(h.ch)
+		close(h.done)
+	})
+	return nil
+}
+
+// DefaultSignalActions returns the actions of the signals: SIGHUP calls reload and SIGUSR1 calls ReopenLogFile
+// on Unix, SIGINT and SIGTERM call shutdown, e.g. a function calling GracefulShutdown.
+// The signals are the keys of the actions.
+// SIGUSR1 is shared with the SNMP log of KCP (KCPConfig.Signal), both are done on the signal.
+func DefaultSignalActions(reload, shutdown func() error) ([]os.Signal, map[os.Signal]func() error) {
+	actions := map[os.Signal]func() error{
+		os.Interrupt:    shutdown,
+		syscall.SIGTERM: shutdown,
+	}
+	unixSignalActions(actions, reload)
+
+	signals := make([]os.Signal, 0, len(actions))
+	for sig := range actions {
+		signals = append(signals, sig)
+	}
+	return signals, actions
+}
@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package gost
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalHandler(t *testing.T) {
+	if _, err := SignalHandler(nil, nil); err == nil {
+		t.Error("should fail with no signals")
+	}
+	if _, err := SignalHandler([]os.Signal{syscall.SIGUSR2}, nil); err == nil {
+		t.Error("should fail with no action")
+	}
+
+	called := make(chan struct{}, 1)
+	h, err := SignalHandler([]os.Signal{syscall.SIGUSR2}, map[os.Signal]func() error{
+		syscall.SIGUSR2: func() error {
+			called <- struct{}{}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+	case <-time.After(3 * time.Second):
+		t.Fatal("action is not called")
+	}
+	if err := h.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDefaultSignalActions(t *testing.T) {
+	signals, actions := DefaultSignalActions(func() error { return nil }, func() error { return nil })
+	for _, sig := range []os.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM} {
+		if actions[sig] == nil {
+			t.Errorf("no action for %s", sig)
+		}
+	}
+	if len(signals) != len(actions) {
+		t.Errorf("signals %d, actions %d", len(signals), len(actions))
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(UsersHandlerOption(url.UserPassword("admin", "123456"))),
+	}
+	go server.Run()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wait for the connection to be accepted.
+	time.Sleep(100 * time.Millisecond)
+
+	// the idle connection is being handled.
+	if err := GracefulShutdown(100*time.Millisecond, server); err != context.DeadlineExceeded {
+		t.Errorf("should time out with the connection being handled, got %v", err)
+	}
+
+	conn.Close()
+	// the listener is closed already.
+	if err := GracefulShutdown(3*time.Second, server); err == context.DeadlineExceeded {
+		t.Error(err)
+	}
+}
@@ -3,4 +3,8 @@
 
 package gost
 
+import "os"
+
 func kcpSigHandler() {}
+
+func unixSignalActions(actions map[os.Signal]func() error, reload func() error) {}
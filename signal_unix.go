@@ -23,3 +23,8 @@ func kcpSigHandler() {
 		}
 	}
 }
+
+func unixSignalActions(actions map[os.Signal]func() error, reload func() error) {
+	actions[syscall.SIGHUP] = reload
+	actions[syscall.SIGUSR1] = ReopenLogFile
+}
@@ -22,6 +22,17 @@ import (
 	"github.com/go-log/log"
 )
 
+func init() {
+	DefaultRegistry.RegisterProtocol("sni", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SNIConnector(node.Get("host"))
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return SNIHandler(), nil
+		},
+	})
+}
+
 type sniConnector struct {
 	host string
 }
@@ -0,0 +1,49 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestTCPTransporterFWMark(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := TCPTransporter().Dial(ln.Addr().String(), WithFWMark(100))
+	if err != nil {
+		// without CAP_NET_ADMIN, the dial must fail rather than going out unmarked.
+		if errors.Is(err, syscall.EPERM) {
+			t.Skip("SO_MARK is not permitted, CAP_NET_ADMIN is required")
+		}
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rc, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mark int
+	var serr error
+	rc.Control(func(fd uintptr) {
+		mark, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK)
+	})
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if mark != 100 {
+		t.Errorf("mark %d, want %d", mark, 100)
+	}
+}
@@ -20,6 +20,33 @@ import (
 	smux "github.com/xtaci/smux"
 )
 
+func init() {
+	DefaultRegistry.RegisterProtocol("socks5", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SOCKS5Connector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return SOCKS5Handler(), nil
+		},
+	}, "socks")
+	DefaultRegistry.RegisterProtocol("socks4", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SOCKS4Connector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return SOCKS4Handler(), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("socks4a", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SOCKS4AConnector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return SOCKS4Handler(), nil
+		},
+	})
+}
+
 const (
 	// MethodTLS is an extended SOCKS5 method with tls encryption support.
 	MethodTLS uint8 = 0x80
@@ -112,6 +139,7 @@ type serverSelector struct {
 	// Users     []*url.Userinfo
 	Authenticator Authenticator
 	TLSConfig     *tls.Config
+	TimeACL       *TimeACL
 }
 
 func (selector *serverSelector) Methods() []uint8 {
@@ -152,12 +180,20 @@ func (selector *serverSelector) OnSelected(method uint8, conn net.Conn) (net.Con
 		log.Logf("[socks5] %d %d", gosocks5.Ver5, method)
 	}
 	switch method {
-	case MethodTLS:
-		conn = tls.Server(conn, selector.TLSConfig)
+	case gosocks5.MethodNoAuth, MethodTLS:
+		if !selector.TimeACL.Allow("", time.Now()) {
+			log.Logf("[socks5] %s - %s: anonymous user is not allowed at this time",
+				conn.RemoteAddr(), conn.LocalAddr())
+			return nil, gosocks5.ErrAuthFailure
+		}
+		if method == MethodTLS {
+			conn = observeSOCKS5TLS(conn, tls.Server(conn, selector.TLSConfig), method)
+		}
 
 	case gosocks5.MethodUserPass, MethodTLSAuth:
+		rawConn := conn
 		if method == MethodTLSAuth {
-			conn = tls.Server(conn, selector.TLSConfig)
+			conn = observeSOCKS5TLS(conn, tls.Server(conn, selector.TLSConfig), method)
 		}
 
 		req, err := gosocks5.ReadUserPassRequest(conn)
@@ -182,6 +218,27 @@ func (selector *serverSelector) OnSelected(method uint8, conn net.Conn) (net.Con
 			return nil, gosocks5.ErrAuthFailure
 		}
 
+		if !selector.TimeACL.Allow(req.Username, time.Now()) {
+			resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Failure)
+			if err := resp.Write(conn); err != nil {
+				log.Logf("[socks5] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+				return nil, err
+			}
+			log.Logf("[socks5] %s - %s: user '%s' is not allowed at this time",
+				conn.RemoteAddr(), conn.LocalAddr(), req.Username)
+			return nil, gosocks5.ErrAuthFailure
+		}
+
+		// AccountingMiddleware can not see the user in the TLS connection.
+		if ac, ok := rawConn.(*accountingConn); ok && method == MethodTLSAuth && !ac.acceptUser(req.Username) {
+			resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Failure)
+			if err := resp.Write(conn); err != nil {
+				log.Logf("[socks5] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+				return nil, err
+			}
+			return nil, ErrQuotaExceeded
+		}
+
 		resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Succeeded)
 		if err := resp.Write(conn); err != nil {
 			log.Logf("[socks5] %s - %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err)
@@ -197,6 +254,15 @@ func (selector *serverSelector) OnSelected(method uint8, conn net.Conn) (net.Con
 	return conn, nil
 }
 
+// observeSOCKS5TLS passes the TLS connection of the method over the raw connection to the middleware
+// which sniffs the SOCKS5 negotiation, as it can not see the encrypted data.
+func observeSOCKS5TLS(raw, conn net.Conn, method uint8) net.Conn {
+	if ec, ok := raw.(*eventConn); ok {
+		return ec.observeTLS(conn, method)
+	}
+	return conn
+}
+
 type socks5Connector struct {
 	User *url.Userinfo
 }
@@ -836,6 +902,7 @@ func (h *socks5Handler) Init(options ...HandlerOption) {
 		// Users:     h.options.Users,
 		Authenticator: h.options.Authenticator,
 		TLSConfig:     tlsConfig,
+		TimeACL:       h.options.TimeACL,
 	}
 	// methods that socks5 server supported
 	h.selector.AddMethod(
@@ -889,6 +956,10 @@ func (h *socks5Handler) handleConnect(conn net.Conn, req *gosocks5.Request) {
 	log.Logf("[socks5] %s -> %s -> %s",
 		conn.RemoteAddr(), h.options.Node.String(), host)
 
+	// SOCKS5 carries no trace context, the span is a new root.
+	_, span := startProxySpan(h.options.TracerProvider, "socks5", conn, host, nil)
+	defer span.End()
+
 	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) {
 		log.Logf("[socks5] %s - %s : Unauthorized to tcp connect to %s",
 			conn.RemoteAddr(), conn.LocalAddr(), host)
@@ -939,6 +1010,7 @@ func (h *socks5Handler) handleConnect(conn net.Conn, req *gosocks5.Request) {
 		}
 		fmt.Fprintf(&buf, "%s", host)
 		log.Log("[route]", buf.String())
+		setSpanRoute(span, route)
 
 		cc, err = route.Dial(host,
 			TimeoutChainOption(h.options.Timeout),
@@ -953,6 +1025,7 @@ func (h *socks5Handler) handleConnect(conn net.Conn, req *gosocks5.Request) {
 	}
 
 	if err != nil {
+		setSpanError(span, err)
 		rep := gosocks5.NewReply(gosocks5.HostUnreachable, nil)
 		rep.Write(conn)
 		if Debug {
@@ -0,0 +1,83 @@
+package gost
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-gost/gosocks5"
+)
+
+// fuzzAuthenticator records whether a user is authenticated.
+type fuzzAuthenticator struct {
+	authenticated bool
+}
+
+func (a *fuzzAuthenticator) Authenticate(user, password string) bool {
+	if user == "alice" && password == "123456" {
+		a.authenticated = true
+	}
+	return a.authenticated
+}
+
+func socks5FuzzSeed(req []byte) []byte {
+	b := []byte{gosocks5.Ver5, 1, gosocks5.MethodUserPass}
+	b = append(b, gosocks5.UserPassVer, 5)
+	b = append(b, "alice"...)
+	b = append(b, 6)
+	b = append(b, "123456"...)
+	return append(b, req...)
+}
+
+func FuzzSOCKS5Request(f *testing.F) {
+	ipv4 := []byte{gosocks5.Ver5, gosocks5.CmdConnect, 0, gosocks5.AddrIPv4, 127, 0, 0, 1, 0, 80}
+	ipv6 := append([]byte{gosocks5.Ver5, gosocks5.CmdUdp, 0, gosocks5.AddrIPv6}, append(make([]byte, 15), 1, 0x01, 0xbb)...)
+	domain := append([]byte{gosocks5.Ver5, gosocks5.CmdBind, 0, gosocks5.AddrDomain, 11}, append([]byte("example.com"), 0x1f, 0x90)...)
+	for _, req := range [][]byte{
+		ipv4,
+		ipv6,
+		domain,
+		{4, gosocks5.CmdConnect, 0, gosocks5.AddrIPv4, 127, 0, 0, 1, 0, 80}, // wrong version
+		{gosocks5.Ver5, gosocks5.CmdConnect, 0, gosocks5.AddrIPv6, 0, 0},    // truncated address
+		{gosocks5.Ver5, gosocks5.CmdConnect, 0, gosocks5.AddrDomain, 255, 'a'},
+		{gosocks5.Ver5, gosocks5.CmdConnect, 0, gosocks5.AddrIPv4, 127, 0, 0, 1, 0xff, 0xff}, // the port is -1 as int16
+	} {
+		f.Add(req)
+		f.Add(socks5FuzzSeed(req))
+	}
+	f.Add([]byte{gosocks5.Ver5, 1, gosocks5.MethodNoAuth})
+	f.Add([]byte{gosocks5.Ver5, 1, MethodTLS, 0x16, 3, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if req, err := gosocks5.ReadRequest(bytes.NewReader(data)); err == nil {
+			if req.Addr == nil {
+				t.Fatal("nil address")
+			}
+			var buf bytes.Buffer
+			if err := req.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			req2, err := gosocks5.ReadRequest(&buf)
+			if err != nil {
+				t.Fatalf("the request %s can not be parsed after written: %v", req, err)
+			}
+			if req2.Cmd != req.Cmd || req2.Addr.Port != req.Addr.Port {
+				t.Fatalf("got %s, want %s", req2, req)
+			}
+		}
+
+		auth := &fuzzAuthenticator{}
+		selector := &serverSelector{
+			Authenticator: auth,
+			TLSConfig:     DefaultTLSConfig,
+		}
+		selector.AddMethod(gosocks5.MethodNoAuth, gosocks5.MethodUserPass, MethodTLS, MethodTLSAuth)
+		conn := gosocks5.ServerConn(newFuzzConn(data), selector)
+		if err := conn.Handleshake(); err != nil {
+			return
+		}
+		if !auth.authenticated {
+			t.Fatal("the handshake succeeds without authentication")
+		}
+		gosocks5.ReadRequest(conn)
+	})
+}
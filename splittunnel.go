@@ -0,0 +1,109 @@
+package gost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-log/log"
+)
+
+// Dialer connects to the address on the named network.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+type splitTunnelDialer struct {
+	cidrs   []*net.IPNet
+	chain   *Chain
+	direct  *net.Dialer
+	opts    []ChainOption
+	options ChainOptions
+}
+
+// SplitTunnelDialer creates a Dialer which connects to the destinations in proxyCIDRs through proxyChain,
+// and the others with directDialer. The domain names are resolved by the hosts and the resolver of the options
+// (HostsChainOption and ResolverChainOption) to check the destinations, which are also used by proxyChain.
+// The domain names are connected through proxyChain if they can not be resolved by them,
+// the system resolver is not used to avoid leaking the names.
+func SplitTunnelDialer(proxyCIDRs []*net.IPNet, proxyChain Chain, directDialer net.Dialer, opts ...ChainOption) Dialer {
+	d := &splitTunnelDialer{
+		cidrs:  proxyCIDRs,
+		chain:  &proxyChain,
+		direct: &directDialer,
+		opts:   opts,
+	}
+	for _, opt := range opts {
+		opt(&d.options)
+	}
+	return d
+}
+
+func (d *splitTunnelDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if splitTunnelProxied(d.cidrs, address, d.options.Resolver, d.options.Hosts) {
+		return d.chain.DialContext(ctx, network, address, d.opts...)
+	}
+	// the name is resolved by the hosts or the resolver.
+	return d.direct.DialContext(ctx, network, d.chain.resolve(address, d.options.Resolver, d.options.Hosts))
+}
+
+// ParseCIDRs parses the comma-separated list of CIDR ranges, e.g. '10.0.0.0/8,fd00::/8'.
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		_, inet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("split-tunnel: invalid CIDR %q", v)
+		}
+		cidrs = append(cidrs, inet)
+	}
+	return cidrs, nil
+}
+
+// splitTunnelProxied reports whether the host of the address is in the CIDR ranges,
+// the domain name is resolved by the hosts and the resolver, and it is in the ranges if any of its IP addresses is.
+// The domain name is in the ranges if it can not be resolved by them.
+func splitTunnelProxied(cidrs []*net.IPNet, address string, resolver Resolver, hosts *Hosts) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if host == "" {
+		return false
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else if ip := hosts.Lookup(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		err := errors.New("no resolver")
+		if resolver != nil {
+			if ips, err = resolver.Resolve(host); err == nil && len(ips) == 0 {
+				err = errors.New("no address")
+			}
+		}
+		if err != nil {
+			if Debug {
+				log.Logf("[split-tunnel] %s: %v, connect through the chain", host, err)
+			}
+			return true
+		}
+	}
+
+	for _, ip := range ips {
+		for _, inet := range cidrs {
+			if inet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
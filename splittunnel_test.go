@@ -0,0 +1,106 @@
+package gost
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type countHandler struct {
+	Handler
+	n int32
+}
+
+func (h *countHandler) Handle(conn net.Conn) {
+	atomic.AddInt32(&h.n, 1)
+	h.Handler.Handle(conn)
+}
+
+func TestSplitTunnelDialer(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(httpSrv.URL, "http://"))
+
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &countHandler{Handler: HTTPHandler()}
+	server := &Server{Listener: ln, Handler: h}
+	go server.Run()
+	defer server.Close()
+
+	chain := NewChain(Node{
+		Addr:      ln.Addr().String(),
+		Protocol:  "http",
+		Transport: "tcp",
+		Client:    &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()},
+	})
+
+	hosts := NewHosts(NewHost(net.ParseIP("127.0.0.1"), "direct.example"))
+	tests := []struct {
+		cidrs   string
+		host    string
+		proxied bool
+		ok      bool
+	}{
+		{"127.0.0.0/8", "127.0.0.1", true, true},
+		{"10.0.0.0/8,192.168.0.0/16", "127.0.0.1", false, true},
+		{"127.0.0.1/32", "localhost", true, true},
+		// the names not resolved by the hosts go through the chain.
+		{"10.0.0.0/8", "localhost", true, true},
+		{"10.0.0.0/8", "direct.example", false, true},
+		{"0.0.0.0/0", "nonexistent.invalid", true, false},
+	}
+	for i, tc := range tests {
+		cidrs, err := ParseCIDRs(tc.cidrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := atomic.LoadInt32(&h.n)
+
+		d := SplitTunnelDialer(cidrs, *chain, net.Dialer{}, HostsChainOption(hosts))
+		conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort(tc.host, port))
+		if err == nil {
+			err = httpRoundtrip(conn, httpSrv.URL, []byte("hello"))
+			conn.Close()
+		}
+		if tc.ok && err != nil {
+			t.Errorf("#%d: %v", i, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("#%d: should fail", i)
+		}
+		if proxied := atomic.LoadInt32(&h.n) > before; proxied != tc.proxied {
+			t.Errorf("#%d: proxied %v, want %v", i, proxied, tc.proxied)
+		}
+	}
+
+	// the split tunnel of the chain.
+	chain.SplitTunnel, _ = ParseCIDRs("10.0.0.0/8")
+	before := atomic.LoadInt32(&h.n)
+	conn, err := chain.Dial(net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if atomic.LoadInt32(&h.n) != before {
+		t.Error("the address out of the split tunnel should connect directly")
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	cidrs, err := ParseCIDRs("10.0.0.0/8, fd00::/8,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cidrs) != 2 || cidrs[0].String() != "10.0.0.0/8" || cidrs[1].String() != "fd00::/8" {
+		t.Errorf("cidrs %v", cidrs)
+	}
+	if _, err := ParseCIDRs("10.0.0.0/8,10.0.0.1"); err == nil {
+		t.Error("should fail with the invalid CIDR")
+	}
+}
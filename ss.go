@@ -3,11 +3,14 @@ package gost
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-gost/gosocks5"
@@ -16,6 +19,26 @@ import (
 	ss "github.com/shadowsocks/shadowsocks-go/shadowsocks"
 )
 
+func init() {
+	// as of 2.10.1, ss2 is same as ss
+	DefaultRegistry.RegisterProtocol("ss", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return ShadowConnector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return ShadowHandler(), nil
+		},
+	}, "ss2")
+	DefaultRegistry.RegisterProtocol("ssu", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return ShadowUDPConnector(node.User)
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return ShadowUDPHandler(), nil
+		},
+	})
+}
+
 const (
 	maxSocksAddrLen = 259
 )
@@ -609,6 +632,90 @@ func initShadowCipher(info *url.Userinfo) (cipher core.Cipher) {
 	return
 }
 
+// ParseShadowsocksURI parses the shadowsocks URI of the SIP002 format:
+//
+//	ss://BASE64URL(method:password)@hostname:port/?plugin=obfs-local%3Bobfs%3Dhttp#tag
+//
+// the userinfo can also be the percent-encoded method:password, as in the URIs of the 2022 ciphers.
+// The legacy format ss://BASE64(method:password@hostname:port)#tag is also accepted.
+// The cipher is set to the User of the node, the plugin and the tag are set to the Values as plugin and name.
+func ParseShadowsocksURI(uri string) (Node, error) {
+	s := strings.TrimSpace(uri)
+	if !strings.HasPrefix(s, "ss://") {
+		return Node{}, errors.New("ss: not a shadowsocks URI")
+	}
+	s = s[len("ss://"):]
+
+	var tag string
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		tag, _ = url.PathUnescape(s[i+1:])
+		s = s[:i]
+	}
+	// the path and query follow the host, the legacy base64 (without '@') may contain '/' but never '?'.
+	var rawQuery string
+	if at := strings.LastIndexByte(s, '@'); at >= 0 {
+		if i := strings.IndexAny(s[at:], "/?"); i >= 0 {
+			rawQuery = strings.TrimPrefix(strings.TrimPrefix(s[at+i:], "/"), "?")
+			s = s[:at+i]
+		}
+	} else if i := strings.IndexByte(s, '?'); i >= 0 {
+		rawQuery = s[i+1:]
+		s = s[:i]
+	}
+
+	var userinfo, host string
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		userinfo, host = s[:i], s[i+1:]
+		if b, err := decodeShadowsocksBase64(userinfo); err == nil && strings.Contains(string(b), ":") {
+			userinfo = string(b)
+		} else if userinfo, err = url.PathUnescape(userinfo); err != nil {
+			return Node{}, fmt.Errorf("ss: invalid userinfo: %v", err)
+		}
+	} else {
+		// the legacy format.
+		b, err := decodeShadowsocksBase64(s)
+		if err != nil {
+			return Node{}, fmt.Errorf("ss: invalid URI: %v", err)
+		}
+		i := strings.LastIndexByte(string(b), '@')
+		if i < 0 {
+			return Node{}, errors.New("ss: missing the host")
+		}
+		userinfo, host = string(b[:i]), string(b[i+1:])
+	}
+
+	method, password, ok := strings.Cut(userinfo, ":")
+	if !ok || method == "" || password == "" {
+		return Node{}, errors.New("ss: missing the method or password")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return Node{}, fmt.Errorf("ss: %v", err)
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Node{}, fmt.Errorf("ss: invalid query: %v", err)
+	}
+	if tag != "" {
+		values.Set("name", tag)
+	}
+	node, err := ParseNode("ss://" + host + "?" + values.Encode())
+	if err != nil {
+		return Node{}, err
+	}
+	node.User = url.UserPassword(method, password)
+	return node, nil
+}
+
+// decodeShadowsocksBase64 decodes the base64 of the URI, which may be URL-safe and unpadded.
+func decodeShadowsocksBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
 func readSocksAddr(r io.Reader) (*gosocks5.Addr, error) {
 	addr := &gosocks5.Addr{}
 	b := sPool.Get().([]byte)
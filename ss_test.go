@@ -3,6 +3,7 @@ package gost
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net/http/httptest"
 	"net/url"
@@ -565,3 +566,56 @@ func BenchmarkShadowUDP(b *testing.B) {
 		}
 	}
 }
+
+var shadowsocksURITests = []struct {
+	uri      string
+	addr     string
+	method   string
+	password string
+	plugin   string
+	name     string
+	hasError bool
+}{
+	{"ss://YWVzLTEyOC1nY206dGVzdA@192.168.100.1:8888#Example1",
+		"192.168.100.1:8888", "aes-128-gcm", "test", "", "Example1", false},
+	{"ss://cmM0LW1kNTpwYXNzd2Q@192.168.100.1:8888/?plugin=obfs-local%3Bobfs%3Dhttp#Example2",
+		"192.168.100.1:8888", "rc4-md5", "passwd", "obfs-local;obfs=http", "Example2", false},
+	{"ss://2022-blake3-aes-256-gcm:YctPZ6U7xPPcU%2Bgp3u%2BoDw%3D%3D@192.168.100.1:8888#Example3",
+		"192.168.100.1:8888", "2022-blake3-aes-256-gcm", "YctPZ6U7xPPcU+gp3u+oDw==", "", "Example3", false},
+	{"ss://YWVzLTEyOC1nY206dGVzdA@[2001:db8::1]:8388",
+		"[2001:db8::1]:8388", "aes-128-gcm", "test", "", "", false},
+	// the legacy format of aes-256-cfb:p@ss@1.2.3.4:8388.
+	{"ss://" + base64.StdEncoding.EncodeToString([]byte("aes-256-cfb:p@ss@1.2.3.4:8388")) + "#legacy",
+		"1.2.3.4:8388", "aes-256-cfb", "p@ss", "", "legacy", false},
+	// the legacy base64 of aes-128-gcm:???@1.2.3.4:8388 contains '/'.
+	{"ss://YWVzLTEyOC1nY206Pz8/QDEuMi4zLjQ6ODM4OA==",
+		"1.2.3.4:8388", "aes-128-gcm", "???", "", "", false},
+	{"ss://YWVzLTEyOC1nY20@192.168.100.1:8888", "", "", "", "", "", true},
+	{"ss://YWVzLTEyOC1nY206dGVzdA@192.168.100.1", "", "", "", "", "", true},
+	{"ss://!!!", "", "", "", "", "", true},
+	{"http://192.168.100.1:8888", "", "", "", "", "", true},
+}
+
+func TestParseShadowsocksURI(t *testing.T) {
+	for i, tc := range shadowsocksURITests {
+		node, err := ParseShadowsocksURI(tc.uri)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("#%d should failed", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d got error %v", i, err)
+			continue
+		}
+		password, _ := node.User.Password()
+		if node.Addr != tc.addr || node.Protocol != "ss" || node.Transport != "tcp" ||
+			node.User.Username() != tc.method || password != tc.password {
+			t.Errorf("#%d got %s %s+%s %s", i, node.Addr, node.Protocol, node.Transport, node.User)
+		}
+		if node.Values.Get("plugin") != tc.plugin || node.Values.Get("name") != tc.name {
+			t.Errorf("#%d got values %v", i, node.Values)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strconv"
@@ -17,6 +18,70 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("ssh", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			if node.Protocol == "direct" || node.Protocol == "remote" {
+				return SSHForwardTransporter(), nil
+			}
+			return SSHTunnelTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			if node.Protocol == "forward" {
+				return TCPListener(node.Addr)
+			}
+			config := &SSHConfig{
+				Authenticator: opts.Authenticator,
+				TLSConfig:     opts.TLSConfig,
+			}
+			if s := node.Get("ssh_key"); s != "" {
+				key, err := ParseSSHKeyFile(s)
+				if err != nil {
+					return nil, err
+				}
+				config.Key = key
+			}
+			if s := node.Get("ssh_authorized_keys"); s != "" {
+				keys, err := ParseSSHAuthorizedKeysFile(s)
+				if err != nil {
+					return nil, err
+				}
+				config.AuthorizedKeys = keys
+			}
+			return SSHTunnelListener(node.Addr, config)
+		},
+	})
+	DefaultRegistry.RegisterProtocol("direct", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SSHDirectForwardConnector()
+		},
+	})
+	DefaultRegistry.RegisterProtocol("remote", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return SSHRemoteForwardConnector()
+		},
+	})
+	DefaultRegistry.RegisterProtocol("forward", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return ForwardConnector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return SSHForwardHandler(), nil
+		},
+	})
+}
+
+// sshForwardChain makes the last node of the chain use the SSH port forwarding by the connector directly
+// if it is a forward+ssh node.
+func sshForwardChain(chain *Chain, connector Connector) {
+	if last := chain.LastNode(); last.Protocol != "forward" || last.Transport != "ssh" {
+		return
+	}
+	nodes := chain.Nodes()
+	nodes[len(nodes)-1].Client.Connector = connector
+	nodes[len(nodes)-1].Client.Transporter = SSHForwardTransporter()
+}
+
 // Applicable SSH Request types for Port Forwarding - RFC 4254 7.X
 const (
 	DirectForwardRequest       = "direct-tcpip"         // RFC 4254 7.2
@@ -209,6 +274,50 @@ func (tr *sshForwardTransporter) Dial(addr string, options ...DialOption) (conn
 	return session.conn, nil
 }
 
+// sshClientAuth sets the password of the user and the key of the options to the config,
+// the returned function reports whether the server has asked for the authentication.
+func sshClientAuth(config *ssh.ClientConfig, opts *HandshakeOptions) func() bool {
+	var mux sync.Mutex
+	var tried bool
+	try := func() {
+		mux.Lock()
+		tried = true
+		mux.Unlock()
+	}
+
+	if opts.User != nil {
+		config.User = opts.User.Username()
+		if password, _ := opts.User.Password(); password != "" {
+			config.Auth = append(config.Auth, ssh.PasswordCallback(func() (string, error) {
+				try()
+				return password, nil
+			}))
+		}
+	}
+	if opts.SSHConfig != nil && opts.SSHConfig.Key != nil {
+		key := opts.SSHConfig.Key
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			try()
+			return []ssh.Signer{key}, nil
+		}))
+	}
+	return func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return tried
+	}
+}
+
+// sshHandshakeError returns the error of the SSH handshake, which is permanent if the authentication
+// is tried and the handshake is not broken by the network.
+func sshHandshakeError(err error, authTried bool) error {
+	var ne net.Error
+	if authTried && !errors.As(err, &ne) && !errors.Is(err, io.EOF) {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
+
 func (tr *sshForwardTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
 	opts := &HandshakeOptions{}
 	for _, option := range options {
@@ -224,17 +333,7 @@ func (tr *sshForwardTransporter) Handshake(conn net.Conn, options ...HandshakeOp
 		Timeout:         timeout,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
-	if opts.User != nil {
-		config.User = opts.User.Username()
-		if password, _ := opts.User.Password(); password != "" {
-			config.Auth = []ssh.AuthMethod{
-				ssh.Password(password),
-			}
-		}
-	}
-	if opts.SSHConfig != nil && opts.SSHConfig.Key != nil {
-		config.Auth = append(config.Auth, ssh.PublicKeys(opts.SSHConfig.Key))
-	}
+	authTried := sshClientAuth(&config, opts)
 
 	tr.sessionMutex.Lock()
 	defer tr.sessionMutex.Unlock()
@@ -249,7 +348,7 @@ func (tr *sshForwardTransporter) Handshake(conn net.Conn, options ...HandshakeOp
 			log.Log("ssh", err)
 			conn.Close()
 			delete(tr.sessions, opts.Addr)
-			return nil, err
+			return nil, sshHandshakeError(err, authTried())
 		}
 
 		session = &sshSession{
@@ -338,17 +437,7 @@ func (tr *sshTunnelTransporter) Handshake(conn net.Conn, options ...HandshakeOpt
 		Timeout:         timeout,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
-	if opts.User != nil {
-		config.User = opts.User.Username()
-		if password, _ := opts.User.Password(); password != "" {
-			config.Auth = []ssh.AuthMethod{
-				ssh.Password(password),
-			}
-		}
-	}
-	if opts.SSHConfig != nil && opts.SSHConfig.Key != nil {
-		config.Auth = append(config.Auth, ssh.PublicKeys(opts.SSHConfig.Key))
-	}
+	authTried := sshClientAuth(&config, opts)
 
 	tr.sessionMutex.Lock()
 	defer tr.sessionMutex.Unlock()
@@ -362,7 +451,7 @@ func (tr *sshTunnelTransporter) Handshake(conn net.Conn, options ...HandshakeOpt
 		if err != nil {
 			conn.Close()
 			delete(tr.sessions, opts.Addr)
-			return nil, err
+			return nil, sshHandshakeError(err, authTried())
 		}
 
 		session = &sshSession{
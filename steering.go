@@ -0,0 +1,271 @@
+package gost
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// interfaceMetricPeriod is the period updating the scores of the interfaces.
+var interfaceMetricPeriod = 30 * time.Second
+
+// InterfaceMetric scores the network interfaces, the interface with the highest score is preferred.
+type InterfaceMetric interface {
+	Score(ifName string) float64
+}
+
+// InterfaceSelector selects the interface with the highest score of the metric for the dial,
+// the socket is bound to the interface (SO_BINDTODEVICE). The first interface is selected if the scores are equal.
+// It only takes effect on Linux, and it is only honoured by TCPTransporter.
+func InterfaceSelector(interfaces []string, metric InterfaceMetric) DialOption {
+	return func(opts *DialOptions) {
+		best, bestScore := "", 0.0
+		for _, name := range interfaces {
+			if score := metric.Score(name); best == "" || score > bestScore {
+				best, bestScore = name, score
+			}
+		}
+		opts.Interface = best
+	}
+}
+
+// interfaceScores updates the scores of the interfaces periodically in background.
+type interfaceScores struct {
+	mux     sync.RWMutex
+	scores  map[string]float64
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newInterfaceScores(interfaces []string, update func(interfaces []string) map[string]float64) *interfaceScores {
+	s := &interfaceScores{
+		scores:  make(map[string]float64),
+		stopped: make(chan struct{}),
+	}
+	s.set(update(interfaces))
+
+	go func() {
+		ticker := time.NewTicker(interfaceMetricPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.set(update(interfaces))
+			case <-s.stopped:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *interfaceScores) set(scores map[string]float64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.scores = scores
+}
+
+func (s *interfaceScores) Score(ifName string) float64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.scores[ifName]
+}
+
+// Stop stops updating the scores.
+func (s *interfaceScores) Stop() {
+	s.once.Do(func() {
+		close(s.stopped)
+	})
+}
+
+// LatencyMetric scores the interfaces by the round-trip time of the ICMP echo to their gateways,
+// the score is the reciprocal of the RTT in seconds, it is 0 if the gateway is unknown or unreachable.
+//
+// The gateways are read from /proc/net/route, so it is only available on Linux.
+type LatencyMetric struct {
+	*interfaceScores
+}
+
+// NewLatencyMetric creates a LatencyMetric for the interfaces, the scores are updated every 30 seconds until it is stopped.
+func NewLatencyMetric(interfaces ...string) *LatencyMetric {
+	return &LatencyMetric{
+		interfaceScores: newInterfaceScores(interfaces, latencyScores),
+	}
+}
+
+func latencyScores(interfaces []string) map[string]float64 {
+	scores := make(map[string]float64)
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return scores
+	}
+	gateways := parseRouteGateways(f)
+	f.Close()
+
+	for _, name := range interfaces {
+		gw := gateways[name]
+		if gw == nil {
+			continue
+		}
+		rtt, err := pingGateway(gw, 2*time.Second)
+		if err != nil {
+			if Debug {
+				log.Logf("[steering] %s: ping %s: %v", name, gw, err)
+			}
+			continue
+		}
+		scores[name] = 1 / rtt.Seconds()
+	}
+	return scores
+}
+
+// parseRouteGateways parses the gateways of the interfaces in the format of /proc/net/route,
+// the gateway of the default route is preferred.
+func parseRouteGateways(r io.Reader) map[string]net.IP {
+	gateways := make(map[string]net.IP)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] == "Iface" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 || binary.LittleEndian.Uint32(b) == 0 {
+			continue
+		}
+		if _, ok := gateways[fields[0]]; ok && fields[1] != "00000000" {
+			continue
+		}
+		gateways[fields[0]] = net.IPv4(b[3], b[2], b[1], b[0])
+	}
+	return gateways
+}
+
+// pingGateway sends an ICMP echo to the IPv4 address, the unprivileged ICMP socket is used if it is allowed.
+func pingGateway(ip net.IP, timeout time.Duration) (time.Duration, error) {
+	network, dst := "udp4", net.Addr(&net.UDPAddr{IP: ip})
+	conn, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		network, dst = "ip4:icmp", &net.IPAddr{IP: ip}
+		if conn, err = icmp.ListenPacket(network, "0.0.0.0"); err != nil {
+			return 0, err
+		}
+	}
+	defer conn.Close()
+
+	seq := int(time.Now().UnixNano() & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: seq, Data: []byte("gost")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		// the ID is replaced by the kernel for the unprivileged socket.
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// ThroughputMetric scores the interfaces by the bytes per second received and sent recently,
+// which are read from /proc/net/dev, so it is only available on Linux.
+type ThroughputMetric struct {
+	*interfaceScores
+}
+
+// NewThroughputMetric creates a ThroughputMetric for the interfaces, the scores are updated every 30 seconds
+// until it is stopped, they are 0 before the first update.
+func NewThroughputMetric(interfaces ...string) *ThroughputMetric {
+	var mux sync.Mutex
+	var last map[string]uint64
+	var lastTime time.Time
+	update := func(interfaces []string) map[string]float64 {
+		scores := make(map[string]float64)
+		counters, err := readNetDev()
+		if err != nil {
+			return scores
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		now := time.Now()
+		if last != nil {
+			secs := now.Sub(lastTime).Seconds()
+			for _, name := range interfaces {
+				if n, ok := counters[name]; ok && n >= last[name] && secs > 0 {
+					scores[name] = float64(n-last[name]) / secs
+				}
+			}
+		}
+		last, lastTime = counters, now
+		return scores
+	}
+	return &ThroughputMetric{
+		interfaceScores: newInterfaceScores(interfaces, update),
+	}
+}
+
+func readNetDev() (map[string]uint64, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNetDev(f)
+}
+
+// parseNetDev parses the total bytes received and sent of the interfaces in the format of /proc/net/dev.
+func parseNetDev(r io.Reader) (map[string]uint64, error) {
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, stats, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(stats)
+		if len(fields) < 9 {
+			return nil, errors.New("steering: invalid interface statistics")
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		counters[strings.TrimSpace(name)] = rx + tx
+	}
+	return counters, scanner.Err()
+}
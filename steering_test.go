@@ -0,0 +1,108 @@
+package gost
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticMetric map[string]float64
+
+func (m staticMetric) Score(ifName string) float64 {
+	return m[ifName]
+}
+
+func TestInterfaceSelector(t *testing.T) {
+	tests := []struct {
+		interfaces []string
+		metric     staticMetric
+		want       string
+	}{
+		{[]string{"eth0", "eth1"}, staticMetric{"eth0": 10, "eth1": 20}, "eth1"},
+		{[]string{"eth0", "eth1"}, staticMetric{"eth0": 20, "eth1": 10}, "eth0"},
+		{[]string{"eth0", "eth1"}, staticMetric{}, "eth0"},
+		{nil, staticMetric{"eth0": 10}, ""},
+	}
+	for i, tc := range tests {
+		opts := &DialOptions{}
+		InterfaceSelector(tc.interfaces, tc.metric)(opts)
+		if opts.Interface != tc.want {
+			t.Errorf("#%d: interface %q, want %q", i, opts.Interface, tc.want)
+		}
+	}
+}
+
+func TestParseRouteGateways(t *testing.T) {
+	routes := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0100A8C0	0003	0	0	100	00000000	0	0	0
+wlan0	0010000A	FE10000A	0003	0	0	0	00FFFFFF	0	0	0
+wlan0	00000000	0110000A	0003	0	0	600	00000000	0	0	0
+`
+	gateways := parseRouteGateways(strings.NewReader(routes))
+	if len(gateways) != 2 || gateways["eth0"].String() != "192.168.0.1" || gateways["wlan0"].String() != "10.0.16.1" {
+		t.Errorf("gateways %v", gateways)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	dev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:  1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+  eth0: 300 3 0 0 0 0 0 0 400 4 0 0 0 0 0 0
+`
+	counters, err := parseNetDev(strings.NewReader(dev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counters) != 2 || counters["lo"] != 3000 || counters["eth0"] != 700 {
+		t.Errorf("counters %v", counters)
+	}
+	if _, err := parseNetDev(strings.NewReader("eth0: 1 2 3\n")); err == nil {
+		t.Error("should fail with the invalid statistics")
+	}
+}
+
+func TestThroughputMetric(t *testing.T) {
+	if _, err := os.Stat("/proc/net/dev"); err != nil {
+		t.Skip("/proc/net/dev is not available")
+	}
+	defer func(d time.Duration) { interfaceMetricPeriod = d }(interfaceMetricPeriod)
+	interfaceMetricPeriod = 50 * time.Millisecond
+
+	m := NewThroughputMetric("lo")
+	defer m.Stop()
+
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Write(make([]byte, 1<<20))
+			conn.Close()
+		}
+	}()
+	conn, err := TCPTransporter().Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Score("lo") <= 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Score("lo") <= 0 {
+		t.Error("the throughput of lo should be scored")
+	}
+}
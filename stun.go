@@ -0,0 +1,206 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/pion/stun"
+)
+
+// NATType is the type of NAT detected by STUNQuery.
+type NATType string
+
+// NAT types as defined in RFC 3489.
+const (
+	NATUnknown        NATType = "Unknown"
+	NATNone           NATType = "None"
+	NATFullCone       NATType = "Full-Cone"
+	NATRestrictedCone NATType = "Restricted-Cone"
+	NATPortRestricted NATType = "Port-Restricted"
+	NATSymmetric      NATType = "Symmetric"
+)
+
+// STUNTimeout is the timeout of a single STUN request.
+var STUNTimeout = 3 * time.Second
+
+// flags of the CHANGE-REQUEST attribute.
+const (
+	stunChangeIP   = 0x04
+	stunChangePort = 0x02
+)
+
+var errSTUNNoResponse = errors.New("stun: no response")
+
+// STUNQuery sends a Binding Request to the STUN server serverAddr,
+// and returns the external (mapped) address of the local UDP socket.
+//
+// The NAT type is detected by the classic procedure of RFC 3489:
+// the server is asked to respond from a different IP and port (CHANGE-REQUEST),
+// and the request is sent again to the alternate address of the server from the same local port
+// to check whether the mapping is kept.
+// The server must provide the OTHER-ADDRESS (or CHANGED-ADDRESS) attribute to tell the
+// Restricted-Cone, Port-Restricted and Symmetric NAT apart, otherwise NATUnknown is returned.
+func STUNQuery(serverAddr string) (externalAddr net.UDPAddr, natType NATType, err error) {
+	natType = NATUnknown
+
+	raddr, err := net.ResolveUDPAddr("udp", serverAddr)
+	if err != nil {
+		return
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Test I: the mapped address seen by the server.
+	resp, err := stunRequest(conn, raddr, 0)
+	if err != nil {
+		return
+	}
+	mapped, err := stunMappedAddr(resp)
+	if err != nil {
+		return
+	}
+	externalAddr = *mapped
+
+	if isLocalUDPAddr(mapped, conn.LocalAddr().(*net.UDPAddr)) {
+		natType = NATNone
+		return
+	}
+
+	// Test II: the response from a different IP and port.
+	if _, err = stunRequest(conn, raddr, stunChangeIP|stunChangePort); err == nil {
+		natType = NATFullCone
+		return
+	}
+	if err != errSTUNNoResponse {
+		return
+	}
+	err = nil
+
+	other := stunOtherAddr(resp)
+	if other == nil {
+		if Debug {
+			log.Logf("[stun] %s: no alternate address", serverAddr)
+		}
+		return
+	}
+
+	// Test I': the mapped address seen by the alternate address of the server.
+	resp, err = stunRequest(conn, other, 0)
+	if err != nil {
+		return
+	}
+	mapped2, err := stunMappedAddr(resp)
+	if err != nil {
+		return
+	}
+	if !mapped.IP.Equal(mapped2.IP) || mapped.Port != mapped2.Port {
+		natType = NATSymmetric
+		return
+	}
+
+	// Test III: the response from a different port.
+	if _, err = stunRequest(conn, raddr, stunChangePort); err == nil {
+		natType = NATRestrictedCone
+		return
+	}
+	if err == errSTUNNoResponse {
+		err = nil
+		natType = NATPortRestricted
+	}
+	return
+}
+
+// stunRequest sends a Binding Request with the CHANGE-REQUEST flags to addr,
+// errSTUNNoResponse is returned if no response is received in STUNTimeout.
+func stunRequest(conn *net.UDPConn, addr *net.UDPAddr, change uint32) (*stun.Message, error) {
+	setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+	if change != 0 {
+		setters = append(setters, stunChangeRequest(change))
+	}
+	req, err := stun.Build(setters...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(req.Raw, addr); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(STUNTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	b := sPool.Get().([]byte)
+	defer sPool.Put(b)
+
+	for {
+		n, _, err := conn.ReadFromUDP(b)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil, errSTUNNoResponse
+			}
+			return nil, err
+		}
+
+		resp := &stun.Message{Raw: append([]byte(nil), b[:n]...)}
+		if err := resp.Decode(); err != nil {
+			continue
+		}
+		// discard the late responses of the previous requests.
+		if resp.TransactionID != req.TransactionID {
+			continue
+		}
+		if resp.Type != stun.BindingSuccess {
+			return nil, errors.New("stun: " + resp.Type.String())
+		}
+		return resp, nil
+	}
+}
+
+type stunChangeRequest uint32
+
+func (c stunChangeRequest) AddTo(m *stun.Message) error {
+	v := make([]byte, 4)
+	v[3] = byte(c)
+	m.Add(stun.AttrChangeRequest, v)
+	return nil
+}
+
+func stunMappedAddr(m *stun.Message) (*net.UDPAddr, error) {
+	var xaddr stun.XORMappedAddress
+	if err := xaddr.GetFrom(m); err == nil {
+		return &net.UDPAddr{IP: xaddr.IP, Port: xaddr.Port}, nil
+	}
+	var addr stun.MappedAddress
+	if err := addr.GetFrom(m); err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: addr.IP, Port: addr.Port}, nil
+}
+
+func stunOtherAddr(m *stun.Message) *net.UDPAddr {
+	for _, t := range []stun.AttrType{stun.AttrOtherAddress, stun.AttrChangedAddress} {
+		var addr stun.MappedAddress
+		if err := addr.GetFromAs(m, t); err == nil {
+			return &net.UDPAddr{IP: addr.IP, Port: addr.Port}
+		}
+	}
+	return nil
+}
+
+// isLocalUDPAddr reports whether the mapped address is the address of the local socket.
+func isLocalUDPAddr(mapped, local *net.UDPAddr) bool {
+	if mapped.Port != local.Port {
+		return false
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, addr := range addrs {
+		if inet, ok := addr.(*net.IPNet); ok && inet.IP.Equal(mapped.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package gost
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// stunTestServer is a mock STUN server listening on two IPs and two ports,
+// it simulates the NAT behind the client by the mapped addresses and the responses it drops.
+type stunTestServer struct {
+	conns   [2][2]*net.UDPConn // [ip][port]
+	natType NATType
+}
+
+func newSTUNTestServer(t *testing.T, natType NATType) *stunTestServer {
+	s := &stunTestServer{natType: natType}
+	for i, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		for j := range s.conns[i] {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip)})
+			if err != nil {
+				s.Close()
+				t.Skip(err)
+			}
+			s.conns[i][j] = conn
+		}
+	}
+	for i := range s.conns {
+		for j := range s.conns[i] {
+			go s.serve(i, j)
+		}
+	}
+	return s
+}
+
+func (s *stunTestServer) serve(i, j int) {
+	b := make([]byte, 1500)
+	for {
+		n, from, err := s.conns[i][j].ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		req := &stun.Message{Raw: append([]byte(nil), b[:n]...)}
+		if err := req.Decode(); err != nil {
+			continue
+		}
+
+		var changeIP, changePort bool
+		if v, err := req.Get(stun.AttrChangeRequest); err == nil && len(v) == 4 {
+			changeIP = v[3]&stunChangeIP != 0
+			changePort = v[3]&stunChangePort != 0
+		}
+
+		mapped := &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: from.Port}
+		switch s.natType {
+		case NATNone:
+			mapped = from
+		case NATRestrictedCone:
+			if changeIP {
+				continue
+			}
+		case NATPortRestricted:
+			if changeIP || changePort {
+				continue
+			}
+		case NATSymmetric:
+			if changeIP || changePort {
+				continue
+			}
+			mapped.Port += i
+		}
+
+		ri, rj := i, j
+		if changeIP {
+			ri = 1 - i
+		}
+		if changePort {
+			rj = 1 - j
+		}
+		other := s.conns[1-i][1-j].LocalAddr().(*net.UDPAddr)
+		resp, err := stun.Build(
+			stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: mapped.IP, Port: mapped.Port},
+		)
+		if err != nil {
+			continue
+		}
+		(&stun.MappedAddress{IP: other.IP, Port: other.Port}).AddToAs(resp, stun.AttrOtherAddress)
+		s.conns[ri][rj].WriteToUDP(resp.Raw, from)
+	}
+}
+
+func (s *stunTestServer) Addr() string {
+	return s.conns[0][0].LocalAddr().String()
+}
+
+func (s *stunTestServer) Close() {
+	for i := range s.conns {
+		for j := range s.conns[i] {
+			if s.conns[i][j] != nil {
+				s.conns[i][j].Close()
+			}
+		}
+	}
+}
+
+func TestSTUNQuery(t *testing.T) {
+	timeout := STUNTimeout
+	STUNTimeout = 200 * time.Millisecond
+	defer func() { STUNTimeout = timeout }()
+
+	for _, natType := range []NATType{
+		NATNone, NATFullCone, NATRestrictedCone, NATPortRestricted, NATSymmetric,
+	} {
+		natType := natType
+		t.Run(string(natType), func(t *testing.T) {
+			server := newSTUNTestServer(t, natType)
+			defer server.Close()
+
+			addr, nt, err := STUNQuery(server.Addr())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nt != natType {
+				t.Errorf("got NAT type %s, want %s", nt, natType)
+			}
+			if natType != NATNone && !addr.IP.Equal(net.ParseIP("203.0.113.1")) {
+				t.Errorf("got external address %s", addr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+var (
+	// DefaultSubscriptionTTL is the cache time of the subscription without the max-age of Cache-Control.
+	DefaultSubscriptionTTL = 1 * time.Hour
+	// MaxSubscriptionSize is the max size of the body of the subscription, the larger subscriptions are rejected.
+	MaxSubscriptionSize int64 = 4 << 20
+)
+
+type subscriptionCache struct {
+	nodes        []*Node
+	expires      time.Time
+	etag         string
+	lastModified string
+}
+
+var (
+	subscriptions   = make(map[string]*subscriptionCache)
+	subscriptionMux sync.Mutex
+)
+
+// FetchSubscription fetches the subscription of the proxies, the body is the base64-encoded (or plain) list of
+// the proxy URIs, one per line. The URIs of ss (by ParseShadowsocksURI), vmess (the JSON of v2rayN), vless, trojan,
+// hysteria2 (or hy2), http, https and socks5 are parsed to the nodes, the others are skipped with a warning.
+// The name of the proxy, the fragment of the URI, is set to the Values as name.
+//
+// The nodes are cached by the URL for the max-age of Cache-Control, or DefaultSubscriptionTTL.
+// The expired cache is revalidated by the conditional request with ETag and Last-Modified,
+// and it is used as is if the server responds 304 Not Modified.
+// The default client is http.DefaultClient if httpClient is nil.
+func FetchSubscription(ctx context.Context, url string, httpClient *http.Client) ([]*Node, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	subscriptionMux.Lock()
+	cache := subscriptions[url]
+	subscriptionMux.Unlock()
+	if cache != nil && time.Now().Before(cache.expires) {
+		return copyNodes(cache.nodes), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", DefaultProxyAgent)
+	if cache != nil {
+		if cache.etag != "" {
+			req.Header.Set("If-None-Match", cache.etag)
+		}
+		if cache.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cache.lastModified)
+		}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ttl := subscriptionTTL(resp.Header.Get("Cache-Control"))
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cache != nil:
+		subscriptionMux.Lock()
+		cache.expires = time.Now().Add(ttl)
+		subscriptionMux.Unlock()
+		return copyNodes(cache.nodes), nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("subscription: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSubscriptionSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxSubscriptionSize {
+		return nil, fmt.Errorf("subscription: the body exceeds %d bytes", MaxSubscriptionSize)
+	}
+	nodes := parseSubscription(data)
+
+	subscriptionMux.Lock()
+	subscriptions[url] = &subscriptionCache{
+		nodes:        nodes,
+		expires:      time.Now().Add(ttl),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	subscriptionMux.Unlock()
+	return copyNodes(nodes), nil
+}
+
+// subscriptionTTL returns the cache time by the Cache-Control header.
+func subscriptionTTL(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(k) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(v, `"`)); err == nil && n >= 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return DefaultSubscriptionTTL
+}
+
+func copyNodes(nodes []*Node) []*Node {
+	var ns []*Node
+	for _, node := range nodes {
+		n := *node
+		n.Values = url.Values{}
+		for k, v := range node.Values {
+			n.Values[k] = append([]string(nil), v...)
+		}
+		ns = append(ns, &n)
+	}
+	return ns
+}
+
+// parseSubscription parses the body of the subscription, which is base64-encoded or plain.
+func parseSubscription(data []byte) []*Node {
+	data = bytes.TrimSpace(data)
+	if b, err := decodeShadowsocksBase64(string(bytes.Join(bytes.Fields(data), nil))); err == nil {
+		data = b
+	}
+
+	var nodes []*Node
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		node, err := ParseProxyURI(line)
+		if err != nil {
+			log.Logf("[subscription] %s, skipped", err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// ParseProxyURI parses the proxy URI of the subscriptions, the schemes are the same as FetchSubscription.
+func ParseProxyURI(uri string) (*Node, error) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil, errors.New("proxy URI: missing scheme")
+	}
+	switch strings.ToLower(scheme) {
+	case "ss":
+		node, err := ParseShadowsocksURI(uri)
+		if err != nil {
+			return nil, err
+		}
+		return &node, nil
+	case "vmess":
+		return parseVmessURI(uri)
+	case "vless", "trojan", "hysteria2", "hy2":
+		return parseShareURI(uri)
+	case "http", "https", "socks5", "socks":
+		node, err := ParseNode(uri)
+		if err != nil {
+			return nil, err
+		}
+		if u, _ := url.Parse(uri); u != nil && u.Fragment != "" {
+			node.Values.Set("name", u.Fragment)
+		}
+		return &node, nil
+	default:
+		return nil, fmt.Errorf("proxy URI: unsupported scheme %s", scheme)
+	}
+}
+
+// parseVmessURI parses the vmess URI of v2rayN, vmess://BASE64(JSON).
+func parseVmessURI(uri string) (*Node, error) {
+	b, err := decodeShadowsocksBase64(strings.TrimPrefix(uri, "vmess://"))
+	if err != nil {
+		return nil, fmt.Errorf("vmess: %v", err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("vmess: %v", err)
+	}
+	get := func(k string) string {
+		if v[k] == nil {
+			return ""
+		}
+		return fmt.Sprint(v[k])
+	}
+
+	port, err := strconv.Atoi(get("port"))
+	if err != nil || get("add") == "" || get("id") == "" {
+		return nil, errors.New("vmess: invalid add, port or id")
+	}
+	node := importNode("vmess", shareTransport(get("net"), get("tls") == "tls"), get("add"), port, url.User(get("id")))
+	setNodeValues(node, map[string]string{
+		"name":        get("ps"),
+		"alterId":     get("aid"),
+		"cipher":      get("scy"),
+		"serverName":  get("sni"),
+		"host":        get("host"),
+		"path":        get("path"),
+		"serviceName": strings.TrimPrefix(get("path"), "/"),
+	})
+	if node.Transport != "grpc" {
+		node.Values.Del("serviceName")
+	}
+	if get("tls") == "tls" {
+		node.Values.Set("secure", "true")
+		if node.Transport == "grpc" {
+			node.Values.Set("tls", "true")
+		}
+	}
+	return node, nil
+}
+
+// parseShareURI parses the URIs of vless, trojan and hysteria2, such as
+// trojan://password@host:port?security=tls&type=ws&sni=example.com&path=/ws#name.
+func parseShareURI(uri string) (*Node, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	protocol := strings.ToLower(u.Scheme)
+	if protocol == "hy2" {
+		protocol = "hysteria2"
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil || u.Hostname() == "" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("%s: invalid host, port or user", protocol)
+	}
+	q := u.Query()
+
+	var transport, secure string
+	switch protocol {
+	case "hysteria2":
+		transport = "hysteria2"
+		if q.Get("insecure") != "1" {
+			secure = "true"
+		}
+	default:
+		security := q.Get("security")
+		if security == "" && protocol == "trojan" {
+			security = "tls"
+		}
+		switch security {
+		case "", "none", "tls":
+		default:
+			return nil, fmt.Errorf("%s: unsupported security %s", protocol, security)
+		}
+		transport = shareTransport(q.Get("type"), security == "tls")
+		if security == "tls" && q.Get("allowInsecure") != "1" {
+			secure = "true"
+		}
+	}
+
+	// the password of hysteria2 can be user:pass.
+	user := url.User(u.User.String())
+	if protocol != "hysteria2" {
+		user = url.User(u.User.Username())
+	}
+	node := importNode(protocol, transport, u.Hostname(), port, user)
+	setNodeValues(node, map[string]string{
+		"name":          u.Fragment,
+		"secure":        secure,
+		"serverName":    q.Get("sni"),
+		"host":          q.Get("host"),
+		"path":          q.Get("path"),
+		"serviceName":   q.Get("serviceName"),
+		"encryption":    q.Get("encryption"),
+		"obfs":          q.Get("obfs"),
+		"obfs-password": q.Get("obfs-password"),
+	})
+	if transport == "grpc" && q.Get("security") == "tls" {
+		node.Values.Set("tls", "true")
+	}
+	if flow := q.Get("flow"); flow != "" && protocol != "hysteria2" {
+		node.Values.Set("flow", flow)
+		if err := checkNodeFlow(*node); err != nil {
+			log.Logf("[subscription] %s, ignored", err)
+			node.Values.Del("flow")
+		}
+	}
+	return node, nil
+}
+
+// shareTransport returns the transport by the network and whether it is over TLS.
+func shareTransport(network string, tls bool) string {
+	switch network {
+	case "ws":
+		if tls {
+			return "wss"
+		}
+		return "ws"
+	case "grpc":
+		return "grpc"
+	case "h2", "http":
+		return "http2"
+	default:
+		if tls {
+			return "tls"
+		}
+		return "tcp"
+	}
+}
+
+func setNodeValues(node *Node, values map[string]string) {
+	for k, v := range values {
+		if v != "" {
+			node.Values.Set(k, v)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package gost
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseSurgeLine parses the proxy line of the Surge config, such as
+//
+//	ProxyName = ss, server, port, encrypt-method=method, password=pass, obfs=http, obfs-host=host
+//
+// The http, https, socks5, socks5-tls, ss, vmess and trojan types are supported. The username and password
+// of http, https, socks5 and socks5-tls can also be positional after the port. The name of the proxy is set
+// to the Values as name, the obfs of ss is set to the Values as plugin, in the format of SIP002.
+//
+// The http, https, socks5, socks5-tls and ss nodes are ready for use. The vmess and trojan nodes keep
+// the parameters of the line in the Values, they are usable only by a Connector of the protocol.
+func ParseSurgeLine(line string) (Node, error) {
+	name, spec, ok := strings.Cut(line, "=")
+	if !ok {
+		return Node{}, errors.New("surge: missing proxy name")
+	}
+	name = strings.TrimSpace(name)
+
+	var fields []string
+	for _, f := range strings.Split(spec, ",") {
+		fields = append(fields, strings.TrimSpace(f))
+	}
+	if len(fields) < 3 {
+		return Node{}, errors.New("surge: missing type, server or port")
+	}
+	typ, server := strings.ToLower(fields[0]), fields[1]
+	port, err := strconv.Atoi(fields[2])
+	if err != nil || server == "" || port <= 0 || port > 65535 {
+		return Node{}, fmt.Errorf("surge: invalid server %s:%s", fields[1], fields[2])
+	}
+
+	params := make(map[string]string)
+	var positional []string
+	for _, f := range fields[3:] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			params[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		} else if f != "" {
+			positional = append(positional, f)
+		}
+	}
+
+	var node *Node
+	switch typ {
+	case "http", "https", "socks5", "socks5-tls":
+		username, password := params["username"], params["password"]
+		if len(positional) > 0 {
+			username = positional[0]
+		}
+		if len(positional) > 1 {
+			password = positional[1]
+		}
+		var user *url.Userinfo
+		if username != "" || password != "" {
+			user = url.UserPassword(username, password)
+		}
+		protocol, transport := typ, "tcp"
+		switch typ {
+		case "https":
+			protocol, transport = "http", "tls"
+		case "socks5-tls":
+			protocol, transport = "socks5", "tls"
+		}
+		node = importNode(protocol, transport, server, port, user)
+	case "ss":
+		method, password := params["encrypt-method"], params["password"]
+		if method == "" || password == "" {
+			return Node{}, errors.New("surge: missing encrypt-method or password")
+		}
+		node = importNode("ss", "tcp", server, port, url.UserPassword(method, password))
+		if obfs := params["obfs"]; obfs != "" {
+			plugin := "obfs-local;obfs=" + obfs
+			if host := params["obfs-host"]; host != "" {
+				plugin += ";obfs-host=" + host
+			}
+			node.Values.Set("plugin", plugin)
+		}
+	case "vmess":
+		uuid := params["username"]
+		if uuid == "" {
+			return Node{}, errors.New("surge: missing username")
+		}
+		node = importNode("vmess", surgeTransport(params), server, port, url.User(uuid))
+		if params["vmess-aead"] == "true" {
+			node.Values.Set("alterId", "0")
+		}
+	case "trojan":
+		password := params["password"]
+		if password == "" {
+			return Node{}, errors.New("surge: missing password")
+		}
+		// trojan is always over TLS.
+		params["tls"] = "true"
+		node = importNode("trojan", surgeTransport(params), server, port, url.User(password))
+	default:
+		return Node{}, fmt.Errorf("surge: unsupported type %s", typ)
+	}
+
+	if name != "" {
+		node.Values.Set("name", name)
+	}
+	if sni := params["sni"]; sni != "" {
+		node.Values.Set("serverName", sni)
+	}
+	if isTLSTransport(node.Transport) && params["skip-cert-verify"] != "true" {
+		node.Values.Set("secure", "true")
+	}
+	if path := params["ws-path"]; path != "" {
+		node.Values.Set("path", path)
+	}
+	// the ws-headers are separated by |, such as Host:example.com|User-Agent:x.
+	for _, h := range strings.Split(params["ws-headers"], "|") {
+		if k, v, ok := strings.Cut(h, ":"); ok && strings.EqualFold(strings.TrimSpace(k), "host") {
+			node.Values.Set("host", strings.TrimSpace(v))
+		}
+	}
+	return *node, nil
+}
+
+// surgeTransport returns the transport by the ws and tls parameters of the Surge line.
+func surgeTransport(params map[string]string) string {
+	ws, tls := params["ws"] == "true", params["tls"] == "true"
+	switch {
+	case ws && tls:
+		return "wss"
+	case ws:
+		return "ws"
+	case tls:
+		return "tls"
+	default:
+		return "tcp"
+	}
+}
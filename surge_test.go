@@ -0,0 +1,62 @@
+package gost
+
+import (
+	"testing"
+)
+
+var surgeLineTests = []struct {
+	line                            string
+	protocol, transport, addr, user string
+	values                          map[string]string
+	hasError                        bool
+}{
+	{"Proxy-SS = ss, 192.0.2.1, 8388, encrypt-method=aes-256-gcm, password=secret, obfs=http, obfs-host=bing.com",
+		"ss", "tcp", "192.0.2.1:8388", "aes-256-gcm:secret",
+		map[string]string{"name": "Proxy-SS", "plugin": "obfs-local;obfs=http;obfs-host=bing.com"}, false},
+	{"Proxy-HTTP = http, proxy.example.com, 8080, user, pass",
+		"http", "tcp", "proxy.example.com:8080", "user:pass", map[string]string{"name": "Proxy-HTTP"}, false},
+	{"Proxy-HTTPS = https, proxy.example.com, 443, username=user, password=pass, sni=example.com, skip-cert-verify=true",
+		"http", "tls", "proxy.example.com:443", "user:pass", map[string]string{"serverName": "example.com", "secure": ""}, false},
+	{"Proxy-SOCKS = socks5, 192.0.2.2, 1080",
+		"socks5", "tcp", "192.0.2.2:1080", "", nil, false},
+	{"Proxy-SOCKS-TLS = socks5-tls, 192.0.2.2, 1443, user, pass",
+		"socks5", "tls", "192.0.2.2:1443", "user:pass", map[string]string{"secure": "true"}, false},
+	{"Proxy-VMess = vmess, vmess.example.com, 443, username=b831381d-6324-4d53-ad4f-8cda48b30811, ws=true, ws-path=/ray, ws-headers=Host:cdn.example.com|User-Agent:x, tls=true, vmess-aead=true",
+		"vmess", "wss", "vmess.example.com:443", "b831381d-6324-4d53-ad4f-8cda48b30811",
+		map[string]string{"path": "/ray", "host": "cdn.example.com", "alterId": "0"}, false},
+	{"Proxy-Trojan = trojan, trojan.example.com, 443, password=secret, sni=example.com",
+		"trojan", "tls", "trojan.example.com:443", "secret", map[string]string{"serverName": "example.com"}, false},
+	{"Proxy-SS = ss, 192.0.2.1, 8388, password=secret", "", "", "", "", nil, true},
+	{"Proxy = ss, 192.0.2.1", "", "", "", "", nil, true},
+	{"Proxy = http, 192.0.2.1, port", "", "", "", "", nil, true},
+	{"Proxy = snell, 192.0.2.1, 443, psk=secret", "", "", "", "", nil, true},
+	{"http, 192.0.2.1, 443", "", "", "", "", nil, true},
+}
+
+func TestParseSurgeLine(t *testing.T) {
+	for i, tc := range surgeLineTests {
+		node, err := ParseSurgeLine(tc.line)
+		if tc.hasError {
+			if err == nil {
+				t.Errorf("#%d should failed", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d got error %v", i, err)
+			continue
+		}
+		var user string
+		if node.User != nil {
+			user = node.User.String()
+		}
+		if node.Protocol != tc.protocol || node.Transport != tc.transport || node.Addr != tc.addr || user != tc.user {
+			t.Errorf("#%d got %s+%s://%s@%s", i, node.Protocol, node.Transport, user, node.Addr)
+		}
+		for k, v := range tc.values {
+			if got := node.Values.Get(k); got != v {
+				t.Errorf("#%d %s got %q, want %q", i, k, got, v)
+			}
+		}
+	}
+}
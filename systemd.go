@@ -0,0 +1,83 @@
+package gost
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemdListenFdsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START).
+const systemdListenFdsStart = 3
+
+var systemdFiles struct {
+	once  sync.Once
+	mux   sync.Mutex
+	files map[string][]*os.File
+}
+
+// SystemdListener returns the listener of the socket passed by systemd socket activation (sd_listen_fds),
+// the name is the FileDescriptorName of the socket unit, or 'unknown' if it is not set.
+// The sockets with the same name are returned in order by the subsequent calls.
+//
+// If the process is not activated by systemd or no socket of the name is passed,
+// the name is used as the address of a TCP listener.
+func SystemdListener(name string) (Listener, error) {
+	systemdFiles.once.Do(func() {
+		systemdFiles.files = systemdListenFds(os.Getenv, systemdListenFdsStart)
+		// the fds are not passed to the child processes.
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+
+	systemdFiles.mux.Lock()
+	var f *os.File
+	if files := systemdFiles.files[name]; len(files) > 0 {
+		f = files[0]
+		systemdFiles.files[name] = files[1:]
+	}
+	systemdFiles.mux.Unlock()
+
+	if f == nil {
+		return TCPListener(name)
+	}
+
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	if tln, ok := ln.(*net.TCPListener); ok {
+		return &tcpListener{Listener: tcpKeepAliveListener{tln}}, nil
+	}
+	return ln, nil
+}
+
+// systemdListenFds returns the files of the fds passed by systemd by the names,
+// the fds are from start to start+LISTEN_FDS-1.
+func systemdListenFds(getenv func(string) string, start int) map[string][]*os.File {
+	if pid, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	var names []string
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+
+	files := make(map[string][]*os.File)
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		fd := start + i
+		files[name] = append(files[name], os.NewFile(uintptr(fd), name))
+	}
+	return files
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+// +build !windows
+
+package gost
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestSystemdListenFds(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "web",
+	}
+	files := systemdListenFds(func(k string) string { return env[k] }, fd)
+	if len(files["web"]) != 1 {
+		t.Fatalf("files: %v", files)
+	}
+
+	defer files["web"][0].Close()
+	fln, err := net.FileListener(files["web"][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fln.Close()
+	if fln.Addr().String() != ln.Addr().String() {
+		t.Errorf("addr %s, want %s", fln.Addr(), ln.Addr())
+	}
+
+	env["LISTEN_PID"] = "1"
+	if files := systemdListenFds(func(k string) string { return env[k] }, fd); files != nil {
+		t.Errorf("the fds of other process should be ignored: %v", files)
+	}
+}
+
+func TestSystemdListenerFallback(t *testing.T) {
+	ln, err := SystemdListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, ok := ln.Addr().(*net.TCPAddr); !ok {
+		t.Errorf("addr %v", ln.Addr())
+	}
+}
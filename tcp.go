@@ -1,6 +1,25 @@
 package gost
 
-import "net"
+import (
+	"net"
+	"syscall"
+
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("tcp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return TCPTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			// Directly use SSH port forwarding if the last chain node is forward+ssh
+			sshForwardChain(opts.Chain, SSHDirectForwardConnector())
+			return TCPListener(node.Addr)
+		},
+		Chain: true,
+	})
+}
 
 // tcpTransporter is a raw TCP transporter.
 type tcpTransporter struct{}
@@ -21,7 +40,33 @@ func (tr *tcpTransporter) Dial(addr string, options ...DialOption) (net.Conn, er
 		timeout = DialTimeout
 	}
 	if opts.Chain == nil {
-		return net.DialTimeout("tcp", addr, timeout)
+		d := &net.Dialer{Timeout: timeout}
+		if opts.SourceIP != nil {
+			d.LocalAddr = &net.TCPAddr{IP: opts.SourceIP}
+		}
+		if opts.FWMark > 0 || opts.Interface != "" {
+			d.Control = func(_, _ string, c syscall.RawConn) error {
+				var serr error
+				if err := c.Control(func(fd uintptr) {
+					if opts.FWMark > 0 {
+						if serr = setSocketMark(int(fd), int(opts.FWMark)); serr != nil {
+							log.Logf("[tcp] set mark %d: %s", opts.FWMark, serr)
+							return
+						}
+					}
+					if opts.Interface != "" {
+						if serr = setSocketInterface(int(fd), opts.Interface); serr != nil {
+							log.Logf("[tcp] bind interface %s: %s", opts.Interface, serr)
+						}
+					}
+				}); err != nil {
+					return err
+				}
+				// fail the dial, otherwise the traffic bypasses the policy routing silently.
+				return serr
+			}
+		}
+		return d.Dial("tcp", addr)
 	}
 	return opts.Chain.Dial(addr)
 }
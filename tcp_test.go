@@ -0,0 +1,44 @@
+package gost
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTCPTransporterSourceIP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	addrc := make(chan net.Addr, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			addrc <- nil
+			return
+		}
+		defer conn.Close()
+		addrc <- conn.RemoteAddr()
+	}()
+
+	srcIP := net.ParseIP("127.0.0.2")
+	conn, err := TCPTransporter().Dial(ln.Addr().String(), WithDialSourceIP(srcIP))
+	if err != nil {
+		t.Skipf("bind to source %s: %v", srcIP, err)
+	}
+	defer conn.Close()
+
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(srcIP) {
+		t.Errorf("local address %s, want %s", ip, srcIP)
+	}
+
+	raddr := <-addrc
+	if raddr == nil {
+		t.Fatal("accept failed")
+	}
+	if ip := raddr.(*net.TCPAddr).IP; !ip.Equal(srcIP) {
+		t.Errorf("source address %s, want %s", ip, srcIP)
+	}
+}
@@ -0,0 +1,303 @@
+package gost
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// IPFilter decides whether the connections from an IP are blocked.
+type IPFilter interface {
+	Blocked(ip net.IP) bool
+}
+
+// FilteredListener wraps the listener to close the connections from the IPs blocked by the filter.
+func FilteredListener(ln Listener, filter IPFilter) Listener {
+	return &filteredListener{Listener: ln, filter: filter}
+}
+
+type filteredListener struct {
+	Listener
+	filter IPFilter
+}
+
+func (l *filteredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if ip := net.ParseIP(host); ip == nil || !l.filter.Blocked(ip) {
+			return conn, nil
+		}
+		if Debug {
+			log.Logf("[filter] %s - %s : blocked", conn.RemoteAddr(), conn.LocalAddr())
+		}
+		conn.Close()
+	}
+}
+
+// ThreatIntel is implemented by the filters of ThreatIntelFilter and LocalThreatFeed.
+type ThreatIntel interface {
+	IPFilter
+	// BlockedCount returns the number of the blocked connections.
+	BlockedCount() int64
+	// FeedLastUpdated returns the time that the feeds are loaded last, it is zero before the first load.
+	FeedLastUpdated() time.Time
+}
+
+// ipTrie is the binary radix trie of the IP prefixes, the IPv4 prefixes are stored as the IPv4-mapped IPv6.
+type ipTrie struct {
+	root ipTrieNode
+	size int
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	leaf     bool // the prefix ends at the node
+}
+
+func (t *ipTrie) insert(ipnet *net.IPNet) {
+	ones, bits := ipnet.Mask.Size()
+	ip := ipnet.IP.To16()
+	if bits == 32 {
+		ones += 96
+	}
+	n := &t.root
+	for i := 0; i < ones && !n.leaf; i++ {
+		b := ip[i/8] >> (7 - i%8) & 1
+		if n.children[b] == nil {
+			n.children[b] = &ipTrieNode{}
+		}
+		n = n.children[b]
+	}
+	if !n.leaf {
+		n.leaf = true
+		// the longer prefixes are covered.
+		n.children = [2]*ipTrieNode{}
+		t.size++
+	}
+}
+
+func (t *ipTrie) contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+	n := &t.root
+	for i := 0; n != nil; i++ {
+		if n.leaf {
+			return true
+		}
+		if i == 128 {
+			break
+		}
+		n = n.children[ip[i/8]>>(7-i%8)&1]
+	}
+	return false
+}
+
+// parseThreatFeed parses the IP list of the feed, one IP or CIDR per line,
+// the comments after # or ; are ignored, as well as the invalid lines.
+func parseThreatFeed(r io.Reader) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		s := fields[0]
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				continue
+			}
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		if _, ipnet, err := net.ParseCIDR(s); err == nil {
+			nets = append(nets, ipnet)
+		}
+	}
+	return nets, scanner.Err()
+}
+
+type threatIntelFilter struct {
+	trie    atomic.Value // *ipTrie
+	blocked int64
+	updated int64 // the unix nano time of the last load
+
+	feedURLs []string
+	feeds    map[string][]*net.IPNet // the last loaded IPs of the feeds
+	mux      sync.Mutex
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// ThreatIntelFilter creates an IPFilter that blocks the IPs of the threat intelligence feeds, such as
+// https://iplists.firehol.org/files/firehol_level1.netset, each feed is a list of IPs or CIDRs, one per line.
+// The feeds are downloaded in the background at once, then every refreshInterval (24 hours if not positive).
+// A feed failed to download keeps its previous IPs. It blocks nothing until the feeds are loaded.
+//
+// The filter implements ThreatIntel, and io.Closer to stop the refreshing.
+func ThreatIntelFilter(feedURLs []string, refreshInterval time.Duration) IPFilter {
+	if refreshInterval <= 0 {
+		refreshInterval = 24 * time.Hour
+	}
+	f := newThreatIntelFilter()
+	f.feedURLs = feedURLs
+	go f.refresh(refreshInterval)
+	return f
+}
+
+// LocalThreatFeed creates an IPFilter that blocks the IPs of the local feed file, for the offline use.
+// The file is in the same format as the feeds of ThreatIntelFilter, and it is loaded once.
+//
+// The filter implements ThreatIntel.
+func LocalThreatFeed(path string) IPFilter {
+	f := newThreatIntelFilter()
+	file, err := os.Open(path)
+	if err != nil {
+		log.Logf("[threat] %s", err)
+		return f
+	}
+	defer file.Close()
+
+	nets, err := parseThreatFeed(file)
+	if err != nil {
+		log.Logf("[threat] %s: %s", path, err)
+		return f
+	}
+	f.feeds[path] = nets
+	f.rebuild()
+	return f
+}
+
+func newThreatIntelFilter() *threatIntelFilter {
+	f := &threatIntelFilter{
+		feeds:   make(map[string][]*net.IPNet),
+		stopped: make(chan struct{}),
+	}
+	f.trie.Store(&ipTrie{})
+	return f
+}
+
+func (f *threatIntelFilter) Blocked(ip net.IP) bool {
+	if f.trie.Load().(*ipTrie).contains(ip) {
+		atomic.AddInt64(&f.blocked, 1)
+		return true
+	}
+	return false
+}
+
+func (f *threatIntelFilter) BlockedCount() int64 {
+	return atomic.LoadInt64(&f.blocked)
+}
+
+func (f *threatIntelFilter) FeedLastUpdated() time.Time {
+	if n := atomic.LoadInt64(&f.updated); n > 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+func (f *threatIntelFilter) Close() error {
+	f.once.Do(func() {
+		close(f.stopped)
+	})
+	return nil
+}
+
+func (f *threatIntelFilter) refresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		f.load()
+		select {
+		case <-ticker.C:
+		case <-f.stopped:
+			return
+		}
+	}
+}
+
+// load downloads the feeds, and rebuilds the trie if any feed is loaded.
+func (f *threatIntelFilter) load() {
+	var loaded bool
+	for _, u := range f.feedURLs {
+		nets, err := f.download(u)
+		if err != nil {
+			log.Logf("[threat] %s: %s", u, err)
+			continue
+		}
+		f.mux.Lock()
+		f.feeds[u] = nets
+		f.mux.Unlock()
+		loaded = true
+	}
+	if loaded {
+		f.rebuild()
+	}
+}
+
+func (f *threatIntelFilter) download(url string) ([]*net.IPNet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.stopped:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", DefaultProxyAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return parseThreatFeed(resp.Body)
+}
+
+func (f *threatIntelFilter) rebuild() {
+	trie := &ipTrie{}
+	f.mux.Lock()
+	for _, nets := range f.feeds {
+		for _, ipnet := range nets {
+			trie.insert(ipnet)
+		}
+	}
+	f.mux.Unlock()
+	f.trie.Store(trie)
+	atomic.StoreInt64(&f.updated, time.Now().UnixNano())
+	if Debug {
+		log.Logf("[threat] %d prefixes loaded", trie.size)
+	}
+}
@@ -0,0 +1,138 @@
+package gost
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const threatTestFeed = `# firehol_level1
+#
+0.0.0.0/8
+10.0.0.0/8 ; private
+192.0.2.1
+192.0.2.0/28
+2001:db8::/32
+not an ip
+`
+
+func TestThreatFeedTrie(t *testing.T) {
+	nets, err := parseThreatFeed(strings.NewReader(threatTestFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 5 {
+		t.Fatalf("got %d prefixes, want 5", len(nets))
+	}
+	trie := &ipTrie{}
+	for _, ipnet := range nets {
+		trie.insert(ipnet)
+	}
+
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.0.2.1", true},
+		{"192.0.2.15", true},
+		{"192.0.2.16", false},
+		{"0.1.2.3", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+	}
+	for _, tc := range tests {
+		if blocked := trie.contains(net.ParseIP(tc.ip)); blocked != tc.blocked {
+			t.Errorf("%s: got %v, want %v", tc.ip, blocked, tc.blocked)
+		}
+	}
+}
+
+func TestFilteredListenerLocalThreatFeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.netset")
+	if err := os.WriteFile(path, []byte("127.0.0.2/32\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filter := LocalThreatFeed(path)
+	ti := filter.(ThreatIntel)
+	if ti.FeedLastUpdated().IsZero() {
+		t.Error("the feed is not loaded")
+	}
+
+	ln, err := TCPListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = FilteredListener(ln, filter)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	read := func(localIP string) string {
+		d := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)}}
+		conn, err := d.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		b := make([]byte, 2)
+		n, _ := conn.Read(b)
+		return string(b[:n])
+	}
+	if s := read("127.0.0.1"); s != "ok" {
+		t.Errorf("127.0.0.1 got %q, want ok", s)
+	}
+	if s := read("127.0.0.2"); s != "" {
+		t.Errorf("127.0.0.2 should be blocked, got %q", s)
+	}
+	if n := ti.BlockedCount(); n != 1 {
+		t.Errorf("got blocked count %d, want 1", n)
+	}
+}
+
+func TestThreatIntelFilter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/level1.netset":
+			w.Write([]byte(threatTestFeed))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	filter := ThreatIntelFilter([]string{srv.URL + "/level1.netset", srv.URL + "/missing"}, time.Hour)
+	defer filter.(interface{ Close() error }).Close()
+	ti := filter.(ThreatIntel)
+	for i := 0; i < 50 && ti.FeedLastUpdated().IsZero(); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if ti.FeedLastUpdated().IsZero() {
+		t.Fatal("the feeds are not loaded")
+	}
+	if !filter.Blocked(net.ParseIP("10.0.0.1")) || filter.Blocked(net.ParseIP("8.8.8.8")) {
+		t.Error("unexpected filter result")
+	}
+	if n := ti.BlockedCount(); n != 1 {
+		t.Errorf("got blocked count %d, want 1", n)
+	}
+}
@@ -0,0 +1,147 @@
+package gost
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeACLAnyUser is the user of the rules applied to the users without their own rules.
+const TimeACLAnyUser = "*"
+
+type timeRule struct {
+	start, end time.Duration // the clock time since midnight
+	weekdays   map[time.Weekday]bool
+}
+
+// timeWindow is the cached decision of a user within [from, to).
+type timeWindow struct {
+	from, to time.Time
+	allowed  bool
+}
+
+// TimeACL is the time-based access control, the users are only allowed within the time of their rules.
+//
+// The time of the rules are evaluated in the timezone of the user, which is set by SetLocation,
+// or the location of the start time of the first rule if it is not set.
+// The users with no rules (and no rules of TimeACLAnyUser) are always allowed.
+type TimeACL struct {
+	mux       sync.RWMutex
+	rules     map[string][]timeRule
+	locations map[string]*time.Location
+	windows   map[string]timeWindow
+}
+
+// NewTimeACL creates a TimeACL.
+func NewTimeACL() *TimeACL {
+	return &TimeACL{
+		rules:     make(map[string][]timeRule),
+		locations: make(map[string]*time.Location),
+		windows:   make(map[string]timeWindow),
+	}
+}
+
+// AddRule allows the user from the clock time of start to the clock time of end on the weekdays,
+// the date of start and end are ignored. The rule crosses midnight if end is not after start,
+// and the weekday is the day it begins. All days are allowed if weekdays is empty.
+func (acl *TimeACL) AddRule(user string, start, end time.Time, weekdays []time.Weekday) {
+	rule := timeRule{
+		start: clockOf(start),
+		end:   clockOf(end),
+	}
+	if len(weekdays) > 0 {
+		rule.weekdays = make(map[time.Weekday]bool)
+		for _, d := range weekdays {
+			rule.weekdays[d] = true
+		}
+	}
+
+	acl.mux.Lock()
+	defer acl.mux.Unlock()
+	acl.rules[user] = append(acl.rules[user], rule)
+	if _, ok := acl.locations[user]; !ok {
+		acl.locations[user] = start.Location()
+	}
+	acl.windows = make(map[string]timeWindow)
+}
+
+// SetLocation sets the timezone of the user.
+func (acl *TimeACL) SetLocation(user string, loc *time.Location) {
+	acl.mux.Lock()
+	defer acl.mux.Unlock()
+	acl.locations[user] = loc
+	acl.windows = make(map[string]timeWindow)
+}
+
+// Allow reports whether the user is allowed at the time t.
+func (acl *TimeACL) Allow(user string, t time.Time) bool {
+	if acl == nil {
+		return true
+	}
+
+	acl.mux.RLock()
+	w, ok := acl.windows[user]
+	acl.mux.RUnlock()
+	if ok && !t.Before(w.from) && t.Before(w.to) {
+		return w.allowed
+	}
+
+	acl.mux.Lock()
+	defer acl.mux.Unlock()
+
+	key := user
+	rules := acl.rules[user]
+	if len(rules) == 0 {
+		key = TimeACLAnyUser
+		rules = acl.rules[key]
+	}
+	if len(rules) == 0 {
+		return true
+	}
+	loc := acl.locations[user]
+	if loc == nil {
+		loc = acl.locations[key]
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	w = evalTimeRules(rules, t.In(loc))
+	acl.windows[user] = w
+	return w.allowed
+}
+
+// evalTimeRules returns the window of the time t. If t is allowed, the window is the occurrence of a rule
+// containing t, otherwise the window lasts until the next occurrence of the rules.
+func evalTimeRules(rules []timeRule, t time.Time) timeWindow {
+	y, m, d := t.Date()
+	next := time.Time{}
+	// the rules occurred yesterday may cross midnight, a week later is the max gap between the occurrences.
+	for day := -1; day <= 7; day++ {
+		midnight := time.Date(y, m, d+day, 0, 0, 0, 0, t.Location())
+		for _, rule := range rules {
+			if rule.weekdays != nil && !rule.weekdays[midnight.Weekday()] {
+				continue
+			}
+			start := midnight.Add(rule.start)
+			end := midnight.Add(rule.end)
+			if !end.After(start) {
+				end = time.Date(y, m, d+day+1, 0, 0, 0, 0, t.Location()).Add(rule.end)
+			}
+			if !t.Before(start) && t.Before(end) {
+				return timeWindow{from: start, to: end, allowed: true}
+			}
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	if next.IsZero() {
+		next = t.Add(24 * time.Hour)
+	}
+	return timeWindow{from: t, to: next}
+}
+
+func clockOf(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
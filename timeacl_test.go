@@ -0,0 +1,106 @@
+package gost
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTimeACL(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+
+	acl := NewTimeACL()
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	acl.AddRule("alice", time.Date(0, 1, 1, 9, 0, 0, 0, time.UTC), time.Date(0, 1, 1, 17, 0, 0, 0, time.UTC), weekdays)
+	acl.AddRule("bob", time.Date(0, 1, 1, 22, 0, 0, 0, time.UTC), time.Date(0, 1, 1, 6, 0, 0, 0, time.UTC), []time.Weekday{time.Friday})
+	acl.SetLocation("bob", tokyo)
+	acl.AddRule(TimeACLAnyUser, time.Date(0, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(0, 1, 1, 13, 0, 0, 0, time.UTC), nil)
+
+	// 2024-01-05 is Friday.
+	tests := []struct {
+		user  string
+		t     time.Time
+		allow bool
+	}{
+		{"alice", time.Date(2024, 1, 5, 8, 59, 59, 0, time.UTC), false},
+		{"alice", time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC), true},
+		{"alice", time.Date(2024, 1, 5, 16, 59, 59, 0, time.UTC), true},
+		{"alice", time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC), false},
+		{"alice", time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC), false},
+		// the time in another timezone is converted.
+		{"alice", time.Date(2024, 1, 5, 18, 0, 0, 0, tokyo), true},
+		// bob is allowed from Friday 22:00 to Saturday 06:00 in Tokyo.
+		{"bob", time.Date(2024, 1, 5, 22, 30, 0, 0, tokyo), true},
+		{"bob", time.Date(2024, 1, 5, 13, 30, 0, 0, time.UTC), true},
+		{"bob", time.Date(2024, 1, 6, 5, 59, 0, 0, tokyo), true},
+		{"bob", time.Date(2024, 1, 6, 6, 0, 0, 0, tokyo), false},
+		{"bob", time.Date(2024, 1, 5, 22, 30, 0, 0, time.UTC), false},
+		// the users without their own rules.
+		{"carol", time.Date(2024, 1, 6, 12, 30, 0, 0, time.UTC), true},
+		{"carol", time.Date(2024, 1, 6, 13, 30, 0, 0, time.UTC), false},
+	}
+	for i, tc := range tests {
+		if allow := acl.Allow(tc.user, tc.t); allow != tc.allow {
+			t.Errorf("#%d: %s at %s: got %v, want %v", i, tc.user, tc.t, allow, tc.allow)
+		}
+	}
+
+	// the cached window.
+	w := acl.windows["alice"]
+	if !w.allowed || !w.from.Equal(time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)) || !w.to.Equal(time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("got window [%s, %s)", w.from, w.to)
+	}
+	// the denied window lasts until the next occurrence.
+	acl.Allow("alice", time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC))
+	w = acl.windows["alice"]
+	if w.allowed || !w.to.Equal(time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("got window [%s, %s)", w.from, w.to)
+	}
+
+	if !NewTimeACL().Allow("alice", time.Now()) {
+		t.Error("empty ACL should allow all users")
+	}
+}
+
+func TestTimeACLHandler(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	now := time.Now()
+	acl := NewTimeACL()
+	acl.AddRule("alice", now.Add(-time.Hour), now.Add(time.Hour), nil)
+	acl.AddRule("bob", now.Add(time.Hour), now.Add(2*time.Hour), nil)
+	users := []*url.Userinfo{url.UserPassword("alice", "123456"), url.UserPassword("bob", "654321")}
+
+	for _, tc := range []struct {
+		name      string
+		connector func(user *url.Userinfo) Connector
+		handler   func(opts ...HandlerOption) Handler
+	}{
+		{"http", HTTPConnector, HTTPHandler},
+		{"socks5", SOCKS5Connector, SOCKS5Handler},
+	} {
+		ln, err := TCPListener("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &Server{
+			Listener: ln,
+			Handler:  tc.handler(UsersHandlerOption(users...), TimeACLHandlerOption(acl)),
+		}
+		go server.Run()
+
+		for i, user := range users {
+			client := &Client{Connector: tc.connector(user), Transporter: TCPTransporter()}
+			err := proxyRoundtrip(client, server, httpSrv.URL, []byte("hello"))
+			if i == 0 && err != nil {
+				t.Errorf("%s: %s: %v", tc.name, user.Username(), err)
+			}
+			if i == 1 && err == nil {
+				t.Errorf("%s: %s should not be allowed", tc.name, user.Username())
+			}
+		}
+		server.Close()
+	}
+}
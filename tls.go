@@ -1,8 +1,10 @@
 package gost
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
+	"math/big"
 	"net"
 	"sync"
 	"time"
@@ -12,13 +14,56 @@ import (
 	smux "github.com/xtaci/smux"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("tls", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return TLSTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			tlsOpts := opts.TLSListenerOptions
+			if flow := node.Get("flow"); flow != "" {
+				tlsOpts = append(tlsOpts[:len(tlsOpts):len(tlsOpts)], WithXTLSServerFlow(flow))
+			}
+			return TLSListener(node.Addr, opts.TLSConfig, tlsOpts...)
+		},
+		TLS: true,
+	}, "https")
+	DefaultRegistry.RegisterTransport("mtls", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return MTLSTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return MTLSListener(node.Addr, opts.TLSConfig, opts.TLSListenerOptions...)
+		},
+		TLS: true,
+	})
+}
+
 type tlsTransporter struct {
 	tcpTransporter
+	options TransporterOptions
 }
 
 // TLSTransporter creates a Transporter that is used by TLS proxy client.
-func TLSTransporter() Transporter {
-	return &tlsTransporter{}
+func TLSTransporter(opts ...TransporterOption) Transporter {
+	tr := &tlsTransporter{}
+	for _, opt := range opts {
+		opt(&tr.options)
+	}
+	return tr
+}
+
+func (tr *tlsTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	conn, err := tr.tcpTransporter.Dial(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &echRedialConn{
+		Conn: conn,
+		redial: func() (net.Conn, error) {
+			return tr.tcpTransporter.Dial(addr, options...)
+		},
+	}, nil
 }
 
 func (tr *tlsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
@@ -26,29 +71,61 @@ func (tr *tlsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (
 	for _, option := range options {
 		option(opts)
 	}
+	var redial func() (net.Conn, error)
+	if rc, ok := conn.(*echRedialConn); ok {
+		conn, redial = rc.Conn, rc.redial
+	}
 	if opts.TLSConfig == nil {
 		opts.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	opts.TLSConfig = withSessionCache(opts.TLSConfig, tr.options.sessionCache)
 
 	timeout := opts.Timeout
 	if timeout <= 0 {
 		timeout = HandshakeTimeout
 	}
 
-	return wrapTLSClient(conn, opts.TLSConfig, timeout)
+	if len(opts.ECHConfigList) > 0 {
+		addr := opts.Addr
+		if addr == "" {
+			addr = conn.RemoteAddr().String()
+		}
+		cc, err := echHandshake(conn, opts.TLSConfig, opts.ECHConfigList, addr, timeout, redial)
+		if err != nil {
+			return nil, err
+		}
+		return writeEarlyData(cc, opts.EarlyData)
+	}
+	if opts.XTLSFlow != "" {
+		cc, err := xtlsClient(conn, opts.TLSConfig, opts.XTLSFlow, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return writeEarlyData(cc, opts.EarlyData)
+	}
+	cc, err := wrapTLSClient(conn, opts.TLSConfig, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return writeEarlyData(cc, opts.EarlyData)
 }
 
 type mtlsTransporter struct {
 	tcpTransporter
 	sessions     map[string]*muxSession
 	sessionMutex sync.Mutex
+	options      TransporterOptions
 }
 
 // MTLSTransporter creates a Transporter that is used by multiplex-TLS proxy client.
-func MTLSTransporter() Transporter {
-	return &mtlsTransporter{
+func MTLSTransporter(opts ...TransporterOption) Transporter {
+	tr := &mtlsTransporter{
 		sessions: make(map[string]*muxSession),
 	}
+	for _, opt := range opts {
+		opt(&tr.options)
+	}
+	return tr
 }
 
 func (tr *mtlsTransporter) Dial(addr string, options ...DialOption) (conn net.Conn, err error) {
@@ -130,6 +207,7 @@ func (tr *mtlsTransporter) initSession(addr string, conn net.Conn, opts *Handsha
 	if opts.TLSConfig == nil {
 		opts.TLSConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	opts.TLSConfig = withSessionCache(opts.TLSConfig, tr.options.sessionCache)
 	conn, err := wrapTLSClient(conn, opts.TLSConfig, opts.Timeout)
 	if err != nil {
 		return nil, err
@@ -153,19 +231,58 @@ type tlsListener struct {
 }
 
 // TLSListener creates a Listener for TLS proxy server.
-func TLSListener(addr string, config *tls.Config) (Listener, error) {
+func TLSListener(addr string, config *tls.Config, opts ...TLSListenerOption) (Listener, error) {
+	options := &TLSListenerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.Accept0RTT {
+		log.Logf("[tls] %s: 0-RTT is not supported, the early data is rejected", addr)
+	}
+
 	if config == nil {
 		config = DefaultTLSConfig
 	}
+	config = tlsPolicyConfig(config, options)
+	if options.XTLSFlow != "" {
+		if err := checkXTLSFlow(options.XTLSFlow); err != nil {
+			return nil, err
+		}
+	}
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	ln = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, config)
+	if options.XTLSFlow != "" {
+		return &tlsListener{&xtlsListener{
+			Listener: tcpKeepAliveListener{ln.(*net.TCPListener)},
+			config:   ja3TLSConfig(config, addr),
+		}}, nil
+	}
+	ln = tls.NewListener(&clientHelloListener{tcpKeepAliveListener{ln.(*net.TCPListener)}}, ja3TLSConfig(config, addr))
 	return &tlsListener{ln}, nil
 }
 
+// ja3TLSConfig returns a copy of the config which logs the JA3 fingerprint of the clients in debug mode.
+func ja3TLSConfig(config *tls.Config, addr string) *tls.Config {
+	config = config.Clone()
+	getConfigForClient := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if c, ok := hello.Conn.(*clientHelloConn); ok {
+			defer c.release()
+		}
+		if Debug {
+			log.Logf("[tls] %s - %s: JA3 %s", hello.Conn.RemoteAddr(), addr, JA3Fingerprint(hello))
+		}
+		if getConfigForClient != nil {
+			return getConfigForClient(hello)
+		}
+		return nil, nil
+	}
+	return config
+}
+
 type mtlsListener struct {
 	ln       net.Listener
 	connChan chan net.Conn
@@ -173,10 +290,15 @@ type mtlsListener struct {
 }
 
 // MTLSListener creates a Listener for multiplex-TLS proxy server.
-func MTLSListener(addr string, config *tls.Config) (Listener, error) {
+func MTLSListener(addr string, config *tls.Config, opts ...TLSListenerOption) (Listener, error) {
+	options := &TLSListenerOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
 	if config == nil {
 		config = DefaultTLSConfig
 	}
+	config = tlsPolicyConfig(config, options)
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -326,3 +448,61 @@ func wrapTLSClient(conn net.Conn, tlsConfig *tls.Config, timeout time.Duration)
 
 	return tlsConn, err
 }
+
+// RandomizedTLSConfig returns a copy of the base config with the randomized ClientHello parameters,
+// so the TLS fingerprint (e.g. JA3) of the client varies between the connections.
+// It should be called for each connection, as tls.Config does not provide a per-connection hook for the client.
+//
+// The TLS 1.2 cipher suites are a random subset of the base (or default) ones, the curve preferences
+// are shuffled, and the session ticket extension is randomly omitted. crypto/tls does not allow to reorder
+// the extensions or set the session ID (which is already random for TLS 1.3), the varied set of the parameters
+// is used instead. All the randomness comes from crypto/rand.
+func RandomizedTLSConfig(base *tls.Config) *tls.Config {
+	if base == nil {
+		base = &tls.Config{}
+	}
+	config := base.Clone()
+
+	suites := config.CipherSuites
+	if len(suites) == 0 {
+		for _, cs := range tls.CipherSuites() {
+			suites = append(suites, cs.ID)
+		}
+	}
+	suites = append([]uint16{}, suites...)
+	shuffle(len(suites), func(i, j int) { suites[i], suites[j] = suites[j], suites[i] })
+	// keeps at least half of the suites.
+	config.CipherSuites = suites[:(len(suites)+1)/2+randIntn(len(suites)/2+1)]
+
+	curves := config.CurvePreferences
+	if len(curves) == 0 {
+		curves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521}
+	}
+	curves = append([]tls.CurveID{}, curves...)
+	shuffle(len(curves), func(i, j int) { curves[i], curves[j] = curves[j], curves[i] })
+	config.CurvePreferences = curves
+
+	if !config.SessionTicketsDisabled {
+		config.SessionTicketsDisabled = randIntn(2) == 0
+	}
+	return config
+}
+
+// randIntn returns a uniform random number in [0, n) from crypto/rand.
+func randIntn(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(v.Int64())
+}
+
+// shuffle is the Fisher-Yates shuffle with crypto/rand.
+func shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, randIntn(i+1))
+	}
+}
@@ -0,0 +1,112 @@
+package gost
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// WithForwardSecrecyOnly restricts the TLS 1.2 cipher suites of the listener to the ECDHE based suites if strict is true,
+// and rejects the clients of TLS 1.1 or lower. The suites of TLS 1.3 always have forward secrecy.
+func WithForwardSecrecyOnly(strict bool) TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		if !strict {
+			return
+		}
+		opts.CipherSuites = forwardSecrecyCipherSuites()
+		if opts.MinVersion < tls.VersionTLS12 {
+			opts.MinVersion = tls.VersionTLS12
+		}
+	}
+}
+
+// WithTLS13Only rejects the clients of TLS 1.2 or lower.
+func WithTLS13Only() TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		opts.MinVersion = tls.VersionTLS13
+	}
+}
+
+func tlsMinVersionOption(version uint16) TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		if opts.MinVersion < version {
+			opts.MinVersion = version
+		}
+	}
+}
+
+func tlsCipherSuitesOption(suites []uint16) TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		opts.CipherSuites = suites
+	}
+}
+
+// ParseTLSListenerOptions parses the options of the tls-min-version and tls-cipher-suites parameters of the node.
+//
+// The minVersion is one of 1.0, 1.1, 1.2 and 1.3.
+// The cipherSuites is 'ecdhe' for WithForwardSecrecyOnly, or a comma-separated list of
+// the cipher suite names, e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
+func ParseTLSListenerOptions(minVersion, cipherSuites string) ([]TLSListenerOption, error) {
+	var opts []TLSListenerOption
+
+	switch minVersion {
+	case "":
+	case "1.0":
+		opts = append(opts, tlsMinVersionOption(tls.VersionTLS10))
+	case "1.1":
+		opts = append(opts, tlsMinVersionOption(tls.VersionTLS11))
+	case "1.2":
+		opts = append(opts, tlsMinVersionOption(tls.VersionTLS12))
+	case "1.3":
+		opts = append(opts, WithTLS13Only())
+	default:
+		return nil, fmt.Errorf("invalid TLS version %s", minVersion)
+	}
+
+	switch cipherSuites {
+	case "":
+	case "ecdhe":
+		opts = append(opts, WithForwardSecrecyOnly(true))
+	default:
+		ids := make(map[string]uint16)
+		for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			ids[cs.Name] = cs.ID
+		}
+		var suites []uint16
+		for _, name := range strings.Split(cipherSuites, ",") {
+			id, ok := ids[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite %s", name)
+			}
+			suites = append(suites, id)
+		}
+		opts = append(opts, tlsCipherSuitesOption(suites))
+	}
+	return opts, nil
+}
+
+// forwardSecrecyCipherSuites returns the secure TLS 1.2 cipher suites with the ECDHE key exchange.
+func forwardSecrecyCipherSuites() []uint16 {
+	var suites []uint16
+	for _, cs := range tls.CipherSuites() {
+		if strings.HasPrefix(cs.Name, "TLS_ECDHE_") {
+			suites = append(suites, cs.ID)
+		}
+	}
+	return suites
+}
+
+// tlsPolicyConfig returns a copy of the config with the version and the cipher suites of the options.
+func tlsPolicyConfig(config *tls.Config, opts *TLSListenerOptions) *tls.Config {
+	if opts.MinVersion == 0 && opts.CipherSuites == nil {
+		return config
+	}
+	config = config.Clone()
+	if opts.MinVersion > config.MinVersion {
+		config.MinVersion = opts.MinVersion
+	}
+	if opts.CipherSuites != nil {
+		config.CipherSuites = opts.CipherSuites
+	}
+	return config
+}
@@ -0,0 +1,103 @@
+package gost
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+// tlsPolicyHandshake connects to the TLS listener with the client config,
+// the server also enables the RSA key exchange which is disabled by default.
+func tlsPolicyHandshake(t *testing.T, opts []TLSListenerOption, config *tls.Config) error {
+	serverConfig := DefaultTLSConfig.Clone()
+	serverConfig.CipherSuites = append(forwardSecrecyCipherSuites(), tls.TLS_RSA_WITH_AES_128_GCM_SHA256)
+	ln, err := TLSListener("127.0.0.1:0", serverConfig, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	config.InsecureSkipVerify = true
+	return tls.Client(conn, config).Handshake()
+}
+
+func TestTLSPolicy(t *testing.T) {
+	rsaKex := []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}
+	tests := []struct {
+		name   string
+		opts   []TLSListenerOption
+		config *tls.Config
+		ok     bool
+	}{
+		{"default", nil, &tls.Config{}, true},
+		{"rsa kex", nil, &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: rsaKex}, true},
+		{"fs rsa kex", []TLSListenerOption{WithForwardSecrecyOnly(true)}, &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: rsaKex}, false},
+		{"fs not strict", []TLSListenerOption{WithForwardSecrecyOnly(false)}, &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: rsaKex}, true},
+		{"fs ecdhe", []TLSListenerOption{WithForwardSecrecyOnly(true)}, &tls.Config{MaxVersion: tls.VersionTLS12}, true},
+		{"fs tls1.1", []TLSListenerOption{WithForwardSecrecyOnly(true)}, &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}, false},
+		{"tls1.3 only", []TLSListenerOption{WithTLS13Only()}, &tls.Config{MaxVersion: tls.VersionTLS12}, false},
+		{"tls1.3", []TLSListenerOption{WithTLS13Only(), WithForwardSecrecyOnly(true)}, &tls.Config{}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tlsPolicyHandshake(t, tc.opts, tc.config)
+			if tc.ok && err != nil {
+				t.Errorf("handshake: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("the handshake should be rejected")
+			}
+		})
+	}
+}
+
+func TestParseTLSListenerOptions(t *testing.T) {
+	tests := []struct {
+		minVersion, cipherSuites string
+		want                     TLSListenerOptions
+		ok                       bool
+	}{
+		{"", "", TLSListenerOptions{}, true},
+		{"1.3", "", TLSListenerOptions{MinVersion: tls.VersionTLS13}, true},
+		{"1.3", "ecdhe", TLSListenerOptions{MinVersion: tls.VersionTLS13, CipherSuites: forwardSecrecyCipherSuites()}, true},
+		{"1.1", "ecdhe", TLSListenerOptions{MinVersion: tls.VersionTLS12, CipherSuites: forwardSecrecyCipherSuites()}, true},
+		{"", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_RSA_WITH_AES_128_GCM_SHA256", TLSListenerOptions{
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+		}, true},
+		{"1.4", "", TLSListenerOptions{}, false},
+		{"", "TLS_UNKNOWN", TLSListenerOptions{}, false},
+	}
+	for _, tc := range tests {
+		opts, err := ParseTLSListenerOptions(tc.minVersion, tc.cipherSuites)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q %q: unexpected error %v", tc.minVersion, tc.cipherSuites, err)
+			continue
+		}
+		var got TLSListenerOptions
+		for _, opt := range opts {
+			opt(&got)
+		}
+		if got.MinVersion != tc.want.MinVersion || len(got.CipherSuites) != len(tc.want.CipherSuites) {
+			t.Errorf("%q %q: got %+v, want %+v", tc.minVersion, tc.cipherSuites, got, tc.want)
+			continue
+		}
+		for i := range got.CipherSuites {
+			if got.CipherSuites[i] != tc.want.CipherSuites[i] {
+				t.Errorf("%q %q: got %+v, want %+v", tc.minVersion, tc.cipherSuites, got, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux && !tproxy_iptables && !tproxy_nftables
+// +build linux,!tproxy_iptables,!tproxy_nftables
+
+package gost
+
+import "sync"
+
+var tproxyBackend struct {
+	once sync.Once
+	name string
+}
+
+// TProxyBackend returns the backend of the transparent proxy rules, 'nftables' or 'iptables'.
+// It can be selected by the build tag tproxy_nftables or tproxy_iptables,
+// or nftables is used if it is supported by the kernel.
+func TProxyBackend() string {
+	tproxyBackend.once.Do(func() {
+		tproxyBackend.name = "iptables"
+		if nftablesSupported() {
+			tproxyBackend.name = "nftables"
+		}
+	})
+	return tproxyBackend.name
+}
@@ -0,0 +1,9 @@
+//go:build linux && tproxy_nftables && !tproxy_iptables
+// +build linux,tproxy_nftables,!tproxy_iptables
+
+package gost
+
+// TProxyBackend returns the backend of the transparent proxy rules, it is selected by the build tag tproxy_nftables.
+func TProxyBackend() string {
+	return "nftables"
+}
@@ -0,0 +1,232 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-log/log"
+)
+
+const (
+	// tproxyMark is the firewall mark of the packets to the transparent proxy.
+	tproxyMark = "0x1"
+	// tproxyRouteTable is the routing table which delivers the marked packets locally.
+	tproxyRouteTable = "100"
+	// tproxyChainPrefix is the prefix of the iptables chains in the mangle table.
+	tproxyChainPrefix = "GOST_TPROXY_"
+)
+
+// tproxyRule is a rule of a chain in the mangle table.
+type tproxyRule struct {
+	chain string
+	spec  []string
+}
+
+// tproxyChains returns the names of the chains for the packets from the other hosts (PREROUTING)
+// and the local processes (OUTPUT).
+func tproxyChains(listenPort int) (prerouting, output string) {
+	port := strconv.Itoa(listenPort)
+	return tproxyChainPrefix + port, tproxyChainPrefix + "OUT_" + port
+}
+
+// tproxyReserved are the destinations which are not proxied.
+func tproxyReserved(proto iptables.Protocol) []string {
+	if proto == iptables.ProtocolIPv6 {
+		return []string{"::1/128", "fe80::/10", "ff00::/8"}
+	}
+	return []string{"0.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "224.0.0.0/4", "255.255.255.255/32"}
+}
+
+// tproxyRules returns the rules of the chains, the TCP and UDP packets are delivered to the listenPort
+// by the TPROXY target, and the packets of the local processes are marked to be routed to the loopback,
+// except the packets of the excludeUIDs.
+func tproxyRules(proto iptables.Protocol, listenPort int, excludeUIDs []int) []tproxyRule {
+	prerouting, output := tproxyChains(listenPort)
+	port := strconv.Itoa(listenPort)
+
+	var rules []tproxyRule
+	for _, dst := range tproxyReserved(proto) {
+		rules = append(rules, tproxyRule{prerouting, []string{"-d", dst, "-j", "RETURN"}})
+	}
+	for _, p := range []string{"tcp", "udp"} {
+		rules = append(rules, tproxyRule{prerouting, []string{
+			"-p", p, "-j", "TPROXY", "--on-port", port, "--tproxy-mark", tproxyMark + "/" + tproxyMark,
+		}})
+	}
+
+	for _, uid := range excludeUIDs {
+		rules = append(rules, tproxyRule{output, []string{
+			"-m", "owner", "--uid-owner", strconv.Itoa(uid), "-j", "RETURN",
+		}})
+	}
+	for _, dst := range tproxyReserved(proto) {
+		rules = append(rules, tproxyRule{output, []string{"-d", dst, "-j", "RETURN"}})
+	}
+	for _, p := range []string{"tcp", "udp"} {
+		rules = append(rules, tproxyRule{output, []string{
+			"-p", p, "-j", "MARK", "--set-mark", tproxyMark,
+		}})
+	}
+	return rules
+}
+
+// SetupTProxy adds the iptables and ip6tables rules (in the mangle table) and the policy routing
+// which redirect the TCP and UDP traffic, of both the other hosts and the local processes, to the
+// transparent proxy (e.g. the red and redu handler with the tproxy option) listening on listenPort.
+//
+// The traffic of the processes of excludeUIDs are not redirected, it must include the user of the proxy
+// to prevent the loop. The rules are replaced if they exist, so it can be called repeatedly.
+//
+// It requires the CAP_NET_ADMIN capability. The IPv6 rules are skipped if ip6tables is not available.
+func SetupTProxy(listenPort int, excludeUIDs []int) error {
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			if proto == iptables.ProtocolIPv6 {
+				log.Logf("[tproxy] ip6tables: %v, IPv6 is skipped", err)
+				continue
+			}
+			return err
+		}
+		if err := setupTProxyRules(ipt, listenPort, excludeUIDs); err != nil {
+			return err
+		}
+		if err := setupTProxyRoute(proto); err != nil {
+			return err
+		}
+	}
+	log.Logf("[tproxy] rules of port %d are set up", listenPort)
+	return nil
+}
+
+// TeardownTProxy removes the rules added by SetupTProxy. The policy routing is removed
+// if the rules of the other ports do not exist. It does nothing if the rules do not exist.
+func TeardownTProxy(listenPort int) error {
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		ipt, err := iptables.NewWithProtocol(proto)
+		if err != nil {
+			if proto == iptables.ProtocolIPv6 {
+				continue
+			}
+			return err
+		}
+		inUse, err := teardownTProxyRules(ipt, listenPort)
+		if err != nil {
+			return err
+		}
+		if !inUse {
+			teardownTProxyRoute(proto)
+		}
+	}
+	log.Logf("[tproxy] rules of port %d are removed", listenPort)
+	return nil
+}
+
+// SetupTransparentProxy sets up the rules for the transparent proxy listening on listenPort with the backend
+// reported by TProxyBackend. The nftables rules are added in the table 'gost' and the chain 'tproxy_<port>'.
+func SetupTransparentProxy(listenPort int, excludeUIDs []int) error {
+	if TProxyBackend() == "nftables" {
+		return SetupNFTProxy("gost", "tproxy_"+strconv.Itoa(listenPort), listenPort, excludeUIDs)
+	}
+	return SetupTProxy(listenPort, excludeUIDs)
+}
+
+// TeardownTransparentProxy removes the rules added by SetupTransparentProxy.
+func TeardownTransparentProxy(listenPort int) error {
+	if TProxyBackend() == "nftables" {
+		return TeardownNFTProxy("gost", "tproxy_"+strconv.Itoa(listenPort), listenPort)
+	}
+	return TeardownTProxy(listenPort)
+}
+
+func setupTProxyRules(ipt *iptables.IPTables, listenPort int, excludeUIDs []int) error {
+	prerouting, output := tproxyChains(listenPort)
+	for _, chain := range []string{prerouting, output} {
+		// the chain is created, or flushed if it exists.
+		if err := ipt.ClearChain("mangle", chain); err != nil {
+			return err
+		}
+	}
+	for _, rule := range tproxyRules(ipt.Proto(), listenPort, excludeUIDs) {
+		if err := ipt.Append("mangle", rule.chain, rule.spec...); err != nil {
+			return err
+		}
+	}
+	if err := ipt.AppendUnique("mangle", "PREROUTING", "-j", prerouting); err != nil {
+		return err
+	}
+	return ipt.AppendUnique("mangle", "OUTPUT", "-j", output)
+}
+
+// teardownTProxyRules removes the chains of the listenPort, and reports whether the chains of the other ports exist.
+func teardownTProxyRules(ipt *iptables.IPTables, listenPort int) (inUse bool, err error) {
+	prerouting, output := tproxyChains(listenPort)
+	if err = ipt.DeleteIfExists("mangle", "PREROUTING", "-j", prerouting); err != nil {
+		return
+	}
+	if err = ipt.DeleteIfExists("mangle", "OUTPUT", "-j", output); err != nil {
+		return
+	}
+
+	chains, err := ipt.ListChains("mangle")
+	if err != nil {
+		return
+	}
+	for _, chain := range chains {
+		switch {
+		case chain == prerouting || chain == output:
+			if err = ipt.ClearAndDeleteChain("mangle", chain); err != nil {
+				return
+			}
+		case strings.HasPrefix(chain, tproxyChainPrefix):
+			inUse = true
+		}
+	}
+	return
+}
+
+func tproxyIPCmd(proto iptables.Protocol) []string {
+	if proto == iptables.ProtocolIPv6 {
+		return []string{"ip", "-6"}
+	}
+	return []string{"ip"}
+}
+
+// setupTProxyRoute routes the marked packets to the loopback, so they are received by the transparent proxy.
+func setupTProxyRoute(proto iptables.Protocol) error {
+	teardownTProxyRoute(proto)
+
+	dst := "0.0.0.0/0"
+	if proto == iptables.ProtocolIPv6 {
+		dst = "::/0"
+	}
+	cmds := [][]string{
+		{"rule", "add", "fwmark", tproxyMark, "lookup", tproxyRouteTable},
+		{"route", "replace", "local", dst, "dev", "lo", "table", tproxyRouteTable},
+	}
+	for _, args := range cmds {
+		args = append(tproxyIPCmd(proto), args...)
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func teardownTProxyRoute(proto iptables.Protocol) {
+	// the rule may be added more than once by the others.
+	for i := 0; i < 16; i++ {
+		args := append(tproxyIPCmd(proto), "rule", "del", "fwmark", tproxyMark, "lookup", tproxyRouteTable)
+		if exec.Command(args[0], args[1:]...).Run() != nil {
+			break
+		}
+	}
+	args := append(tproxyIPCmd(proto), "route", "flush", "table", tproxyRouteTable)
+	exec.Command(args[0], args[1:]...).Run()
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/google/nftables/expr"
+)
+
+func TestTProxyRules(t *testing.T) {
+	rules := tproxyRules(iptables.ProtocolIPv4, 12345, []int{0, 1000})
+
+	var prerouting, output []string
+	for _, rule := range rules {
+		spec := strings.Join(rule.spec, " ")
+		switch rule.chain {
+		case "GOST_TPROXY_12345":
+			prerouting = append(prerouting, spec)
+		case "GOST_TPROXY_OUT_12345":
+			output = append(output, spec)
+		default:
+			t.Errorf("unexpected chain %s", rule.chain)
+		}
+	}
+
+	if n := len(prerouting); n < 2 ||
+		prerouting[n-2] != "-p tcp -j TPROXY --on-port 12345 --tproxy-mark 0x1/0x1" ||
+		prerouting[n-1] != "-p udp -j TPROXY --on-port 12345 --tproxy-mark 0x1/0x1" {
+		t.Errorf("prerouting rules %q", prerouting)
+	}
+	// the excluded users are returned before the packets are marked.
+	if len(output) < 4 ||
+		output[0] != "-m owner --uid-owner 0 -j RETURN" ||
+		output[1] != "-m owner --uid-owner 1000 -j RETURN" ||
+		output[len(output)-1] != "-p udp -j MARK --set-mark 0x1" {
+		t.Errorf("output rules %q", output)
+	}
+
+	for _, rule := range tproxyRules(iptables.ProtocolIPv6, 12345, nil) {
+		if strings.Contains(strings.Join(rule.spec, " "), "127.0.0.0/8") {
+			t.Errorf("IPv4 address in the IPv6 rule %q", rule.spec)
+		}
+	}
+}
+
+func TestNFTProxyRules(t *testing.T) {
+	table, prerouting, output := nftProxyChains("gost", "tproxy")
+	if output.Name != "tproxy_out" {
+		t.Errorf("output chain %s", output.Name)
+	}
+	rules := nftProxyRules(table, prerouting, output, 12345, []int{1000})
+
+	var tproxies, uids int
+	for _, rule := range rules {
+		if !bytes.Equal(rule.UserData, []byte("gost:tproxy:12345")) {
+			t.Errorf("rule tag %q", rule.UserData)
+		}
+		for i, e := range rule.Exprs {
+			switch e := e.(type) {
+			case *expr.TProxy:
+				tproxies++
+				if rule.Chain != prerouting {
+					t.Error("tproxy in the output chain")
+				}
+				if port := rule.Exprs[i-1].(*expr.Immediate).Data; !bytes.Equal(port, []byte{0x30, 0x39}) {
+					t.Errorf("tproxy port %v", port)
+				}
+			case *expr.Meta:
+				if e.Key == expr.MetaKeySKUID {
+					uids++
+					if rule.Chain != output {
+						t.Error("uid rule in the prerouting chain")
+					}
+				}
+			}
+		}
+	}
+	for _, rule := range rules {
+		if rule.Chain == output {
+			if m, ok := rule.Exprs[0].(*expr.Meta); !ok || m.Key != expr.MetaKeySKUID {
+				t.Error("the excluded users should be returned first in the output chain")
+			}
+			break
+		}
+	}
+	if tproxies != 2 || uids != 1 {
+		t.Errorf("tproxy rules %d, uid rules %d", tproxies, uids)
+	}
+}
@@ -0,0 +1,224 @@
+//go:build linux
+// +build linux
+
+package gost
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-log/log"
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// SetupNFTProxy is the same as SetupTProxy, but the rules are added in the chains of the dedicated nftables table
+// (of the inet family), which is created if it does not exist. The chain is hooked on prerouting, and the chain
+// suffixed with '_out' is hooked on output.
+//
+// The rules are tagged with the listenPort, they are replaced if they exist.
+// It requires the CAP_NET_ADMIN capability.
+func SetupNFTProxy(table, chain string, listenPort int, excludeUIDs []int) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	t, prerouting, output := nftProxyChains(table, chain)
+	conn.AddTable(t)
+	conn.AddChain(prerouting)
+	conn.AddChain(output)
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: %s: %v", table, err)
+	}
+
+	if err := delNFTProxyRules(conn, t, []*nftables.Chain{prerouting, output}, listenPort); err != nil {
+		return err
+	}
+	for _, rule := range nftProxyRules(t, prerouting, output, listenPort, excludeUIDs) {
+		conn.AddRule(rule)
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: %s: %v", table, err)
+	}
+
+	for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+		if err := setupTProxyRoute(proto); err != nil {
+			return err
+		}
+	}
+	log.Logf("[tproxy] nftables rules of port %d are set up in %s", listenPort, table)
+	return nil
+}
+
+// TeardownNFTProxy removes the rules of listenPort added by SetupNFTProxy, the chains and the table are deleted
+// if they are empty. It does nothing if the rules do not exist.
+func TeardownNFTProxy(table, chain string, listenPort int) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	t, prerouting, output := nftProxyChains(table, chain)
+	chains, err := conn.ListChainsOfTableFamily(t.Family)
+	if err != nil {
+		return fmt.Errorf("nftables: %v", err)
+	}
+	var found []*nftables.Chain
+	for _, c := range chains {
+		if c.Table.Name == table && (c.Name == prerouting.Name || c.Name == output.Name) {
+			found = append(found, c)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	if err := delNFTProxyRules(conn, t, found, listenPort); err != nil {
+		return err
+	}
+
+	inUse := false
+	for _, c := range found {
+		rules, err := conn.GetRules(t, c)
+		if err != nil {
+			return fmt.Errorf("nftables: %s: %v", c.Name, err)
+		}
+		if len(rules) > 0 {
+			inUse = true
+			continue
+		}
+		conn.DelChain(c)
+	}
+	if !inUse && len(found) == len(chains) {
+		conn.DelTable(t)
+	}
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("nftables: %s: %v", table, err)
+	}
+
+	if !inUse {
+		teardownTProxyRoute(iptables.ProtocolIPv4)
+		teardownTProxyRoute(iptables.ProtocolIPv6)
+	}
+	log.Logf("[tproxy] nftables rules of port %d are removed from %s", listenPort, table)
+	return nil
+}
+
+// nftablesSupported reports whether the nftables is supported by the kernel.
+func nftablesSupported() bool {
+	conn, err := nftables.New()
+	if err != nil {
+		return false
+	}
+	_, err = conn.ListTables()
+	return err == nil
+}
+
+func nftProxyChains(table, chain string) (*nftables.Table, *nftables.Chain, *nftables.Chain) {
+	t := &nftables.Table{Name: table, Family: nftables.TableFamilyINet}
+	prerouting := &nftables.Chain{
+		Name:     chain,
+		Table:    t,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityMangle,
+	}
+	output := &nftables.Chain{
+		Name:     chain + "_out",
+		Table:    t,
+		Type:     nftables.ChainTypeRoute,
+		Hooknum:  nftables.ChainHookOutput,
+		Priority: nftables.ChainPriorityMangle,
+	}
+	return t, prerouting, output
+}
+
+// nftProxyTag is the user data of the rules of the listenPort.
+func nftProxyTag(listenPort int) []byte {
+	return []byte("gost:tproxy:" + strconv.Itoa(listenPort))
+}
+
+func delNFTProxyRules(conn *nftables.Conn, t *nftables.Table, chains []*nftables.Chain, listenPort int) error {
+	tag := nftProxyTag(listenPort)
+	for _, c := range chains {
+		rules, err := conn.GetRules(t, c)
+		if err != nil {
+			return fmt.Errorf("nftables: %s: %v", c.Name, err)
+		}
+		for _, rule := range rules {
+			if bytes.Equal(rule.UserData, tag) {
+				if err := conn.DelRule(rule); err != nil {
+					return fmt.Errorf("nftables: %s: %v", c.Name, err)
+				}
+			}
+		}
+	}
+	return conn.Flush()
+}
+
+// nftProxyRules returns the same rules as tproxyRules for the nftables.
+func nftProxyRules(t *nftables.Table, prerouting, output *nftables.Chain, listenPort int, excludeUIDs []int) []*nftables.Rule {
+	tag := nftProxyTag(listenPort)
+	newRule := func(chain *nftables.Chain, exprs ...expr.Any) *nftables.Rule {
+		return &nftables.Rule{Table: t, Chain: chain, Exprs: exprs, UserData: tag}
+	}
+	mark := binaryutil.NativeEndian.PutUint32(1)
+
+	var rules []*nftables.Rule
+	for _, chain := range []*nftables.Chain{prerouting, output} {
+		if chain == output {
+			for _, uid := range excludeUIDs {
+				rules = append(rules, newRule(chain,
+					&expr.Meta{Key: expr.MetaKeySKUID, Register: 1},
+					&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(uint32(uid))},
+					&expr.Verdict{Kind: expr.VerdictReturn},
+				))
+			}
+		}
+		for _, proto := range []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6} {
+			for _, dst := range tproxyReserved(proto) {
+				exprs := append(nftDaddrExprs(dst), &expr.Verdict{Kind: expr.VerdictReturn})
+				rules = append(rules, newRule(chain, exprs...))
+			}
+		}
+		for _, l4proto := range []byte{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+			exprs := []expr.Any{
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{l4proto}},
+				&expr.Immediate{Register: 1, Data: mark},
+				&expr.Meta{Key: expr.MetaKeyMARK, SourceRegister: true, Register: 1},
+			}
+			if chain == prerouting {
+				exprs = append(exprs,
+					&expr.Immediate{Register: 1, Data: binaryutil.BigEndian.PutUint16(uint16(listenPort))},
+					&expr.TProxy{Family: byte(nftables.TableFamilyUnspecified), TableFamily: byte(t.Family), RegPort: 1},
+					&expr.Verdict{Kind: expr.VerdictAccept},
+				)
+			}
+			rules = append(rules, newRule(chain, exprs...))
+		}
+	}
+	return rules
+}
+
+// nftDaddrExprs matches the destination address in the CIDR range.
+func nftDaddrExprs(cidr string) []expr.Any {
+	_, inet, _ := net.ParseCIDR(cidr)
+	nfproto, offset, ip := byte(unix.NFPROTO_IPV4), uint32(16), inet.IP.To4()
+	if ip == nil {
+		nfproto, offset, ip = unix.NFPROTO_IPV6, 24, inet.IP.To16()
+	}
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{nfproto}},
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: uint32(len(ip))},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: uint32(len(ip)), Mask: inet.Mask, Xor: make([]byte, len(ip))},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip},
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !linux
+// +build !linux
+
+package gost
+
+import "errors"
+
+// TProxyBackend returns the backend of the transparent proxy rules, it is empty if it is not supported.
+func TProxyBackend() string {
+	return ""
+}
+
+// SetupTProxy adds the rules for the transparent proxy, it is only available on Linux.
+func SetupTProxy(listenPort int, excludeUIDs []int) error {
+	return errors.New("tproxy: iptables is not available on this platform")
+}
+
+// TeardownTProxy removes the rules for the transparent proxy, it is only available on Linux.
+func TeardownTProxy(listenPort int) error {
+	return errors.New("tproxy: iptables is not available on this platform")
+}
+
+// SetupNFTProxy adds the nftables rules for the transparent proxy, it is only available on Linux.
+func SetupNFTProxy(table, chain string, listenPort int, excludeUIDs []int) error {
+	return errors.New("tproxy: nftables is not available on this platform")
+}
+
+// TeardownNFTProxy removes the nftables rules for the transparent proxy, it is only available on Linux.
+func TeardownNFTProxy(table, chain string, listenPort int) error {
+	return errors.New("tproxy: nftables is not available on this platform")
+}
+
+// SetupTransparentProxy sets up the rules for the transparent proxy, it is only available on Linux.
+func SetupTransparentProxy(listenPort int, excludeUIDs []int) error {
+	return SetupTProxy(listenPort, excludeUIDs)
+}
+
+// TeardownTransparentProxy removes the rules for the transparent proxy, it is only available on Linux.
+func TeardownTransparentProxy(listenPort int) error {
+	return TeardownTProxy(listenPort)
+}
@@ -0,0 +1,107 @@
+package gost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// HopResult is the result of a hop of TraceChain.
+type HopResult struct {
+	Hop       int
+	NodeAddr  string
+	Protocol  string
+	Transport string
+	// RTT is the time to connect to the node through the previous hop, including the handshake.
+	RTT   time.Duration
+	Error error
+}
+
+// String formats the hop like traceroute, e.g. ' 2  socks5+tcp://10.0.0.2:1080  15.2ms'.
+func (h HopResult) String() string {
+	s := fmt.Sprintf("%2d  %s+%s://%s  ", h.Hop, h.Protocol, h.Transport, h.NodeAddr)
+	if h.Error != nil {
+		return s + "*  " + h.Error.Error()
+	}
+	return s + fmt.Sprintf("%.1fms", float64(h.RTT.Microseconds())/1000)
+}
+
+// TraceChain connects to the nodes of the chain one by one, each node is connected through the previous nodes,
+// and measures the time of each hop. The hops after the first failed hop are not traced.
+func TraceChain(ctx context.Context, chain Chain) ([]HopResult, error) {
+	if chain.IsEmpty() {
+		return nil, ErrEmptyChain
+	}
+
+	var nodes []Node
+	for _, group := range chain.nodeGroups {
+		node, err := group.Next()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	var hops []HopResult
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for i, node := range nodes {
+		hop := HopResult{
+			Hop:       i + 1,
+			NodeAddr:  node.Addr,
+			Protocol:  node.Protocol,
+			Transport: node.Transport,
+		}
+
+		start := time.Now()
+		cc, err := traceHop(ctx, conn, nodes, i)
+		hop.RTT = time.Since(start)
+		hop.Error = err
+		hops = append(hops, hop)
+		if err != nil {
+			break
+		}
+		conn = cc
+	}
+	return hops, nil
+}
+
+// traceHop connects to the i-th node through the connection to the previous node.
+func traceHop(ctx context.Context, conn net.Conn, nodes []Node, i int) (net.Conn, error) {
+	node := nodes[i]
+	if i == 0 {
+		cc, err := node.Client.Dial(node.Addr, node.DialOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			cc.SetDeadline(deadline)
+		}
+		conn, err = node.Client.Handshake(cc, node.HandshakeOptions...)
+		if err != nil {
+			cc.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	preNode := nodes[i-1]
+	cc, err := preNode.Client.ConnectContext(ctx, conn, "tcp", node.Addr, preNode.ConnectOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return node.Client.Handshake(cc, node.HandshakeOptions...)
+}
+
+// PrintHops prints the hops of TraceChain like traceroute.
+func PrintHops(w io.Writer, hops []HopResult) {
+	for _, hop := range hops {
+		fmt.Fprintln(w, hop.String())
+	}
+}
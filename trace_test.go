@@ -0,0 +1,72 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTraceChain(t *testing.T) {
+	var nodes []Node
+	for _, protocol := range []string{"socks5", "http"} {
+		ln, err := TCPListener("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var server *Server
+		var connector Connector
+		if protocol == "socks5" {
+			server = &Server{Listener: ln, Handler: SOCKS5Handler()}
+			connector = SOCKS5Connector(nil)
+		} else {
+			server = &Server{Listener: ln, Handler: HTTPHandler()}
+			connector = HTTPConnector(nil)
+		}
+		go server.Run()
+		defer server.Close()
+
+		nodes = append(nodes, Node{
+			Addr:      ln.Addr().String(),
+			Protocol:  protocol,
+			Transport: "tcp",
+			Client:    &Client{Connector: connector, Transporter: TCPTransporter()},
+		})
+	}
+	// the unavailable node, and the node after it.
+	for i := 0; i < 2; i++ {
+		nodes = append(nodes, Node{
+			Addr:      "127.0.0.1:1",
+			Protocol:  "socks5",
+			Transport: "tcp",
+			Client:    &Client{Connector: SOCKS5Connector(nil), Transporter: TCPTransporter()},
+		})
+	}
+
+	hops, err := TraceChain(context.Background(), *NewChain(nodes...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hops) != 3 {
+		t.Fatalf("hops %v", hops)
+	}
+	for i, hop := range hops[:2] {
+		if hop.Error != nil || hop.Hop != i+1 || hop.NodeAddr != nodes[i].Addr || hop.RTT <= 0 {
+			t.Errorf("hop %v", hop)
+		}
+	}
+	if hops[2].Error == nil {
+		t.Errorf("hop 3 should fail")
+	}
+
+	var buf bytes.Buffer
+	PrintHops(&buf, hops)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], " 1  socks5+tcp://") || !strings.Contains(lines[2], "*") {
+		t.Errorf("output %q", buf.String())
+	}
+
+	if _, err := TraceChain(context.Background(), Chain{}); err != ErrEmptyChain {
+		t.Errorf("empty chain: %v", err)
+	}
+}
@@ -0,0 +1,988 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+	quic "github.com/quic-go/quic-go"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("tuic", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			uuid, password := tuicUser(node.User)
+			return TUICTransporter(node.Addr, uuid, password, opts.TLSConfig), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			uuid, password := tuicUser(node.User)
+			return TUICListener(node.Addr, map[string]string{uuid: password}, opts.TLSConfig)
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterProtocol("tuic", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return TUICConnector()
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TUICHandler(), nil
+		},
+	})
+}
+
+// tuicUser returns the UUID and password of the tuic node.
+func tuicUser(user *url.Userinfo) (uuid, password string) {
+	if user == nil {
+		return
+	}
+	password, _ = user.Password()
+	return user.Username(), password
+}
+
+const (
+	tuicVersion = 0x05
+
+	tuicCmdAuthenticate = 0x00
+	tuicCmdConnect      = 0x01
+	tuicCmdPacket       = 0x02
+	tuicCmdDissociate   = 0x03
+	tuicCmdHeartbeat    = 0x04
+
+	tuicAddrNone   = 0xff
+	tuicAddrDomain = 0x00
+	tuicAddrIPv4   = 0x01
+	tuicAddrIPv6   = 0x02
+
+	// tuicMaxFragmentSize is the max data size of the fragments of the UDP packets sent by the datagrams.
+	tuicMaxFragmentSize = 1024
+	// tuicMaxPendingPackets is the max number of the UDP packets in reassembly per association.
+	tuicMaxPendingPackets = 64
+)
+
+var (
+	errTUICAuth = errors.New("tuic: authentication failed")
+)
+
+// parseTUICUUID parses the UUID in the canonical form.
+func parseTUICUUID(s string) (uuid [16]byte, err error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return uuid, fmt.Errorf("tuic: invalid UUID %s", s)
+	}
+	copy(uuid[:], b)
+	return
+}
+
+// tuicToken returns the token of the authentication, which is the TLS keying material
+// exported with the label UUID and the context password.
+func tuicToken(state tls.ConnectionState, uuid [16]byte, password string) ([]byte, error) {
+	return state.ExportKeyingMaterial(string(uuid[:]), []byte(password), 32)
+}
+
+func appendTUICAddr(b []byte, addr string) ([]byte, error) {
+	if addr == "" {
+		return append(b, tuicAddrNone), nil
+	}
+	host, sport, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(sport, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("tuic: domain too long %s", host)
+		}
+		b = append(b, tuicAddrDomain, byte(len(host)))
+		b = append(b, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, tuicAddrIPv4)
+		b = append(b, ip4...)
+	} else {
+		b = append(b, tuicAddrIPv6)
+		b = append(b, ip.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+func readTUICAddr(r io.Reader) (string, error) {
+	var typ [1]byte
+	if _, err := io.ReadFull(r, typ[:]); err != nil {
+		return "", err
+	}
+	var host string
+	switch typ[0] {
+	case tuicAddrNone:
+		return "", nil
+	case tuicAddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return "", err
+		}
+		b := make([]byte, n[0])
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		host = string(b)
+	case tuicAddrIPv4, tuicAddrIPv6:
+		b := make([]byte, net.IPv4len)
+		if typ[0] == tuicAddrIPv6 {
+			b = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		host = net.IP(b).String()
+	default:
+		return "", fmt.Errorf("tuic: unknown address type %d", typ[0])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// tuicPacket is the fragment of a UDP packet:
+// [VER][TYPE][ASSOC_ID (2 bytes)][PKT_ID (2 bytes)][FRAG_TOTAL][FRAG_ID][SIZE (2 bytes)][ADDR][DATA].
+type tuicPacket struct {
+	assocID   uint16
+	pktID     uint16
+	fragTotal byte
+	fragID    byte
+	addr      string
+	data      []byte
+}
+
+// tuicPackets splits the UDP packet to the fragments, only the first fragment has the address.
+func tuicPackets(assocID, pktID uint16, addr string, data []byte) ([][]byte, error) {
+	total := (len(data) + tuicMaxFragmentSize - 1) / tuicMaxFragmentSize
+	if total == 0 {
+		total = 1
+	}
+	if total > 255 {
+		return nil, fmt.Errorf("tuic: packet too large (%d)", len(data))
+	}
+	var packets [][]byte
+	for i := 0; i < total; i++ {
+		frag := data[i*tuicMaxFragmentSize:]
+		if len(frag) > tuicMaxFragmentSize {
+			frag = frag[:tuicMaxFragmentSize]
+		}
+		b := []byte{tuicVersion, tuicCmdPacket}
+		b = binary.BigEndian.AppendUint16(b, assocID)
+		b = binary.BigEndian.AppendUint16(b, pktID)
+		b = append(b, byte(total), byte(i))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(frag)))
+		a := ""
+		if i == 0 {
+			a = addr
+		}
+		b, err := appendTUICAddr(b, a)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, append(b, frag...))
+	}
+	return packets, nil
+}
+
+// readTUICPacket reads the packet after the header [VER][TYPE].
+func readTUICPacket(r io.Reader) (*tuicPacket, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, err
+	}
+	p := &tuicPacket{
+		assocID:   binary.BigEndian.Uint16(b[0:]),
+		pktID:     binary.BigEndian.Uint16(b[2:]),
+		fragTotal: b[4],
+		fragID:    b[5],
+	}
+	if p.fragTotal == 0 || p.fragID >= p.fragTotal {
+		return nil, errors.New("tuic: invalid fragment")
+	}
+	var err error
+	if p.addr, err = readTUICAddr(r); err != nil {
+		return nil, err
+	}
+	p.data = make([]byte, binary.BigEndian.Uint16(b[6:]))
+	if _, err := io.ReadFull(r, p.data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// tuicDefragger reassembles the fragments of the UDP packets of an association.
+type tuicDefragger struct {
+	pending map[uint16]*tuicFragments
+	mux     sync.Mutex
+}
+
+type tuicFragments struct {
+	addr  string
+	frags [][]byte
+	n     int
+}
+
+// feed returns the address and the data of the packet if all the fragments are received.
+func (d *tuicDefragger) feed(p *tuicPacket) (string, []byte, bool) {
+	if p.fragTotal == 1 {
+		return p.addr, p.data, true
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.pending == nil {
+		d.pending = make(map[uint16]*tuicFragments)
+	}
+	f := d.pending[p.pktID]
+	if f == nil || len(f.frags) != int(p.fragTotal) {
+		if len(d.pending) >= tuicMaxPendingPackets {
+			// the lost packets are dropped.
+			for id := range d.pending {
+				delete(d.pending, id)
+				break
+			}
+		}
+		f = &tuicFragments{frags: make([][]byte, p.fragTotal)}
+		d.pending[p.pktID] = f
+	}
+	if f.frags[p.fragID] == nil {
+		f.frags[p.fragID] = p.data
+		f.n++
+	}
+	if p.fragID == 0 {
+		f.addr = p.addr
+	}
+	if f.n < len(f.frags) {
+		return "", nil, false
+	}
+	delete(d.pending, p.pktID)
+	return f.addr, bytes.Join(f.frags, nil), true
+}
+
+type tuicSession struct {
+	conn   quic.EarlyConnection
+	pc     net.PacketConn
+	assocs map[uint16]*tuicUDPConn
+	mux    sync.Mutex
+}
+
+func (s *tuicSession) receiveLoop() {
+	for {
+		b, err := s.conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(b)
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil || header[0] != tuicVersion || header[1] != tuicCmdPacket {
+			continue
+		}
+		p, err := readTUICPacket(r)
+		if err != nil {
+			continue
+		}
+		s.mux.Lock()
+		c := s.assocs[p.assocID]
+		s.mux.Unlock()
+		if c == nil {
+			continue
+		}
+		if _, data, ok := c.defragger.feed(p); ok {
+			select {
+			case c.rchan <- data:
+			default: // the packet is dropped if the reading is slow
+			}
+		}
+	}
+}
+
+func (s *tuicSession) Close() error {
+	s.conn.CloseWithError(0, "")
+	return s.pc.Close()
+}
+
+type tuicTransporter struct {
+	addr         string
+	uuid         [16]byte
+	password     string
+	tlsConfig    *tls.Config
+	session      *tuicSession
+	sessionCache tls.ClientSessionCache
+	mux          sync.Mutex
+}
+
+// TUICTransporter creates a Transporter of the TUIC v5 server at addr, which is a QUIC proxy protocol optimized
+// for the high latency. The QUIC connection is made in 0-RTT if it is possible, and authenticated by the uuid and
+// password after the handshake. The connections are the streams and the datagrams of the QUIC connection without
+// additional framing, use it with TUICConnector.
+//
+// The certificate of the server is not verified if tlsConfig is nil, the ALPN is h3.
+func TUICTransporter(addr, uuid, password string, tlsConfig *tls.Config) Transporter {
+	tr := &tuicTransporter{
+		addr:         addr,
+		password:     password,
+		tlsConfig:    tlsConfig,
+		sessionCache: tls.NewLRUClientSessionCache(0),
+	}
+	var err error
+	if tr.uuid, err = parseTUICUUID(uuid); err != nil {
+		log.Logf("[tuic] %s", err)
+	}
+	return tr
+}
+
+func (tr *tuicTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	if tr.addr != "" {
+		addr = tr.addr
+	}
+
+	tr.mux.Lock()
+	defer tr.mux.Unlock()
+
+	if tr.session != nil && tr.session.conn.Context().Err() != nil {
+		tr.session.Close()
+		tr.session = nil
+	}
+	if tr.session == nil {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = DialTimeout
+		}
+		session, err := tr.initSession(addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		tr.session = session
+	}
+	return &tuicClientConn{session: tr.session}, nil
+}
+
+func (tr *tuicTransporter) initSession(addr string, timeout time.Duration) (*tuicSession, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := tr.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+	if tlsConfig.ClientSessionCache == nil {
+		tlsConfig.ClientSessionCache = tr.sessionCache
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := quic.DialEarly(ctx, pc, udpAddr, tlsConfig, &quic.Config{
+		HandshakeIdleTimeout: timeout,
+		KeepAlivePeriod:      10 * time.Second,
+		EnableDatagrams:      true,
+	})
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	session := &tuicSession{
+		conn:   conn,
+		pc:     pc,
+		assocs: make(map[uint16]*tuicUDPConn),
+	}
+	// the streams can be opened in 0-RTT, the server holds them until the authentication.
+	go func() {
+		select {
+		case <-conn.HandshakeComplete():
+		case <-conn.Context().Done():
+			return
+		}
+		if err := tr.authenticate(conn); err != nil {
+			log.Logf("[tuic] %s -> %s : %s", conn.LocalAddr(), addr, err)
+			session.Close()
+		}
+	}()
+	go session.receiveLoop()
+	return session, nil
+}
+
+func (tr *tuicTransporter) authenticate(conn quic.Connection) error {
+	token, err := tuicToken(conn.ConnectionState().TLS, tr.uuid, tr.password)
+	if err != nil {
+		return err
+	}
+	stream, err := conn.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	b := []byte{tuicVersion, tuicCmdAuthenticate}
+	b = append(b, tr.uuid[:]...)
+	b = append(b, token...)
+	if _, err := stream.Write(b); err != nil {
+		return err
+	}
+	return stream.Close()
+}
+
+func (tr *tuicTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *tuicTransporter) Multiplex() bool {
+	return true
+}
+
+// a dummy TUIC client conn used by TUIC connector
+type tuicClientConn struct {
+	nopConn
+	session *tuicSession
+}
+
+type tuicConnector struct{}
+
+// TUICConnector creates a Connector for TUIC client, the TCP connection is relayed by a stream of the
+// connection of TUICTransporter, and the UDP connection is relayed by the datagrams as an association.
+func TUICConnector() Connector {
+	return &tuicConnector{}
+}
+
+func (c *tuicConnector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *tuicConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	cc, ok := conn.(*tuicClientConn)
+	if !ok {
+		return nil, errors.New("wrong connection type")
+	}
+	session := cc.session
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		return session.associate(address)
+	}
+
+	header, err := appendTUICAddr([]byte{tuicVersion, tuicCmdConnect}, address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := session.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stream.Write(header); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	raddr, _ := net.ResolveTCPAddr("tcp", address)
+	if raddr == nil {
+		raddr = &net.TCPAddr{}
+	}
+	return &quicConn{Stream: stream, laddr: session.conn.LocalAddr(), raddr: raddr}, nil
+}
+
+// associate creates the UDP connection to the address by a new association.
+func (s *tuicSession) associate(address string) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var id [2]byte
+	for {
+		rand.Read(id[:])
+		if _, ok := s.assocs[binary.BigEndian.Uint16(id[:])]; !ok {
+			break
+		}
+	}
+	c := &tuicUDPConn{
+		session: s,
+		assocID: binary.BigEndian.Uint16(id[:]),
+		target:  address,
+		raddr:   raddr,
+		rchan:   make(chan []byte, 128),
+		closed:  make(chan struct{}),
+	}
+	s.assocs[c.assocID] = c
+	return c, nil
+}
+
+// tuicUDPConn is the UDP connection of an association of the TUIC client.
+type tuicUDPConn struct {
+	session   *tuicSession
+	assocID   uint16
+	pktID     uint32
+	target    string
+	raddr     net.Addr
+	defragger tuicDefragger
+	rchan     chan []byte
+	closed    chan struct{}
+	once      sync.Once
+	deadline  atomic.Value // time.Time
+}
+
+func (c *tuicUDPConn) Read(b []byte) (n int, err error) {
+	var timeout <-chan time.Time
+	if d, _ := c.deadline.Load().(time.Time); !d.IsZero() {
+		timer := time.NewTimer(time.Until(d))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case data := <-c.rchan:
+		return copy(b, data), nil
+	case <-timeout:
+		return 0, &net.OpError{Op: "read", Net: "tuic", Err: os.ErrDeadlineExceeded}
+	case <-c.closed:
+		return 0, io.EOF
+	case <-c.session.conn.Context().Done():
+		return 0, io.EOF
+	}
+}
+
+func (c *tuicUDPConn) Write(b []byte) (int, error) {
+	packets, err := tuicPackets(c.assocID, uint16(atomic.AddUint32(&c.pktID, 1)), c.target, b)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range packets {
+		if err := c.session.conn.SendDatagram(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Close dissociates the association.
+func (c *tuicUDPConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		c.session.mux.Lock()
+		delete(c.session.assocs, c.assocID)
+		c.session.mux.Unlock()
+
+		var stream quic.SendStream
+		if stream, err = c.session.conn.OpenUniStream(); err != nil {
+			return
+		}
+		b := []byte{tuicVersion, tuicCmdDissociate}
+		stream.Write(binary.BigEndian.AppendUint16(b, c.assocID))
+		err = stream.Close()
+	})
+	return err
+}
+
+func (c *tuicUDPConn) LocalAddr() net.Addr {
+	return c.session.conn.LocalAddr()
+}
+
+func (c *tuicUDPConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *tuicUDPConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *tuicUDPConn) SetReadDeadline(t time.Time) error {
+	c.deadline.Store(t)
+	return nil
+}
+
+func (c *tuicUDPConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type tuicHandler struct {
+	options *HandlerOptions
+}
+
+// TUICHandler creates a server Handler for the TCP relay requests of the connections of TUICListener.
+func TUICHandler(opts ...HandlerOption) Handler {
+	h := &tuicHandler{}
+	h.Init(opts...)
+	return h
+}
+
+func (h *tuicHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *tuicHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		log.Logf("[tuic] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	if header[0] != tuicVersion || header[1] != tuicCmdConnect {
+		log.Logf("[tuic] %s - %s : unknown command %d/%d", conn.RemoteAddr(), conn.LocalAddr(), header[0], header[1])
+		return
+	}
+	host, err := readTUICAddr(conn)
+	if err != nil {
+		log.Logf("[tuic] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	log.Logf("[tuic] %s -> %s", conn.RemoteAddr(), host)
+
+	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) {
+		log.Logf("[tuic] %s - %s : Unauthorized to tcp connect to %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		return
+	}
+	if h.options.Bypass.Contains(host) {
+		log.Logf("[tuic] %s - %s : Bypass %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		return
+	}
+
+	cc, err := h.options.Chain.DialContext(context.Background(),
+		"tcp", host,
+		RetryChainOption(h.options.Retries),
+		TimeoutChainOption(h.options.Timeout),
+		HostsChainOption(h.options.Hosts),
+		ResolverChainOption(h.options.Resolver),
+	)
+	if err != nil {
+		log.Logf("[tuic] %s -> %s : %s", conn.RemoteAddr(), host, err)
+		return
+	}
+	defer cc.Close()
+
+	log.Logf("[tuic] %s <-> %s", conn.RemoteAddr(), host)
+	transport(conn, cc)
+	log.Logf("[tuic] %s >-< %s", conn.RemoteAddr(), host)
+}
+
+type tuicListener struct {
+	ln       *quic.EarlyListener
+	users    map[[16]byte]string
+	connChan chan net.Conn
+	errChan  chan error
+}
+
+// TUICListener creates a Listener for TUIC v5 server, the QUIC connections are authenticated by the users
+// of UUID and password, then the streams are accepted as the TCP relay connections, use it with TUICHandler.
+// The UDP packets of the datagrams and the unidirectional streams are relayed by the listener directly.
+func TUICListener(addr string, users map[string]string, tlsConfig *tls.Config) (Listener, error) {
+	l := &tuicListener{
+		users:    make(map[[16]byte]string),
+		connChan: make(chan net.Conn, 1024),
+		errChan:  make(chan error, 1),
+	}
+	for uuid, password := range users {
+		id, err := parseTUICUUID(uuid)
+		if err != nil {
+			return nil, err
+		}
+		l.users[id] = password
+	}
+
+	if tlsConfig == nil {
+		tlsConfig = DefaultTLSConfig
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"h3"}
+	ln, err := quic.ListenAddrEarly(addr, tlsConfig, &quic.Config{
+		KeepAlivePeriod: 10 * time.Second,
+		EnableDatagrams: true,
+		Allow0RTT:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.ln = ln
+	go l.listenLoop()
+	return l, nil
+}
+
+func (l *tuicListener) listenLoop() {
+	for {
+		session, err := l.ln.Accept(context.Background())
+		if err != nil {
+			log.Log("[tuic] accept:", err)
+			l.errChan <- err
+			close(l.errChan)
+			return
+		}
+		go l.sessionLoop(session)
+	}
+}
+
+// tuicServerSession is the authenticated connection of the TUIC client.
+type tuicServerSession struct {
+	conn   quic.EarlyConnection
+	authed chan struct{}
+	once   sync.Once
+	assocs map[uint16]*tuicAssociation
+	mux    sync.Mutex
+}
+
+// tuicAssociation is the UDP socket of an association of the TUIC client.
+type tuicAssociation struct {
+	pc        net.PacketConn
+	defragger tuicDefragger
+	pktID     uint32
+}
+
+func (l *tuicListener) sessionLoop(conn quic.EarlyConnection) {
+	s := &tuicServerSession{
+		conn:   conn,
+		authed: make(chan struct{}),
+		assocs: make(map[uint16]*tuicAssociation),
+	}
+	defer s.close()
+
+	go l.uniStreamLoop(s)
+
+	select {
+	case <-s.authed:
+	case <-time.After(HandshakeTimeout):
+		log.Logf("[tuic] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), "authentication timeout")
+		return
+	case <-conn.Context().Done():
+		return
+	}
+	log.Logf("[tuic] %s <-> %s", conn.RemoteAddr(), conn.LocalAddr())
+	defer log.Logf("[tuic] %s >-< %s", conn.RemoteAddr(), conn.LocalAddr())
+
+	go s.datagramLoop()
+
+	for {
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		cc := &quicConn{Stream: stream, laddr: conn.LocalAddr(), raddr: conn.RemoteAddr()}
+		select {
+		case l.connChan <- cc:
+		default:
+			cc.Close()
+			log.Logf("[tuic] %s - %s: connection queue is full", conn.RemoteAddr(), conn.LocalAddr())
+		}
+	}
+}
+
+func (l *tuicListener) uniStreamLoop(s *tuicServerSession) {
+	for {
+		stream, err := s.conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			if err := l.handleUniStream(s, stream); err != nil {
+				log.Logf("[tuic] %s - %s : %s", s.conn.RemoteAddr(), s.conn.LocalAddr(), err)
+				if errors.Is(err, errTUICAuth) {
+					s.conn.CloseWithError(0, "")
+				}
+			}
+		}()
+	}
+}
+
+func (l *tuicListener) handleUniStream(s *tuicServerSession, stream quic.ReceiveStream) error {
+	var header [2]byte
+	if _, err := io.ReadFull(stream, header[:]); err != nil {
+		return err
+	}
+	if header[0] != tuicVersion {
+		return fmt.Errorf("tuic: unknown version %d", header[0])
+	}
+
+	if header[1] == tuicCmdAuthenticate {
+		var b [16 + 32]byte
+		if _, err := io.ReadFull(stream, b[:]); err != nil {
+			return err
+		}
+		var uuid [16]byte
+		copy(uuid[:], b[:16])
+		password, ok := l.users[uuid]
+		if !ok {
+			return errTUICAuth
+		}
+		select {
+		case <-s.conn.HandshakeComplete():
+		case <-s.conn.Context().Done():
+			return s.conn.Context().Err()
+		}
+		token, err := tuicToken(s.conn.ConnectionState().TLS, uuid, password)
+		if err != nil || !bytes.Equal(token, b[16:]) {
+			return errTUICAuth
+		}
+		s.once.Do(func() { close(s.authed) })
+		return nil
+	}
+
+	// the other commands are held until the authentication.
+	select {
+	case <-s.authed:
+	case <-s.conn.Context().Done():
+		return s.conn.Context().Err()
+	}
+	switch header[1] {
+	case tuicCmdPacket:
+		p, err := readTUICPacket(stream)
+		if err != nil {
+			return err
+		}
+		s.relay(p)
+	case tuicCmdDissociate:
+		var id [2]byte
+		if _, err := io.ReadFull(stream, id[:]); err != nil {
+			return err
+		}
+		s.dissociate(binary.BigEndian.Uint16(id[:]))
+	}
+	return nil
+}
+
+func (s *tuicServerSession) datagramLoop() {
+	for {
+		b, err := s.conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(b)
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil || header[0] != tuicVersion {
+			continue
+		}
+		if header[1] != tuicCmdPacket {
+			continue // heartbeat
+		}
+		if p, err := readTUICPacket(r); err == nil {
+			s.relay(p)
+		}
+	}
+}
+
+// relay sends the UDP packet to the address by the socket of the association.
+func (s *tuicServerSession) relay(p *tuicPacket) {
+	s.mux.Lock()
+	assoc := s.assocs[p.assocID]
+	if assoc == nil {
+		pc, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			s.mux.Unlock()
+			log.Logf("[tuic] %s - %s : %s", s.conn.RemoteAddr(), s.conn.LocalAddr(), err)
+			return
+		}
+		assoc = &tuicAssociation{pc: pc}
+		s.assocs[p.assocID] = assoc
+		go s.associationLoop(p.assocID, assoc)
+	}
+	s.mux.Unlock()
+
+	addr, data, ok := assoc.defragger.feed(p)
+	if !ok {
+		return
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Logf("[tuic] %s - %s : %s", s.conn.RemoteAddr(), addr, err)
+		return
+	}
+	if _, err := assoc.pc.WriteTo(data, raddr); err != nil {
+		log.Logf("[tuic] %s - %s : %s", s.conn.RemoteAddr(), addr, err)
+	}
+}
+
+// associationLoop sends the UDP packets received by the socket of the association back to the client.
+func (s *tuicServerSession) associationLoop(assocID uint16, assoc *tuicAssociation) {
+	b := make([]byte, 65535)
+	for {
+		n, addr, err := assoc.pc.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		packets, err := tuicPackets(assocID, uint16(atomic.AddUint32(&assoc.pktID, 1)), addr.String(), b[:n])
+		if err != nil {
+			continue
+		}
+		for _, p := range packets {
+			if err := s.conn.SendDatagram(p); err != nil {
+				break
+			}
+		}
+	}
+}
+
+func (s *tuicServerSession) dissociate(assocID uint16) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if assoc := s.assocs[assocID]; assoc != nil {
+		assoc.pc.Close()
+		delete(s.assocs, assocID)
+	}
+}
+
+func (s *tuicServerSession) close() {
+	s.conn.CloseWithError(0, "")
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for id, assoc := range s.assocs {
+		assoc.pc.Close()
+		delete(s.assocs, id)
+	}
+}
+
+func (l *tuicListener) Accept() (conn net.Conn, err error) {
+	var ok bool
+	select {
+	case conn = <-l.connChan:
+	case err, ok = <-l.errChan:
+		if !ok {
+			err = errors.New("accpet on closed listener")
+		}
+	}
+	return
+}
+
+func (l *tuicListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+func (l *tuicListener) Close() error {
+	return l.ln.Close()
+}
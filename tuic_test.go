@@ -0,0 +1,112 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const tuicTestUUID = "6f5d3c7a-2b1e-4d4f-9a8b-0c1d2e3f4a5b"
+
+func TestTUICPacketFragments(t *testing.T) {
+	data := make([]byte, 3*tuicMaxFragmentSize+10)
+	rand.Read(data)
+	packets, err := tuicPackets(1, 2, "example.com:53", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 4 {
+		t.Fatalf("got %d fragments, want 4", len(packets))
+	}
+
+	var d tuicDefragger
+	// the fragments are reassembled out of order.
+	for i := len(packets) - 1; i >= 0; i-- {
+		p, err := readTUICPacket(bytes.NewReader(packets[i][2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, b, ok := d.feed(p)
+		if ok != (i == 0) {
+			t.Fatalf("fragment %d: got reassembled %v", i, ok)
+		}
+		if ok && (addr != "example.com:53" || !bytes.Equal(b, data)) {
+			t.Errorf("got packet to %s of %d bytes", addr, len(b))
+		}
+	}
+}
+
+func tuicRoundtrip(t *testing.T, targetURL string, data []byte, password string) error {
+	ln, err := TUICListener("127.0.0.1:0", map[string]string{tuicTestUUID: "password"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  TUICHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   TUICConnector(),
+		Transporter: TUICTransporter(ln.Addr().String(), tuicTestUUID, password, nil),
+	}
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestTUIC(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	if err := tuicRoundtrip(t, httpSrv.URL, sendData, "password"); err != nil {
+		t.Error(err)
+	}
+	if err := tuicRoundtrip(t, httpSrv.URL, sendData, "wrong"); err == nil {
+		t.Error("the wrong password should not be authenticated")
+	}
+}
+
+func TestTUICUDP(t *testing.T) {
+	udpSrv := newUDPTestServer(udpTestHandler)
+	udpSrv.Start()
+	defer udpSrv.Close()
+
+	ln, err := TUICListener("127.0.0.1:0", map[string]string{tuicTestUUID: "password"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	tr := TUICTransporter(ln.Addr().String(), tuicTestUUID, "password", nil)
+	conn, err := tr.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := TUICConnector().ConnectContext(context.Background(), conn, "udp", udpSrv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	sendData := make([]byte, 2*tuicMaxFragmentSize)
+	rand.Read(sendData)
+	if _, err := cc.Write(sendData); err != nil {
+		t.Fatal(err)
+	}
+	cc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	b := make([]byte, 4096)
+	n, err := cc.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:n], sendData) {
+		t.Error("data not equal")
+	}
+}
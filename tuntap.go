@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +21,42 @@ import (
 	"golang.org/x/net/ipv6"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("tun", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return TunListener(TunConfig{
+				Name:    node.Get("name"),
+				Addr:    node.Get("net"),
+				Peer:    node.Get("peer"),
+				MTU:     node.GetInt("mtu"),
+				Routes:  opts.IPRoutes,
+				Gateway: node.Get("gw"),
+			})
+		},
+	})
+	DefaultRegistry.RegisterTransport("tap", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return TapListener(TapConfig{
+				Name:    node.Get("name"),
+				Addr:    node.Get("net"),
+				MTU:     node.GetInt("mtu"),
+				Routes:  strings.Split(node.Get("route"), ","),
+				Gateway: node.Get("gw"),
+			})
+		},
+	})
+	DefaultRegistry.RegisterProtocol("tun", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TunHandler(), nil
+		},
+	})
+	DefaultRegistry.RegisterProtocol("tap", Protocol{
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return TapHandler(), nil
+		},
+	})
+}
+
 var mIPProts = map[waterutil.IPProtocol]string{
 	waterutil.HOPOPT:     "HOPOPT",
 	waterutil.ICMP:       "ICMP",
@@ -0,0 +1,356 @@
+package gost
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/pion/turn/v2"
+)
+
+// WithTURNTCP specifies whether the TURNTransporter uses TCP allocations (RFC 6062),
+// by default the UDP allocation (RFC 5766) is used.
+func WithTURNTCP(b bool) TransporterOption {
+	return func(opts *TransporterOptions) {
+		opts.turnTCP = b
+	}
+}
+
+type turnTransporter struct {
+	turnAddr string
+	user     string
+	pass     string
+	realm    string
+	options  *TransporterOptions
+}
+
+// TURNTransporter creates a Transporter that relays the connection through a TURN server.
+// For each Dial, a new allocation is created on the TURN server using the long-term credentials,
+// then the peer address is permitted and bound to a channel.
+//
+// With the UDP allocation, the connection is datagram oriented,
+// each Write is sent to the peer as a single packet.
+// If the chain is not empty, the TURN server is reached over TCP through the chain,
+// so the TURN server must also accept TCP on turnAddr.
+func TURNTransporter(turnAddr, user, pass string, realm string, opts ...TransporterOption) Transporter {
+	options := &TransporterOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &turnTransporter{
+		turnAddr: turnAddr,
+		user:     user,
+		pass:     pass,
+		realm:    realm,
+		options:  options,
+	}
+}
+
+func (tr *turnTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+
+	if tr.options.turnTCP {
+		return tr.dialTCP(addr, timeout, opts.Chain)
+	}
+	return tr.dialUDP(addr, timeout, opts.Chain)
+}
+
+// dialServer connects to the TURN server over TCP, through the chain if it is not empty.
+func (tr *turnTransporter) dialServer(timeout time.Duration, chain *Chain) (net.Conn, error) {
+	if chain.IsEmpty() {
+		return net.DialTimeout("tcp", tr.turnAddr, timeout)
+	}
+	return chain.Dial(tr.turnAddr, TimeoutChainOption(timeout))
+}
+
+func (tr *turnTransporter) dialUDP(addr string, timeout time.Duration, chain *Chain) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var pc net.PacketConn
+	if chain.IsEmpty() {
+		pc, err = net.ListenPacket("udp", "")
+	} else {
+		// the chain can not carry the packets to the TURN server, so the TURN server is reached over TCP.
+		var conn net.Conn
+		if conn, err = tr.dialServer(timeout, chain); err == nil {
+			pc = turn.NewSTUNConn(conn)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := tr.newClient(pc)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	closer := func() { client.Close(); pc.Close() }
+
+	// the pending transactions are aborted if the allocation is not done in time.
+	timer := time.AfterFunc(timeout, closer)
+	relay, err := tr.allocateUDP(client, raddr)
+	if !timer.Stop() {
+		if err == nil {
+			relay.Close()
+		}
+		err = tr.timeoutError(addr)
+	}
+	if err != nil {
+		closer()
+		return nil, err
+	}
+
+	return &turnConn{
+		relay:  relay,
+		raddr:  raddr,
+		closer: closer,
+	}, nil
+}
+
+func (tr *turnTransporter) allocateUDP(client *turn.Client, raddr *net.UDPAddr) (net.PacketConn, error) {
+	relay, err := client.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	if Debug {
+		log.Logf("[turn] %s: relayed address %s", tr.turnAddr, relay.LocalAddr())
+	}
+
+	if err := client.CreatePermission(raddr); err != nil {
+		relay.Close()
+		return nil, err
+	}
+	return relay, nil
+}
+
+func (tr *turnTransporter) dialTCP(addr string, timeout time.Duration, chain *Chain) (net.Conn, error) {
+	control, err := tr.dialServer(timeout, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := tr.newClient(turn.NewSTUNConn(control))
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+	closer := func() { client.Close(); control.Close() }
+
+	// the pending transactions are aborted if the connection is not established in time.
+	timer := time.AfterFunc(timeout, closer)
+	conn, alloc, err := tr.allocateTCP(client, addr, timeout, chain)
+	if !timer.Stop() {
+		if err == nil {
+			conn.Close()
+			alloc.Close()
+		}
+		err = tr.timeoutError(addr)
+	}
+	if err != nil {
+		closer()
+		return nil, err
+	}
+
+	return &turnTCPConn{
+		Conn:   conn,
+		closer: func() { alloc.Close(); closer() },
+	}, nil
+}
+
+// allocateTCP creates the TCP allocation, then connects to the peer with a new data connection (RFC 6062).
+func (tr *turnTransporter) allocateTCP(client *turn.Client, addr string, timeout time.Duration, chain *Chain) (net.Conn, io.Closer, error) {
+	alloc, err := client.AllocateTCP()
+	if err != nil {
+		return nil, nil, err
+	}
+	if Debug {
+		log.Logf("[turn] %s: relayed address %s", tr.turnAddr, alloc.Addr())
+	}
+
+	data, err := tr.dialServer(timeout, chain)
+	if err != nil {
+		alloc.Close()
+		return nil, nil, err
+	}
+	var conn net.Conn
+	if tc, ok := data.(*net.TCPConn); ok {
+		conn, err = alloc.DialWithConn(tc, "tcp", addr)
+	} else {
+		conn, err = alloc.DialWithConn(&turnDataConn{Conn: data}, "tcp", addr)
+	}
+	if err != nil {
+		data.Close()
+		alloc.Close()
+		return nil, nil, err
+	}
+	return conn, alloc, nil
+}
+
+func (tr *turnTransporter) timeoutError(addr string) error {
+	return &net.OpError{Op: "dial", Net: "turn", Addr: turnAddr(addr), Err: os.ErrDeadlineExceeded}
+}
+
+func (tr *turnTransporter) newClient(conn net.PacketConn) (*turn.Client, error) {
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: tr.turnAddr,
+		TURNServerAddr: tr.turnAddr,
+		Conn:           conn,
+		Username:       tr.user,
+		Password:       tr.pass,
+		Realm:          tr.realm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Listen(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (tr *turnTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *turnTransporter) Multiplex() bool {
+	return false
+}
+
+// turnConn is a connection to the peer over the channel of a TURN UDP allocation.
+type turnConn struct {
+	relay  net.PacketConn
+	raddr  *net.UDPAddr
+	closer func()
+	once   sync.Once
+}
+
+func (c *turnConn) Read(b []byte) (n int, err error) {
+	for {
+		var addr net.Addr
+		n, addr, err = c.relay.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		// drop the packets not from the peer.
+		if ua, ok := addr.(*net.UDPAddr); ok && ua.IP.Equal(c.raddr.IP) && ua.Port == c.raddr.Port {
+			return
+		}
+	}
+}
+
+func (c *turnConn) Write(b []byte) (n int, err error) {
+	return c.relay.WriteTo(b, c.raddr)
+}
+
+func (c *turnConn) Close() (err error) {
+	c.once.Do(func() {
+		err = c.relay.Close()
+		c.closer()
+	})
+	return
+}
+
+func (c *turnConn) LocalAddr() net.Addr {
+	return c.relay.LocalAddr()
+}
+
+func (c *turnConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *turnConn) SetDeadline(t time.Time) error {
+	return c.relay.SetDeadline(t)
+}
+
+func (c *turnConn) SetReadDeadline(t time.Time) error {
+	return c.relay.SetReadDeadline(t)
+}
+
+func (c *turnConn) SetWriteDeadline(t time.Time) error {
+	return c.relay.SetWriteDeadline(t)
+}
+
+// turnTCPConn is a connection to the peer over a TURN TCP allocation,
+// the allocation is released along with the connection.
+type turnTCPConn struct {
+	net.Conn
+	closer func()
+	once   sync.Once
+}
+
+func (c *turnTCPConn) Close() (err error) {
+	c.once.Do(func() {
+		err = c.Conn.Close()
+		c.closer()
+	})
+	return
+}
+
+// turnDataConn adapts the data connection through the chain to the TCP connection required by the TURN client,
+// the TCP specific options are ignored.
+type turnDataConn struct {
+	net.Conn
+}
+
+func (c *turnDataConn) CloseRead() error {
+	return nil
+}
+
+func (c *turnDataConn) CloseWrite() error {
+	return nil
+}
+
+func (c *turnDataConn) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(c.Conn, r)
+}
+
+func (c *turnDataConn) SetLinger(sec int) error {
+	return nil
+}
+
+func (c *turnDataConn) SetKeepAlive(keepalive bool) error {
+	return nil
+}
+
+func (c *turnDataConn) SetKeepAlivePeriod(d time.Duration) error {
+	return nil
+}
+
+func (c *turnDataConn) SetNoDelay(noDelay bool) error {
+	return nil
+}
+
+func (c *turnDataConn) SetWriteBuffer(bytes int) error {
+	return nil
+}
+
+func (c *turnDataConn) SetReadBuffer(bytes int) error {
+	return nil
+}
+
+type turnAddr string
+
+func (a turnAddr) Network() string {
+	return "turn"
+}
+
+func (a turnAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,347 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/turn/v2"
+)
+
+// turnTestServer starts a TURN server with a single user on both UDP and TCP,
+// and returns the server and its address.
+func turnTestServer(t *testing.T, user, pass, realm string) (*turn.Server, string) {
+	// the TCP port may be taken by others, try another UDP port.
+	var pc net.PacketConn
+	var ln net.Listener
+	var err error
+	for i := 0; i < 10; i++ {
+		if pc, err = net.ListenPacket("udp4", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if ln, err = net.Listen("tcp4", pc.LocalAddr().String()); err == nil {
+			break
+		}
+		pc.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	relay := &turn.RelayAddressGeneratorStatic{
+		RelayAddress: net.ParseIP("127.0.0.1"),
+		Address:      "127.0.0.1",
+	}
+
+	key := turn.GenerateAuthKey(user, realm, pass)
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			return key, username == user
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{PacketConn: pc, RelayAddressGenerator: relay},
+		},
+		ListenerConfigs: []turn.ListenerConfig{
+			{Listener: ln, RelayAddressGenerator: relay},
+		},
+	})
+	if err != nil {
+		pc.Close()
+		ln.Close()
+		t.Fatal(err)
+	}
+	return server, pc.LocalAddr().String()
+}
+
+func TestTURNTransporter(t *testing.T) {
+	udpSrv := newUDPTestServer(udpTestHandler)
+	udpSrv.Start()
+	defer udpSrv.Close()
+
+	server, turnAddr := turnTestServer(t, "admin", "123456", "gost")
+	defer server.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	tests := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"admin", "123456", true},
+		{"admin", "654321", false},
+	}
+	for _, tc := range tests {
+		tr := TURNTransporter(turnAddr, tc.user, tc.pass, "gost")
+		conn, err := tr.Dial(udpSrv.Addr())
+		if !tc.ok {
+			if err == nil {
+				conn.Close()
+				t.Errorf("%s:%s should failed", tc.user, tc.pass)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := turnRoundtrip(conn, sendData); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}
+}
+
+func turnRoundtrip(conn net.Conn, data []byte) error {
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write(data); err != nil {
+		return err
+	}
+	recv := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, recv); err != nil {
+		return err
+	}
+	if !bytes.Equal(data, recv) {
+		return errors.New("data not equal")
+	}
+	return nil
+}
+
+func TestTURNTransporterChain(t *testing.T) {
+	udpSrv := newUDPTestServer(udpTestHandler)
+	udpSrv.Start()
+	defer udpSrv.Close()
+
+	server, turnAddr := turnTestServer(t, "admin", "123456", "gost")
+	defer server.Close()
+
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go proxy.Run()
+	defer proxy.Close()
+
+	chain := NewChain(Node{
+		Addr:   ln.Addr().String(),
+		Client: &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()},
+	})
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	// the UDP allocation is requested over TCP through the HTTP proxy.
+	tr := TURNTransporter(turnAddr, "admin", "123456", "gost")
+	conn, err := tr.Dial(udpSrv.Addr(), ChainDialOption(chain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := turnRoundtrip(conn, sendData); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTURNTransporterTimeout(t *testing.T) {
+	// the TURN server never responds.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	tr := TURNTransporter(pc.LocalAddr().String(), "admin", "123456", "gost")
+	start := time.Now()
+	conn, err := tr.Dial("127.0.0.1:53", TimeoutDialOption(300*time.Millisecond))
+	if err == nil {
+		conn.Close()
+		t.Fatal("should failed")
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("got %v, want timeout error", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("dial timeout after %v", d)
+	}
+}
+
+// turnTCPTestServer is a mock TURN server that only supports the TCP allocation (RFC 6062),
+// as the pion TURN server does not implement the Connect and ConnectionBind methods.
+func turnTCPTestServer(t *testing.T, user, pass, realm string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	integrity := stun.NewLongTermIntegrity(user, realm, pass)
+	relayed := ln.Addr().(*net.TCPAddr)
+
+	var mu sync.Mutex
+	var cid uint32
+	peers := make(map[uint32]net.Conn)
+
+	readMessage := func(r io.Reader) (*stun.Message, error) {
+		b := make([]byte, 20)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		b = append(b, make([]byte, binary.BigEndian.Uint16(b[2:4]))...)
+		if _, err := io.ReadFull(r, b[20:]); err != nil {
+			return nil, err
+		}
+		m := &stun.Message{Raw: b}
+		return m, m.Decode()
+	}
+
+	reply := func(conn net.Conn, m *stun.Message, class stun.MessageClass, setters ...stun.Setter) error {
+		setters = append([]stun.Setter{
+			stun.NewTransactionIDSetter(m.TransactionID),
+			stun.NewType(m.Type.Method, class),
+		}, setters...)
+		if class == stun.ClassSuccessResponse {
+			setters = append(setters, integrity)
+		}
+		setters = append(setters, stun.Fingerprint)
+		res, err := stun.Build(setters...)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(res.Raw)
+		return err
+	}
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			m, err := readMessage(conn)
+			if err != nil {
+				return
+			}
+			if _, err := m.Get(stun.AttrMessageIntegrity); err != nil || integrity.Check(m) != nil {
+				reply(conn, m, stun.ClassErrorResponse,
+					&stun.ErrorCodeAttribute{Code: stun.CodeUnauthorized},
+					stun.NewRealm(realm), stun.NewNonce("nonce"))
+				continue
+			}
+
+			switch m.Type.Method {
+			case stun.MethodAllocate:
+				lifetime := make([]byte, 4)
+				binary.BigEndian.PutUint32(lifetime, 600)
+				reply(conn, m, stun.ClassSuccessResponse,
+					turnAddrSetter{stun.AttrXORRelayedAddress, relayed},
+					turnAddrSetter{stun.AttrXORMappedAddress, conn.RemoteAddr().(*net.TCPAddr)},
+					stun.RawAttribute{Type: stun.AttrLifetime, Value: lifetime})
+			case stun.MethodCreatePermission, stun.MethodRefresh:
+				reply(conn, m, stun.ClassSuccessResponse)
+			case stun.MethodConnect:
+				var peer stun.XORMappedAddress
+				if err := peer.GetFromAs(m, stun.AttrXORPeerAddress); err != nil {
+					return
+				}
+				pc, err := net.Dial("tcp", net.JoinHostPort(peer.IP.String(), strconv.Itoa(peer.Port)))
+				if err != nil {
+					reply(conn, m, stun.ClassErrorResponse,
+						&stun.ErrorCodeAttribute{Code: stun.CodeConnTimeoutOrFailure})
+					continue
+				}
+				mu.Lock()
+				cid++
+				peers[cid] = pc
+				id := make([]byte, 4)
+				binary.BigEndian.PutUint32(id, cid)
+				mu.Unlock()
+				reply(conn, m, stun.ClassSuccessResponse,
+					stun.RawAttribute{Type: stun.AttrConnectionID, Value: id})
+			case stun.MethodConnectionBind:
+				v, err := m.Get(stun.AttrConnectionID)
+				if err != nil || len(v) != 4 {
+					return
+				}
+				mu.Lock()
+				pc := peers[binary.BigEndian.Uint32(v)]
+				delete(peers, binary.BigEndian.Uint32(v))
+				mu.Unlock()
+				if pc == nil {
+					return
+				}
+				defer pc.Close()
+				// the connection becomes the data connection to the peer.
+				if reply(conn, m, stun.ClassSuccessResponse) == nil {
+					transport(conn, pc)
+				}
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln
+}
+
+type turnAddrSetter struct {
+	typ  stun.AttrType
+	addr *net.TCPAddr
+}
+
+func (s turnAddrSetter) AddTo(m *stun.Message) error {
+	return stun.XORMappedAddress{IP: s.addr.IP, Port: s.addr.Port}.AddToAs(m, s.typ)
+}
+
+func TestTURNTransporterTCP(t *testing.T) {
+	peer := echoTestServer(t)
+	defer peer.Close()
+
+	turnSrv := turnTCPTestServer(t, "admin", "123456", "gost")
+	defer turnSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	tests := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"admin", "123456", true},
+		{"admin", "654321", false},
+	}
+	for _, tc := range tests {
+		tr := TURNTransporter(turnSrv.Addr().String(), tc.user, tc.pass, "gost", WithTURNTCP(true))
+		conn, err := tr.Dial(peer.Addr().String(), TimeoutDialOption(3*time.Second))
+		if !tc.ok {
+			if err == nil {
+				conn.Close()
+				t.Errorf("%s:%s should failed", tc.user, tc.pass)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := turnRoundtrip(conn, sendData); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}
+}
@@ -10,6 +10,26 @@ import (
 	"github.com/go-log/log"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("udp", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return UDPTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return UDPListener(node.Addr, udpListenConfig(node))
+		},
+	}, "ssu")
+}
+
+// udpListenConfig returns the UDPListenConfig of the node parameters ttl, backlog and queue.
+func udpListenConfig(node Node) *UDPListenConfig {
+	return &UDPListenConfig{
+		TTL:       node.GetDuration("ttl"),
+		Backlog:   node.GetInt("backlog"),
+		QueueSize: node.GetInt("queue"),
+	}
+}
+
 // udpTransporter is a raw UDP transporter.
 type udpTransporter struct{}
 
@@ -66,7 +86,10 @@ func UDPListener(addr string, cfg *UDPListenConfig) (Listener, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newUDPListener(ln, cfg), nil
+}
 
+func newUDPListener(ln net.PacketConn, cfg *UDPListenConfig) *udpListener {
 	if cfg == nil {
 		cfg = &UDPListenConfig{}
 	}
@@ -84,7 +107,7 @@ func UDPListener(addr string, cfg *UDPListenConfig) (Listener, error) {
 		config:   cfg,
 	}
 	go l.listenLoop()
-	return l, nil
+	return l
 }
 
 func (l *udpListener) listenLoop() {
@@ -0,0 +1,118 @@
+package gost
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("unix", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return UDSTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return UDSListener(node.Addr)
+		},
+		PathAddr: true,
+	})
+	DefaultRegistry.RegisterTransport("unixgram", Transport{
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return UDSDatagramListener(node.Addr)
+		},
+		PathAddr: true,
+	})
+}
+
+// udsTransporter is a raw Unix domain socket transporter.
+type udsTransporter struct{}
+
+// UDSTransporter creates a Transporter for Unix domain socket (SOCK_STREAM) client.
+// The address is the path of the socket, a path starting with '@' is a socket in the abstract namespace (Linux only).
+// The Unix domain socket is for the local IPC, so the chain is not used.
+func UDSTransporter() Transporter {
+	return &udsTransporter{}
+}
+
+func (tr *udsTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	opts := &DialOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	return net.DialTimeout("unix", addr, timeout)
+}
+
+func (tr *udsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
+	return conn, nil
+}
+
+func (tr *udsTransporter) Multiplex() bool {
+	return false
+}
+
+// UDSListener creates a Listener for Unix domain socket server, it is the same as UDSStreamListener.
+func UDSListener(path string) (Listener, error) {
+	return UDSStreamListener(path)
+}
+
+// UDSStreamListener creates a Listener for Unix domain socket (SOCK_STREAM) server.
+// The stale socket file is removed before binding,
+// a path starting with '@' is a socket in the abstract namespace (Linux only).
+func UDSStreamListener(path string) (Listener, error) {
+	if err := removeStaleSocket("unix", path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// UDSDatagramListener creates a Listener for Unix domain socket (SOCK_DGRAM) server.
+// As the UDP listener, each client address is a connection,
+// so the client must bind its own address to receive the replies.
+func UDSDatagramListener(path string) (Listener, error) {
+	if err := removeStaleSocket("unixgram", path); err != nil {
+		return nil, err
+	}
+	ln, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		return nil, err
+	}
+	return newUDPListener(ln, nil), nil
+}
+
+// removeStaleSocket removes the socket file left by the previous server.
+// The socket is stale only if nobody is listening on it, otherwise the address is in use.
+func removeStaleSocket(network, path string) error {
+	if path == "" || strings.HasPrefix(path, "@") {
+		return nil
+	}
+	addr := &net.UnixAddr{Name: path, Net: network}
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return &net.OpError{Op: "listen", Net: network, Addr: addr, Err: os.ErrExist}
+	}
+
+	conn, err := net.DialTimeout(network, path, time.Second)
+	if err == nil {
+		conn.Close()
+		return &net.OpError{Op: "listen", Net: network, Addr: addr, Err: syscall.EADDRINUSE}
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return &net.OpError{Op: "listen", Net: network, Addr: addr, Err: err}
+	}
+	return os.Remove(path)
+}
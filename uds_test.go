@@ -0,0 +1,159 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func udsProxyRoundtrip(path string) error {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	ln, err := UDSListener(path)
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: UDSTransporter(),
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	return proxyRoundtrip(client, server, httpSrv.URL, sendData)
+}
+
+func TestUDSListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gost.sock")
+
+	// the stale socket file left by a previous server.
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Skip(err)
+	}
+	ln.SetUnlinkOnClose(false)
+	ln.Close()
+
+	if err := udsProxyRoundtrip(path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUDSListenerNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gost.sock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := UDSListener(path); err == nil {
+		ln.Close()
+		t.Error("should failed on the regular file")
+	}
+}
+
+func TestUDSListenerInUse(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "stream.sock")
+	ln, err := UDSStreamListener(path)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	if ln2, err := UDSStreamListener(path); err == nil {
+		ln2.Close()
+		t.Error("should failed on the live socket")
+	}
+	// the live socket is not removed.
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Error(err)
+	} else {
+		conn.Close()
+	}
+
+	path = filepath.Join(dir, "dgram.sock")
+	dln, err := UDSDatagramListener(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dln.Close()
+	if ln2, err := UDSDatagramListener(path); err == nil {
+		ln2.Close()
+		t.Error("should failed on the live datagram socket")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUDSListenerAbstract(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract socket is only supported on Linux")
+	}
+	if err := udsProxyRoundtrip("@gost-test-abstract"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUDSDatagramListener(t *testing.T) {
+	dir := t.TempDir()
+	ln, err := UDSDatagramListener(filepath.Join(dir, "server.sock"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b := make([]byte, 1024)
+				n, err := conn.Read(b)
+				if err != nil {
+					return
+				}
+				conn.Write(b[:n])
+			}()
+		}
+	}()
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "client.sock"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+	if _, err := conn.WriteTo(sendData, ln.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	recv := make([]byte, 1024)
+	n, err := conn.Read(recv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sendData, recv[:n]) {
+		t.Error("data not equal")
+	}
+}
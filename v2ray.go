@@ -0,0 +1,239 @@
+package gost
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/go-log/log"
+)
+
+// v2rayOutbound is the outbound object of the V2Ray config, only the fields used by gost are decoded.
+type v2rayOutbound struct {
+	Protocol string `json:"protocol"`
+	Tag      string `json:"tag"`
+	Settings struct {
+		Vnext []struct {
+			Address string `json:"address"`
+			Port    int    `json:"port"`
+			Users   []struct {
+				ID         string `json:"id"`
+				AlterID    int    `json:"alterId"`
+				Security   string `json:"security"`
+				Encryption string `json:"encryption"`
+				Flow       string `json:"flow"`
+			} `json:"users"`
+		} `json:"vnext"`
+		Servers []struct {
+			Address  string `json:"address"`
+			Port     int    `json:"port"`
+			Method   string `json:"method"`
+			Password string `json:"password"`
+		} `json:"servers"`
+	} `json:"settings"`
+	StreamSettings struct {
+		Network     string `json:"network"`
+		Security    string `json:"security"`
+		TLSSettings struct {
+			ServerName    string `json:"serverName"`
+			AllowInsecure bool   `json:"allowInsecure"`
+		} `json:"tlsSettings"`
+		WSSettings struct {
+			Path    string            `json:"path"`
+			Headers map[string]string `json:"headers"`
+		} `json:"wsSettings"`
+		GRPCSettings struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"grpcSettings"`
+	} `json:"streamSettings"`
+	Mux struct {
+		Enabled bool `json:"enabled"`
+	} `json:"mux"`
+}
+
+// ImportV2RayOutbound reads the outbounds of the V2Ray JSON config file and converts them to the nodes.
+// The file is a config with the outbounds, an array of the outbounds, or an outbound.
+// The vmess, vless, trojan, shadowsocks and freedom outbounds are supported, each server of the outbound
+// is a node, with the first user of the server. The tag of the outbound is set to the Values as name.
+//
+// The streamSettings of tcp, ws and grpc with or without tls are converted to the transports
+// tcp, tls, ws, wss and grpc, the other networks are skipped with a warning, as well as the other protocols.
+// The features that gost does not support, such as mux and the flow of vless other than
+// xtls-rprx-vision over tls, are ignored with a warning.
+//
+// The shadowsocks and vless nodes are ready for use. The vmess and trojan nodes keep the parameters of
+// the outbounds in the Values, they are usable only by a Connector of the protocol. The freedom outbound
+// is the node of the protocol freedom without address, which is the direct connection,
+// it should not be added to a chain.
+func ImportV2RayOutbound(jsonPath string) ([]*Node, error) {
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var outbounds []v2rayOutbound
+	switch data = bytes.TrimSpace(data); {
+	case bytes.HasPrefix(data, []byte("[")):
+		err = json.Unmarshal(data, &outbounds)
+	default:
+		var cfg struct {
+			Outbounds []v2rayOutbound `json:"outbounds"`
+			v2rayOutbound
+		}
+		if err = json.Unmarshal(data, &cfg); err == nil {
+			outbounds = cfg.Outbounds
+			if cfg.Protocol != "" {
+				outbounds = append(outbounds, cfg.v2rayOutbound)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("v2ray %s: %w", jsonPath, err)
+	}
+
+	var nodes []*Node
+	for i := range outbounds {
+		ob := &outbounds[i]
+		ns, err := ob.nodes()
+		if err != nil {
+			log.Logf("[v2ray] outbound %q: %s, skipped", ob.Tag, err)
+			continue
+		}
+		nodes = append(nodes, ns...)
+	}
+	return nodes, nil
+}
+
+func (ob *v2rayOutbound) nodes() ([]*Node, error) {
+	var nodes []*Node
+	switch ob.Protocol {
+	case "freedom":
+		nodes = append(nodes, &Node{
+			Protocol:  "freedom",
+			Transport: "tcp",
+			Values:    url.Values{"name": {ob.Tag}},
+			marker:    &failMarker{},
+		})
+	case "vmess", "vless":
+		for _, v := range ob.Settings.Vnext {
+			if len(v.Users) == 0 || v.Users[0].ID == "" {
+				return nil, errors.New("missing user id")
+			}
+			u := v.Users[0]
+			node, err := ob.node(v.Address, v.Port)
+			if err != nil {
+				return nil, err
+			}
+			node.User = url.User(u.ID)
+			if ob.Protocol == "vmess" {
+				node.Values.Set("alterId", strconv.Itoa(u.AlterID))
+				if u.Security != "" {
+					node.Values.Set("cipher", u.Security)
+				}
+			} else if u.Encryption != "" {
+				node.Values.Set("encryption", u.Encryption)
+			}
+			if u.Flow != "" {
+				node.Values.Set("flow", u.Flow)
+				if err := checkNodeFlow(*node); err != nil {
+					log.Logf("[v2ray] outbound %q: %s, ignored", ob.Tag, err)
+					node.Values.Del("flow")
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	case "trojan", "shadowsocks":
+		for _, s := range ob.Settings.Servers {
+			if s.Password == "" || (ob.Protocol == "shadowsocks" && s.Method == "") {
+				return nil, errors.New("missing method or password")
+			}
+			node, err := ob.node(s.Address, s.Port)
+			if err != nil {
+				return nil, err
+			}
+			if ob.Protocol == "shadowsocks" {
+				if node.Transport != "tcp" {
+					return nil, fmt.Errorf("unsupported transport %s of shadowsocks", node.Transport)
+				}
+				node.Protocol = "ss"
+				node.User = url.UserPassword(s.Method, s.Password)
+			} else {
+				node.User = url.User(s.Password)
+			}
+			nodes = append(nodes, node)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported protocol %s", ob.Protocol)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no server")
+	}
+	if ob.Mux.Enabled {
+		log.Logf("[v2ray] outbound %q: mux is not supported, ignored", ob.Tag)
+	}
+	return nodes, nil
+}
+
+// node creates the node of the server, with the streamSettings of the outbound.
+func (ob *v2rayOutbound) node(address string, port int) (*Node, error) {
+	if address == "" || port <= 0 || port > 65535 {
+		return nil, errors.New("invalid address or port")
+	}
+
+	ss := &ob.StreamSettings
+	var tls bool
+	switch ss.Security {
+	case "", "none":
+	case "tls":
+		tls = true
+	default:
+		return nil, fmt.Errorf("unsupported security %s", ss.Security)
+	}
+	var transport string
+	switch ss.Network {
+	case "", "tcp":
+		transport = "tcp"
+		if tls {
+			transport = "tls"
+		}
+	case "ws":
+		transport = "ws"
+		if tls {
+			transport = "wss"
+		}
+	case "grpc":
+		transport = "grpc"
+	default:
+		return nil, fmt.Errorf("unsupported network %s", ss.Network)
+	}
+
+	node := importNode(ob.Protocol, transport, address, port, nil)
+	if ob.Tag != "" {
+		node.Values.Set("name", ob.Tag)
+	}
+	if tls {
+		if transport == "grpc" {
+			node.Values.Set("tls", "true")
+		}
+		if !ss.TLSSettings.AllowInsecure {
+			node.Values.Set("secure", "true")
+		}
+		if ss.TLSSettings.ServerName != "" {
+			node.Values.Set("serverName", ss.TLSSettings.ServerName)
+		}
+	}
+	if ss.WSSettings.Path != "" {
+		node.Values.Set("path", ss.WSSettings.Path)
+	}
+	if host := ss.WSSettings.Headers["Host"]; host != "" {
+		node.Values.Set("host", host)
+	}
+	if ss.GRPCSettings.ServiceName != "" {
+		node.Values.Set("serviceName", ss.GRPCSettings.ServiceName)
+	}
+	return node, nil
+}
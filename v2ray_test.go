@@ -0,0 +1,97 @@
+package gost
+
+import (
+	"testing"
+)
+
+const v2rayTestConfig = `{
+	"outbounds": [
+		{
+			"protocol": "vmess",
+			"tag": "vmess-ws",
+			"settings": {"vnext": [{"address": "vmess.example.com", "port": 443, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "alterId": 0, "security": "auto"}]}]},
+			"streamSettings": {"network": "ws", "security": "tls", "tlsSettings": {"serverName": "example.com"}, "wsSettings": {"path": "/ray", "headers": {"Host": "cdn.example.com"}}},
+			"mux": {"enabled": true}
+		},
+		{
+			"protocol": "vless",
+			"tag": "vless-grpc",
+			"settings": {"vnext": [{"address": "vless.example.com", "port": 443, "users": [{"id": "27848739-7e62-4138-9fd3-098a63964b6b", "encryption": "none", "flow": "xtls-rprx-vision"}]}]},
+			"streamSettings": {"network": "grpc", "security": "tls", "tlsSettings": {"allowInsecure": true}, "grpcSettings": {"serviceName": "grpc"}}
+		},
+		{
+			"protocol": "trojan",
+			"tag": "trojan",
+			"settings": {"servers": [{"address": "192.0.2.1", "port": 443, "password": "secret"}, {"address": "192.0.2.2", "port": 443, "password": "secret"}]},
+			"streamSettings": {"security": "tls"}
+		},
+		{
+			"protocol": "shadowsocks",
+			"tag": "ss",
+			"settings": {"servers": [{"address": "192.0.2.3", "port": 8388, "method": "aes-256-gcm", "password": "secret"}]}
+		},
+		{"protocol": "freedom", "tag": "direct"},
+		{"protocol": "blackhole", "tag": "block"},
+		{
+			"protocol": "vmess",
+			"tag": "vmess-kcp",
+			"settings": {"vnext": [{"address": "vmess.example.com", "port": 443, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"}]}]},
+			"streamSettings": {"network": "kcp"}
+		}
+	]
+}`
+
+func TestImportV2RayOutbound(t *testing.T) {
+	nodes, err := ImportV2RayOutbound(writeConfigFile(t, "v2ray.json", v2rayTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, protocol, transport, addr, user string
+		values                                map[string]string
+	}{
+		{"vmess-ws", "vmess", "wss", "vmess.example.com:443", "b831381d-6324-4d53-ad4f-8cda48b30811",
+			map[string]string{"alterId": "0", "cipher": "auto", "serverName": "example.com", "path": "/ray", "host": "cdn.example.com", "secure": "true"}},
+		{"vless-grpc", "vless", "grpc", "vless.example.com:443", "27848739-7e62-4138-9fd3-098a63964b6b",
+			map[string]string{"encryption": "none", "tls": "true", "serviceName": "grpc", "secure": "", "flow": ""}},
+		{"trojan", "trojan", "tls", "192.0.2.1:443", "secret", map[string]string{"secure": "true"}},
+		{"trojan", "trojan", "tls", "192.0.2.2:443", "secret", nil},
+		{"ss", "ss", "tcp", "192.0.2.3:8388", "aes-256-gcm:secret", nil},
+		{"direct", "freedom", "tcp", "", "", nil},
+	}
+	if len(nodes) != len(tests) {
+		t.Fatalf("got %d nodes, want %d", len(nodes), len(tests))
+	}
+	for i, tc := range tests {
+		node := nodes[i]
+		var user string
+		if node.User != nil {
+			user = node.User.String()
+		}
+		if node.Values.Get("name") != tc.name || node.Protocol != tc.protocol || node.Transport != tc.transport ||
+			node.Addr != tc.addr || user != tc.user {
+			t.Errorf("#%d got %s %s+%s://%s@%s", i, node.Values.Get("name"), node.Protocol, node.Transport, user, node.Addr)
+		}
+		for k, v := range tc.values {
+			if got := node.Values.Get(k); got != v {
+				t.Errorf("#%d %s got %q, want %q", i, k, got, v)
+			}
+		}
+	}
+}
+
+func TestImportV2RayOutboundSingle(t *testing.T) {
+	for _, data := range []string{
+		`{"protocol": "freedom"}`,
+		`[{"protocol": "freedom"}]`,
+	} {
+		nodes, err := ImportV2RayOutbound(writeConfigFile(t, "outbound.json", data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 || nodes[0].Protocol != "freedom" {
+			t.Errorf("%s: got %v", data, nodes)
+		}
+	}
+}
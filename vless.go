@@ -0,0 +1,451 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+func init() {
+	DefaultRegistry.RegisterProtocol("vless", Protocol{
+		NewConnector: func(node Node, opts *NodeOptions) Connector {
+			return VLESSConnector(node.User, node.Get("flow"))
+		},
+		NewHandler: func(node Node, opts *NodeOptions) (Handler, error) {
+			return VLESSHandler(node.Get("flow")), nil
+		},
+	})
+}
+
+const (
+	vlessVersion = 0
+
+	vlessCmdTCP = 1
+
+	vlessAddrIPv4   = 1
+	vlessAddrDomain = 2
+	vlessAddrIPv6   = 3
+)
+
+var (
+	errVLESSBadVersion = errors.New("vless: bad version")
+)
+
+// parseVLESSUUID parses the UUID of the VLESS user in the canonical form.
+func parseVLESSUUID(s string) (uuid [16]byte, err error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		return uuid, fmt.Errorf("vless: invalid UUID %s", s)
+	}
+	copy(uuid[:], b)
+	return
+}
+
+// formatVLESSUUID returns the canonical form of the UUID in lower case.
+func formatVLESSUUID(uuid [16]byte) string {
+	s := hex.EncodeToString(uuid[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// vlessAddons encodes the addons of the header, which is the protobuf message with the flow as field 1.
+func vlessAddons(flow string) []byte {
+	if flow == "" {
+		return []byte{0}
+	}
+	return append([]byte{byte(2 + len(flow)), 0x0a, byte(len(flow))}, flow...)
+}
+
+// readVLESSAddons reads the addons of the header and returns the flow.
+func readVLESSAddons(r io.Reader) (flow string, err error) {
+	var b [1]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return
+	}
+	addons := make([]byte, b[0])
+	if _, err = io.ReadFull(r, addons); err != nil {
+		return
+	}
+	for len(addons) > 0 {
+		key, n := binary.Uvarint(addons)
+		if n <= 0 {
+			return "", errors.New("vless: bad addons")
+		}
+		addons = addons[n:]
+		var v uint64
+		switch key & 0x07 {
+		case 0: // varint
+			if _, n = binary.Uvarint(addons); n <= 0 {
+				return "", errors.New("vless: bad addons")
+			}
+		case 1: // 64-bit
+			n = 8
+		case 2: // length-delimited
+			if v, n = binary.Uvarint(addons); n <= 0 || v > uint64(len(addons)-n) {
+				return "", errors.New("vless: bad addons")
+			}
+			if key>>3 == 1 {
+				flow = string(addons[n : n+int(v)])
+			}
+			n += int(v)
+		case 5: // 32-bit
+			n = 4
+		default:
+			return "", errors.New("vless: bad addons")
+		}
+		if n > len(addons) {
+			return "", errors.New("vless: bad addons")
+		}
+		addons = addons[n:]
+	}
+	return
+}
+
+// vlessAddr encodes the address of the request, the port is followed by the address.
+func vlessAddr(address string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	b := binary.BigEndian.AppendUint16(nil, uint16(p))
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("vless: host %s is too long", host)
+		}
+		b = append(b, vlessAddrDomain, byte(len(host)))
+		b = append(b, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append(append(b, vlessAddrIPv4), ip4...)
+	} else {
+		b = append(append(b, vlessAddrIPv6), ip.To16()...)
+	}
+	return b, nil
+}
+
+func readVLESSAddr(r io.Reader) (string, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:3]); err != nil {
+		return "", err
+	}
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(b[:])))
+	var host []byte
+	switch b[2] {
+	case vlessAddrIPv4:
+		host = make([]byte, net.IPv4len)
+	case vlessAddrIPv6:
+		host = make([]byte, net.IPv6len)
+	case vlessAddrDomain:
+		if _, err := io.ReadFull(r, b[3:]); err != nil {
+			return "", err
+		}
+		host = make([]byte, b[3])
+	default:
+		return "", fmt.Errorf("vless: bad address type %d", b[2])
+	}
+	if _, err := io.ReadFull(r, host); err != nil {
+		return "", err
+	}
+	if b[2] == vlessAddrDomain {
+		return net.JoinHostPort(string(host), port), nil
+	}
+	return net.JoinHostPort(net.IP(host).String(), port), nil
+}
+
+type vlessConnector struct {
+	user *url.Userinfo
+	flow string
+}
+
+// VLESSConnector creates a Connector for VLESS proxy client, the user name is the UUID of the user.
+// The flow is XTLSFlowVision or empty, the flow requires the TLS transport with the same flow, see WithXTLSFlow.
+// Only TCP is supported.
+func VLESSConnector(user *url.Userinfo, flow string) Connector {
+	return &vlessConnector{
+		user: user,
+		flow: flow,
+	}
+}
+
+func (c *vlessConnector) Connect(conn net.Conn, address string, options ...ConnectOption) (net.Conn, error) {
+	return c.ConnectContext(context.Background(), conn, "tcp", address, options...)
+}
+
+func (c *vlessConnector) ConnectContext(ctx context.Context, conn net.Conn, network, address string, options ...ConnectOption) (net.Conn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%s unsupported", network)
+	}
+
+	opts := &ConnectOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = ConnectTimeout
+	}
+
+	if c.user == nil {
+		return nil, errors.New("vless: missing UUID")
+	}
+	uuid, err := parseVLESSUUID(c.user.Username())
+	if err != nil {
+		return nil, err
+	}
+	addr, err := vlessAddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{vlessVersion}, uuid[:]...)
+	header = append(header, vlessAddons(c.flow)...)
+	header = append(header, vlessCmdTCP)
+	header = append(header, addr...)
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if c.flow != "" {
+		if err := checkXTLSFlow(c.flow); err != nil {
+			return nil, err
+		}
+		xc, ok := conn.(*XTLSConn)
+		if !ok {
+			return nil, fmt.Errorf("vless: flow %s requires the tls transport with the same flow", c.flow)
+		}
+		if err := xc.vision(uuid, header); err != nil {
+			return nil, err
+		}
+		return &vlessVisionConn{XTLSConn: xc}, nil
+	}
+
+	vc := &vlessConn{Conn: conn}
+	// write the header at once.
+	if opts.NoDelay {
+		if _, err := conn.Write(header); err != nil {
+			return nil, err
+		}
+	} else {
+		vc.wbuf.Write(header)
+	}
+	return vc, nil
+}
+
+// vlessResponse reads the response header once.
+type vlessResponse struct {
+	once sync.Once
+	err  error
+}
+
+func (r *vlessResponse) read(conn io.Reader) error {
+	r.once.Do(func() {
+		var b [1]byte
+		if _, r.err = io.ReadFull(conn, b[:]); r.err != nil {
+			return
+		}
+		if b[0] != vlessVersion {
+			r.err = errVLESSBadVersion
+			return
+		}
+		_, r.err = readVLESSAddons(conn)
+	})
+	return r.err
+}
+
+type vlessConn struct {
+	net.Conn
+	wbuf bytes.Buffer
+	resp vlessResponse
+}
+
+func (c *vlessConn) Read(b []byte) (n int, err error) {
+	if err = c.resp.read(c.Conn); err != nil {
+		return
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *vlessConn) Write(b []byte) (n int, err error) {
+	n = len(b) // force byte length consistent
+	if c.wbuf.Len() > 0 {
+		c.wbuf.Write(b) // append the data to the cached header
+		_, err = c.Conn.Write(c.wbuf.Bytes())
+		c.wbuf.Reset()
+		return
+	}
+	_, err = c.Conn.Write(b)
+	return
+}
+
+// vlessVisionConn is the client connection of the vision flow, the response header is not framed.
+type vlessVisionConn struct {
+	*XTLSConn
+	resp vlessResponse
+}
+
+func (c *vlessVisionConn) Read(b []byte) (n int, err error) {
+	if err = c.resp.read(c.XTLSConn.Conn); err != nil {
+		return
+	}
+	return c.XTLSConn.Read(b)
+}
+
+func (c *vlessVisionConn) WriteTo(w io.Writer) (n int64, err error) {
+	if err = c.resp.read(c.XTLSConn.Conn); err != nil {
+		return
+	}
+	return c.XTLSConn.WriteTo(w)
+}
+
+type vlessHandler struct {
+	flow    string
+	options *HandlerOptions
+}
+
+// VLESSHandler creates a server Handler for VLESS proxy server, the users are the UUIDs in the canonical form
+// in lower case, which are checked by the Authenticator. The flow is XTLSFlowVision or empty, it must be the same
+// as the flow of the clients, the flow requires the TLS listener with the same flow, see WithXTLSServerFlow.
+func VLESSHandler(flow string, opts ...HandlerOption) Handler {
+	h := &vlessHandler{flow: flow}
+	h.Init(opts...)
+
+	return h
+}
+
+func (h *vlessHandler) Init(options ...HandlerOption) {
+	if h.options == nil {
+		h.options = &HandlerOptions{}
+	}
+	for _, opt := range options {
+		opt(h.options)
+	}
+}
+
+func (h *vlessHandler) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+	uuid, host, err := h.readRequest(conn)
+	if err != nil {
+		log.Logf("[vless] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	log.Logf("[vless] %s -> %s", conn.RemoteAddr(), host)
+
+	var xc *XTLSConn
+	if h.flow != "" {
+		var ok bool
+		if xc, ok = conn.(*XTLSConn); !ok {
+			log.Logf("[vless] %s - %s : flow %s requires the tls listener with the same flow",
+				conn.RemoteAddr(), conn.LocalAddr(), h.flow)
+			return
+		}
+	}
+
+	if !Can("tcp", host, h.options.Whitelist, h.options.Blacklist) {
+		log.Logf("[vless] %s - %s : Unauthorized to tcp connect to %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		return
+	}
+
+	if h.options.Bypass.Contains(host) {
+		log.Logf("[vless] %s - %s : Bypass %s",
+			conn.RemoteAddr(), conn.LocalAddr(), host)
+		return
+	}
+
+	retries := 1
+	if h.options.Chain != nil && h.options.Chain.Retries > 0 {
+		retries = h.options.Chain.Retries
+	}
+	if h.options.Retries > 0 {
+		retries = h.options.Retries
+	}
+
+	var cc net.Conn
+	for i := 0; i < retries; i++ {
+		cc, err = h.options.Chain.Dial(host,
+			TimeoutChainOption(h.options.Timeout),
+			HostsChainOption(h.options.Hosts),
+			ResolverChainOption(h.options.Resolver),
+		)
+		if err == nil {
+			break
+		}
+		log.Logf("[vless] %s -> %s : %s",
+			conn.RemoteAddr(), conn.LocalAddr(), err)
+	}
+	if err != nil {
+		return
+	}
+	defer cc.Close()
+
+	resp := []byte{vlessVersion, 0}
+	if xc != nil {
+		err = xc.vision(uuid, resp)
+	} else {
+		_, err = conn.Write(resp)
+	}
+	if err != nil {
+		log.Logf("[vless] %s - %s : %s", conn.RemoteAddr(), conn.LocalAddr(), err)
+		return
+	}
+
+	log.Logf("[vless] %s <-> %s", conn.RemoteAddr(), host)
+	transport(conn, cc)
+	log.Logf("[vless] %s >-< %s", conn.RemoteAddr(), host)
+}
+
+// readRequest reads the request header, and checks the user and the flow.
+func (h *vlessHandler) readRequest(conn net.Conn) (uuid [16]byte, host string, err error) {
+	var b [17]byte
+	if _, err = io.ReadFull(conn, b[:]); err != nil {
+		return
+	}
+	if b[0] != vlessVersion {
+		err = errVLESSBadVersion
+		return
+	}
+	copy(uuid[:], b[1:])
+	if user := formatVLESSUUID(uuid); h.options.Authenticator == nil || !h.options.Authenticator.Authenticate(user, "") {
+		err = fmt.Errorf("vless: %s unauthorized", user)
+		return
+	}
+
+	flow, err := readVLESSAddons(conn)
+	if err != nil {
+		return
+	}
+	if flow != h.flow {
+		err = fmt.Errorf("vless: flow %q mismatch, want %q", flow, h.flow)
+		return
+	}
+
+	if _, err = io.ReadFull(conn, b[:1]); err != nil {
+		return
+	}
+	if b[0] != vlessCmdTCP {
+		err = fmt.Errorf("vless: unsupported command %d", b[0])
+		return
+	}
+	host, err = readVLESSAddr(conn)
+	return
+}
@@ -0,0 +1,66 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func vlessRoundtrip(targetURL string, data []byte, clientUUID, serverUUID string) error {
+	ln, err := TCPListener("")
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		Connector:   VLESSConnector(url.User(clientUUID), ""),
+		Transporter: TCPTransporter(),
+	}
+
+	server := &Server{
+		Listener: ln,
+		Handler:  VLESSHandler("", AuthenticatorHandlerOption(NewLocalAuthenticator(map[string]string{serverUUID: ""}))),
+	}
+
+	go server.Run()
+	defer server.Close()
+
+	return proxyRoundtrip(client, server, targetURL, data)
+}
+
+func TestVLESS(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	data := make([]byte, 1024)
+	rand.Read(data)
+
+	if err := vlessRoundtrip(httpSrv.URL, data, xtlsTestUUID, xtlsTestUUID); err != nil {
+		t.Error(err)
+	}
+	if err := vlessRoundtrip(httpSrv.URL, data, "7b4a3fd6-5f6c-4f3e-9a52-3b1a0e9d0c11", xtlsTestUUID); err == nil {
+		t.Error("the unknown user should be rejected")
+	}
+}
+
+func TestVLESSAddons(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		flow string
+		ok   bool
+	}{
+		{vlessAddons(""), "", true},
+		{vlessAddons(XTLSFlowVision), XTLSFlowVision, true},
+		// the flow followed by the seed (field 2)
+		{append(append([]byte{22, 0x0a, 16}, XTLSFlowVision...), 0x12, 2, 1, 2), XTLSFlowVision, true},
+		{[]byte{3, 0x0a, 16, 'x'}, "", false},
+	}
+	for i, tc := range tests {
+		flow, err := readVLESSAddons(bytes.NewReader(tc.b))
+		if (err == nil) != tc.ok || flow != tc.flow {
+			t.Errorf("#%d: got %q %v, want %q", i, flow, err, tc.flow)
+		}
+	}
+}
@@ -7,12 +7,72 @@ import (
 	"github.com/mdlayher/vsock"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("vsock", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return VSOCKTransporter(), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return VSOCKListener(node.Addr)
+		},
+	})
+}
+
+type vsockOptions struct {
+	cid  *uint32
+	port *uint32
+}
+
+// VSOCKOption allows a common way to set the VSOCK transporter and listener options.
+type VSOCKOption func(opts *vsockOptions)
+
+// VSOCKContextIDOption specifies the context ID to connect to instead of the host of the Dial address.
+// Use the CID 2 (host) in the guest to reach the host, and the CID of the guest on the host to reach the guest.
+func VSOCKContextIDOption(cid uint32) VSOCKOption {
+	return func(opts *vsockOptions) {
+		opts.cid = &cid
+	}
+}
+
+// VSOCKPortOption specifies the port to connect to or listen on instead of the port of the address.
+func VSOCKPortOption(port uint32) VSOCKOption {
+	return func(opts *vsockOptions) {
+		opts.port = &port
+	}
+}
+
+// address returns the VSOCK address of addr with the context ID and port of the options,
+// addr is not used if both of them are specified.
+func (opts *vsockOptions) address(addr string) (*vsock.Addr, error) {
+	vAddr := &vsock.Addr{}
+	if opts.cid == nil || opts.port == nil {
+		var err error
+		if vAddr, err = parseAddr(addr); err != nil {
+			return nil, err
+		}
+	}
+	if opts.cid != nil {
+		vAddr.ContextID = *opts.cid
+	}
+	if opts.port != nil {
+		vAddr.Port = *opts.port
+	}
+	return vAddr, nil
+}
+
 // vsockTransporter is a raw VSOCK transporter.
-type vsockTransporter struct{}
+type vsockTransporter struct {
+	options vsockOptions
+}
 
 // VSOCKTransporter creates a raw VSOCK client.
-func VSOCKTransporter() Transporter {
-	return &vsockTransporter{}
+// With both VSOCKContextIDOption and VSOCKPortOption, it connects to the fixed endpoint and the Dial address is ignored.
+func VSOCKTransporter(opts ...VSOCKOption) Transporter {
+	tr := &vsockTransporter{}
+	for _, opt := range opts {
+		opt(&tr.options)
+	}
+	return tr
 }
 
 func (tr *vsockTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
@@ -21,7 +81,7 @@ func (tr *vsockTransporter) Dial(addr string, options ...DialOption) (net.Conn,
 		option(opts)
 	}
 	if opts.Chain == nil {
-		vAddr, err := parseAddr(addr)
+		vAddr, err := tr.options.address(addr)
 		if err != nil {
 			return nil, err
 		}
@@ -30,7 +90,7 @@ func (tr *vsockTransporter) Dial(addr string, options ...DialOption) (net.Conn,
 	return opts.Chain.Dial(addr)
 }
 
-func parseUint32(s string) (uint32, error ) {
+func parseUint32(s string) (uint32, error) {
 	n, err := strconv.ParseUint(s, 10, 32)
 	if err != nil {
 		return 0, err
@@ -67,10 +127,21 @@ func (tr *vsockTransporter) Multiplex() bool {
 }
 
 // VSOCKListener creates a Listener for VSOCK proxy server.
-func VSOCKListener(addr string) (Listener, error) {
-	vAddr, err := parseAddr(addr)
-	if err != nil {
-		return nil, err
+// The port of VSOCKPortOption is used instead of the port of addr, which can be empty then.
+// VSOCK is only supported on Linux, the listener fails on the other platforms.
+func VSOCKListener(addr string, opts ...VSOCKOption) (Listener, error) {
+	options := &vsockOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	vAddr := &vsock.Addr{}
+	if options.port == nil {
+		var err error
+		if vAddr, err = parseAddr(addr); err != nil {
+			return nil, err
+		}
+	} else {
+		vAddr.Port = *options.port
 	}
 	return vsock.Listen(vAddr.Port, nil)
 }
@@ -0,0 +1,45 @@
+package gost
+
+import (
+	"crypto/rand"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdlayher/vsock"
+)
+
+func TestVSOCKTransporterOptions(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+
+	// the loopback requires the vsock_loopback module (Linux 5.6+).
+	const port = 10808
+	ln, err := VSOCKListener("", VSOCKPortOption(port))
+	if err != nil {
+		t.Skip(err)
+	}
+	probe, err := vsock.Dial(vsock.Local, port, nil)
+	if err != nil {
+		ln.Close()
+		t.Skip("vsock loopback is not available:", err)
+	}
+	probe.Close()
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: VSOCKTransporter(VSOCKContextIDOption(vsock.Local), VSOCKPortOption(port)),
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+		t.Error(err)
+	}
+}
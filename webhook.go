@@ -0,0 +1,92 @@
+package gost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+const (
+	// webhookQueueSize is the max number of the events waiting for delivery, the new events are dropped if it is full.
+	webhookQueueSize = 1024
+	// webhookRetries is the max number of the retries of a failed delivery.
+	webhookRetries = 3
+)
+
+// webhookRetryInterval is the initial interval between the retries, it is doubled for each retry.
+var webhookRetryInterval = time.Second
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+	ch     chan ConnEvent
+}
+
+// WebhookNotifier creates a Middleware which sends a JSON POST request (ConnEvent) to webhookURL for each event
+// of the connections. The events are delivered in order by a background goroutine, so the proxy is not blocked,
+// a failed delivery (an error or a non-2xx response) is retried up to 3 times with exponential backoff.
+func WebhookNotifier(webhookURL string, events []EventType) Middleware {
+	n := &webhookNotifier{
+		url:    webhookURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+		ch:     make(chan ConnEvent, webhookQueueSize),
+	}
+	go n.run()
+	return eventMiddleware(events, n.notify)
+}
+
+func (n *webhookNotifier) notify(e ConnEvent) {
+	select {
+	case n.ch <- e:
+	default:
+		if Debug {
+			log.Logf("[webhook] %s: event %s of %s is dropped, the queue is full", n.url, e.Event, e.SrcAddr)
+		}
+	}
+}
+
+func (n *webhookNotifier) run() {
+	for e := range n.ch {
+		n.deliver(e)
+	}
+}
+
+func (n *webhookNotifier) deliver(e ConnEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Logf("[webhook] %s: %v", n.url, err)
+		return
+	}
+
+	backoff := ExponentialBackoff(webhookRetryInterval, 0, 2)
+	for i := 0; ; i++ {
+		err = n.post(body)
+		if err == nil {
+			return
+		}
+		if i >= webhookRetries {
+			break
+		}
+		if Debug {
+			log.Logf("[webhook] %s: %v, retrying", n.url, err)
+		}
+		time.Sleep(backoff.Next())
+	}
+	log.Logf("[webhook] %s: event %s of %s: %v", n.url, e.Event, e.SrcAddr, err)
+}
+
+func (n *webhookNotifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package gost
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func webhookTestServer(t *testing.T, failures int32) (*httptest.Server, <-chan ConnEvent) {
+	events := make(chan ConnEvent, 16)
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e ConnEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		events <- e
+	}))
+	t.Cleanup(srv.Close)
+	return srv, events
+}
+
+func nextEvent(t *testing.T, events <-chan ConnEvent) ConnEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event received")
+	}
+	return ConnEvent{}
+}
+
+func middlewareRoundtrip(t *testing.T, mw Middleware, handler Handler, client *Client, targetURL string) error {
+	ln, err := TCPListener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{
+		Listener: ln,
+		Handler:  mw(handler),
+	}
+	go server.Run()
+	// the events are sent after the connections are handled.
+	defer server.Shutdown(context.Background())
+
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+	return proxyRoundtrip(client, server, targetURL, sendData)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	webhookRetryInterval = 10 * time.Millisecond
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+	target := httpSrv.Listener.Addr().String()
+
+	testCases := []struct {
+		name    string
+		handler Handler
+		client  *Client
+	}{
+		{"http", HTTPHandler(), &Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()}},
+		{"socks5", SOCKS5Handler(), &Client{Connector: SOCKS5Connector(nil), Transporter: TCPTransporter()}},
+		{"socks5 auth", SOCKS5Handler(UsersHandlerOption(url.UserPassword("admin", "123456"))),
+			&Client{Connector: SOCKS5Connector(url.UserPassword("admin", "123456")), Transporter: TCPTransporter()}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the first delivery is retried.
+			srv, events := webhookTestServer(t, 1)
+			mw := WebhookNotifier(srv.URL, []EventType{EventConnOpen, EventConnClose, EventConnError})
+			if err := middlewareRoundtrip(t, mw, tc.handler, tc.client, httpSrv.URL); err != nil {
+				t.Fatal(err)
+			}
+
+			e := nextEvent(t, events)
+			if e.Event != EventConnOpen || e.DstAddr != target || e.SrcAddr == "" {
+				t.Errorf("open event: %+v", e)
+			}
+			e = nextEvent(t, events)
+			if e.Event != EventConnClose || e.DstAddr != target || e.BytesIn == 0 || e.BytesOut == 0 {
+				t.Errorf("close event: %+v", e)
+			}
+			if e.Timestamp.IsZero() || e.DurationMs < 0 {
+				t.Errorf("close event: %+v", e)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	webhookRetryInterval = 10 * time.Millisecond
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	testCases := []struct {
+		name    string
+		handler Handler
+		client  *Client
+		err     string
+	}{
+		{"http", HTTPHandler(UsersHandlerOption(url.UserPassword("admin", "123456"))),
+			&Client{Connector: HTTPConnector(nil), Transporter: TCPTransporter()}, "HTTP 407"},
+		{"socks5", SOCKS5Handler(UsersHandlerOption(url.UserPassword("admin", "123456"))),
+			&Client{Connector: SOCKS5Connector(url.UserPassword("admin", "654321")), Transporter: TCPTransporter()},
+			"SOCKS5 authentication failure"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, events := webhookTestServer(t, 0)
+			mw := WebhookNotifier(srv.URL, []EventType{EventConnError})
+			if err := middlewareRoundtrip(t, mw, tc.handler, tc.client, httpSrv.URL); err == nil {
+				t.Fatal("should fail")
+			}
+			if e := nextEvent(t, events); e.Event != EventConnError || e.Error != tc.err {
+				t.Errorf("error event: %+v", e)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	webhookRetryInterval = 10 * time.Millisecond
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	notifier := &webhookNotifier{url: srv.URL, client: http.DefaultClient}
+	notifier.deliver(ConnEvent{Event: EventConnOpen})
+	if n != 1+webhookRetries {
+		t.Errorf("%d attempts, want %d", n, 1+webhookRetries)
+	}
+}
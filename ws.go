@@ -1,6 +1,7 @@
 package gost
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/tls"
@@ -19,6 +20,43 @@ import (
 	smux "github.com/xtaci/smux"
 )
 
+func init() {
+	DefaultRegistry.RegisterTransport("ws", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return WSTransporter(opts.WSOptions), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return WSListener(node.Addr, opts.WSOptions)
+		},
+	})
+	DefaultRegistry.RegisterTransport("mws", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return MWSTransporter(opts.WSOptions), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return MWSListener(node.Addr, opts.WSOptions)
+		},
+	})
+	DefaultRegistry.RegisterTransport("wss", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return WSSTransporter(opts.WSOptions), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return WSSListener(node.Addr, opts.TLSConfig, opts.WSOptions)
+		},
+		TLS: true,
+	})
+	DefaultRegistry.RegisterTransport("mwss", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			return MWSSTransporter(opts.WSOptions), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			return MWSSListener(node.Addr, opts.TLSConfig, opts.WSOptions)
+		},
+		TLS: true,
+	})
+}
+
 const (
 	defaultWSPath = "/ws"
 )
@@ -74,6 +112,8 @@ type mwsTransporter struct {
 }
 
 // MWSTransporter creates a Transporter that is used by multiplex-websocket proxy client.
+// The websocket connection to each server is established on the first use and shared by the streams,
+// it is re-established with the exponential backoff if the connection drops.
 func MWSTransporter(opts *WSOptions) Transporter {
 	return &mwsTransporter{
 		options:  opts,
@@ -88,31 +128,71 @@ func (tr *mwsTransporter) Dial(addr string, options ...DialOption) (conn net.Con
 	}
 
 	tr.sessionMutex.Lock()
-	defer tr.sessionMutex.Unlock()
-
 	session, ok := tr.sessions[addr]
+	reconnect := false
 	if session != nil && session.IsClosed() {
 		delete(tr.sessions, addr)
 		ok = false
+		reconnect = true
+	}
+	tr.sessionMutex.Unlock()
+	if ok {
+		return session.conn, nil
+	}
+
+	// the lock is not held while connecting, the other streams do not wait for the backoff.
+	conn, err = dialMWS(addr, opts, reconnect)
+	if err != nil {
+		return
 	}
-	if !ok {
-		timeout := opts.Timeout
-		if timeout <= 0 {
-			timeout = DialTimeout
-		}
 
+	tr.sessionMutex.Lock()
+	defer tr.sessionMutex.Unlock()
+
+	if session, ok := tr.sessions[addr]; ok && !session.IsClosed() {
+		conn.Close()
+		return session.conn, nil
+	}
+	tr.sessions[addr] = &muxSession{conn: conn}
+	return conn, nil
+}
+
+// the backoff of re-establishing the dropped multiplex-websocket connection.
+var (
+	mwsReconnectBackoffInitial = 100 * time.Millisecond
+	mwsReconnectBackoffMax     = 2 * time.Second
+)
+
+// dialMWS connects to the server of the multiplex-websocket session. If the session of the server was dropped,
+// the connection is retried with the exponential backoff within the dial timeout, so the new streams survive
+// a short outage of the server.
+func dialMWS(addr string, opts *DialOptions, reconnect bool) (conn net.Conn, err error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DialTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := ExponentialBackoff(mwsReconnectBackoffInitial, mwsReconnectBackoffMax, 2)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	for {
 		if opts.Chain == nil {
-			conn, err = net.DialTimeout("tcp", addr, timeout)
+			conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
 		} else {
-			conn, err = opts.Chain.Dial(addr)
+			conn, err = opts.Chain.DialContext(ctx, "tcp", addr)
 		}
-		if err != nil {
+		if err == nil || !reconnect {
 			return
 		}
-		session = &muxSession{conn: conn}
-		tr.sessions[addr] = session
+		d := backoff.Next()
+		if time.Until(deadline) < d {
+			return
+		}
+		log.Logf("[mws] %s : %s, reconnecting in %v", addr, err, d)
+		time.Sleep(d)
 	}
-	return session.conn, nil
 }
 
 func (tr *mwsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
@@ -127,32 +207,43 @@ func (tr *mwsTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (
 	}
 
 	tr.sessionMutex.Lock()
-	defer tr.sessionMutex.Unlock()
-
-	conn.SetDeadline(time.Now().Add(timeout))
-	defer conn.SetDeadline(time.Time{})
-
 	session, ok := tr.sessions[opts.Addr]
+	tr.sessionMutex.Unlock()
+
 	if !ok || session.session == nil {
+		conn.SetDeadline(time.Now().Add(timeout))
 		s, err := tr.initSession(opts.Addr, conn, opts)
+		conn.SetDeadline(time.Time{})
 		if err != nil {
 			conn.Close()
-			delete(tr.sessions, opts.Addr)
+			tr.removeSession(opts.Addr, session)
 			return nil, err
 		}
 		session = s
+		tr.sessionMutex.Lock()
 		tr.sessions[opts.Addr] = session
+		tr.sessionMutex.Unlock()
 	}
 
 	cc, err := session.GetConn()
 	if err != nil {
 		session.Close()
-		delete(tr.sessions, opts.Addr)
+		tr.removeSession(opts.Addr, session)
 		return nil, err
 	}
 	return cc, nil
 }
 
+// removeSession removes the session of addr, unless it has been replaced by another one.
+func (tr *mwsTransporter) removeSession(addr string, session *muxSession) {
+	tr.sessionMutex.Lock()
+	defer tr.sessionMutex.Unlock()
+
+	if tr.sessions[addr] == session {
+		delete(tr.sessions, addr)
+	}
+}
+
 func (tr *mwsTransporter) initSession(addr string, conn net.Conn, opts *HandshakeOptions) (*muxSession, error) {
 	if opts == nil {
 		opts = &HandshakeOptions{}
@@ -193,6 +284,9 @@ type wssTransporter struct {
 }
 
 // WSSTransporter creates a Transporter that is used by websocket secure proxy client.
+// The websocket is established over TLS, with the TLS config of HandshakeOptions, the certificate is not verified
+// if no TLS config is given. The node URL of the transport is wss://host:port?path=/ws, the path defaults to /ws,
+// e.g. http+wss://example.com:443?path=/proxy for HTTP proxy over it.
 func WSSTransporter(opts *WSOptions) Transporter {
 	return &wssTransporter{
 		options: opts,
@@ -231,6 +325,7 @@ type mwssTransporter struct {
 }
 
 // MWSSTransporter creates a Transporter that is used by multiplex-websocket secure proxy client.
+// The connections are shared and re-established as MWSTransporter.
 func MWSSTransporter(opts *WSOptions) Transporter {
 	return &mwssTransporter{
 		options:  opts,
@@ -245,31 +340,33 @@ func (tr *mwssTransporter) Dial(addr string, options ...DialOption) (conn net.Co
 	}
 
 	tr.sessionMutex.Lock()
-	defer tr.sessionMutex.Unlock()
-
 	session, ok := tr.sessions[addr]
+	reconnect := false
 	if session != nil && session.IsClosed() {
 		delete(tr.sessions, addr)
 		ok = false
+		reconnect = true
+	}
+	tr.sessionMutex.Unlock()
+	if ok {
+		return session.conn, nil
 	}
-	if !ok {
-		timeout := opts.Timeout
-		if timeout <= 0 {
-			timeout = DialTimeout
-		}
 
-		if opts.Chain == nil {
-			conn, err = net.DialTimeout("tcp", addr, timeout)
-		} else {
-			conn, err = opts.Chain.Dial(addr)
-		}
-		if err != nil {
-			return
-		}
-		session = &muxSession{conn: conn}
-		tr.sessions[addr] = session
+	// the lock is not held while connecting, the other streams do not wait for the backoff.
+	conn, err = dialMWS(addr, opts, reconnect)
+	if err != nil {
+		return
+	}
+
+	tr.sessionMutex.Lock()
+	defer tr.sessionMutex.Unlock()
+
+	if session, ok := tr.sessions[addr]; ok && !session.IsClosed() {
+		conn.Close()
+		return session.conn, nil
 	}
-	return session.conn, nil
+	tr.sessions[addr] = &muxSession{conn: conn}
+	return conn, nil
 }
 
 func (tr *mwssTransporter) Handshake(conn net.Conn, options ...HandshakeOption) (net.Conn, error) {
@@ -284,31 +381,43 @@ func (tr *mwssTransporter) Handshake(conn net.Conn, options ...HandshakeOption)
 	}
 
 	tr.sessionMutex.Lock()
-	defer tr.sessionMutex.Unlock()
-
-	conn.SetDeadline(time.Now().Add(timeout))
-	defer conn.SetDeadline(time.Time{})
-
 	session, ok := tr.sessions[opts.Addr]
+	tr.sessionMutex.Unlock()
+
 	if !ok || session.session == nil {
+		conn.SetDeadline(time.Now().Add(timeout))
 		s, err := tr.initSession(opts.Addr, conn, opts)
+		conn.SetDeadline(time.Time{})
 		if err != nil {
 			conn.Close()
-			delete(tr.sessions, opts.Addr)
+			tr.removeSession(opts.Addr, session)
 			return nil, err
 		}
 		session = s
+		tr.sessionMutex.Lock()
 		tr.sessions[opts.Addr] = session
+		tr.sessionMutex.Unlock()
 	}
+
 	cc, err := session.GetConn()
 	if err != nil {
 		session.Close()
-		delete(tr.sessions, opts.Addr)
+		tr.removeSession(opts.Addr, session)
 		return nil, err
 	}
 	return cc, nil
 }
 
+// removeSession removes the session of addr, unless it has been replaced by another one.
+func (tr *mwssTransporter) removeSession(addr string, session *muxSession) {
+	tr.sessionMutex.Lock()
+	defer tr.sessionMutex.Unlock()
+
+	if tr.sessions[addr] == session {
+		delete(tr.sessions, addr)
+	}
+}
+
 func (tr *mwssTransporter) initSession(addr string, conn net.Conn, opts *HandshakeOptions) (*muxSession, error) {
 	if opts == nil {
 		opts = &HandshakeOptions{}
@@ -571,7 +680,8 @@ type wssListener struct {
 	*wsListener
 }
 
-// WSSListener creates a Listener for websocket secure proxy server.
+// WSSListener creates a Listener for websocket secure proxy server, the websocket is served over TLS
+// by tlsConfig, or DefaultTLSConfig if it is nil. The clients connect to it by WSSTransporter.
 func WSSListener(addr string, tlsConfig *tls.Config, options *WSOptions) (Listener, error) {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
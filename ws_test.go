@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func httpOverWSRoundtrip(targetURL string, data []byte,
@@ -806,3 +807,111 @@ func TestMWSForwardTunnel(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMWSReconnect(t *testing.T) {
+	ln, err := MWSListener("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	server := &Server{Listener: ln, Handler: HTTPHandler()}
+	go server.Run()
+
+	tr := MWSTransporter(nil).(*mwsTransporter)
+	dial := func() error {
+		conn, err := tr.Dial(addr)
+		if err != nil {
+			return err
+		}
+		cc, err := tr.Handshake(conn, AddrHandshakeOption(addr), HostHandshakeOption(addr))
+		if err != nil {
+			return err
+		}
+		return cc.Close()
+	}
+	if err := dial(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server restarts, and the connection drops.
+	server.Close()
+	tr.sessions[addr].Close()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		ln, err := MWSListener(addr, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		server := &Server{Listener: ln, Handler: HTTPHandler()}
+		t.Cleanup(func() { server.Close() })
+		server.Run()
+	}()
+
+	start := time.Now()
+	if err := dial(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("reconnected in %v before the server restarts", d)
+	}
+}
+
+func TestMWSDialDuringReconnect(t *testing.T) {
+	ln, err := MWSListener("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Listener: ln, Handler: HTTPHandler()}
+	go server.Run()
+	defer server.Close()
+
+	tr := MWSTransporter(nil).(*mwsTransporter)
+	dial := func(addr string, options ...DialOption) error {
+		conn, err := tr.Dial(addr, options...)
+		if err != nil {
+			return err
+		}
+		cc, err := tr.Handshake(conn, AddrHandshakeOption(addr), HostHandshakeOption(addr))
+		if err != nil {
+			return err
+		}
+		return cc.Close()
+	}
+
+	// the session of the server down.
+	down, err := MWSListener("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	downServer := &Server{Listener: down, Handler: HTTPHandler()}
+	go downServer.Run()
+	if err := dial(downAddr); err != nil {
+		t.Fatal(err)
+	}
+	downServer.Close()
+	tr.sessions[downAddr].Close()
+
+	errc := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		errc <- dial(downAddr, TimeoutDialOption(time.Second))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the reconnecting does not block the other server.
+	if err := dial(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("blocked by the reconnecting for %v", d)
+	}
+
+	if err := <-errc; err == nil {
+		t.Error("should fail to reconnect")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("reconnected for %v, beyond the dial timeout", d)
+	}
+}
@@ -0,0 +1,572 @@
+package gost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-log/log"
+)
+
+// XTLSFlowVision is the XTLS flow of the VLESS protocol, which pads the inner TLS handshake and relays the inner
+// TLS 1.3 application data directly without the outer TLS encryption. It is compatible with Xray.
+const XTLSFlowVision = "xtls-rprx-vision"
+
+const (
+	xtlsCmdPaddingContinue = 0x00
+	xtlsCmdPaddingEnd      = 0x01
+	xtlsCmdPaddingDirect   = 0x02
+
+	// xtlsBufferSize is the buffer size of Xray, a padded frame with the UUID fits in a buffer.
+	xtlsBufferSize = 8192
+	// xtlsPacketsToFilter is the number of the packets of both directions which are checked for the inner TLS.
+	xtlsPacketsToFilter = 8
+	// xtlsMaxRecordSize is the max size of a TLS 1.3 record.
+	xtlsMaxRecordSize = 5 + 16384 + 256
+
+	xtlsStatePlain   = 0
+	xtlsStatePadding = 1
+	xtlsStateDirect  = 2
+)
+
+var (
+	xtlsApplicationDataStart = []byte{0x17, 0x03, 0x03}
+	// the supported_versions extension of TLS 1.3 in the ServerHello.
+	xtlsTLS13SupportedVersions = []byte{0x00, 0x2b, 0x00, 0x02, 0x03, 0x04}
+)
+
+// WithXTLSFlow sets the XTLS flow of TLSTransporter, only XTLSFlowVision is supported.
+// The connection is a XTLSConn, the flow is started by the VLESS connector with the same flow.
+func WithXTLSFlow(flow string) HandshakeOption {
+	return func(opts *HandshakeOptions) {
+		opts.XTLSFlow = flow
+	}
+}
+
+// WithXTLSServerFlow sets the XTLS flow of TLSListener, only XTLSFlowVision is supported.
+// The connections are XTLSConn, the flow is started by the VLESS handler with the same flow.
+func WithXTLSServerFlow(flow string) TLSListenerOption {
+	return func(opts *TLSListenerOptions) {
+		opts.XTLSFlow = flow
+	}
+}
+
+func checkXTLSFlow(flow string) error {
+	if flow != XTLSFlowVision {
+		return fmt.Errorf("xtls: unsupported flow %s", flow)
+	}
+	return nil
+}
+
+// checkNodeFlow checks the flow parameter of the node, the flow is only supported by vless+tls.
+func checkNodeFlow(node Node) error {
+	flow := node.Get("flow")
+	if flow == "" {
+		return nil
+	}
+	if err := checkXTLSFlow(flow); err != nil {
+		return err
+	}
+	if node.Protocol != "vless" || node.Transport != "tls" {
+		return fmt.Errorf("%s: flow %s is only supported by vless+tls", node.String(), flow)
+	}
+	return nil
+}
+
+// xtlsRecordConn reads the TLS records one by one, so crypto/tls does not read beyond the record
+// which switches the connection to the direct mode.
+type xtlsRecordConn struct {
+	net.Conn
+	header [5]byte
+	hn     int // the bytes of the header not read
+	rest   int // the bytes of the record body not read
+}
+
+func (c *xtlsRecordConn) Read(b []byte) (n int, err error) {
+	if c.hn == 0 && c.rest == 0 {
+		if _, err = io.ReadFull(c.Conn, c.header[:]); err != nil {
+			return
+		}
+		c.hn = len(c.header)
+		c.rest = int(binary.BigEndian.Uint16(c.header[3:]))
+	}
+	if c.hn > 0 {
+		n = copy(b, c.header[len(c.header)-c.hn:])
+		c.hn -= n
+		return
+	}
+	if len(b) > c.rest {
+		b = b[:c.rest]
+	}
+	n, err = c.Conn.Read(b)
+	c.rest -= n
+	return
+}
+
+// xtlsTrafficState is the inner TLS found by the packets of both directions, it is XtlsFilterTls of Xray.
+type xtlsTrafficState struct {
+	mu                   sync.Mutex
+	packetsToFilter      int
+	remainingServerHello int
+	cipher               uint16
+	isTLS                bool
+	isTLS12orAbove       bool
+	enableXTLS           bool
+}
+
+// filter checks a packet of the inner connection, the caller holds the lock.
+func (s *xtlsTrafficState) filter(b []byte) {
+	if s.packetsToFilter <= 0 {
+		return
+	}
+	s.packetsToFilter--
+	if len(b) >= 6 {
+		switch {
+		case b[0] == 0x16 && b[1] == 0x03 && b[2] == 0x03 && b[5] == 0x02: // ServerHello
+			s.remainingServerHello = int(binary.BigEndian.Uint16(b[3:])) + 5
+			s.isTLS = true
+			s.isTLS12orAbove = true
+			if len(b) >= 79 && s.remainingServerHello >= 79 {
+				if i := 43 + int(b[43]) + 1; i+2 <= len(b) {
+					s.cipher = binary.BigEndian.Uint16(b[i:])
+				}
+			}
+		case b[0] == 0x16 && b[1] == 0x03 && b[5] == tlsHandshakeClientHello:
+			s.isTLS = true
+		}
+	}
+	if s.remainingServerHello > 0 {
+		end := min(s.remainingServerHello, len(b))
+		s.remainingServerHello -= len(b)
+		if bytes.Contains(b[:end], xtlsTLS13SupportedVersions) {
+			// the cipher suites of TLS 1.3 except TLS_AES_128_CCM_8_SHA256.
+			s.enableXTLS = s.cipher >= 0x1301 && s.cipher <= 0x1304
+			s.packetsToFilter = 0
+		} else if s.remainingServerHello <= 0 {
+			s.packetsToFilter = 0
+		}
+	}
+}
+
+// XTLSConn is the TLS connection of the XTLS vision flow, which is started by the VLESS protocol.
+// The data is framed with the random padding until the inner TLS 1.3 handshake is done, then the inner
+// application data, which is already encrypted, is relayed by the raw connection directly, which is
+// copied by splice(2) between the TCP connections. The framing ends after a few packets if the inner
+// connection is not TLS 1.3.
+//
+// The frame is [command][content length (2 bytes)][padding length (2 bytes)][content][padding],
+// the first frame of each direction is prefixed with the UUID of the VLESS user, as Xray does.
+type XTLSConn struct {
+	*tls.Conn
+	raw net.Conn
+
+	writeState int32
+	readState  int32
+
+	uuid      [16]byte
+	writeUUID []byte // the UUID prefix of the first frame to write
+	readUUID  bool   // the UUID prefix of the first frame is read
+	pending   []byte // the data read for the frames
+	rbuf      []byte
+
+	traffic xtlsTrafficState
+}
+
+func newXTLSConn(conn *tls.Conn, raw net.Conn) *XTLSConn {
+	return &XTLSConn{Conn: conn, raw: raw}
+}
+
+// xtlsClient does the TLS handshake of the XTLS client.
+func xtlsClient(conn net.Conn, tlsConfig *tls.Config, flow string, timeout time.Duration) (net.Conn, error) {
+	if err := checkXTLSFlow(flow); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	tlsConn := tls.Client(&xtlsRecordConn{Conn: conn}, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	return newXTLSConn(tlsConn, conn), nil
+}
+
+// vision starts the flow of the VLESS user, the data before it is not framed. The VLESS header is
+// written with an empty padded frame, which hides the length of the header.
+func (c *XTLSConn) vision(uuid [16]byte, header []byte) error {
+	if err := c.Handshake(); err != nil {
+		return err
+	}
+	if v := c.ConnectionState().Version; v != tls.VersionTLS13 {
+		return fmt.Errorf("xtls: the flow requires TLS 1.3, got %s", tls.VersionName(v))
+	}
+
+	c.uuid = uuid
+	c.writeUUID = c.uuid[:]
+	c.traffic.mu.Lock()
+	c.traffic.packetsToFilter = xtlsPacketsToFilter
+	c.traffic.mu.Unlock()
+	atomic.StoreInt32(&c.readState, xtlsStatePadding)
+	atomic.StoreInt32(&c.writeState, xtlsStatePadding)
+
+	b := c.appendFrame(append([]byte(nil), header...), xtlsCmdPaddingContinue, nil, true)
+	_, err := c.Conn.Write(b)
+	return err
+}
+
+// Direct reports whether the writes and reads are relayed by the raw connection.
+func (c *XTLSConn) Direct() (write, read bool) {
+	return atomic.LoadInt32(&c.writeState) == xtlsStateDirect, atomic.LoadInt32(&c.readState) == xtlsStateDirect
+}
+
+func (c *XTLSConn) filter(b []byte) {
+	c.traffic.mu.Lock()
+	c.traffic.filter(b)
+	c.traffic.mu.Unlock()
+}
+
+func (c *XTLSConn) Read(b []byte) (n int, err error) {
+	for len(c.rbuf) == 0 {
+		switch atomic.LoadInt32(&c.readState) {
+		case xtlsStatePlain:
+			n, err = c.Conn.Read(b)
+			if n > 0 {
+				c.filter(b[:n])
+			}
+			return
+		case xtlsStateDirect:
+			return c.raw.Read(b)
+		}
+		if err = c.readFrame(); err != nil {
+			return
+		}
+	}
+	n = copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return
+}
+
+// readFrame reads a frame to rbuf. The data is not framed if the first packet is not prefixed with the UUID.
+func (c *XTLSConn) readFrame() error {
+	if !c.readUUID {
+		b := make([]byte, xtlsBufferSize)
+		n, err := c.Conn.Read(b)
+		if n == 0 {
+			return err
+		}
+		if n < 21 || !bytes.Equal(b[:16], c.uuid[:]) {
+			atomic.StoreInt32(&c.readState, xtlsStatePlain)
+			c.rbuf = b[:n]
+			c.filter(c.rbuf)
+			return nil
+		}
+		c.readUUID = true
+		c.pending = b[16:n]
+	}
+
+	var header [5]byte
+	if err := c.readPending(header[:]); err != nil {
+		return err
+	}
+	content := make([]byte, binary.BigEndian.Uint16(header[1:]))
+	if err := c.readPending(content); err != nil {
+		return err
+	}
+	if padding := int(binary.BigEndian.Uint16(header[3:])); padding <= len(c.pending) {
+		c.pending = c.pending[padding:]
+	} else {
+		padding -= len(c.pending)
+		c.pending = nil
+		if _, err := io.CopyN(io.Discard, c.Conn, int64(padding)); err != nil {
+			return err
+		}
+	}
+	if len(content) > 0 {
+		c.filter(content)
+	}
+	c.rbuf = content
+
+	switch header[0] {
+	case xtlsCmdPaddingEnd:
+		atomic.StoreInt32(&c.readState, xtlsStatePlain)
+	case xtlsCmdPaddingDirect:
+		atomic.StoreInt32(&c.readState, xtlsStateDirect)
+		if Debug {
+			log.Logf("[xtls] %s - %s : read direct", c.RemoteAddr(), c.LocalAddr())
+		}
+	default:
+		return nil
+	}
+	// the peer does not send the data after the last frame by the outer TLS.
+	c.rbuf = append(c.rbuf, c.pending...)
+	c.pending = nil
+	return nil
+}
+
+func (c *XTLSConn) readPending(b []byte) error {
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	if n < len(b) {
+		_, err := io.ReadFull(c.Conn, b[n:])
+		return err
+	}
+	return nil
+}
+
+func (c *XTLSConn) Write(b []byte) (n int, err error) {
+	switch atomic.LoadInt32(&c.writeState) {
+	case xtlsStatePlain:
+		n, err = c.Conn.Write(b)
+		if n > 0 {
+			c.filter(b[:n])
+		}
+		return
+	case xtlsStateDirect:
+		return c.raw.Write(b)
+	}
+	if len(b) == 0 {
+		return
+	}
+
+	var packets [][]byte
+	for p := b; len(p) > 0; {
+		m := min(len(p), xtlsBufferSize)
+		packets = append(packets, p[:m])
+		p = p[m:]
+	}
+
+	s := &c.traffic
+	s.mu.Lock()
+	for _, p := range packets {
+		s.filter(p)
+	}
+	complete := xtlsCompleteRecords(b)
+	packets = xtlsReshape(packets)
+	state := int32(xtlsStatePadding)
+	longPadding := s.isTLS
+	var frames []byte
+	for i, p := range packets {
+		last := i == len(packets)-1
+		if s.isTLS && len(p) >= 6 && bytes.HasPrefix(p, xtlsApplicationDataStart) && complete {
+			cmd := byte(xtlsCmdPaddingContinue)
+			if last {
+				cmd = xtlsCmdPaddingEnd
+				if s.enableXTLS {
+					cmd = xtlsCmdPaddingDirect
+				}
+			}
+			state = xtlsStatePlain
+			if s.enableXTLS {
+				state = xtlsStateDirect
+			}
+			frames = c.appendFrame(frames, cmd, p, true)
+			longPadding = false
+			continue
+		} else if !s.isTLS12orAbove && s.packetsToFilter <= 1 {
+			// the padding ends a packet early, the rest is written by the outer TLS.
+			state = xtlsStatePlain
+			frames = c.appendFrame(frames, xtlsCmdPaddingEnd, p, longPadding)
+			for _, p := range packets[i+1:] {
+				frames = append(frames, p...)
+			}
+			break
+		}
+		cmd := byte(xtlsCmdPaddingContinue)
+		if last && state != xtlsStatePadding {
+			cmd = xtlsCmdPaddingEnd
+			if s.enableXTLS {
+				cmd = xtlsCmdPaddingDirect
+			}
+		}
+		frames = c.appendFrame(frames, cmd, p, longPadding)
+	}
+	s.mu.Unlock()
+
+	if _, err = c.Conn.Write(frames); err != nil {
+		return
+	}
+	atomic.StoreInt32(&c.writeState, state)
+	if state == xtlsStateDirect && Debug {
+		log.Logf("[xtls] %s - %s : write direct", c.LocalAddr(), c.RemoteAddr())
+	}
+	return len(b), nil
+}
+
+// appendFrame appends the frame of the content to b, the short content of the handshake is padded to 900-1400 bytes.
+func (c *XTLSConn) appendFrame(b []byte, cmd byte, content []byte, longPadding bool) []byte {
+	var padding int
+	if len(content) < 900 && longPadding {
+		padding = xtlsRandInt(500) + 900 - len(content)
+	} else {
+		padding = xtlsRandInt(256)
+	}
+	padding = min(padding, xtlsBufferSize-21-len(content))
+
+	if c.writeUUID != nil {
+		b = append(b, c.writeUUID...)
+		c.writeUUID = nil
+	}
+	b = append(b, cmd, byte(len(content)>>8), byte(len(content)), byte(padding>>8), byte(padding))
+	b = append(b, content...)
+	return append(b, make([]byte, padding)...)
+}
+
+func xtlsRandInt(n int64) int {
+	v, _ := rand.Int(rand.Reader, big.NewInt(n))
+	return int(v.Int64())
+}
+
+// xtlsCompleteRecords reports whether b is the complete TLS application data records.
+func xtlsCompleteRecords(b []byte) bool {
+	for len(b) > 0 {
+		if len(b) < 5 || !bytes.HasPrefix(b, xtlsApplicationDataStart) {
+			return false
+		}
+		n := 5 + int(binary.BigEndian.Uint16(b[3:]))
+		if len(b) < n {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+// xtlsRecordRest returns the bytes to read to complete the last record of b, if b is the TLS application
+// data records. The direct mode starts with the complete records only, but a read may end in a record.
+func xtlsRecordRest(b []byte) int {
+	for len(b) >= 5 && bytes.HasPrefix(b, xtlsApplicationDataStart) {
+		n := 5 + int(binary.BigEndian.Uint16(b[3:]))
+		if n > xtlsMaxRecordSize {
+			return 0
+		}
+		if len(b) < n {
+			return n - len(b)
+		}
+		b = b[n:]
+	}
+	return 0
+}
+
+// xtlsReshape splits the packets which do not fit in a frame, at the last application data record if possible.
+func xtlsReshape(packets [][]byte) [][]byte {
+	var reshaped [][]byte
+	for _, p := range packets {
+		if len(p) < xtlsBufferSize-21 {
+			reshaped = append(reshaped, p)
+			continue
+		}
+		i := bytes.LastIndex(p, xtlsApplicationDataStart)
+		if i < 21 || i > xtlsBufferSize-21 {
+			i = xtlsBufferSize / 2
+		}
+		reshaped = append(reshaped, p[:i], p[i:])
+	}
+	return reshaped
+}
+
+// readFromFirst makes the relay use ReadFrom, as the TCP connections implement io.WriterTo,
+// which hides the source from XTLSConn, so splice(2) is not used in the direct mode.
+func (c *XTLSConn) readFromFirst() {}
+
+// ReadFrom copies the data from r to the connection, the data is copied to the raw connection by
+// splice(2) in the direct mode if both are TCP connections.
+func (c *XTLSConn) ReadFrom(r io.Reader) (n int64, err error) {
+	// the room for the rest of the last TLS record, see xtlsRecordRest.
+	buf := make([]byte, largeBufferSize+xtlsMaxRecordSize)
+
+	for atomic.LoadInt32(&c.writeState) != xtlsStateDirect {
+		nr, er := r.Read(buf[:largeBufferSize])
+		if rest := xtlsRecordRest(buf[:nr]); er == nil && rest > 0 && atomic.LoadInt32(&c.writeState) == xtlsStatePadding {
+			var m int
+			m, er = io.ReadFull(r, buf[nr:nr+rest])
+			nr += m
+			if er == io.ErrUnexpectedEOF {
+				er = io.EOF
+			}
+		}
+		if nr > 0 {
+			nw, ew := c.Write(buf[:nr])
+			n += int64(nw)
+			if ew != nil {
+				return n, ew
+			}
+		}
+		if er != nil {
+			if er == io.EOF {
+				er = nil
+			}
+			return n, er
+		}
+	}
+
+	var nn int64
+	if rf, ok := c.raw.(io.ReaderFrom); ok {
+		nn, err = rf.ReadFrom(r)
+	} else {
+		nn, err = io.CopyBuffer(c.raw, r, buf)
+	}
+	return n + nn, err
+}
+
+// WriteTo copies the data of the connection to w, the data is copied from the raw connection by
+// splice(2) in the direct mode if both are TCP connections.
+func (c *XTLSConn) WriteTo(w io.Writer) (n int64, err error) {
+	buf := lPool.Get().([]byte)
+	defer lPool.Put(buf)
+
+	for atomic.LoadInt32(&c.readState) != xtlsStateDirect || len(c.rbuf) > 0 {
+		nr, er := c.Read(buf)
+		if nr > 0 {
+			nw, ew := w.Write(buf[:nr])
+			n += int64(nw)
+			if ew != nil {
+				return n, ew
+			}
+		}
+		if er != nil {
+			if er == io.EOF {
+				er = nil
+			}
+			return n, er
+		}
+	}
+
+	var nn int64
+	if rf, ok := w.(io.ReaderFrom); ok {
+		nn, err = rf.ReadFrom(c.raw)
+	} else {
+		nn, err = io.CopyBuffer(w, c.raw, buf)
+	}
+	return n + nn, err
+}
+
+// Close closes the raw connection without the TLS close notify in the direct mode,
+// as the peer does not read the TLS records.
+func (c *XTLSConn) Close() error {
+	if atomic.LoadInt32(&c.writeState) == xtlsStateDirect {
+		return c.raw.Close()
+	}
+	return c.Conn.Close()
+}
+
+type xtlsListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+func (l *xtlsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newXTLSConn(tls.Server(&xtlsRecordConn{Conn: conn}, l.config), conn), nil
+}
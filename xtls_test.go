@@ -0,0 +1,228 @@
+package gost
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const xtlsTestUUID = "27848739-7e62-4138-9fd3-098a63964b6b"
+
+// xtlsTestRelay returns the connection to the target by the VLESS over TLS proxy server,
+// which uses the XTLS flow if flow is not empty.
+func xtlsTestRelay(tb testing.TB, target, flow string) (conn net.Conn, closeFunc func()) {
+	var opts []TLSListenerOption
+	if flow != "" {
+		opts = append(opts, WithXTLSServerFlow(flow))
+	}
+	ln, err := TLSListener("127.0.0.1:0", nil, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	h := VLESSHandler(flow, AuthenticatorHandlerOption(NewLocalAuthenticator(map[string]string{xtlsTestUUID: ""})))
+	server := &Server{
+		Listener: ln,
+		Handler:  h,
+	}
+	go server.Run()
+
+	tr := TLSTransporter()
+	conn, err = tr.Dial(ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	conn, err = tr.Handshake(conn, WithXTLSFlow(flow))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	conn, err = VLESSConnector(url.User(xtlsTestUUID), flow).ConnectContext(context.Background(), conn, "tcp", target, NoDelayConnectOption(true))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Close()
+	}
+}
+
+// xtlsTestEchoServer is the TLS echo server of the inner connections.
+func xtlsTestEchoServer(tb testing.TB) net.Listener {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", DefaultTLSConfig)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestXTLSVision(t *testing.T) {
+	echo := xtlsTestEchoServer(t)
+	defer echo.Close()
+
+	conn, closeFunc := xtlsTestRelay(t, echo.Addr().String(), XTLSFlowVision)
+	defer closeFunc()
+
+	inner := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	for i := 0; i < 4; i++ {
+		data := make([]byte, 1024*(i+1))
+		rand.Read(data)
+		if _, err := inner.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, len(data))
+		if _, err := io.ReadFull(inner, b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatal("data not equal")
+		}
+	}
+	if write, read := conn.(*vlessVisionConn).Direct(); !write || !read {
+		t.Errorf("got direct write %v read %v, want both", write, read)
+	}
+}
+
+func TestXTLSVisionPlain(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	u, _ := url.Parse(httpSrv.URL)
+	conn, closeFunc := xtlsTestRelay(t, u.Host, XTLSFlowVision)
+	defer closeFunc()
+
+	// the connection is not framed after the padded packets.
+	for i := 0; i < xtlsPacketsToFilter+2; i++ {
+		data := make([]byte, 128)
+		rand.Read(data)
+		if err := httpRoundtrip(conn, httpSrv.URL, data); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if write, read := conn.(*vlessVisionConn).Direct(); write || read {
+		t.Error("the plain connection should not be direct")
+	}
+
+	if _, err := TLSListener("127.0.0.1:0", nil, WithXTLSServerFlow("xtls-rprx-direct")); err == nil {
+		t.Error("the unsupported flow should be rejected")
+	}
+	for _, s := range []string{"http+tls://:443?flow=xtls-rprx-vision", "vless+ws://:443?flow=xtls-rprx-vision"} {
+		node, _ := ParseNode(s)
+		if err := checkNodeFlow(node); err == nil {
+			t.Errorf("%s: the flow should be rejected", s)
+		}
+	}
+}
+
+// TestXTLSVisionFrame checks the request of the client by the wire format of Xray: the VLESS header with
+// the flow in the addons, followed by the empty padded frame prefixed with the UUID.
+func TestXTLSVisionFrame(t *testing.T) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", DefaultTLSConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		accepted <- conn
+	}()
+
+	tr := TLSTransporter()
+	conn, err := tr.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn, err = tr.Handshake(conn, WithXTLSFlow(XTLSFlowVision)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VLESSConnector(url.User(xtlsTestUUID), XTLSFlowVision).Connect(conn, "example.com:443"); err != nil {
+		t.Fatal(err)
+	}
+
+	uuid, _ := parseVLESSUUID(xtlsTestUUID)
+	header := append([]byte{0}, uuid[:]...)
+	header = append(header, 18, 0x0a, 16)
+	header = append(header, XTLSFlowVision...)
+	header = append(header, 1, 0x01, 0xbb, 2, 11)
+	header = append(header, "example.com"...)
+
+	sc := <-accepted
+	defer sc.Close()
+	b := make([]byte, len(header)+21)
+	if _, err := io.ReadFull(sc, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:len(header)], header) {
+		t.Fatalf("bad header %x", b[:len(header)])
+	}
+	b = b[len(header):]
+	if !bytes.Equal(b[:16], uuid[:]) {
+		t.Fatalf("bad UUID prefix %x", b[:16])
+	}
+	if cmd, n := b[16], binary.BigEndian.Uint16(b[17:]); cmd != xtlsCmdPaddingContinue || n != 0 {
+		t.Errorf("got command %d content %d, want 0 and 0", cmd, n)
+	}
+	padding := int(binary.BigEndian.Uint16(b[19:]))
+	if padding < 900 || padding >= 1400 {
+		t.Errorf("bad padding %d", padding)
+	}
+	if _, err := io.ReadFull(sc, make([]byte, padding)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func benchmarkXTLSRelay(b *testing.B, flow string) {
+	echo := xtlsTestEchoServer(b)
+	defer echo.Close()
+
+	conn, closeFunc := xtlsTestRelay(b, echo.Addr().String(), flow)
+	defer closeFunc()
+
+	inner := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	data := make([]byte, 32*1024)
+	rand.Read(data)
+	buf := make([]byte, len(data))
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inner.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(inner, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkXTLSRelay(b *testing.B) {
+	benchmarkXTLSRelay(b, XTLSFlowVision)
+}
+
+func BenchmarkTLSRelay(b *testing.B) {
+	benchmarkXTLSRelay(b, "")
+}
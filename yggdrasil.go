@@ -0,0 +1,512 @@
+package gost
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/xtaci/kcp-go/v5"
+	"github.com/yggdrasil-network/yggdrasil-go/src/config"
+	"github.com/yggdrasil-network/yggdrasil-go/src/core"
+	"github.com/yggdrasil-network/yggdrasil-go/src/ipv6rwc"
+)
+
+func init() {
+	DefaultRegistry.RegisterTransport("yggdrasil", Transport{
+		NewTransporter: func(node Node, opts *NodeOptions) (Transporter, error) {
+			core, err := yggdrasilCore(node)
+			if err != nil {
+				return nil, err
+			}
+			return YggdrasilTransporter(core), nil
+		},
+		NewListener: func(node Node, opts *NodeOptions) (Listener, error) {
+			_, sport, err := net.SplitHostPort(node.Addr)
+			if err != nil {
+				return nil, err
+			}
+			port, err := strconv.ParseUint(sport, 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			core, err := yggdrasilCore(node)
+			if err != nil {
+				return nil, err
+			}
+			return YggdrasilListener(core, uint16(port))
+		},
+	}, "ygg")
+}
+
+var (
+	yggdrasilCores   = make(map[string]*core.Core)
+	yggdrasilCoresMu sync.Mutex
+)
+
+// yggdrasilCore returns the Yggdrasil node of the config file of the node parameter conf, or of a new key
+// peered with the comma-separated URIs of the parameter peers. The Yggdrasil node is shared by the nodes
+// of the same parameters, so the listener and the transporter use the same Yggdrasil address.
+func yggdrasilCore(node Node) (*core.Core, error) {
+	file, peers := node.Get("conf"), node.Get("peers")
+	key := file + "|" + peers
+
+	yggdrasilCoresMu.Lock()
+	defer yggdrasilCoresMu.Unlock()
+	if c := yggdrasilCores[key]; c != nil {
+		return c, nil
+	}
+
+	cfg := config.GenerateConfig()
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := cfg.ReadFrom(f); err != nil {
+			return nil, err
+		}
+	} else if peers != "" {
+		cfg.Peers = strings.Split(peers, ",")
+	}
+	c, err := NewYggdrasilCore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	yggdrasilCores[key] = c
+	return c, nil
+}
+
+const (
+	yggdrasilIPv6HeaderLen = 40
+	yggdrasilUDPHeaderLen  = 8
+)
+
+// yggdrasilNet is the address range of the Yggdrasil network, 200::/8 for the node addresses
+// and 300::/8 for the routed subnets.
+var yggdrasilNet = &net.IPNet{IP: net.ParseIP("200::"), Mask: net.CIDRMask(7, 128)}
+
+// NewYggdrasilCore creates and starts the Yggdrasil node of cfg, which peers with the nodes of cfg.Peers
+// and listens for the peers on cfg.Listen. A config of a new private key is generated if cfg is nil.
+// The TUN interface, the admin socket and the multicast discovery of the config are not used,
+// the node only carries the connections of YggdrasilTransporter and YggdrasilListener.
+func NewYggdrasilCore(cfg *config.NodeConfig) (*core.Core, error) {
+	if cfg == nil {
+		cfg = config.GenerateConfig()
+	}
+	if cfg.PrivateKey == nil {
+		cfg.NewPrivateKey()
+	}
+	if cfg.Certificate == nil {
+		if err := cfg.GenerateSelfSignedCertificate(); err != nil {
+			return nil, err
+		}
+	}
+
+	options := []core.SetupOption{
+		core.NodeInfo(cfg.NodeInfo),
+		core.NodeInfoPrivacy(cfg.NodeInfoPrivacy),
+	}
+	for _, addr := range cfg.Listen {
+		options = append(options, core.ListenAddress(addr))
+	}
+	for _, peer := range cfg.Peers {
+		options = append(options, core.Peer{URI: peer})
+	}
+	for intf, peers := range cfg.InterfacePeers {
+		for _, peer := range peers {
+			options = append(options, core.Peer{URI: peer, SourceInterface: intf})
+		}
+	}
+	for _, allowed := range cfg.AllowedPublicKeys {
+		k, err := hex.DecodeString(allowed)
+		if err != nil {
+			return nil, fmt.Errorf("yggdrasil: invalid public key %s: %v", allowed, err)
+		}
+		options = append(options, core.AllowedPublicKey(k))
+	}
+	return core.New(cfg.Certificate, nil, options...)
+}
+
+var (
+	yggdrasilStacks   = make(map[*core.Core]*yggdrasilStack)
+	yggdrasilStackMux sync.Mutex
+)
+
+// yggdrasilStack is the UDP over the IPv6 packets of the Yggdrasil node, the packets are dispatched
+// to the packet connections by the destination port. The IPv6 packets are read and written by
+// the ipv6rwc of the node, which looks up the keys of the Yggdrasil addresses.
+type yggdrasilStack struct {
+	rwc   *ipv6rwc.ReadWriteCloser
+	addr  net.IP
+	mux   sync.Mutex
+	ports map[uint16]*yggdrasilPacketConn
+	err   error
+}
+
+// getYggdrasilStack returns the stack of the node, the ipv6rwc can only be attached to the node once.
+func getYggdrasilStack(c *core.Core) *yggdrasilStack {
+	yggdrasilStackMux.Lock()
+	defer yggdrasilStackMux.Unlock()
+
+	if s := yggdrasilStacks[c]; s != nil {
+		return s
+	}
+	s := &yggdrasilStack{
+		rwc:   ipv6rwc.NewReadWriteCloser(c),
+		addr:  c.Address(),
+		ports: make(map[uint16]*yggdrasilPacketConn),
+	}
+	yggdrasilStacks[c] = s
+	go s.readLoop(c)
+	return s
+}
+
+func (s *yggdrasilStack) readLoop(c *core.Core) {
+	buf := make([]byte, s.rwc.MTU())
+	for {
+		n, err := s.rwc.Read(buf)
+		if err != nil {
+			// the node is stopped.
+			yggdrasilStackMux.Lock()
+			delete(yggdrasilStacks, c)
+			yggdrasilStackMux.Unlock()
+
+			s.mux.Lock()
+			s.err = err
+			for _, pc := range s.ports {
+				pc.shutdown(err)
+			}
+			s.mux.Unlock()
+			return
+		}
+
+		b := buf[:n]
+		if n < yggdrasilIPv6HeaderLen+yggdrasilUDPHeaderLen || b[6] != 17 { // UDP
+			continue
+		}
+		udp := b[yggdrasilIPv6HeaderLen:]
+		if l := int(binary.BigEndian.Uint16(b[4:6])); l < len(udp) {
+			udp = udp[:l]
+		}
+		if l := int(binary.BigEndian.Uint16(udp[4:6])); l < yggdrasilUDPHeaderLen || l > len(udp) {
+			continue
+		} else {
+			udp = udp[:l]
+		}
+		src := &net.UDPAddr{
+			IP:   append(net.IP(nil), b[8:24]...),
+			Port: int(binary.BigEndian.Uint16(udp[0:2])),
+		}
+
+		s.mux.Lock()
+		pc := s.ports[binary.BigEndian.Uint16(udp[2:4])]
+		s.mux.Unlock()
+		if pc == nil {
+			continue
+		}
+		p := yggdrasilPacket{src: src, data: append([]byte(nil), udp[yggdrasilUDPHeaderLen:]...)}
+		select {
+		case pc.packets <- p:
+		default: // the receiver is overrun, the packet is dropped as UDP.
+		}
+	}
+}
+
+// listen binds the packet connection to port, a random port is chosen if port is 0.
+func (s *yggdrasilStack) listen(port uint16) (*yggdrasilPacketConn, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	if port == 0 {
+		for i := 0; i < 100; i++ {
+			p := uint16(49152 + rand.Intn(16384))
+			if s.ports[p] == nil {
+				port = p
+				break
+			}
+		}
+	}
+	if port == 0 || s.ports[port] != nil {
+		return nil, fmt.Errorf("yggdrasil: port %d is in use", port)
+	}
+
+	pc := &yggdrasilPacketConn{
+		stack:   s,
+		laddr:   &net.UDPAddr{IP: s.addr, Port: int(port)},
+		packets: make(chan yggdrasilPacket, 1024),
+		closed:  make(chan struct{}),
+	}
+	s.ports[port] = pc
+	return pc, nil
+}
+
+func (s *yggdrasilStack) writeTo(b []byte, src, dst *net.UDPAddr) (int, error) {
+	pkt := make([]byte, yggdrasilIPv6HeaderLen+yggdrasilUDPHeaderLen+len(b))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(yggdrasilUDPHeaderLen+len(b)))
+	pkt[6] = 17 // UDP
+	pkt[7] = 64 // hop limit
+	copy(pkt[8:24], src.IP.To16())
+	copy(pkt[24:40], dst.IP.To16())
+
+	udp := pkt[yggdrasilIPv6HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:2], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:6], uint16(len(udp)))
+	copy(udp[yggdrasilUDPHeaderLen:], b)
+	binary.BigEndian.PutUint16(udp[6:8], yggdrasilUDPChecksum(pkt[8:24], pkt[24:40], udp))
+
+	if _, err := s.rwc.Write(pkt); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// yggdrasilUDPChecksum returns the checksum of the UDP datagram with the IPv6 pseudo header.
+func yggdrasilUDPChecksum(src, dst, udp []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src)
+	add(dst)
+	sum += uint32(len(udp)) + 17
+	add(udp)
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	if cs := ^uint16(sum); cs != 0 {
+		return cs
+	}
+	return 0xffff
+}
+
+type yggdrasilPacket struct {
+	src  *net.UDPAddr
+	data []byte
+}
+
+// yggdrasilPacketConn is the UDP socket of the Yggdrasil address of the node.
+type yggdrasilPacketConn struct {
+	stack   *yggdrasilStack
+	laddr   *net.UDPAddr
+	packets chan yggdrasilPacket
+	closed  chan struct{}
+	once    sync.Once
+	err     error
+
+	dmux         sync.Mutex
+	readDeadline time.Time
+	deadlineSet  chan struct{} // closed when the read deadline is changed
+}
+
+// ReadFrom reads a packet, the blocked read follows the change of the read deadline as the UDP socket,
+// which is relied on by the read loop of KCP.
+func (c *yggdrasilPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		c.dmux.Lock()
+		deadline := c.readDeadline
+		if c.deadlineSet == nil {
+			c.deadlineSet = make(chan struct{})
+		}
+		deadlineSet := c.deadlineSet
+		c.dmux.Unlock()
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		select {
+		case p := <-c.packets:
+			n, addr = copy(b, p.data), p.src
+		case <-c.closed:
+			err = c.err
+		case <-timeout:
+			err = &net.OpError{Op: "read", Net: "yggdrasil", Err: os.ErrDeadlineExceeded}
+		case <-deadlineSet:
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		return
+	}
+}
+
+func (c *yggdrasilPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, c.err
+	default:
+	}
+	dst, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, fmt.Errorf("yggdrasil: invalid address %v", addr)
+	}
+	return c.stack.writeTo(b, c.laddr, dst)
+}
+
+func (c *yggdrasilPacketConn) shutdown(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.closed)
+	})
+}
+
+func (c *yggdrasilPacketConn) Close() error {
+	c.stack.mux.Lock()
+	if c.stack.ports[uint16(c.laddr.Port)] == c {
+		delete(c.stack.ports, uint16(c.laddr.Port))
+	}
+	c.stack.mux.Unlock()
+	c.shutdown(net.ErrClosed)
+	return nil
+}
+
+// LocalAddr returns the Yggdrasil address of the node with the port.
+func (c *yggdrasilPacketConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *yggdrasilPacketConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *yggdrasilPacketConn) SetReadDeadline(t time.Time) error {
+	c.dmux.Lock()
+	defer c.dmux.Unlock()
+	c.readDeadline = t
+	if c.deadlineSet != nil {
+		close(c.deadlineSet)
+		c.deadlineSet = nil
+	}
+	return nil
+}
+
+// SetWriteDeadline does nothing, the writes are not blocked.
+func (c *yggdrasilPacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// yggdrasilKCPConfig returns the KCP config of the Yggdrasil connections,
+// the packets are not encrypted by KCP as they are encrypted end-to-end by Yggdrasil.
+func yggdrasilKCPConfig() *KCPConfig {
+	config := DefaultKCPConfig
+	config.Crypt = "none"
+	config.Init()
+	return &config
+}
+
+type yggdrasilTransporter struct {
+	*kcpTransporter
+	core *core.Core
+}
+
+// YggdrasilTransporter creates a Transporter that connects to the Yggdrasil addresses (200::/7) by the
+// Yggdrasil node of core. The streams are multiplexed over KCP over the UDP of the Yggdrasil network,
+// and the server is YggdrasilListener or the KCP server on the Yggdrasil address of the host.
+func YggdrasilTransporter(core *core.Core) Transporter {
+	return &yggdrasilTransporter{
+		kcpTransporter: &kcpTransporter{
+			config:   yggdrasilKCPConfig(),
+			sessions: make(map[string]*muxSession),
+		},
+		core: core,
+	}
+}
+
+func (tr *yggdrasilTransporter) Dial(addr string, options ...DialOption) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !yggdrasilNet.Contains(ip) {
+		return nil, fmt.Errorf("yggdrasil: %s is not a Yggdrasil address", host)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, err
+	}
+
+	tr.sessionMutex.Lock()
+	defer tr.sessionMutex.Unlock()
+
+	session, ok := tr.sessions[addr]
+	if session != nil && session.session != nil && session.session.IsClosed() {
+		session.Close()
+		delete(tr.sessions, addr) // session is dead
+		ok = false
+	}
+	if !ok {
+		pc, err := getYggdrasilStack(tr.core).listen(0)
+		if err != nil {
+			return nil, err
+		}
+		session = &muxSession{conn: &fakeTCPConn{raddr: raddr, PacketConn: pc}}
+		tr.sessions[addr] = session
+	}
+	return session.conn, nil
+}
+
+type yggdrasilListener struct {
+	*kcpListener
+	pc *yggdrasilPacketConn
+}
+
+// YggdrasilListener creates a Listener on the listenPort of the Yggdrasil address of the node of core,
+// so the server is only reachable from the Yggdrasil network.
+func YggdrasilListener(core *core.Core, listenPort uint16) (Listener, error) {
+	if listenPort == 0 {
+		return nil, errors.New("yggdrasil: invalid listen port 0")
+	}
+	pc, err := getYggdrasilStack(core).listen(listenPort)
+	if err != nil {
+		return nil, err
+	}
+	config := yggdrasilKCPConfig()
+	ln, err := kcp.ServeConn(blockCrypt(config.Key, config.Crypt, KCPSalt), config.DataShard, config.ParityShard, pc)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	log.Logf("[yggdrasil] listening on %s", pc.LocalAddr())
+
+	l := &kcpListener{
+		config:   config,
+		ln:       ln,
+		connChan: make(chan net.Conn, 1024),
+		errChan:  make(chan error, 1),
+	}
+	go l.listenLoop()
+	return &yggdrasilListener{kcpListener: l, pc: pc}, nil
+}
+
+func (l *yggdrasilListener) Close() error {
+	err := l.kcpListener.Close()
+	l.pc.Close()
+	return err
+}
@@ -0,0 +1,118 @@
+package gost
+
+import (
+	"crypto/rand"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yggdrasil-network/yggdrasil-go/src/config"
+	"github.com/yggdrasil-network/yggdrasil-go/src/core"
+)
+
+func TestYggdrasilUDPChecksum(t *testing.T) {
+	src := net.ParseIP("200::1").To16()
+	dst := net.ParseIP("200::2").To16()
+	udp := []byte{0x30, 0x39, 0x1f, 0x90, 0x00, 0x0d, 0x00, 0x00, 'h', 'e', 'l', 'l', 'o'}
+	cs := yggdrasilUDPChecksum(src, dst, udp)
+	udp[6], udp[7] = byte(cs>>8), byte(cs)
+	// the checksum of the datagram with the checksum is 0.
+	if yggdrasilUDPChecksum(src, dst, udp) != 0xffff {
+		t.Errorf("invalid checksum %#04x", cs)
+	}
+}
+
+func TestYggdrasilTransporter(t *testing.T) {
+	c, err := NewYggdrasilCore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	tr := YggdrasilTransporter(c)
+	for _, addr := range []string{"127.0.0.1:8080", "[fd00::1]:8080", "example.com:8080", "[400::1]:8080"} {
+		if _, err := tr.Dial(addr); err == nil {
+			t.Errorf("%s should not be dialed", addr)
+		}
+	}
+}
+
+// yggdrasilWaitPath waits for the path from the node src to the node dst, which is found by the key lookup
+// on the first packets.
+func yggdrasilWaitPath(t *testing.T, src, dst *core.Core) {
+	pdst, err := getYggdrasilStack(dst).listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdst.Close()
+	psrc, err := getYggdrasilStack(src).listen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psrc.Close()
+
+	for i := 0; i < 50; i++ {
+		if _, err := psrc.WriteTo([]byte("ping"), pdst.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		pdst.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, _, err := pdst.ReadFrom(make([]byte, 16)); err == nil {
+			return
+		}
+	}
+	t.Fatal("no path to", dst.Address())
+}
+
+func TestHTTPOverYggdrasil(t *testing.T) {
+	httpSrv := httptest.NewServer(httpTestHandler)
+	defer httpSrv.Close()
+
+	// the node of the server, and the node of the client peered with it.
+	a, err := NewYggdrasilCore(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+	peering, err := a.Listen(&url.URL{Scheme: "tcp", Host: "127.0.0.1:0"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.GenerateConfig()
+	cfg.Peers = []string{"tcp://" + peering.Addr().String()}
+	b, err := NewYggdrasilCore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+	yggdrasilWaitPath(t, b, a)
+
+	ln, err := YggdrasilListener(a, 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := ln.Addr().(*net.UDPAddr); !addr.IP.Equal(a.Address()) || addr.Port != 8080 {
+		t.Errorf("got address %s, want [%s]:8080", addr, a.Address())
+	}
+	if _, err := YggdrasilListener(a, 8080); err == nil {
+		t.Error("the port in use should not be listened")
+	}
+
+	server := &Server{
+		Listener: ln,
+		Handler:  HTTPHandler(),
+	}
+	go server.Run()
+	defer server.Close()
+
+	client := &Client{
+		Connector:   HTTPConnector(nil),
+		Transporter: YggdrasilTransporter(b),
+	}
+	sendData := make([]byte, 128)
+	rand.Read(sendData)
+	if err := proxyRoundtrip(client, server, httpSrv.URL, sendData); err != nil {
+		t.Error(err)
+	}
+}
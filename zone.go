@@ -0,0 +1,333 @@
+package gost
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-log/log"
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultZoneTTL = 60 * time.Second
+	// maxCNAMEDepth is the max length of the CNAME chain followed in the local zones.
+	maxCNAMEDepth = 8
+)
+
+// DNSRecord is a resource record served by the internal DNS server.
+type DNSRecord struct {
+	// Name is the owner name, it is either relative to the zone or a FQDN ending with '.',
+	// empty or '@' for the zone apex.
+	Name string
+	// Type is one of A, AAAA, CNAME, MX and TXT.
+	Type string
+	// Value is the IP address for A and AAAA, the domain name for CNAME and MX, the text for TXT.
+	Value string
+	// Preference is the MX preference.
+	Preference uint16
+	// TTL is the TTL of the record, defaults to 60s.
+	TTL time.Duration
+}
+
+func (r *DNSRecord) rr(zone string) (dns.RR, error) {
+	name := r.Name
+	switch {
+	case name == "" || name == "@":
+		name = zone
+	case !dns.IsFqdn(name):
+		name = name + "." + zone
+	}
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = defaultZoneTTL
+	}
+
+	hdr := dns.RR_Header{
+		Name:  dns.CanonicalName(name),
+		Class: dns.ClassINET,
+		Ttl:   uint32(ttl.Seconds()),
+	}
+
+	switch strings.ToUpper(r.Type) {
+	case "A":
+		ip := net.ParseIP(r.Value).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid A record %s: %s", name, r.Value)
+		}
+		hdr.Rrtype = dns.TypeA
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	case "AAAA":
+		ip := net.ParseIP(r.Value)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid AAAA record %s: %s", name, r.Value)
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case "CNAME":
+		hdr.Rrtype = dns.TypeCNAME
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(r.Value)}, nil
+	case "MX":
+		hdr.Rrtype = dns.TypeMX
+		return &dns.MX{Hdr: hdr, Preference: r.Preference, Mx: dns.Fqdn(r.Value)}, nil
+	case "TXT":
+		hdr.Rrtype = dns.TypeTXT
+		return &dns.TXT{Hdr: hdr, Txt: []string{r.Value}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported record type %s of %s", r.Type, name)
+	}
+}
+
+type internalDNSOptions struct {
+	upstream Exchanger
+}
+
+// InternalDNSOption allows a common way to set the internal DNS server options.
+type InternalDNSOption func(opts *internalDNSOptions)
+
+// UpstreamInternalDNSOption sets the upstream for the queries out of the local zones,
+// the default resolver is used if not specified.
+func UpstreamInternalDNSOption(ex Exchanger) InternalDNSOption {
+	return func(opts *internalDNSOptions) {
+		opts.upstream = ex
+	}
+}
+
+// InternalDNS is a DNS server that serves the local zones authoritatively on both UDP and TCP.
+type InternalDNS struct {
+	addr    net.Addr
+	servers []*dns.Server
+}
+
+// InternalDNSServer starts a DNS server on the UDP and TCP address addr that serves the records of the zones authoritatively,
+// the queries for the names out of the zones are forwarded to the upstream.
+// The server runs in the background until it is closed.
+func InternalDNSServer(addr string, zones map[string][]DNSRecord, opts ...InternalDNSOption) (*InternalDNS, error) {
+	h, err := newInternalDNSHandler(zones, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, ln, err := listenDNS(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &InternalDNS{
+		addr: pc.LocalAddr(),
+		servers: []*dns.Server{
+			{PacketConn: pc, Handler: h},
+			{Listener: ln, Handler: h},
+		},
+	}
+	for _, srv := range s.servers {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go func(srv *dns.Server) {
+			if err := srv.ActivateAndServe(); err != nil {
+				log.Logf("[dns] %s: %v", s.addr, err)
+			}
+		}(srv)
+		<-started
+	}
+	return s, nil
+}
+
+// listenDNS listens on the UDP and TCP address. If the port of addr is 0, the TCP server listens on
+// the same port as the UDP server, another port is tried if the TCP port is taken.
+func listenDNS(addr string) (pc net.PacketConn, ln net.Listener, err error) {
+	host, port, _ := net.SplitHostPort(addr)
+	for i := 0; i < 10; i++ {
+		pc, err = net.ListenPacket("udp", addr)
+		if err != nil {
+			return
+		}
+		_, udpPort, _ := net.SplitHostPort(pc.LocalAddr().String())
+		ln, err = net.Listen("tcp", net.JoinHostPort(host, udpPort))
+		if err == nil {
+			return
+		}
+		pc.Close()
+		if port != "0" {
+			return
+		}
+	}
+	return
+}
+
+// Addr returns the UDP address of the server, the TCP server listens on the same port.
+func (s *InternalDNS) Addr() net.Addr {
+	return s.addr
+}
+
+// Close stops the server.
+func (s *InternalDNS) Close() (err error) {
+	for _, srv := range s.servers {
+		if e := srv.Shutdown(); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+type internalDNSHandler struct {
+	// zone name -> owner name -> records.
+	zones map[string]map[string][]dns.RR
+	// zone name -> SOA record, it is put in the authority section of the negative answers.
+	soas    map[string]*dns.SOA
+	options internalDNSOptions
+}
+
+func newInternalDNSHandler(zones map[string][]DNSRecord, opts ...InternalDNSOption) (*internalDNSHandler, error) {
+	h := &internalDNSHandler{
+		zones: make(map[string]map[string][]dns.RR),
+		soas:  make(map[string]*dns.SOA),
+	}
+	for _, opt := range opts {
+		opt(&h.options)
+	}
+	if h.options.upstream == nil {
+		h.options.upstream = defaultResolver
+	}
+
+	for zone, records := range zones {
+		zone = dns.CanonicalName(zone)
+		names := make(map[string][]dns.RR)
+		for i := range records {
+			rr, err := records[i].rr(zone)
+			if err != nil {
+				return nil, err
+			}
+			if !dns.IsSubDomain(zone, rr.Header().Name) {
+				return nil, fmt.Errorf("record %s is out of zone %s", rr.Header().Name, zone)
+			}
+			names[rr.Header().Name] = append(names[rr.Header().Name], rr)
+		}
+		soa := zoneSOA(zone)
+		names[zone] = append(names[zone], soa)
+		h.zones[zone] = names
+		h.soas[zone] = soa
+	}
+	return h, nil
+}
+
+// zoneSOA returns the SOA record of the zone, the minimum TTL is used for the negative caching (RFC 2308).
+func zoneSOA(zone string) *dns.SOA {
+	ttl := uint32(defaultZoneTTL.Seconds())
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
+
+// findZone returns the longest zone that contains the name.
+func (h *internalDNSHandler) findZone(name string) (zone string, ok bool) {
+	for z := range h.zones {
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone, ok = z, true
+		}
+	}
+	return
+}
+
+func (h *internalDNSHandler) ServeDNS(w dns.ResponseWriter, mq *dns.Msg) {
+	if len(mq.Question) == 0 {
+		dns.HandleFailed(w, mq)
+		return
+	}
+
+	q := mq.Question[0]
+	name := dns.CanonicalName(q.Name)
+	zone, ok := h.findZone(name)
+	if !ok || q.Qclass != dns.ClassINET {
+		h.forward(w, mq)
+		return
+	}
+
+	mr := &dns.Msg{}
+	mr.SetReply(mq)
+	mr.Authoritative = true
+	h.answer(mr, name, q.Qtype, 0)
+	// NXDOMAIN or NODATA.
+	if mr.Rcode == dns.RcodeNameError || len(mr.Answer) == 0 {
+		mr.Ns = append(mr.Ns, dns.Copy(h.soas[zone]))
+	}
+
+	if Debug {
+		log.Logf("[dns] %s: local zone %s", w.RemoteAddr(), mr.String())
+	}
+	h.writeMsg(w, mq, mr)
+}
+
+// writeMsg writes the reply, it is truncated to the size advertised by the client over UDP.
+func (h *internalDNSHandler) writeMsg(w dns.ResponseWriter, mq, mr *dns.Msg) {
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := mq.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+		mr.Truncate(size)
+	}
+	w.WriteMsg(mr)
+}
+
+func (h *internalDNSHandler) answer(mr *dns.Msg, name string, qtype uint16, depth int) {
+	zone, ok := h.findZone(name)
+	if !ok {
+		return
+	}
+
+	rrs, ok := h.zones[zone][name]
+	if !ok {
+		if depth == 0 {
+			mr.Rcode = dns.RcodeNameError
+		}
+		return
+	}
+
+	for _, rr := range rrs {
+		switch {
+		case rr.Header().Rrtype == qtype || qtype == dns.TypeANY:
+			mr.Answer = append(mr.Answer, dns.Copy(rr))
+		case rr.Header().Rrtype == dns.TypeCNAME:
+			mr.Answer = append(mr.Answer, dns.Copy(rr))
+			if depth < maxCNAMEDepth {
+				h.answer(mr, dns.CanonicalName(rr.(*dns.CNAME).Target), qtype, depth+1)
+			}
+		}
+	}
+}
+
+func (h *internalDNSHandler) forward(w dns.ResponseWriter, mq *dns.Msg) {
+	query, err := mq.Pack()
+	if err != nil {
+		dns.HandleFailed(w, mq)
+		return
+	}
+	reply, err := h.options.upstream.Exchange(context.Background(), query)
+	if err != nil {
+		log.Logf("[dns] %s: forward %s: %v", w.RemoteAddr(), mq.Question[0].String(), err)
+		dns.HandleFailed(w, mq)
+		return
+	}
+	mr := &dns.Msg{}
+	if err := mr.Unpack(reply); err != nil {
+		log.Logf("[dns] %s: forward %s: %v", w.RemoteAddr(), mq.Question[0].String(), err)
+		dns.HandleFailed(w, mq)
+		return
+	}
+	h.writeMsg(w, mq, mr)
+}
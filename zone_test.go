@@ -0,0 +1,166 @@
+package gost
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type exchangerFunc func(ctx context.Context, query []byte) ([]byte, error)
+
+func (f exchangerFunc) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	return f(ctx, query)
+}
+
+func TestInternalDNSServer(t *testing.T) {
+	zones := map[string][]DNSRecord{
+		"corp.internal": {
+			{Type: "MX", Value: "mail.corp.internal", Preference: 10},
+			{Name: "www", Type: "A", Value: "10.0.0.1"},
+			{Name: "www", Type: "AAAA", Value: "fd00::1"},
+			{Name: "web", Type: "CNAME", Value: "www.corp.internal"},
+			{Name: "info.corp.internal.", Type: "TXT", Value: "hello"},
+		},
+	}
+	// the answer is larger than the 512 bytes UDP message.
+	for i := 0; i < 20; i++ {
+		zones["corp.internal"] = append(zones["corp.internal"],
+			DNSRecord{Name: "big", Type: "TXT", Value: strings.Repeat("x", 64)})
+	}
+
+	// the upstream answers all queries with 192.0.2.1.
+	upstream := exchangerFunc(func(ctx context.Context, query []byte) ([]byte, error) {
+		mq := &dns.Msg{}
+		if err := mq.Unpack(query); err != nil {
+			return nil, err
+		}
+		mr := &dns.Msg{}
+		mr.SetReply(mq)
+		rr, _ := dns.NewRR(mq.Question[0].Name + " 60 IN A 192.0.2.1")
+		mr.Answer = append(mr.Answer, rr)
+		return mr.Pack()
+	})
+
+	srv, err := InternalDNSServer("127.0.0.1:0", zones, UpstreamInternalDNSOption(upstream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rcode  int
+		answer []string
+	}{
+		{"www.corp.internal.", dns.TypeA, dns.RcodeSuccess, []string{"10.0.0.1"}},
+		{"WWW.Corp.Internal.", dns.TypeAAAA, dns.RcodeSuccess, []string{"fd00::1"}},
+		{"web.corp.internal.", dns.TypeA, dns.RcodeSuccess, []string{"www.corp.internal.", "10.0.0.1"}},
+		{"corp.internal.", dns.TypeMX, dns.RcodeSuccess, []string{"mail.corp.internal."}},
+		{"corp.internal.", dns.TypeSOA, dns.RcodeSuccess, []string{"ns.corp.internal."}},
+		{"info.corp.internal.", dns.TypeTXT, dns.RcodeSuccess, []string{"hello"}},
+		{"www.corp.internal.", dns.TypeTXT, dns.RcodeSuccess, nil},
+		{"nonexistent.corp.internal.", dns.TypeA, dns.RcodeNameError, nil},
+		{"example.com.", dns.TypeA, dns.RcodeSuccess, []string{"192.0.2.1"}},
+	}
+
+	client := &dns.Client{}
+	for _, tc := range tests {
+		mq := &dns.Msg{}
+		mq.SetQuestion(tc.name, tc.qtype)
+		mr, _, err := client.Exchange(mq, srv.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mr.Rcode != tc.rcode {
+			t.Errorf("%s %s: got rcode %s, want %s", tc.name, dns.TypeToString[tc.qtype],
+				dns.RcodeToString[mr.Rcode], dns.RcodeToString[tc.rcode])
+		}
+		// the negative answer carries the SOA of the zone.
+		if tc.answer == nil {
+			if len(mr.Ns) != 1 || mr.Ns[0].Header().Rrtype != dns.TypeSOA {
+				t.Errorf("%s %s: got authority %v, want SOA", tc.name, dns.TypeToString[tc.qtype], mr.Ns)
+			}
+		}
+		if len(mr.Answer) != len(tc.answer) {
+			t.Errorf("%s %s: got %d answers, want %d", tc.name, dns.TypeToString[tc.qtype], len(mr.Answer), len(tc.answer))
+			continue
+		}
+		for i, rr := range mr.Answer {
+			var v string
+			switch rr := rr.(type) {
+			case *dns.A:
+				v = rr.A.String()
+			case *dns.AAAA:
+				v = rr.AAAA.String()
+			case *dns.CNAME:
+				v = rr.Target
+			case *dns.MX:
+				v = rr.Mx
+			case *dns.TXT:
+				v = rr.Txt[0]
+			case *dns.SOA:
+				v = rr.Ns
+			}
+			if v != tc.answer[i] {
+				t.Errorf("%s %s: got answer %s, want %s", tc.name, dns.TypeToString[tc.qtype], v, tc.answer[i])
+			}
+		}
+	}
+
+	// the large answer is truncated over UDP, and the full answer is served over TCP.
+	mq := &dns.Msg{}
+	mq.SetQuestion("big.corp.internal.", dns.TypeTXT)
+	mr, _, err := client.Exchange(mq, srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Truncated || len(mr.Answer) >= 20 {
+		t.Errorf("UDP: got truncated %v with %d answers", mr.Truncated, len(mr.Answer))
+	}
+	tcpClient := &dns.Client{Net: "tcp"}
+	mr, _, err = tcpClient.Exchange(mq, srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.Truncated || len(mr.Answer) != 20 {
+		t.Errorf("TCP: got truncated %v with %d answers", mr.Truncated, len(mr.Answer))
+	}
+}
+
+func TestInternalDNSServerClose(t *testing.T) {
+	srv, err := InternalDNSServer("127.0.0.1:0", map[string][]DNSRecord{
+		"corp.internal": {{Name: "www", Type: "A", Value: "10.0.0.1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.Addr().String()
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the address can be reused after the server is closed.
+	srv, err = InternalDNSServer(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+}
+
+func TestInternalDNSServerInvalidRecord(t *testing.T) {
+	for _, r := range []DNSRecord{
+		{Name: "www", Type: "A", Value: "fd00::1"},
+		{Name: "www", Type: "AAAA", Value: "10.0.0.1"},
+		{Name: "www", Type: "SRV", Value: "www.corp.internal"},
+		{Name: "www.example.com.", Type: "A", Value: "10.0.0.1"},
+	} {
+		srv, err := InternalDNSServer("127.0.0.1:0", map[string][]DNSRecord{"corp.internal": {r}})
+		if err == nil {
+			srv.Close()
+			t.Errorf("%s %s %s: should failed", r.Name, r.Type, r.Value)
+		}
+	}
+}